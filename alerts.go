@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"screenshot-tool/config"
+	"screenshot-tool/delivery"
+	"screenshot-tool/screenshot"
+)
+
+// chatMaxAlerts is the number of alerts listed in a chat message
+const chatMaxAlerts = 20
+
+// runAlert is an alert rule matched by a URL of a run
+type runAlert struct {
+	Rule     string `json:"rule"`
+	Type     string `json:"type"`
+	URL      string `json:"url"` // Name of the URL
+	Viewport string `json:"viewport,omitempty"`
+	Message  string `json:"message"`
+
+	notify []string // Notifications the rule routes to, all if empty
+}
+
+// alertReport is the notification body of the alerts of a run
+type alertReport struct {
+	Run       string     `json:"run"`
+	Label     string     `json:"label,omitempty"`
+	Kind      string     `json:"kind"`
+	Schedule  string     `json:"schedule,omitempty"`
+	OutputDir string     `json:"outputDir"`
+	Alerts    []runAlert `json:"alerts"`
+}
+
+// alertHook returns a callback that checks the alert rules against the artifacts of a
+// finished run and sends the matches to the notification channels the rules route to,
+// or nil if there are no rules
+func alertHook(ctx context.Context, cfg *config.Config, journal *delivery.Journal) func(*screenshot.RunSummary) {
+	if len(cfg.Alerts) == 0 {
+		return nil
+	}
+
+	return func(summary *screenshot.RunSummary) {
+		alerts := evaluateAlerts(cfg.Alerts, summary)
+		if len(alerts) == 0 {
+			return
+		}
+		for _, a := range alerts {
+			log.Printf("ALERT: %s: %s: %s", a.Rule, a.URL, a.Message)
+		}
+
+		// Still alert about runs that ended because of a shutdown
+		ctx := context.WithoutCancel(ctx)
+
+		for _, notification := range cfg.Notifications {
+			if !reportsRun(notification, summary) {
+				continue
+			}
+
+			var routed []runAlert
+			for _, a := range alerts {
+				if len(a.notify) == 0 || slices.Contains(a.notify, notification.Name) {
+					routed = append(routed, a)
+				}
+			}
+			if len(routed) == 0 {
+				continue
+			}
+
+			report := alertReport{
+				Run:       summary.Run,
+				Label:     summary.Label,
+				Kind:      summary.Kind,
+				Schedule:  summary.Schedule,
+				OutputDir: summary.OutputDir,
+				Alerts:    routed,
+			}
+			var body any = report
+			switch notification.Type {
+			case "slack":
+				body = slackAlertMessage(report)
+			case "teams":
+				body = teamsAlertMessage(report)
+			}
+
+			if err := delivery.Notify(ctx, journal, notification, body); err != nil {
+				log.Printf("ERROR: Failed to send alerts to %s: %v", notification.URL, err)
+				continue
+			}
+			log.Printf("Sent %d alerts to %s", len(routed), notification.URL)
+		}
+	}
+}
+
+// evaluateAlerts checks each rule against the manifests and cookie logs of the URLs of a run
+func evaluateAlerts(rules []config.AlertRule, summary *screenshot.RunSummary) []runAlert {
+	var alerts []runAlert
+
+	for _, result := range summary.URLs {
+		if result.Dir == "" {
+			continue
+		}
+		urlDir := filepath.Join(summary.OutputDir, filepath.FromSlash(result.Dir))
+
+		var manifest *screenshot.Manifest
+		if data, err := os.ReadFile(filepath.Join(urlDir, "manifest.json")); err == nil {
+			manifest = &screenshot.Manifest{}
+			if err := json.Unmarshal(data, manifest); err != nil {
+				log.Printf("Warning: Failed to read manifest of %s for alerts: %v", result.Name, err)
+				manifest = nil
+			}
+		}
+
+		var cookies map[cookieKey]inventoryCookie
+		for _, rule := range rules {
+			if len(rule.URLs) > 0 && !slices.Contains(rule.URLs, result.Name) {
+				continue
+			}
+			newAlert := func(viewport, message string) runAlert {
+				return runAlert{Rule: rule.Name, Type: rule.Type, URL: result.Name, Viewport: viewport, Message: message, notify: rule.Notify}
+			}
+
+			switch rule.Type {
+			case "cookie":
+				if cookies == nil {
+					var err error
+					if cookies, err = readURLCookies(urlDir); err != nil {
+						log.Printf("Warning: Failed to read cookies of %s for alerts: %v", result.Name, err)
+						cookies = make(map[cookieKey]inventoryCookie)
+					}
+				}
+				var matched []string
+				for key := range cookies {
+					if matchesCookieRule(rule, key) {
+						matched = append(matched, fmt.Sprintf("%s (%s)", key.Name, key.Domain))
+					}
+				}
+				slices.Sort(matched)
+				for _, cookie := range matched {
+					alerts = append(alerts, newAlert("", "forbidden cookie "+cookie))
+				}
+
+			case "diff":
+				if manifest == nil {
+					continue
+				}
+				for _, vm := range manifest.Viewports {
+					if vm.Diff == nil || vm.Diff.Status == "missing" {
+						continue
+					}
+					if diff := 1 - vm.Diff.Similarity; diff > rule.MaxDiff {
+						alerts = append(alerts, newAlert(fmt.Sprintf("%dx%d", vm.Width, vm.Height),
+							fmt.Sprintf("%.2f%% of pixels differ from the baseline, more than %.2f%%", diff*100, rule.MaxDiff*100)))
+					}
+				}
+
+			case "pageWeight":
+				if manifest == nil {
+					continue
+				}
+				for _, vm := range manifest.Viewports {
+					if vm.Metrics == nil || vm.Metrics.TransferBytes <= rule.MaxBytes {
+						continue
+					}
+					alerts = append(alerts, newAlert(fmt.Sprintf("%dx%d", vm.Width, vm.Height),
+						fmt.Sprintf("page weighs %d bytes, more than %d", vm.Metrics.TransferBytes, rule.MaxBytes)))
+				}
+			}
+		}
+	}
+
+	return alerts
+}
+
+// matchesCookieRule reports whether a cookie matches the name and domain globs of a cookie rule.
+// Domains are matched without their leading dot.
+func matchesCookieRule(rule config.AlertRule, key cookieKey) bool {
+	if ok, _ := path.Match(rule.Cookie, key.Name); !ok {
+		return false
+	}
+	if rule.Domain == "" {
+		return true
+	}
+	ok, _ := path.Match(strings.TrimPrefix(rule.Domain, "."), strings.TrimPrefix(key.Domain, "."))
+	return ok
+}
+
+// alertLines formats the alerts of a report as list items, up to chatMaxAlerts
+func alertLines(report alertReport, bullet string) []string {
+	var lines []string
+	for i, a := range report.Alerts {
+		if i == chatMaxAlerts {
+			lines = append(lines, fmt.Sprintf("…and %d more", len(report.Alerts)-chatMaxAlerts))
+			break
+		}
+		where := a.URL
+		if a.Viewport != "" {
+			where += " at " + a.Viewport
+		}
+		lines = append(lines, fmt.Sprintf("%s %s: %s — %s", bullet, a.Rule, where, truncate(a.Message, 200)))
+	}
+	return lines
+}
+
+// slackAlertMessage formats the alerts of a run as a Slack incoming webhook message
+func slackAlertMessage(report alertReport) map[string]any {
+	title := fmt.Sprintf("🚨 %d alerts in %s", len(report.Alerts), runTitle(report.Run, report.Label))
+	return map[string]any{
+		"text": title,
+		"blocks": []map[string]any{
+			slackSection("*" + title + "*"),
+			slackSection(strings.Join(alertLines(report, "•"), "\n")),
+		},
+	}
+}
+
+// teamsAlertMessage formats the alerts of a run as a Microsoft Teams message with an Adaptive Card
+func teamsAlertMessage(report alertReport) map[string]any {
+	body := []map[string]any{
+		{"type": "TextBlock", "text": fmt.Sprintf("🚨 %d alerts in %s", len(report.Alerts), runTitle(report.Run, report.Label)), "weight": "Bolder", "size": "Medium", "wrap": true, "color": "Attention"},
+	}
+	for _, line := range alertLines(report, "-") {
+		body = append(body, map[string]any{"type": "TextBlock", "text": line, "wrap": true})
+	}
+
+	return map[string]any{
+		"type": "message",
+		"attachments": []map[string]any{{
+			"contentType": "application/vnd.microsoft.card.adaptive",
+			"content": map[string]any{
+				"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+				"type":    "AdaptiveCard",
+				"version": "1.4",
+				"body":    body,
+			},
+		}},
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"screenshot-tool/config"
+	"screenshot-tool/screenshot"
+)
+
+// apiKeyError is a request refused because of its API key, with the HTTP status it's answered with
+type apiKeyError struct {
+	status     int
+	message    string
+	retryAfter time.Duration // When the request may be sent again, for rate limited requests
+}
+
+func (e *apiKeyError) Error() string {
+	return e.message
+}
+
+// apiUsage counts the URLs each team captured on a day, kept in outputDir/.api-usage.json
+// so restarting the server doesn't reset the quotas
+type apiUsage struct {
+	Date     string         `json:"date"`     // UTC day, YYYY-MM-DD
+	Captured map[string]int `json:"captured"` // URLs captured by API key name
+}
+
+// apiTenants authenticates requests to the capture endpoints with the configured API keys
+// and enforces the limits of each key
+type apiTenants struct {
+	tenants   []*apiTenant
+	usagePath string
+
+	mu    sync.Mutex
+	usage apiUsage
+}
+
+// apiTenant is a team with its API key, whose captures are written below its prefix
+type apiTenant struct {
+	config.APIKey
+	screenshoter *screenshot.Screenshoter
+	registry     *apiTenants
+
+	mu       sync.Mutex
+	tokens   float64 // Requests the rate limit allows right now
+	refilled time.Time
+}
+
+// newAPITenants creates a screenshoter for each API key, writing to the key's prefix and
+// sharing the standby browser. It returns nil if no keys are configured.
+func newAPITenants(cfg *config.Config, standby *screenshot.Standby, afterURL func(config.URLConfig, string)) (*apiTenants, error) {
+	if len(cfg.APIKeys) == 0 {
+		return nil, nil
+	}
+
+	t := &apiTenants{usagePath: filepath.Join(cfg.OutputDir, ".api-usage.json")}
+	if data, err := os.ReadFile(t.usagePath); err == nil {
+		if err := json.Unmarshal(data, &t.usage); err != nil {
+			log.Printf("Warning: Ignoring invalid API usage file %s: %v", t.usagePath, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	for _, apiKey := range cfg.APIKeys {
+		tenantCfg := *cfg
+		tenantCfg.OutputDir = filepath.Join(cfg.OutputDir, apiKey.Prefix)
+		if err := os.MkdirAll(tenantCfg.OutputDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create output directory of API key %s: %w", apiKey.Name, err)
+		}
+		screenshoter := screenshot.NewScreenshoter(&tenantCfg)
+		if standby != nil {
+			screenshoter.UseStandby(standby)
+		}
+		screenshoter.AfterURL = afterURL
+
+		t.tenants = append(t.tenants, &apiTenant{
+			APIKey:       apiKey,
+			screenshoter: screenshoter,
+			registry:     t,
+			tokens:       float64(apiKey.RateLimit),
+			refilled:     time.Now(),
+		})
+	}
+	return t, nil
+}
+
+// requestAPIKey returns the API key of a request, sent as a bearer token or in X-API-Key
+func requestAPIKey(header http.Header) string {
+	if key := header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if token, ok := strings.CutPrefix(header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+// authenticate returns the tenant whose API key a request carries
+func (t *apiTenants) authenticate(header http.Header) (*apiTenant, error) {
+	key := requestAPIKey(header)
+	if key == "" {
+		return nil, &apiKeyError{status: http.StatusUnauthorized, message: "API key required"}
+	}
+	// Compare with every key so the time taken doesn't tell which one matched
+	var match *apiTenant
+	for _, tenant := range t.tenants {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(tenant.Key)) == 1 {
+			match = tenant
+		}
+	}
+	if match == nil {
+		return nil, &apiKeyError{status: http.StatusUnauthorized, message: "invalid API key"}
+	}
+	return match, nil
+}
+
+// admit charges a request capturing urls URLs to the tenant's rate limit and daily quota.
+// Requests without a tenant, when no API keys are configured, are always admitted.
+func (tenant *apiTenant) admit(urls int) error {
+	if tenant == nil {
+		return nil
+	}
+
+	if tenant.RateLimit > 0 {
+		tenant.mu.Lock()
+		now := time.Now()
+		perSecond := float64(tenant.RateLimit) / 60
+		tenant.tokens = min(float64(tenant.RateLimit), tenant.tokens+now.Sub(tenant.refilled).Seconds()*perSecond)
+		tenant.refilled = now
+		if tenant.tokens < 1 {
+			wait := time.Duration((1 - tenant.tokens) / perSecond * float64(time.Second))
+			tenant.mu.Unlock()
+			return &apiKeyError{
+				status:     http.StatusTooManyRequests,
+				message:    fmt.Sprintf("rate limit of %d requests per minute exceeded", tenant.RateLimit),
+				retryAfter: wait,
+			}
+		}
+		tenant.tokens--
+		tenant.mu.Unlock()
+	}
+
+	t := tenant.registry
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now().UTC()
+	if today := now.Format("2006-01-02"); t.usage.Date != today || t.usage.Captured == nil {
+		t.usage = apiUsage{Date: today, Captured: make(map[string]int)}
+	}
+	captured := t.usage.Captured[tenant.Name]
+	if tenant.DailyQuota > 0 && captured+urls > tenant.DailyQuota {
+		return &apiKeyError{
+			status:     http.StatusTooManyRequests,
+			message:    fmt.Sprintf("daily quota of %d URLs exceeded, %d captured today", tenant.DailyQuota, captured),
+			retryAfter: now.Truncate(24 * time.Hour).Add(24 * time.Hour).Sub(now),
+		}
+	}
+	t.usage.Captured[tenant.Name] = captured + urls
+	if err := t.save(); err != nil {
+		log.Printf("Warning: Failed to save API usage: %v", err)
+	}
+	return nil
+}
+
+// save writes the usage of the day. The caller holds t.mu.
+func (t *apiTenants) save() error {
+	data, err := json.MarshalIndent(t.usage, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(t.usagePath, data, 0644)
+}
+
+// writeAPIKeyError answers a request refused because of its API key
+func writeAPIKeyError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if keyErr, ok := err.(*apiKeyError); ok {
+		status = keyErr.status
+		if status == http.StatusUnauthorized {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+		}
+		if keyErr.retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(keyErr.retryAfter.Seconds()))))
+		}
+	}
+	http.Error(w, err.Error(), status)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"screenshot-tool/screenshot"
+)
+
+// archiveExtensions maps the formats of -archive to the extension of the archive
+var archiveExtensions = map[string]string{
+	"zip": ".zip",
+	"tar": ".tar.gz",
+}
+
+// archiveRun bundles paths, relative to baseDir, into a compressed archive named base plus the
+// extension of the format. Directories are included with everything in them and missing paths
+// are skipped. Files are added in lexical order of their paths, so archiving the same files
+// always gives the same listing. It returns the path of the archive.
+func archiveRun(format, base, baseDir string, paths []string) (string, error) {
+	var files []string
+	for _, path := range paths {
+		err := filepath.Walk(filepath.Join(baseDir, path), func(file string, info os.FileInfo, err error) error {
+			if os.IsNotExist(err) && file == filepath.Join(baseDir, path) {
+				return nil
+			}
+			if err != nil || info.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(baseDir, file)
+			if err != nil {
+				return err
+			}
+			files = append(files, filepath.ToSlash(rel))
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	sort.Strings(files)
+
+	archivePath := base + archiveExtensions[format]
+	out, err := os.Create(archivePath)
+	if err != nil {
+		return "", err
+	}
+
+	switch format {
+	case "zip":
+		err = writeZip(out, baseDir, files)
+	case "tar":
+		err = writeTarGz(out, baseDir, files)
+	default:
+		err = fmt.Errorf("unknown archive format %q", format)
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(archivePath)
+		return "", err
+	}
+	return archivePath, nil
+}
+
+// writeZip writes files, relative to baseDir, as a deflated ZIP archive
+func writeZip(w io.Writer, baseDir string, files []string) error {
+	zw := zip.NewWriter(w)
+	for _, name := range files {
+		info, err := os.Stat(filepath.Join(baseDir, name))
+		if err != nil {
+			return err
+		}
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		header.Method = zip.Deflate
+
+		entry, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		if err := copyFile(entry, filepath.Join(baseDir, name)); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// writeTarGz writes files, relative to baseDir, as a gzip-compressed tar archive
+func writeTarGz(w io.Writer, baseDir string, files []string) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	for _, name := range files {
+		info, err := os.Stat(filepath.Join(baseDir, name))
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		// Owners of the capture machine mean nothing to the recipient
+		header.Uid, header.Gid, header.Uname, header.Gname = 0, 0, "", ""
+
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if err := copyFile(tw, filepath.Join(baseDir, name)); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// copyFile copies the content of the file at path to w
+func copyFile(w io.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(w, file)
+	return err
+}
+
+// archiveCapture bundles the URL directories of a capture run and its run log into the
+// archive named name in the output directory
+func archiveCapture(format, outputDir, name string, summary *screenshot.RunSummary) {
+	paths := []string{"run.log"}
+	for _, result := range summary.URLs {
+		if result.Dir != "" {
+			paths = append(paths, filepath.FromSlash(result.Dir))
+		}
+	}
+
+	archivePath, err := archiveRun(format, filepath.Join(outputDir, name), outputDir, paths)
+	if err != nil {
+		log.Printf("ERROR: Failed to archive run: %v", err)
+		return
+	}
+	log.Printf("Archived run to %s", archivePath)
+}
+
+// archiveRunDir bundles a run directory, such as a watch iteration, into an archive next to it.
+// Paths in the archive start with the name of the directory.
+func archiveRunDir(format, runDir string) {
+	runDir = filepath.Clean(runDir)
+	archivePath, err := archiveRun(format, runDir, filepath.Dir(runDir), []string{filepath.Base(runDir)})
+	if err != nil {
+		log.Printf("ERROR: Failed to archive %s: %v", runDir, err)
+		return
+	}
+	log.Printf("Archived %s to %s", runDir, archivePath)
+}
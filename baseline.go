@@ -0,0 +1,176 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"screenshot-tool/config"
+	"screenshot-tool/screenshot"
+)
+
+// runBaseline implements the baseline command, which promotes captures to the baselines of diff mode
+func runBaseline(args []string) {
+	usage := func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s baseline approve [flags] <runDir>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s baseline update -filter <name> [flags] [runDir...]\n", os.Args[0])
+		os.Exit(2)
+	}
+	if len(args) == 0 {
+		usage()
+	}
+
+	switch args[0] {
+	case "approve":
+		runBaselineApprove(args[1:])
+	case "update":
+		runBaselineUpdate(args[1:])
+	default:
+		usage()
+	}
+}
+
+// baselineFlags adds the flags shared by the baseline subcommands. The returned function
+// loads the configuration and returns it with the baseline directory to write to.
+func baselineFlags(flags *flag.FlagSet) func() (*config.Config, string) {
+	configPath := flags.String("config", "config.json", "Path to configuration file")
+	baselineDir := flags.String("baseline-dir", "", "Baseline directory, overriding the diff baselineDir of the configuration")
+
+	return func() (*config.Config, string) {
+		cfg, err := config.LoadConfig(*configPath)
+		if err != nil {
+			log.Fatalf("Failed to load configuration: %v", err)
+		}
+		if *baselineDir != "" {
+			return cfg, *baselineDir
+		}
+		if cfg.Diff == nil || cfg.Diff.BaselineDir == "" {
+			log.Fatalf("No baseline directory: configure diff with a baselineDir or use -baseline-dir")
+		}
+		return cfg, cfg.Diff.BaselineDir
+	}
+}
+
+// runBaselineApprove implements baseline approve, which makes the captures of a run the baselines
+func runBaselineApprove(args []string) {
+	flags := flag.NewFlagSet("baseline approve", flag.ExitOnError)
+	load := baselineFlags(flags)
+	filter := flags.String("filter", "", "Only approve URLs whose name matches this pattern, e.g. 'checkout*'")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s baseline approve [flags] <runDir>\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	_, baselineDir := load()
+
+	promoteBaselines(flags.Args(), *filter, baselineDir)
+}
+
+// runBaselineUpdate implements baseline update, which makes the latest captures of the
+// matching URLs the baselines, wherever in the output directory they were captured
+func runBaselineUpdate(args []string) {
+	flags := flag.NewFlagSet("baseline update", flag.ExitOnError)
+	load := baselineFlags(flags)
+	filter := flags.String("filter", "", "Update the URLs whose name matches this pattern, e.g. 'checkout*' (required)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s baseline update -filter <name> [flags] [runDir...]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *filter == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+	cfg, baselineDir := load()
+
+	runDirs := flags.Args()
+	if len(runDirs) == 0 {
+		runDirs = []string{cfg.OutputDir}
+	}
+	promoteBaselines(runDirs, *filter, baselineDir)
+}
+
+// promoteBaselines makes the latest capture of each URL in the run directories whose name
+// matches filter, or of every URL if filter is empty, the baseline of the URL
+func promoteBaselines(runDirs []string, filter, baselineDir string) {
+	if _, err := path.Match(filter, ""); err != nil {
+		log.Fatalf("Invalid filter %q: %v", filter, err)
+	}
+
+	urlDirs, err := latestCaptures(runDirs, filter)
+	if err != nil {
+		log.Fatalf("Failed to find captures: %v", err)
+	}
+	if len(urlDirs) == 0 && filter != "" {
+		log.Fatalf("No captured URLs matching %q found", filter)
+	}
+	if len(urlDirs) == 0 {
+		log.Fatalf("No captured URLs found")
+	}
+
+	promoted, err := screenshot.PromoteToBaselines(urlDirs, baselineDir)
+	for _, baseline := range promoted {
+		log.Printf("Updated baseline %s", baseline)
+	}
+	if err != nil {
+		log.Fatalf("Failed to update baselines: %v", err)
+	}
+	log.Printf("Updated %d baselines of %d URLs in %s", len(promoted), len(urlDirs), baselineDir)
+}
+
+// latestCaptures returns the directory of the latest capture of each URL in the run
+// directories whose name matches filter, sorted by name. A URL captured several times,
+// such as in the output directory of regular runs, uses its latest capture.
+func latestCaptures(runDirs []string, filter string) ([]string, error) {
+	type capture struct {
+		dir       string
+		startedAt time.Time
+	}
+	latest := make(map[string]capture)
+
+	for _, runDir := range runDirs {
+		manifests, err := filepath.Glob(filepath.Join(runDir, "*", "manifest.json"))
+		if err != nil {
+			return nil, err
+		}
+		for _, manifestPath := range manifests {
+			urlDir := filepath.Dir(manifestPath)
+			manifest, err := readManifest(urlDir)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", urlDir, err)
+			}
+			if filter != "" {
+				if ok, _ := path.Match(filter, manifest.Name); !ok {
+					continue
+				}
+			}
+			if previous, ok := latest[manifest.Name]; ok && !manifest.StartedAt.After(previous.startedAt) {
+				continue
+			}
+			latest[manifest.Name] = capture{dir: urlDir, startedAt: manifest.StartedAt}
+		}
+	}
+
+	names := make([]string, 0, len(latest))
+	for name := range latest {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	urlDirs := make([]string, 0, len(names))
+	for _, name := range names {
+		urlDirs = append(urlDirs, latest[name].dir)
+	}
+	return urlDirs, nil
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"screenshot-tool/config"
+	"screenshot-tool/screenshot"
+)
+
+// benchPage is the synthetic page captured by the benchmark. It is tall enough
+// to need several viewport sections and marks itself ready after a short delay.
+const benchPage = `<!DOCTYPE html>
+<html>
+<head>
+<title>Benchmark page %[1]d</title>
+<style>
+body { margin: 0; font-family: sans-serif; }
+section { height: 600px; padding: 40px; box-sizing: border-box; }
+section:nth-child(odd) { background: linear-gradient(135deg, #4a90d9, #9b59b6); color: #fff; }
+section:nth-child(even) { background: linear-gradient(135deg, #f5f5f5, #dcdcdc); }
+</style>
+</head>
+<body>
+%[2]s
+<script>
+setTimeout(() => {
+	const ready = document.createElement('div');
+	ready.id = 'ready';
+	ready.textContent = 'Ready';
+	document.body.prepend(ready);
+}, 300);
+</script>
+</body>
+</html>`
+
+// benchRun is one combination of settings in the benchmark matrix
+type benchRun struct {
+	Concurrency int
+	Strategy    string // "delay" or "selector"
+	Delay       int
+}
+
+// benchResult is the outcome of a benchmark run
+type benchResult struct {
+	benchRun
+	Captures   int // Successful viewport captures
+	Failures   int // URLs that failed
+	Elapsed    time.Duration
+	PeakMemory uint64 // Peak increase of system memory in use during the run, 0 if unknown
+}
+
+// runBench implements the bench command, which captures a synthetic local page
+// across a matrix of settings and reports throughput and memory for each
+func runBench(args []string) {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	chromeMode := flags.String("chrome", "local", "Chrome execution mode: 'local', 'docker', or 'auto'")
+	concurrencies := flags.String("concurrency", "1,2,4", "Comma-separated concurrency levels to test")
+	delays := flags.String("delays", "500,1000", "Comma-separated delays in milliseconds for the delay strategy (0 uses the default of 1000)")
+	strategies := flags.String("strategies", "delay,selector", "Comma-separated wait strategies to test: 'delay', 'selector'")
+	viewportList := flags.String("viewports", "1280x800,375x667", "Comma-separated viewports captured in parallel per URL")
+	pages := flags.Int("pages", 8, "Number of URLs captured per run")
+	sections := flags.Int("sections", 8, "Number of 600px sections on the synthetic page")
+	csvPath := flags.String("csv", "", "Write the results to a CSV file")
+	verbose := flags.Bool("verbose", false, "Show capture logs")
+	flags.Parse(args)
+
+	if *chromeMode != "auto" && *chromeMode != "local" && *chromeMode != "docker" {
+		log.Fatalf("Invalid chrome mode: %s. Must be 'auto', 'local', or 'docker'", *chromeMode)
+	}
+
+	levels, err := parseIntList(*concurrencies)
+	if err != nil {
+		log.Fatalf("Invalid concurrency list: %v", err)
+	}
+	for _, level := range levels {
+		if level < 1 {
+			log.Fatalf("Invalid concurrency list: concurrency must be at least 1")
+		}
+	}
+	delayValues, err := parseIntList(*delays)
+	if err != nil {
+		log.Fatalf("Invalid delay list: %v", err)
+	}
+	viewports, err := parseViewports(*viewportList)
+	if err != nil {
+		log.Fatalf("Invalid viewport list: %v", err)
+	}
+
+	// Build the matrix, the selector strategy doesn't depend on the delay
+	var runs []benchRun
+	for _, level := range levels {
+		for _, strategy := range strings.Split(*strategies, ",") {
+			switch strings.TrimSpace(strategy) {
+			case "delay":
+				for _, d := range delayValues {
+					runs = append(runs, benchRun{Concurrency: level, Strategy: "delay", Delay: d})
+				}
+			case "selector":
+				runs = append(runs, benchRun{Concurrency: level, Strategy: "selector"})
+			default:
+				log.Fatalf("Invalid strategy: %s. Must be 'delay' or 'selector'", strategy)
+			}
+		}
+	}
+
+	// Serve the synthetic page locally
+	var body strings.Builder
+	for i := 1; i <= *sections; i++ {
+		fmt.Fprintf(&body, "<section><h1>Section %d</h1><p>%s</p></section>\n", i, strings.Repeat("Lorem ipsum dolor sit amet. ", 40))
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, _ := strconv.Atoi(r.URL.Query().Get("id"))
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, benchPage, id, body.String())
+	}))
+	defer server.Close()
+
+	outputDir, err := os.MkdirTemp("", "screenshot-bench-")
+	if err != nil {
+		log.Fatalf("Failed to create output directory: %v", err)
+	}
+	defer os.RemoveAll(outputDir)
+
+	log.Printf("Running %d benchmark configurations with %d pages and %d viewports each against %s",
+		len(runs), *pages, len(viewports), server.URL)
+
+	results := make([]benchResult, 0, len(runs))
+	for i, run := range runs {
+		log.Printf("[%d/%d] concurrency=%d strategy=%s delay=%dms", i+1, len(runs), run.Concurrency, run.Strategy, run.Delay)
+
+		result, err := benchOnce(run, server.URL, *pages, viewports, filepath.Join(outputDir, strconv.Itoa(i)), *chromeMode, *verbose)
+		if err != nil {
+			log.Fatalf("Benchmark run failed: %v", err)
+		}
+		results = append(results, result)
+	}
+
+	cleanupDockerContainer()
+	printBenchResults(os.Stdout, results)
+
+	if *csvPath != "" {
+		if err := writeBenchCSV(*csvPath, results); err != nil {
+			log.Fatalf("Failed to write CSV: %v", err)
+		}
+		log.Printf("Wrote benchmark results to %s", *csvPath)
+	}
+}
+
+// benchOnce captures the synthetic page with one combination of settings
+func benchOnce(run benchRun, baseURL string, pages int, viewports []config.Viewport, outputDir, chromeMode string, verbose bool) (benchResult, error) {
+	cfg := config.Config{
+		DefaultViewports: viewports,
+		OutputDir:        outputDir,
+		FileFormat:       "png",
+		Concurrency:      run.Concurrency,
+	}
+	for i := 1; i <= pages; i++ {
+		urlConfig := config.URLConfig{
+			Name:  fmt.Sprintf("bench-%d", i),
+			URL:   fmt.Sprintf("%s/?id=%d", baseURL, i),
+			Delay: run.Delay,
+		}
+		if run.Strategy == "selector" {
+			urlConfig.WaitForSelector = "#ready"
+		}
+		cfg.URLs = append(cfg.URLs, urlConfig)
+	}
+
+	loaded, err := loadGeneratedConfig(cfg, outputDir)
+	if err != nil {
+		return benchResult{}, err
+	}
+	loaded.ChromeMode = chromeMode
+
+	if !verbose {
+		log.SetOutput(io.Discard)
+		defer log.SetOutput(os.Stderr)
+	}
+
+	// Sample memory in use while the run is in progress
+	baseline, memErr := systemMemoryUsed()
+	var peak uint64
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	if memErr == nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ticker := time.NewTicker(250 * time.Millisecond)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-stop:
+					return
+				case <-ticker.C:
+					if used, err := systemMemoryUsed(); err == nil && used > baseline && used-baseline > peak {
+						peak = used - baseline
+					}
+				}
+			}
+		}()
+	}
+
+	// Capture every URL separately to count failures, with the configured concurrency
+	screenshoter := screenshot.NewScreenshoter(loaded)
+	start := time.Now()
+
+	sem := make(chan struct{}, loaded.Concurrency)
+	var mu sync.Mutex
+	failures := 0
+	var captures sync.WaitGroup
+	for _, urlConfig := range loaded.URLs {
+		urlConfig := urlConfig
+		sem <- struct{}{}
+		captures.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				captures.Done()
+			}()
+			if err := screenshoter.CaptureURL(context.Background(), urlConfig); err != nil {
+				mu.Lock()
+				failures++
+				mu.Unlock()
+			}
+		}()
+	}
+	captures.Wait()
+	elapsed := time.Since(start)
+
+	close(stop)
+	wg.Wait()
+
+	return benchResult{
+		benchRun:   run,
+		Captures:   (len(loaded.URLs) - failures) * len(viewports),
+		Failures:   failures,
+		Elapsed:    elapsed,
+		PeakMemory: peak,
+	}, nil
+}
+
+// throughput returns the successful viewport captures per minute of a result
+func (r benchResult) throughput() float64 {
+	return float64(r.Captures) / r.Elapsed.Minutes()
+}
+
+// printBenchResults prints the results as a table and recommends the fastest configuration without failures
+func printBenchResults(w io.Writer, results []benchResult) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CONCURRENCY\tSTRATEGY\tDELAY\tCAPTURES\tFAILED URLS\tTIME\tCAPTURES/MIN\tPEAK MEMORY")
+
+	var best *benchResult
+	for i, r := range results {
+		delay := "-"
+		if r.Strategy == "delay" {
+			delay = fmt.Sprintf("%dms", r.Delay)
+		}
+		memory := "n/a"
+		if r.PeakMemory > 0 {
+			memory = fmt.Sprintf("%.0f MiB", float64(r.PeakMemory)/(1024*1024))
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%d\t%v\t%.1f\t%s\n",
+			r.Concurrency, r.Strategy, delay, r.Captures, r.Failures, r.Elapsed.Round(time.Millisecond), r.throughput(), memory)
+
+		if r.Failures == 0 && (best == nil || r.throughput() > best.throughput()) {
+			best = &results[i]
+		}
+	}
+	tw.Flush()
+
+	if best != nil {
+		fmt.Fprintf(w, "\nFastest configuration without failures: concurrency=%d strategy=%s", best.Concurrency, best.Strategy)
+		if best.Strategy == "delay" {
+			fmt.Fprintf(w, " delay=%dms", best.Delay)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// writeBenchCSV writes the results to a CSV file
+func writeBenchCSV(path string, results []benchResult) error {
+	var b strings.Builder
+	b.WriteString("concurrency,strategy,delay_ms,captures,failed_urls,elapsed_ms,captures_per_min,peak_memory_bytes\n")
+	for _, r := range results {
+		fmt.Fprintf(&b, "%d,%s,%d,%d,%d,%d,%.2f,%d\n",
+			r.Concurrency, r.Strategy, r.Delay, r.Captures, r.Failures, r.Elapsed.Milliseconds(), r.throughput(), r.PeakMemory)
+	}
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
+
+// loadGeneratedConfig loads a generated configuration through a file in dir,
+// so the usual defaults and validation apply
+func loadGeneratedConfig(cfg config.Config, dir string) (*config.Config, error) {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	configPath := filepath.Join(dir, "generated-config.json")
+	if err := os.WriteFile(configPath, data, 0644); err != nil {
+		return nil, err
+	}
+	return config.LoadConfig(configPath)
+}
+
+// parseIntList parses a comma-separated list of positive integers
+func parseIntList(s string) ([]int, error) {
+	var values []int
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		v, err := strconv.Atoi(part)
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("invalid value %q", part)
+		}
+		values = append(values, v)
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("no values given")
+	}
+	return values, nil
+}
+
+// parseViewports parses a comma-separated list of WIDTHxHEIGHT viewports
+func parseViewports(s string) ([]config.Viewport, error) {
+	var viewports []config.Viewport
+	for _, part := range strings.Split(s, ",") {
+		var v config.Viewport
+		if _, err := fmt.Sscanf(strings.TrimSpace(part), "%dx%d", &v.Width, &v.Height); err != nil || v.Width <= 0 || v.Height <= 0 {
+			return nil, fmt.Errorf("invalid viewport %q", part)
+		}
+		viewports = append(viewports, v)
+	}
+	return viewports, nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// systemMemoryUsed returns the memory in use system-wide, which includes Chrome's processes
+func systemMemoryUsed() (uint64, error) {
+	file, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	values := make(map[string]uint64)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		values[strings.TrimSuffix(fields[0], ":")] = kb * 1024
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	total, hasTotal := values["MemTotal"]
+	available, hasAvailable := values["MemAvailable"]
+	if !hasTotal || !hasAvailable {
+		return 0, fmt.Errorf("/proc/meminfo is missing MemTotal or MemAvailable")
+	}
+	return total - available, nil
+}
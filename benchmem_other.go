@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "fmt"
+
+// systemMemoryUsed is only implemented on Linux
+func systemMemoryUsed() (uint64, error) {
+	return 0, fmt.Errorf("system memory usage is not available on this platform")
+}
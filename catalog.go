@@ -0,0 +1,478 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"screenshot-tool/config"
+	"screenshot-tool/screenshot"
+)
+
+// catalogFile is the catalog of runs and captures in the output directory
+const catalogFile = "index.db"
+
+// catalogTimeLayout stores times in UTC, so they sort and compare as text
+const catalogTimeLayout = "2006-01-02T15:04:05Z"
+
+// catalogSchema creates the catalog tables. Directories and paths are relative to the
+// directory of the catalog and use forward slashes.
+const catalogSchema = `PRAGMA journal_mode = WAL;
+CREATE TABLE IF NOT EXISTS runs (
+	id INTEGER PRIMARY KEY,
+	kind TEXT NOT NULL,
+	label TEXT,
+	status TEXT,
+	dir TEXT NOT NULL,
+	started_at TEXT NOT NULL,
+	finished_at TEXT,
+	duration_ms INTEGER,
+	UNIQUE (kind, dir, started_at)
+);
+CREATE TABLE IF NOT EXISTS captures (
+	id INTEGER PRIMARY KEY,
+	run_id INTEGER NOT NULL REFERENCES runs (id),
+	name TEXT NOT NULL,
+	url TEXT NOT NULL,
+	label TEXT,
+	status TEXT,
+	dir TEXT NOT NULL UNIQUE,
+	started_at TEXT NOT NULL,
+	finished_at TEXT,
+	duration_ms INTEGER
+);
+CREATE TABLE IF NOT EXISTS viewports (
+	capture_id INTEGER NOT NULL REFERENCES captures (id),
+	width INTEGER NOT NULL,
+	height INTEGER NOT NULL,
+	mobile INTEGER NOT NULL,
+	orientation TEXT,
+	screenshot TEXT,
+	failure TEXT
+);
+CREATE TABLE IF NOT EXISTS files (
+	capture_id INTEGER NOT NULL REFERENCES captures (id),
+	path TEXT NOT NULL,
+	sha256 TEXT NOT NULL,
+	bytes INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS captures_by_url ON captures (url, started_at);
+CREATE INDEX IF NOT EXISTS viewports_by_capture ON viewports (capture_id);
+CREATE INDEX IF NOT EXISTS files_by_capture ON files (capture_id);
+CREATE INDEX IF NOT EXISTS files_by_sha256 ON files (sha256);
+`
+
+// catalogMu serializes writes to the catalog by runs of this process, such as overlapping scheduled runs
+var catalogMu sync.Mutex
+
+// catalogRun is a run to record in the catalog
+type catalogRun struct {
+	Kind       string
+	Label      string
+	Status     string
+	Dir        string // Run directory
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Captures   []catalogCapture
+}
+
+// catalogCapture is a captured URL to record in the catalog
+type catalogCapture struct {
+	Dir      string // URL directory
+	Status   string
+	Manifest *screenshot.Manifest
+}
+
+// catalogHook returns a callback that records a finished run in the catalog, or nil
+// if the catalog isn't enabled. The catalog is written with the sqlite3 command.
+func catalogHook(cfg *config.Config) func(*screenshot.RunSummary) {
+	if !cfg.Catalog {
+		return nil
+	}
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		log.Printf("Warning: sqlite3 is not installed, runs won't be recorded in the catalog")
+		return nil
+	}
+
+	catalogPath := filepath.Join(cfg.OutputDir, catalogFile)
+	return func(summary *screenshot.RunSummary) {
+		run := catalogRun{
+			Kind:       summary.Kind,
+			Label:      summary.Label,
+			Status:     summary.Status,
+			Dir:        summary.OutputDir,
+			StartedAt:  summary.StartedAt,
+			FinishedAt: summary.FinishedAt,
+		}
+		for _, result := range summary.URLs {
+			if result.Dir == "" {
+				continue
+			}
+			urlDir := filepath.Join(summary.OutputDir, filepath.FromSlash(result.Dir))
+			manifest, err := readManifest(urlDir)
+			if err != nil {
+				log.Printf("Warning: Not cataloging %s: %v", result.Name, err)
+				continue
+			}
+			run.Captures = append(run.Captures, catalogCapture{Dir: urlDir, Status: result.Status, Manifest: manifest})
+		}
+
+		if err := writeCatalog(catalogPath, run); err != nil {
+			log.Printf("ERROR: Failed to record run in catalog %s: %v", catalogPath, err)
+			return
+		}
+		log.Printf("Recorded %d URLs in catalog %s", len(run.Captures), catalogPath)
+	}
+}
+
+// readManifest reads the manifest.json of a URL directory
+func readManifest(urlDir string) (*screenshot.Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(urlDir, "manifest.json"))
+	if err != nil {
+		return nil, err
+	}
+	manifest := &screenshot.Manifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+// writeCatalog records a run in the catalog at catalogPath, creating it if needed.
+// Captures already in the catalog are replaced, so indexing a directory again is harmless.
+func writeCatalog(catalogPath string, run catalogRun) error {
+	root := filepath.Dir(catalogPath)
+
+	var script strings.Builder
+	script.WriteString(".bail on\n.timeout 30000\n")
+	script.WriteString(catalogSchema)
+	script.WriteString("BEGIN;\n")
+
+	runDir := catalogRelPath(root, run.Dir)
+	fmt.Fprintf(&script, "INSERT OR IGNORE INTO runs (kind, label, status, dir, started_at, finished_at, duration_ms) VALUES (%s, %s, %s, %s, %s, %s, %d);\n",
+		sqlQuote(run.Kind), sqlQuote(run.Label), sqlQuote(run.Status), sqlQuote(runDir),
+		sqlTime(run.StartedAt), sqlTime(run.FinishedAt), run.FinishedAt.Sub(run.StartedAt).Milliseconds())
+	runID := fmt.Sprintf("(SELECT id FROM runs WHERE kind = %s AND dir = %s AND started_at = %s)",
+		sqlQuote(run.Kind), sqlQuote(runDir), sqlTime(run.StartedAt))
+
+	for _, capture := range run.Captures {
+		manifest := capture.Manifest
+		dir := sqlQuote(catalogRelPath(root, capture.Dir))
+		captureID := fmt.Sprintf("(SELECT id FROM captures WHERE dir = %s)", dir)
+
+		fmt.Fprintf(&script, "DELETE FROM viewports WHERE capture_id = %s;\n", captureID)
+		fmt.Fprintf(&script, "DELETE FROM files WHERE capture_id = %s;\n", captureID)
+		fmt.Fprintf(&script, "DELETE FROM captures WHERE dir = %s;\n", dir)
+		fmt.Fprintf(&script, "INSERT INTO captures (run_id, name, url, label, status, dir, started_at, finished_at, duration_ms) VALUES (%s, %s, %s, %s, %s, %s, %s, %s, %d);\n",
+			runID, sqlQuote(manifest.Name), sqlQuote(manifest.URL), sqlQuote(manifest.Label), sqlQuote(capture.Status), dir,
+			sqlTime(manifest.StartedAt), sqlTime(manifest.FinishedAt), manifest.FinishedAt.Sub(manifest.StartedAt).Milliseconds())
+
+		for _, vm := range manifest.Viewports {
+			name := fmt.Sprintf("%dx%d", vm.Width, vm.Height)
+			var screenshotPath, failure string
+			if matches, _ := filepath.Glob(filepath.Join(capture.Dir, name, fmt.Sprintf("*-full-%s.*", name))); len(matches) > 0 {
+				sort.Strings(matches)
+				screenshotPath = catalogRelPath(root, matches[len(matches)-1])
+			}
+			if vm.Failure != nil {
+				failure = vm.Failure.Stage
+			}
+			mobile := 0
+			if vm.Mobile {
+				mobile = 1
+			}
+			fmt.Fprintf(&script, "INSERT INTO viewports (capture_id, width, height, mobile, orientation, screenshot, failure) VALUES (%s, %d, %d, %d, %s, %s, %s);\n",
+				captureID, vm.Width, vm.Height, mobile, sqlQuote(vm.Orientation), sqlQuote(screenshotPath), sqlQuote(failure))
+		}
+
+		// Use the digests recorded at capture time if there are any, they are the evidence
+		checksums := manifest.Checksums
+		if checksums == nil {
+			var err error
+			if checksums, err = screenshot.ChecksumDir(capture.Dir); err != nil {
+				return fmt.Errorf("failed to hash artifacts of %s: %w", capture.Dir, err)
+			}
+		}
+		paths := make([]string, 0, len(checksums))
+		for path := range checksums {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			var size int64
+			if info, err := os.Stat(filepath.Join(capture.Dir, filepath.FromSlash(path))); err == nil {
+				size = info.Size()
+			}
+			fmt.Fprintf(&script, "INSERT INTO files (capture_id, path, sha256, bytes) VALUES (%s, %s, %s, %d);\n",
+				captureID, sqlQuote(catalogRelPath(root, filepath.Join(capture.Dir, filepath.FromSlash(path)))), sqlQuote(checksums[path]), size)
+		}
+	}
+	script.WriteString("COMMIT;\n")
+
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return err
+	}
+	cmd := exec.Command("sqlite3", catalogPath)
+	cmd.Stdin = strings.NewReader(script.String())
+	var stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stderr, &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("sqlite3: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// catalogRelPath returns path relative to the catalog directory with forward slashes
+func catalogRelPath(root, path string) string {
+	absRoot, rootErr := filepath.Abs(root)
+	absPath, pathErr := filepath.Abs(path)
+	if rootErr == nil && pathErr == nil {
+		if rel, err := filepath.Rel(absRoot, absPath); err == nil {
+			path = rel
+		}
+	}
+	return filepath.ToSlash(path)
+}
+
+// sqlQuote quotes a string as an SQL literal
+func sqlQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// sqlTime quotes a time as an SQL literal in the catalog's time format
+func sqlTime(t time.Time) string {
+	return sqlQuote(t.UTC().Format(catalogTimeLayout))
+}
+
+// runCatalog implements the catalog command, which finds captures in the catalog of runs
+func runCatalog(args []string) {
+	usage := func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s catalog <list|query|index> [flags]\n", os.Args[0])
+		os.Exit(2)
+	}
+	if len(args) == 0 {
+		usage()
+	}
+
+	switch args[0] {
+	case "list":
+		runCatalogList(args[1:])
+	case "query":
+		runCatalogQuery(args[1:])
+	case "index":
+		runCatalogIndex(args[1:])
+	default:
+		usage()
+	}
+}
+
+// catalogFlags adds the flags that locate the catalog to a catalog subcommand
+func catalogFlags(flags *flag.FlagSet) func() string {
+	configPath := flags.String("config", "config.json", "Path to configuration file, whose output directory holds the catalog")
+	dbPath := flags.String("db", "", "Path of the catalog, overriding the one of the configuration")
+
+	return func() string {
+		if *dbPath != "" {
+			return *dbPath
+		}
+		cfg, err := config.LoadConfig(*configPath)
+		if err != nil {
+			log.Fatalf("Failed to load configuration: %v", err)
+		}
+		return filepath.Join(cfg.OutputDir, catalogFile)
+	}
+}
+
+// runCatalogList implements catalog list, which lists the captured viewports matching the filters
+func runCatalogList(args []string) {
+	flags := flag.NewFlagSet("catalog list", flag.ExitOnError)
+	catalogPath := catalogFlags(flags)
+	url := flags.String("url", "", "Only list URLs containing this text, e.g. /pricing")
+	name := flags.String("name", "", "Only list URLs with this name")
+	label := flags.String("label", "", "Only list captures of runs with this label")
+	from := flags.String("from", "", "Only list captures started on or after this date (YYYY-MM-DD) or time (RFC 3339)")
+	to := flags.String("to", "", "Only list captures started on or before this date (YYYY-MM-DD) or time (RFC 3339)")
+	viewport := flags.String("viewport", "", "Only list this viewport, as a width (1366) or size (1366x768)")
+	status := flags.String("status", "", "Only list captures with this status, e.g. failed")
+	limit := flags.Int("limit", 100, "Maximum number of captures listed, 0 for all")
+	flags.Parse(args)
+
+	conditions := []string{"1"}
+	if *url != "" {
+		conditions = append(conditions, fmt.Sprintf("instr(c.url, %s) > 0", sqlQuote(*url)))
+	}
+	if *name != "" {
+		conditions = append(conditions, "c.name = "+sqlQuote(*name))
+	}
+	if *label != "" {
+		conditions = append(conditions, "c.label = "+sqlQuote(*label))
+	}
+	if *from != "" {
+		start, _, err := parseCatalogTime(*from)
+		if err != nil {
+			log.Fatalf("Invalid -from: %v", err)
+		}
+		conditions = append(conditions, "c.started_at >= "+sqlTime(start))
+	}
+	if *to != "" {
+		end, isDate, err := parseCatalogTime(*to)
+		if err != nil {
+			log.Fatalf("Invalid -to: %v", err)
+		}
+		// A date includes the whole day
+		if isDate {
+			conditions = append(conditions, "c.started_at < "+sqlTime(end.AddDate(0, 0, 1)))
+		} else {
+			conditions = append(conditions, "c.started_at <= "+sqlTime(end))
+		}
+	}
+	if *viewport != "" {
+		width, height, hasHeight := strings.Cut(*viewport, "x")
+		w, err := strconv.Atoi(width)
+		h, heightErr := strconv.Atoi(height)
+		if err != nil || (hasHeight && heightErr != nil) {
+			log.Fatalf("Invalid -viewport %q, must be a width or WIDTHxHEIGHT", *viewport)
+		}
+		conditions = append(conditions, fmt.Sprintf("v.width = %d", w))
+		if hasHeight {
+			conditions = append(conditions, fmt.Sprintf("v.height = %d", h))
+		}
+	}
+	if *status != "" {
+		conditions = append(conditions, "c.status = "+sqlQuote(*status))
+	}
+
+	query := fmt.Sprintf(`SELECT c.started_at AS captured, c.name, c.url, v.width || 'x' || v.height AS viewport, c.status, coalesce(nullif(v.screenshot, ''), c.dir) AS screenshot
+FROM captures c JOIN viewports v ON v.capture_id = c.id
+WHERE %s
+ORDER BY c.started_at DESC, c.name, v.width, v.height`, strings.Join(conditions, " AND "))
+	if *limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", *limit)
+	}
+
+	if err := queryCatalog(catalogPath(), query); err != nil {
+		log.Fatalf("Failed to list captures: %v", err)
+	}
+}
+
+// parseCatalogTime parses a date in local time or an RFC 3339 time, reporting whether it was a date
+func parseCatalogTime(value string) (time.Time, bool, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return t, false, err
+}
+
+// runCatalogQuery implements catalog query, which runs a read-only SQL query on the catalog
+func runCatalogQuery(args []string) {
+	flags := flag.NewFlagSet("catalog query", flag.ExitOnError)
+	catalogPath := catalogFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s catalog query [flags] <sql>\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if err := queryCatalog(catalogPath(), flags.Arg(0)); err != nil {
+		log.Fatalf("Query failed: %v", err)
+	}
+}
+
+// queryCatalog runs a query on the catalog with the sqlite3 command, printing the result as a table
+func queryCatalog(catalogPath, query string) error {
+	if _, err := os.Stat(catalogPath); err != nil {
+		return fmt.Errorf("no catalog at %s, enable catalog in the configuration or run catalog index", catalogPath)
+	}
+	cmd := exec.Command("sqlite3", "-readonly", "-bail", "-header", "-column", catalogPath, query)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	return cmd.Run()
+}
+
+// runCatalogIndex implements catalog index, which adds the captures of existing run
+// directories to the catalog, one run per directory
+func runCatalogIndex(args []string) {
+	flags := flag.NewFlagSet("catalog index", flag.ExitOnError)
+	catalogPath := catalogFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s catalog index [flags] <runDir>...\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	path := catalogPath()
+
+	for _, runDir := range flags.Args() {
+		run, err := loadCatalogRun(runDir)
+		if err != nil {
+			log.Fatalf("Failed to read run %s: %v", runDir, err)
+		}
+		if err := writeCatalog(path, run); err != nil {
+			log.Fatalf("Failed to index %s: %v", runDir, err)
+		}
+		log.Printf("Indexed %d URLs of %s in %s", len(run.Captures), runDir, path)
+	}
+}
+
+// loadCatalogRun reads the URL directories of a run directory as a run of kind "indexed",
+// spanning its captures
+func loadCatalogRun(runDir string) (catalogRun, error) {
+	run := catalogRun{Kind: "indexed", Status: "passed", Dir: runDir}
+
+	manifests, err := filepath.Glob(filepath.Join(runDir, "*", "manifest.json"))
+	if err != nil {
+		return run, err
+	}
+	if len(manifests) == 0 {
+		return run, fmt.Errorf("no captured URLs found")
+	}
+	sort.Strings(manifests)
+
+	for _, manifestPath := range manifests {
+		urlDir := filepath.Dir(manifestPath)
+		manifest, err := readManifest(urlDir)
+		if err != nil {
+			return run, fmt.Errorf("%s: %w", urlDir, err)
+		}
+
+		status := "passed"
+		for _, vm := range manifest.Viewports {
+			if vm.Failure != nil {
+				status = "failed"
+				run.Status = "failed"
+			}
+		}
+		if run.StartedAt.IsZero() || manifest.StartedAt.Before(run.StartedAt) {
+			run.StartedAt = manifest.StartedAt
+		}
+		if manifest.FinishedAt.After(run.FinishedAt) {
+			run.FinishedAt = manifest.FinishedAt
+		}
+		if run.Label == "" {
+			run.Label = manifest.Label
+		}
+		run.Captures = append(run.Captures, catalogCapture{Dir: urlDir, Status: status, Manifest: manifest})
+	}
+	return run, nil
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"screenshot-tool/screenshot"
+)
+
+// Limits that keep chat messages short
+const (
+	chatMaxURLs       = 10 // URLs listed individually
+	chatMaxThumbnails = 3  // Diagnostic screenshots shown inline
+)
+
+// chatURL is a URL listed in a chat message
+type chatURL struct {
+	Name   string
+	Status string
+	Error  string
+	Link   string // Uploaded failure report or manifest, empty if not uploaded
+}
+
+// chatThumbnail is an image shown in a chat message
+type chatThumbnail struct {
+	Title string
+	URL   string
+}
+
+// chatContent is what Slack and Teams messages show of a run summary
+type chatContent struct {
+	Title      string
+	Counts     string
+	Error      string
+	URLs       []chatURL
+	More       int // Failing URLs not listed
+	Thumbnails []chatThumbnail
+}
+
+// loadFailureReport reads the failure report of a URL in a run, returning it and its raw content
+func loadFailureReport(summary *screenshot.RunSummary, result screenshot.URLResult) (*screenshot.FailureReport, []byte, error) {
+	data, err := os.ReadFile(filepath.Join(summary.OutputDir, filepath.FromSlash(result.Failure)))
+	if err != nil {
+		return nil, nil, err
+	}
+	var report screenshot.FailureReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, nil, err
+	}
+	return &report, data, nil
+}
+
+// runTitle names a run in chat messages, with its label if it has one
+func runTitle(run, label string) string {
+	if label == "" {
+		return run
+	}
+	return fmt.Sprintf("%s (%s)", run, label)
+}
+
+// newChatContent selects what chat messages show of a run: the counts, the URLs that
+// didn't pass with links to their reports, and thumbnails of their diagnostic screenshots
+// if the uploaded artifacts are public
+func newChatContent(summary *screenshot.RunSummary, links artifactLinks) chatContent {
+	content := chatContent{
+		Title: fmt.Sprintf("✅ %s passed", runTitle(summary.Run, summary.Label)),
+		Counts: fmt.Sprintf("%d URLs: %d passed, %d failed, %d quarantined, in %v",
+			summary.Total, summary.Passed, summary.Failed, summary.Quarantined,
+			summary.FinishedAt.Sub(summary.StartedAt).Round(time.Second)),
+		Error: summary.Error,
+	}
+	if summary.Status == "failed" {
+		content.Title = fmt.Sprintf("❌ %s failed", runTitle(summary.Run, summary.Label))
+	}
+	if summary.Cost != nil {
+		content.Counts += fmt.Sprintf(", estimated cost %.2f %s", summary.Cost.Total, summary.Cost.Currency)
+	}
+
+	for _, result := range summary.URLs {
+		if result.Status == "passed" {
+			continue
+		}
+		if len(content.URLs) == chatMaxURLs {
+			content.More++
+			continue
+		}
+
+		report := result.Manifest
+		if result.Failure != "" {
+			report = result.Failure
+		}
+		content.URLs = append(content.URLs, chatURL{
+			Name:   result.Name,
+			Status: result.Status,
+			Error:  result.Error,
+			Link:   links.location(summary.OutputDir, report),
+		})
+
+		if result.Failure == "" || len(content.Thumbnails) == chatMaxThumbnails {
+			continue
+		}
+		failure, _, err := loadFailureReport(summary, result)
+		if err != nil {
+			continue
+		}
+		for _, viewport := range failure.Viewports {
+			if viewport.Screenshot == "" || len(content.Thumbnails) == chatMaxThumbnails {
+				continue
+			}
+			if url := links.public(summary.OutputDir, path.Join(result.Dir, viewport.Screenshot)); url != "" {
+				content.Thumbnails = append(content.Thumbnails, chatThumbnail{
+					Title: fmt.Sprintf("%s at %dx%d", result.Name, viewport.Width, viewport.Height),
+					URL:   url,
+				})
+			}
+		}
+	}
+
+	return content
+}
+
+// slackMessage formats a run summary as a Slack incoming webhook message
+func slackMessage(summary *screenshot.RunSummary, links artifactLinks) map[string]any {
+	content := newChatContent(summary, links)
+
+	text := "*" + content.Title + "*\n" + content.Counts
+	if content.Error != "" && len(content.URLs) == 0 {
+		text += "\n" + content.Error
+	}
+	blocks := []map[string]any{slackSection(text)}
+
+	if len(content.URLs) > 0 {
+		var lines []string
+		for _, u := range content.URLs {
+			name := u.Name
+			if strings.HasPrefix(u.Link, "http") {
+				name = fmt.Sprintf("<%s|%s>", u.Link, u.Name)
+			} else if u.Link != "" {
+				name = fmt.Sprintf("%s (`%s`)", u.Name, u.Link)
+			}
+			lines = append(lines, fmt.Sprintf("• %s: %s — %s", name, u.Status, truncate(u.Error, 200)))
+		}
+		if content.More > 0 {
+			lines = append(lines, fmt.Sprintf("…and %d more", content.More))
+		}
+		blocks = append(blocks, slackSection(strings.Join(lines, "\n")))
+	}
+
+	for _, thumbnail := range content.Thumbnails {
+		blocks = append(blocks, map[string]any{
+			"type":      "image",
+			"image_url": thumbnail.URL,
+			"alt_text":  thumbnail.Title,
+			"title":     map[string]any{"type": "plain_text", "text": thumbnail.Title},
+		})
+	}
+
+	return map[string]any{
+		"text":   content.Title, // Shown in notifications, which don't render blocks
+		"blocks": blocks,
+	}
+}
+
+// slackSection returns a Slack section block with Markdown text
+func slackSection(text string) map[string]any {
+	return map[string]any{
+		"type": "section",
+		"text": map[string]any{"type": "mrkdwn", "text": text},
+	}
+}
+
+// teamsMessage formats a run summary as a Microsoft Teams message with an Adaptive Card
+func teamsMessage(summary *screenshot.RunSummary, links artifactLinks) map[string]any {
+	content := newChatContent(summary, links)
+
+	body := []map[string]any{
+		{"type": "TextBlock", "text": content.Title, "weight": "Bolder", "size": "Medium", "wrap": true},
+		{"type": "TextBlock", "text": content.Counts, "wrap": true},
+	}
+	if content.Error != "" && len(content.URLs) == 0 {
+		body = append(body, map[string]any{"type": "TextBlock", "text": content.Error, "wrap": true, "color": "Attention"})
+	}
+
+	for _, u := range content.URLs {
+		name := u.Name
+		if strings.HasPrefix(u.Link, "http") {
+			name = fmt.Sprintf("[%s](%s)", u.Name, u.Link)
+		} else if u.Link != "" {
+			name = fmt.Sprintf("%s (`%s`)", u.Name, u.Link)
+		}
+		body = append(body, map[string]any{
+			"type": "TextBlock",
+			"text": fmt.Sprintf("- %s: %s — %s", name, u.Status, truncate(u.Error, 200)),
+			"wrap": true,
+		})
+	}
+	if content.More > 0 {
+		body = append(body, map[string]any{"type": "TextBlock", "text": fmt.Sprintf("…and %d more", content.More), "wrap": true})
+	}
+
+	for _, thumbnail := range content.Thumbnails {
+		body = append(body, map[string]any{
+			"type":    "Image",
+			"url":     thumbnail.URL,
+			"altText": thumbnail.Title,
+			"size":    "Large",
+		})
+	}
+
+	return map[string]any{
+		"type": "message",
+		"attachments": []map[string]any{{
+			"contentType": "application/vnd.microsoft.card.adaptive",
+			"content": map[string]any{
+				"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+				"type":    "AdaptiveCard",
+				"version": "1.4",
+				"body":    body,
+			},
+		}},
+	}
+}
+
+// truncate shortens text to at most n runes
+func truncate(text string, n int) string {
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	return string(runes[:n-1]) + "…"
+}
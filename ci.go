@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"screenshot-tool/screenshot"
+)
+
+// Exit codes of a run with -ci
+const (
+	exitPassed   = 0 // Every URL was captured and matched its baseline
+	exitFailed   = 1 // A capture or the run failed
+	exitMismatch = 3 // Every capture succeeded but some didn't match their baselines
+)
+
+// ciSummary is the machine-readable outcome of a run printed with -ci
+type ciSummary struct {
+	Status      string                 `json:"status"` // "passed", "failed" or "mismatch"
+	ExitCode    int                    `json:"exitCode"`
+	Error       string                 `json:"error,omitempty"` // Error that ended the run before all URLs were captured
+	OutputDir   string                 `json:"outputDir"`
+	Total       int                    `json:"total"`
+	Passed      int                    `json:"passed"`
+	Failed      int                    `json:"failed"`      // URLs whose capture failed
+	Mismatched  int                    `json:"mismatched"`  // URLs that didn't match their baselines
+	Quarantined int                    `json:"quarantined"` // Failed quarantined URLs, which don't fail the run
+	Failures    []screenshot.URLResult `json:"failures"`    // Failed and mismatching URLs in configuration order
+}
+
+// exitCI prints the summary of a run as a single line of JSON to stderr, after everything
+// else the run logged, and exits with the code that tells CI how the run went
+func exitCI(summary *screenshot.RunSummary, runErr error) {
+	ci := ciSummary{
+		Status:      "passed",
+		ExitCode:    exitPassed,
+		OutputDir:   summary.OutputDir,
+		Total:       summary.Total,
+		Passed:      summary.Passed,
+		Quarantined: summary.Quarantined,
+		Failures:    []screenshot.URLResult{},
+	}
+	for _, result := range summary.URLs {
+		switch result.Status {
+		case "passed", "quarantined":
+			continue
+		case "mismatch":
+			ci.Mismatched++
+		default:
+			ci.Failed++
+		}
+		ci.Failures = append(ci.Failures, result)
+	}
+
+	// URLs that weren't captured at all, e.g. after an interrupt, count as failures too
+	completed := ci.Passed + ci.Failed + ci.Mismatched + ci.Quarantined
+	switch {
+	case ci.Failed > 0 || completed < ci.Total:
+		ci.Status, ci.ExitCode = "failed", exitFailed
+	case ci.Mismatched > 0:
+		ci.Status, ci.ExitCode = "mismatch", exitMismatch
+	case runErr != nil:
+		ci.Status, ci.ExitCode = "failed", exitFailed
+	}
+	if runErr != nil && completed < ci.Total {
+		ci.Error = runErr.Error()
+	}
+
+	data, err := json.Marshal(ci)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "{\"status\":\"failed\",\"exitCode\":%d,\"error\":%q}\n", exitFailed, err.Error())
+		os.Exit(exitFailed)
+	}
+	fmt.Fprintln(os.Stderr, string(data))
+	os.Exit(ci.ExitCode)
+}
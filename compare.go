@@ -0,0 +1,368 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"screenshot-tool/config"
+	"screenshot-tool/screenshot"
+)
+
+// comparison records the result of a compare run in comparison.json of its directory
+type comparison struct {
+	Base       string           `json:"base"`  // Base URL of the reference environment
+	Other      string           `json:"other"` // Base URL of the environment compared with it
+	Label      string           `json:"label,omitempty"`
+	StartedAt  time.Time        `json:"startedAt"`
+	FinishedAt time.Time        `json:"finishedAt"`
+	Identical  int              `json:"identical"`
+	Different  int              `json:"different"`
+	Failed     int              `json:"failed"` // Viewports not captured in one of the environments
+	Pairs      []comparisonPair `json:"pairs"`
+}
+
+// comparisonPair is a viewport of a URL captured in both environments. Paths are relative
+// to the directory of the compare run.
+type comparisonPair struct {
+	Name     string                 `json:"name"`
+	Path     string                 `json:"path"` // Path and query captured in both environments
+	Viewport string                 `json:"viewport"`
+	Status   string                 `json:"status"` // "identical", "different" or "failed"
+	Base     string                 `json:"base,omitempty"`
+	Other    string                 `json:"other,omitempty"`
+	Triptych string                 `json:"triptych,omitempty"` // Base, other and heatmap side by side
+	Heatmap  string                 `json:"heatmap,omitempty"`
+	Diff     *screenshot.DiffResult `json:"diff,omitempty"`
+	Error    string                 `json:"error,omitempty"`
+}
+
+// runCompare implements the compare command, which captures the configured pages on two
+// environments and compares each capture of the other environment with the one of the base
+func runCompare(args []string) {
+	flags := flag.NewFlagSet("compare", flag.ExitOnError)
+	configPath := flags.String("config", "config.json", "Path to configuration file")
+	chromeMode := flags.String("chrome", "auto", "Chrome execution mode: 'local', 'docker', or 'auto'")
+	filter := flags.String("filter", "", "Only compare URLs whose name matches this pattern, e.g. 'checkout*'")
+	label := flags.String("label", "", "Label of the comparison, added to its directory name")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s compare [flags] <baseURL> <otherURL>\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "  e.g. %s compare https://www.example.com https://staging.example.com\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if *chromeMode != "auto" && *chromeMode != "local" && *chromeMode != "docker" {
+		log.Fatalf("Invalid chrome mode: %s. Must be 'auto', 'local', or 'docker'", *chromeMode)
+	}
+	if _, err := path.Match(*filter, ""); err != nil {
+		log.Fatalf("Invalid filter %q: %v", *filter, err)
+	}
+
+	base, err := parseBaseURL(flags.Arg(0))
+	if err != nil {
+		log.Fatalf("Invalid base URL %s: %v", flags.Arg(0), err)
+	}
+	other, err := parseBaseURL(flags.Arg(1))
+	if err != nil {
+		log.Fatalf("Invalid base URL %s: %v", flags.Arg(1), err)
+	}
+	baseName, otherName := environmentName(base), environmentName(other)
+	if baseName == otherName {
+		log.Fatalf("The base URLs %s and %s point to the same environment", base, other)
+	}
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	cfg.ChromeMode = *chromeMode
+	cfg.Label = strings.TrimSpace(*label)
+	logConfigWarnings(cfg)
+
+	if *filter != "" {
+		var urls []config.URLConfig
+		for _, urlConfig := range cfg.URLs {
+			if ok, _ := path.Match(*filter, urlConfig.Name); ok {
+				urls = append(urls, urlConfig)
+			}
+		}
+		cfg.URLs = urls
+	}
+	if len(cfg.URLs) == 0 {
+		log.Fatalf("No URLs to compare")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signalChan
+		log.Printf("Received signal: %v, shutting down gracefully", sig)
+		cancel()
+	}()
+
+	result, compareDir, err := compareEnvironments(ctx, cfg, base, other)
+	cleanupDockerContainer()
+	if err != nil {
+		log.Fatalf("Comparison failed: %v", err)
+	}
+
+	log.Printf("Compared %s with %s: %d viewports identical, %d different, %d failed",
+		result.Other, result.Base, result.Identical, result.Different, result.Failed)
+	for _, pair := range result.Pairs {
+		switch pair.Status {
+		case "different":
+			log.Printf("  %s at %s differs, %s: %s", pair.Name, pair.Viewport, pair.Diff.Score(), filepath.Join(compareDir, filepath.FromSlash(pair.Triptych)))
+		case "failed":
+			log.Printf("  %s at %s failed: %s", pair.Name, pair.Viewport, pair.Error)
+		}
+	}
+	log.Printf("Comparison written to %s", filepath.Join(compareDir, "comparison.json"))
+
+	switch {
+	case ctx.Err() != nil || result.Failed > 0:
+		os.Exit(exitFailed)
+	case result.Different > 0:
+		os.Exit(exitMismatch)
+	}
+}
+
+// compareEnvironments captures the URLs of the configuration on the base environment, makes
+// the captures the baselines of a capture on the other environment, and records the pairs.
+// Both runs are written to outputDir/compare/timestamp, in a directory named after their
+// environment.
+func compareEnvironments(ctx context.Context, cfg *config.Config, base, other *url.URL) (*comparison, string, error) {
+	result := &comparison{Base: base.String(), Other: other.String(), Label: cfg.Label, StartedAt: time.Now()}
+
+	compareDir := filepath.Join(cfg.OutputDir, "compare", result.StartedAt.Format("20060102-150405"))
+	if cfg.Label != "" {
+		compareDir += "_" + screenshot.SanitizeFilename(cfg.Label)
+	}
+	baselineDir := filepath.Join(compareDir, ".baselines")
+
+	baseCfg, err := rebaseConfig(cfg, base)
+	if err != nil {
+		return nil, compareDir, err
+	}
+	baseCfg.OutputDir = filepath.Join(compareDir, environmentName(base))
+	baseCfg.Diff = nil
+	captureRun(ctx, baseCfg, "Compare "+base.Host, nil, nil, nil)
+	if ctx.Err() != nil {
+		return nil, compareDir, ctx.Err()
+	}
+
+	// Captures that failed on the base environment leave their pages without a baseline,
+	// which the other environment's captures report as missing
+	if err := screenshot.CopyRunToBaselines(baseCfg.OutputDir, baselineDir); err != nil {
+		return nil, compareDir, fmt.Errorf("failed to keep the captures of %s: %w", base.Host, err)
+	}
+
+	otherCfg, err := rebaseConfig(cfg, other)
+	if err != nil {
+		return nil, compareDir, err
+	}
+	otherCfg.OutputDir = filepath.Join(compareDir, environmentName(other))
+	diff := config.Diff{Threshold: 0.999, SSIMThreshold: 0.98, MaxHashDistance: 5}
+	if cfg.Diff != nil {
+		diff = *cfg.Diff
+	}
+	diff.BaselineDir = baselineDir
+	otherCfg.Diff = &diff
+	captureRun(ctx, otherCfg, "Compare "+other.Host, nil, nil, nil)
+	if ctx.Err() != nil {
+		return nil, compareDir, ctx.Err()
+	}
+
+	result.Pairs = comparisonPairs(compareDir, otherCfg.OutputDir, cfg.URLs)
+	for _, pair := range result.Pairs {
+		switch pair.Status {
+		case "identical":
+			result.Identical++
+		case "different":
+			result.Different++
+		default:
+			result.Failed++
+		}
+	}
+	result.FinishedAt = time.Now()
+
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return nil, compareDir, err
+	}
+	if err := os.WriteFile(filepath.Join(compareDir, "comparison.json"), data, 0644); err != nil {
+		return nil, compareDir, err
+	}
+	return result, compareDir, nil
+}
+
+// comparisonPairs reads the manifests of the other environment's run and pairs each of its
+// viewports with the baseline it was compared to. URLs without a manifest have a single pair
+// for their failed capture.
+func comparisonPairs(compareDir, runDir string, urls []config.URLConfig) []comparisonPair {
+	rel := func(p string) string {
+		if p == "" {
+			return ""
+		}
+		if r, err := filepath.Rel(compareDir, p); err == nil {
+			return filepath.ToSlash(r)
+		}
+		return filepath.ToSlash(p)
+	}
+
+	manifests := make(map[string]string)
+	paths, _ := filepath.Glob(filepath.Join(runDir, "*", "manifest.json"))
+	for _, manifestPath := range paths {
+		if manifest, err := readManifest(filepath.Dir(manifestPath)); err == nil {
+			manifests[manifest.Name] = filepath.Dir(manifestPath)
+		}
+	}
+
+	var pairs []comparisonPair
+	for _, urlConfig := range urls {
+		pagePath := "/"
+		if u, err := url.Parse(urlConfig.URL); err == nil {
+			pagePath = u.RequestURI()
+		}
+
+		urlDir, ok := manifests[urlConfig.Name]
+		var manifest *screenshot.Manifest
+		if ok {
+			manifest, _ = readManifest(urlDir)
+		}
+		if manifest == nil {
+			pairs = append(pairs, comparisonPair{Name: urlConfig.Name, Path: pagePath, Viewport: "-", Status: "failed", Error: "not captured"})
+			continue
+		}
+
+		for _, vm := range manifest.Viewports {
+			viewportName := fmt.Sprintf("%dx%d", vm.Width, vm.Height)
+			viewportDir := filepath.Join(urlDir, viewportName)
+			pair := comparisonPair{Name: urlConfig.Name, Path: pagePath, Viewport: viewportName, Diff: vm.Diff}
+
+			captures, _ := filepath.Glob(filepath.Join(viewportDir, fmt.Sprintf("*-full-%s.*", viewportName)))
+			if len(captures) > 0 {
+				pair.Other = rel(captures[len(captures)-1])
+			}
+
+			switch {
+			case vm.Diff == nil && vm.Failure != nil:
+				pair.Status = "failed"
+				pair.Error = vm.Failure.Stage + " failed"
+				if len(vm.Failure.Errors) > 0 {
+					pair.Error += ": " + vm.Failure.Errors[0]
+				}
+			case vm.Diff == nil:
+				pair.Status, pair.Error = "failed", "not compared"
+			case vm.Diff.Status == "missing":
+				pair.Status, pair.Error = "failed", "not captured in the base environment"
+			case vm.Diff.Status == "mismatch":
+				pair.Status = "different"
+				pair.Base = rel(vm.Diff.Baseline)
+				if vm.Diff.Triptych != "" {
+					pair.Triptych = rel(filepath.Join(viewportDir, vm.Diff.Triptych))
+					pair.Heatmap = rel(filepath.Join(viewportDir, vm.Diff.Heatmap))
+				}
+			default:
+				pair.Status = "identical"
+				pair.Base = rel(vm.Diff.Baseline)
+			}
+			pairs = append(pairs, pair)
+		}
+	}
+	return pairs
+}
+
+// parseBaseURL parses the base URL of an environment, e.g. https://staging.example.com
+func parseBaseURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("scheme must be http or https")
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("missing host")
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return nil, fmt.Errorf("base URLs can't have a query or fragment")
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	u.RawPath = ""
+	return u, nil
+}
+
+// environmentName names the directory of an environment's captures after its base URL
+func environmentName(base *url.URL) string {
+	return screenshot.SanitizeFilename(strings.Trim(base.Host+base.Path, "/"))
+}
+
+// rebaseConfig returns a copy of the configuration whose URLs and login pages point to the
+// environment at base, keeping their paths and queries. Cookies set for the host of a URL
+// are moved to the host of the environment, and logins don't reuse saved sessions.
+func rebaseConfig(cfg *config.Config, base *url.URL) (*config.Config, error) {
+	rebased := *cfg
+	rebased.URLs = make([]config.URLConfig, len(cfg.URLs))
+	for i, urlConfig := range cfg.URLs {
+		u, err := rebaseURL(urlConfig.URL, base)
+		if err != nil {
+			return nil, fmt.Errorf("URL %s: %w", urlConfig.Name, err)
+		}
+		original, _ := url.Parse(urlConfig.URL)
+
+		urlConfig.URL = u
+		urlConfig.Cookies = append([]config.Cookie(nil), urlConfig.Cookies...)
+		for j := range urlConfig.Cookies {
+			cookie := &urlConfig.Cookies[j]
+			if domain := strings.TrimPrefix(cookie.Domain, "."); domain != "" && domain == original.Hostname() {
+				cookie.Domain = strings.TrimSuffix(cookie.Domain, domain) + base.Hostname()
+			}
+		}
+		rebased.URLs[i] = urlConfig
+	}
+
+	rebased.Logins = make([]config.Login, len(cfg.Logins))
+	for i, login := range cfg.Logins {
+		u, err := rebaseURL(login.LoginURL, base)
+		if err != nil {
+			return nil, fmt.Errorf("login %s: %w", login.Name, err)
+		}
+		login.LoginURL = u
+		// A saved session belongs to the environment it was saved from
+		login.StorageState = ""
+		rebased.Logins[i] = login
+	}
+	return &rebased, nil
+}
+
+// rebaseURL moves a URL to the environment at base, prefixing its path with the base's path
+func rebaseURL(raw string, base *url.URL) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	u.Scheme = base.Scheme
+	u.Host = base.Host
+	u.User = base.User
+	u.Path = base.Path + "/" + strings.TrimPrefix(u.Path, "/")
+	u.RawPath = ""
+	return u.String(), nil
+}
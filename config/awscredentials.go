@@ -0,0 +1,252 @@
+package config
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// awsCredentials are the keys requests to AWS are signed with
+type awsCredentials struct {
+	accessKey    string
+	secretKey    string
+	sessionToken string
+}
+
+// metadataClient is used for the instance metadata services, which only answer on cloud
+// machines, so other machines give up on them quickly
+var metadataClient = &http.Client{Timeout: 2 * time.Second}
+
+// loadAWSCredentials finds credentials like the AWS SDKs: static keys from the environment,
+// a web identity token (EKS service accounts), the container credentials of ECS and EKS Pod
+// Identity, the shared credentials file, and the instance profile of an EC2 instance.
+// Credentials are only used while a configuration is loaded, so they aren't refreshed.
+func loadAWSCredentials(region string) (awsCredentials, error) {
+	if accessKey, secretKey := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"); accessKey != "" && secretKey != "" {
+		return awsCredentials{accessKey, secretKey, os.Getenv("AWS_SESSION_TOKEN")}, nil
+	}
+	if tokenFile, roleARN := os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"), os.Getenv("AWS_ROLE_ARN"); tokenFile != "" && roleARN != "" {
+		return awsWebIdentityCredentials(region, tokenFile, roleARN)
+	}
+	if os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI") != "" || os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI") != "" {
+		return awsContainerCredentials()
+	}
+	if creds, ok, err := awsSharedCredentials(); ok || err != nil {
+		return creds, err
+	}
+	if !strings.EqualFold(os.Getenv("AWS_EC2_METADATA_DISABLED"), "true") {
+		if creds, err := awsInstanceCredentials(); err == nil {
+			return creds, nil
+		}
+	}
+	return awsCredentials{}, fmt.Errorf("no AWS credentials found in the environment, a web identity token, container or instance credentials, or the shared credentials file")
+}
+
+// awsWebIdentityCredentials exchanges the web identity token of an EKS service account for
+// the credentials of its role
+func awsWebIdentityCredentials(region, tokenFile, roleARN string) (awsCredentials, error) {
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("failed to read web identity token: %w", err)
+	}
+	sessionName := os.Getenv("AWS_ROLE_SESSION_NAME")
+	if sessionName == "" {
+		sessionName = "screenshot-tool"
+	}
+
+	query := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {roleARN},
+		"RoleSessionName":  {sessionName},
+		"WebIdentityToken": {strings.TrimSpace(string(token))},
+	}
+	resp, err := httpClient.PostForm("https://sts."+region+".amazonaws.com/", query)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("failed to assume role %s: %w", roleARN, err)
+	}
+	data, err := readSecretResponse(resp)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("failed to assume role %s: %w", roleARN, err)
+	}
+
+	var result struct {
+		Credentials struct {
+			AccessKeyID     string `xml:"AccessKeyId"`
+			SecretAccessKey string `xml:"SecretAccessKey"`
+			SessionToken    string `xml:"SessionToken"`
+		} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+	if err := xml.Unmarshal(data, &result); err != nil {
+		return awsCredentials{}, fmt.Errorf("invalid AssumeRoleWithWebIdentity response: %w", err)
+	}
+	creds := result.Credentials
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return awsCredentials{}, fmt.Errorf("AssumeRoleWithWebIdentity response contains no keys")
+	}
+	return awsCredentials{creds.AccessKeyID, creds.SecretAccessKey, creds.SessionToken}, nil
+}
+
+// awsContainerCredentials reads the credentials of an ECS task role or EKS Pod Identity
+// from the container credentials endpoint
+func awsContainerCredentials() (awsCredentials, error) {
+	endpoint := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	if relative := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); relative != "" {
+		endpoint = "http://169.254.170.2" + relative
+	}
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	authorization := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN")
+	if path := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return awsCredentials{}, fmt.Errorf("failed to read container authorization token: %w", err)
+		}
+		authorization = strings.TrimSpace(string(data))
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	creds, err := fetchAWSMetadataCredentials(req)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("failed to read container credentials: %w", err)
+	}
+	return creds, nil
+}
+
+// awsInstanceCredentials reads the credentials of the instance profile of an EC2 instance
+// from the instance metadata service, with a session token (IMDSv2)
+func awsInstanceCredentials() (awsCredentials, error) {
+	endpoint := strings.TrimSuffix(os.Getenv("AWS_EC2_METADATA_SERVICE_ENDPOINT"), "/")
+	if endpoint == "" {
+		endpoint = "http://169.254.169.254"
+	}
+
+	req, err := http.NewRequest(http.MethodPut, endpoint+"/latest/api/token", nil)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "300")
+	resp, err := metadataClient.Do(req)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	token, err := readSecretResponse(resp)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+
+	rolesURL := endpoint + "/latest/meta-data/iam/security-credentials/"
+	req, err = http.NewRequest(http.MethodGet, rolesURL, nil)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", string(token))
+	resp, err = metadataClient.Do(req)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	roles, err := readSecretResponse(resp)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("instance has no instance profile: %w", err)
+	}
+	role, _, _ := strings.Cut(strings.TrimSpace(string(roles)), "\n")
+
+	req, err = http.NewRequest(http.MethodGet, rolesURL+role, nil)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", string(token))
+	return fetchAWSMetadataCredentials(req)
+}
+
+// fetchAWSMetadataCredentials reads credentials in the JSON format of the container and
+// instance metadata services
+func fetchAWSMetadataCredentials(req *http.Request) (awsCredentials, error) {
+	resp, err := metadataClient.Do(req)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	data, err := readSecretResponse(resp)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	var creds struct {
+		AccessKeyID     string `json:"AccessKeyId"`
+		SecretAccessKey string `json:"SecretAccessKey"`
+		Token           string `json:"Token"`
+	}
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return awsCredentials{}, fmt.Errorf("invalid credentials response: %w", err)
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return awsCredentials{}, fmt.Errorf("credentials response contains no keys")
+	}
+	return awsCredentials{creds.AccessKeyID, creds.SecretAccessKey, creds.Token}, nil
+}
+
+// awsSharedCredentials reads the static keys of the profile named by AWS_PROFILE, or the
+// default profile, from the shared credentials file. ok is false if the file or profile
+// doesn't exist or holds no keys, such as profiles assuming roles or using SSO.
+func awsSharedCredentials() (creds awsCredentials, ok bool, err error) {
+	path := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return awsCredentials{}, false, nil
+		}
+		path = filepath.Join(home, ".aws", "credentials")
+	}
+	profile := os.Getenv("AWS_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return awsCredentials{}, false, nil
+		}
+		return awsCredentials{}, false, fmt.Errorf("failed to read AWS credentials: %w", err)
+	}
+	defer file.Close()
+
+	var section string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !found || section != profile {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "aws_access_key_id":
+			creds.accessKey = strings.TrimSpace(value)
+		case "aws_secret_access_key":
+			creds.secretKey = strings.TrimSpace(value)
+		case "aws_session_token":
+			creds.sessionToken = strings.TrimSpace(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return awsCredentials{}, false, fmt.Errorf("failed to read AWS credentials: %w", err)
+	}
+	return creds, creds.accessKey != "" && creds.secretKey != "", nil
+}
@@ -0,0 +1,171 @@
+package config
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// awsSecrets reads secrets from AWS Secrets Manager through its JSON API. Secrets are named
+// by their name or ARN.
+type awsSecrets struct {
+	endpoint     string
+	host         string
+	region       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+}
+
+// newAWSSecrets creates a Secrets Manager provider with the credentials of the environment,
+// see loadAWSCredentials
+func newAWSSecrets(secrets *Secrets) (*awsSecrets, error) {
+	a := &awsSecrets{region: secrets.Region}
+	if a.region == "" {
+		a.region = os.Getenv("AWS_REGION")
+	}
+	if a.region == "" {
+		a.region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if a.region == "" {
+		a.region = "us-east-1"
+	}
+
+	a.endpoint = strings.TrimSuffix(secrets.Endpoint, "/")
+	if a.endpoint == "" {
+		a.endpoint = "https://secretsmanager." + a.region + ".amazonaws.com"
+	}
+	u, err := url.Parse(a.endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid secrets endpoint %s", secrets.Endpoint)
+	}
+	a.host = u.Host
+
+	creds, err := loadAWSCredentials(a.region)
+	if err != nil {
+		return nil, err
+	}
+	a.accessKey, a.secretKey, a.sessionToken = creds.accessKey, creds.secretKey, creds.sessionToken
+	return a, nil
+}
+
+// fetch reads the current version of a secret, or a key of a secret holding a JSON object
+func (a *awsSecrets) fetch(name, key string) (string, error) {
+	body, err := json.Marshal(map[string]string{"SecretId": name})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodPost, a.endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	a.sign(req, body, time.Now().UTC())
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	data, err := readSecretResponse(resp)
+	if err != nil {
+		return "", err
+	}
+
+	var secret struct {
+		SecretString string `json:"SecretString"`
+		SecretBinary string `json:"SecretBinary"`
+	}
+	if err := json.Unmarshal(data, &secret); err != nil {
+		return "", fmt.Errorf("invalid Secrets Manager response: %w", err)
+	}
+	value := secret.SecretString
+	if value == "" && secret.SecretBinary != "" {
+		decoded, err := base64.StdEncoding.DecodeString(secret.SecretBinary)
+		if err != nil {
+			return "", fmt.Errorf("invalid binary secret: %w", err)
+		}
+		value = string(decoded)
+	}
+
+	if key != "" {
+		return secretField(value, key)
+	}
+	return value, nil
+}
+
+// sign adds a Signature Version 4 authorization to a request of the JSON API
+func (a *awsSecrets) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := hex.EncodeToString(sha256Sum(body))
+
+	req.Host = a.host
+	req.Header.Set("X-Amz-Date", amzDate)
+	if a.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", a.sessionToken)
+	}
+
+	headers := []string{"content-type", "host", "x-amz-date"}
+	values := map[string]string{"content-type": req.Header.Get("Content-Type"), "host": a.host, "x-amz-date": amzDate}
+	if a.sessionToken != "" {
+		headers = append(headers, "x-amz-security-token")
+		values["x-amz-security-token"] = a.sessionToken
+	}
+	headers = append(headers, "x-amz-target")
+	values["x-amz-target"] = req.Header.Get("X-Amz-Target")
+
+	var canonicalHeaders strings.Builder
+	for _, h := range headers {
+		canonicalHeaders.WriteString(h + ":" + values[h] + "\n")
+	}
+	signedHeaders := strings.Join(headers, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		"/",
+		"",
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + a.region + "/secretsmanager/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(sha256Sum([]byte(canonicalRequest))),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+a.secretKey), date)
+	key = hmacSHA256(key, a.region)
+	key = hmacSHA256(key, "secretsmanager")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		a.accessKey, scope, signedHeaders, signature))
+}
+
+// sha256Sum returns the SHA-256 hash of data
+func sha256Sum(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data with key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
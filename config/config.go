@@ -3,24 +3,40 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"path"
+	"path/filepath"
+	"regexp"
 	"strings"
+	"time"
+	_ "time/tzdata" // Validate time zones on systems without a zoneinfo database
 )
 
 // Cookie represents a browser cookie to set
 type Cookie struct {
-	Name     string `json:"name"`
-	Value    string `json:"value"`
-	Domain   string `json:"domain,omitempty"`
-	Path     string `json:"path,omitempty"`
-	Secure   bool   `json:"secure,omitempty"`
-	HTTPOnly bool   `json:"httpOnly,omitempty"`
+	Name      string     `json:"name"`
+	Value     string     `json:"value"`
+	ValueFrom *ValueFrom `json:"valueFrom,omitempty"` // Produces the value for each capture instead
+	Domain    string     `json:"domain,omitempty"`
+	Path      string     `json:"path,omitempty"`
+	Secure    bool       `json:"secure,omitempty"`
+	HTTPOnly  bool       `json:"httpOnly,omitempty"`
 }
 
 // LocalStorage represents a localStorage key-value pair to set
 type LocalStorage struct {
-	Key   string `json:"key"`
-	Value string `json:"value"`
+	Key       string     `json:"key"`
+	Value     string     `json:"value"`
+	ValueFrom *ValueFrom `json:"valueFrom,omitempty"` // Produces the value for each capture instead
+}
+
+// ValueFrom produces a cookie or localStorage value when it is set, for values such as
+// short-lived tokens that would expire during a run
+type ValueFrom struct {
+	Command string `json:"command"`           // Shell command whose output, without surrounding whitespace, is the value
+	Timeout int    `json:"timeout,omitempty"` // Maximum time for the command in milliseconds, defaults to 30000
 }
 
 // CookieProfile represents a named set of cookies and localStorage values
@@ -30,45 +46,466 @@ type CookieProfile struct {
 	LocalStorage []LocalStorage `json:"localStorage,omitempty"`
 }
 
+// UserSimulation configures randomized, user-like behavior performed before capture
+type UserSimulation struct {
+	Enabled    bool  `json:"enabled"`
+	Seed       int64 `json:"seed,omitempty"`       // Random seed, picked at startup if not specified
+	Steps      int   `json:"steps,omitempty"`      // Number of scroll and dwell rounds
+	MouseMoves int   `json:"mouseMoves,omitempty"` // Mouse movements per round
+	MinDwell   int   `json:"minDwell,omitempty"`   // Minimum dwell time in milliseconds
+	MaxDwell   int   `json:"maxDwell,omitempty"`   // Maximum dwell time in milliseconds
+}
+
+// Proxy configures an upstream HTTP proxy, optionally with authentication
+type Proxy struct {
+	URL            string   `json:"url"`                // Proxy address, e.g. http://proxy.example.com:8080
+	Auth           string   `json:"auth,omitempty"`     // Authentication scheme: "basic", "ntlm" or "negotiate"
+	Username       string   `json:"username,omitempty"` // May include the domain as DOMAIN\user
+	Password       string   `json:"password,omitempty"`
+	PasswordSecret string   `json:"passwordSecret,omitempty"` // Secret holding the password, see secrets
+	Domain         string   `json:"domain,omitempty"`         // NTLM domain
+	Bypass         []string `json:"bypass,omitempty"`         // Hosts that are accessed directly
+}
+
+// TypeAction types text into an element
+type TypeAction struct {
+	Selector string `json:"selector"`
+	Text     string `json:"text"`
+}
+
+// PrintableCapture captures the page as it would be printed, e.g. a receipt at the end of a checkout
+type PrintableCapture struct {
+	HideSelectors []string `json:"hideSelectors,omitempty"` // Navigation and other chrome hidden from the capture
+}
+
+// TabThrough presses Tab repeatedly, capturing the page at each focus stop
+type TabThrough struct {
+	MaxStops int `json:"maxStops,omitempty"` // Maximum number of focus stops captured, defaults to 20
+}
+
+// Action is a single interaction performed before capture, exactly one field must be set
+type Action struct {
+	Click            string            `json:"click,omitempty"`            // CSS selector of the element to click
+	Type             *TypeAction       `json:"type,omitempty"`             // Text to type into an element
+	ScrollTo         string            `json:"scrollTo,omitempty"`         // CSS selector of the element to scroll into view
+	Hover            string            `json:"hover,omitempty"`            // CSS selector of the element to hover over
+	Wait             int               `json:"wait,omitempty"`             // Pause in milliseconds
+	CapturePrintable *PrintableCapture `json:"capturePrintable,omitempty"` // Print view capture, only allowed as the last action
+	TabThrough       *TabThrough       `json:"tabThrough,omitempty"`       // Keyboard navigation capture of the focus order
+}
+
+// RewriteRule rewrites matching browser requests before they are sent
+type RewriteRule struct {
+	Match    string            `json:"match,omitempty"`    // Regular expression matched against the request URL
+	FromHost string            `json:"fromHost,omitempty"` // Host to match, e.g. cdn.example.com
+	ToHost   string            `json:"toHost,omitempty"`   // Host to send matching requests to instead
+	Headers  map[string]string `json:"headers,omitempty"`  // Headers to add or override on matching requests
+}
+
+// Placeholder replaces the text of matching elements with a fixed string before capture
+type Placeholder struct {
+	Selector string `json:"selector"`        // CSS selector of the elements whose text is replaced
+	Match    string `json:"match,omitempty"` // Regular expression, only matching text is replaced if set
+	Text     string `json:"text"`            // Placeholder text
+}
+
+// Login describes a scripted login flow whose session is shared by all URLs referencing it
+type Login struct {
+	Name             string `json:"name"`
+	LoginURL         string `json:"loginUrl"`
+	Username         string `json:"username"`
+	Password         string `json:"password,omitempty"`
+	PasswordEnv      string `json:"passwordEnv,omitempty"`    // Environment variable holding the password
+	PasswordSecret   string `json:"passwordSecret,omitempty"` // Secret holding the password, see secrets
+	UsernameSelector string `json:"usernameSelector"`
+	PasswordSelector string `json:"passwordSelector"`
+	SubmitSelector   string `json:"submitSelector"`
+	SuccessSelector  string `json:"successSelector,omitempty"` // Element visible once logged in
+	SuccessURL       string `json:"successUrl,omitempty"`      // URL fragment present once logged in
+	Timeout          int    `json:"timeout,omitempty"`         // Maximum time for the login in milliseconds
+	StorageState     string `json:"storageState,omitempty"`    // File the session is saved to and reused from across runs
+}
+
+// WebDriver configures capturing in browsers of a Selenium Grid instead of launching Chrome
+type WebDriver struct {
+	URL            string         `json:"url"`                      // Grid hub address, e.g. http://grid.example.com:4444
+	Capabilities   map[string]any `json:"capabilities,omitempty"`   // Added to the capabilities requested for each session, e.g. platformName
+	SessionTimeout int            `json:"sessionTimeout,omitempty"` // Maximum wait for a free node in milliseconds, defaults to 300000
+}
+
+// Firefox configures the captures of URLs with browser "firefox"
+type Firefox struct {
+	Geckodriver string         `json:"geckodriver,omitempty"` // geckodriver executable, looked up on the PATH by default
+	Binary      string         `json:"binary,omitempty"`      // Firefox executable, found by geckodriver by default
+	Prefs       map[string]any `json:"prefs,omitempty"`       // Preferences set in every Firefox session, e.g. "layout.css.devPixelsPerPx"
+}
+
+// TabPool configures reusing the tabs of the shared browser across captures
+type TabPool struct {
+	Enabled   bool `json:"enabled"`
+	MaxUses   int  `json:"maxUses,omitempty"`   // Captures per tab before it's closed, defaults to 50
+	KeepState bool `json:"keepState,omitempty"` // Keep cookies, storage and cache of a tab between captures
+}
+
+// DockerPool configures spreading Docker Chrome captures over several containers
+type DockerPool struct {
+	Enabled  bool `json:"enabled"`
+	Size     int  `json:"size,omitempty"`     // Number of containers, defaults to concurrency
+	BasePort int  `json:"basePort,omitempty"` // Host port of the first container, the others follow it; defaults to 9223
+}
+
+// Kubernetes configures distributing a run over Kubernetes Jobs with the kube command
+type Kubernetes struct {
+	Image          string   `json:"image"`                    // Worker image with the tool and Chrome
+	Namespace      string   `json:"namespace,omitempty"`      // Namespace of the Jobs, defaults to "default"
+	Context        string   `json:"context,omitempty"`        // kubectl context, defaults to the current one
+	Shards         int      `json:"shards,omitempty"`         // Number of workers the URLs are split over, defaults to 4
+	VolumeClaim    string   `json:"volumeClaim"`              // ReadWriteMany PersistentVolumeClaim the workers write their output to
+	ServiceAccount string   `json:"serviceAccount,omitempty"` // Service account of the worker pods
+	Secrets        []string `json:"secrets,omitempty"`        // Secrets exposed to the workers as environment variables, e.g. upload credentials
+	CPU            string   `json:"cpu,omitempty"`            // CPU requested by each worker, e.g. "2"
+	Memory         string   `json:"memory,omitempty"`         // Memory requested by each worker, e.g. "4Gi"
+}
+
+// Queue configures the work queue the enqueue command fills and workers capture from
+type Queue struct {
+	Type              string `json:"type"`                        // "redis", "nats" or "sqs"
+	URL               string `json:"url"`                         // Server address, e.g. redis://:password@host:6379/0 or nats://host:4222, or the SQS queue URL
+	Name              string `json:"name,omitempty"`              // Redis list or NATS subject of the jobs, defaults to screenshot-tool.jobs
+	Stream            string `json:"stream,omitempty"`            // JetStream stream storing the subject (nats)
+	Consumer          string `json:"consumer,omitempty"`          // Durable pull consumer the workers share (nats)
+	Region            string `json:"region,omitempty"`            // Queue region, defaults to the region of the queue URL (sqs)
+	VisibilityTimeout int    `json:"visibilityTimeout,omitempty"` // Seconds a job is hidden from other workers once received, defaults to 900 (sqs)
+}
+
+// DiskSpace configures the free space check performed before a run
+type DiskSpace struct {
+	Policy  string `json:"policy,omitempty"`  // "abort", "degrade" or "warn" when space is insufficient
+	Reserve int    `json:"reserve,omitempty"` // Space in MB that must remain free after the run
+}
+
+// ImageLimits caps the size of individual screenshot files
+type ImageLimits struct {
+	MaxWidth  int    `json:"maxWidth,omitempty"`  // Maximum width in pixels
+	MaxHeight int    `json:"maxHeight,omitempty"` // Maximum height in pixels
+	MaxPixels int64  `json:"maxPixels,omitempty"` // Maximum width × height
+	MaxBytes  int64  `json:"maxBytes,omitempty"`  // Maximum file size in bytes
+	Fallback  string `json:"fallback,omitempty"`  // "reencode" or "downscale" for files over maxBytes
+}
+
+// Diff configures comparison of full page captures against baseline screenshots
+type Diff struct {
+	BaselineDir     string         `json:"baselineDir"`               // Directory holding a baseline screenshot per URL and viewport
+	Mode            string         `json:"mode,omitempty"`            // "pixel", "ssim" or "phash" comparison for all URLs, defaults to "pixel"
+	Threshold       float64        `json:"threshold,omitempty"`       // Minimum similarity (0-1) to match the baseline, defaults to 0.999
+	SSIMThreshold   float64        `json:"ssimThreshold,omitempty"`   // Minimum structural similarity (0-1) to match in ssim mode, defaults to 0.98
+	MaxHashDistance int            `json:"maxHashDistance,omitempty"` // Largest perceptual hash distance (0-64) to match in phash mode, defaults to 5
+	Retry           *DiffRetry     `json:"retry,omitempty"`           // Re-capture once with an alternate wait strategy on a mismatch
+	Tolerance       *DiffTolerance `json:"tolerance,omitempty"`       // Differences ignored by the comparison, for all URLs
+}
+
+// DiffTolerance relaxes the comparison with the baseline so rendering noise doesn't count as a change
+type DiffTolerance struct {
+	MaxChangedPercent  float64 `json:"maxChangedPercent,omitempty"`  // Largest percentage of changed pixels that still matches, replaces the threshold
+	PixelTolerance     int     `json:"pixelTolerance,omitempty"`     // Largest difference (0-255) of a color channel for pixels to count as identical
+	IgnoreAntialiasing bool    `json:"ignoreAntialiasing,omitempty"` // Don't count pixels that differ by anti-aliasing of edges and text
+}
+
+// DiffRetry is the readiness strategy used to re-capture a page that didn't match its baseline
+type DiffRetry struct {
+	Delay           int    `json:"delay,omitempty"`           // Delay in milliseconds, defaults to three times the URL's delay
+	WaitForSelector string `json:"waitForSelector,omitempty"` // CSS selector to wait for instead of the delay
+	WaitTimeout     int    `json:"waitTimeout,omitempty"`     // Maximum wait for the selector in milliseconds
+}
+
+// Quarantine configures automatic quarantining of URLs whose captures keep mismatching their baselines
+type Quarantine struct {
+	AutoAfter    int `json:"autoAfter,omitempty"`    // Consecutive baseline mismatches before a URL is quarantined, 0 disables
+	ReleaseAfter int `json:"releaseAfter,omitempty"` // Consecutive passing runs before an auto-quarantined URL is released, defaults to 3
+}
+
+// Accessibility configures the accessibility audit run after capture
+type Accessibility struct {
+	Enabled   bool   `json:"enabled"`
+	AxeScript string `json:"axeScript,omitempty"` // Path to axe.min.js, the built-in checks are used if not specified
+}
+
+// InteractiveMap configures the diagnostic screenshot outlining the interactive elements of a page
+type InteractiveMap struct {
+	Enabled       bool `json:"enabled"`
+	MinTargetSize int  `json:"minTargetSize,omitempty"` // Smallest acceptable target in CSS pixels, defaults to 24
+}
+
+// ScrollRecording configures an animated recording of the page scrolling from top to bottom
+type ScrollRecording struct {
+	Enabled  bool   `json:"enabled"`
+	Format   string `json:"format,omitempty"`   // "gif" or "webm", defaults to gif
+	Duration int    `json:"duration,omitempty"` // Length of the scroll in milliseconds, defaults to 5000
+	FPS      int    `json:"fps,omitempty"`      // Frames per second, defaults to 10
+	MaxWidth int    `json:"maxWidth,omitempty"` // Width the frames are scaled down to, defaults to 800
+}
+
+// VideoRecording configures a video of the whole capture session of each viewport
+type VideoRecording struct {
+	Enabled  bool   `json:"enabled"`
+	Format   string `json:"format,omitempty"`   // "webm" or "gif", defaults to webm
+	FPS      int    `json:"fps,omitempty"`      // Frames per second, defaults to 5
+	MaxWidth int    `json:"maxWidth,omitempty"` // Width the frames are scaled down to, defaults to 800
+}
+
+// Geolocation is the position reported to pages through the Geolocation API
+type Geolocation struct {
+	Latitude  float64 `json:"lat"`
+	Longitude float64 `json:"lon"`
+	Accuracy  float64 `json:"accuracy,omitempty"` // Accuracy in meters, defaults to 100
+}
+
+// Throttling slows down the network of the browser
+type Throttling struct {
+	Profile  string `json:"profile,omitempty"`  // "slow-3g" or "fast-3g", the settings below override its values
+	Latency  int    `json:"latency,omitempty"`  // Added round trip time in milliseconds
+	Download int    `json:"download,omitempty"` // Download bandwidth in kbit/s
+	Upload   int    `json:"upload,omitempty"`   // Upload bandwidth in kbit/s
+}
+
+// throttlingProfiles are the presets of the Chrome DevTools network panel
+var throttlingProfiles = map[string]Throttling{
+	"slow-3g": {Latency: 2000, Download: 400, Upload: 400},
+	"fast-3g": {Latency: 563, Download: 1440, Upload: 675},
+}
+
+// Upload configures remote storage that run artifacts are uploaded to
+type Upload struct {
+	Type        string            `json:"type"`                // Storage backend: "s3", "gcs" or "azure"
+	Bucket      string            `json:"bucket,omitempty"`    // Bucket the artifacts are stored in (s3, gcs)
+	Container   string            `json:"container,omitempty"` // Blob container the artifacts are stored in (azure)
+	Account     string            `json:"account,omitempty"`   // Storage account, defaults to AZURE_STORAGE_ACCOUNT (azure)
+	Prefix      string            `json:"prefix,omitempty"`    // Key prefix, e.g. proofs/nightly
+	Region      string            `json:"region,omitempty"`    // Bucket region, defaults to AWS_REGION (s3)
+	Endpoint    string            `json:"endpoint,omitempty"`  // Custom endpoint, e.g. for S3-compatible storage or an emulator
+	PublicURL   string            `json:"publicUrl,omitempty"` // URL the prefix is served at, used to link artifacts in notifications
+	Secrets     map[string]string `json:"secrets,omitempty"`   // Credential environment variables read from secrets instead, e.g. AWS_SECRET_ACCESS_KEY
+	Credentials map[string]string `json:"-"`                   // Values of the secrets, resolved when the configuration is loaded
+}
+
+// Credential returns a credential of the upload, resolved from its secrets or read from the
+// environment variable of the same name
+func (upload Upload) Credential(name string) string {
+	if value, ok := upload.Credentials[name]; ok {
+		return value
+	}
+	return os.Getenv(name)
+}
+
+// Notification configures a channel that is sent the run summary when a run finishes
+type Notification struct {
+	Name    string            `json:"name,omitempty"`    // Name that alert rules route to
+	Type    string            `json:"type"`              // Channel type: "webhook", "slack" or "teams"
+	URL     string            `json:"url"`               // Endpoint the summary is posted to, the incoming webhook for Slack and Teams
+	Headers map[string]string `json:"headers,omitempty"` // Extra request headers, e.g. Authorization
+	On      string            `json:"on,omitempty"`      // "always" (default) or "failure"
+	Runs    []string          `json:"runs,omitempty"`    // Runs reported: "capture", "watch", "deployment", schedule or trigger names, all if empty
+}
+
+// Trigger configures an inbound webhook that captures a set of URLs in server mode
+type Trigger struct {
+	Name   string   `json:"name"`             // Names the endpoint, /trigger/name, and the directory the runs are written to
+	Secret string   `json:"secret,omitempty"` // Shared secret the request is signed or authenticated with
+	URLs   []string `json:"urls,omitempty"`   // Names of the URLs to capture, all URLs if not specified
+}
+
+// APIKey grants a team access to the capture endpoints of server mode, with its own limits
+// and output directory
+type APIKey struct {
+	Name       string `json:"name"`                 // Team the key belongs to, named in the logs
+	Key        string `json:"key"`                  // Secret sent as a bearer token or in the X-API-Key header
+	Prefix     string `json:"prefix,omitempty"`     // Directory below outputDir the team's captures are written to, defaults to the name
+	RateLimit  int    `json:"rateLimit,omitempty"`  // Requests per minute, unlimited if 0
+	DailyQuota int    `json:"dailyQuota,omitempty"` // URLs captured per day (UTC), unlimited if 0
+}
+
+// Deployments configures the before and after captures server mode runs around announced deployments
+type Deployments struct {
+	BeforeMinutes int      `json:"beforeMinutes,omitempty"` // Minutes before the deployment the before capture starts
+	AfterMinutes  int      `json:"afterMinutes,omitempty"`  // Minutes after the deployment the after capture starts, defaults to 10
+	URLs          []string `json:"urls,omitempty"`          // Names of the URLs to capture, all URLs if not specified
+}
+
+// AlertRule configures a condition checked in the artifacts of each URL after a run
+type AlertRule struct {
+	Name     string   `json:"name"`               // Name shown in alerts
+	Type     string   `json:"type"`               // Condition: "cookie", "diff" or "pageWeight"
+	Cookie   string   `json:"cookie,omitempty"`   // Glob of forbidden cookie names (cookie)
+	Domain   string   `json:"domain,omitempty"`   // Glob the cookie's domain must match, any domain if empty (cookie)
+	MaxDiff  float64  `json:"maxDiff,omitempty"`  // Largest acceptable fraction of pixels differing from the baseline (diff)
+	MaxBytes int64    `json:"maxBytes,omitempty"` // Largest acceptable transfer size of a page load (pageWeight)
+	URLs     []string `json:"urls,omitempty"`     // Names of the URLs checked, all if empty
+	Notify   []string `json:"notify,omitempty"`   // Names of the notifications alerted, all if empty
+}
+
+// Issues configures filing issues for URLs that keep failing in scheduled runs
+type Issues struct {
+	Type       string   `json:"type"`             // Issue tracker: "github" or "gitlab"
+	Repository string   `json:"repository"`       // owner/repo on GitHub, project path or ID on GitLab
+	APIURL     string   `json:"apiUrl,omitempty"` // API base URL for GitHub Enterprise or self-managed GitLab
+	After      int      `json:"after,omitempty"`  // Consecutive failed scheduled runs before an issue is filed, defaults to 3
+	Labels     []string `json:"labels,omitempty"` // Labels of filed issues
+}
+
+// Review configures reporting CI runs on the commit and pull or merge request they belong to
+type Review struct {
+	Type       string `json:"type"`                 // Code host: "github" or "gitlab"
+	Repository string `json:"repository,omitempty"` // owner/repo on GitHub, project path or ID on GitLab, defaults to that of the CI run
+	APIURL     string `json:"apiUrl,omitempty"`     // API base URL for GitHub Enterprise or self-managed GitLab, defaults to the API of the CI run
+	Context    string `json:"context,omitempty"`    // Name of the commit status, defaults to "screenshot-tool"
+	ReportURL  string `json:"reportUrl,omitempty"`  // Page the status and comment link to, defaults to the page of the CI run or job
+	Comment    string `json:"comment,omitempty"`    // "failures", "always" or "never" to comment on the pull or merge request, defaults to "failures"
+}
+
+// Costs are the prices used to estimate the cost of a run
+type Costs struct {
+	TransferPerGB     float64 `json:"transferPerGB"`             // Price per GB the browser downloads, e.g. NAT gateway or proxy traffic
+	StoragePerGBMonth float64 `json:"storagePerGBMonth"`         // Price per GB of artifacts stored for a month
+	RetentionMonths   float64 `json:"retentionMonths,omitempty"` // Months the artifacts are kept, defaults to 1
+	Currency          string  `json:"currency,omitempty"`        // Currency of the prices, defaults to USD
+}
+
 // URLConfig represents configuration for a single URL to capture
 type URLConfig struct {
-	Name            string         `json:"name"`
-	URL             string         `json:"url"`
-	Viewports       []Viewport     `json:"viewports,omitempty"`
-	Delay           int            `json:"delay,omitempty"` // Delay in milliseconds
-	Cookies         []Cookie       `json:"cookies,omitempty"`
-	LocalStorage    []LocalStorage `json:"localStorage,omitempty"`
-	CookieProfileID string         `json:"cookieProfileId,omitempty"` // Reference to a cookie profile
+	Name            string            `json:"name"`
+	URL             string            `json:"url"`
+	Viewports       []Viewport        `json:"viewports,omitempty"`
+	Delay           int               `json:"delay,omitempty"` // Delay in milliseconds
+	Cookies         []Cookie          `json:"cookies,omitempty"`
+	LocalStorage    []LocalStorage    `json:"localStorage,omitempty"`
+	CookieProfileID string            `json:"cookieProfileId,omitempty"` // Reference to a cookie profile
+	Samples         int               `json:"samples,omitempty"`         // Number of full page captures per viewport
+	SampleInterval  int               `json:"sampleInterval,omitempty"`  // Interval between samples in milliseconds
+	UserSimulation  *UserSimulation   `json:"userSimulation,omitempty"`  // Randomized user behavior before capture
+	WaitForSelector string            `json:"waitForSelector,omitempty"` // CSS selector that must be visible before capture
+	WaitTimeout     int               `json:"waitTimeout,omitempty"`     // Maximum wait for the selector in milliseconds
+	Proxy           *Proxy            `json:"proxy,omitempty"`           // Proxy for this URL, overrides the global proxy
+	Actions         []Action          `json:"actions,omitempty"`         // Interactions performed before capture
+	Rewrites        []RewriteRule     `json:"rewrites,omitempty"`        // Request rewrite rules, applied after the global rules
+	DNSOverrides    map[string]string `json:"dnsOverrides,omitempty"`    // Hostname to IP mappings, merged over the global ones
+	Extensions      []string          `json:"extensions,omitempty"`      // Unpacked Chrome extension directories, overrides the global extensions
+	ChromeFlags     []string          `json:"chromeFlags,omitempty"`     // Chrome command line flags added after the global flags, e.g. "--lang=de"
+	LoginID         string            `json:"loginId,omitempty"`         // Reference to a login flow
+	StorageState    string            `json:"storageState,omitempty"`    // Storage state file imported before capture
+	HideSelectors   []string          `json:"hideSelectors,omitempty"`   // Elements hidden before capture
+	MaskSelectors   []string          `json:"maskSelectors,omitempty"`   // Elements blocked out before capture
+	Placeholders    []Placeholder     `json:"placeholders,omitempty"`    // Dynamic text replaced with fixed strings before capture
+	ChromeMode      string            `json:"chromeMode,omitempty"`      // "local", "docker" or "auto", overrides the command line mode
+	Browser         string            `json:"browser,omitempty"`         // "chrome" (default) or "firefox"
+	Timezone        string            `json:"timezone,omitempty"`        // IANA time zone the page is rendered in, e.g. "Europe/Berlin"
+	Geolocation     *Geolocation      `json:"geolocation,omitempty"`     // Position reported to the page, with the geolocation permission granted
+	Throttling      *Throttling       `json:"throttling,omitempty"`      // Network throttling, overrides the global throttling
+	HAR             bool              `json:"har,omitempty"`             // Record network traffic to a HAR file
+	Trace           bool              `json:"trace,omitempty"`           // Record a DevTools performance trace of the page load
+	Minimap         bool              `json:"minimap,omitempty"`         // Mark the page position on each viewport section screenshot
+	Accessibility   *Accessibility    `json:"accessibility,omitempty"`   // Accessibility audit, overrides the global audit settings
+	Flaky           bool              `json:"flaky,omitempty"`           // Quarantined: failures are reported separately and don't fail the run
+	InteractiveMap  *InteractiveMap   `json:"interactiveMap,omitempty"`  // Interactive elements map, overrides the global settings
+	ScrollRecording *ScrollRecording  `json:"scrollRecording,omitempty"` // Animated scroll recording, overrides the global settings
+	Video           *VideoRecording   `json:"video,omitempty"`           // Session video, overrides the global settings
+	DiffTolerance   *DiffTolerance    `json:"diffTolerance,omitempty"`   // Baseline comparison tolerance, overrides the global tolerance
+	DiffMode        string            `json:"diffMode,omitempty"`        // Baseline comparison mode, overrides the global mode
 }
 
 // Viewport represents browser viewport dimensions
 type Viewport struct {
-	Width  int `json:"width"`
-	Height int `json:"height"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	Mobile      bool   `json:"mobile,omitempty"`      // Emulate a mobile device, so the page's meta viewport applies
+	Touch       bool   `json:"touch,omitempty"`       // Enable touch events
+	Orientation string `json:"orientation,omitempty"` // "portrait" (default) or "landscape" screen orientation
+
+	// Overrides of the URL's cookies and localStorage items with the same name, for this viewport only
+	Cookies      []Cookie       `json:"cookies,omitempty"`
+	LocalStorage []LocalStorage `json:"localStorage,omitempty"`
 }
 
 // Config represents the application configuration
 type Config struct {
-	URLs             []URLConfig     `json:"urls"`
-	URLList          []string        `json:"urlList,omitempty"` // Simple list of URLs
-	DefaultViewports []Viewport      `json:"defaultViewports"`
-	DefaultDelay     int             `json:"defaultDelay,omitempty"` // Default delay for urlList items
-	DefaultCookies   []Cookie        `json:"defaultCookies,omitempty"`
-	DefaultStorage   []LocalStorage  `json:"defaultStorage,omitempty"`
-	CookieProfiles   []CookieProfile `json:"cookieProfiles,omitempty"` // Named cookie profiles
-	ViewProof        []string        `json:"viewproof,omitempty"`      // List of cookie/localStorage keys to extract and display
-	OutputDir        string          `json:"outputDir"`
-	FileFormat       string          `json:"fileFormat"`
-	Quality          int             `json:"quality"`
-	Concurrency      int             `json:"concurrency"`
-	ChromeMode       string          `json:"-"` // Not parsed from JSON, set by command line
+	Include             []string          `json:"include,omitempty"` // Config files merged under this one, relative to it; empty once loaded
+	URLs                []URLConfig       `json:"urls"`
+	URLList             []string          `json:"urlList,omitempty"`  // Simple list of URLs
+	Sitemaps            []Sitemap         `json:"sitemaps,omitempty"` // Sitemaps whose pages are captured
+	Crawl               *Crawl            `json:"crawl,omitempty"`    // Crawl whose discovered pages are captured
+	DefaultViewports    []Viewport        `json:"defaultViewports"`
+	DefaultDelay        int               `json:"defaultDelay,omitempty"` // Default delay for urlList items
+	DefaultCookies      []Cookie          `json:"defaultCookies,omitempty"`
+	DefaultStorage      []LocalStorage    `json:"defaultStorage,omitempty"`
+	CookieProfiles      []CookieProfile   `json:"cookieProfiles,omitempty"` // Named cookie profiles
+	CookieMerge         string            `json:"cookieMerge,omitempty"`    // "merge" (default) or "replace" for the earlier rules, which only merge default cookies
+	Logins              []Login           `json:"logins,omitempty"`         // Named login flows
+	StorageState        string            `json:"storageState,omitempty"`   // Default storage state file imported before capture
+	ViewProof           []string          `json:"viewproof,omitempty"`      // List of cookie/localStorage keys to extract and display
+	UserSimulation      *UserSimulation   `json:"userSimulation,omitempty"` // Default user simulation for all URLs
+	Proxy               *Proxy            `json:"proxy,omitempty"`          // Default proxy for all URLs
+	Throttling          *Throttling       `json:"throttling,omitempty"`     // Default network throttling for all URLs
+	Rewrites            []RewriteRule     `json:"rewrites,omitempty"`       // Request rewrite rules for all URLs
+	DNSOverrides        map[string]string `json:"dnsOverrides,omitempty"`   // Hostname to IP mappings for all URLs
+	Extensions          []string          `json:"extensions,omitempty"`     // Unpacked Chrome extension directories loaded for all URLs
+	ChromeFlags         []string          `json:"chromeFlags,omitempty"`    // Chrome command line flags added to every launch, e.g. "--force-device-scale-factor=2"
+	Backend             string            `json:"backend,omitempty"`        // "chrome" to launch Chrome (default) or "webdriver" to use a Selenium Grid
+	WebDriver           *WebDriver        `json:"webdriver,omitempty"`      // Selenium Grid used by the webdriver backend
+	Firefox             *Firefox          `json:"firefox,omitempty"`        // Firefox used by URLs with browser "firefox"
+	OutputDir           string            `json:"outputDir"`
+	FileFormat          string            `json:"fileFormat"`
+	Quality             int               `json:"quality"`
+	Concurrency         int               `json:"concurrency"`
+	ViewportConcurrency int               `json:"viewportConcurrency,omitempty"` // Viewports of a URL captured at once, defaults to 3
+	SectionConcurrency  int               `json:"sectionConcurrency,omitempty"`  // Scroll sections of a viewport captured at once in parallel mode, defaults to 4
+	SectionMode         string            `json:"sectionMode,omitempty"`         // "parallel" or "sequential" capture of the scroll sections
+	SeparateBrowsers    bool              `json:"separateBrowsers,omitempty"`    // Launch a browser for every URL and viewport instead of sharing one per run
+	TabPool             *TabPool          `json:"tabPool,omitempty"`             // Reuse tabs of the shared browser across captures
+	DockerPool          *DockerPool       `json:"dockerPool,omitempty"`          // Spread Docker Chrome captures over several containers
+	Kubernetes          *Kubernetes       `json:"kubernetes,omitempty"`          // Workers of runs distributed by the kube command
+	Queue               *Queue            `json:"queue,omitempty"`               // Work queue of the enqueue and worker commands
+	DiskSpace           *DiskSpace        `json:"diskSpace,omitempty"`           // Free space preflight settings
+	ImageLimits         *ImageLimits      `json:"imageLimits,omitempty"`         // Size limits for individual screenshots
+	OptimizeImages      bool              `json:"optimizeImages,omitempty"`      // Recompress PNG screenshots losslessly to save space
+	EmbedMetadata       bool              `json:"embedMetadata,omitempty"`       // Write the capture's provenance into each screenshot file
+	Checksums           bool              `json:"checksums,omitempty"`           // Record a SHA-256 digest of every artifact in checksums.txt and the manifest
+	Catalog             bool              `json:"catalog,omitempty"`             // Record runs and captures in index.db in the output directory
+	RedactCookies       bool              `json:"redactCookies,omitempty"`       // Write hashes instead of cookie values to the logs, cookie files and ViewProof overlays
+	RedactCookiesAllow  []string          `json:"redactCookiesAllow,omitempty"`  // Globs of cookie names whose values are kept when redacting
+	MaxPageHeight       int               `json:"maxPageHeight,omitempty"`       // Tallest full page capture in pixels, defaults to 16384
+	PageHeightPolicy    string            `json:"pageHeightPolicy,omitempty"`    // "truncate", "fail" or "stitch" for pages taller than maxPageHeight
+	HAR                 bool              `json:"har,omitempty"`                 // Record network traffic of all URLs to HAR files
+	Minimap             bool              `json:"minimap,omitempty"`             // Mark the page position on the viewport section screenshots of all URLs
+	Accessibility       *Accessibility    `json:"accessibility,omitempty"`       // Default accessibility audit for all URLs
+	InteractiveMap      *InteractiveMap   `json:"interactiveMap,omitempty"`      // Default interactive elements map for all URLs
+	ScrollRecording     *ScrollRecording  `json:"scrollRecording,omitempty"`     // Default animated scroll recording for all URLs
+	Video               *VideoRecording   `json:"video,omitempty"`               // Default session video for all URLs
+	Diff                *Diff             `json:"diff,omitempty"`                // Comparison against baseline screenshots
+	Quarantine          *Quarantine       `json:"quarantine,omitempty"`          // Automatic quarantine of URLs that keep mismatching
+	Schedules           []Schedule        `json:"schedules,omitempty"`           // Recurring captures run by the schedule command
+	Triggers            []Trigger         `json:"triggers,omitempty"`            // Webhooks that start captures in server mode
+	Deployments         *Deployments      `json:"deployments,omitempty"`         // Captures around deployments announced in server mode
+	APIKeys             []APIKey          `json:"apiKeys,omitempty"`             // Keys the capture endpoints of server mode require, one per team
+	Secrets             *Secrets          `json:"secrets,omitempty"`             // Secret manager credentials are resolved from
+	Upload              *Upload           `json:"upload,omitempty"`              // Remote storage the artifacts are uploaded to
+	Notifications       []Notification    `json:"notifications,omitempty"`       // Channels notified when a run finishes
+	Alerts              []AlertRule       `json:"alerts,omitempty"`              // Rules checked after each run, alerting the notification channels
+	Issues              *Issues           `json:"issues,omitempty"`              // Issues filed for URLs that keep failing in scheduled runs
+	Review              *Review           `json:"review,omitempty"`              // Commit status and pull or merge request comment of CI runs
+	Costs               *Costs            `json:"costs,omitempty"`               // Prices for estimating the cost of a run
+	ChromeMode          string            `json:"-"`                             // Not parsed from JSON, set by command line
+	Label               string            `json:"-"`                             // Label of the run, e.g. a release or ticket, set by command line
+	Shard               int               `json:"-"`                             // 0-based shard of the URLs captured by this worker, set by command line
+	Shards              int               `json:"-"`                             // Number of shards the URLs are split into, 0 to capture all, set by command line
+
+	qualitySet bool            // Whether quality was configured rather than defaulted
+	secrets    *secretResolver // Resolver of the secrets, kept for URLs validated after loading
 }
 
 // LoadConfig loads configuration from a file
 func LoadConfig(path string) (*Config, error) {
-	data, err := os.ReadFile(path)
+	data, err := readConfigFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("error reading config file: %w", err)
+		return nil, err
 	}
 
 	var config Config
@@ -117,6 +554,79 @@ func validateConfig(config *Config) error {
 		}
 	}
 
+	// Expand sitemaps into URLConfig objects, skipping pages that are already configured
+	if len(config.Sitemaps) > 0 {
+		known := make(map[string]bool, len(config.URLs))
+		for _, u := range config.URLs {
+			known[u.URL] = true
+		}
+
+		for i, sitemap := range config.Sitemaps {
+			if sitemap.URL == "" {
+				return fmt.Errorf("sitemap #%d is missing url", i+1)
+			}
+			if sitemap.Limit < 0 {
+				return fmt.Errorf("sitemap #%d limit must not be negative", i+1)
+			}
+
+			pages, err := LoadSitemap(sitemap)
+			if err != nil {
+				return fmt.Errorf("sitemap #%d: %w", i+1, err)
+			}
+
+			for _, page := range pages {
+				if known[page] {
+					continue
+				}
+				known[page] = true
+				config.URLs = append(config.URLs, URLConfig{
+					Name:  PageNameFromURL(page),
+					URL:   page,
+					Delay: config.DefaultDelay,
+				})
+			}
+		}
+	}
+
+	// Crawl the seeds and add the discovered pages, skipping pages that are already configured
+	if config.Crawl != nil {
+		crawl := config.Crawl
+		if len(crawl.Seeds) == 0 {
+			return fmt.Errorf("crawl is missing seeds")
+		}
+		if crawl.MaxDepth == 0 {
+			crawl.MaxDepth = 2
+		} else if crawl.MaxDepth < 0 {
+			return fmt.Errorf("crawl maxDepth must not be negative")
+		}
+		if crawl.MaxPages == 0 {
+			crawl.MaxPages = 100
+		} else if crawl.MaxPages < 0 {
+			return fmt.Errorf("crawl maxPages must not be negative")
+		}
+
+		pages, err := CrawlSite(*crawl)
+		if err != nil {
+			return fmt.Errorf("crawl failed: %w", err)
+		}
+
+		known := make(map[string]bool, len(config.URLs))
+		for _, u := range config.URLs {
+			known[u.URL] = true
+		}
+		for _, page := range pages {
+			if known[page] {
+				continue
+			}
+			known[page] = true
+			config.URLs = append(config.URLs, URLConfig{
+				Name:  PageNameFromURL(page),
+				URL:   page,
+				Delay: config.DefaultDelay,
+			})
+		}
+	}
+
 	// Check if there are any URLs to process
 	if len(config.URLs) == 0 {
 		return fmt.Errorf("no URLs specified in configuration")
@@ -146,6 +656,7 @@ func validateConfig(config *Config) error {
 	}
 
 	// Set default quality if not specified
+	config.qualitySet = config.Quality != 0
 	if config.Quality == 0 {
 		config.Quality = 80
 	} else if config.Quality < 1 || config.Quality > 100 {
@@ -158,6 +669,370 @@ func validateConfig(config *Config) error {
 	} else if config.Concurrency < 1 {
 		return fmt.Errorf("concurrency must be at least 1")
 	}
+	if config.ViewportConcurrency == 0 {
+		config.ViewportConcurrency = 3
+	} else if config.ViewportConcurrency < 1 {
+		return fmt.Errorf("viewportConcurrency must be at least 1")
+	}
+
+	// Set default scroll section capture if not specified
+	if config.SectionMode == "" {
+		config.SectionMode = "parallel"
+	} else if config.SectionMode != "parallel" && config.SectionMode != "sequential" {
+		return fmt.Errorf("unsupported section mode: %s (supported: parallel, sequential)", config.SectionMode)
+	}
+	if config.SectionConcurrency == 0 {
+		config.SectionConcurrency = 4
+	} else if config.SectionConcurrency < 1 {
+		return fmt.Errorf("sectionConcurrency must be at least 1")
+	}
+
+	// Validate tab pooling, which needs the shared browser
+	if config.TabPool != nil && config.TabPool.Enabled {
+		if config.SeparateBrowsers {
+			return fmt.Errorf("tabPool can't be used with separateBrowsers")
+		}
+		if config.TabPool.MaxUses == 0 {
+			config.TabPool.MaxUses = 50
+		} else if config.TabPool.MaxUses < 0 {
+			return fmt.Errorf("tabPool maxUses must not be negative")
+		}
+	}
+
+	// Validate the Docker Chrome pool, one container per parallel URL by default
+	if pool := config.DockerPool; pool != nil && pool.Enabled {
+		if pool.Size == 0 {
+			pool.Size = config.Concurrency
+		} else if pool.Size < 1 {
+			return fmt.Errorf("dockerPool size must be at least 1")
+		}
+		if pool.BasePort == 0 {
+			pool.BasePort = 9223 // The single container uses 9222
+		} else if pool.BasePort < 1 || pool.BasePort+pool.Size-1 > 65535 {
+			return fmt.Errorf("dockerPool ports %d to %d are out of range", pool.BasePort, pool.BasePort+pool.Size-1)
+		}
+	}
+
+	// Validate the Kubernetes workers of distributed runs
+	if k := config.Kubernetes; k != nil {
+		if k.Image == "" {
+			return fmt.Errorf("kubernetes requires an image")
+		}
+		if k.VolumeClaim == "" {
+			return fmt.Errorf("kubernetes requires a volumeClaim the workers write to")
+		}
+		if k.Namespace == "" {
+			k.Namespace = "default"
+		}
+		if k.Shards == 0 {
+			k.Shards = 4
+		} else if k.Shards < 1 {
+			return fmt.Errorf("kubernetes shards must be at least 1")
+		}
+	}
+
+	// Validate the work queue of distributed workers
+	if q := config.Queue; q != nil {
+		if q.URL == "" {
+			return fmt.Errorf("queue requires a url")
+		}
+		switch q.Type {
+		case "redis", "nats":
+			if q.Name == "" {
+				q.Name = "screenshot-tool.jobs"
+			}
+			if q.Type == "nats" && (q.Stream == "" || q.Consumer == "") {
+				return fmt.Errorf("nats queue requires the stream and the consumer the workers pull from")
+			}
+		case "sqs":
+			if q.VisibilityTimeout == 0 {
+				q.VisibilityTimeout = 900 // Longer than the capture of a URL with several viewports
+			} else if q.VisibilityTimeout < 0 || q.VisibilityTimeout > 43200 {
+				return fmt.Errorf("queue visibilityTimeout must be between 1 and 43200 seconds")
+			}
+		default:
+			return fmt.Errorf("unsupported queue type: %s (supported: redis, nats, sqs)", q.Type)
+		}
+	}
+
+	// Set default disk space policy if not specified
+	if config.DiskSpace == nil {
+		config.DiskSpace = &DiskSpace{}
+	}
+	if config.DiskSpace.Policy == "" {
+		config.DiskSpace.Policy = "warn"
+	} else if config.DiskSpace.Policy != "abort" && config.DiskSpace.Policy != "degrade" && config.DiskSpace.Policy != "warn" {
+		return fmt.Errorf("unsupported disk space policy: %s (supported: abort, degrade, warn)", config.DiskSpace.Policy)
+	}
+	if config.DiskSpace.Reserve == 0 {
+		config.DiskSpace.Reserve = 100 // 100 MB default
+	} else if config.DiskSpace.Reserve < 0 {
+		return fmt.Errorf("disk space reserve must not be negative")
+	}
+
+	// Set default maximum page height if not specified
+	if config.MaxPageHeight == 0 {
+		config.MaxPageHeight = 16384
+	} else if config.MaxPageHeight < 0 {
+		return fmt.Errorf("maxPageHeight must not be negative")
+	}
+	if config.PageHeightPolicy == "" {
+		config.PageHeightPolicy = "truncate"
+	} else if config.PageHeightPolicy != "truncate" && config.PageHeightPolicy != "fail" && config.PageHeightPolicy != "stitch" {
+		return fmt.Errorf("unsupported page height policy: %s (supported: truncate, fail, stitch)", config.PageHeightPolicy)
+	}
+
+	// Validate image limits
+	if config.ImageLimits != nil {
+		limits := config.ImageLimits
+		if limits.MaxWidth < 0 || limits.MaxHeight < 0 || limits.MaxPixels < 0 || limits.MaxBytes < 0 {
+			return fmt.Errorf("image limits must not be negative")
+		}
+		if limits.Fallback == "" {
+			limits.Fallback = "reencode"
+		} else if limits.Fallback != "reencode" && limits.Fallback != "downscale" {
+			return fmt.Errorf("unsupported image limit fallback: %s (supported: reencode, downscale)", limits.Fallback)
+		}
+	}
+
+	// Validate baseline comparison
+	if config.Diff != nil {
+		diff := config.Diff
+		if diff.BaselineDir == "" {
+			return fmt.Errorf("diff is missing baselineDir")
+		}
+		if diff.Tolerance != nil {
+			if err := validateDiffTolerance(diff.Tolerance); err != nil {
+				return fmt.Errorf("invalid diff tolerance: %w", err)
+			}
+			if diff.Tolerance.MaxChangedPercent > 0 && diff.Threshold != 0 {
+				return fmt.Errorf("diff threshold and tolerance maxChangedPercent can't be used together")
+			}
+		}
+		if diff.Threshold == 0 {
+			diff.Threshold = 0.999
+		} else if diff.Threshold < 0 || diff.Threshold > 1 {
+			return fmt.Errorf("diff threshold must be between 0 and 1")
+		}
+		if diff.Mode == "" {
+			diff.Mode = "pixel"
+		} else if err := validateDiffMode(diff.Mode); err != nil {
+			return err
+		}
+		if diff.SSIMThreshold == 0 {
+			diff.SSIMThreshold = 0.98
+		} else if diff.SSIMThreshold < 0 || diff.SSIMThreshold > 1 {
+			return fmt.Errorf("diff ssimThreshold must be between 0 and 1")
+		}
+		if diff.MaxHashDistance == 0 {
+			diff.MaxHashDistance = 5
+		} else if diff.MaxHashDistance < 0 || diff.MaxHashDistance > 64 {
+			return fmt.Errorf("diff maxHashDistance must be between 0 and 64")
+		}
+		if retry := diff.Retry; retry != nil {
+			if retry.Delay < 0 || retry.WaitTimeout < 0 {
+				return fmt.Errorf("diff retry delay and waitTimeout must not be negative")
+			}
+			if retry.WaitForSelector != "" && retry.WaitTimeout == 0 {
+				retry.WaitTimeout = 30000 // 30 seconds default
+			}
+		}
+	}
+
+	// Validate automatic quarantine
+	if config.Quarantine != nil {
+		if config.Quarantine.AutoAfter < 0 {
+			return fmt.Errorf("quarantine autoAfter must not be negative")
+		}
+		if config.Quarantine.ReleaseAfter == 0 {
+			config.Quarantine.ReleaseAfter = 3
+		} else if config.Quarantine.ReleaseAfter < 0 {
+			return fmt.Errorf("quarantine releaseAfter must not be negative")
+		}
+	}
+
+	// Validate the cookie names whose values aren't redacted
+	for _, pattern := range config.RedactCookiesAllow {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid redactCookiesAllow pattern %s: %w", pattern, err)
+		}
+	}
+
+	// Credentials of logins, proxies and uploads may be resolved from a secret manager
+	secrets, err := newSecretResolver(config.Secrets)
+	if err != nil {
+		return fmt.Errorf("secrets are invalid: %w", err)
+	}
+	config.secrets = secrets
+
+	// Validate artifact uploads
+	if config.Upload != nil {
+		if err := validateUpload(config.Upload, secrets); err != nil {
+			return fmt.Errorf("upload is invalid: %w", err)
+		}
+	}
+
+	// Validate run notifications
+	for i := range config.Notifications {
+		if err := validateNotification(&config.Notifications[i]); err != nil {
+			return fmt.Errorf("notification #%d is invalid: %w", i+1, err)
+		}
+	}
+
+	// Validate alert rules, which route to named notifications
+	notificationNames := make(map[string]bool)
+	for _, notification := range config.Notifications {
+		if notification.Name != "" {
+			if notificationNames[notification.Name] {
+				return fmt.Errorf("duplicate notification name: %s", notification.Name)
+			}
+			notificationNames[notification.Name] = true
+		}
+	}
+	for i := range config.Alerts {
+		if err := validateAlertRule(config.Alerts[i], notificationNames); err != nil {
+			return fmt.Errorf("alert #%d is invalid: %w", i+1, err)
+		}
+	}
+	if len(config.Alerts) > 0 && len(config.Notifications) == 0 {
+		return fmt.Errorf("alerts require at least one notification")
+	}
+
+	// Validate issue filing
+	if config.Issues != nil {
+		if err := validateIssues(config.Issues); err != nil {
+			return fmt.Errorf("issues are invalid: %w", err)
+		}
+	}
+
+	// Validate reporting on pull and merge requests
+	if config.Review != nil {
+		if err := validateReview(config.Review); err != nil {
+			return fmt.Errorf("review is invalid: %w", err)
+		}
+	}
+
+	// Validate cost estimation prices
+	if config.Costs != nil {
+		if config.Costs.TransferPerGB < 0 || config.Costs.StoragePerGBMonth < 0 {
+			return fmt.Errorf("costs must not be negative")
+		}
+		if config.Costs.RetentionMonths == 0 {
+			config.Costs.RetentionMonths = 1
+		} else if config.Costs.RetentionMonths < 0 {
+			return fmt.Errorf("costs retentionMonths must not be negative")
+		}
+		if config.Costs.Currency == "" {
+			config.Costs.Currency = "USD"
+		}
+	}
+
+	// Validate schedules, the URLs they reference are checked once all URLs are known
+	scheduleNames := make(map[string]bool)
+	for i := range config.Schedules {
+		if err := validateSchedule(&config.Schedules[i]); err != nil {
+			return fmt.Errorf("schedule #%d is invalid: %w", i+1, err)
+		}
+		if scheduleNames[config.Schedules[i].Name] {
+			return fmt.Errorf("schedule name %s is used more than once", config.Schedules[i].Name)
+		}
+		scheduleNames[config.Schedules[i].Name] = true
+	}
+
+	// Validate webhook triggers
+	triggerNames := make(map[string]bool)
+	for i, trigger := range config.Triggers {
+		if trigger.Name == "" {
+			return fmt.Errorf("trigger #%d is missing name", i+1)
+		}
+		if strings.ContainsAny(trigger.Name, `/\`) || trigger.Name == "." || trigger.Name == ".." {
+			return fmt.Errorf("trigger name %s must not contain path separators", trigger.Name)
+		}
+		if triggerNames[trigger.Name] {
+			return fmt.Errorf("trigger name %s is used more than once", trigger.Name)
+		}
+		triggerNames[trigger.Name] = true
+	}
+
+	// Validate API keys
+	apiKeyNames := make(map[string]bool)
+	apiKeys := make(map[string]bool)
+	apiKeyPrefixes := make(map[string]bool)
+	for i := range config.APIKeys {
+		apiKey := &config.APIKeys[i]
+		if apiKey.Name == "" {
+			return fmt.Errorf("API key #%d is missing name", i+1)
+		}
+		if apiKeyNames[apiKey.Name] {
+			return fmt.Errorf("API key name %s is used more than once", apiKey.Name)
+		}
+		apiKeyNames[apiKey.Name] = true
+		if apiKey.Key == "" {
+			return fmt.Errorf("API key %s is missing key", apiKey.Name)
+		}
+		if apiKeys[apiKey.Key] {
+			return fmt.Errorf("API key %s has the same key as another team", apiKey.Name)
+		}
+		apiKeys[apiKey.Key] = true
+		if apiKey.Prefix == "" {
+			apiKey.Prefix = apiKey.Name
+		}
+		prefix := filepath.Clean(apiKey.Prefix)
+		if filepath.IsAbs(prefix) || prefix == "." || prefix == ".." || strings.HasPrefix(prefix, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("API key %s prefix %s must be a directory below outputDir", apiKey.Name, apiKey.Prefix)
+		}
+		if top := strings.SplitN(filepath.ToSlash(prefix), "/", 2)[0]; top == "triggers" || top == "deployments" {
+			return fmt.Errorf("API key %s prefix %s would mix its captures with the %s runs", apiKey.Name, apiKey.Prefix, top)
+		}
+		if apiKeyPrefixes[prefix] {
+			return fmt.Errorf("API key %s prefix %s is used by another team", apiKey.Name, apiKey.Prefix)
+		}
+		apiKeyPrefixes[prefix] = true
+		if apiKey.RateLimit < 0 {
+			return fmt.Errorf("API key %s rateLimit must not be negative", apiKey.Name)
+		}
+		if apiKey.DailyQuota < 0 {
+			return fmt.Errorf("API key %s dailyQuota must not be negative", apiKey.Name)
+		}
+	}
+
+	// Validate deployment captures
+	if config.Deployments != nil {
+		if config.Deployments.BeforeMinutes < 0 {
+			return fmt.Errorf("deployments beforeMinutes must not be negative")
+		}
+		if config.Deployments.AfterMinutes == 0 {
+			config.Deployments.AfterMinutes = 10
+		} else if config.Deployments.AfterMinutes < 0 {
+			return fmt.Errorf("deployments afterMinutes must not be negative")
+		}
+	}
+
+	// Validate the capture backend
+	switch config.Backend {
+	case "":
+		config.Backend = "chrome"
+	case "chrome":
+	case "webdriver":
+		if err := validateWebDriver(config.WebDriver); err != nil {
+			return fmt.Errorf("webdriver is invalid: %w", err)
+		}
+	default:
+		return fmt.Errorf("unsupported backend: %s (supported: chrome, webdriver)", config.Backend)
+	}
+
+	// Validate the Chrome flags of all URLs, those of each URL are checked with the URL
+	for _, flag := range config.ChromeFlags {
+		if err := validateChromeFlag(flag); err != nil {
+			return fmt.Errorf("invalid chromeFlags: %w", err)
+		}
+	}
+
+	switch config.CookieMerge {
+	case "", "merge", "replace":
+	default:
+		return fmt.Errorf("unsupported cookieMerge: %s (supported: merge, replace)", config.CookieMerge)
+	}
 
 	// Validate cookie profiles
 	cookieProfileMap := make(map[string]CookieProfile)
@@ -168,79 +1043,1022 @@ func validateConfig(config *Config) error {
 		cookieProfileMap[profile.Name] = profile
 	}
 
+	// Validate login flows
+	loginMap := make(map[string]bool)
+	for i := range config.Logins {
+		if err := validateLogin(&config.Logins[i], secrets); err != nil {
+			return fmt.Errorf("login #%d is invalid: %w", i+1, err)
+		}
+		loginMap[config.Logins[i].Name] = true
+	}
+
 	// Validate and set defaults for each URL
 	for i := range config.URLs {
-		// Ensure URL has a name
-		if config.URLs[i].Name == "" {
-			config.URLs[i].Name = fmt.Sprintf("page-%d", i+1)
+		if err := validateURL(config, i, cookieProfileMap, loginMap, secrets); err != nil {
+			return err
 		}
+	}
 
-		// Ensure URL has a value
-		if config.URLs[i].URL == "" {
-			return fmt.Errorf("URL #%d is missing URL value", i+1)
+	// Check that scheduled, triggered and deployment URLs exist
+	urlNames := make(map[string]bool, len(config.URLs))
+	for _, u := range config.URLs {
+		urlNames[u.Name] = true
+	}
+	for _, schedule := range config.Schedules {
+		for _, name := range schedule.URLs {
+			if !urlNames[name] {
+				return fmt.Errorf("schedule %s references non-existent URL: %s", schedule.Name, name)
+			}
 		}
-
-		// If no viewports specified for this URL, use the default viewports
-		if len(config.URLs[i].Viewports) == 0 {
-			config.URLs[i].Viewports = make([]Viewport, len(config.DefaultViewports))
-			copy(config.URLs[i].Viewports, config.DefaultViewports)
+	}
+	for _, trigger := range config.Triggers {
+		for _, name := range trigger.URLs {
+			if !urlNames[name] {
+				return fmt.Errorf("trigger %s references non-existent URL: %s", trigger.Name, name)
+			}
 		}
-
-		// Apply cookie profile if specified
-		if config.URLs[i].CookieProfileID != "" {
-			profile, exists := cookieProfileMap[config.URLs[i].CookieProfileID]
-			if !exists {
-				return fmt.Errorf("URL #%d references non-existent cookie profile: %s", i+1, config.URLs[i].CookieProfileID)
+	}
+	if config.Deployments != nil {
+		for _, name := range config.Deployments.URLs {
+			if !urlNames[name] {
+				return fmt.Errorf("deployments reference non-existent URL: %s", name)
 			}
+		}
+	}
 
-			// Apply profile cookies if URL doesn't have its own
-			if len(config.URLs[i].Cookies) == 0 {
-				config.URLs[i].Cookies = make([]Cookie, len(profile.Cookies))
-				copy(config.URLs[i].Cookies, profile.Cookies)
-			}
+	return nil
+}
 
-			// Apply profile localStorage if URL doesn't have its own
-			if len(config.URLs[i].LocalStorage) == 0 {
-				config.URLs[i].LocalStorage = make([]LocalStorage, len(profile.LocalStorage))
-				copy(config.URLs[i].LocalStorage, profile.LocalStorage)
-			}
-		} else {
-			// Apply default cookies if no profile specified and the URL doesn't have its own
-			if len(config.URLs[i].Cookies) == 0 && len(config.DefaultCookies) > 0 {
-				config.URLs[i].Cookies = make([]Cookie, len(config.DefaultCookies))
-				copy(config.URLs[i].Cookies, config.DefaultCookies)
-			} else if len(config.DefaultCookies) > 0 {
-				// Merge defaultCookies with URL-specific cookies
-				// First, create a map of existing cookie names to avoid duplicates
-				existingCookies := make(map[string]bool)
-				for _, cookie := range config.URLs[i].Cookies {
-					existingCookies[cookie.Name] = true
-				}
+// validateUserSimulation validates user simulation settings and sets defaults
+func validateUserSimulation(sim *UserSimulation) error {
+	// Pick a seed now so every capture of the URL replays the same behavior
+	if sim.Seed == 0 {
+		sim.Seed = time.Now().UnixNano()
+	}
 
-				// Add default cookies that don't already exist
-				for _, defaultCookie := range config.DefaultCookies {
-					if _, exists := existingCookies[defaultCookie.Name]; !exists {
-						config.URLs[i].Cookies = append(config.URLs[i].Cookies, defaultCookie)
-					}
-				}
-			}
+	if sim.Steps == 0 {
+		sim.Steps = 4
+	} else if sim.Steps < 0 {
+		return fmt.Errorf("steps must not be negative")
+	}
 
-			// Apply default localStorage if no profile specified and the URL doesn't have its own
-			if len(config.URLs[i].LocalStorage) == 0 && len(config.DefaultStorage) > 0 {
-				config.URLs[i].LocalStorage = make([]LocalStorage, len(config.DefaultStorage))
-				copy(config.URLs[i].LocalStorage, config.DefaultStorage)
-			}
-		}
+	if sim.MouseMoves == 0 {
+		sim.MouseMoves = 5
+	} else if sim.MouseMoves < 0 {
+		return fmt.Errorf("mouseMoves must not be negative")
+	}
 
-		// Set default delay if not specified
-		if config.URLs[i].Delay == 0 {
-			config.URLs[i].Delay = 1000 // 1 second default
-		}
+	if sim.MinDwell == 0 {
+		sim.MinDwell = 300
+	}
+	if sim.MaxDwell == 0 {
+		sim.MaxDwell = 1500
+	}
+	if sim.MinDwell < 0 || sim.MaxDwell < sim.MinDwell {
+		return fmt.Errorf("dwell range %d-%d is invalid", sim.MinDwell, sim.MaxDwell)
 	}
 
 	return nil
 }
 
+// ValidateURL validates a URL object given after the configuration was loaded, such as the
+// target of an API request, and applies the defaults and global settings to it like
+// LoadConfig does for the URLs of the configuration
+func (c *Config) ValidateURL(u *URLConfig) error {
+	cookieProfileMap := make(map[string]CookieProfile, len(c.CookieProfiles))
+	for _, profile := range c.CookieProfiles {
+		cookieProfileMap[profile.Name] = profile
+	}
+	loginMap := make(map[string]bool, len(c.Logins))
+	for _, login := range c.Logins {
+		loginMap[login.Name] = true
+	}
+	// Secrets resolved when the configuration was loaded aren't fetched again
+	secrets := c.secrets
+	if secrets == nil && c.Secrets != nil {
+		var err error
+		if secrets, err = newSecretResolver(c.Secrets); err != nil {
+			return fmt.Errorf("invalid secrets: %w", err)
+		}
+	}
+
+	check := *c
+	check.URLs = []URLConfig{*u}
+	if err := validateURL(&check, 0, cookieProfileMap, loginMap, secrets); err != nil {
+		return err
+	}
+	*u = check.URLs[0]
+	return nil
+}
+
+// validateURL validates the URL at index i of the configuration and applies the defaults
+// and global settings to it
+func validateURL(config *Config, i int, cookieProfileMap map[string]CookieProfile, loginMap map[string]bool, secrets *secretResolver) error {
+	// Ensure URL has a name
+	if config.URLs[i].Name == "" {
+		config.URLs[i].Name = fmt.Sprintf("page-%d", i+1)
+	}
+
+	// Ensure URL has a value
+	if config.URLs[i].URL == "" {
+		return fmt.Errorf("URL #%d is missing URL value", i+1)
+	}
+
+	// If no viewports specified for this URL, use the default viewports
+	if len(config.URLs[i].Viewports) == 0 {
+		config.URLs[i].Viewports = make([]Viewport, len(config.DefaultViewports))
+		copy(config.URLs[i].Viewports, config.DefaultViewports)
+	}
+	for _, viewport := range config.URLs[i].Viewports {
+		if viewport.Orientation != "" && viewport.Orientation != "portrait" && viewport.Orientation != "landscape" {
+			return fmt.Errorf("URL #%d viewport %dx%d has unsupported orientation: %s (supported: portrait, landscape)",
+				i+1, viewport.Width, viewport.Height, viewport.Orientation)
+		}
+		for _, cookie := range viewport.Cookies {
+			if cookie.Name == "" {
+				return fmt.Errorf("URL #%d viewport %dx%d has a cookie without a name", i+1, viewport.Width, viewport.Height)
+			}
+			if err := validateValueFrom(cookie.ValueFrom, cookie.Value); err != nil {
+				return fmt.Errorf("URL #%d viewport %dx%d cookie %s is invalid: %w", i+1, viewport.Width, viewport.Height, cookie.Name, err)
+			}
+		}
+		for _, item := range viewport.LocalStorage {
+			if item.Key == "" {
+				return fmt.Errorf("URL #%d viewport %dx%d has a localStorage item without a key", i+1, viewport.Width, viewport.Height)
+			}
+			if err := validateValueFrom(item.ValueFrom, item.Value); err != nil {
+				return fmt.Errorf("URL #%d viewport %dx%d localStorage item %s is invalid: %w", i+1, viewport.Width, viewport.Height, item.Key, err)
+			}
+		}
+	}
+
+	// Apply the cookie profile if specified, or the default cookies and localStorage
+	var profile CookieProfile
+	if config.URLs[i].CookieProfileID != "" {
+		var exists bool
+		if profile, exists = cookieProfileMap[config.URLs[i].CookieProfileID]; !exists {
+			return fmt.Errorf("URL #%d references non-existent cookie profile: %s", i+1, config.URLs[i].CookieProfileID)
+		}
+	}
+	if config.CookieMerge == "replace" {
+		// The rules before cookieMerge: a URL's own values replace those of its profile or
+		// the default localStorage, and only the default cookies are added to its own
+		defaultCookies, defaultStorage := config.DefaultCookies, config.DefaultStorage
+		if config.URLs[i].CookieProfileID != "" {
+			defaultCookies, defaultStorage = profile.Cookies, profile.LocalStorage
+		}
+		if len(config.URLs[i].Cookies) == 0 && len(defaultCookies) > 0 {
+			config.URLs[i].Cookies = append([]Cookie(nil), defaultCookies...)
+		} else if config.URLs[i].CookieProfileID == "" {
+			existingCookies := make(map[string]bool)
+			for _, cookie := range config.URLs[i].Cookies {
+				existingCookies[cookie.Name] = true
+			}
+			for _, defaultCookie := range config.DefaultCookies {
+				if !existingCookies[defaultCookie.Name] {
+					config.URLs[i].Cookies = append(config.URLs[i].Cookies, defaultCookie)
+				}
+			}
+		}
+		if len(config.URLs[i].LocalStorage) == 0 && len(defaultStorage) > 0 {
+			config.URLs[i].LocalStorage = append([]LocalStorage(nil), defaultStorage...)
+		}
+	} else {
+		// The URL's values replace those of the profile with the same name, which replace the defaults
+		config.URLs[i].Cookies = mergeCookies(config.DefaultCookies, profile.Cookies, config.URLs[i].Cookies)
+		config.URLs[i].LocalStorage = mergeLocalStorage(config.DefaultStorage, profile.LocalStorage, config.URLs[i].LocalStorage)
+	}
+
+	// Validate the commands producing cookie and localStorage values
+	for _, cookie := range config.URLs[i].Cookies {
+		if err := validateValueFrom(cookie.ValueFrom, cookie.Value); err != nil {
+			return fmt.Errorf("URL #%d cookie %s is invalid: %w", i+1, cookie.Name, err)
+		}
+	}
+	for _, item := range config.URLs[i].LocalStorage {
+		if err := validateValueFrom(item.ValueFrom, item.Value); err != nil {
+			return fmt.Errorf("URL #%d localStorage item %s is invalid: %w", i+1, item.Key, err)
+		}
+	}
+
+	// Set default delay if not specified
+	if config.URLs[i].Delay == 0 {
+		config.URLs[i].Delay = 1000 // 1 second default
+	}
+
+	// Apply the global proxy if the URL doesn't have its own
+	if config.URLs[i].Proxy == nil && config.Proxy != nil {
+		proxy := *config.Proxy
+		config.URLs[i].Proxy = &proxy
+	}
+
+	if config.URLs[i].Proxy != nil {
+		if err := validateProxy(config.URLs[i].Proxy, secrets); err != nil {
+			return fmt.Errorf("URL #%d has invalid proxy: %w", i+1, err)
+		}
+	}
+
+	// Apply the global accessibility audit if the URL doesn't have its own
+	if config.URLs[i].Accessibility == nil && config.Accessibility != nil {
+		audit := *config.Accessibility
+		config.URLs[i].Accessibility = &audit
+	}
+
+	if audit := config.URLs[i].Accessibility; audit != nil && audit.Enabled && audit.AxeScript != "" {
+		if _, err := os.Stat(audit.AxeScript); err != nil {
+			return fmt.Errorf("URL #%d axe-core script not found: %w", i+1, err)
+		}
+	}
+
+	// Apply the global interactive elements map if the URL doesn't have its own
+	if config.URLs[i].InteractiveMap == nil && config.InteractiveMap != nil {
+		interactiveMap := *config.InteractiveMap
+		config.URLs[i].InteractiveMap = &interactiveMap
+	}
+
+	if interactiveMap := config.URLs[i].InteractiveMap; interactiveMap != nil {
+		if interactiveMap.MinTargetSize == 0 {
+			interactiveMap.MinTargetSize = 24 // WCAG 2.2 minimum target size
+		} else if interactiveMap.MinTargetSize < 0 {
+			return fmt.Errorf("URL #%d interactiveMap minTargetSize must not be negative", i+1)
+		}
+	}
+
+	if config.URLs[i].ScrollRecording == nil && config.ScrollRecording != nil {
+		recording := *config.ScrollRecording
+		config.URLs[i].ScrollRecording = &recording
+	}
+
+	if recording := config.URLs[i].ScrollRecording; recording != nil {
+		if err := validateScrollRecording(recording); err != nil {
+			return fmt.Errorf("URL #%d has an invalid scroll recording: %w", i+1, err)
+		}
+	}
+
+	if config.URLs[i].Video == nil && config.Video != nil {
+		video := *config.Video
+		config.URLs[i].Video = &video
+	}
+
+	if video := config.URLs[i].Video; video != nil {
+		if err := validateVideoRecording(video); err != nil {
+			return fmt.Errorf("URL #%d has an invalid video: %w", i+1, err)
+		}
+	}
+
+	// Prepend global rewrite rules so URL-specific rules take precedence
+	if len(config.Rewrites) > 0 {
+		config.URLs[i].Rewrites = append(append([]RewriteRule{}, config.Rewrites...), config.URLs[i].Rewrites...)
+	}
+
+	for j, rule := range config.URLs[i].Rewrites {
+		if err := validateRewriteRule(rule); err != nil {
+			return fmt.Errorf("URL #%d rewrite rule #%d is invalid: %w", i+1, j+1, err)
+		}
+	}
+
+	// Merge global DNS overrides, URL-specific entries win
+	if len(config.DNSOverrides) > 0 {
+		merged := make(map[string]string, len(config.DNSOverrides)+len(config.URLs[i].DNSOverrides))
+		for host, ip := range config.DNSOverrides {
+			merged[host] = ip
+		}
+		for host, ip := range config.URLs[i].DNSOverrides {
+			merged[host] = ip
+		}
+		config.URLs[i].DNSOverrides = merged
+	}
+
+	for host, ip := range config.URLs[i].DNSOverrides {
+		if strings.TrimSpace(host) == "" {
+			return fmt.Errorf("URL #%d has a DNS override with an empty hostname", i+1)
+		}
+		if net.ParseIP(ip) == nil {
+			return fmt.Errorf("URL #%d DNS override for %s is not a valid IP address: %s", i+1, host, ip)
+		}
+	}
+
+	// Load the global extensions if the URL doesn't have its own
+	if len(config.URLs[i].Extensions) == 0 && len(config.Extensions) > 0 {
+		config.URLs[i].Extensions = append([]string(nil), config.Extensions...)
+	}
+	for j, dir := range config.URLs[i].Extensions {
+		abs, err := validateExtension(dir)
+		if err != nil {
+			return fmt.Errorf("URL #%d has an invalid extension: %w", i+1, err)
+		}
+		config.URLs[i].Extensions[j] = abs
+	}
+
+	// Grid nodes don't share the runner's files or local proxy helpers
+	if config.Backend == "webdriver" {
+		if len(config.URLs[i].Extensions) > 0 {
+			return fmt.Errorf("URL #%d has extensions, which the webdriver backend can't load", i+1)
+		}
+		if proxy := config.URLs[i].Proxy; proxy != nil && proxy.Auth != "" {
+			return fmt.Errorf("URL #%d has a proxy with authentication, which the webdriver backend can't use", i+1)
+		}
+	}
+
+	for _, flag := range config.URLs[i].ChromeFlags {
+		if err := validateChromeFlag(flag); err != nil {
+			return fmt.Errorf("URL #%d has invalid chromeFlags: %w", i+1, err)
+		}
+	}
+
+	// Firefox is driven through WebDriver, which has no way to pass Chrome's launch settings
+	switch config.URLs[i].Browser {
+	case "", "chrome":
+	case "firefox":
+		if len(config.URLs[i].ChromeFlags) > 0 {
+			return fmt.Errorf("URL #%d uses Firefox, which does not support chromeFlags", i+1)
+		}
+		if proxy := config.URLs[i].Proxy; proxy != nil && proxy.Auth != "" {
+			return fmt.Errorf("URL #%d uses Firefox, which can't authenticate to a proxy", i+1)
+		}
+	default:
+		return fmt.Errorf("URL #%d has unsupported browser: %s (supported: chrome, firefox)", i+1, config.URLs[i].Browser)
+	}
+
+	// Record network traffic of every URL if enabled globally
+	if config.HAR {
+		config.URLs[i].HAR = true
+	}
+
+	// Mark the page position on the viewport sections of every URL if enabled globally
+	if config.Minimap {
+		config.URLs[i].Minimap = true
+	}
+
+	// Validate the URL's time zone, Chrome accepts IANA names only
+	if tz := config.URLs[i].Timezone; tz != "" {
+		if _, err := time.LoadLocation(tz); err != nil || tz == "Local" {
+			return fmt.Errorf("URL #%d has unknown time zone: %s", i+1, tz)
+		}
+	}
+
+	if geo := config.URLs[i].Geolocation; geo != nil {
+		if geo.Latitude < -90 || geo.Latitude > 90 || geo.Longitude < -180 || geo.Longitude > 180 {
+			return fmt.Errorf("URL #%d has invalid geolocation: latitude must be between -90 and 90, longitude between -180 and 180", i+1)
+		}
+		if geo.Accuracy == 0 {
+			geo.Accuracy = 100
+		} else if geo.Accuracy < 0 {
+			return fmt.Errorf("URL #%d geolocation accuracy must not be negative", i+1)
+		}
+	}
+
+	// Throttle every URL if enabled globally
+	if config.URLs[i].Throttling == nil && config.Throttling != nil {
+		throttling := *config.Throttling
+		config.URLs[i].Throttling = &throttling
+	}
+	if throttling := config.URLs[i].Throttling; throttling != nil {
+		if err := validateThrottling(throttling); err != nil {
+			return fmt.Errorf("URL #%d has invalid throttling: %w", i+1, err)
+		}
+	}
+
+	// Compare every URL with the global tolerance unless it has its own
+	if config.URLs[i].DiffTolerance == nil && config.Diff != nil && config.Diff.Tolerance != nil {
+		tolerance := *config.Diff.Tolerance
+		config.URLs[i].DiffTolerance = &tolerance
+	}
+	if tolerance := config.URLs[i].DiffTolerance; tolerance != nil {
+		if err := validateDiffTolerance(tolerance); err != nil {
+			return fmt.Errorf("URL #%d has invalid diff tolerance: %w", i+1, err)
+		}
+	}
+	if config.URLs[i].DiffMode == "" && config.Diff != nil {
+		config.URLs[i].DiffMode = config.Diff.Mode
+	} else if config.URLs[i].DiffMode != "" {
+		if err := validateDiffMode(config.URLs[i].DiffMode); err != nil {
+			return fmt.Errorf("URL #%d: %w", i+1, err)
+		}
+	}
+
+	// Validate the URL's Chrome backend, settings applied at launch can't reach the shared Docker Chrome
+	switch config.URLs[i].ChromeMode {
+	case "", "auto", "local":
+	case "docker":
+		if config.URLs[i].Proxy != nil || len(config.URLs[i].DNSOverrides) > 0 || len(config.URLs[i].Extensions) > 0 {
+			return fmt.Errorf("URL #%d uses docker Chrome mode, which does not support proxy, DNS override or extension settings", i+1)
+		}
+	default:
+		return fmt.Errorf("URL #%d has unsupported Chrome mode: %s (supported: local, docker, auto)", i+1, config.URLs[i].ChromeMode)
+	}
+
+	// Apply the global storage state if the URL doesn't have its own
+	if config.URLs[i].StorageState == "" {
+		config.URLs[i].StorageState = config.StorageState
+	}
+
+	if config.URLs[i].LoginID != "" && !loginMap[config.URLs[i].LoginID] {
+		return fmt.Errorf("URL #%d references non-existent login: %s", i+1, config.URLs[i].LoginID)
+	}
+
+	// Validate pre-capture actions
+	for j, action := range config.URLs[i].Actions {
+		if err := validateAction(action); err != nil {
+			return fmt.Errorf("URL #%d action #%d is invalid: %w", i+1, j+1, err)
+		}
+		if action.CapturePrintable != nil && j != len(config.URLs[i].Actions)-1 {
+			return fmt.Errorf("URL #%d action #%d is invalid: capturePrintable must be the last action", i+1, j+1)
+		}
+	}
+
+	// Validate placeholder substitutions
+	for j, placeholder := range config.URLs[i].Placeholders {
+		if err := validatePlaceholder(placeholder); err != nil {
+			return fmt.Errorf("URL #%d placeholder #%d is invalid: %w", i+1, j+1, err)
+		}
+	}
+
+	// Set default selector wait timeout if not specified
+	if config.URLs[i].WaitTimeout == 0 {
+		config.URLs[i].WaitTimeout = 30000 // 30 seconds default
+	} else if config.URLs[i].WaitTimeout < 0 {
+		return fmt.Errorf("URL #%d waitTimeout must not be negative", i+1)
+	}
+
+	// Set default sample count if not specified
+	if config.URLs[i].Samples == 0 {
+		config.URLs[i].Samples = 1
+	} else if config.URLs[i].Samples < 1 {
+		return fmt.Errorf("URL #%d samples must be at least 1", i+1)
+	}
+
+	if config.URLs[i].SampleInterval < 0 {
+		return fmt.Errorf("URL #%d sampleInterval must not be negative", i+1)
+	}
+
+	// Apply default user simulation if the URL doesn't have its own
+	if config.URLs[i].UserSimulation == nil && config.UserSimulation != nil {
+		simulation := *config.UserSimulation
+		config.URLs[i].UserSimulation = &simulation
+	}
+
+	if sim := config.URLs[i].UserSimulation; sim != nil && sim.Enabled {
+		if err := validateUserSimulation(sim); err != nil {
+			return fmt.Errorf("URL #%d has invalid userSimulation: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// validateProxy validates proxy settings and sets defaults
+func validateProxy(proxy *Proxy, secrets *secretResolver) error {
+	if proxy.URL == "" {
+		return fmt.Errorf("proxy is missing url")
+	}
+
+	parsed, err := url.Parse(proxy.URL)
+	if err != nil {
+		return fmt.Errorf("invalid proxy url %s: %w", proxy.URL, err)
+	}
+	if parsed.Scheme != "http" || parsed.Host == "" {
+		return fmt.Errorf("proxy url must be of the form http://host:port, got %s", proxy.URL)
+	}
+
+	if proxy.PasswordSecret != "" {
+		password, err := secrets.resolve(proxy.PasswordSecret)
+		if err != nil {
+			return fmt.Errorf("proxy password: %w", err)
+		}
+		proxy.Password = password
+	}
+
+	// Default to basic authentication when credentials are given
+	if proxy.Auth == "" && proxy.Username != "" {
+		proxy.Auth = "basic"
+	}
+
+	switch proxy.Auth {
+	case "":
+	case "basic", "ntlm", "negotiate":
+		if proxy.Username == "" {
+			return fmt.Errorf("proxy auth %s requires a username", proxy.Auth)
+		}
+	default:
+		return fmt.Errorf("unsupported proxy auth: %s (supported: basic, ntlm, negotiate)", proxy.Auth)
+	}
+
+	return nil
+}
+
+// mergeCookies returns the cookies of the layers in order, a cookie replacing the cookie of
+// the same name of an earlier layer in place
+func mergeCookies(layers ...[]Cookie) []Cookie {
+	var merged []Cookie
+	positions := make(map[string]int)
+	for _, layer := range layers {
+		for _, cookie := range layer {
+			if i, ok := positions[cookie.Name]; ok {
+				merged[i] = cookie
+				continue
+			}
+			positions[cookie.Name] = len(merged)
+			merged = append(merged, cookie)
+		}
+	}
+	return merged
+}
+
+// mergeLocalStorage returns the localStorage items of the layers in order, an item replacing
+// the item with the same key of an earlier layer in place
+func mergeLocalStorage(layers ...[]LocalStorage) []LocalStorage {
+	var merged []LocalStorage
+	positions := make(map[string]int)
+	for _, layer := range layers {
+		for _, item := range layer {
+			if i, ok := positions[item.Key]; ok {
+				merged[i] = item
+				continue
+			}
+			positions[item.Key] = len(merged)
+			merged = append(merged, item)
+		}
+	}
+	return merged
+}
+
+// ForViewport returns the URL with the cookie and localStorage overrides of a viewport
+// applied, an override replacing the URL's value with the same name
+func (u URLConfig) ForViewport(viewport Viewport) URLConfig {
+	if len(viewport.Cookies) > 0 {
+		u.Cookies = mergeCookies(u.Cookies, viewport.Cookies)
+	}
+	if len(viewport.LocalStorage) > 0 {
+		u.LocalStorage = mergeLocalStorage(u.LocalStorage, viewport.LocalStorage)
+	}
+	return u
+}
+
+// validateValueFrom validates the command producing a cookie or localStorage value and sets defaults
+func validateValueFrom(from *ValueFrom, value string) error {
+	if from == nil {
+		return nil
+	}
+	if from.Command == "" {
+		return fmt.Errorf("valueFrom is missing command")
+	}
+	if value != "" {
+		return fmt.Errorf("value and valueFrom can't be combined")
+	}
+	if from.Timeout == 0 {
+		from.Timeout = 30000 // 30 seconds default
+	} else if from.Timeout < 0 {
+		return fmt.Errorf("valueFrom timeout must not be negative")
+	}
+	return nil
+}
+
+// validateLogin validates a login flow and sets defaults
+func validateLogin(login *Login, secrets *secretResolver) error {
+	if login.Name == "" {
+		return fmt.Errorf("login is missing name")
+	}
+	if login.LoginURL == "" {
+		return fmt.Errorf("login %s is missing loginUrl", login.Name)
+	}
+	if login.UsernameSelector == "" || login.PasswordSelector == "" || login.SubmitSelector == "" {
+		return fmt.Errorf("login %s requires usernameSelector, passwordSelector and submitSelector", login.Name)
+	}
+	if login.SuccessSelector == "" && login.SuccessURL == "" {
+		return fmt.Errorf("login %s requires successSelector or successUrl", login.Name)
+	}
+
+	// Resolve the password from the environment if requested
+	if login.PasswordEnv != "" {
+		login.Password = os.Getenv(login.PasswordEnv)
+		if login.Password == "" {
+			return fmt.Errorf("login %s password environment variable %s is not set", login.Name, login.PasswordEnv)
+		}
+	}
+	if login.PasswordSecret != "" {
+		password, err := secrets.resolve(login.PasswordSecret)
+		if err != nil {
+			return fmt.Errorf("login %s password: %w", login.Name, err)
+		}
+		login.Password = password
+	}
+
+	if login.Timeout == 0 {
+		login.Timeout = 60000 // 60 seconds default
+	} else if login.Timeout < 0 {
+		return fmt.Errorf("login %s timeout must not be negative", login.Name)
+	}
+
+	return nil
+}
+
+// validateUpload checks that an upload names a supported backend and its destination
+func validateUpload(upload *Upload, secrets *secretResolver) error {
+	switch upload.Type {
+	case "s3", "gcs":
+		if upload.Bucket == "" {
+			return fmt.Errorf("%s upload is missing bucket", upload.Type)
+		}
+	case "azure":
+		if upload.Container == "" {
+			return fmt.Errorf("azure upload is missing container")
+		}
+	case "":
+		return fmt.Errorf("upload is missing type")
+	default:
+		return fmt.Errorf("unsupported upload type: %s (supported: s3, gcs, azure)", upload.Type)
+	}
+
+	if upload.Endpoint != "" {
+		parsed, err := url.Parse(upload.Endpoint)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("endpoint must be of the form https://host[:port], got %s", upload.Endpoint)
+		}
+	}
+
+	if upload.PublicURL != "" {
+		parsed, err := url.Parse(upload.PublicURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("publicUrl must be an http or https URL, got %s", upload.PublicURL)
+		}
+	}
+
+	if len(upload.Secrets) > 0 {
+		upload.Credentials = make(map[string]string)
+		for name, reference := range upload.Secrets {
+			value, err := secrets.resolve(reference)
+			if err != nil {
+				return fmt.Errorf("credential %s: %w", name, err)
+			}
+			upload.Credentials[name] = value
+		}
+	}
+
+	return nil
+}
+
+// validateNotification checks that a notification names a supported channel and sets its defaults
+func validateNotification(notification *Notification) error {
+	switch notification.Type {
+	case "webhook", "slack", "teams":
+	case "":
+		return fmt.Errorf("notification is missing type")
+	default:
+		return fmt.Errorf("unsupported notification type: %s (supported: webhook, slack, teams)", notification.Type)
+	}
+
+	parsed, err := url.Parse(notification.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("url must be an http or https URL, got %q", notification.URL)
+	}
+
+	switch notification.On {
+	case "":
+		notification.On = "always"
+	case "always", "failure":
+	default:
+		return fmt.Errorf("on must be always or failure, got %s", notification.On)
+	}
+
+	for _, run := range notification.Runs {
+		if run == "" {
+			return fmt.Errorf("runs must not contain empty names")
+		}
+	}
+
+	return nil
+}
+
+// validateAlertRule checks that an alert rule has a name, a supported condition and
+// its threshold, and only routes to existing notifications
+func validateAlertRule(rule AlertRule, notificationNames map[string]bool) error {
+	if rule.Name == "" {
+		return fmt.Errorf("alert is missing name")
+	}
+
+	switch rule.Type {
+	case "cookie":
+		if rule.Cookie == "" {
+			return fmt.Errorf("cookie alert is missing cookie")
+		}
+		if _, err := path.Match(rule.Cookie, ""); err != nil {
+			return fmt.Errorf("invalid cookie pattern %s: %w", rule.Cookie, err)
+		}
+		if _, err := path.Match(rule.Domain, ""); err != nil {
+			return fmt.Errorf("invalid domain pattern %s: %w", rule.Domain, err)
+		}
+	case "diff":
+		if rule.MaxDiff <= 0 || rule.MaxDiff >= 1 {
+			return fmt.Errorf("diff alert maxDiff must be between 0 and 1, got %g", rule.MaxDiff)
+		}
+	case "pageWeight":
+		if rule.MaxBytes <= 0 {
+			return fmt.Errorf("pageWeight alert maxBytes must be positive")
+		}
+	case "":
+		return fmt.Errorf("alert is missing type")
+	default:
+		return fmt.Errorf("unsupported alert type: %s (supported: cookie, diff, pageWeight)", rule.Type)
+	}
+
+	for _, name := range rule.Notify {
+		if !notificationNames[name] {
+			return fmt.Errorf("notify names unknown notification: %s", name)
+		}
+	}
+
+	return nil
+}
+
+// validateIssues checks that issue filing names a supported tracker and a repository, and sets its defaults
+func validateIssues(issues *Issues) error {
+	switch issues.Type {
+	case "github", "gitlab":
+	case "":
+		return fmt.Errorf("issues are missing type")
+	default:
+		return fmt.Errorf("unsupported issue tracker: %s (supported: github, gitlab)", issues.Type)
+	}
+
+	if issues.Repository == "" {
+		return fmt.Errorf("issues are missing repository")
+	}
+	if issues.Type == "github" && strings.Count(issues.Repository, "/") != 1 {
+		return fmt.Errorf("github repository must be of the form owner/repo, got %s", issues.Repository)
+	}
+
+	if issues.APIURL != "" {
+		parsed, err := url.Parse(issues.APIURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("apiUrl must be an http or https URL, got %s", issues.APIURL)
+		}
+	}
+
+	if issues.After == 0 {
+		issues.After = 3
+	} else if issues.After < 0 {
+		return fmt.Errorf("after must not be negative")
+	}
+
+	return nil
+}
+
+// validateWebDriver checks that the webdriver backend has a Grid to connect to, and sets its defaults
+func validateWebDriver(webDriver *WebDriver) error {
+	if webDriver == nil || webDriver.URL == "" {
+		return fmt.Errorf("missing url")
+	}
+	parsed, err := url.Parse(webDriver.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("url must be an http or https URL, got %s", webDriver.URL)
+	}
+	if webDriver.SessionTimeout == 0 {
+		webDriver.SessionTimeout = 300000 // 5 minutes default
+	} else if webDriver.SessionTimeout < 0 {
+		return fmt.Errorf("sessionTimeout must not be negative")
+	}
+	return nil
+}
+
+// validateReview checks that reporting on pull and merge requests names a supported code host, and sets its defaults
+func validateReview(review *Review) error {
+	switch review.Type {
+	case "github", "gitlab":
+	case "":
+		return fmt.Errorf("review is missing type")
+	default:
+		return fmt.Errorf("unsupported code host: %s (supported: github, gitlab)", review.Type)
+	}
+
+	if review.Type == "github" && review.Repository != "" && strings.Count(review.Repository, "/") != 1 {
+		return fmt.Errorf("github repository must be of the form owner/repo, got %s", review.Repository)
+	}
+
+	for name, value := range map[string]string{"apiUrl": review.APIURL, "reportUrl": review.ReportURL} {
+		if value == "" {
+			continue
+		}
+		parsed, err := url.Parse(value)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("%s must be an http or https URL, got %s", name, value)
+		}
+	}
+
+	if review.Context == "" {
+		review.Context = "screenshot-tool"
+	}
+
+	switch review.Comment {
+	case "":
+		review.Comment = "failures"
+	case "failures", "always", "never":
+	default:
+		return fmt.Errorf("unsupported comment setting: %s (supported: failures, always, never)", review.Comment)
+	}
+
+	return nil
+}
+
+// validateScrollRecording checks a scroll recording and sets its defaults
+func validateScrollRecording(recording *ScrollRecording) error {
+	switch recording.Format {
+	case "":
+		recording.Format = "gif"
+	case "gif", "webm":
+	default:
+		return fmt.Errorf("unsupported format: %s (supported: gif, webm)", recording.Format)
+	}
+
+	if recording.Duration == 0 {
+		recording.Duration = 5000
+	} else if recording.Duration < 0 {
+		return fmt.Errorf("duration must not be negative")
+	}
+	if recording.FPS == 0 {
+		recording.FPS = 10
+	} else if recording.FPS < 1 || recording.FPS > 50 {
+		return fmt.Errorf("fps must be between 1 and 50")
+	}
+	if recording.MaxWidth == 0 {
+		recording.MaxWidth = 800
+	} else if recording.MaxWidth < 0 {
+		return fmt.Errorf("maxWidth must not be negative")
+	}
+	return nil
+}
+
+// validateVideoRecording checks a session video and sets its defaults
+func validateVideoRecording(video *VideoRecording) error {
+	switch video.Format {
+	case "":
+		video.Format = "webm"
+	case "gif", "webm":
+	default:
+		return fmt.Errorf("unsupported format: %s (supported: webm, gif)", video.Format)
+	}
+
+	if video.FPS == 0 {
+		video.FPS = 5
+	} else if video.FPS < 1 || video.FPS > 50 {
+		return fmt.Errorf("fps must be between 1 and 50")
+	}
+	if video.MaxWidth == 0 {
+		video.MaxWidth = 800
+	} else if video.MaxWidth < 0 {
+		return fmt.Errorf("maxWidth must not be negative")
+	}
+	return nil
+}
+
+// validateDiffMode checks a baseline comparison mode
+func validateDiffMode(mode string) error {
+	switch mode {
+	case "pixel", "ssim", "phash":
+		return nil
+	default:
+		return fmt.Errorf("unsupported diff mode: %s (supported: pixel, ssim, phash)", mode)
+	}
+}
+
+// validateDiffTolerance checks the tolerance of a baseline comparison
+func validateDiffTolerance(tolerance *DiffTolerance) error {
+	if tolerance.MaxChangedPercent < 0 || tolerance.MaxChangedPercent >= 100 {
+		return fmt.Errorf("maxChangedPercent must be between 0 and 100, got %g", tolerance.MaxChangedPercent)
+	}
+	if tolerance.PixelTolerance < 0 || tolerance.PixelTolerance > 255 {
+		return fmt.Errorf("pixelTolerance must be between 0 and 255, got %d", tolerance.PixelTolerance)
+	}
+	return nil
+}
+
+// validateThrottling checks network throttling and fills in the values of its profile
+func validateThrottling(throttling *Throttling) error {
+	if throttling.Profile != "" {
+		profile, ok := throttlingProfiles[throttling.Profile]
+		if !ok {
+			return fmt.Errorf("unsupported profile: %s (supported: slow-3g, fast-3g)", throttling.Profile)
+		}
+		if throttling.Latency == 0 {
+			throttling.Latency = profile.Latency
+		}
+		if throttling.Download == 0 {
+			throttling.Download = profile.Download
+		}
+		if throttling.Upload == 0 {
+			throttling.Upload = profile.Upload
+		}
+	}
+
+	if throttling.Latency < 0 || throttling.Download < 0 || throttling.Upload < 0 {
+		return fmt.Errorf("latency and bandwidth must not be negative")
+	}
+	if throttling.Latency == 0 && throttling.Download == 0 && throttling.Upload == 0 {
+		return fmt.Errorf("a profile, latency or bandwidth is required")
+	}
+	return nil
+}
+
+// validateChromeFlag checks that a Chrome flag has the form --name or --name=value
+func validateChromeFlag(flag string) error {
+	name, _, _ := strings.Cut(strings.TrimPrefix(flag, "--"), "=")
+	if !strings.HasPrefix(flag, "--") || name == "" || strings.ContainsAny(name, " \t") {
+		return fmt.Errorf("%q must have the form --name or --name=value", flag)
+	}
+	return nil
+}
+
+// validateExtension checks that dir is an unpacked Chrome extension and returns its absolute path,
+// which Chrome needs as it may not share the working directory
+func validateExtension(dir string) (string, error) {
+	if strings.Contains(dir, ",") {
+		return "", fmt.Errorf("extension path %s must not contain commas", dir)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "manifest.json")); err != nil {
+		return "", fmt.Errorf("%s is not an unpacked extension: %w", dir, err)
+	}
+	return filepath.Abs(dir)
+}
+
+// validateRewriteRule checks that a rewrite rule matches something and changes something
+func validateRewriteRule(rule RewriteRule) error {
+	if rule.Match != "" {
+		if _, err := regexp.Compile(rule.Match); err != nil {
+			return fmt.Errorf("invalid match pattern %s: %w", rule.Match, err)
+		}
+	}
+
+	if rule.ToHost != "" && rule.FromHost == "" {
+		return fmt.Errorf("toHost requires fromHost")
+	}
+	if rule.ToHost == "" && len(rule.Headers) == 0 {
+		return fmt.Errorf("rule must set toHost or headers")
+	}
+
+	return nil
+}
+
+// validatePlaceholder checks that a placeholder has a selector and a valid match pattern
+func validatePlaceholder(placeholder Placeholder) error {
+	if strings.TrimSpace(placeholder.Selector) == "" {
+		return fmt.Errorf("placeholder is missing selector")
+	}
+
+	if placeholder.Match != "" {
+		if _, err := regexp.Compile(placeholder.Match); err != nil {
+			return fmt.Errorf("invalid match pattern %s: %w", placeholder.Match, err)
+		}
+	}
+
+	return nil
+}
+
+// validateAction checks that an action specifies exactly one interaction
+func validateAction(action Action) error {
+	count := 0
+	if action.Click != "" {
+		count++
+	}
+	if action.Type != nil {
+		if action.Type.Selector == "" {
+			return fmt.Errorf("type action is missing selector")
+		}
+		count++
+	}
+	if action.ScrollTo != "" {
+		count++
+	}
+	if action.Hover != "" {
+		count++
+	}
+	if action.Wait != 0 {
+		if action.Wait < 0 {
+			return fmt.Errorf("wait must not be negative")
+		}
+		count++
+	}
+	if action.CapturePrintable != nil {
+		for _, selector := range action.CapturePrintable.HideSelectors {
+			if strings.TrimSpace(selector) == "" {
+				return fmt.Errorf("capturePrintable has an empty hide selector")
+			}
+		}
+		count++
+	}
+	if action.TabThrough != nil {
+		if action.TabThrough.MaxStops == 0 {
+			action.TabThrough.MaxStops = 20
+		} else if action.TabThrough.MaxStops < 0 {
+			return fmt.Errorf("tabThrough maxStops must not be negative")
+		}
+		count++
+	}
+
+	if count != 1 {
+		return fmt.Errorf("exactly one of click, type, scrollTo, hover, wait, capturePrintable or tabThrough must be set")
+	}
+	return nil
+}
+
 // ensureOutputDir ensures the output directory exists
 func ensureOutputDir(dir string) error {
 	return os.MkdirAll(dir, 0755)
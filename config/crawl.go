@@ -0,0 +1,178 @@
+package config
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Crawl discovers the pages to capture by following links from seed URLs
+type Crawl struct {
+	Seeds    []string `json:"seeds"`              // Pages the crawl starts from
+	MaxDepth int      `json:"maxDepth,omitempty"` // Maximum number of links followed from a seed, defaults to 2
+	MaxPages int      `json:"maxPages,omitempty"` // Maximum number of pages discovered, defaults to 100
+	Domains  []string `json:"domains,omitempty"`  // Additional domains to follow links to, the seeds' domains are always followed
+	Include  []string `json:"include,omitempty"`  // Regular expressions, only matching pages are captured if set
+	Exclude  []string `json:"exclude,omitempty"`  // Regular expressions of pages that are neither captured nor followed
+}
+
+// maxCrawlPageSize limits how much of a page is read when looking for links
+const maxCrawlPageSize = 10 << 20 // 10 MB
+
+var (
+	// linkPattern finds the targets of anchor and area elements
+	linkPattern = regexp.MustCompile(`(?is)<(?:a|area)\s[^>]*?href\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+	// basePattern finds a <base href> that relative links resolve against
+	basePattern = regexp.MustCompile(`(?is)<base\s[^>]*?href\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+)
+
+// crawlTarget is a page waiting to be fetched
+type crawlTarget struct {
+	url   *url.URL
+	depth int
+}
+
+// CrawlSite follows links breadth-first from the seeds and returns the HTML
+// pages found on the allowed domains that pass the filters, in discovery order
+func CrawlSite(crawl Crawl) ([]string, error) {
+	include, err := compilePatterns(crawl.Include)
+	if err != nil {
+		return nil, fmt.Errorf("invalid include pattern: %w", err)
+	}
+	exclude, err := compilePatterns(crawl.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exclude pattern: %w", err)
+	}
+
+	domains := make(map[string]bool)
+	for _, domain := range crawl.Domains {
+		domains[normalizeHost(domain)] = true
+	}
+
+	var queue []crawlTarget
+	queued := make(map[string]bool)
+	for _, seed := range crawl.Seeds {
+		parsed, err := url.Parse(strings.TrimSpace(seed))
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return nil, fmt.Errorf("invalid seed URL: %s", seed)
+		}
+		parsed.Fragment = ""
+		domains[normalizeHost(parsed.Hostname())] = true
+		if !queued[parsed.String()] {
+			queued[parsed.String()] = true
+			queue = append(queue, crawlTarget{url: parsed})
+		}
+	}
+
+	var pages []string
+	for len(queue) > 0 && len(pages) < crawl.MaxPages {
+		target := queue[0]
+		queue = queue[1:]
+		pageURL := target.url.String()
+
+		body, finalURL, err := fetchCrawlPage(target.url)
+		if err != nil {
+			log.Printf("Warning: Crawl skipped %s: %v", pageURL, err)
+			continue
+		}
+
+		// A redirect may leave the allowed domains
+		if !domains[normalizeHost(finalURL.Hostname())] {
+			log.Printf("Crawl skipped %s: redirected off-site to %s", pageURL, finalURL)
+			continue
+		}
+
+		if len(include) == 0 || matchesAny(include, pageURL) {
+			pages = append(pages, pageURL)
+			log.Printf("Crawl found page %d/%d at depth %d: %s", len(pages), crawl.MaxPages, target.depth, pageURL)
+		}
+
+		if target.depth >= crawl.MaxDepth {
+			continue
+		}
+
+		for _, link := range extractLinks(body, finalURL) {
+			key := link.String()
+			if queued[key] || !domains[normalizeHost(link.Hostname())] || matchesAny(exclude, key) {
+				continue
+			}
+			queued[key] = true
+			queue = append(queue, crawlTarget{url: link, depth: target.depth + 1})
+		}
+	}
+
+	log.Printf("Crawl discovered %d pages from %d seeds", len(pages), len(crawl.Seeds))
+	return pages, nil
+}
+
+// fetchCrawlPage downloads an HTML page, returning its body and the URL it was served from after redirects
+func fetchCrawlPage(pageURL *url.URL) (string, *url.URL, error) {
+	resp, err := httpClient.Get(pageURL.String())
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, fmt.Errorf("status %s", resp.Status)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return "", nil, fmt.Errorf("not an HTML page (%s)", mediaType)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxCrawlPageSize))
+	if err != nil {
+		return "", nil, err
+	}
+
+	return string(data), resp.Request.URL, nil
+}
+
+// extractLinks returns the absolute http(s) links of a page without fragments
+func extractLinks(body string, pageURL *url.URL) []*url.URL {
+	base := pageURL
+	if match := basePattern.FindStringSubmatch(body); match != nil {
+		if parsed, err := pageURL.Parse(html.UnescapeString(firstGroup(match))); err == nil {
+			base = parsed
+		}
+	}
+
+	var links []*url.URL
+	for _, match := range linkPattern.FindAllStringSubmatch(body, -1) {
+		href := strings.TrimSpace(html.UnescapeString(firstGroup(match)))
+		if href == "" || strings.HasPrefix(href, "#") {
+			continue
+		}
+
+		link, err := base.Parse(href)
+		if err != nil || (link.Scheme != "http" && link.Scheme != "https") {
+			continue
+		}
+		link.Fragment = ""
+		links = append(links, link)
+	}
+	return links
+}
+
+// firstGroup returns the first non-empty capture group of a match
+func firstGroup(match []string) string {
+	for _, group := range match[1:] {
+		if group != "" {
+			return group
+		}
+	}
+	return ""
+}
+
+// normalizeHost lowercases a host and removes the www. prefix, so both forms of a domain are treated alike
+func normalizeHost(host string) string {
+	return strings.TrimPrefix(strings.ToLower(host), "www.")
+}
@@ -0,0 +1,205 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule captures a group of URLs whenever its cron expression matches
+type Schedule struct {
+	Name     string   `json:"name"`               // Names the directory the runs are written to
+	Cron     string   `json:"cron"`               // Five-field cron expression or a macro such as @daily
+	URLs     []string `json:"urls,omitempty"`     // Names of the URLs to capture, all URLs if not specified
+	Timezone string   `json:"timezone,omitempty"` // IANA time zone the expression is evaluated in, defaults to local time
+
+	Parsed   *CronSchedule  `json:"-"`
+	Location *time.Location `json:"-"`
+}
+
+// CronSchedule is a parsed five-field cron expression: minute, hour, day of month, month and day of week
+type CronSchedule struct {
+	minutes, hours, days, months, weekdays uint64 // Bit sets of the allowed values
+	anyDay, anyWeekday                     bool   // Whether the day fields were "*"
+}
+
+// validateSchedule parses a schedule's expression and time zone
+func validateSchedule(schedule *Schedule) error {
+	if schedule.Name == "" {
+		return fmt.Errorf("schedule is missing name")
+	}
+	if strings.ContainsAny(schedule.Name, `/\`) || schedule.Name == "." || schedule.Name == ".." {
+		return fmt.Errorf("schedule name %s must not contain path separators", schedule.Name)
+	}
+
+	parsed, err := ParseCron(schedule.Cron)
+	if err != nil {
+		return fmt.Errorf("schedule %s: %w", schedule.Name, err)
+	}
+	schedule.Parsed = parsed
+
+	schedule.Location = time.Local
+	if schedule.Timezone != "" {
+		if schedule.Location, err = time.LoadLocation(schedule.Timezone); err != nil {
+			return fmt.Errorf("schedule %s has invalid timezone: %w", schedule.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// cronMacros are the supported shorthand schedules
+var cronMacros = map[string]string{
+	"@yearly":  "0 0 1 1 *",
+	"@monthly": "0 0 1 * *",
+	"@weekly":  "0 0 * * 0",
+	"@daily":   "0 0 * * *",
+	"@hourly":  "0 * * * *",
+}
+
+var (
+	monthNames   = map[string]int{"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6, "jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}
+	weekdayNames = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+)
+
+// ParseCron parses a cron expression. Each field accepts *, values, ranges (1-5),
+// steps (*/15, 0-30/10) and comma-separated lists; months and weekdays also accept
+// three-letter names. Weekday 7 is Sunday, like 0.
+func ParseCron(expr string) (*CronSchedule, error) {
+	expr = strings.TrimSpace(expr)
+	if macro, ok := cronMacros[strings.ToLower(expr)]; ok {
+		expr = macro
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields, found %d", expr, len(fields))
+	}
+
+	var sched CronSchedule
+	var err error
+	if sched.minutes, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("invalid minute field: %w", err)
+	}
+	if sched.hours, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("invalid hour field: %w", err)
+	}
+	if sched.days, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("invalid day of month field: %w", err)
+	}
+	if sched.months, err = parseCronField(fields[3], 1, 12, monthNames); err != nil {
+		return nil, fmt.Errorf("invalid month field: %w", err)
+	}
+	if sched.weekdays, err = parseCronField(fields[4], 0, 7, weekdayNames); err != nil {
+		return nil, fmt.Errorf("invalid day of week field: %w", err)
+	}
+
+	// Sunday can be written as 0 or 7
+	if sched.weekdays&(1<<7) != 0 {
+		sched.weekdays |= 1
+	}
+	sched.anyDay = fields[2] == "*"
+	sched.anyWeekday = fields[4] == "*"
+
+	return &sched, nil
+}
+
+// parseCronField parses one field into a bit set of the values it allows
+func parseCronField(field string, min, max int, names map[string]int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			rangePart = part[:i]
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			step = n
+		}
+
+		start, end := min, max
+		if rangePart != "*" {
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if start, err = parseCronValue(bounds[0], names); err != nil {
+				return 0, err
+			}
+			end = start
+			if len(bounds) == 2 {
+				if end, err = parseCronValue(bounds[1], names); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				// A single value with a step runs from that value to the maximum
+				end = max
+			}
+		}
+
+		if start < min || end > max || start > end {
+			return 0, fmt.Errorf("%q is out of range %d-%d", part, min, max)
+		}
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// parseCronValue parses a number or a name
+func parseCronValue(s string, names map[string]int) (int, error) {
+	if v, ok := names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	return v, nil
+}
+
+// Next returns the first time after t that matches the schedule, in t's location
+func (c *CronSchedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+
+	// Every schedule matches within a few years, e.g. February 29th
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if c.months&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.hours&(1<<uint(t.Hour())) == 0 {
+			t = t.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if c.minutes&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// matchesDay applies the cron rule that when both day fields are restricted, either may match
+func (c *CronSchedule) matchesDay(t time.Time) bool {
+	day := c.days&(1<<uint(t.Day())) != 0
+	weekday := c.weekdays&(1<<uint(t.Weekday())) != 0
+
+	switch {
+	case c.anyDay && c.anyWeekday:
+		return true
+	case c.anyDay:
+		return weekday
+	case c.anyWeekday:
+		return day
+	default:
+		return day || weekday
+	}
+}
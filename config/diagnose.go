@@ -0,0 +1,341 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Diagnostic is a problem found in a configuration file
+type Diagnostic struct {
+	Severity string `json:"severity"`          // "error" or "warning"
+	Pointer  string `json:"pointer,omitempty"` // JSON Pointer to the value in the merged configuration, e.g. /urls/2/cookieProfileId
+	Message  string `json:"message"`
+}
+
+// String formats the diagnostic for the terminal
+func (d Diagnostic) String() string {
+	if d.Pointer == "" {
+		return fmt.Sprintf("%s: %s", d.Severity, d.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", d.Severity, d.Pointer, d.Message)
+}
+
+// Diagnose checks a configuration file without failing at the first problem. It reports
+// unknown options, values of the wrong type, duplicate names, references to missing cookie
+// profiles and logins, and conflicting options, followed by the remaining validation error,
+// if any, and the lint warnings. The configuration is returned if it has no errors.
+func Diagnose(path string) (*Config, []Diagnostic) {
+	doc, err := loadIncludes(path, nil)
+	if err != nil {
+		return nil, []Diagnostic{{Severity: "error", Message: err.Error()}}
+	}
+
+	var diagnostics []Diagnostic
+	checkValue(doc, reflect.TypeOf(Config{}), "", &diagnostics)
+
+	// Decoding goes on past values of the wrong type, which are reported already
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, append(diagnostics, Diagnostic{Severity: "error", Message: err.Error()})
+	}
+	var config Config
+	json.Unmarshal(data, &config)
+	diagnostics = append(diagnostics, checkReferences(&config)...)
+
+	for _, d := range diagnostics {
+		if d.Severity == "error" {
+			return nil, diagnostics
+		}
+	}
+
+	// Validation stops at the first error, so it only runs once the others are fixed
+	if err := validateConfig(&config); err != nil {
+		return nil, append(diagnostics, Diagnostic{Severity: "error", Message: err.Error()})
+	}
+	for _, warning := range Lint(&config) {
+		diagnostics = append(diagnostics, Diagnostic{Severity: "warning", Message: warning})
+	}
+	return &config, diagnostics
+}
+
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// checkValue reports the options of a JSON value that its Go type doesn't have, and values
+// whose JSON type doesn't fit it. Null fits every type.
+func checkValue(value any, t reflect.Type, pointer string, diagnostics *[]Diagnostic) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if value == nil || reflect.PointerTo(t).Implements(unmarshalerType) {
+		return
+	}
+
+	wrongType := func(want string) {
+		*diagnostics = append(*diagnostics, Diagnostic{
+			Severity: "error",
+			Pointer:  pointer,
+			Message:  fmt.Sprintf("must be %s, not %s", want, jsonType(value)),
+		})
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		object, ok := value.(map[string]any)
+		if !ok {
+			wrongType("an object")
+			return
+		}
+		fields := jsonFields(t)
+		for _, key := range sortedObjectKeys(object) {
+			field, ok := fields[key]
+			if !ok {
+				// Decoding matches option names case-insensitively
+				for name, f := range fields {
+					if strings.EqualFold(name, key) {
+						field, ok = f, true
+						break
+					}
+				}
+			}
+			if !ok {
+				message := "unknown option " + strconv.Quote(key)
+				if suggestion := closestName(key, fields); suggestion != "" {
+					message += fmt.Sprintf(", did you mean %q?", suggestion)
+				}
+				*diagnostics = append(*diagnostics, Diagnostic{Severity: "error", Pointer: pointer + "/" + escapePointer(key), Message: message})
+				continue
+			}
+			checkValue(object[key], field.Type, pointer+"/"+escapePointer(key), diagnostics)
+		}
+	case reflect.Slice, reflect.Array:
+		list, ok := value.([]any)
+		if !ok {
+			wrongType("a list")
+			return
+		}
+		for i, entry := range list {
+			checkValue(entry, t.Elem(), pointer+"/"+strconv.Itoa(i), diagnostics)
+		}
+	case reflect.Map:
+		object, ok := value.(map[string]any)
+		if !ok {
+			wrongType("an object")
+			return
+		}
+		for _, key := range sortedObjectKeys(object) {
+			checkValue(object[key], t.Elem(), pointer+"/"+escapePointer(key), diagnostics)
+		}
+	case reflect.String:
+		if _, ok := value.(string); !ok {
+			wrongType("a string")
+		}
+	case reflect.Bool:
+		if _, ok := value.(bool); !ok {
+			wrongType("true or false")
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		number, ok := value.(json.Number)
+		if !ok {
+			wrongType("a number")
+		} else if _, err := number.Int64(); err != nil {
+			wrongType("a whole number")
+		}
+	case reflect.Float32, reflect.Float64:
+		if _, ok := value.(json.Number); !ok {
+			wrongType("a number")
+		}
+	}
+}
+
+// jsonFields returns the fields of a struct by their JSON option name
+func jsonFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field
+	}
+	return fields
+}
+
+// closestName returns the option name a misspelled one most likely meant, or "" if none
+// is close enough
+func closestName(key string, fields map[string]reflect.StructField) string {
+	best, bestDistance := "", 3
+	for name := range fields {
+		if d := editDistance(strings.ToLower(key), strings.ToLower(name)); d < bestDistance || d == bestDistance && name < best {
+			best, bestDistance = name, d
+		}
+	}
+	if bestDistance > 2 {
+		return ""
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+// checkReferences reports duplicate names, references to cookie profiles and logins that
+// don't exist, ones that are never referenced, and options that contradict each other
+func checkReferences(config *Config) []Diagnostic {
+	var diagnostics []Diagnostic
+	report := func(severity, pointer, format string, args ...any) {
+		diagnostics = append(diagnostics, Diagnostic{Severity: severity, Pointer: pointer, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// Names identify URLs in directory names and baselines, so they must be unique
+	urlNames := make(map[string]int)
+	for i, u := range config.URLs {
+		if u.Name == "" {
+			continue
+		}
+		if first, ok := urlNames[u.Name]; ok {
+			report("error", fmt.Sprintf("/urls/%d/name", i), "URL name %s is already used by /urls/%d", u.Name, first)
+			continue
+		}
+		urlNames[u.Name] = i
+	}
+
+	profiles := make(map[string]int)
+	for i, profile := range config.CookieProfiles {
+		if first, ok := profiles[profile.Name]; ok && profile.Name != "" {
+			report("error", fmt.Sprintf("/cookieProfiles/%d/name", i), "cookie profile name %s is already used by /cookieProfiles/%d", profile.Name, first)
+			continue
+		}
+		profiles[profile.Name] = i
+	}
+	logins := make(map[string]int)
+	for i, login := range config.Logins {
+		if first, ok := logins[login.Name]; ok && login.Name != "" {
+			report("error", fmt.Sprintf("/logins/%d/name", i), "login name %s is already used by /logins/%d", login.Name, first)
+			continue
+		}
+		logins[login.Name] = i
+	}
+
+	usedProfiles := make(map[string]bool)
+	usedLogins := make(map[string]bool)
+	for i, u := range config.URLs {
+		pointer := fmt.Sprintf("/urls/%d", i)
+		if u.URL == "" {
+			report("error", pointer, "url is missing")
+		}
+		if u.CookieProfileID != "" {
+			usedProfiles[u.CookieProfileID] = true
+			if _, ok := profiles[u.CookieProfileID]; !ok {
+				report("error", pointer+"/cookieProfileId", "cookie profile %s doesn't exist", u.CookieProfileID)
+			} else if config.CookieMerge == "replace" && len(u.Cookies) > 0 && len(u.LocalStorage) > 0 {
+				report("warning", pointer+"/cookieProfileId", "cookie profile %s has no effect, the URL sets its own cookies and localStorage", u.CookieProfileID)
+			} else if config.CookieMerge == "replace" && len(u.Cookies) > 0 {
+				report("warning", pointer+"/cookies", "the URL's cookies replace those of cookie profile %s", u.CookieProfileID)
+			}
+		}
+		if u.LoginID != "" {
+			usedLogins[u.LoginID] = true
+			if _, ok := logins[u.LoginID]; !ok {
+				report("error", pointer+"/loginId", "login %s doesn't exist", u.LoginID)
+			}
+		}
+		for j, viewport := range u.Viewports {
+			if viewport.Width <= 0 || viewport.Height <= 0 {
+				report("error", fmt.Sprintf("%s/viewports/%d", pointer, j), "viewport width and height must be positive")
+			}
+		}
+		if tolerance := u.DiffTolerance; tolerance != nil && config.Diff == nil {
+			report("warning", pointer+"/diffTolerance", "diffTolerance has no effect without diff")
+		}
+	}
+	for j, viewport := range config.DefaultViewports {
+		if viewport.Width <= 0 || viewport.Height <= 0 {
+			report("error", fmt.Sprintf("/defaultViewports/%d", j), "viewport width and height must be positive")
+		}
+	}
+
+	for i, profile := range config.CookieProfiles {
+		if profile.Name != "" && !usedProfiles[profile.Name] {
+			report("warning", fmt.Sprintf("/cookieProfiles/%d", i), "cookie profile %s isn't used by any URL", profile.Name)
+		}
+	}
+	for i, login := range config.Logins {
+		if login.Name != "" && !usedLogins[login.Name] {
+			report("warning", fmt.Sprintf("/logins/%d", i), "login %s isn't used by any URL", login.Name)
+		}
+	}
+
+	// Options that can't be combined
+	if config.TabPool != nil && config.TabPool.Enabled && config.SeparateBrowsers {
+		report("error", "/tabPool/enabled", "tabPool can't be used with separateBrowsers")
+	}
+	if diff := config.Diff; diff != nil && diff.Threshold != 0 && diff.Tolerance != nil && diff.Tolerance.MaxChangedPercent > 0 {
+		report("error", "/diff/threshold", "threshold and tolerance maxChangedPercent can't be used together")
+	}
+	if len(config.Alerts) > 0 && len(config.Notifications) == 0 {
+		report("error", "/alerts", "alerts require at least one notification")
+	}
+	return diagnostics
+}
+
+// jsonType names the JSON type of a decoded value
+func jsonType(value any) string {
+	switch value.(type) {
+	case map[string]any:
+		return "an object"
+	case []any:
+		return "a list"
+	case string:
+		return "a string"
+	case bool:
+		return "true or false"
+	case json.Number:
+		return "a number"
+	default:
+		return "null"
+	}
+}
+
+// escapePointer escapes an object key for a JSON Pointer
+func escapePointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
+
+// sortedObjectKeys returns the keys of a JSON object in order, so diagnostics are stable
+func sortedObjectKeys(object map[string]any) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,325 @@
+package config
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// gcpSecretsScope is the OAuth scope needed to access Secret Manager
+const gcpSecretsScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// gcpSecrets reads secrets from Google Cloud Secret Manager. Secrets are named by their ID
+// in the project, or by their resource name, e.g. projects/p/secrets/login/versions/3.
+type gcpSecrets struct {
+	endpoint string
+	project  string
+
+	// Credentials: a fixed access token, or a service account key, gcloud user credentials or
+	// the metadata server, whose token is fetched once
+	accessToken  string
+	account      *gcpServiceAccount
+	user         *gcpAuthorizedUser
+	metadataHost string
+}
+
+// gcpServiceAccount is the part of a service account key file needed to obtain a token
+type gcpServiceAccount struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+	ProjectID   string `json:"project_id"`
+}
+
+// gcpAuthorizedUser is the part of the user credentials gcloud auth application-default
+// login saves needed to obtain a token
+type gcpAuthorizedUser struct {
+	ClientID       string `json:"client_id"`
+	ClientSecret   string `json:"client_secret"`
+	RefreshToken   string `json:"refresh_token"`
+	QuotaProjectID string `json:"quota_project_id"`
+}
+
+// newGCPSecrets creates a Secret Manager provider with the application default credentials:
+// the key file named by GOOGLE_APPLICATION_CREDENTIALS, GOOGLE_OAUTH_ACCESS_TOKEN, the
+// credentials of gcloud auth application-default login, or the service account of the
+// metadata server on Compute Engine, GKE with Workload Identity and Cloud Run.
+func newGCPSecrets(secrets *Secrets) (*gcpSecrets, error) {
+	g := &gcpSecrets{
+		endpoint: strings.TrimSuffix(secrets.Endpoint, "/"),
+		project:  secrets.Project,
+	}
+	if g.endpoint == "" {
+		g.endpoint = "https://secretmanager.googleapis.com"
+	}
+
+	path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	g.accessToken = os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN")
+	if path == "" && g.accessToken == "" {
+		path = gcloudCredentialsPath()
+	}
+	switch {
+	case path != "":
+		g.accessToken = ""
+		if err := g.readCredentials(path); err != nil {
+			return nil, err
+		}
+	case g.accessToken == "":
+		// Workloads on Google Cloud get the token of their service account from the metadata server
+		if g.metadataHost = os.Getenv("GCE_METADATA_HOST"); g.metadataHost == "" {
+			g.metadataHost = "metadata.google.internal"
+		}
+	}
+
+	if g.project == "" {
+		g.project = os.Getenv("GOOGLE_CLOUD_PROJECT")
+	}
+	return g, nil
+}
+
+// readCredentials reads a service account key or gcloud user credentials file
+func (g *gcpSecrets) readCredentials(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read GCP credentials: %w", err)
+	}
+	var credentials struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &credentials); err != nil {
+		return fmt.Errorf("failed to parse GCP credentials %s: %w", path, err)
+	}
+
+	switch credentials.Type {
+	case "service_account":
+		var account gcpServiceAccount
+		if err := json.Unmarshal(data, &account); err != nil {
+			return fmt.Errorf("failed to parse GCP credentials %s: %w", path, err)
+		}
+		if account.ClientEmail == "" || account.PrivateKey == "" {
+			return fmt.Errorf("GCP credentials %s are missing the client email or private key", path)
+		}
+		if account.TokenURI == "" {
+			account.TokenURI = "https://oauth2.googleapis.com/token"
+		}
+		if g.project == "" {
+			g.project = account.ProjectID
+		}
+		g.account = &account
+	case "authorized_user":
+		var user gcpAuthorizedUser
+		if err := json.Unmarshal(data, &user); err != nil {
+			return fmt.Errorf("failed to parse GCP credentials %s: %w", path, err)
+		}
+		if user.RefreshToken == "" {
+			return fmt.Errorf("GCP credentials %s are missing the refresh token", path)
+		}
+		if g.project == "" {
+			g.project = user.QuotaProjectID
+		}
+		g.user = &user
+	default:
+		return fmt.Errorf("GCP credentials %s are of unsupported type %q (supported: service_account, authorized_user)", path, credentials.Type)
+	}
+	return nil
+}
+
+// gcloudCredentialsPath returns the path of the credentials of gcloud auth application-default
+// login, empty if there are none
+func gcloudCredentialsPath() string {
+	dir := os.Getenv("CLOUDSDK_CONFIG")
+	if dir == "" {
+		if appData := os.Getenv("APPDATA"); runtime.GOOS == "windows" && appData != "" {
+			dir = filepath.Join(appData, "gcloud")
+		} else if home, err := os.UserHomeDir(); err == nil {
+			dir = filepath.Join(home, ".config", "gcloud")
+		} else {
+			return ""
+		}
+	}
+	path := filepath.Join(dir, "application_default_credentials.json")
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// fetch reads a version of a secret, the latest unless the resource name names one, or a
+// key of a secret holding a JSON object
+func (g *gcpSecrets) fetch(name, key string) (string, error) {
+	resource := name
+	if !strings.HasPrefix(resource, "projects/") {
+		if g.project == "" && g.metadataHost != "" {
+			project, err := g.metadata("project/project-id")
+			if err != nil {
+				return "", fmt.Errorf("failed to read the project from the metadata server: %w", err)
+			}
+			g.project = string(project)
+		}
+		if g.project == "" {
+			return "", fmt.Errorf("no project to read secret %s from, set project or GOOGLE_CLOUD_PROJECT", name)
+		}
+		resource = "projects/" + g.project + "/secrets/" + url.PathEscape(name)
+	}
+	if !strings.Contains(resource, "/versions/") {
+		resource += "/versions/latest"
+	}
+
+	token, err := g.bearerToken()
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodGet, g.endpoint+"/v1/"+resource+":access", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	data, err := readSecretResponse(resp)
+	if err != nil {
+		return "", err
+	}
+
+	var version struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(data, &version); err != nil {
+		return "", fmt.Errorf("invalid Secret Manager response: %w", err)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(version.Payload.Data)
+	if err != nil {
+		return "", fmt.Errorf("invalid secret payload: %w", err)
+	}
+
+	if key != "" {
+		return secretField(string(decoded), key)
+	}
+	return string(decoded), nil
+}
+
+// bearerToken returns the access token, obtaining one with the credentials on first use.
+// Configurations are resolved within seconds, so the token isn't renewed.
+func (g *gcpSecrets) bearerToken() (string, error) {
+	if g.accessToken != "" {
+		return g.accessToken, nil
+	}
+
+	var data []byte
+	var err error
+	switch {
+	case g.account != nil:
+		var assertion string
+		if assertion, err = g.account.signedJWT(time.Now()); err != nil {
+			return "", err
+		}
+		data, err = postGCPTokenRequest(g.account.TokenURI, url.Values{
+			"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+			"assertion":  {assertion},
+		})
+	case g.user != nil:
+		data, err = postGCPTokenRequest("https://oauth2.googleapis.com/token", url.Values{
+			"grant_type":    {"refresh_token"},
+			"client_id":     {g.user.ClientID},
+			"client_secret": {g.user.ClientSecret},
+			"refresh_token": {g.user.RefreshToken},
+		})
+	default:
+		if data, err = g.metadata("instance/service-accounts/default/token"); err != nil {
+			err = fmt.Errorf("no GCP credentials found, set GOOGLE_APPLICATION_CREDENTIALS or run gcloud auth application-default login, and the metadata server isn't reachable: %w", err)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(data, &token); err != nil || token.AccessToken == "" {
+		return "", fmt.Errorf("failed to parse GCP access token: %v", err)
+	}
+	g.accessToken = token.AccessToken
+	return g.accessToken, nil
+}
+
+// postGCPTokenRequest exchanges credentials for an access token at an OAuth token endpoint
+func postGCPTokenRequest(tokenURL string, form url.Values) ([]byte, error) {
+	resp, err := httpClient.PostForm(tokenURL, form)
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain GCP access token: %w", err)
+	}
+	data, err := readSecretResponse(resp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain GCP access token: %w", err)
+	}
+	return data, nil
+}
+
+// metadata reads a value of the metadata server, e.g. project/project-id
+func (g *gcpSecrets) metadata(path string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, "http://"+g.metadataHost+"/computeMetadata/v1/"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := metadataClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	return readSecretResponse(resp)
+}
+
+// signedJWT returns the assertion exchanged for an access token
+func (a *gcpServiceAccount) signedJWT(now time.Time) (string, error) {
+	block, _ := pem.Decode([]byte(a.PrivateKey))
+	if block == nil {
+		return "", fmt.Errorf("GCP credentials contain no private key")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse GCP private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", fmt.Errorf("GCP private key is not an RSA key")
+	}
+
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]any{
+		"iss":   a.ClientEmail,
+		"scope": gcpSecretsScope,
+		"aud":   a.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+	hash := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign GCP token request: %w", err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// readConfigFile reads a configuration file and the files it includes, and returns them
+// merged into a single JSON document. Included files are merged in order, each over the
+// ones before it, and the including file over all of them. Include paths are relative to
+// the file that includes them.
+func readConfigFile(path string) ([]byte, error) {
+	merged, err := loadIncludes(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(merged)
+}
+
+// ResolveConfigFile reads a configuration file as a JSON object with its includes merged
+// in, e.g. to hand the configuration to a process without access to the included files
+func ResolveConfigFile(path string) (map[string]any, error) {
+	return loadIncludes(path, nil)
+}
+
+// loadIncludes reads a configuration file as a JSON object with its includes merged in.
+// stack holds the files including it, to detect include cycles.
+func loadIncludes(path string, stack []string) (map[string]any, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %w", err)
+	}
+	for i, including := range stack {
+		if including == abs {
+			return nil, fmt.Errorf("include cycle: %s", strings.Join(append(stack[i:], abs), " -> "))
+		}
+	}
+	stack = append(stack, abs)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %w", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber() // Keep numbers exactly as written
+	var doc map[string]any
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+	if doc == nil {
+		return nil, fmt.Errorf("error parsing config file %s: not a JSON object", path)
+	}
+
+	includes, ok := doc["include"]
+	if !ok {
+		return doc, nil
+	}
+	delete(doc, "include")
+
+	var paths []string
+	raw, _ := json.Marshal(includes)
+	if err := json.Unmarshal(raw, &paths); err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: include must be a list of file paths", path)
+	}
+
+	merged := map[string]any{}
+	for _, include := range paths {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(path), include)
+		}
+		included, err := loadIncludes(include, stack)
+		if err != nil {
+			return nil, err
+		}
+		merged = mergeObjects(merged, included)
+	}
+	return mergeObjects(merged, doc), nil
+}
+
+// mergeObjects merges the JSON object over into base. Objects are merged key by key, and
+// lists of objects that all have a name by name: entries named like one in base are merged
+// into it, and the others are appended. Other values, including other lists and empty
+// lists, replace those of base, and null removes them.
+func mergeObjects(base, over map[string]any) map[string]any {
+	merged := make(map[string]any, len(base)+len(over))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range over {
+		if value == nil {
+			delete(merged, key)
+			continue
+		}
+		merged[key] = mergeValues(merged[key], value)
+	}
+	return merged
+}
+
+// mergeValues merges a JSON value over another, as mergeObjects does for their fields
+func mergeValues(base, over any) any {
+	switch over := over.(type) {
+	case map[string]any:
+		if base, ok := base.(map[string]any); ok {
+			return mergeObjects(base, over)
+		}
+	case []any:
+		if base, ok := base.([]any); ok && len(over) > 0 && namedList(base) && namedList(over) {
+			return mergeNamedLists(base, over)
+		}
+	}
+	return over
+}
+
+// mergeNamedLists merges lists of named objects, keeping the order of base with the
+// entries only over has appended
+func mergeNamedLists(base, over []any) []any {
+	merged := append([]any(nil), base...)
+	index := make(map[string]int, len(base))
+	for i, entry := range base {
+		index[entry.(map[string]any)["name"].(string)] = i
+	}
+
+	for _, entry := range over {
+		name := entry.(map[string]any)["name"].(string)
+		if i, ok := index[name]; ok {
+			merged[i] = mergeObjects(merged[i].(map[string]any), entry.(map[string]any))
+			continue
+		}
+		index[name] = len(merged)
+		merged = append(merged, entry)
+	}
+	return merged
+}
+
+// namedList reports whether a list consists of objects that all have a name. An empty list
+// counts as named, so entries can be merged into it.
+func namedList(list []any) bool {
+	for _, entry := range list {
+		object, ok := entry.(map[string]any)
+		if !ok {
+			return false
+		}
+		if name, ok := object["name"].(string); !ok || name == "" {
+			return false
+		}
+	}
+	return true
+}
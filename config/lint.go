@@ -0,0 +1,175 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Thresholds of the configuration lint
+const (
+	lintMaxDelay            = 10000 // Delay in milliseconds above which a URL is reported
+	lintMaxParallelCaptures = 12    // Captures running at once above which memory is likely to run out
+	lintMaxExamples         = 3     // URL names listed in a warning that applies to many URLs
+)
+
+// Lint returns warnings about settings that are valid but likely to make a run slow,
+// fail partway through or capture something other than intended. It expects a
+// configuration that passed validation.
+func Lint(config *Config) []string {
+	var warnings []string
+
+	// Long fixed delays add up over many URLs and viewports
+	var slow []string
+	for _, u := range config.URLs {
+		if u.Delay > lintMaxDelay {
+			slow = append(slow, fmt.Sprintf("%s (%ds)", u.Name, u.Delay/1000))
+		}
+	}
+	if len(slow) > 0 {
+		warnings = append(warnings, fmt.Sprintf("delay longer than %ds on %s; waitForSelector usually waits only as long as needed",
+			lintMaxDelay/1000, examples(slow)))
+	}
+
+	// Every viewport captured at once runs its own tab or browser
+	viewports := 0
+	for _, u := range config.URLs {
+		viewports = max(viewports, min(len(u.Viewports), config.ViewportConcurrency))
+	}
+	if parallel := min(config.Concurrency, len(config.URLs)) * viewports; parallel > lintMaxParallelCaptures {
+		warnings = append(warnings, fmt.Sprintf("concurrency %d with %d viewports per URL in parallel runs up to %d captures at once, each using several hundred MB of memory; lower concurrency or viewportConcurrency if the machine has less than %d GB",
+			config.Concurrency, viewports, parallel, (parallel+1)/2))
+	}
+
+	// Cookies without a domain are only set for the URL's own host
+	hosts := make(map[string]map[string]bool)
+	for _, u := range config.URLs {
+		host := extractDomain(u.URL)
+		parent := parentDomain(host)
+		if hosts[parent] == nil {
+			hosts[parent] = make(map[string]bool)
+		}
+		hosts[parent][host] = true
+	}
+	hostOnly := make(map[string][]string)
+	for _, u := range config.URLs {
+		host := extractDomain(u.URL)
+		parent := parentDomain(host)
+		if host == parent || len(hosts[parent]) < 2 {
+			continue
+		}
+		for _, cookie := range u.Cookies {
+			if cookie.Domain == "" {
+				hostOnly[cookie.Name] = append(hostOnly[cookie.Name], u.Name)
+			}
+		}
+	}
+	for _, name := range sortedKeys(hostOnly) {
+		warnings = append(warnings, fmt.Sprintf("cookie %s has no domain on %s, so it is only set for the URL's own host while other URLs are on sibling subdomains; set domain to share it",
+			name, examples(hostOnly[name])))
+	}
+
+	// PNG is lossless, so the quality setting has no effect
+	if config.qualitySet && config.FileFormat == "png" {
+		warnings = append(warnings, fmt.Sprintf("quality %d has no effect with fileFormat png, it only applies to jpeg", config.Quality))
+	}
+
+	// JPEG screenshots aren't recompressed
+	if config.OptimizeImages && config.FileFormat == "jpeg" {
+		warnings = append(warnings, "optimizeImages has no effect with fileFormat jpeg, it only recompresses png screenshots")
+	}
+
+	// The tolerance only relaxes the pixel comparison
+	var perceptual []string
+	for _, u := range config.URLs {
+		if u.DiffTolerance != nil && u.DiffMode != "" && u.DiffMode != "pixel" {
+			perceptual = append(perceptual, u.Name)
+		}
+	}
+	if len(perceptual) > 0 {
+		warnings = append(warnings, fmt.Sprintf("diff tolerance has no effect on %s, which use ssim or phash comparison", examples(perceptual)))
+	}
+
+	// Firefox captures skip what needs the Chrome DevTools protocol
+	for _, u := range config.URLs {
+		if ignored := FirefoxIgnoredOptions(u); len(ignored) > 0 {
+			warnings = append(warnings, fmt.Sprintf("%s uses Firefox, which ignores %s", u.Name, strings.Join(ignored, ", ")))
+		}
+	}
+
+	// Webhooks of triggers without a secret aren't authenticated
+	for _, trigger := range config.Triggers {
+		if trigger.Secret == "" {
+			warnings = append(warnings, fmt.Sprintf("trigger %s has no secret, so anyone who can reach the server can start its runs with POST /trigger/%s",
+				trigger.Name, trigger.Name))
+		}
+	}
+
+	return warnings
+}
+
+// FirefoxIgnoredOptions returns the options of a URL that its Firefox captures ignore, as
+// they need the Chrome DevTools protocol. It returns nothing for URLs captured in Chrome.
+func FirefoxIgnoredOptions(u URLConfig) []string {
+	if u.Browser != "firefox" {
+		return nil
+	}
+
+	var ignored []string
+	add := func(set bool, name string) {
+		if set {
+			ignored = append(ignored, name)
+		}
+	}
+	mobile := false
+	for _, viewport := range u.Viewports {
+		mobile = mobile || viewport.Mobile || viewport.Touch || viewport.Orientation == "landscape"
+	}
+	capturing := false
+	for _, action := range u.Actions {
+		capturing = capturing || action.CapturePrintable != nil || action.TabThrough != nil
+	}
+	add(mobile, "mobile emulation")
+	add(capturing, "capturePrintable and tabThrough actions")
+	add(len(u.Rewrites) > 0, "rewrites")
+	add(len(u.DNSOverrides) > 0, "dnsOverrides")
+	add(len(u.Extensions) > 0, "extensions")
+	add(u.LoginID != "", "loginId")
+	add(u.StorageState != "", "storageState")
+	add(u.Timezone != "", "timezone")
+	add(u.Geolocation != nil, "geolocation")
+	add(u.Throttling != nil, "throttling")
+	add(u.HAR, "har")
+	add(u.Trace, "trace")
+	add(u.Accessibility != nil && u.Accessibility.Enabled, "accessibility")
+	add(u.ScrollRecording != nil && u.ScrollRecording.Enabled, "scrollRecording")
+	add(u.Video != nil && u.Video.Enabled, "video")
+	return ignored
+}
+
+// parentDomain returns the last two labels of a hostname, e.g. example.com for shop.example.com
+func parentDomain(host string) string {
+	labels := strings.Split(host, ".")
+	if len(labels) <= 2 {
+		return host
+	}
+	return strings.Join(labels[len(labels)-2:], ".")
+}
+
+// examples lists the first names of a warning that applies to many URLs
+func examples(names []string) string {
+	if len(names) <= lintMaxExamples {
+		return strings.Join(names, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(names[:lintMaxExamples], ", "), len(names)-lintMaxExamples)
+}
+
+// sortedKeys returns the keys of a map in order, so warnings are stable between runs
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,166 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Secrets configures the secret manager that the passwordSecret of logins and proxies and
+// the secrets of uploads are resolved from
+type Secrets struct {
+	Provider  string `json:"provider"`            // "vault", "aws" or "gcp"
+	Address   string `json:"address,omitempty"`   // Vault server, defaults to VAULT_ADDR (vault)
+	Namespace string `json:"namespace,omitempty"` // Vault Enterprise namespace, defaults to VAULT_NAMESPACE (vault)
+	Region    string `json:"region,omitempty"`    // Region, defaults to AWS_REGION (aws)
+	Project   string `json:"project,omitempty"`   // Project, defaults to the credentials', then GOOGLE_CLOUD_PROJECT (gcp)
+	Endpoint  string `json:"endpoint,omitempty"`  // Custom endpoint, e.g. for an emulator or VPC endpoint (aws, gcp)
+}
+
+// ResolveProxyPassword sets the password of a proxy from its passwordSecret with the secret
+// manager of the configuration, for proxies passed on without their password such as those
+// of queued jobs
+func (c *Config) ResolveProxyPassword(proxy *Proxy) error {
+	if proxy == nil || proxy.PasswordSecret == "" {
+		return nil
+	}
+	secrets, err := newSecretResolver(c.Secrets)
+	if err != nil {
+		return fmt.Errorf("invalid secrets: %w", err)
+	}
+	password, err := secrets.resolve(proxy.PasswordSecret)
+	if err != nil {
+		return fmt.Errorf("proxy password: %w", err)
+	}
+	proxy.Password = password
+	return nil
+}
+
+// secretProvider fetches secrets from a secret manager
+type secretProvider interface {
+	// fetch returns the value of the named secret, or of one of its keys if key is set
+	fetch(name, key string) (string, error)
+}
+
+// secretResolver resolves secret references of the form name#key with the configured
+// provider, fetching each secret once per configuration load
+type secretResolver struct {
+	mu       sync.Mutex // URLs of API requests are validated concurrently
+	secrets  *Secrets
+	provider secretProvider // Created on first use, so commands not needing credentials don't need access
+	cache    map[string]string
+}
+
+// newSecretResolver creates the resolver of the configured provider, nil if secrets aren't configured
+func newSecretResolver(secrets *Secrets) (*secretResolver, error) {
+	if secrets == nil {
+		return nil, nil
+	}
+	switch secrets.Provider {
+	case "vault", "aws", "gcp":
+	case "":
+		return nil, fmt.Errorf("secrets are missing provider")
+	default:
+		return nil, fmt.Errorf("unsupported secrets provider: %s (supported: vault, aws, gcp)", secrets.Provider)
+	}
+	if secrets.Endpoint != "" {
+		parsed, err := url.Parse(secrets.Endpoint)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return nil, fmt.Errorf("endpoint must be of the form https://host[:port], got %s", secrets.Endpoint)
+		}
+	}
+	return &secretResolver{secrets: secrets, cache: make(map[string]string)}, nil
+}
+
+// connect creates the provider on first use
+func (r *secretResolver) connect() (secretProvider, error) {
+	if r.provider != nil {
+		return r.provider, nil
+	}
+	var err error
+	switch r.secrets.Provider {
+	case "vault":
+		r.provider, err = newVaultSecrets(r.secrets)
+	case "aws":
+		r.provider, err = newAWSSecrets(r.secrets)
+	case "gcp":
+		r.provider, err = newGCPSecrets(r.secrets)
+	}
+	if err != nil {
+		r.provider = nil
+		return nil, err
+	}
+	return r.provider, nil
+}
+
+// resolve returns the value a secret reference points to
+func (r *secretResolver) resolve(reference string) (string, error) {
+	if r == nil {
+		return "", fmt.Errorf("secret %s can't be resolved, secrets are not configured", reference)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if value, ok := r.cache[reference]; ok {
+		return value, nil
+	}
+
+	name, key, _ := strings.Cut(reference, "#")
+	if name == "" {
+		return "", fmt.Errorf("secret reference %q is missing the secret name", reference)
+	}
+	provider, err := r.connect()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve secret %s: %w", reference, err)
+	}
+	value, err := provider.fetch(name, key)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve secret %s: %w", reference, err)
+	}
+	if value == "" {
+		return "", fmt.Errorf("secret %s is empty", reference)
+	}
+	r.cache[reference] = value
+	return value, nil
+}
+
+// secretField returns a key of a secret holding a JSON object, as AWS and GCP secrets
+// often bundle the credentials of a service
+func secretField(value, key string) (string, error) {
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(value), &fields); err != nil {
+		return "", fmt.Errorf("secret is not a JSON object, it has no key %s", key)
+	}
+	return fieldString(fields, key)
+}
+
+// fieldString returns a key of a secret's fields as a string
+func fieldString(fields map[string]any, key string) (string, error) {
+	switch field := fields[key].(type) {
+	case nil:
+		return "", fmt.Errorf("secret has no key %s", key)
+	case string:
+		return field, nil
+	case float64, bool:
+		return fmt.Sprint(field), nil
+	default:
+		return "", fmt.Errorf("key %s of the secret is not a string", key)
+	}
+}
+
+// readSecretResponse returns the body of a secret manager response, or an error with its
+// status and message
+func readSecretResponse(resp *http.Response) ([]byte, error) {
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
@@ -0,0 +1,197 @@
+package config
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Sitemap describes a sitemap.xml whose pages are captured
+type Sitemap struct {
+	URL     string   `json:"url"`               // Sitemap or sitemap index URL
+	Include []string `json:"include,omitempty"` // Regular expressions, only matching page URLs are captured if set
+	Exclude []string `json:"exclude,omitempty"` // Regular expressions of page URLs to skip
+	Limit   int      `json:"limit,omitempty"`   // Maximum number of pages taken from the sitemap
+}
+
+// maxSitemapDepth limits how deeply sitemap indexes may nest
+const maxSitemapDepth = 3
+
+// sitemapDocument matches both <urlset> sitemaps and <sitemapindex> indexes
+type sitemapDocument struct {
+	XMLName  xml.Name
+	URLs     []sitemapLocation `xml:"url"`
+	Sitemaps []sitemapLocation `xml:"sitemap"`
+}
+
+type sitemapLocation struct {
+	Loc string `xml:"loc"`
+}
+
+// httpClient fetches sitemaps and crawled pages
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// LoadSitemap fetches a sitemap, following sitemap indexes, and returns the
+// page URLs that pass its filters in sitemap order, up to its limit
+func LoadSitemap(sitemap Sitemap) ([]string, error) {
+	include, err := compilePatterns(sitemap.Include)
+	if err != nil {
+		return nil, fmt.Errorf("invalid include pattern: %w", err)
+	}
+	exclude, err := compilePatterns(sitemap.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exclude pattern: %w", err)
+	}
+
+	var pages []string
+	seen := make(map[string]bool)
+	visited := make(map[string]bool)
+
+	var load func(sitemapURL string, depth int) error
+	load = func(sitemapURL string, depth int) error {
+		if visited[sitemapURL] {
+			return nil
+		}
+		visited[sitemapURL] = true
+
+		doc, err := fetchSitemap(sitemapURL)
+		if err != nil {
+			return err
+		}
+
+		// Follow the sitemaps listed by an index
+		if doc.XMLName.Local == "sitemapindex" {
+			if depth >= maxSitemapDepth {
+				log.Printf("Warning: Sitemap index %s is nested more than %d levels deep, skipping it", sitemapURL, maxSitemapDepth)
+				return nil
+			}
+			log.Printf("Sitemap index %s lists %d sitemaps", sitemapURL, len(doc.Sitemaps))
+			for _, child := range doc.Sitemaps {
+				if sitemap.Limit > 0 && len(pages) >= sitemap.Limit {
+					return nil
+				}
+				if err := load(strings.TrimSpace(child.Loc), depth+1); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		for _, entry := range doc.URLs {
+			if sitemap.Limit > 0 && len(pages) >= sitemap.Limit {
+				return nil
+			}
+
+			page := strings.TrimSpace(entry.Loc)
+			if page == "" || seen[page] {
+				continue
+			}
+			if len(include) > 0 && !matchesAny(include, page) {
+				continue
+			}
+			if matchesAny(exclude, page) {
+				continue
+			}
+
+			seen[page] = true
+			pages = append(pages, page)
+		}
+		return nil
+	}
+
+	if err := load(sitemap.URL, 0); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Loaded %d pages from sitemap %s", len(pages), sitemap.URL)
+	return pages, nil
+}
+
+// fetchSitemap downloads and parses a sitemap, which may be gzip compressed
+func fetchSitemap(sitemapURL string) (*sitemapDocument, error) {
+	log.Printf("Fetching sitemap %s", sitemapURL)
+
+	resp, err := httpClient.Get(sitemapURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch sitemap %s: %w", sitemapURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch sitemap %s: %s", sitemapURL, resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sitemap %s: %w", sitemapURL, err)
+	}
+
+	// sitemap.xml.gz files are served compressed without a Content-Encoding header
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress sitemap %s: %w", sitemapURL, err)
+		}
+		if data, err = io.ReadAll(reader); err != nil {
+			return nil, fmt.Errorf("failed to decompress sitemap %s: %w", sitemapURL, err)
+		}
+	}
+
+	var doc sitemapDocument
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse sitemap %s: %w", sitemapURL, err)
+	}
+	if doc.XMLName.Local != "urlset" && doc.XMLName.Local != "sitemapindex" {
+		return nil, fmt.Errorf("%s is not a sitemap: unexpected root element <%s>", sitemapURL, doc.XMLName.Local)
+	}
+
+	return &doc, nil
+}
+
+// PageNameFromURL derives a readable, unique name for a discovered page from its host and path
+func PageNameFromURL(pageURL string) string {
+	parsed, err := url.Parse(pageURL)
+	if err != nil || parsed.Host == "" {
+		return extractDomain(pageURL)
+	}
+
+	name := strings.TrimPrefix(parsed.Hostname(), "www.")
+	if path := strings.Trim(parsed.Path, "/"); path != "" {
+		name += "-" + strings.ReplaceAll(path, "/", "-")
+	}
+	if parsed.RawQuery != "" {
+		name += "-" + parsed.RawQuery
+	}
+	return name
+}
+
+// compilePatterns compiles a list of regular expressions
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// matchesAny reports whether s matches any of the patterns
+func matchesAny(patterns []*regexp.Regexp, s string) bool {
+	for _, re := range patterns {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
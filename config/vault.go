@@ -0,0 +1,95 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// vaultSecrets reads secrets from HashiCorp Vault with a token. Secrets are named by their
+// API path, e.g. secret/data/staging/login for version 2 of the KV engine.
+type vaultSecrets struct {
+	address   string
+	namespace string
+	token     string
+}
+
+// newVaultSecrets creates a Vault provider, reading the token from VAULT_TOKEN or the token
+// file the vault CLI writes on login
+func newVaultSecrets(secrets *Secrets) (*vaultSecrets, error) {
+	v := &vaultSecrets{
+		address:   strings.TrimSuffix(secrets.Address, "/"),
+		namespace: secrets.Namespace,
+		token:     os.Getenv("VAULT_TOKEN"),
+	}
+	if v.address == "" {
+		v.address = strings.TrimSuffix(os.Getenv("VAULT_ADDR"), "/")
+	}
+	if v.namespace == "" {
+		v.namespace = os.Getenv("VAULT_NAMESPACE")
+	}
+	if v.token == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			if data, err := os.ReadFile(filepath.Join(home, ".vault-token")); err == nil {
+				v.token = strings.TrimSpace(string(data))
+			}
+		}
+	}
+
+	if v.address == "" {
+		return nil, fmt.Errorf("vault secrets require an address, set address or VAULT_ADDR")
+	}
+	if v.token == "" {
+		return nil, fmt.Errorf("vault secrets require VAULT_TOKEN to be set or a token from vault login")
+	}
+	return v, nil
+}
+
+// fetch reads a secret's key. Vault secrets are sets of keys, so a secret with several keys
+// must be referenced with the key.
+func (v *vaultSecrets) fetch(name, key string) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, v.address+"/v1/"+strings.TrimPrefix(name, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+	if v.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.namespace)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	data, err := readSecretResponse(resp)
+	if err != nil {
+		return "", err
+	}
+
+	var secret struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.Unmarshal(data, &secret); err != nil {
+		return "", fmt.Errorf("invalid Vault response: %w", err)
+	}
+	// Version 2 of the KV engine nests the keys below data with the version's metadata
+	fields := secret.Data
+	if nested, ok := fields["data"].(map[string]any); ok {
+		if _, ok := fields["metadata"]; ok {
+			fields = nested
+		}
+	}
+
+	if key == "" {
+		if len(fields) != 1 {
+			return "", fmt.Errorf("secret has %d keys, reference one as %s#key", len(fields), name)
+		}
+		for only := range fields {
+			key = only
+		}
+	}
+	return fieldString(fields, key)
+}
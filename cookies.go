@@ -0,0 +1,409 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"screenshot-tool/screenshot"
+)
+
+// cookieTimeLayout is the format of the timestamps in the cookie CSV files
+const cookieTimeLayout = "2006-01-02 15:04:05"
+
+// cookieKey identifies a cookie in an inventory
+type cookieKey struct {
+	Name   string
+	Domain string
+	Path   string
+}
+
+// inventoryCookie is a cookie set while capturing a URL
+type inventoryCookie struct {
+	Name     string `json:"name"`
+	Domain   string `json:"domain"`
+	Path     string `json:"path"`
+	Lifetime string `json:"lifetime"` // Time from the capture to the expiry, "session" for session cookies
+	HTTPOnly bool   `json:"httpOnly"`
+	Secure   bool   `json:"secure"`
+	SameSite string `json:"sameSite,omitempty"`
+	Priority string `json:"priority,omitempty"`
+}
+
+// cookieChange is a cookie whose lifetime or flags differ between two runs
+type cookieChange struct {
+	Name    string          `json:"name"`
+	Domain  string          `json:"domain"`
+	Path    string          `json:"path"`
+	Changes []string        `json:"changes"`
+	Before  inventoryCookie `json:"before"`
+	After   inventoryCookie `json:"after"`
+}
+
+// urlCookieDiff is the difference between the cookie inventories of a URL in two runs
+type urlCookieDiff struct {
+	Name    string            `json:"name"`
+	Status  string            `json:"status"` // "compared", "added" or "removed" if the URL was only captured in one run
+	Added   []inventoryCookie `json:"added,omitempty"`
+	Removed []inventoryCookie `json:"removed,omitempty"`
+	Changed []cookieChange    `json:"changed,omitempty"`
+}
+
+// cookieReport is the result of comparing the cookie inventories of two runs
+type cookieReport struct {
+	RunA    string          `json:"runA"`
+	RunB    string          `json:"runB"`
+	Added   int             `json:"added"`
+	Removed int             `json:"removed"`
+	Changed int             `json:"changed"`
+	URLs    []urlCookieDiff `json:"urls"`
+}
+
+// runCompareCookies implements the compare-cookies command, which reports the cookies
+// added, removed or changed between two runs
+func runCompareCookies(args []string) {
+	flags := flag.NewFlagSet("compare-cookies", flag.ExitOnError)
+	jsonPath := flags.String("json", "", "Also write the report to a JSON file")
+	failOnNew := flags.Bool("fail-on-new", false, "Exit with status 1 if the second run sets cookies the first didn't")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s compare-cookies [flags] <runA> <runB>\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	runA, runB := flags.Arg(0), flags.Arg(1)
+
+	inventoryA, err := loadCookieInventory(runA)
+	if err != nil {
+		log.Fatalf("Failed to read cookies of %s: %v", runA, err)
+	}
+	inventoryB, err := loadCookieInventory(runB)
+	if err != nil {
+		log.Fatalf("Failed to read cookies of %s: %v", runB, err)
+	}
+
+	report := compareCookieInventories(inventoryA, inventoryB)
+	report.RunA, report.RunB = runA, runB
+	writeCookieReport(os.Stdout, report)
+
+	if *jsonPath != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			log.Fatalf("Failed to encode cookie report: %v", err)
+		}
+		if err := os.WriteFile(*jsonPath, data, 0644); err != nil {
+			log.Fatalf("Failed to write cookie report: %v", err)
+		}
+		log.Printf("Wrote cookie report to %s", *jsonPath)
+	}
+
+	if *failOnNew && report.Added > 0 {
+		os.Exit(1)
+	}
+}
+
+// loadCookieInventory reads the cookies recorded for each URL of a run. A run is a directory
+// of URL directories, such as a watch iteration, a scheduled run or the output directory.
+// If a URL was captured several times, its latest capture is used.
+func loadCookieInventory(runDir string) (map[string]map[cookieKey]inventoryCookie, error) {
+	manifests, err := filepath.Glob(filepath.Join(runDir, "*", "manifest.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(manifests) == 0 {
+		return nil, fmt.Errorf("no captured URLs found")
+	}
+
+	latest := make(map[string]time.Time)
+	inventory := make(map[string]map[cookieKey]inventoryCookie)
+	for _, manifestPath := range manifests {
+		data, err := os.ReadFile(manifestPath)
+		if err != nil {
+			return nil, err
+		}
+		var manifest screenshot.Manifest
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", manifestPath, err)
+		}
+		if started, ok := latest[manifest.Name]; ok && !manifest.StartedAt.After(started) {
+			continue
+		}
+
+		cookies, err := readURLCookies(filepath.Dir(manifestPath))
+		if err != nil {
+			return nil, err
+		}
+		latest[manifest.Name] = manifest.StartedAt
+		inventory[manifest.Name] = cookies
+	}
+	return inventory, nil
+}
+
+// readURLCookies reads the cookie CSV files of a URL directory. Cookies logged at several
+// stages or viewports are merged, keeping the attributes they were last logged with.
+func readURLCookies(urlDir string) (map[cookieKey]inventoryCookie, error) {
+	cookies := make(map[cookieKey]inventoryCookie)
+
+	err := filepath.WalkDir(urlDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), "-cookies.csv") {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for line := 0; scanner.Scan(); line++ {
+			if line == 0 {
+				continue // Header
+			}
+			cookie, ok := parseCookieLine(scanner.Text())
+			if !ok {
+				log.Printf("Warning: Skipping malformed line %d of %s", line+1, path)
+				continue
+			}
+			cookies[cookieKey{cookie.Name, cookie.Domain, cookie.Path}] = cookie
+		}
+		return scanner.Err()
+	})
+	return cookies, err
+}
+
+// parseCookieLine parses a line of a cookie CSV file, in which commas within fields are escaped with a backslash
+func parseCookieLine(line string) (inventoryCookie, bool) {
+	var fields []string
+	var field strings.Builder
+	for i := 0; i < len(line); i++ {
+		if line[i] == '\\' && i+1 < len(line) && line[i+1] == ',' {
+			field.WriteByte(',')
+			i++
+			continue
+		}
+		if line[i] == ',' {
+			fields = append(fields, field.String())
+			field.Reset()
+			continue
+		}
+		field.WriteByte(line[i])
+	}
+	fields = append(fields, field.String())
+
+	// Timestamp,URL,URL_Name,Stage,Screenshot_Type,Viewport,Cookie_Name,Cookie_Value,Domain,Path,
+	// Expires,Size,HttpOnly,Secure,Session,SameSite,Priority
+	if len(fields) != 17 {
+		return inventoryCookie{}, false
+	}
+
+	cookie := inventoryCookie{
+		Name:     fields[6],
+		Domain:   fields[8],
+		Path:     fields[9],
+		SameSite: fields[15],
+		Priority: fields[16],
+	}
+	cookie.HTTPOnly, _ = strconv.ParseBool(fields[12])
+	cookie.Secure, _ = strconv.ParseBool(fields[13])
+	session, _ := strconv.ParseBool(fields[14])
+
+	if session {
+		cookie.Lifetime = "session"
+		return cookie, true
+	}
+
+	loggedAt, err := time.ParseInLocation(cookieTimeLayout, strings.SplitN(fields[0], ".", 2)[0], time.Local)
+	if err != nil {
+		return inventoryCookie{}, false
+	}
+	expires, err := time.ParseInLocation(cookieTimeLayout, fields[10], time.Local)
+	if err != nil {
+		return inventoryCookie{}, false
+	}
+	cookie.Lifetime = formatLifetime(expires.Sub(loggedAt))
+	return cookie, true
+}
+
+// formatLifetime formats a cookie lifetime in days, or hours below a day, so that the
+// seconds between the capture and the cookie being set don't show up as a change
+func formatLifetime(d time.Duration) string {
+	switch {
+	case d <= 0:
+		return "expired"
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Round(time.Hour).Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(d.Round(24*time.Hour).Hours()/24))
+	}
+}
+
+// compareCookieInventories lists the cookies added, removed or changed for each URL from inventory a to b
+func compareCookieInventories(a, b map[string]map[cookieKey]inventoryCookie) *cookieReport {
+	report := &cookieReport{}
+
+	names := make([]string, 0, len(a)+len(b))
+	for name := range a {
+		names = append(names, name)
+	}
+	for name := range b {
+		if _, ok := a[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		before, inA := a[name]
+		after, inB := b[name]
+		diff := urlCookieDiff{Name: name, Status: "compared"}
+		switch {
+		case !inA:
+			diff.Status = "added"
+		case !inB:
+			diff.Status = "removed"
+		}
+
+		if inA && inB {
+			for key, cookie := range after {
+				old, ok := before[key]
+				if !ok {
+					diff.Added = append(diff.Added, cookie)
+					continue
+				}
+				if changes := cookieChanges(old, cookie); len(changes) > 0 {
+					diff.Changed = append(diff.Changed, cookieChange{
+						Name: key.Name, Domain: key.Domain, Path: key.Path,
+						Changes: changes, Before: old, After: cookie,
+					})
+				}
+			}
+			for key, cookie := range before {
+				if _, ok := after[key]; !ok {
+					diff.Removed = append(diff.Removed, cookie)
+				}
+			}
+		}
+
+		sortCookies(diff.Added)
+		sortCookies(diff.Removed)
+		sort.Slice(diff.Changed, func(i, j int) bool {
+			return cookieLess(diff.Changed[i].Domain, diff.Changed[i].Name, diff.Changed[j].Domain, diff.Changed[j].Name)
+		})
+
+		report.Added += len(diff.Added)
+		report.Removed += len(diff.Removed)
+		report.Changed += len(diff.Changed)
+		report.URLs = append(report.URLs, diff)
+	}
+
+	return report
+}
+
+// cookieChanges describes how the lifetime and flags of a cookie changed
+func cookieChanges(before, after inventoryCookie) []string {
+	var changes []string
+	if before.Lifetime != after.Lifetime {
+		changes = append(changes, fmt.Sprintf("lifetime %s → %s", before.Lifetime, after.Lifetime))
+	}
+	if before.HTTPOnly != after.HTTPOnly {
+		changes = append(changes, fmt.Sprintf("httpOnly %t → %t", before.HTTPOnly, after.HTTPOnly))
+	}
+	if before.Secure != after.Secure {
+		changes = append(changes, fmt.Sprintf("secure %t → %t", before.Secure, after.Secure))
+	}
+	if before.SameSite != after.SameSite {
+		changes = append(changes, fmt.Sprintf("sameSite %s → %s", orNone(before.SameSite), orNone(after.SameSite)))
+	}
+	if before.Priority != after.Priority {
+		changes = append(changes, fmt.Sprintf("priority %s → %s", orNone(before.Priority), orNone(after.Priority)))
+	}
+	return changes
+}
+
+// orNone returns s, or "none" if it's empty
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
+
+// sortCookies sorts cookies by domain and name
+func sortCookies(cookies []inventoryCookie) {
+	sort.Slice(cookies, func(i, j int) bool {
+		return cookieLess(cookies[i].Domain, cookies[i].Name, cookies[j].Domain, cookies[j].Name)
+	})
+}
+
+// cookieLess orders cookies by domain, then name
+func cookieLess(domainA, nameA, domainB, nameB string) bool {
+	if domainA != domainB {
+		return domainA < domainB
+	}
+	return nameA < nameB
+}
+
+// writeCookieReport writes a cookie comparison as text
+func writeCookieReport(w io.Writer, report *cookieReport) {
+	fmt.Fprintf(w, "Cookies of %s compared with %s\n", report.RunB, report.RunA)
+
+	for _, diff := range report.URLs {
+		switch diff.Status {
+		case "added":
+			fmt.Fprintf(w, "\n%s: only captured in %s\n", diff.Name, report.RunB)
+			continue
+		case "removed":
+			fmt.Fprintf(w, "\n%s: only captured in %s\n", diff.Name, report.RunA)
+			continue
+		}
+		if len(diff.Added)+len(diff.Removed)+len(diff.Changed) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(w, "\n%s:\n", diff.Name)
+		for _, cookie := range diff.Added {
+			fmt.Fprintf(w, "  + %s (%s%s) %s\n", cookie.Name, cookie.Domain, cookie.Path, describeCookie(cookie))
+		}
+		for _, cookie := range diff.Removed {
+			fmt.Fprintf(w, "  - %s (%s%s)\n", cookie.Name, cookie.Domain, cookie.Path)
+		}
+		for _, change := range diff.Changed {
+			fmt.Fprintf(w, "  ~ %s (%s%s): %s\n", change.Name, change.Domain, change.Path, strings.Join(change.Changes, ", "))
+		}
+	}
+
+	fmt.Fprintf(w, "\n%d new, %d removed, %d changed cookies\n", report.Added, report.Removed, report.Changed)
+}
+
+// describeCookie summarizes the lifetime and flags of a cookie
+func describeCookie(cookie inventoryCookie) string {
+	parts := []string{cookie.Lifetime}
+	if cookie.HTTPOnly {
+		parts = append(parts, "httpOnly")
+	}
+	if cookie.Secure {
+		parts = append(parts, "secure")
+	}
+	if cookie.SameSite != "" {
+		parts = append(parts, "sameSite="+cookie.SameSite)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,661 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"screenshot-tool/config"
+	"screenshot-tool/screenshot"
+)
+
+// dashboardMaxLog is the largest cookie log shown inline on a capture page
+const dashboardMaxLog = 256 << 10
+
+// dashboardRun is a run listed by the dashboard, from the catalog or a directory of URL directories
+type dashboardRun struct {
+	Key        string // Catalog ID, or the run directory if there is no catalog
+	Kind       string
+	Label      string
+	Status     string
+	Dir        string // Run directory, relative to the output directory
+	Log        string // Run log, relative to the output directory, if the run wrote one
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Captures   []dashboardCapture
+}
+
+// dashboardCapture is a captured URL of a run
+type dashboardCapture struct {
+	Name      string
+	URL       string
+	Status    string
+	Dir       string // URL directory, relative to the output directory
+	StartedAt time.Time
+	Viewports []string // Viewport names, e.g. 1280x800
+}
+
+// dashboardURL is a URL with its captures across all runs, newest first
+type dashboardURL struct {
+	Name      string
+	URL       string
+	Viewports []string
+	Captures  []dashboardCapture
+}
+
+// dashboardViewport is a viewport of a capture page with its images
+type dashboardViewport struct {
+	Manifest  *screenshot.ViewportManifest
+	Name      string
+	Full      string // Latest full page screenshot, relative to the output directory
+	ViewProof string
+	Heatmap   string
+	Triptych  string
+}
+
+// dashboard serves the read-only web UI over an output directory
+type dashboard struct {
+	root string
+}
+
+// runDashboard implements the dashboard command, which serves a read-only web UI over the
+// runs and captures of the output directory
+func runDashboard(args []string) {
+	flags := flag.NewFlagSet("dashboard", flag.ExitOnError)
+	configPath := flags.String("config", "config.json", "Path to configuration file, whose output directory is shown")
+	dir := flags.String("dir", "", "Output directory to show, overriding the one of the configuration")
+	addr := flags.String("addr", "127.0.0.1:8090", "Address to listen on")
+	flags.Parse(args)
+
+	if *dir == "" {
+		cfg, err := config.LoadConfig(*configPath)
+		if err != nil {
+			log.Fatalf("Failed to load configuration: %v", err)
+		}
+		*dir = cfg.OutputDir
+	}
+	if info, err := os.Stat(*dir); err != nil || !info.IsDir() {
+		log.Fatalf("Output directory %s doesn't exist", *dir)
+	}
+
+	d := &dashboard{root: *dir}
+
+	if _, err := os.Stat(filepath.Join(*dir, catalogFile)); err == nil {
+		log.Printf("Listing the runs of the catalog %s", filepath.Join(*dir, catalogFile))
+	}
+	log.Printf("Serving the dashboard of %s on http://%s", *dir, *addr)
+	if err := http.ListenAndServe(*addr, d.routes()); err != nil {
+		log.Fatalf("Server failed: %v", err)
+	}
+}
+
+// routes returns the pages of the dashboard. Every route is read-only.
+func (d *dashboard) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", d.handleRuns)
+	mux.HandleFunc("GET /run", d.handleRun)
+	mux.HandleFunc("GET /capture", d.handleCapture)
+	mux.HandleFunc("GET /urls", d.handleURLs)
+	mux.HandleFunc("GET /url", d.handleURL)
+	mux.HandleFunc("GET /files/{path...}", d.handleFile)
+	return mux
+}
+
+// loadRuns returns the runs of the output directory, newest first. Runs are read from the
+// catalog if there is one, otherwise every directory holding URL directories is a run.
+func (d *dashboard) loadRuns() ([]dashboardRun, error) {
+	var runs []dashboardRun
+	var err error
+	if _, statErr := os.Stat(filepath.Join(d.root, catalogFile)); statErr == nil {
+		runs, err = d.loadCatalogRuns()
+	} else {
+		runs, err = d.scanRuns()
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(runs, func(i, j int) bool { return runs[i].StartedAt.After(runs[j].StartedAt) })
+	return runs, nil
+}
+
+// loadCatalogRuns reads the runs and their captures from the catalog with the sqlite3 command
+func (d *dashboard) loadCatalogRuns() ([]dashboardRun, error) {
+	const query = `SELECT r.id AS run_id, r.kind, coalesce(r.label, '') AS run_label, coalesce(r.status, '') AS run_status,
+	r.dir AS run_dir, r.started_at AS run_started, coalesce(r.finished_at, '') AS run_finished,
+	coalesce(c.name, '') AS name, coalesce(c.url, '') AS url, coalesce(c.status, '') AS status, coalesce(c.dir, '') AS dir,
+	coalesce(c.started_at, '') AS started,
+	coalesce((SELECT group_concat(v.width || 'x' || v.height) FROM viewports v WHERE v.capture_id = c.id), '') AS viewports
+FROM runs r LEFT JOIN captures c ON c.run_id = r.id
+ORDER BY r.id, c.dir`
+
+	cmd := exec.Command("sqlite3", "-readonly", "-json", filepath.Join(d.root, catalogFile), query)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("sqlite3: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	// sqlite3 prints nothing rather than an empty array without rows
+	var rows []struct {
+		RunID       int64  `json:"run_id"`
+		Kind        string `json:"kind"`
+		RunLabel    string `json:"run_label"`
+		RunStatus   string `json:"run_status"`
+		RunDir      string `json:"run_dir"`
+		RunStarted  string `json:"run_started"`
+		RunFinished string `json:"run_finished"`
+		Name        string `json:"name"`
+		URL         string `json:"url"`
+		Status      string `json:"status"`
+		Dir         string `json:"dir"`
+		Started     string `json:"started"`
+		Viewports   string `json:"viewports"`
+	}
+	if stdout.Len() > 0 {
+		if err := json.Unmarshal(stdout.Bytes(), &rows); err != nil {
+			return nil, fmt.Errorf("invalid sqlite3 output: %w", err)
+		}
+	}
+
+	var runs []dashboardRun
+	for _, row := range rows {
+		key := strconv.FormatInt(row.RunID, 10)
+		if len(runs) == 0 || runs[len(runs)-1].Key != key {
+			started, _ := time.Parse(catalogTimeLayout, row.RunStarted)
+			finished, _ := time.Parse(catalogTimeLayout, row.RunFinished)
+			runs = append(runs, dashboardRun{
+				Key:        key,
+				Kind:       row.Kind,
+				Label:      row.RunLabel,
+				Status:     row.RunStatus,
+				Dir:        row.RunDir,
+				StartedAt:  started,
+				FinishedAt: finished,
+			})
+		}
+		if row.Dir == "" {
+			continue
+		}
+		capture := dashboardCapture{Name: row.Name, URL: row.URL, Status: row.Status, Dir: row.Dir}
+		capture.StartedAt, _ = time.Parse(catalogTimeLayout, row.Started)
+		if row.Viewports != "" {
+			capture.Viewports = strings.Split(row.Viewports, ",")
+		}
+		runs[len(runs)-1].Captures = append(runs[len(runs)-1].Captures, capture)
+	}
+	return runs, nil
+}
+
+// scanRuns finds the directories of the output directory that hold URL directories and
+// reads each as a run, like catalog index does
+func (d *dashboard) scanRuns() ([]dashboardRun, error) {
+	runDirs := make(map[string]bool)
+	err := filepath.WalkDir(d.root, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && p != d.root && strings.HasPrefix(entry.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if !entry.IsDir() && entry.Name() == "manifest.json" {
+			runDirs[filepath.Dir(filepath.Dir(p))] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var runs []dashboardRun
+	for runDir := range runDirs {
+		run, err := loadCatalogRun(runDir)
+		if err != nil {
+			log.Printf("Warning: Skipping run %s: %v", runDir, err)
+			continue
+		}
+		dir := catalogRelPath(d.root, runDir)
+		listed := dashboardRun{
+			Key:        dir,
+			Kind:       "directory",
+			Label:      run.Label,
+			Status:     run.Status,
+			Dir:        dir,
+			StartedAt:  run.StartedAt,
+			FinishedAt: run.FinishedAt,
+		}
+		for _, capture := range run.Captures {
+			listedCapture := dashboardCapture{
+				Name:      capture.Manifest.Name,
+				URL:       capture.Manifest.URL,
+				Status:    capture.Status,
+				Dir:       catalogRelPath(d.root, capture.Dir),
+				StartedAt: capture.Manifest.StartedAt,
+			}
+			for _, vm := range capture.Manifest.Viewports {
+				listedCapture.Viewports = append(listedCapture.Viewports, fmt.Sprintf("%dx%d", vm.Width, vm.Height))
+			}
+			listed.Captures = append(listed.Captures, listedCapture)
+		}
+		runs = append(runs, listed)
+	}
+	return runs, nil
+}
+
+// localPath resolves a path relative to the output directory, refusing paths outside of it
+// and hidden files such as the delivery journal
+func (d *dashboard) localPath(rel string) (string, bool) {
+	// Backslashes are separators on Windows, so they are checked for .. elements as well
+	for _, element := range strings.Split(strings.ReplaceAll(rel, "\\", "/"), "/") {
+		if element == "" || strings.HasPrefix(element, ".") {
+			return "", false
+		}
+	}
+	local := filepath.FromSlash(rel)
+	if !filepath.IsLocal(local) {
+		return "", false
+	}
+	return filepath.Join(d.root, local), true
+}
+
+func (d *dashboard) handleRuns(w http.ResponseWriter, r *http.Request) {
+	runs, err := d.loadRuns()
+	if err != nil {
+		http.Error(w, "failed to load runs: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	d.render(w, "runs", map[string]any{"Root": d.root, "Runs": runs})
+}
+
+func (d *dashboard) handleRun(w http.ResponseWriter, r *http.Request) {
+	runs, err := d.loadRuns()
+	if err != nil {
+		http.Error(w, "failed to load runs: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	key := r.URL.Query().Get("id")
+	for _, run := range runs {
+		if run.Key == key {
+			if logPath, ok := d.localPath(path.Join(run.Dir, "run.log")); ok {
+				if _, err := os.Stat(logPath); err == nil {
+					run.Log = path.Join(run.Dir, "run.log")
+				}
+			}
+			d.render(w, "run", run)
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+func (d *dashboard) handleCapture(w http.ResponseWriter, r *http.Request) {
+	rel := r.URL.Query().Get("dir")
+	urlDir, ok := d.localPath(rel)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	manifest, err := readManifest(urlDir)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	var viewports []dashboardViewport
+	for _, vm := range manifest.Viewports {
+		name := fmt.Sprintf("%dx%d", vm.Width, vm.Height)
+		viewport := dashboardViewport{
+			Manifest:  vm,
+			Name:      name,
+			Full:      latestFile(d.root, filepath.Join(urlDir, name, fmt.Sprintf("*-full-%s.*", name))),
+			ViewProof: latestFile(d.root, filepath.Join(urlDir, name, fmt.Sprintf("*-full-proof-%s.*", name))),
+		}
+		if vm.Diff != nil {
+			if vm.Diff.Heatmap != "" {
+				viewport.Heatmap = path.Join(rel, name, vm.Diff.Heatmap)
+			}
+			if vm.Diff.Triptych != "" {
+				viewport.Triptych = path.Join(rel, name, vm.Diff.Triptych)
+			}
+		}
+		viewports = append(viewports, viewport)
+	}
+
+	var cookies []inventoryCookie
+	if inventory, err := readURLCookies(urlDir); err == nil {
+		for _, cookie := range inventory {
+			cookies = append(cookies, cookie)
+		}
+		sortCookies(cookies)
+	}
+
+	// The cookie log of the URL directory, and every artifact for download
+	var cookieLog string
+	var files []string
+	filepath.WalkDir(urlDir, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return nil
+		}
+		files = append(files, catalogRelPath(d.root, p))
+		if strings.HasSuffix(entry.Name(), "-cookies.log") && filepath.Dir(p) == urlDir {
+			if info, err := entry.Info(); err == nil && info.Size() <= dashboardMaxLog {
+				data, _ := os.ReadFile(p)
+				cookieLog = string(data)
+			}
+		}
+		return nil
+	})
+
+	d.render(w, "capture", map[string]any{
+		"Dir":       rel,
+		"Manifest":  manifest,
+		"Viewports": viewports,
+		"Cookies":   cookies,
+		"CookieLog": cookieLog,
+		"Files":     files,
+	})
+}
+
+// latestFile returns the last file matching pattern relative to root, or "" if there is none.
+// Timestamped names sort by capture time.
+func latestFile(root, pattern string) string {
+	matches, _ := filepath.Glob(pattern)
+	if len(matches) == 0 {
+		return ""
+	}
+	sort.Strings(matches)
+	return catalogRelPath(root, matches[len(matches)-1])
+}
+
+// loadURLs groups the captures of all runs by URL, sorted by name
+func (d *dashboard) loadURLs() ([]*dashboardURL, error) {
+	runs, err := d.loadRuns()
+	if err != nil {
+		return nil, err
+	}
+	byURL := make(map[string]*dashboardURL)
+	var urls []*dashboardURL
+	for _, run := range runs {
+		for _, capture := range run.Captures {
+			u, ok := byURL[capture.URL]
+			if !ok {
+				u = &dashboardURL{Name: capture.Name, URL: capture.URL}
+				byURL[capture.URL] = u
+				urls = append(urls, u)
+			}
+			u.Captures = append(u.Captures, capture)
+			for _, viewport := range capture.Viewports {
+				if !containsString(u.Viewports, viewport) {
+					u.Viewports = append(u.Viewports, viewport)
+				}
+			}
+		}
+	}
+	for _, u := range urls {
+		sort.SliceStable(u.Captures, func(i, j int) bool { return u.Captures[i].StartedAt.After(u.Captures[j].StartedAt) })
+		sort.Slice(u.Viewports, func(i, j int) bool { return viewportLess(u.Viewports[i], u.Viewports[j]) })
+	}
+	sort.SliceStable(urls, func(i, j int) bool { return urls[i].Name < urls[j].Name })
+	return urls, nil
+}
+
+// containsString reports whether values contains s
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// viewportLess orders viewport names by width, then height
+func viewportLess(a, b string) bool {
+	aWidth, aHeight, _ := strings.Cut(a, "x")
+	bWidth, bHeight, _ := strings.Cut(b, "x")
+	aw, _ := strconv.Atoi(aWidth)
+	bw, _ := strconv.Atoi(bWidth)
+	if aw != bw {
+		return aw < bw
+	}
+	ah, _ := strconv.Atoi(aHeight)
+	bh, _ := strconv.Atoi(bHeight)
+	return ah < bh
+}
+
+func (d *dashboard) handleURLs(w http.ResponseWriter, r *http.Request) {
+	urls, err := d.loadURLs()
+	if err != nil {
+		http.Error(w, "failed to load runs: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	d.render(w, "urls", urls)
+}
+
+// handleURL shows the screenshots of a URL in one viewport across its captures
+func (d *dashboard) handleURL(w http.ResponseWriter, r *http.Request) {
+	urls, err := d.loadURLs()
+	if err != nil {
+		http.Error(w, "failed to load runs: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var u *dashboardURL
+	for _, candidate := range urls {
+		if candidate.URL == r.URL.Query().Get("url") {
+			u = candidate
+		}
+	}
+	if u == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	viewport := r.URL.Query().Get("viewport")
+	if viewport == "" && len(u.Viewports) > 0 {
+		viewport = u.Viewports[0]
+	}
+	type shot struct {
+		Capture    dashboardCapture
+		Screenshot string
+	}
+	var shots []shot
+	for _, capture := range u.Captures {
+		if !containsString(capture.Viewports, viewport) {
+			continue
+		}
+		s := shot{Capture: capture}
+		if urlDir, ok := d.localPath(capture.Dir); ok {
+			s.Screenshot = latestFile(d.root, filepath.Join(urlDir, viewport, fmt.Sprintf("*-full-%s.*", viewport)))
+		}
+		shots = append(shots, s)
+	}
+	d.render(w, "url", map[string]any{"URL": u, "Viewport": viewport, "Shots": shots})
+}
+
+// handleFile serves an artifact of the output directory. Directories aren't listed.
+func (d *dashboard) handleFile(w http.ResponseWriter, r *http.Request) {
+	local, ok := d.localPath(r.PathValue("path"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	info, err := os.Stat(local)
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeFile(w, r, local)
+}
+
+// render executes a page of the dashboard template
+func (d *dashboard) render(w http.ResponseWriter, page string, data any) {
+	var buf bytes.Buffer
+	if err := dashboardTemplate.ExecuteTemplate(&buf, page, data); err != nil {
+		log.Printf("ERROR: Failed to render dashboard page %s: %v", page, err)
+		http.Error(w, "failed to render page", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	buf.WriteTo(w)
+}
+
+// dashboardTemplate lays out the pages of the dashboard, which share the header of "top"
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"time": func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Local().Format("2006-01-02 15:04:05")
+	},
+	"duration": func(start, end time.Time) string {
+		if start.IsZero() || end.IsZero() {
+			return ""
+		}
+		return end.Sub(start).Round(time.Second).String()
+	},
+	"file": func(rel string) string {
+		elements := strings.Split(rel, "/")
+		for i, element := range elements {
+			elements[i] = url.PathEscape(element)
+		}
+		return "/files/" + strings.Join(elements, "/")
+	},
+	"percent": func(f float64) string { return fmt.Sprintf("%.2f%%", f*100) },
+	"join":    func(values []string) string { return strings.Join(values, ", ") },
+}).Parse(`{{define "top"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.}} - Screenshot Tool</title>
+<style>
+	body { font-family: Arial, sans-serif; font-size: 14px; color: #222; margin: 0 24px 24px; }
+	nav { padding: 12px 0; border-bottom: 1px solid #ccc; margin-bottom: 16px; }
+	nav a { margin-right: 16px; }
+	h1 { font-size: 20px; word-break: break-all; }
+	h2 { font-size: 16px; margin-top: 28px; }
+	table { border-collapse: collapse; margin-bottom: 12px; }
+	th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+	th { background: #f0f0f0; }
+	.passed, .match { color: #1b7f2a; }
+	.failed, .mismatch, .missing { color: #b00020; font-weight: bold; }
+	.quarantined { color: #a66300; }
+	.shots { display: flex; flex-wrap: wrap; gap: 16px; }
+	.shot { max-width: 420px; }
+	.shot img { display: block; max-width: 100%; max-height: 640px; border: 1px solid #ccc; }
+	pre { background: #f6f6f6; padding: 8px; overflow-x: auto; max-height: 480px; }
+</style>
+</head>
+<body>
+<nav><a href="/">Runs</a><a href="/urls">URLs</a></nav>
+{{end}}
+
+{{define "bottom"}}</body>
+</html>
+{{end}}
+
+{{define "runs"}}{{template "top" "Runs"}}
+<h1>Runs of {{.Root}}</h1>
+{{if .Runs}}<table>
+	<tr><th>Started</th><th>Kind</th><th>Label</th><th>Status</th><th>Directory</th><th>URLs</th><th>Duration</th></tr>
+	{{range .Runs}}<tr><td><a href="/run?id={{.Key}}">{{time .StartedAt}}</a></td><td>{{.Kind}}</td><td>{{.Label}}</td><td class="{{.Status}}">{{.Status}}</td><td>{{.Dir}}</td><td>{{len .Captures}}</td><td>{{duration .StartedAt .FinishedAt}}</td></tr>
+	{{end}}
+</table>{{else}}<p>No runs found.</p>{{end}}
+{{template "bottom"}}{{end}}
+
+{{define "run"}}{{template "top" "Run"}}
+<h1>Run of {{time .StartedAt}}</h1>
+<table>
+	<tr><th>Kind</th><td>{{.Kind}}</td></tr>
+	{{with .Label}}<tr><th>Label</th><td>{{.}}</td></tr>{{end}}
+	<tr><th>Status</th><td class="{{.Status}}">{{.Status}}</td></tr>
+	<tr><th>Directory</th><td>{{.Dir}}</td></tr>
+	<tr><th>Finished</th><td>{{time .FinishedAt}}</td></tr>
+	{{with .Log}}<tr><th>Log</th><td><a href="{{file .}}">run.log</a></td></tr>{{end}}
+</table>
+<table>
+	<tr><th>Name</th><th>URL</th><th>Status</th><th>Viewports</th><th>Started</th></tr>
+	{{range .Captures}}<tr><td><a href="/capture?dir={{.Dir}}">{{.Name}}</a></td><td><a href="/url?url={{.URL}}">{{.URL}}</a></td><td class="{{.Status}}">{{.Status}}</td><td>{{join .Viewports}}</td><td>{{time .StartedAt}}</td></tr>
+	{{end}}
+</table>
+{{template "bottom"}}{{end}}
+
+{{define "capture"}}{{template "top" .Manifest.Name}}{{$dir := .Dir}}{{$m := .Manifest}}
+<h1>{{$m.Name}}</h1>
+<table>
+	<tr><th>URL</th><td><a href="/url?url={{$m.URL}}">{{$m.URL}}</a></td></tr>
+	<tr><th>Directory</th><td>{{$dir}}</td></tr>
+	{{with $m.Label}}<tr><th>Label</th><td>{{.}}</td></tr>{{end}}
+	<tr><th>Started</th><td>{{time $m.StartedAt}}</td></tr>
+	<tr><th>Finished</th><td>{{time $m.FinishedAt}}</td></tr>
+	{{with $m.Browser}}<tr><th>Browser</th><td>{{.}}</td></tr>{{end}}
+	<tr><th>Downloaded</th><td>{{$m.BytesDownloaded}} bytes</td></tr>
+</table>
+
+{{range .Viewports}}
+<h2>Viewport {{.Name}}{{if .Manifest.Mobile}}, mobile{{end}}{{with .Manifest.Orientation}}, {{.}}{{end}}</h2>
+{{with .Manifest.Failure}}<p class="failed">Capture failed at {{.Stage}}{{range .Errors}}: {{.}}{{end}}</p>{{end}}
+{{with .Manifest.Diff}}<table>
+	<tr><th>Baseline</th><td class="{{.Status}}">{{.Status}}</td></tr>
+	<tr><th>Similarity</th><td>{{percent .Similarity}}</td></tr>
+	<tr><th>SSIM</th><td>{{.SSIM}}</td></tr>
+	{{if .Retried}}<tr><th>Retried</th><td>first attempt {{percent .FirstSimilarity}} similar</td></tr>{{end}}
+</table>{{end}}
+<div class="shots">
+{{with .Full}}<div class="shot"><p>Full page</p><a href="{{file .}}"><img src="{{file .}}" loading="lazy"></a></div>{{end}}
+{{with .ViewProof}}<div class="shot"><p>ViewProof</p><a href="{{file .}}"><img src="{{file .}}" loading="lazy"></a></div>{{end}}
+{{with .Heatmap}}<div class="shot"><p>Changed pixels</p><a href="{{file .}}"><img src="{{file .}}" loading="lazy"></a></div>{{end}}
+</div>
+{{with .Triptych}}<div class="shot" style="max-width: 100%"><p>Baseline, capture and changes</p><a href="{{file .}}"><img src="{{file .}}" loading="lazy"></a></div>{{end}}
+{{end}}
+
+<h2>Cookies</h2>
+{{if .Cookies}}<table>
+	<tr><th>Name</th><th>Domain</th><th>Path</th><th>Lifetime</th><th>HttpOnly</th><th>Secure</th><th>SameSite</th></tr>
+	{{range .Cookies}}<tr><td>{{.Name}}</td><td>{{.Domain}}</td><td>{{.Path}}</td><td>{{.Lifetime}}</td><td>{{.HTTPOnly}}</td><td>{{.Secure}}</td><td>{{.SameSite}}</td></tr>
+	{{end}}
+</table>{{else}}<p>No cookies were recorded.</p>{{end}}
+{{with .CookieLog}}<h2>Cookie log</h2>
+<pre>{{.}}</pre>{{end}}
+
+<h2>Files</h2>
+<ul>
+	{{range .Files}}<li><a href="{{file .}}">{{.}}</a></li>
+	{{end}}
+</ul>
+{{template "bottom"}}{{end}}
+
+{{define "urls"}}{{template "top" "URLs"}}
+<h1>URLs</h1>
+{{if .}}<table>
+	<tr><th>Name</th><th>URL</th><th>Captures</th><th>Last captured</th><th>Viewports</th></tr>
+	{{range .}}<tr><td>{{.Name}}</td><td><a href="/url?url={{.URL}}">{{.URL}}</a></td><td>{{len .Captures}}</td><td>{{time (index .Captures 0).StartedAt}}</td><td>{{$u := .URL}}{{range .Viewports}}<a href="/url?url={{$u}}&amp;viewport={{.}}">{{.}}</a> {{end}}</td></tr>
+	{{end}}
+</table>{{else}}<p>No captures found.</p>{{end}}
+{{template "bottom"}}{{end}}
+
+{{define "url"}}{{template "top" .URL.Name}}{{$u := .URL.URL}}{{$viewport := .Viewport}}
+<h1>{{.URL.Name}}</h1>
+<p>{{$u}}</p>
+<p>Viewport: {{range .URL.Viewports}}{{if eq . $viewport}}<strong>{{.}}</strong>{{else}}<a href="/url?url={{$u}}&amp;viewport={{.}}">{{.}}</a>{{end}} {{end}}</p>
+{{if .Shots}}<div class="shots">
+{{range .Shots}}<div class="shot">
+	<p><a href="/capture?dir={{.Capture.Dir}}">{{time .Capture.StartedAt}}</a> <span class="{{.Capture.Status}}">{{.Capture.Status}}</span></p>
+	{{with .Screenshot}}<a href="{{file .}}"><img src="{{file .}}" loading="lazy"></a>{{else}}<p>No screenshot</p>{{end}}
+</div>
+{{end}}</div>{{else}}<p>No captures of this viewport.</p>{{end}}
+{{template "bottom"}}{{end}}
+`))
@@ -0,0 +1,192 @@
+package delivery
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"screenshot-tool/config"
+)
+
+// azureAPIVersion is the Blob service version requests are made with
+const azureAPIVersion = "2021-08-06"
+
+// azureUploader uploads files to an Azure Blob Storage container, authorized
+// with the account's shared key or a shared access signature
+type azureUploader struct {
+	account   string
+	container string
+	prefix    string
+	endpoint  string // Blob service endpoint, e.g. https://account.blob.core.windows.net
+	key       []byte // Decoded account key, nil when a SAS token is used
+	sasToken  string
+	client    *http.Client
+}
+
+// newAzureUploader creates an Azure Blob uploader. Credentials are read from
+// AZURE_STORAGE_CONNECTION_STRING, or AZURE_STORAGE_ACCOUNT together with
+// AZURE_STORAGE_KEY or AZURE_STORAGE_SAS_TOKEN, or the upload's secrets of the same names.
+func newAzureUploader(upload config.Upload) (*azureUploader, error) {
+	u := &azureUploader{
+		account:   upload.Account,
+		container: upload.Container,
+		prefix:    strings.Trim(upload.Prefix, "/"),
+		endpoint:  strings.TrimSuffix(upload.Endpoint, "/"),
+		client:    &http.Client{Timeout: 5 * time.Minute},
+	}
+
+	accountKey := upload.Credential("AZURE_STORAGE_KEY")
+	u.sasToken = upload.Credential("AZURE_STORAGE_SAS_TOKEN")
+	if connectionString := upload.Credential("AZURE_STORAGE_CONNECTION_STRING"); connectionString != "" {
+		for _, part := range strings.Split(connectionString, ";") {
+			name, value, _ := strings.Cut(part, "=")
+			switch name {
+			case "AccountName":
+				if u.account == "" {
+					u.account = value
+				}
+			case "AccountKey":
+				accountKey = value
+			case "SharedAccessSignature":
+				u.sasToken = value
+			case "BlobEndpoint":
+				if u.endpoint == "" {
+					u.endpoint = strings.TrimSuffix(value, "/")
+				}
+			}
+		}
+	}
+	if u.account == "" {
+		u.account = os.Getenv("AZURE_STORAGE_ACCOUNT")
+	}
+	u.sasToken = strings.TrimPrefix(u.sasToken, "?")
+
+	if u.account == "" {
+		return nil, fmt.Errorf("Azure upload requires an account, set account or AZURE_STORAGE_ACCOUNT")
+	}
+	if u.endpoint == "" {
+		u.endpoint = "https://" + u.account + ".blob.core.windows.net"
+	}
+
+	if accountKey != "" {
+		key, err := base64.StdEncoding.DecodeString(accountKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Azure storage account key: %w", err)
+		}
+		u.key = key
+	} else if u.sasToken == "" {
+		return nil, fmt.Errorf("Azure upload requires AZURE_STORAGE_KEY, AZURE_STORAGE_SAS_TOKEN or AZURE_STORAGE_CONNECTION_STRING to be set")
+	}
+
+	return u, nil
+}
+
+// Target describes the container and prefix uploads go to
+func (u *azureUploader) Target() string {
+	target := "azure://" + u.account + "/" + u.container
+	if u.prefix != "" {
+		target += "/" + u.prefix
+	}
+	return target
+}
+
+// Upload streams a file to the container as a block blob
+func (u *azureUploader) Upload(ctx context.Context, key, filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	if u.prefix != "" {
+		key = u.prefix + "/" + key
+	}
+
+	blobURL := u.endpoint + "/" + url.PathEscape(u.container) + "/" + s3EscapePath(key)
+	if u.key == nil {
+		blobURL += "?" + u.sasToken
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, blobURL, file)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = info.Size()
+	req.Header.Set("X-Ms-Blob-Type", "BlockBlob")
+	req.Header.Set("X-Ms-Date", time.Now().UTC().Format(http.TimeFormat))
+	req.Header.Set("X-Ms-Version", azureAPIVersion)
+	if contentType := mime.TypeByExtension(filepath.Ext(filePath)); contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if u.key != nil {
+		u.sign(req)
+	}
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("failed to upload %s: %s: %s", key, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// sign adds a Shared Key authorization to a request
+func (u *azureUploader) sign(req *http.Request) {
+	contentLength := ""
+	if req.ContentLength > 0 {
+		contentLength = strconv.FormatInt(req.ContentLength, 10)
+	}
+
+	var msHeaders []string
+	for name := range req.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-ms-") {
+			msHeaders = append(msHeaders, lower)
+		}
+	}
+	sort.Strings(msHeaders)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range msHeaders {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(req.Header.Get(name)) + "\n")
+	}
+
+	// Empty lines stand for the standard headers these requests don't send
+	stringToSign := strings.Join([]string{
+		req.Method,
+		"", // Content-Encoding
+		"", // Content-Language
+		contentLength,
+		"", // Content-MD5
+		req.Header.Get("Content-Type"),
+		"", // Date, superseded by x-ms-date
+		"", // If-Modified-Since
+		"", // If-Match
+		"", // If-None-Match
+		"", // If-Unmodified-Since
+		"", // Range
+		canonicalHeaders.String() + "/" + u.account + req.URL.EscapedPath(),
+	}, "\n")
+
+	signature := base64.StdEncoding.EncodeToString(hmacSHA256(u.key, stringToSign))
+	req.Header.Set("Authorization", "SharedKey "+u.account+":"+signature)
+}
@@ -0,0 +1,264 @@
+package delivery
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"screenshot-tool/config"
+)
+
+// gcsScope is the OAuth scope needed to write objects
+const gcsScope = "https://www.googleapis.com/auth/devstorage.read_write"
+
+// gcsUploader uploads files to a Google Cloud Storage bucket
+type gcsUploader struct {
+	bucket   string
+	prefix   string
+	endpoint string // Custom endpoint, e.g. for a storage emulator
+	client   *http.Client
+
+	// Credentials: a fixed access token, or a service account whose tokens are fetched on demand
+	accessToken string
+	account     *gcsServiceAccount
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+// gcsServiceAccount is the part of a service account key file needed to obtain tokens
+type gcsServiceAccount struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+
+	key *rsa.PrivateKey
+}
+
+// newGCSUploader creates a GCS uploader. Credentials are read from the service account
+// key file named by GOOGLE_APPLICATION_CREDENTIALS, or GOOGLE_OAUTH_ACCESS_TOKEN. A
+// GOOGLE_APPLICATION_CREDENTIALS secret of the upload holds the key itself.
+func newGCSUploader(upload config.Upload) (*gcsUploader, error) {
+	u := &gcsUploader{
+		bucket:   upload.Bucket,
+		prefix:   strings.Trim(upload.Prefix, "/"),
+		endpoint: strings.TrimSuffix(upload.Endpoint, "/"),
+		client:   &http.Client{Timeout: 5 * time.Minute},
+	}
+	if u.endpoint == "" {
+		u.endpoint = "https://storage.googleapis.com"
+	}
+
+	if key, ok := upload.Credentials["GOOGLE_APPLICATION_CREDENTIALS"]; ok {
+		account, err := parseGCSServiceAccount([]byte(key), "secret")
+		if err != nil {
+			return nil, err
+		}
+		u.account = account
+		return u, nil
+	}
+	if path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); path != "" {
+		account, err := loadGCSServiceAccount(path)
+		if err != nil {
+			return nil, err
+		}
+		u.account = account
+		return u, nil
+	}
+
+	if u.accessToken = upload.Credential("GOOGLE_OAUTH_ACCESS_TOKEN"); u.accessToken != "" {
+		return u, nil
+	}
+
+	return nil, fmt.Errorf("GCS upload requires GOOGLE_APPLICATION_CREDENTIALS or GOOGLE_OAUTH_ACCESS_TOKEN to be set")
+}
+
+// loadGCSServiceAccount reads a service account key file
+func loadGCSServiceAccount(path string) (*gcsServiceAccount, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GCS credentials: %w", err)
+	}
+	return parseGCSServiceAccount(data, path)
+}
+
+// parseGCSServiceAccount parses a service account key read from source
+func parseGCSServiceAccount(data []byte, source string) (*gcsServiceAccount, error) {
+	var account gcsServiceAccount
+	if err := json.Unmarshal(data, &account); err != nil {
+		return nil, fmt.Errorf("failed to parse GCS credentials %s: %w", source, err)
+	}
+	if account.ClientEmail == "" || account.PrivateKey == "" {
+		return nil, fmt.Errorf("GCS credentials %s are not a service account key", source)
+	}
+	if account.TokenURI == "" {
+		account.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+
+	block, _ := pem.Decode([]byte(account.PrivateKey))
+	if block == nil {
+		return nil, fmt.Errorf("GCS credentials %s contain no private key", source)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse GCS private key: %w", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("GCS private key is not an RSA key")
+	}
+	account.key = rsaKey
+
+	return &account, nil
+}
+
+// Target describes the bucket and prefix uploads go to
+func (u *gcsUploader) Target() string {
+	if u.prefix == "" {
+		return "gs://" + u.bucket
+	}
+	return "gs://" + u.bucket + "/" + u.prefix
+}
+
+// Upload streams a file to the bucket with a simple media upload
+func (u *gcsUploader) Upload(ctx context.Context, key, filePath string) error {
+	token, err := u.bearerToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	if u.prefix != "" {
+		key = u.prefix + "/" + key
+	}
+
+	endpoint := fmt.Sprintf("%s/upload/storage/v1/b/%s/o?uploadType=media&name=%s",
+		u.endpoint, url.PathEscape(u.bucket), url.QueryEscape(key))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, file)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = info.Size()
+	req.Header.Set("Authorization", "Bearer "+token)
+	contentType := mime.TypeByExtension(filepath.Ext(filePath))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("failed to upload %s: %s: %s", key, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// bearerToken returns the access token, exchanging a signed JWT for a new one when needed
+func (u *gcsUploader) bearerToken(ctx context.Context) (string, error) {
+	if u.account == nil {
+		return u.accessToken, nil
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.token != "" && time.Now().Before(u.tokenExpiry) {
+		return u.token, nil
+	}
+
+	assertion, err := u.account.signedJWT(time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.account.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to obtain GCS access token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return "", fmt.Errorf("failed to obtain GCS access token: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to parse GCS access token: %w", err)
+	}
+
+	// Renew a minute early so a token doesn't expire during an upload
+	u.token = token.AccessToken
+	u.tokenExpiry = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - time.Minute)
+	return u.token, nil
+}
+
+// signedJWT returns the assertion exchanged for an access token
+func (a *gcsServiceAccount) signedJWT(now time.Time) (string, error) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]any{
+		"iss":   a.ClientEmail,
+		"scope": gcsScope,
+		"aud":   a.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+	hash := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign GCS token request: %w", err)
+	}
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
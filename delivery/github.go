@@ -0,0 +1,228 @@
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"screenshot-tool/config"
+)
+
+// githubTracker files issues in a GitHub repository
+type githubTracker struct {
+	repository string
+	labels     []string
+	api        *issueClient
+}
+
+// newGitHubTracker creates a GitHub issue tracker, authenticated with GITHUB_TOKEN
+func newGitHubTracker(issues config.Issues) (*githubTracker, error) {
+	token := os.Getenv("GITHUB_TOKEN")
+	if token == "" {
+		return nil, fmt.Errorf("GitHub issues require GITHUB_TOKEN to be set")
+	}
+
+	baseURL := issues.APIURL
+	if baseURL == "" {
+		baseURL = "https://api.github.com"
+	}
+
+	return &githubTracker{
+		repository: issues.Repository,
+		labels:     issues.Labels,
+		api: newIssueClient(baseURL, map[string]string{
+			"Authorization":        "Bearer " + token,
+			"Accept":               "application/vnd.github+json",
+			"X-GitHub-Api-Version": "2022-11-28",
+		}),
+	}, nil
+}
+
+// Target describes the repository
+func (t *githubTracker) Target() string {
+	return "github:" + t.repository
+}
+
+// Create opens an issue
+func (t *githubTracker) Create(ctx context.Context, title, body string) (Issue, error) {
+	request := map[string]any{"title": title, "body": body}
+	if len(t.labels) > 0 {
+		request["labels"] = t.labels
+	}
+
+	var created struct {
+		Number  int    `json:"number"`
+		HTMLURL string `json:"html_url"`
+	}
+	if err := t.api.do(ctx, http.MethodPost, "/repos/"+t.repository+"/issues", request, &created); err != nil {
+		return Issue{}, err
+	}
+	return Issue{Number: created.Number, URL: created.HTMLURL}, nil
+}
+
+// Comment adds a comment to an issue
+func (t *githubTracker) Comment(ctx context.Context, number int, body string) error {
+	path := fmt.Sprintf("/repos/%s/issues/%d/comments", t.repository, number)
+	return t.api.do(ctx, http.MethodPost, path, map[string]string{"body": body}, nil)
+}
+
+// IsOpen reports whether an issue is still open
+func (t *githubTracker) IsOpen(ctx context.Context, number int) (bool, error) {
+	var issue struct {
+		State string `json:"state"`
+	}
+	if err := t.api.do(ctx, http.MethodGet, fmt.Sprintf("/repos/%s/issues/%d", t.repository, number), nil, &issue); err != nil {
+		return false, err
+	}
+	return issue.State == "open", nil
+}
+
+// Attach is not supported, the GitHub API has no uploads for issue attachments
+func (t *githubTracker) Attach(ctx context.Context, path string) (string, error) {
+	return "", nil
+}
+
+// githubReviewer reports GitHub Actions runs on their commit and pull request
+type githubReviewer struct {
+	repository string
+	commit     string // Commit the status is set on, the head of the pull request
+	number     int    // Pull request number, 0 outside pull requests
+	context    string // Name of the commit status
+	reportURL  string
+	api        *issueClient
+}
+
+// newGitHubReviewer creates a GitHub reviewer, authenticated with GITHUB_TOKEN. The repository,
+// commit and pull request default to those of the GitHub Actions run.
+func newGitHubReviewer(review config.Review) (*githubReviewer, error) {
+	token := os.Getenv("GITHUB_TOKEN")
+	if token == "" {
+		return nil, fmt.Errorf("GitHub reviews require GITHUB_TOKEN to be set")
+	}
+
+	repository := review.Repository
+	if repository == "" {
+		repository = os.Getenv("GITHUB_REPOSITORY")
+	}
+	if repository == "" {
+		return nil, fmt.Errorf("no repository: set review repository or GITHUB_REPOSITORY")
+	}
+
+	// A pull request run checks out a merge commit, its status belongs on the head of the pull request
+	commit := os.Getenv("GITHUB_SHA")
+	number := 0
+	if eventPath := os.Getenv("GITHUB_EVENT_PATH"); eventPath != "" {
+		var event struct {
+			PullRequest *struct {
+				Number int `json:"number"`
+				Head   struct {
+					SHA string `json:"sha"`
+				} `json:"head"`
+			} `json:"pull_request"`
+		}
+		data, err := os.ReadFile(eventPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read GitHub event: %w", err)
+		}
+		if err := json.Unmarshal(data, &event); err != nil {
+			return nil, fmt.Errorf("failed to parse GitHub event %s: %w", eventPath, err)
+		}
+		if event.PullRequest != nil {
+			number = event.PullRequest.Number
+			commit = event.PullRequest.Head.SHA
+		}
+	}
+	if commit == "" {
+		return nil, fmt.Errorf("no commit to report on: set GITHUB_SHA")
+	}
+
+	baseURL := review.APIURL
+	if baseURL == "" {
+		baseURL = os.Getenv("GITHUB_API_URL")
+	}
+	if baseURL == "" {
+		baseURL = "https://api.github.com"
+	}
+
+	reportURL := review.ReportURL
+	if server, runID := os.Getenv("GITHUB_SERVER_URL"), os.Getenv("GITHUB_RUN_ID"); reportURL == "" && server != "" && runID != "" {
+		reportURL = fmt.Sprintf("%s/%s/actions/runs/%s", strings.TrimSuffix(server, "/"), repository, runID)
+	}
+
+	return &githubReviewer{
+		repository: repository,
+		commit:     commit,
+		number:     number,
+		context:    review.Context,
+		reportURL:  reportURL,
+		api: newIssueClient(baseURL, map[string]string{
+			"Authorization":        "Bearer " + token,
+			"Accept":               "application/vnd.github+json",
+			"X-GitHub-Api-Version": "2022-11-28",
+		}),
+	}, nil
+}
+
+// Target describes the commit or pull request
+func (r *githubReviewer) Target() string {
+	if r.number > 0 {
+		return fmt.Sprintf("github:%s#%d", r.repository, r.number)
+	}
+	return fmt.Sprintf("github:%s@%.7s", r.repository, r.commit)
+}
+
+// ReportURL returns the page the status links to
+func (r *githubReviewer) ReportURL() string {
+	return r.reportURL
+}
+
+// ArtifactURL is not supported, GitHub only links whole artifact archives
+func (r *githubReviewer) ArtifactURL(path string) string {
+	return ""
+}
+
+// SetStatus sets the commit status
+func (r *githubReviewer) SetStatus(ctx context.Context, state, description string) error {
+	// GitHub rejects descriptions over 140 characters
+	if len(description) > 140 {
+		description = description[:137] + "..."
+	}
+	request := map[string]string{"state": state, "description": description, "context": r.context}
+	if r.reportURL != "" {
+		request["target_url"] = r.reportURL
+	}
+	return r.api.do(ctx, http.MethodPost, fmt.Sprintf("/repos/%s/statuses/%s", r.repository, r.commit), request, nil)
+}
+
+// Comment replaces the comment of previous runs on the pull request, or adds one if create is set
+func (r *githubReviewer) Comment(ctx context.Context, body string, create bool) error {
+	if r.number == 0 {
+		return nil
+	}
+	marker := reviewMarker(r.context)
+	body = marker + "\n" + body
+
+	var comments []struct {
+		ID   int64  `json:"id"`
+		Body string `json:"body"`
+	}
+	path := fmt.Sprintf("/repos/%s/issues/%d/comments?per_page=100", r.repository, r.number)
+	if err := r.api.do(ctx, http.MethodGet, path, nil, &comments); err != nil {
+		return err
+	}
+	for i := len(comments) - 1; i >= 0; i-- {
+		if strings.HasPrefix(comments[i].Body, marker) {
+			path := fmt.Sprintf("/repos/%s/issues/comments/%d", r.repository, comments[i].ID)
+			return r.api.do(ctx, http.MethodPatch, path, map[string]string{"body": body}, nil)
+		}
+	}
+
+	if !create {
+		return nil
+	}
+	path = fmt.Sprintf("/repos/%s/issues/%d/comments", r.repository, r.number)
+	return r.api.do(ctx, http.MethodPost, path, map[string]string{"body": body}, nil)
+}
@@ -0,0 +1,263 @@
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"screenshot-tool/config"
+)
+
+// gitlabTracker files issues in a GitLab project
+type gitlabTracker struct {
+	project string // Project path or ID
+	labels  []string
+	api     *issueClient
+}
+
+// newGitLabTracker creates a GitLab issue tracker, authenticated with GITLAB_TOKEN
+func newGitLabTracker(issues config.Issues) (*gitlabTracker, error) {
+	token := os.Getenv("GITLAB_TOKEN")
+	if token == "" {
+		return nil, fmt.Errorf("GitLab issues require GITLAB_TOKEN to be set")
+	}
+
+	baseURL := strings.TrimSuffix(issues.APIURL, "/")
+	if baseURL == "" {
+		baseURL = "https://gitlab.com"
+	}
+
+	return &gitlabTracker{
+		project: issues.Repository,
+		labels:  issues.Labels,
+		api:     newIssueClient(baseURL+"/api/v4", map[string]string{"PRIVATE-TOKEN": token}),
+	}, nil
+}
+
+// Target describes the project
+func (t *gitlabTracker) Target() string {
+	return "gitlab:" + t.project
+}
+
+// projectPath returns the API path of the project
+func (t *gitlabTracker) projectPath() string {
+	return "/projects/" + url.PathEscape(t.project)
+}
+
+// Create opens an issue
+func (t *gitlabTracker) Create(ctx context.Context, title, body string) (Issue, error) {
+	request := map[string]any{"title": title, "description": body}
+	if len(t.labels) > 0 {
+		request["labels"] = strings.Join(t.labels, ",")
+	}
+
+	var created struct {
+		IID    int    `json:"iid"`
+		WebURL string `json:"web_url"`
+	}
+	if err := t.api.do(ctx, http.MethodPost, t.projectPath()+"/issues", request, &created); err != nil {
+		return Issue{}, err
+	}
+	return Issue{Number: created.IID, URL: created.WebURL}, nil
+}
+
+// Comment adds a note to an issue
+func (t *gitlabTracker) Comment(ctx context.Context, number int, body string) error {
+	path := fmt.Sprintf("%s/issues/%d/notes", t.projectPath(), number)
+	return t.api.do(ctx, http.MethodPost, path, map[string]string{"body": body}, nil)
+}
+
+// IsOpen reports whether an issue is still open
+func (t *gitlabTracker) IsOpen(ctx context.Context, number int) (bool, error) {
+	var issue struct {
+		State string `json:"state"`
+	}
+	if err := t.api.do(ctx, http.MethodGet, fmt.Sprintf("%s/issues/%d", t.projectPath(), number), nil, &issue); err != nil {
+		return false, err
+	}
+	return issue.State == "opened", nil
+}
+
+// Attach uploads a file to the project and returns the Markdown that embeds it
+func (t *gitlabTracker) Attach(ctx context.Context, path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", filepath.Base(path))
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(part, file); err != nil {
+		return "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+
+	var uploaded struct {
+		Markdown string `json:"markdown"`
+	}
+	if err := t.api.send(ctx, http.MethodPost, t.projectPath()+"/uploads", &body, writer.FormDataContentType(), &uploaded); err != nil {
+		return "", err
+	}
+	return uploaded.Markdown, nil
+}
+
+// gitlabReviewer reports GitLab CI jobs on their commit and merge request
+type gitlabReviewer struct {
+	project    string // Project path or ID
+	commit     string // Commit the status is set on
+	mergeIID   int    // Merge request IID, 0 outside merge request pipelines
+	context    string // Name of the commit status
+	reportURL  string
+	jobURL     string // Page of the CI job, whose artifacts are linked
+	projectDir string // Directory the job's artifact paths are relative to
+	api        *issueClient
+}
+
+// newGitLabReviewer creates a GitLab reviewer, authenticated with GITLAB_TOKEN. The project,
+// commit and merge request default to those of the GitLab CI job.
+func newGitLabReviewer(review config.Review) (*gitlabReviewer, error) {
+	token := os.Getenv("GITLAB_TOKEN")
+	if token == "" {
+		return nil, fmt.Errorf("GitLab reviews require GITLAB_TOKEN to be set")
+	}
+
+	project := review.Repository
+	if project == "" {
+		project = os.Getenv("CI_PROJECT_ID")
+	}
+	if project == "" {
+		return nil, fmt.Errorf("no project: set review repository or CI_PROJECT_ID")
+	}
+
+	// Merged results pipelines check out a merge commit, the status belongs on the source branch
+	commit := os.Getenv("CI_MERGE_REQUEST_SOURCE_BRANCH_SHA")
+	if commit == "" {
+		commit = os.Getenv("CI_COMMIT_SHA")
+	}
+	if commit == "" {
+		return nil, fmt.Errorf("no commit to report on: set CI_COMMIT_SHA")
+	}
+
+	mergeIID := 0
+	if iid := os.Getenv("CI_MERGE_REQUEST_IID"); iid != "" {
+		var err error
+		if mergeIID, err = strconv.Atoi(iid); err != nil {
+			return nil, fmt.Errorf("invalid CI_MERGE_REQUEST_IID %q", iid)
+		}
+	}
+
+	baseURL := os.Getenv("CI_API_V4_URL")
+	if review.APIURL != "" {
+		baseURL = strings.TrimSuffix(review.APIURL, "/") + "/api/v4"
+	}
+	if baseURL == "" {
+		baseURL = "https://gitlab.com/api/v4"
+	}
+
+	jobURL := os.Getenv("CI_JOB_URL")
+	reportURL := review.ReportURL
+	if reportURL == "" {
+		reportURL = jobURL
+	}
+
+	return &gitlabReviewer{
+		project:    project,
+		commit:     commit,
+		mergeIID:   mergeIID,
+		context:    review.Context,
+		reportURL:  reportURL,
+		jobURL:     strings.TrimSuffix(jobURL, "/"),
+		projectDir: os.Getenv("CI_PROJECT_DIR"),
+		api:        newIssueClient(baseURL, map[string]string{"PRIVATE-TOKEN": token}),
+	}, nil
+}
+
+// Target describes the commit or merge request
+func (r *gitlabReviewer) Target() string {
+	if r.mergeIID > 0 {
+		return fmt.Sprintf("gitlab:%s!%d", r.project, r.mergeIID)
+	}
+	return fmt.Sprintf("gitlab:%s@%.7s", r.project, r.commit)
+}
+
+// ReportURL returns the page the status links to
+func (r *gitlabReviewer) ReportURL() string {
+	return r.reportURL
+}
+
+// ArtifactURL returns the page of a file in the artifacts of the CI job. The page only
+// exists once the job has finished and if the file is in the job's artifacts.
+func (r *gitlabReviewer) ArtifactURL(path string) string {
+	if r.jobURL == "" || r.projectDir == "" {
+		return ""
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return ""
+	}
+	rel, err := filepath.Rel(r.projectDir, abs)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return ""
+	}
+	return r.jobURL + "/artifacts/file/" + filepath.ToSlash(rel)
+}
+
+// projectPath returns the API path of the project
+func (r *gitlabReviewer) projectPath() string {
+	return "/projects/" + url.PathEscape(r.project)
+}
+
+// SetStatus sets the commit status
+func (r *gitlabReviewer) SetStatus(ctx context.Context, state, description string) error {
+	if state == "failure" {
+		state = "failed"
+	}
+	request := map[string]string{"state": state, "description": description, "name": r.context}
+	if r.reportURL != "" {
+		request["target_url"] = r.reportURL
+	}
+	return r.api.do(ctx, http.MethodPost, fmt.Sprintf("%s/statuses/%s", r.projectPath(), r.commit), request, nil)
+}
+
+// Comment replaces the note of previous runs on the merge request, or adds one if create is set
+func (r *gitlabReviewer) Comment(ctx context.Context, body string, create bool) error {
+	if r.mergeIID == 0 {
+		return nil
+	}
+	marker := reviewMarker(r.context)
+	body = marker + "\n" + body
+	notesPath := fmt.Sprintf("%s/merge_requests/%d/notes", r.projectPath(), r.mergeIID)
+
+	var notes []struct {
+		ID   int64  `json:"id"`
+		Body string `json:"body"`
+	}
+	if err := r.api.do(ctx, http.MethodGet, notesPath+"?sort=desc&order_by=created_at&per_page=100", nil, &notes); err != nil {
+		return err
+	}
+	for _, note := range notes {
+		if strings.HasPrefix(note.Body, marker) {
+			return r.api.do(ctx, http.MethodPut, fmt.Sprintf("%s/%d", notesPath, note.ID), map[string]string{"body": body}, nil)
+		}
+	}
+
+	if !create {
+		return nil
+	}
+	return r.api.do(ctx, http.MethodPost, notesPath, map[string]string{"body": body}, nil)
+}
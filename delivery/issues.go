@@ -0,0 +1,110 @@
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"screenshot-tool/config"
+)
+
+// Issue identifies an issue in an issue tracker
+type Issue struct {
+	Number int    `json:"number"` // Issue number within the repository
+	URL    string `json:"url"`    // Web page of the issue
+}
+
+// IssueTracker files and updates issues
+type IssueTracker interface {
+	// Create opens an issue and returns it
+	Create(ctx context.Context, title, body string) (Issue, error)
+	// Comment adds a comment to an issue
+	Comment(ctx context.Context, number int, body string) error
+	// IsOpen reports whether an issue is still open
+	IsOpen(ctx context.Context, number int) (bool, error)
+	// Attach uploads a file and returns Markdown that embeds it, or "" if the tracker has no uploads
+	Attach(ctx context.Context, path string) (string, error)
+	// Target describes the repository for logs, e.g. github:owner/repo
+	Target() string
+}
+
+// NewIssueTracker creates the client of the configured issue tracker
+func NewIssueTracker(issues config.Issues) (IssueTracker, error) {
+	switch issues.Type {
+	case "github":
+		return newGitHubTracker(issues)
+	case "gitlab":
+		return newGitLabTracker(issues)
+	default:
+		return nil, fmt.Errorf("unsupported issue tracker: %s", issues.Type)
+	}
+}
+
+// issueClient sends JSON requests to an issue tracker API
+type issueClient struct {
+	baseURL string
+	headers map[string]string
+	client  *http.Client
+}
+
+// newIssueClient creates a client for the API at baseURL that sends the headers with every request
+func newIssueClient(baseURL string, headers map[string]string) *issueClient {
+	return &issueClient{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		headers: headers,
+		client:  &http.Client{Timeout: time.Minute},
+	}
+}
+
+// do sends a request with an optional JSON body and decodes the JSON response into result, if set
+func (c *issueClient) do(ctx context.Context, method, path string, body any, result any) error {
+	var reader io.Reader
+	contentType := ""
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+		contentType = "application/json"
+	}
+	return c.send(ctx, method, path, reader, contentType, result)
+}
+
+// send sends a request and decodes the JSON response into result, if set
+func (c *issueClient) send(ctx context.Context, method, path string, body io.Reader, contentType string, result any) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for name, value := range c.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s failed: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%s %s failed: %s: %s", method, path, resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to parse response of %s %s: %w", method, path, err)
+	}
+	return nil
+}
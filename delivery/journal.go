@@ -0,0 +1,236 @@
+package delivery
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Retry backoff bounds for pending deliveries
+const (
+	baseBackoff = 30 * time.Second
+	maxBackoff  = 6 * time.Hour
+)
+
+// Entry is a delivery that could not be completed and is waiting to be retried
+type Entry struct {
+	ID          string          `json:"id"`
+	Kind        string          `json:"kind"`   // Type of delivery, selects the handler
+	Target      string          `json:"target"` // Human readable destination, e.g. a bucket or endpoint
+	Payload     json.RawMessage `json:"payload"`
+	Attempts    int             `json:"attempts"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	NextAttempt time.Time       `json:"nextAttempt"`
+	LastError   string          `json:"lastError,omitempty"`
+}
+
+// Handler performs a delivery of a given kind
+type Handler func(ctx context.Context, entry Entry) error
+
+// Journal is a file-backed queue of pending deliveries. Deliveries that fail
+// because the network or the destination is unavailable are recorded here and
+// retried with exponential backoff on later runs or by the flush command.
+type Journal struct {
+	path     string
+	handlers map[string]Handler
+	mu       sync.Mutex
+}
+
+// OpenJournal opens the journal stored in the given directory
+func OpenJournal(dir string) (*Journal, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create journal directory: %w", err)
+	}
+
+	return &Journal{
+		path:     filepath.Join(dir, "journal.json"),
+		handlers: make(map[string]Handler),
+	}, nil
+}
+
+// Register sets the handler used for deliveries of the given kind
+func (j *Journal) Register(kind string, handler Handler) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.handlers[kind] = handler
+}
+
+// Deliver attempts a delivery immediately and queues it for retry if it fails
+func (j *Journal) Deliver(ctx context.Context, kind, target string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s payload: %w", kind, err)
+	}
+
+	entry := Entry{
+		ID:        newEntryID(),
+		Kind:      kind,
+		Target:    target,
+		Payload:   data,
+		CreatedAt: time.Now(),
+	}
+
+	j.mu.Lock()
+	handler, exists := j.handlers[kind]
+	j.mu.Unlock()
+	if !exists {
+		return fmt.Errorf("no handler registered for %s deliveries", kind)
+	}
+
+	if err := handler(ctx, entry); err != nil {
+		entry.Attempts = 1
+		entry.LastError = err.Error()
+		entry.NextAttempt = time.Now().Add(backoff(entry.Attempts))
+
+		log.Printf("Delivery of %s to %s failed, queued for retry at %s: %v",
+			kind, target, entry.NextAttempt.Format(time.RFC3339), err)
+
+		return j.update(func(entries []Entry) []Entry {
+			return append(entries, entry)
+		})
+	}
+
+	return nil
+}
+
+// Flush retries pending deliveries. Entries whose backoff has not expired are
+// skipped unless force is set. It returns the number of delivered and remaining entries.
+func (j *Journal) Flush(ctx context.Context, force bool) (int, int, error) {
+	entries, err := j.load()
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(entries) == 0 {
+		return 0, 0, nil
+	}
+
+	log.Printf("Retrying pending deliveries (%d queued)", len(entries))
+
+	delivered := make(map[string]bool)
+	failed := make(map[string]Entry)
+
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			break
+		}
+		if !force && time.Now().Before(entry.NextAttempt) {
+			continue
+		}
+
+		j.mu.Lock()
+		handler, exists := j.handlers[entry.Kind]
+		j.mu.Unlock()
+
+		err := fmt.Errorf("no handler registered for %s deliveries", entry.Kind)
+		if exists {
+			err = handler(ctx, entry)
+		}
+
+		if err == nil {
+			log.Printf("Delivered queued %s to %s after %d failed attempts", entry.Kind, entry.Target, entry.Attempts)
+			delivered[entry.ID] = true
+			continue
+		}
+
+		entry.Attempts++
+		entry.LastError = err.Error()
+		entry.NextAttempt = time.Now().Add(backoff(entry.Attempts))
+		failed[entry.ID] = entry
+		log.Printf("Queued %s to %s still failing (attempt %d), next retry at %s: %v",
+			entry.Kind, entry.Target, entry.Attempts, entry.NextAttempt.Format(time.RFC3339), err)
+	}
+
+	// Merge results into the journal, keeping entries queued concurrently
+	remaining := 0
+	err = j.update(func(current []Entry) []Entry {
+		kept := make([]Entry, 0, len(current))
+		for _, entry := range current {
+			if delivered[entry.ID] {
+				continue
+			}
+			if updated, ok := failed[entry.ID]; ok {
+				entry = updated
+			}
+			kept = append(kept, entry)
+		}
+		remaining = len(kept)
+		return kept
+	})
+
+	return len(delivered), remaining, err
+}
+
+// Pending returns all queued entries
+func (j *Journal) Pending() ([]Entry, error) {
+	return j.load()
+}
+
+// load reads the journal from disk
+func (j *Journal) load() ([]Entry, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.read()
+}
+
+// update applies a change to the journal and writes it back atomically
+func (j *Journal) update(change func([]Entry) []Entry) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entries, err := j.read()
+	if err != nil {
+		return err
+	}
+	entries = change(entries)
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode journal: %w", err)
+	}
+
+	tmpPath := j.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	return os.Rename(tmpPath, j.path)
+}
+
+// read loads the journal, the caller must hold the lock
+func (j *Journal) read() ([]Entry, error) {
+	data, err := os.ReadFile(j.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+
+	var entries []Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse journal %s: %w", j.path, err)
+	}
+	return entries, nil
+}
+
+// backoff returns the retry delay after the given number of failed attempts
+func backoff(attempts int) time.Duration {
+	delay := baseBackoff
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxBackoff)
+}
+
+// newEntryID returns a random identifier for a journal entry
+func newEntryID() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,72 @@
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"screenshot-tool/config"
+)
+
+// NotifyKind is the journal kind of run notifications
+const NotifyKind = "notification"
+
+// notificationPayload is the journal payload of a notification
+type notificationPayload struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body"`
+}
+
+// RegisterNotifications makes the journal deliver queued notifications
+func RegisterNotifications(j *Journal) {
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	j.Register(NotifyKind, func(ctx context.Context, entry Entry) error {
+		var payload notificationPayload
+		if err := json.Unmarshal(entry.Payload, &payload); err != nil {
+			return fmt.Errorf("invalid notification payload: %w", err)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, payload.URL, bytes.NewReader(payload.Body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		for name, value := range payload.Headers {
+			req.Header.Set(name, value)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("failed to post notification: %w", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+			return fmt.Errorf("notification rejected: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+		}
+		return nil
+	})
+}
+
+// Notify sends a notification with the given body, which is encoded as JSON.
+// A failed notification is queued in the journal for retry.
+func Notify(ctx context.Context, j *Journal, notification config.Notification, body any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+
+	return j.Deliver(ctx, NotifyKind, notification.URL, notificationPayload{
+		URL:     notification.URL,
+		Headers: notification.Headers,
+		Body:    data,
+	})
+}
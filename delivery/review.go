@@ -0,0 +1,42 @@
+package delivery
+
+import (
+	"context"
+	"fmt"
+
+	"screenshot-tool/config"
+)
+
+// Reviewer reports a CI run on the commit it checks and the pull or merge request the commit belongs to
+type Reviewer interface {
+	// SetStatus sets the status of the commit, "success" or "failure", linking the report of the run
+	SetStatus(ctx context.Context, state, description string) error
+	// Comment replaces the comment of previous runs on the pull or merge request with body.
+	// Without one, a comment is only added if create is set. It does nothing outside of them.
+	Comment(ctx context.Context, body string, create bool) error
+	// ReportURL returns the page the status links to, or "" if there is none
+	ReportURL() string
+	// ArtifactURL returns the page of a file in the artifacts of the CI job, or "" if the
+	// code host doesn't link to single artifacts
+	ArtifactURL(path string) string
+	// Target describes the commit and pull or merge request for logs, e.g. github:owner/repo#12
+	Target() string
+}
+
+// NewReviewer creates the reviewer of the configured code host from the environment of
+// the CI run. It fails if the run has no token or commit to report on, e.g. outside CI.
+func NewReviewer(review config.Review) (Reviewer, error) {
+	switch review.Type {
+	case "github":
+		return newGitHubReviewer(review)
+	case "gitlab":
+		return newGitLabReviewer(review)
+	default:
+		return nil, fmt.Errorf("unsupported code host: %s", review.Type)
+	}
+}
+
+// reviewMarker tags the comments of a status context, so later runs replace them
+func reviewMarker(statusContext string) string {
+	return fmt.Sprintf("<!-- screenshot-tool review: %s -->", statusContext)
+}
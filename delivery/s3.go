@@ -0,0 +1,208 @@
+package delivery
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"screenshot-tool/config"
+)
+
+// s3Uploader uploads files to an S3 bucket with Signature Version 4 signed requests
+type s3Uploader struct {
+	bucket       string
+	prefix       string
+	region       string
+	endpoint     string // Custom endpoint for S3-compatible storage, addressed path-style
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	client       *http.Client
+}
+
+// newS3Uploader creates an S3 uploader, reading credentials from the standard AWS environment
+// variables or the upload's secrets of the same names
+func newS3Uploader(upload config.Upload) (*s3Uploader, error) {
+	u := &s3Uploader{
+		bucket:       upload.Bucket,
+		prefix:       strings.Trim(upload.Prefix, "/"),
+		region:       upload.Region,
+		endpoint:     strings.TrimSuffix(upload.Endpoint, "/"),
+		accessKey:    upload.Credential("AWS_ACCESS_KEY_ID"),
+		secretKey:    upload.Credential("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: upload.Credential("AWS_SESSION_TOKEN"),
+		client:       &http.Client{Timeout: 5 * time.Minute},
+	}
+
+	if u.region == "" {
+		u.region = os.Getenv("AWS_REGION")
+	}
+	if u.region == "" {
+		u.region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if u.region == "" {
+		u.region = "us-east-1"
+	}
+
+	if u.accessKey == "" || u.secretKey == "" {
+		return nil, fmt.Errorf("S3 upload requires AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY to be set")
+	}
+
+	return u, nil
+}
+
+// Target describes the bucket and prefix uploads go to
+func (u *s3Uploader) Target() string {
+	if u.prefix == "" {
+		return "s3://" + u.bucket
+	}
+	return "s3://" + u.bucket + "/" + u.prefix
+}
+
+// Upload streams a file to the bucket
+func (u *s3Uploader) Upload(ctx context.Context, key, filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	if u.prefix != "" {
+		key = u.prefix + "/" + key
+	}
+
+	host := fmt.Sprintf("%s.s3.%s.amazonaws.com", u.bucket, u.region)
+	objectPath := "/" + s3EscapePath(key)
+	endpoint := "https://" + host
+	if u.endpoint != "" {
+		endpoint = u.endpoint
+		host = strings.TrimPrefix(strings.TrimPrefix(u.endpoint, "https://"), "http://")
+		objectPath = "/" + s3EscapePath(u.bucket) + objectPath
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint+objectPath, file)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = info.Size()
+	if contentType := mime.TypeByExtension(filepath.Ext(filePath)); contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	u.sign(req, host, objectPath, time.Now().UTC())
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("failed to upload %s: %s: %s", key, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// sign adds a Signature Version 4 authorization to a request. The payload is
+// left unsigned so files can be streamed without hashing them first.
+func (u *s3Uploader) sign(req *http.Request, host, objectPath string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	const payloadHash = "UNSIGNED-PAYLOAD"
+
+	req.Host = host
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if u.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", u.sessionToken)
+	}
+
+	headers := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	values := map[string]string{"host": host, "x-amz-content-sha256": payloadHash, "x-amz-date": amzDate}
+	if contentType := req.Header.Get("Content-Type"); contentType != "" {
+		headers = append([]string{"content-type"}, headers...)
+		values["content-type"] = contentType
+	}
+	if u.sessionToken != "" {
+		headers = append(headers, "x-amz-security-token")
+		values["x-amz-security-token"] = u.sessionToken
+	}
+
+	var canonicalHeaders strings.Builder
+	for _, h := range headers {
+		canonicalHeaders.WriteString(h + ":" + values[h] + "\n")
+	}
+	signedHeaders := strings.Join(headers, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		objectPath,
+		"",
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + u.region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(sha256Sum([]byte(canonicalRequest))),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+u.secretKey), date)
+	key = hmacSHA256(key, u.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		u.accessKey, scope, signedHeaders, signature))
+}
+
+// s3EscapePath URI-encodes each segment of an object key as required for signing
+func s3EscapePath(key string) string {
+	segments := strings.Split(path.Clean("/" + key)[1:], "/")
+	for i, segment := range segments {
+		var b strings.Builder
+		for _, c := range []byte(segment) {
+			if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+				c == '-' || c == '_' || c == '.' || c == '~' {
+				b.WriteByte(c)
+			} else {
+				fmt.Fprintf(&b, "%%%02X", c)
+			}
+		}
+		segments[i] = b.String()
+	}
+	return strings.Join(segments, "/")
+}
+
+// sha256Sum returns the SHA-256 hash of data
+func sha256Sum(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data with key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,96 @@
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"screenshot-tool/config"
+)
+
+// UploadKind is the journal kind of artifact uploads
+const UploadKind = "upload"
+
+// Uploader stores run artifacts in remote storage
+type Uploader interface {
+	// Upload stores the file at path under key, relative to the configured prefix
+	Upload(ctx context.Context, key, path string) error
+	// Target describes the destination for logs, e.g. s3://bucket/prefix
+	Target() string
+}
+
+// uploadPayload is the journal payload of an artifact upload
+type uploadPayload struct {
+	Path string `json:"path"`
+	Key  string `json:"key"`
+}
+
+// NewUploader creates the uploader for the configured storage backend
+func NewUploader(upload config.Upload) (Uploader, error) {
+	switch upload.Type {
+	case "s3":
+		return newS3Uploader(upload)
+	case "gcs":
+		return newGCSUploader(upload)
+	case "azure":
+		return newAzureUploader(upload)
+	default:
+		return nil, fmt.Errorf("unsupported upload type: %s", upload.Type)
+	}
+}
+
+// RegisterUploads makes the journal deliver queued uploads with the uploader
+func RegisterUploads(j *Journal, uploader Uploader) {
+	j.Register(UploadKind, func(ctx context.Context, entry Entry) error {
+		var payload uploadPayload
+		if err := json.Unmarshal(entry.Payload, &payload); err != nil {
+			return fmt.Errorf("invalid upload payload: %w", err)
+		}
+
+		// Artifacts deleted since the upload was queued can't be delivered anymore
+		if _, err := os.Stat(payload.Path); os.IsNotExist(err) {
+			log.Printf("Dropping queued upload of %s, the file no longer exists", payload.Path)
+			return nil
+		}
+
+		return uploader.Upload(ctx, payload.Key, payload.Path)
+	})
+}
+
+// UploadDir uploads every file below dir, keyed by its path relative to baseDir.
+// Failed uploads are queued in the journal for retry. It returns the number of files.
+func UploadDir(ctx context.Context, j *Journal, uploader Uploader, baseDir, dir string) (int, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, file := range files {
+		rel, err := filepath.Rel(baseDir, file)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			rel = filepath.Base(file)
+		}
+		key := path.Clean(filepath.ToSlash(rel))
+
+		if err := j.Deliver(ctx, UploadKind, uploader.Target()+"/"+key, uploadPayload{Path: file, Key: key}); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(files), nil
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"screenshot-tool/config"
+	"screenshot-tool/screenshot"
+)
+
+// deploymentRun is the before or after capture of a deployment
+type deploymentRun struct {
+	Dir    string    `json:"dir"`    // Run directory, relative to the output directory
+	At     time.Time `json:"at"`     // When the capture starts
+	Status string    `json:"status"` // "pending", "passed", "failed" or "missed"
+	Error  string    `json:"error,omitempty"`
+}
+
+// deploymentMarker is an announced deployment with its pair of captures
+type deploymentMarker struct {
+	ID         string        `json:"id"`
+	Version    string        `json:"version"`
+	At         time.Time     `json:"at"` // When the deployment happens
+	RecordedAt time.Time     `json:"recordedAt"`
+	Before     deploymentRun `json:"before"`
+	After      deploymentRun `json:"after"`
+
+	beforeDone chan struct{} // Closed when the before capture finished or was missed
+}
+
+// deploymentRequest is the body of a deployment announcement
+type deploymentRequest struct {
+	Version string    `json:"version"`
+	At      time.Time `json:"at,omitzero"` // Defaults to beforeMinutes from now
+}
+
+// deploymentScheduler runs the before and after captures of announced deployments and
+// keeps the index that pairs them in outputDir/deployments/index.json
+type deploymentScheduler struct {
+	ctx        context.Context
+	cfg        *config.Config
+	afterURL   func(config.URLConfig, string)
+	afterRun   func(*screenshot.RunSummary)
+	onProgress func(screenshot.ProgressEvent) // Progress of the captures, if set
+
+	dir     string
+	mu      sync.Mutex
+	markers []*deploymentMarker
+	wg      sync.WaitGroup
+}
+
+// newDeploymentScheduler loads the deployment index and resumes the captures that
+// were pending when the server stopped
+func newDeploymentScheduler(ctx context.Context, cfg *config.Config, afterURL func(config.URLConfig, string), afterRun func(*screenshot.RunSummary), onProgress func(screenshot.ProgressEvent)) (*deploymentScheduler, error) {
+	d := &deploymentScheduler{
+		ctx:        ctx,
+		cfg:        cfg,
+		afterURL:   afterURL,
+		afterRun:   afterRun,
+		onProgress: onProgress,
+		dir:        filepath.Join(cfg.OutputDir, "deployments"),
+	}
+
+	data, err := os.ReadFile(filepath.Join(d.dir, "index.json"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &d.markers); err != nil {
+			return nil, fmt.Errorf("failed to parse deployment index: %w", err)
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, marker := range d.markers {
+		marker.beforeDone = make(chan struct{})
+		switch {
+		case marker.Before.Status != "pending":
+			close(marker.beforeDone)
+		case time.Now().After(marker.At):
+			// A capture taken after the deployment can't show what came before it
+			marker.Before.Status = "missed"
+			close(marker.beforeDone)
+			log.Printf("Warning: Missed the before capture of deployment %s", marker.ID)
+		default:
+			d.schedule(marker, "before")
+		}
+		if marker.After.Status == "pending" {
+			d.schedule(marker, "after")
+		}
+	}
+	return d, d.save()
+}
+
+// record announces a deployment and schedules its captures
+func (d *deploymentScheduler) record(version string, at time.Time) (*deploymentMarker, error) {
+	now := time.Now()
+	before := time.Duration(d.cfg.Deployments.BeforeMinutes) * time.Minute
+	after := time.Duration(d.cfg.Deployments.AfterMinutes) * time.Minute
+	if at.IsZero() {
+		at = now.Add(before)
+	}
+
+	id := screenshot.SanitizeFilename(version) + "_" + at.Format("20060102-150405")
+	marker := &deploymentMarker{
+		ID:         id,
+		Version:    version,
+		At:         at,
+		RecordedAt: now,
+		Before:     deploymentRun{Dir: "deployments/" + id + "/before", At: at.Add(-before), Status: "pending"},
+		After:      deploymentRun{Dir: "deployments/" + id + "/after", At: at.Add(after), Status: "pending"},
+		beforeDone: make(chan struct{}),
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, existing := range d.markers {
+		if existing.ID == id {
+			return nil, fmt.Errorf("deployment %s at %s is already recorded", version, at.Format(time.RFC3339))
+		}
+	}
+
+	if at.Before(now) {
+		marker.Before.Status = "missed"
+		close(marker.beforeDone)
+	}
+
+	if err := os.MkdirAll(filepath.Join(d.dir, id), 0755); err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(marker, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(d.dir, id, "deployment.json"), data, 0644); err != nil {
+		return nil, err
+	}
+
+	d.markers = append(d.markers, marker)
+	if err := d.save(); err != nil {
+		return nil, err
+	}
+
+	if marker.Before.Status == "pending" {
+		d.schedule(marker, "before")
+	}
+	d.schedule(marker, "after")
+	log.Printf("Recorded deployment %s at %s, capturing before at %s and after at %s",
+		version, at.Format(time.RFC3339), marker.Before.At.Format(time.RFC3339), marker.After.At.Format(time.RFC3339))
+	return marker, nil
+}
+
+// schedule starts the before or after capture of a deployment at its time.
+// The after capture waits for the before capture. The caller holds d.mu.
+func (d *deploymentScheduler) schedule(marker *deploymentMarker, phase string) {
+	run := &marker.Before
+	if phase == "after" {
+		run = &marker.After
+	}
+	at := run.At
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+
+		timer := time.NewTimer(time.Until(at))
+		defer timer.Stop()
+		select {
+		case <-d.ctx.Done():
+			return // Resumed when the server starts again
+		case <-timer.C:
+		}
+		if phase == "after" {
+			select {
+			case <-d.ctx.Done():
+				return
+			case <-marker.beforeDone:
+			}
+		}
+
+		runCfg := *d.cfg
+		runCfg.OutputDir = filepath.Join(d.cfg.OutputDir, filepath.FromSlash(run.Dir))
+		runCfg.URLs = selectURLs(d.cfg.URLs, d.cfg.Deployments.URLs)
+		label := fmt.Sprintf("Deployment %s %s", marker.Version, phase)
+		err := captureRun(d.ctx, &runCfg, label, d.afterURL, tagRun(d.afterRun, "deployment", ""), d.onProgress)
+
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		switch {
+		case d.ctx.Err() != nil:
+			// Interrupted by a shutdown, captured again when the server starts
+		case err != nil:
+			run.Status, run.Error = "failed", err.Error()
+		default:
+			run.Status = "passed"
+		}
+		if phase == "before" && run.Status != "pending" {
+			close(marker.beforeDone)
+		}
+		if err := d.save(); err != nil {
+			log.Printf("Warning: Failed to save deployment index: %v", err)
+		}
+	}()
+}
+
+// save writes the deployment index. The caller holds d.mu.
+func (d *deploymentScheduler) save() error {
+	if err := os.MkdirAll(d.dir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(d.markers, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(d.dir, "index.json"), data, 0644)
+}
+
+// wait waits for the scheduled captures, which return early once the server shuts down
+func (d *deploymentScheduler) wait() {
+	d.wg.Wait()
+}
+
+// handle records deployments on POST and lists them on GET. With ?wait=before,
+// a POST answers once the before capture finished, so a pipeline can deploy after it.
+func (d *deploymentScheduler) handle(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		d.mu.Lock()
+		data, err := json.Marshal(d.markers)
+		d.mu.Unlock()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+		return
+	case http.MethodPost:
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req deploymentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Version) == "" {
+		http.Error(w, "invalid request: version is required", http.StatusBadRequest)
+		return
+	}
+
+	marker, err := d.record(req.Version, req.At)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	if r.URL.Query().Get("wait") == "before" {
+		select {
+		case <-marker.beforeDone:
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	d.mu.Lock()
+	data, err := json.Marshal(marker)
+	d.mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(data)
+}
+
+// runDeploy implements the deploy command, which announces a deployment to a server
+func runDeploy(args []string) {
+	flags := flag.NewFlagSet("deploy", flag.ExitOnError)
+	server := flags.String("server", "http://127.0.0.1:8080", "URL of the server started with the serve command")
+	version := flags.String("version", "", "Version being deployed")
+	at := flags.String("at", "", "Time of the deployment in RFC 3339 format (defaults to beforeMinutes from now)")
+	wait := flags.Bool("wait", false, "Wait until the before capture finished, exiting with status 1 if it failed")
+	flags.Parse(args)
+
+	if *version == "" {
+		log.Fatalf("-version is required")
+	}
+	req := deploymentRequest{Version: *version}
+	if *at != "" {
+		parsed, err := time.Parse(time.RFC3339, *at)
+		if err != nil {
+			log.Fatalf("Invalid deployment time %s: %v", *at, err)
+		}
+		req.At = parsed
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		log.Fatalf("Failed to encode deployment: %v", err)
+	}
+	endpoint := strings.TrimSuffix(*server, "/") + "/deployments"
+	if *wait {
+		endpoint += "?wait=before"
+	}
+
+	resp, err := http.Post(endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Fatalf("Failed to record deployment: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusCreated {
+		log.Fatalf("Failed to record deployment: %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	var marker deploymentMarker
+	if err := json.Unmarshal(data, &marker); err != nil {
+		log.Fatalf("Invalid response from server: %v", err)
+	}
+	log.Printf("Recorded deployment %s at %s: before capture %s (%s), after capture at %s",
+		marker.Version, marker.At.Format(time.RFC3339), marker.Before.Status, marker.Before.Dir, marker.After.At.Format(time.RFC3339))
+
+	if *wait && marker.Before.Status == "failed" {
+		log.Printf("Before capture failed: %s", marker.Before.Error)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"screenshot-tool/screenshot"
+)
+
+// eventBacklog is how many recent events a reconnecting client can catch up on
+const eventBacklog = 1000
+
+// eventKeepalive is how often an idle event stream gets a comment, so proxies keep it open
+const eventKeepalive = 30 * time.Second
+
+// serverEvent is a capture progress event streamed by GET /events
+type serverEvent struct {
+	ID     int64  `json:"id"`
+	Source string `json:"source"` // "capture", "team:<name>", "trigger:<name>" or "deployment"
+	screenshot.ProgressEvent
+
+	owner string // API key name of the team that requested the capture
+}
+
+// progressHub collects the progress events of the server's captures and streams them
+// to the clients of GET /events as server-sent events
+type progressHub struct {
+	outputDir string
+
+	mu      sync.Mutex
+	nextID  int64
+	events  []serverEvent // The last eventBacklog events
+	closed  bool
+	changed chan struct{} // Closed and replaced when an event is added or the hub closes
+}
+
+func newProgressHub(outputDir string) *progressHub {
+	return &progressHub{outputDir: outputDir, nextID: 1, changed: make(chan struct{})}
+}
+
+// publisher returns an OnProgress callback adding the events of a source. owner is the API
+// key name the captures were requested with, empty if not requested with a key.
+func (h *progressHub) publisher(source, owner string) func(screenshot.ProgressEvent) {
+	return func(event screenshot.ProgressEvent) {
+		h.publish(source, owner, event)
+	}
+}
+
+func (h *progressHub) publish(source, owner string, event screenshot.ProgressEvent) {
+	// Report directories like the capture endpoints, relative to the output directory
+	if event.Dir != "" {
+		if dir, err := filepath.Rel(h.outputDir, event.Dir); err == nil {
+			event.Dir = filepath.ToSlash(dir)
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.events = append(h.events, serverEvent{ID: h.nextID, Source: source, ProgressEvent: event, owner: owner})
+	h.nextID++
+	if len(h.events) > eventBacklog {
+		h.events = h.events[len(h.events)-eventBacklog:]
+	}
+	close(h.changed)
+	h.changed = make(chan struct{})
+}
+
+// close ends the streams, so shutting down the server doesn't wait for them
+func (h *progressHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.closed {
+		h.closed = true
+		close(h.changed)
+	}
+}
+
+// handle streams the events from now on, or from after the Last-Event-ID of a reconnecting
+// client. With API keys, a team only receives the events of its own captures. ?source=
+// limits the stream to one source, e.g. trigger:deploy.
+func (h *progressHub) handle(tenants *apiTenants) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var tenant *apiTenant
+		if tenants != nil {
+			var err error
+			if tenant, err = tenants.authenticate(r.Header); err != nil {
+				writeAPIKeyError(w, err)
+				return
+			}
+		}
+		source := r.URL.Query().Get("source")
+
+		h.mu.Lock()
+		last := h.nextID - 1
+		h.mu.Unlock()
+		if id, err := strconv.ParseInt(r.Header.Get("Last-Event-ID"), 10, 64); err == nil && id < last {
+			last = id
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		rc := http.NewResponseController(w)
+		rc.Flush()
+
+		keepalive := time.NewTicker(eventKeepalive)
+		defer keepalive.Stop()
+		for {
+			h.mu.Lock()
+			var pending []serverEvent
+			for _, event := range h.events {
+				if event.ID > last {
+					pending = append(pending, event)
+				}
+			}
+			changed, closed := h.changed, h.closed
+			h.mu.Unlock()
+			if closed {
+				return
+			}
+
+			for _, event := range pending {
+				last = event.ID
+				if (tenant != nil && event.owner != tenant.Name) || (source != "" && event.Source != source) {
+					continue
+				}
+				data, err := json.Marshal(event)
+				if err != nil {
+					continue
+				}
+				if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data); err != nil {
+					return
+				}
+			}
+			if len(pending) > 0 {
+				if err := rc.Flush(); err != nil {
+					return
+				}
+			}
+
+			select {
+			case <-changed:
+			case <-keepalive.C:
+				if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+					return
+				}
+				if err := rc.Flush(); err != nil {
+					return
+				}
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}
+}
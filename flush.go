@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+
+	"screenshot-tool/config"
+	"screenshot-tool/delivery"
+)
+
+// openJournal opens the pending delivery journal kept in the output directory
+// and registers the handlers of the configured deliveries
+func openJournal(cfg *config.Config) (*delivery.Journal, error) {
+	journal, err := delivery.OpenJournal(filepath.Join(cfg.OutputDir, ".pending"))
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Upload != nil {
+		uploader, err := delivery.NewUploader(*cfg.Upload)
+		if err != nil {
+			return nil, err
+		}
+		delivery.RegisterUploads(journal, uploader)
+	}
+	delivery.RegisterNotifications(journal)
+
+	return journal, nil
+}
+
+// runFlush implements the flush command, which retries all queued deliveries immediately
+func runFlush(args []string) {
+	flags := flag.NewFlagSet("flush", flag.ExitOnError)
+	configPath := flags.String("config", "config.json", "Path to configuration file")
+	flags.Parse(args)
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	journal, err := openJournal(cfg)
+	if err != nil {
+		log.Fatalf("Failed to open delivery journal: %v", err)
+	}
+
+	delivered, remaining, err := journal.Flush(context.Background(), true)
+	if err != nil {
+		log.Fatalf("Failed to flush pending deliveries: %v", err)
+	}
+
+	log.Printf("Flushed pending deliveries: %d delivered, %d still queued", delivered, remaining)
+	if remaining > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,546 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"screenshot-tool/config"
+	"screenshot-tool/screenshot"
+)
+
+// grpcService is the full name of the service of api/capture.proto
+const grpcService = "/screenshottool.v1.CaptureService/"
+
+// grpcMaxMessage is the largest request message accepted, like the gRPC default
+const grpcMaxMessage = 4 << 20
+
+// batchRetention is how long the events of a finished batch can still be streamed
+const batchRetention = time.Hour
+
+// gRPC status codes
+const (
+	grpcOK              = 0
+	grpcInvalidArgument = 3
+	grpcNotFound        = 5
+	grpcResourceLimit   = 8
+	grpcUnimplemented   = 12
+	grpcInternal        = 13
+	grpcUnavailable     = 14
+	grpcUnauthenticated = 16
+)
+
+// grpcError is a failed call with its gRPC status code
+type grpcError struct {
+	code    int
+	message string
+}
+
+func (e *grpcError) Error() string {
+	return e.message
+}
+
+// grpcServer serves the CaptureService over HTTP/2 with the captures of the serve command
+type grpcServer struct {
+	ctx          context.Context
+	cfg          *config.Config
+	screenshoter *screenshot.Screenshoter
+	tenants      *apiTenants   // API keys calls must carry, nil if none are configured
+	sem          chan struct{} // Limits batch captures to the configured concurrency
+
+	mu      sync.Mutex
+	batches map[string]*captureBatch
+	wg      sync.WaitGroup // Running batches
+}
+
+// captureBatch is a batch of URLs captured in the background, with its events so far
+type captureBatch struct {
+	id       string
+	owner    *apiTenant // Team that started the batch, the only one that can stream it
+	total    int
+	events   []*pbProgressEvent
+	finished time.Time
+	changed  chan struct{} // Closed and replaced when an event is added
+}
+
+func newGRPCServer(ctx context.Context, cfg *config.Config, screenshoter *screenshot.Screenshoter, tenants *apiTenants) *grpcServer {
+	return &grpcServer{
+		ctx:          ctx,
+		cfg:          cfg,
+		screenshoter: screenshoter,
+		tenants:      tenants,
+		sem:          make(chan struct{}, cfg.Concurrency),
+		batches:      make(map[string]*captureBatch),
+	}
+}
+
+// ServeHTTP handles a gRPC call. Requests must use HTTP/2 and uncompressed messages.
+func (g *grpcServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ProtoMajor != 2 || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "gRPC requests only", http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+
+	// API keys are sent as metadata, which arrives as request headers
+	var tenant *apiTenant
+	if g.tenants != nil {
+		var err error
+		if tenant, err = g.tenants.authenticate(r.Header); err != nil {
+			writeGRPCStatus(w, grpcAPIKeyError(err))
+			return
+		}
+	}
+
+	request, err := readGRPCMessage(r.Body)
+	if err != nil {
+		writeGRPCStatus(w, err)
+		return
+	}
+
+	switch strings.TrimPrefix(r.URL.Path, grpcService) {
+	case "CaptureURL":
+		var req pbCaptureURLRequest
+		if err := req.unmarshal(request); err != nil {
+			writeGRPCStatus(w, &grpcError{grpcInvalidArgument, err.Error()})
+			return
+		}
+		result, err := g.captureURL(r.Context(), tenant, req.Target)
+		if err == nil {
+			err = writeGRPCMessage(w, result.marshal())
+		}
+		writeGRPCStatus(w, err)
+	case "CaptureBatch":
+		var req pbCaptureBatchRequest
+		if err := req.unmarshal(request); err != nil {
+			writeGRPCStatus(w, &grpcError{grpcInvalidArgument, err.Error()})
+			return
+		}
+		batch, err := g.startBatch(tenant, req.Targets)
+		if err == nil {
+			err = writeGRPCMessage(w, batch.marshal())
+		}
+		writeGRPCStatus(w, err)
+	case "StreamProgress":
+		var req pbStreamProgressRequest
+		if err := req.unmarshal(request); err != nil {
+			writeGRPCStatus(w, &grpcError{grpcInvalidArgument, err.Error()})
+			return
+		}
+		writeGRPCStatus(w, g.streamProgress(r.Context(), w, tenant, req.BatchID))
+	default:
+		writeGRPCStatus(w, &grpcError{grpcUnimplemented, "unknown method " + r.URL.Path})
+	}
+}
+
+// readGRPCMessage reads the single length-prefixed message of a unary or server streaming call
+func readGRPCMessage(body io.Reader) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(body, prefix[:]); err != nil {
+		return nil, &grpcError{grpcInvalidArgument, "missing request message"}
+	}
+	if prefix[0] != 0 {
+		return nil, &grpcError{grpcUnimplemented, "compressed messages are not supported"}
+	}
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if size > grpcMaxMessage {
+		return nil, &grpcError{grpcResourceLimit, fmt.Sprintf("request message of %d bytes is larger than %d bytes", size, grpcMaxMessage)}
+	}
+	message := make([]byte, size)
+	if _, err := io.ReadFull(body, message); err != nil {
+		return nil, &grpcError{grpcInvalidArgument, "truncated request message"}
+	}
+	return message, nil
+}
+
+// writeGRPCMessage writes a length-prefixed message and flushes it to the client
+func writeGRPCMessage(w http.ResponseWriter, message []byte) error {
+	frame := make([]byte, 5, 5+len(message))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(message)))
+	if _, err := w.Write(append(frame, message...)); err != nil {
+		return err
+	}
+	return http.NewResponseController(w).Flush()
+}
+
+// writeGRPCStatus ends a call with the status of err in the trailers
+func writeGRPCStatus(w http.ResponseWriter, err error) {
+	code, message := grpcOK, ""
+	if err != nil {
+		code, message = grpcInternal, err.Error()
+		if grpcErr, ok := err.(*grpcError); ok {
+			code = grpcErr.code
+		}
+	}
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(code))
+	if message != "" {
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", grpcPercentEncode(message))
+	}
+}
+
+// grpcAPIKeyError turns a request refused because of its API key into its gRPC status
+func grpcAPIKeyError(err error) error {
+	if keyErr, ok := err.(*apiKeyError); ok {
+		if keyErr.status == http.StatusUnauthorized {
+			return &grpcError{grpcUnauthenticated, keyErr.message}
+		}
+		return &grpcError{grpcResourceLimit, keyErr.message}
+	}
+	return err
+}
+
+// grpcPercentEncode encodes a status message as required in the grpc-message trailer
+func grpcPercentEncode(message string) string {
+	var b strings.Builder
+	for _, c := range []byte(message) {
+		if c < 0x20 || c > 0x7e || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// grpcPageOptions are the options of a URL object API clients can give in config_json.
+// Options reaching into the server, such as Chrome flags, extensions, files, proxies and
+// value commands, are left to the server's configuration.
+type grpcPageOptions struct {
+	Name            string                  `json:"name"`
+	URL             string                  `json:"url"`
+	Viewports       []config.Viewport       `json:"viewports,omitempty"`
+	Delay           int                     `json:"delay,omitempty"`
+	Cookies         []config.Cookie         `json:"cookies,omitempty"`
+	LocalStorage    []config.LocalStorage   `json:"localStorage,omitempty"`
+	CookieProfileID string                  `json:"cookieProfileId,omitempty"`
+	Samples         int                     `json:"samples,omitempty"`
+	SampleInterval  int                     `json:"sampleInterval,omitempty"`
+	UserSimulation  *config.UserSimulation  `json:"userSimulation,omitempty"`
+	WaitForSelector string                  `json:"waitForSelector,omitempty"`
+	WaitTimeout     int                     `json:"waitTimeout,omitempty"`
+	Actions         []config.Action         `json:"actions,omitempty"`
+	Rewrites        []config.RewriteRule    `json:"rewrites,omitempty"`
+	LoginID         string                  `json:"loginId,omitempty"`
+	HideSelectors   []string                `json:"hideSelectors,omitempty"`
+	MaskSelectors   []string                `json:"maskSelectors,omitempty"`
+	Placeholders    []config.Placeholder    `json:"placeholders,omitempty"`
+	Timezone        string                  `json:"timezone,omitempty"`
+	Geolocation     *config.Geolocation     `json:"geolocation,omitempty"`
+	Throttling      *config.Throttling      `json:"throttling,omitempty"`
+	HAR             bool                    `json:"har,omitempty"`
+	Trace           bool                    `json:"trace,omitempty"`
+	Minimap         bool                    `json:"minimap,omitempty"`
+	Accessibility   *config.Accessibility   `json:"accessibility,omitempty"`
+	Flaky           bool                    `json:"flaky,omitempty"`
+	InteractiveMap  *config.InteractiveMap  `json:"interactiveMap,omitempty"`
+	ScrollRecording *config.ScrollRecording `json:"scrollRecording,omitempty"`
+	Video           *config.VideoRecording  `json:"video,omitempty"`
+	DiffTolerance   *config.DiffTolerance   `json:"diffTolerance,omitempty"`
+	DiffMode        string                  `json:"diffMode,omitempty"`
+}
+
+// decodePageOptions decodes config_json into a URL object, refusing options that aren't page
+// options and values produced by commands
+func decodePageOptions(data string) (config.URLConfig, error) {
+	decoder := json.NewDecoder(strings.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var o grpcPageOptions
+	if err := decoder.Decode(&o); err != nil {
+		return config.URLConfig{}, fmt.Errorf("%w (only page options can be given, settings such as chromeFlags, extensions, storageState, proxy, dnsOverrides, chromeMode and browser are left to the server)", err)
+	}
+
+	if err := rejectValueCommands(o.Cookies, o.LocalStorage, o.Viewports); err != nil {
+		return config.URLConfig{}, err
+	}
+	if o.Accessibility != nil && o.Accessibility.AxeScript != "" {
+		return config.URLConfig{}, fmt.Errorf("accessibility: axeScript can only be set in the server's configuration")
+	}
+
+	return config.URLConfig{
+		Name:            o.Name,
+		URL:             o.URL,
+		Viewports:       o.Viewports,
+		Delay:           o.Delay,
+		Cookies:         o.Cookies,
+		LocalStorage:    o.LocalStorage,
+		CookieProfileID: o.CookieProfileID,
+		Samples:         o.Samples,
+		SampleInterval:  o.SampleInterval,
+		UserSimulation:  o.UserSimulation,
+		WaitForSelector: o.WaitForSelector,
+		WaitTimeout:     o.WaitTimeout,
+		Actions:         o.Actions,
+		Rewrites:        o.Rewrites,
+		LoginID:         o.LoginID,
+		HideSelectors:   o.HideSelectors,
+		MaskSelectors:   o.MaskSelectors,
+		Placeholders:    o.Placeholders,
+		Timezone:        o.Timezone,
+		Geolocation:     o.Geolocation,
+		Throttling:      o.Throttling,
+		HAR:             o.HAR,
+		Trace:           o.Trace,
+		Minimap:         o.Minimap,
+		Accessibility:   o.Accessibility,
+		Flaky:           o.Flaky,
+		InteractiveMap:  o.InteractiveMap,
+		ScrollRecording: o.ScrollRecording,
+		Video:           o.Video,
+		DiffTolerance:   o.DiffTolerance,
+		DiffMode:        o.DiffMode,
+	}, nil
+}
+
+// urlConfig turns a target into a URL object, filling in defaults like the -url flag and
+// validating it like the URLs of the configuration
+func (g *grpcServer) urlConfig(target pbTarget) (config.URLConfig, error) {
+	var urlConfig config.URLConfig
+	if target.ConfigJSON != "" {
+		var err error
+		if urlConfig, err = decodePageOptions(target.ConfigJSON); err != nil {
+			return urlConfig, &grpcError{grpcInvalidArgument, "invalid config_json: " + err.Error()}
+		}
+	}
+	if target.URL != "" {
+		urlConfig.URL = target.URL
+	}
+	if target.Name != "" {
+		urlConfig.Name = target.Name
+	}
+	if target.Delay != 0 {
+		urlConfig.Delay = int(target.Delay)
+	}
+	for _, v := range target.Viewports {
+		if v.Width <= 0 || v.Height <= 0 {
+			return urlConfig, &grpcError{grpcInvalidArgument, fmt.Sprintf("invalid viewport %dx%d", v.Width, v.Height)}
+		}
+		if v.Orientation != "" && v.Orientation != "portrait" && v.Orientation != "landscape" {
+			return urlConfig, &grpcError{grpcInvalidArgument, "invalid viewport orientation: " + v.Orientation}
+		}
+		urlConfig.Viewports = append(urlConfig.Viewports, config.Viewport{
+			Width:       int(v.Width),
+			Height:      int(v.Height),
+			Mobile:      v.Mobile,
+			Touch:       v.Touch,
+			Orientation: v.Orientation,
+		})
+	}
+	for _, c := range target.Cookies {
+		urlConfig.Cookies = append(urlConfig.Cookies, config.Cookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Domain:   c.Domain,
+			Path:     c.Path,
+			Secure:   c.Secure,
+			HTTPOnly: c.HTTPOnly,
+		})
+	}
+
+	if urlConfig.URL == "" {
+		return urlConfig, &grpcError{grpcInvalidArgument, "url is required"}
+	}
+	if urlConfig.Name == "" {
+		urlConfig.Name = extractDomain(urlConfig.URL)
+	}
+	if urlConfig.Delay == 0 {
+		urlConfig.Delay = 1000
+	}
+	if len(urlConfig.Viewports) == 0 {
+		urlConfig.Viewports = g.cfg.DefaultViewports
+	}
+	if len(urlConfig.Viewports) == 0 {
+		urlConfig.Viewports = []config.Viewport{{Width: 1280, Height: 800}}
+	}
+	if err := g.cfg.ValidateURL(&urlConfig); err != nil {
+		return urlConfig, &grpcError{grpcInvalidArgument, "invalid target: " + err.Error()}
+	}
+	return urlConfig, nil
+}
+
+// captureURL captures a target and reports its outcome. Failed captures are reported in
+// the result rather than as an error of the call.
+func (g *grpcServer) captureURL(ctx context.Context, tenant *apiTenant, target pbTarget) (*pbCaptureResult, error) {
+	urlConfig, err := g.urlConfig(target)
+	if err != nil {
+		return nil, err
+	}
+	if err := tenant.admit(1); err != nil {
+		return nil, grpcAPIKeyError(err)
+	}
+	log.Printf("Received gRPC capture request for %s", urlConfig.URL)
+	return g.capture(ctx, tenant, urlConfig), nil
+}
+
+// capture captures a URL, into the prefix of the tenant if there is one, and describes its outcome
+func (g *grpcServer) capture(ctx context.Context, tenant *apiTenant, urlConfig config.URLConfig) *pbCaptureResult {
+	screenshoter := g.screenshoter
+	if tenant != nil {
+		screenshoter = tenant.screenshoter
+	}
+	start := time.Now()
+	urlDir, err := screenshoter.CaptureURLDir(ctx, urlConfig)
+
+	result := &pbCaptureResult{
+		Name:       urlConfig.Name,
+		URL:        urlConfig.URL,
+		Status:     "passed",
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if urlDir != "" {
+		if dir, err := filepath.Rel(g.cfg.OutputDir, urlDir); err == nil {
+			result.Dir = filepath.ToSlash(dir)
+		}
+	}
+	if err != nil {
+		log.Printf("gRPC capture of %s failed: %v", urlConfig.URL, err)
+		result.Status = "failed"
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// startBatch starts capturing the targets of a batch in the background
+func (g *grpcServer) startBatch(tenant *apiTenant, targets []pbTarget) (*pbBatch, error) {
+	if len(targets) == 0 {
+		return nil, &grpcError{grpcInvalidArgument, "targets are required"}
+	}
+	urls := make([]config.URLConfig, len(targets))
+	for i, target := range targets {
+		urlConfig, err := g.urlConfig(target)
+		if err != nil {
+			return nil, &grpcError{grpcInvalidArgument, fmt.Sprintf("target #%d: %v", i+1, err)}
+		}
+		urls[i] = urlConfig
+	}
+	if g.ctx.Err() != nil {
+		return nil, &grpcError{grpcUnavailable, "server is shutting down"}
+	}
+	if err := tenant.admit(len(urls)); err != nil {
+		return nil, grpcAPIKeyError(err)
+	}
+
+	id := make([]byte, 8)
+	rand.Read(id)
+	batch := &captureBatch{id: hex.EncodeToString(id), owner: tenant, total: len(urls), changed: make(chan struct{})}
+
+	g.mu.Lock()
+	for id, b := range g.batches {
+		if !b.finished.IsZero() && time.Since(b.finished) > batchRetention {
+			delete(g.batches, id)
+		}
+	}
+	g.batches[batch.id] = batch
+	g.mu.Unlock()
+
+	log.Printf("Starting gRPC batch %s of %d URLs", batch.id, len(urls))
+	g.wg.Add(1)
+	go g.runBatch(batch, urls)
+	return &pbBatch{ID: batch.id, Total: int32(len(urls))}, nil
+}
+
+// runBatch captures the URLs of a batch concurrently, recording their events
+func (g *grpcServer) runBatch(batch *captureBatch, urls []config.URLConfig) {
+	defer g.wg.Done()
+
+	var wg sync.WaitGroup
+	for i, urlConfig := range urls {
+		g.sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-g.sem
+				wg.Done()
+			}()
+
+			event := &pbProgressEvent{Type: "started", Index: int32(i + 1), Name: urlConfig.Name, URL: urlConfig.URL}
+			g.addEvent(batch, event)
+
+			result := g.capture(g.ctx, batch.owner, urlConfig)
+			event = &pbProgressEvent{Type: "captured", Index: int32(i + 1), Name: urlConfig.Name, URL: urlConfig.URL, Result: result}
+			if result.Status != "passed" {
+				event.Type = "failed"
+			}
+			g.addEvent(batch, event)
+		}()
+	}
+	wg.Wait()
+
+	g.addEvent(batch, &pbProgressEvent{Type: "finished"})
+	log.Printf("Finished gRPC batch %s", batch.id)
+}
+
+// addEvent records an event of a batch and wakes up its streams
+func (g *grpcServer) addEvent(batch *captureBatch, event *pbProgressEvent) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	completed := 0
+	for _, e := range batch.events {
+		if e.Type == "captured" || e.Type == "failed" {
+			completed++
+		}
+	}
+	if event.Type == "captured" || event.Type == "failed" {
+		completed++
+	}
+	event.BatchID = batch.id
+	event.Completed = int32(completed)
+	event.Total = int32(batch.total)
+	if event.Type == "finished" {
+		batch.finished = time.Now()
+	}
+
+	batch.events = append(batch.events, event)
+	close(batch.changed)
+	batch.changed = make(chan struct{})
+}
+
+// streamProgress sends the events of a batch from its start until it finished
+func (g *grpcServer) streamProgress(ctx context.Context, w http.ResponseWriter, tenant *apiTenant, batchID string) error {
+	g.mu.Lock()
+	batch, ok := g.batches[batchID]
+	g.mu.Unlock()
+	if !ok || batch.owner != tenant {
+		return &grpcError{grpcNotFound, "unknown batch " + batchID}
+	}
+
+	sent := 0
+	for {
+		g.mu.Lock()
+		events := batch.events[sent:]
+		changed := batch.changed
+		g.mu.Unlock()
+
+		for _, event := range events {
+			if err := writeGRPCMessage(w, event.marshal()); err != nil {
+				return err
+			}
+			sent++
+			if event.Type == "finished" {
+				return nil
+			}
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// wait waits for the running batches to finish
+func (g *grpcServer) wait() {
+	g.wg.Wait()
+}
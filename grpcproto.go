@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Messages of api/capture.proto with their protobuf wire encoding, written by hand to keep
+// the tool free of code generators and the gRPC libraries
+
+var errTruncatedProto = errors.New("truncated protobuf message")
+
+// protoEncoder appends fields in the protobuf wire format. Fields with their zero
+// value are left out like in proto3.
+type protoEncoder struct {
+	buf []byte
+}
+
+func (e *protoEncoder) tag(field, wireType int) {
+	e.buf = binary.AppendUvarint(e.buf, uint64(field)<<3|uint64(wireType))
+}
+
+func (e *protoEncoder) int(field int, v int64) {
+	if v != 0 {
+		e.tag(field, 0)
+		e.buf = binary.AppendUvarint(e.buf, uint64(v))
+	}
+}
+
+func (e *protoEncoder) bool(field int, v bool) {
+	if v {
+		e.int(field, 1)
+	}
+}
+
+func (e *protoEncoder) bytes(field int, v []byte) {
+	e.tag(field, 2)
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(v)))
+	e.buf = append(e.buf, v...)
+}
+
+func (e *protoEncoder) string(field int, v string) {
+	if v != "" {
+		e.bytes(field, []byte(v))
+	}
+}
+
+// protoField is a field read from a message: its number and either its varint value or
+// its length-delimited bytes
+type protoField struct {
+	number int
+	varint uint64
+	data   []byte
+}
+
+func (f protoField) int32() int32 { return int32(f.varint) }
+func (f protoField) bool() bool   { return f.varint != 0 }
+
+// decodeProto calls fn with each field of a message in the protobuf wire format. Fixed
+// width fields, which no message of the API uses, are skipped.
+func decodeProto(data []byte, fn func(protoField) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errTruncatedProto
+		}
+		data = data[n:]
+		if key>>3 > math.MaxInt32 {
+			return fmt.Errorf("invalid protobuf field number %d", key>>3)
+		}
+		field := protoField{number: int(key >> 3)}
+
+		switch key & 7 {
+		case 0:
+			if field.varint, n = binary.Uvarint(data); n <= 0 {
+				return errTruncatedProto
+			}
+			data = data[n:]
+		case 1:
+			if len(data) < 8 {
+				return errTruncatedProto
+			}
+			data = data[8:]
+			continue
+		case 2:
+			size, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < size {
+				return errTruncatedProto
+			}
+			field.data = data[n : n+int(size)]
+			data = data[n+int(size):]
+		case 5:
+			if len(data) < 4 {
+				return errTruncatedProto
+			}
+			data = data[4:]
+			continue
+		default:
+			return fmt.Errorf("unsupported protobuf wire type %d", key&7)
+		}
+
+		if err := fn(field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pbViewport is the Viewport message
+type pbViewport struct {
+	Width, Height int32
+	Mobile, Touch bool
+	Orientation   string
+}
+
+func (m *pbViewport) unmarshal(data []byte) error {
+	return decodeProto(data, func(f protoField) error {
+		switch f.number {
+		case 1:
+			m.Width = f.int32()
+		case 2:
+			m.Height = f.int32()
+		case 3:
+			m.Mobile = f.bool()
+		case 4:
+			m.Touch = f.bool()
+		case 5:
+			m.Orientation = string(f.data)
+		}
+		return nil
+	})
+}
+
+// pbCookie is the Cookie message
+type pbCookie struct {
+	Name, Value, Domain, Path string
+	Secure, HTTPOnly          bool
+}
+
+func (m *pbCookie) unmarshal(data []byte) error {
+	return decodeProto(data, func(f protoField) error {
+		switch f.number {
+		case 1:
+			m.Name = string(f.data)
+		case 2:
+			m.Value = string(f.data)
+		case 3:
+			m.Domain = string(f.data)
+		case 4:
+			m.Path = string(f.data)
+		case 5:
+			m.Secure = f.bool()
+		case 6:
+			m.HTTPOnly = f.bool()
+		}
+		return nil
+	})
+}
+
+// pbTarget is the Target message
+type pbTarget struct {
+	URL        string
+	Name       string
+	Viewports  []pbViewport
+	Delay      int32
+	Cookies    []pbCookie
+	ConfigJSON string
+}
+
+func (m *pbTarget) unmarshal(data []byte) error {
+	return decodeProto(data, func(f protoField) error {
+		switch f.number {
+		case 1:
+			m.URL = string(f.data)
+		case 2:
+			m.Name = string(f.data)
+		case 3:
+			var viewport pbViewport
+			if err := viewport.unmarshal(f.data); err != nil {
+				return err
+			}
+			m.Viewports = append(m.Viewports, viewport)
+		case 4:
+			m.Delay = f.int32()
+		case 5:
+			var cookie pbCookie
+			if err := cookie.unmarshal(f.data); err != nil {
+				return err
+			}
+			m.Cookies = append(m.Cookies, cookie)
+		case 6:
+			m.ConfigJSON = string(f.data)
+		}
+		return nil
+	})
+}
+
+// pbCaptureURLRequest is the CaptureURLRequest message
+type pbCaptureURLRequest struct {
+	Target pbTarget
+}
+
+func (m *pbCaptureURLRequest) unmarshal(data []byte) error {
+	return decodeProto(data, func(f protoField) error {
+		if f.number == 1 {
+			return m.Target.unmarshal(f.data)
+		}
+		return nil
+	})
+}
+
+// pbCaptureBatchRequest is the CaptureBatchRequest message
+type pbCaptureBatchRequest struct {
+	Targets []pbTarget
+}
+
+func (m *pbCaptureBatchRequest) unmarshal(data []byte) error {
+	return decodeProto(data, func(f protoField) error {
+		if f.number == 1 {
+			var target pbTarget
+			if err := target.unmarshal(f.data); err != nil {
+				return err
+			}
+			m.Targets = append(m.Targets, target)
+		}
+		return nil
+	})
+}
+
+// pbStreamProgressRequest is the StreamProgressRequest message
+type pbStreamProgressRequest struct {
+	BatchID string
+}
+
+func (m *pbStreamProgressRequest) unmarshal(data []byte) error {
+	return decodeProto(data, func(f protoField) error {
+		if f.number == 1 {
+			m.BatchID = string(f.data)
+		}
+		return nil
+	})
+}
+
+// pbCaptureResult is the CaptureResult message
+type pbCaptureResult struct {
+	Name, URL, Status, Error, Dir string
+	DurationMs                    int64
+}
+
+func (m *pbCaptureResult) marshal() []byte {
+	e := &protoEncoder{}
+	e.string(1, m.Name)
+	e.string(2, m.URL)
+	e.string(3, m.Status)
+	e.string(4, m.Error)
+	e.string(5, m.Dir)
+	e.int(6, m.DurationMs)
+	return e.buf
+}
+
+// pbBatch is the Batch message
+type pbBatch struct {
+	ID    string
+	Total int32
+}
+
+func (m *pbBatch) marshal() []byte {
+	e := &protoEncoder{}
+	e.string(1, m.ID)
+	e.int(2, int64(m.Total))
+	return e.buf
+}
+
+// pbProgressEvent is the ProgressEvent message
+type pbProgressEvent struct {
+	BatchID, Type    string
+	Index            int32
+	Name, URL        string
+	Result           *pbCaptureResult
+	Completed, Total int32
+}
+
+func (m *pbProgressEvent) marshal() []byte {
+	e := &protoEncoder{}
+	e.string(1, m.BatchID)
+	e.string(2, m.Type)
+	e.int(3, int64(m.Index))
+	e.string(4, m.Name)
+	e.string(5, m.URL)
+	if m.Result != nil {
+		e.bytes(6, m.Result.marshal())
+	}
+	e.int(7, int64(m.Completed))
+	e.int(8, int64(m.Total))
+	return e.buf
+}
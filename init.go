@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"screenshot-tool/config"
+)
+
+// Viewport presets offered by the init wizard
+var initViewportPresets = map[string]config.Viewport{
+	"desktop": {Width: 1920, Height: 1080},
+	"laptop":  {Width: 1366, Height: 768},
+	"tablet":  {Width: 768, Height: 1024, Mobile: true, Touch: true},
+	"mobile":  {Width: 375, Height: 667, Mobile: true, Touch: true},
+}
+
+// starterConfig is the configuration written by the init wizard, holding only what it asks for
+type starterConfig struct {
+	URLs             []config.URLConfig `json:"urls"`
+	DefaultViewports []config.Viewport  `json:"defaultViewports"`
+	OutputDir        string             `json:"outputDir"`
+	FileFormat       string             `json:"fileFormat"`
+	Concurrency      int                `json:"concurrency"`
+}
+
+// runInit implements the init command, which asks for the URLs, viewports, output
+// directory and Chrome mode of a first configuration and writes it
+func runInit(args []string) {
+	flags := flag.NewFlagSet("init", flag.ExitOnError)
+	configPath := flags.String("config", "config.json", "Path of the configuration file to write")
+	force := flags.Bool("force", false, "Overwrite the configuration file if it exists")
+	flags.Parse(args)
+
+	if _, err := os.Stat(*configPath); err == nil && !*force {
+		log.Fatalf("%s already exists, use -force to overwrite it", *configPath)
+	}
+
+	wizard := &initWizard{in: bufio.NewReader(os.Stdin), out: os.Stdout}
+	fmt.Fprintf(wizard.out, "This creates %s. Press Enter to accept the default in brackets.\n\n", *configPath)
+
+	starter, chromeMode, err := wizard.run()
+	if err != nil {
+		log.Fatalf("Failed to create configuration: %v", err)
+	}
+
+	data, err := json.MarshalIndent(starter, "", "  ")
+	if err != nil {
+		log.Fatalf("Failed to create configuration: %v", err)
+	}
+	if err := os.WriteFile(*configPath, append(data, '\n'), 0644); err != nil {
+		log.Fatalf("Failed to write %s: %v", *configPath, err)
+	}
+
+	// The wizard only writes valid values, so this catches mistakes in the wizard itself
+	if _, diagnostics := config.Diagnose(*configPath); len(diagnostics) > 0 {
+		for _, d := range diagnostics {
+			fmt.Fprintln(wizard.out, d)
+		}
+	}
+
+	fmt.Fprintf(wizard.out, "\nWrote %s with %d URLs and %d viewports. To capture them, run:\n\n", *configPath, len(starter.URLs), len(starter.DefaultViewports))
+	fmt.Fprintf(wizard.out, "  %s -config=%s -chrome=%s\n\n", os.Args[0], *configPath, chromeMode)
+	fmt.Fprintf(wizard.out, "Check the configuration after editing it with: %s validate -config=%s\n", os.Args[0], *configPath)
+}
+
+// initWizard asks the questions of the init command
+type initWizard struct {
+	in  *bufio.Reader
+	out io.Writer
+	eof bool // Input ended, so the remaining questions take their defaults
+}
+
+// run asks for each part of the configuration in turn
+func (w *initWizard) run() (*starterConfig, string, error) {
+	starter := &starterConfig{FileFormat: "png", Concurrency: 2}
+
+	fmt.Fprintln(w.out, "Enter the URLs to capture, one per line, and an empty line when done.")
+	names := make(map[string]bool)
+	for {
+		raw := w.ask(fmt.Sprintf("URL %d", len(starter.URLs)+1), "")
+		if raw == "" {
+			if len(starter.URLs) > 0 {
+				break
+			}
+			if w.eof {
+				return nil, "", errors.New("no URLs entered")
+			}
+			fmt.Fprintln(w.out, "  At least one URL is needed.")
+			continue
+		}
+		if !strings.Contains(raw, "://") {
+			raw = "https://" + raw
+		}
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fmt.Fprintf(w.out, "  %s is not an http or https URL.\n", raw)
+			continue
+		}
+
+		name := w.ask("  Name", config.PageNameFromURL(raw))
+		for base, i := name, 2; names[name]; i++ {
+			name = fmt.Sprintf("%s-%d", base, i)
+		}
+		names[name] = true
+		starter.URLs = append(starter.URLs, config.URLConfig{Name: name, URL: raw})
+	}
+
+	fmt.Fprintln(w.out, "\nViewports are presets (desktop 1920x1080, laptop 1366x768, tablet 768x1024,")
+	fmt.Fprintln(w.out, "mobile 375x667) or sizes such as 1280x800, separated by commas.")
+	for {
+		viewports, err := parseInitViewports(w.ask("Viewports", "desktop,mobile"))
+		if err == nil {
+			starter.DefaultViewports = viewports
+			break
+		}
+		fmt.Fprintf(w.out, "  %v\n", err)
+		if w.eof {
+			return nil, "", err
+		}
+	}
+
+	starter.OutputDir = w.ask("\nOutput directory", "./screenshots")
+
+	chromeMode := ""
+	for chromeMode == "" {
+		switch mode := w.ask("Chrome mode (auto, local or docker)", "auto"); mode {
+		case "auto", "local", "docker":
+			chromeMode = mode
+		default:
+			fmt.Fprintf(w.out, "  %s is not auto, local or docker.\n", mode)
+			if w.eof {
+				return nil, "", fmt.Errorf("invalid chrome mode: %s", mode)
+			}
+		}
+	}
+	return starter, chromeMode, nil
+}
+
+// ask prints a question with its default and returns the trimmed answer, or the default
+// if the answer is empty
+func (w *initWizard) ask(question, defaultValue string) string {
+	if defaultValue != "" {
+		fmt.Fprintf(w.out, "%s [%s]: ", question, defaultValue)
+	} else {
+		fmt.Fprintf(w.out, "%s: ", question)
+	}
+	if w.eof {
+		fmt.Fprintln(w.out)
+		return defaultValue
+	}
+
+	line, err := w.in.ReadString('\n')
+	if err != nil {
+		w.eof = true
+		fmt.Fprintln(w.out)
+	}
+	if answer := strings.TrimSpace(line); answer != "" {
+		return answer
+	}
+	return defaultValue
+}
+
+// parseInitViewports parses a comma-separated list of viewport presets and sizes
+func parseInitViewports(list string) ([]config.Viewport, error) {
+	var viewports []config.Viewport
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if preset, ok := initViewportPresets[entry]; ok {
+			viewports = append(viewports, preset)
+			continue
+		}
+
+		width, height, ok := strings.Cut(entry, "x")
+		w, errW := strconv.Atoi(width)
+		h, errH := strconv.Atoi(height)
+		if !ok || errW != nil || errH != nil || w <= 0 || h <= 0 {
+			return nil, fmt.Errorf("%s is neither a preset nor a size such as 1280x800", entry)
+		}
+		viewports = append(viewports, config.Viewport{Width: w, Height: h})
+	}
+	if len(viewports) == 0 {
+		return nil, errors.New("at least one viewport is needed")
+	}
+	return viewports, nil
+}
@@ -0,0 +1,144 @@
+// Package testserver serves synthetic pages that exercise the tricky parts of
+// capturing real sites: lazy loading, cookie banners, redirects, very tall
+// pages and strict Content Security Policies. It is used by the selftest command.
+package testserver
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+)
+
+// Page paths served by the test server
+const (
+	PathBasic         = "/basic"
+	PathLazy          = "/lazy"
+	PathCookieBanner  = "/cookie-banner"
+	PathRedirect      = "/redirect"
+	PathRedirectFinal = "/redirect/final"
+	PathTall          = "/tall"
+	PathCSP           = "/csp"
+	PathLazyImage     = "/lazy-image/" // Followed by the image number
+)
+
+// Layout details the selftest checks against
+const (
+	TallHeight    = 12000     // Height of the tall page in pixels
+	LazyImages    = 6         // Number of lazily loaded images
+	ConsentCookie = "consent" // Cookie that hides the cookie banner when set to "yes"
+	BannerColor   = "#e00000" // Background of the cookie banner
+	MaskedElement = "#clock"  // Element on the basic page that changes on every load
+	MaskedX       = 100       // Left edge of the masked element
+	MaskedY       = 100       // Top edge of the masked element
+	MaskedSize    = 80        // Width and height of the masked element
+)
+
+// Server is a running test server
+type Server struct {
+	*httptest.Server
+}
+
+// Start starts a test server on a local port
+func Start() *Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc(PathBasic, handleBasic)
+	mux.HandleFunc(PathLazy, handleLazy)
+	mux.HandleFunc(PathLazyImage, handleLazyImage)
+	mux.HandleFunc(PathCookieBanner, handleCookieBanner)
+	mux.HandleFunc(PathRedirect, func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, PathRedirectFinal, http.StatusFound)
+	})
+	mux.HandleFunc(PathRedirectFinal, func(w http.ResponseWriter, r *http.Request) {
+		writePage(w, "Redirect target", `<h1 id="final">Redirected</h1>`)
+	})
+	mux.HandleFunc(PathTall, handleTall)
+	mux.HandleFunc(PathCSP, handleCSP)
+
+	return &Server{Server: httptest.NewServer(mux)}
+}
+
+// PageURL returns the absolute URL of a page
+func (s *Server) PageURL(path string) string {
+	return s.URL + path
+}
+
+// writePage writes a complete HTML page
+func writePage(w http.ResponseWriter, title, body string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>%s</title>
+<style>body { margin: 0; font-family: sans-serif; background: #fff; }</style>
+</head>
+<body>
+%s
+</body>
+</html>`, title, body)
+}
+
+// handleBasic serves a short page with an element whose content changes on every load
+func handleBasic(w http.ResponseWriter, r *http.Request) {
+	writePage(w, "Basic", fmt.Sprintf(`<h1>Basic page</h1>
+<div id="clock" style="position: absolute; left: %dpx; top: %dpx; width: %dpx; height: %dpx; background: #ffd800;"></div>
+<script>document.getElementById('clock').textContent = new Date().toISOString();</script>`,
+		MaskedX, MaskedY, MaskedSize, MaskedSize))
+}
+
+// handleLazy serves a page whose images only load once scrolled into view
+func handleLazy(w http.ResponseWriter, r *http.Request) {
+	var body strings.Builder
+	body.WriteString(`<h1>Lazy loading</h1>`)
+	for i := 1; i <= LazyImages; i++ {
+		fmt.Fprintf(&body, `<div style="height: 900px"><img class="lazy" data-src="%s%d" width="400" height="300" alt="image %d"></div>`, PathLazyImage, i, i)
+	}
+	body.WriteString(`<script>
+const observer = new IntersectionObserver((entries) => {
+	for (const entry of entries) {
+		if (entry.isIntersecting) {
+			entry.target.src = entry.target.dataset.src;
+			observer.unobserve(entry.target);
+		}
+	}
+});
+document.querySelectorAll('img.lazy').forEach((img) => observer.observe(img));
+</script>`)
+	writePage(w, "Lazy loading", body.String())
+}
+
+// handleLazyImage serves a generated SVG image
+func handleLazyImage(w http.ResponseWriter, r *http.Request) {
+	n, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, PathLazyImage))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "image/svg+xml")
+	fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="400" height="300"><rect width="400" height="300" fill="hsl(%d, 70%%, 50%%)"/><text x="20" y="160" font-size="48" fill="#fff">Image %d</text></svg>`, n*60, n)
+}
+
+// handleCookieBanner serves a page covered by a consent banner until the consent cookie is set
+func handleCookieBanner(w http.ResponseWriter, r *http.Request) {
+	banner := fmt.Sprintf(`<div id="cookie-banner" style="position: fixed; top: 0; left: 0; right: 0; height: 120px; background: %s; color: #fff;">We use cookies</div>`, BannerColor)
+	if cookie, err := r.Cookie(ConsentCookie); err == nil && cookie.Value == "yes" {
+		banner = ""
+	}
+	writePage(w, "Cookie banner", banner+`<h1 style="margin-top: 200px">Content behind the banner</h1>`)
+}
+
+// handleTall serves a page much taller than any viewport
+func handleTall(w http.ResponseWriter, r *http.Request) {
+	var body strings.Builder
+	for y := 0; y < TallHeight; y += 1000 {
+		fmt.Fprintf(&body, `<div style="height: 1000px; background: hsl(%d, 60%%, 80%%)">%dpx</div>`, (y/1000)*30, y)
+	}
+	writePage(w, "Tall page", body.String())
+}
+
+// handleCSP serves a page with a strict Content Security Policy that blocks inline scripts
+func handleCSP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'self'; style-src 'self' 'unsafe-inline'")
+	writePage(w, "Content Security Policy", `<h1>Strict CSP</h1>
+<script>document.body.insertAdjacentHTML('beforeend', '<p id="inline-ran">Inline script ran</p>');</script>`)
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"screenshot-tool/config"
+	"screenshot-tool/delivery"
+	"screenshot-tool/screenshot"
+)
+
+// failureStreak tracks the consecutive failed scheduled runs of a URL and the issue filed for it
+type failureStreak struct {
+	Failures int             `json:"failures"`
+	Issue    *delivery.Issue `json:"issue,omitempty"`
+}
+
+// issueHook returns a callback that files an issue for each URL of a schedule that
+// failed issues.after consecutive runs and comments on it while the URL keeps failing,
+// or nil if issue filing isn't configured. The streaks are kept in the schedule's directory.
+func issueHook(ctx context.Context, cfg *config.Config, schedule config.Schedule) func(*screenshot.RunSummary) {
+	if cfg.Issues == nil {
+		return nil
+	}
+
+	tracker, err := delivery.NewIssueTracker(*cfg.Issues)
+	if err != nil {
+		log.Fatalf("Failed to set up issue filing: %v", err)
+	}
+
+	statePath := filepath.Join(cfg.OutputDir, schedule.Name, ".issues.json")
+	return func(summary *screenshot.RunSummary) {
+		streaks := loadFailureStreaks(statePath)
+		ctx := context.WithoutCancel(ctx)
+
+		for _, result := range summary.URLs {
+			streak := streaks[result.Name]
+
+			if result.Status != "failed" && result.Status != "quarantined" {
+				if streak != nil && streak.Issue != nil {
+					body := fmt.Sprintf("%s was captured successfully again in run `%s`.", result.Name, summary.OutputDir)
+					if err := tracker.Comment(ctx, streak.Issue.Number, body); err != nil {
+						log.Printf("Warning: Failed to comment on issue %s: %v", streak.Issue.URL, err)
+					}
+				}
+				delete(streaks, result.Name)
+				continue
+			}
+
+			if streak == nil {
+				streak = &failureStreak{}
+				streaks[result.Name] = streak
+			}
+			streak.Failures++
+			if streak.Failures < cfg.Issues.After {
+				continue
+			}
+
+			// An issue closed while the URL still fails is replaced by a new one
+			if streak.Issue != nil {
+				open, err := tracker.IsOpen(ctx, streak.Issue.Number)
+				if err != nil {
+					log.Printf("Warning: Failed to check issue %s: %v", streak.Issue.URL, err)
+					continue
+				}
+				if !open {
+					streak.Issue = nil
+				}
+			}
+
+			details := failureDetails(ctx, tracker, summary, result)
+			if streak.Issue != nil {
+				body := fmt.Sprintf("Still failing after %d consecutive scheduled runs.\n\n%s", streak.Failures, details)
+				if err := tracker.Comment(ctx, streak.Issue.Number, body); err != nil {
+					log.Printf("Warning: Failed to comment on issue %s: %v", streak.Issue.URL, err)
+				}
+				continue
+			}
+
+			title := fmt.Sprintf("Capture of %s keeps failing in schedule %s", result.Name, schedule.Name)
+			body := fmt.Sprintf("The capture of %s (%s) failed %d consecutive runs of schedule `%s`.\n\n%s",
+				result.Name, result.URL, streak.Failures, schedule.Name, details)
+			issue, err := tracker.Create(ctx, title, body)
+			if err != nil {
+				// The streak is kept, so filing is retried after the next failed run
+				log.Printf("ERROR: Failed to file issue for %s in %s: %v", result.Name, tracker.Target(), err)
+				continue
+			}
+			streak.Issue = &issue
+			log.Printf("Filed issue %s for %s after %d consecutive failed runs", issue.URL, result.Name, streak.Failures)
+		}
+
+		if err := saveFailureStreaks(statePath, streaks); err != nil {
+			log.Printf("Warning: Failed to save failure streaks of schedule %s: %v", schedule.Name, err)
+		}
+	}
+}
+
+// failureDetails describes the failure of a URL in Markdown, attaching the diagnostic
+// screenshots if the tracker supports uploads
+func failureDetails(ctx context.Context, tracker delivery.IssueTracker, summary *screenshot.RunSummary, result screenshot.URLResult) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "**Run:** `%s`\n\n**Error:** `%s`\n", summary.OutputDir, result.Error)
+
+	if result.Failure == "" {
+		return b.String()
+	}
+
+	report, data, err := loadFailureReport(summary, result)
+	if err != nil {
+		return b.String()
+	}
+
+	urlDir := filepath.Join(summary.OutputDir, result.Dir)
+	for _, viewport := range report.Viewports {
+		fmt.Fprintf(&b, "\n### %dx%d\n\n", viewport.Width, viewport.Height)
+		fmt.Fprintf(&b, "- Stage: %s\n", viewport.Stage)
+		if viewport.LastURL != "" {
+			fmt.Fprintf(&b, "- Last URL: %s\n", viewport.LastURL)
+		}
+		for _, message := range viewport.Errors {
+			fmt.Fprintf(&b, "- `%s`\n", message)
+		}
+
+		if viewport.Screenshot != "" {
+			screenshotPath := filepath.Join(urlDir, filepath.FromSlash(viewport.Screenshot))
+			markdown, err := tracker.Attach(ctx, screenshotPath)
+			if err != nil {
+				log.Printf("Warning: Failed to attach %s to issue: %v", screenshotPath, err)
+			}
+			if markdown != "" {
+				fmt.Fprintf(&b, "\n%s\n", markdown)
+			} else {
+				fmt.Fprintf(&b, "\nDiagnostic screenshot: `%s`\n", screenshotPath)
+			}
+		}
+
+		if len(viewport.Console) > 0 {
+			fmt.Fprintf(&b, "\n<details><summary>Console (last %d messages)</summary>\n\n```\n%s\n```\n\n</details>\n",
+				len(viewport.Console), strings.Join(viewport.Console, "\n"))
+		}
+	}
+
+	fmt.Fprintf(&b, "\n<details><summary>failure.json</summary>\n\n```json\n%s\n```\n\n</details>\n", strings.TrimSpace(string(data)))
+	return b.String()
+}
+
+// loadFailureStreaks reads the failure streaks of a schedule, returning none if there are none
+func loadFailureStreaks(path string) map[string]*failureStreak {
+	streaks := make(map[string]*failureStreak)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return streaks
+	}
+	if err := json.Unmarshal(data, &streaks); err != nil {
+		log.Printf("Warning: Ignoring unreadable failure streaks: %v", err)
+		return make(map[string]*failureStreak)
+	}
+	return streaks
+}
+
+// saveFailureStreaks writes the failure streaks of a schedule
+func saveFailureStreaks(path string, streaks map[string]*failureStreak) error {
+	data, err := json.MarshalIndent(streaks, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
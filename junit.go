@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"screenshot-tool/screenshot"
+)
+
+// junitTestSuites is the root element of a JUnit XML report
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+// junitTestSuite holds the test cases of a URL
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Errors     int             `xml:"errors,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Time       string          `xml:"time,attr"`
+	Timestamp  string          `xml:"timestamp,attr,omitempty"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	Cases      []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// junitTestCase is the capture of a viewport or its comparison with the baseline
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"` // The capture didn't match its baseline
+	Error     *junitMessage `xml:"error,omitempty"`   // The capture failed
+	Skipped   *junitMessage `xml:"skipped,omitempty"` // No baseline, or the URL is quarantined
+	SystemOut *junitOutput  `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Details string `xml:",cdata"`
+}
+
+type junitOutput struct {
+	Text string `xml:",cdata"`
+}
+
+// writeJUnit writes a JUnit XML report of a run to path, so CI servers can show the run as
+// test results. Each URL is a test suite with a test case for the capture of each viewport
+// and one for its comparison with the baseline, if it was compared. Images that show what
+// went wrong are attached to failed test cases in the format GitLab understands.
+func writeJUnit(path string, summary *screenshot.RunSummary) error {
+	report := junitTestSuites{
+		Name: "screenshot-tool " + summary.Run,
+		Time: junitSeconds(summary.FinishedAt.Sub(summary.StartedAt)),
+	}
+	if summary.Label != "" {
+		report.Name += " " + summary.Label
+	}
+
+	for _, result := range summary.URLs {
+		suite := junitURLSuite(summary.OutputDir, result)
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+		report.Errors += suite.Errors
+		report.Skipped += suite.Skipped
+		report.Suites = append(report.Suites, suite)
+	}
+
+	data, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append([]byte(xml.Header), append(data, '\n')...), 0644)
+}
+
+// junitURLSuite returns the test suite of a captured URL. A URL without a manifest,
+// whose capture failed before any viewport was captured, has a single failed test case.
+func junitURLSuite(outputDir string, result screenshot.URLResult) junitTestSuite {
+	suite := junitTestSuite{
+		Name:       result.Name,
+		Time:       junitSeconds(0),
+		Properties: []junitProperty{{Name: "url", Value: result.URL}},
+	}
+	if result.Dir != "" {
+		suite.Properties = append(suite.Properties, junitProperty{Name: "dir", Value: result.Dir})
+	}
+
+	urlDir := filepath.Join(outputDir, filepath.FromSlash(result.Dir))
+	manifest, err := readManifest(urlDir)
+	if result.Dir == "" || err != nil {
+		message := result.Error
+		if message == "" && err != nil {
+			message = fmt.Sprintf("failed to read manifest: %v", err)
+		}
+		suite.Cases = []junitTestCase{{
+			Name:      "capture",
+			ClassName: result.Name,
+			Error:     &junitMessage{Message: firstLine(message), Type: "capture", Details: message},
+		}}
+	} else {
+		suite.Time = junitSeconds(manifest.FinishedAt.Sub(manifest.StartedAt))
+		suite.Timestamp = manifest.StartedAt.UTC().Format("2006-01-02T15:04:05")
+		for _, vm := range manifest.Viewports {
+			suite.Cases = append(suite.Cases, junitViewportCases(urlDir, result.Name, vm)...)
+		}
+	}
+
+	for i := range suite.Cases {
+		testCase := &suite.Cases[i]
+
+		// Failures of quarantined URLs don't fail the run, so they don't fail the report either
+		if result.Status == "quarantined" {
+			for _, m := range []*junitMessage{testCase.Failure, testCase.Error} {
+				if m != nil {
+					testCase.Skipped = &junitMessage{Message: "quarantined: " + m.Message}
+				}
+			}
+			testCase.Failure, testCase.Error = nil, nil
+		}
+
+		suite.Tests++
+		switch {
+		case testCase.Failure != nil:
+			suite.Failures++
+		case testCase.Error != nil:
+			suite.Errors++
+		case testCase.Skipped != nil:
+			suite.Skipped++
+		}
+	}
+	return suite
+}
+
+// junitViewportCases returns the test cases of a viewport: its capture, and its comparison
+// with the baseline if it was compared
+func junitViewportCases(urlDir, name string, vm *screenshot.ViewportManifest) []junitTestCase {
+	viewportName := fmt.Sprintf("%dx%d", vm.Width, vm.Height)
+	viewportDir := filepath.Join(urlDir, viewportName)
+
+	capture := junitTestCase{Name: "capture " + viewportName, ClassName: name}
+	comparisonFailed := vm.Failure != nil && vm.Failure.Stage == "baseline comparison"
+	if vm.Failure != nil && !comparisonFailed {
+		capture.Error = junitFailure(vm.Failure)
+		if vm.Failure.Screenshot != "" {
+			capture.SystemOut = junitAttachments(filepath.Join(viewportDir, vm.Failure.Screenshot))
+		}
+	}
+	cases := []junitTestCase{capture}
+
+	if vm.Diff == nil {
+		return cases
+	}
+	comparison := junitTestCase{Name: "baseline " + viewportName, ClassName: name}
+	switch {
+	case vm.Diff.Status == "mismatch":
+		comparison.Failure = &junitMessage{
+			Message: fmt.Sprintf("capture differs from baseline %s", vm.Diff.Baseline),
+			Type:    "mismatch",
+			Details: vm.Diff.Score(),
+		}
+		if vm.Diff.Triptych != "" {
+			comparison.SystemOut = junitAttachments(filepath.Join(viewportDir, vm.Diff.Triptych), filepath.Join(viewportDir, vm.Diff.Heatmap))
+		}
+	case vm.Diff.Status == "missing":
+		comparison.Skipped = &junitMessage{Message: fmt.Sprintf("no baseline at %s", vm.Diff.Baseline)}
+	case comparisonFailed:
+		comparison.Error = junitFailure(vm.Failure)
+	}
+	return append(cases, comparison)
+}
+
+// junitFailure describes a failed viewport as a test case error
+func junitFailure(failure *screenshot.ViewportFailure) *junitMessage {
+	m := &junitMessage{Type: failure.Stage, Details: strings.Join(failure.Errors, "\n")}
+	if len(failure.Errors) > 0 {
+		m.Message = failure.Errors[0]
+	}
+	if failure.LastURL != "" {
+		m.Details += "\nLast URL: " + failure.LastURL
+	}
+	return m
+}
+
+// junitAttachments returns the output that attaches files to a test case in GitLab
+func junitAttachments(paths ...string) *junitOutput {
+	var lines []string
+	for _, path := range paths {
+		lines = append(lines, "[[ATTACHMENT|"+filepath.ToSlash(path)+"]]")
+	}
+	return &junitOutput{Text: strings.Join(lines, "\n")}
+}
+
+// junitSeconds formats a duration as the seconds of a JUnit time attribute
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", max(d, 0).Seconds())
+}
+
+// firstLine returns the first line of s
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
@@ -0,0 +1,473 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"screenshot-tool/config"
+	"screenshot-tool/screenshot"
+)
+
+// kubeRunLabel labels the Kubernetes objects of a distributed run with the run's name
+const kubeRunLabel = "screenshot-tool/run"
+
+// kubeOutputDir is where the volume claim is mounted in the worker pods
+const kubeOutputDir = "/output"
+
+// shardSummaryFile is the run summary a shard worker writes to its shard directory
+const shardSummaryFile = "summary.json"
+
+// kubePollInterval is how often the progress of the workers is checked
+const kubePollInterval = 15 * time.Second
+
+// writeShardSummary saves the summary of a shard for the kube command to merge
+func writeShardSummary(shardDir string, summary *screenshot.RunSummary) {
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err == nil {
+		err = os.WriteFile(filepath.Join(shardDir, shardSummaryFile), data, 0644)
+	}
+	if err != nil {
+		log.Printf("ERROR: Failed to write shard summary: %v", err)
+	}
+}
+
+// kubectl runs kubectl in the configured context and namespace and returns its output.
+// stdin, if not nil, is passed to the command.
+func kubectl(k *config.Kubernetes, stdin []byte, args ...string) ([]byte, error) {
+	base := []string{"--namespace", k.Namespace}
+	if k.Context != "" {
+		base = append(base, "--context", k.Context)
+	}
+	cmd := exec.Command("kubectl", append(base, args...)...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("kubectl %s failed: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return output, nil
+}
+
+func runKube(args []string) {
+	flags := flag.NewFlagSet("kube", flag.ExitOnError)
+	configPath := flags.String("config", "config.json", "Path to configuration file")
+	label := flags.String("label", "", "Label of the run, e.g. a release or ticket, added to the directory names, manifests and notifications")
+	timeout := flags.Duration("timeout", 6*time.Hour, "How long to wait for the workers to finish")
+	keep := flags.Bool("keep", false, "Keep the Job and the shard output on the volume after collecting the run")
+	dryRun := flags.Bool("dry-run", false, "Print the Kubernetes objects of the run without creating them")
+	ci := flags.Bool("ci", false, "Exit with 1 if a capture failed or 3 if captures only mismatched their baselines, and print a JSON summary as the last line of stderr")
+	flags.Parse(args)
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	k := cfg.Kubernetes
+	if k == nil {
+		log.Fatalf("No Kubernetes workers configured, add a kubernetes object to the configuration")
+	}
+	cfg.ChromeMode = "local"
+	cfg.Label = strings.TrimSpace(*label)
+	logConfigWarnings(cfg)
+
+	if len(cfg.URLs) == 0 {
+		log.Fatalf("No URLs to process")
+	}
+	shards := min(k.Shards, len(cfg.URLs))
+
+	// Workers get the configuration with its includes merged, writing below the volume claim
+	run := "screenshot-" + time.Now().Format("20060102-150405")
+	workerConfig, err := config.ResolveConfigFile(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	workerConfig["outputDir"] = kubeOutputDir + "/" + run
+	objects, err := kubeObjects(k, run, shards, cfg.Label, workerConfig)
+	if err != nil {
+		log.Fatalf("Failed to create the Kubernetes objects: %v", err)
+	}
+
+	if *dryRun {
+		os.Stdout.Write(objects)
+		fmt.Println()
+		return
+	}
+	if _, err := exec.LookPath("kubectl"); err != nil {
+		log.Fatalf("kubectl not found, it is required to run captures on Kubernetes")
+	}
+
+	// Stop the workers when interrupted, they would keep capturing otherwise
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signalChan
+		log.Printf("Received signal: %v, stopping run %s", sig, run)
+		cancel()
+	}()
+
+	startTime := time.Now()
+	if _, err := kubectl(k, objects, "create", "-f", "-"); err != nil {
+		log.Fatalf("Failed to start run %s: %v", run, err)
+	}
+	log.Printf("Started run %s: %d URLs on %d workers in namespace %s", run, len(cfg.URLs), shards, k.Namespace)
+
+	jobErr := waitForKubeJob(ctx, k, run, shards)
+	if ctx.Err() != nil {
+		if _, err := kubectl(k, nil, "delete", "job", run, "--wait=false"); err != nil {
+			log.Printf("Warning: Failed to stop the workers: %v", err)
+		}
+	}
+
+	summary, err := collectKubeRun(k, run, shards, cfg.OutputDir, *keep)
+	if err != nil {
+		log.Fatalf("Failed to collect run %s: %v", run, err)
+	}
+	summary.Label = cfg.Label
+	summary.Total = len(cfg.URLs)
+	summary.StartedAt = startTime
+	summary.FinishedAt = time.Now()
+	runErr := errors.Join(jobErr, summaryError(summary))
+	if runErr != nil {
+		summary.Status = "failed"
+		summary.Error = runErr.Error()
+	}
+
+	if !*keep {
+		if _, err := kubectl(k, nil, "delete", "job,configmap", "-l", kubeRunLabel+"="+run, "--wait=false"); err != nil {
+			log.Printf("Warning: Failed to delete the Job of run %s: %v", run, err)
+		}
+	}
+
+	// Report the merged run like a run captured on this host
+	journal, err := openJournal(cfg)
+	if err != nil {
+		log.Fatalf("Failed to open delivery journal: %v", err)
+	}
+	reportCtx := context.Background()
+	if afterRun := chainRunHooks(catalogHook(cfg), notifyHook(reportCtx, cfg, journal), alertHook(reportCtx, cfg, journal), reviewHook(reportCtx, cfg)); afterRun != nil {
+		afterRun(summary)
+	}
+
+	if *ci {
+		exitCI(summary, runErr)
+	}
+	if runErr != nil {
+		log.Printf("Run %s failed: %v", run, runErr)
+		os.Exit(1)
+	}
+	log.Printf("Run %s completed successfully in %v", run, time.Since(startTime).Round(time.Second))
+}
+
+// kubeObjects returns the ConfigMap holding the worker configuration and the indexed Job
+// running a worker per shard, as a kubectl List
+func kubeObjects(k *config.Kubernetes, run string, shards int, label string, workerConfig map[string]any) ([]byte, error) {
+	configJSON, err := json.MarshalIndent(workerConfig, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	labels := map[string]string{kubeRunLabel: run}
+
+	args := []string{
+		"-config", "/etc/screenshot-tool/config.json",
+		"-chrome", "local",
+		"-shard", "$(SHARD)/" + strconv.Itoa(shards),
+	}
+	if label != "" {
+		args = append(args, "-label", label)
+	}
+
+	container := map[string]any{
+		"name":    "worker",
+		"image":   k.Image,
+		"command": []string{"screenshot-tool"},
+		"args":    args,
+		"env": []map[string]any{{
+			"name": "SHARD",
+			"valueFrom": map[string]any{
+				"fieldRef": map[string]any{"fieldPath": "metadata.annotations['batch.kubernetes.io/job-completion-index']"},
+			},
+		}},
+		"volumeMounts": []map[string]any{
+			{"name": "config", "mountPath": "/etc/screenshot-tool", "readOnly": true},
+			{"name": "output", "mountPath": kubeOutputDir},
+			{"name": "shm", "mountPath": "/dev/shm"},
+		},
+	}
+	var envFrom []map[string]any
+	for _, secret := range k.Secrets {
+		envFrom = append(envFrom, map[string]any{"secretRef": map[string]any{"name": secret}})
+	}
+	if len(envFrom) > 0 {
+		container["envFrom"] = envFrom
+	}
+	requests := map[string]string{}
+	if k.CPU != "" {
+		requests["cpu"] = k.CPU
+	}
+	if k.Memory != "" {
+		requests["memory"] = k.Memory
+	}
+	if len(requests) > 0 {
+		container["resources"] = map[string]any{"requests": requests}
+	}
+
+	pod := map[string]any{
+		"restartPolicy":   "Never",
+		"securityContext": map[string]any{"fsGroup": 1000}, // The user of the worker image
+		"containers":      []any{container},
+		"volumes": []map[string]any{
+			{"name": "config", "configMap": map[string]any{"name": run}},
+			{"name": "output", "persistentVolumeClaim": map[string]any{"claimName": k.VolumeClaim}},
+			// Chrome needs more shared memory than the container default
+			{"name": "shm", "emptyDir": map[string]any{"medium": "Memory", "sizeLimit": "1Gi"}},
+		},
+	}
+	if k.ServiceAccount != "" {
+		pod["serviceAccountName"] = k.ServiceAccount
+	}
+
+	list := map[string]any{
+		"apiVersion": "v1",
+		"kind":       "List",
+		"items": []any{
+			map[string]any{
+				"apiVersion": "v1",
+				"kind":       "ConfigMap",
+				"metadata":   map[string]any{"name": run, "labels": labels},
+				"data":       map[string]string{"config.json": string(configJSON)},
+			},
+			map[string]any{
+				"apiVersion": "batch/v1",
+				"kind":       "Job",
+				"metadata":   map[string]any{"name": run, "labels": labels},
+				"spec": map[string]any{
+					"completionMode": "Indexed",
+					"completions":    shards,
+					"parallelism":    shards,
+					// A shard with failed captures isn't retried, its summary reports them
+					"backoffLimitPerIndex": 0,
+					"template": map[string]any{
+						"metadata": map[string]any{"labels": labels},
+						"spec":     pod,
+					},
+				},
+			},
+		},
+	}
+	return json.MarshalIndent(list, "", "  ")
+}
+
+// waitForKubeJob waits until all workers of a run finished, logging their progress.
+// It returns an error if a worker failed or ctx ended first.
+func waitForKubeJob(ctx context.Context, k *config.Kubernetes, run string, shards int) error {
+	reported := ""
+	for {
+		output, err := kubectl(k, nil, "get", "job", run, "-o", "json")
+		if err != nil {
+			log.Printf("Warning: Failed to check the workers: %v", err)
+		} else {
+			var job struct {
+				Status struct {
+					Active     int `json:"active"`
+					Succeeded  int `json:"succeeded"`
+					Failed     int `json:"failed"`
+					Conditions []struct {
+						Type   string `json:"type"`
+						Status string `json:"status"`
+					} `json:"conditions"`
+				} `json:"status"`
+			}
+			if err := json.Unmarshal(output, &job); err != nil {
+				return fmt.Errorf("failed to parse the Job status: %w", err)
+			}
+
+			status := job.Status
+			progress := fmt.Sprintf("%d of %d workers finished, %d running", status.Succeeded+status.Failed, shards, status.Active)
+			if status.Failed > 0 {
+				progress += fmt.Sprintf(", %d failed", status.Failed)
+			}
+			if progress != reported {
+				log.Printf("Run %s: %s", run, progress)
+				reported = progress
+			}
+
+			for _, condition := range status.Conditions {
+				if condition.Status != "True" {
+					continue
+				}
+				switch condition.Type {
+				case "Complete":
+					return nil
+				case "Failed":
+					return fmt.Errorf("%d of %d workers failed", status.Failed, shards)
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("workers did not finish: %w", ctx.Err())
+		case <-time.After(kubePollInterval):
+		}
+	}
+}
+
+// collectKubeRun copies the shard directories of a run from the volume claim through a
+// helper pod, moves their URL directories and run logs into outputDir and merges the
+// shard summaries, leaving the total to the caller. Unless keep is set, the shard directories are removed from the volume.
+func collectKubeRun(k *config.Kubernetes, run string, shards int, outputDir string, keep bool) (*screenshot.RunSummary, error) {
+	pod := run + "-collect"
+	collector := map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata":   map[string]any{"name": pod, "labels": map[string]string{kubeRunLabel: run}},
+		"spec": map[string]any{
+			"restartPolicy":   "Never",
+			"securityContext": map[string]any{"fsGroup": 1000},
+			"containers": []map[string]any{{
+				"name":         "collect",
+				"image":        k.Image,
+				"command":      []string{"sleep", "86400"},
+				"volumeMounts": []map[string]any{{"name": "output", "mountPath": kubeOutputDir}},
+			}},
+			"volumes": []map[string]any{
+				{"name": "output", "persistentVolumeClaim": map[string]any{"claimName": k.VolumeClaim}},
+			},
+		},
+	}
+	manifest, err := json.Marshal(collector)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := kubectl(k, manifest, "create", "-f", "-"); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if _, err := kubectl(k, nil, "delete", "pod", pod, "--wait=false"); err != nil {
+			log.Printf("Warning: Failed to delete collector pod %s: %v", pod, err)
+		}
+	}()
+	if _, err := kubectl(k, nil, "wait", "--for=condition=Ready", "pod/"+pod, "--timeout=5m"); err != nil {
+		return nil, err
+	}
+
+	staging := filepath.Join(outputDir, "."+run)
+	defer os.RemoveAll(staging)
+	log.Printf("Copying the captures of run %s", run)
+	if _, err := kubectl(k, nil, "cp", pod+":"+kubeOutputDir+"/"+run, staging); err != nil {
+		return nil, err
+	}
+
+	summary := &screenshot.RunSummary{
+		Run:       run,
+		Kind:      "capture",
+		Status:    "passed",
+		OutputDir: outputDir,
+	}
+	for shard := 0; shard < shards; shard++ {
+		shardDir := filepath.Join(staging, fmt.Sprintf("shard-%d", shard))
+		if err := moveShard(shardDir, outputDir, fmt.Sprintf("%s-shard-%d.log", run, shard)); err != nil {
+			return nil, fmt.Errorf("shard %d: %w", shard, err)
+		}
+
+		data, err := os.ReadFile(filepath.Join(shardDir, shardSummaryFile))
+		if err != nil {
+			log.Printf("ERROR: Shard %d of run %s did not finish: %v", shard, run, err)
+			summary.Status = "failed"
+			continue
+		}
+		var shardSummary screenshot.RunSummary
+		if err := json.Unmarshal(data, &shardSummary); err != nil {
+			return nil, fmt.Errorf("shard %d: failed to parse summary: %w", shard, err)
+		}
+		mergeRunSummary(summary, &shardSummary)
+	}
+	sort.SliceStable(summary.URLs, func(i, j int) bool { return summary.URLs[i].Index < summary.URLs[j].Index })
+
+	if !keep {
+		if _, err := kubectl(k, nil, "exec", pod, "--", "rm", "-rf", kubeOutputDir+"/"+run); err != nil {
+			log.Printf("Warning: Failed to remove the shard directories of run %s from the volume: %v", run, err)
+		}
+	}
+	log.Printf("Collected %d URLs of run %s into %s", len(summary.URLs), run, outputDir)
+	return summary, nil
+}
+
+// moveShard moves the URL directories of a shard directory into outputDir, and its run
+// log to logName
+func moveShard(shardDir, outputDir, logName string) error {
+	entries, err := os.ReadDir(shardDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil // The worker failed before it started capturing
+		}
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		switch {
+		case entry.IsDir() && !strings.HasPrefix(name, "."):
+			if _, err := os.Stat(filepath.Join(shardDir, name, "manifest.json")); err != nil {
+				continue
+			}
+			if err := os.Rename(filepath.Join(shardDir, name), filepath.Join(outputDir, name)); err != nil {
+				return err
+			}
+		case name == "run.log":
+			if err := os.Rename(filepath.Join(shardDir, name), filepath.Join(outputDir, logName)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// mergeRunSummary adds the URLs and totals of a shard's summary to the run summary
+func mergeRunSummary(summary, shard *screenshot.RunSummary) {
+	summary.Passed += shard.Passed
+	summary.Failed += shard.Failed
+	summary.Quarantined += shard.Quarantined
+	summary.BytesDownloaded += shard.BytesDownloaded
+	summary.ArtifactBytes += shard.ArtifactBytes
+	summary.URLs = append(summary.URLs, shard.URLs...)
+	if shard.Status != "passed" {
+		summary.Status = "failed"
+	}
+	if shard.Cost != nil {
+		if summary.Cost == nil {
+			summary.Cost = &screenshot.CostEstimate{Currency: shard.Cost.Currency}
+		}
+		summary.Cost.Transfer += shard.Cost.Transfer
+		summary.Cost.Storage += shard.Cost.Storage
+		summary.Cost.Total += shard.Cost.Total
+	}
+}
+
+// summaryError returns an error if URLs of the merged summary of a run failed or weren't
+// captured, e.g. because their worker crashed
+func summaryError(summary *screenshot.RunSummary) error {
+	failed := summary.Total - summary.Passed - summary.Quarantined
+	if failed == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d of %d URLs failed or weren't captured", failed, summary.Total)
+}
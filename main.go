@@ -3,10 +3,13 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
 	"os/signal"
+	"path/filepath"
 	"strings"
 	"syscall"
 	"time"
@@ -15,27 +18,28 @@ import (
 	"screenshot-tool/screenshot"
 )
 
-// cleanupDockerContainer stops the chrome docker container if it was started by this app
+// cleanupDockerContainer stops the chrome docker container and the containers of the
+// Docker Chrome pool if they were started by this app
 func cleanupDockerContainer() {
 	// Check if docker is installed
 	if _, err := exec.LookPath("docker"); err != nil {
 		return
 	}
 
-	// Check if chrome container is running
-	cmd := exec.Command("docker", "ps", "-q", "-f", "name=chrome", "-f", "status=running")
+	// Check if chrome containers are running
+	cmd := exec.Command("docker", "ps", "-q", "-f", "name=^chrome(-[0-9]+)?$", "-f", "status=running")
 	output, err := cmd.Output()
 	if err != nil || len(output) == 0 {
 		return
 	}
 
-	log.Println("Stopping Chrome Docker container...")
-	cmd = exec.Command("docker", "stop", "chrome")
+	log.Println("Stopping Chrome Docker containers...")
+	cmd = exec.Command("docker", append([]string{"stop"}, strings.Fields(string(output))...)...)
 	if err := cmd.Run(); err != nil {
-		log.Printf("Failed to stop Chrome container: %v", err)
+		log.Printf("Failed to stop Chrome containers: %v", err)
 		return
 	}
-	log.Println("Chrome Docker container stopped")
+	log.Println("Chrome Docker containers stopped")
 }
 
 // extractDomain extracts a domain name from a URL for use as a default name
@@ -65,16 +69,135 @@ func extractDomain(url string) string {
 	return url
 }
 
+// readURLList reads newline-separated URLs from a file, or from stdin if path is "-".
+// Blank lines and lines starting with # are ignored.
+func readURLList(path string) ([]string, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var urls []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+	return urls, nil
+}
+
 func main() {
+	// Dispatch subcommands before parsing the capture flags
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "flush":
+			runFlush(os.Args[2:])
+			return
+		case "serve":
+			runServe(os.Args[2:])
+			return
+		case "bench":
+			runBench(os.Args[2:])
+			return
+		case "selftest":
+			runSelftest(os.Args[2:])
+			return
+		case "schedule":
+			runSchedule(os.Args[2:])
+			return
+		case "deploy":
+			runDeploy(os.Args[2:])
+			return
+		case "compare":
+			runCompare(os.Args[2:])
+			return
+		case "compare-cookies":
+			runCompareCookies(os.Args[2:])
+			return
+		case "init":
+			runInit(os.Args[2:])
+			return
+		case "validate":
+			runValidate(os.Args[2:])
+			return
+		case "report":
+			runReport(os.Args[2:])
+			return
+		case "catalog":
+			runCatalog(os.Args[2:])
+			return
+		case "baseline":
+			runBaseline(os.Args[2:])
+			return
+		case "kube":
+			runKube(os.Args[2:])
+			return
+		case "enqueue":
+			runEnqueue(os.Args[2:])
+			return
+		case "worker":
+			runWorker(os.Args[2:])
+			return
+		case "dashboard":
+			runDashboard(os.Args[2:])
+			return
+		}
+	}
+
 	// Parse command line flags
 	configPath := flag.String("config", "config.json", "Path to configuration file")
-	cmdUrls := flag.String("urls", "", "Comma-separated list of URLs to capture (overrides config file URLs)")
+	cmdUrls := flag.String("urls", "", "Comma-separated list of URLs to capture, or '-' to read them from stdin (overrides config file URLs)")
+	urlsFile := flag.String("urls-file", "", "File with one URL per line to capture (overrides config file URLs)")
 	cmdUrl := flag.String("url", "", "Single URL to capture (overrides config file URLs)")
 	name := flag.String("name", "", "Name for the URL when using -url flag (defaults to domain)")
 	delay := flag.Int("delay", 0, "Delay in milliseconds for page loading when using -url flag (defaults to 1000)")
 	chromeMode := flag.String("chrome", "auto", "Chrome execution mode: 'local', 'docker', or 'auto'")
+	sitemapURL := flag.String("sitemap", "", "Sitemap URL whose pages to capture (overrides config file URLs)")
+	watch := flag.Duration("watch", 0, "Capture the URLs repeatedly at this interval until interrupted, e.g. 15m")
+	watchChanges := flag.Bool("watch-changes", false, "In watch mode, compare each iteration with the previous one and report changes")
+	dryRun := flag.Bool("dry-run", false, "Validate the configuration and print the capture plan without launching Chrome")
+	label := flag.String("label", "", "Label of the run, e.g. a release or ticket, added to the directory names, manifests and notifications")
+	archive := flag.String("archive", "", "Bundle each run into a compressed archive: 'zip' or 'tar' (.tar.gz)")
+	junit := flag.String("junit", "", "Write a JUnit XML report of the run to this file, e.g. for Jenkins or GitLab test results")
+	ci := flag.Bool("ci", false, "Exit with 1 if a capture failed or 3 if captures only mismatched their baselines, and print a JSON summary as the last line of stderr")
+	shard := flag.String("shard", "", "Capture only shard K of N of the URLs, given as K/N with K from 0, writing to shard-K of the output directory (used by the kube command)")
 	flag.Parse()
 
+	if *watch < 0 {
+		log.Fatalf("Invalid watch interval: %v", *watch)
+	}
+	if *watchChanges && *watch == 0 {
+		log.Fatalf("-watch-changes requires -watch")
+	}
+	if *ci && *watch > 0 {
+		log.Fatalf("-ci can't be used with -watch")
+	}
+	if *junit != "" && *watch > 0 {
+		log.Fatalf("-junit can't be used with -watch")
+	}
+
+	shardIndex, shardCount := 0, 0
+	if *shard != "" {
+		if _, err := fmt.Sscanf(*shard, "%d/%d", &shardIndex, &shardCount); err != nil || shardCount < 1 || shardIndex < 0 || shardIndex >= shardCount {
+			log.Fatalf("Invalid shard: %s. Must be K/N with 0 <= K < N", *shard)
+		}
+		if *watch > 0 {
+			log.Fatalf("-shard can't be used with -watch")
+		}
+	}
+
+	if _, ok := archiveExtensions[*archive]; *archive != "" && !ok {
+		log.Fatalf("Invalid archive format: %s. Must be 'zip' or 'tar'", *archive)
+	}
+
 	// Validate chrome mode flag
 	if *chromeMode != "auto" && *chromeMode != "local" && *chromeMode != "docker" {
 		log.Fatalf("Invalid chrome mode: %s. Must be 'auto', 'local', or 'docker'", *chromeMode)
@@ -90,8 +213,40 @@ func main() {
 	cfg.ChromeMode = *chromeMode
 	log.Printf("Using Chrome mode: %s", cfg.ChromeMode)
 
-	// Handle command-line URLs if provided
-	if *cmdUrl != "" || *cmdUrls != "" {
+	// Tie the run to a release or ticket
+	cfg.Label = strings.TrimSpace(*label)
+	if cfg.Label != "" {
+		log.Printf("Labeling run: %s", cfg.Label)
+	}
+
+	// Capture one shard of a distributed run in its own directory, so workers can share a volume
+	if shardCount > 0 {
+		cfg.Shard, cfg.Shards = shardIndex, shardCount
+		cfg.OutputDir = filepath.Join(cfg.OutputDir, fmt.Sprintf("shard-%d", shardIndex))
+		if err := os.MkdirAll(cfg.OutputDir, 0755); err != nil {
+			log.Fatalf("Failed to create shard directory: %v", err)
+		}
+		log.Printf("Capturing shard %d of %d", shardIndex, shardCount)
+	}
+
+	// Collect the URLs given on the command line, from stdin or from a file
+	var urlList []string
+	if *urlsFile != "" || *cmdUrls == "-" {
+		source := *urlsFile
+		if source == "" {
+			source = "-"
+		}
+		if urlList, err = readURLList(source); err != nil {
+			log.Fatalf("Failed to read URLs: %v", err)
+		}
+		if len(urlList) == 0 {
+			log.Fatalf("No URLs found in %s", source)
+		}
+	} else if *cmdUrls != "" {
+		urlList = strings.Split(*cmdUrls, ",")
+	}
+
+	if *cmdUrl != "" || len(urlList) > 0 || *sitemapURL != "" {
 		// Override config URLs with command line URLs
 		cfg.URLs = []config.URLConfig{}
 
@@ -123,9 +278,9 @@ func main() {
 			})
 
 			log.Printf("Using single URL from command line: %s", *cmdUrl)
-		} else if *cmdUrls != "" {
+		} else if len(urlList) > 0 {
 			// Multiple URLs mode
-			urlList := strings.Split(*cmdUrls, ",")
+			names := make(map[string]bool)
 			for _, url := range urlList {
 				url = strings.TrimSpace(url)
 				if url == "" {
@@ -144,8 +299,15 @@ func main() {
 					viewports = []config.Viewport{{Width: 1280, Height: 800}}
 				}
 
+				// Name URLs by domain, adding the path when a domain appears more than once
+				urlName := extractDomain(url)
+				if names[urlName] {
+					urlName = config.PageNameFromURL(url)
+				}
+				names[urlName] = true
+
 				cfg.URLs = append(cfg.URLs, config.URLConfig{
-					Name:      extractDomain(url),
+					Name:      urlName,
 					URL:       url,
 					Viewports: viewports,
 					Delay:     urlDelay,
@@ -153,6 +315,35 @@ func main() {
 			}
 
 			log.Printf("Using %d URLs from command line", len(cfg.URLs))
+		} else if *sitemapURL != "" {
+			// Sitemap mode
+			pages, err := config.LoadSitemap(config.Sitemap{URL: *sitemapURL})
+			if err != nil {
+				log.Fatalf("Failed to load sitemap: %v", err)
+			}
+
+			urlDelay := 1000
+			if *delay > 0 {
+				urlDelay = *delay
+			}
+
+			// Use default viewports if available, otherwise use a standard viewport
+			viewports := cfg.DefaultViewports
+			if len(viewports) == 0 {
+				// Use a standard viewport as fallback
+				viewports = []config.Viewport{{Width: 1280, Height: 800}}
+			}
+
+			for _, page := range pages {
+				cfg.URLs = append(cfg.URLs, config.URLConfig{
+					Name:      config.PageNameFromURL(page),
+					URL:       page,
+					Viewports: viewports,
+					Delay:     urlDelay,
+				})
+			}
+
+			log.Printf("Using %d URLs from sitemap %s", len(cfg.URLs), *sitemapURL)
 		}
 	}
 
@@ -161,6 +352,44 @@ func main() {
 		log.Fatalf("No URLs to process. Please specify URLs in the config file or use -url/-urls flags.")
 	}
 
+	logConfigWarnings(cfg)
+
+	// Show what would be captured without capturing it
+	if *dryRun {
+		printPlan(os.Stdout, cfg, screenshot.NewScreenshoter(cfg).Plan())
+		return
+	}
+
+	// Retry deliveries queued by previous runs whose backoff has expired
+	journal, err := openJournal(cfg)
+	if err != nil {
+		log.Fatalf("Failed to open delivery journal: %v", err)
+	}
+	if _, remaining, err := journal.Flush(context.Background(), false); err != nil {
+		log.Printf("Failed to retry pending deliveries: %v", err)
+	} else if remaining > 0 {
+		log.Printf("%d deliveries are still queued, run the flush command to retry them now", remaining)
+	}
+
+	// Capture repeatedly in watch mode, each iteration checks disk space itself
+	if *watch > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		signalChan := make(chan os.Signal, 1)
+		signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			sig := <-signalChan
+			log.Printf("Received signal: %v, stopping watch mode", sig)
+			cancel()
+		}()
+
+		log.Printf("Watching %d URLs every %v", len(cfg.URLs), *watch)
+		runWatch(ctx, cfg, *watch, *watchChanges, *archive, uploadHook(ctx, cfg, journal), chainRunHooks(catalogHook(cfg), notifyHook(ctx, cfg, journal), alertHook(ctx, cfg, journal)))
+		cleanupDockerContainer()
+		return
+	}
+
 	// Create screenshot handler
 	screenshoter := screenshot.NewScreenshoter(cfg)
 
@@ -168,6 +397,44 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// Keep the log of the run in its output directory, with its captures
+	startTime := time.Now()
+	archiveName := "run-" + startTime.Format("20060102-150405")
+	if cfg.Label != "" {
+		archiveName += "-" + screenshot.SanitizeFilename(cfg.Label)
+	}
+	stopRunLog := startRunLog(filepath.Join(cfg.OutputDir, "run.log"))
+	defer stopRunLog()
+
+	// Send the run summary and alerts to the notification channels and report the run on the pull request when it finishes or fails
+	afterRun := tagRun(chainRunHooks(catalogHook(cfg), notifyHook(ctx, cfg, journal), alertHook(ctx, cfg, journal), reviewHook(ctx, cfg)), "capture", "")
+	if cfg.Shards > 0 {
+		// The kube command reports the whole run once it merged the shard summaries
+		afterRun = func(summary *screenshot.RunSummary) {
+			summary.Kind = "capture"
+			writeShardSummary(cfg.OutputDir, summary)
+		}
+	}
+	notifyRun := func(err error) {
+		if afterRun != nil {
+			afterRun(screenshoter.Summary("capture", startTime, err))
+		}
+	}
+
+	// Check there is enough disk space for the run
+	if err := screenshoter.Preflight(); err != nil {
+		err = fmt.Errorf("disk space preflight failed: %w", err)
+		notifyRun(err)
+		if *ci {
+			log.Printf("Disk space preflight failed: %v", err)
+			exitCI(screenshoter.Summary("capture", startTime, err), err)
+		}
+		log.Fatalf("Disk space preflight failed: %v", err)
+	}
+
+	// Upload the artifacts of each URL as soon as it is captured
+	screenshoter.AfterURL = uploadHook(ctx, cfg, journal)
+
 	// Set up signal handling for graceful shutdown
 	signalChan := make(chan os.Signal, 1)
 	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
@@ -183,19 +450,50 @@ func main() {
 
 	// Run screenshot capture
 	log.Printf("Starting screenshot capture for %d URLs", len(cfg.URLs))
-	startTime := time.Now()
+
+	// Bundle the URL directories and the log of the run for hand-off
+	bundleRun := func() {
+		if *archive != "" {
+			archiveCapture(*archive, cfg.OutputDir, archiveName, screenshoter.Summary("capture", startTime, nil))
+		}
+	}
+
+	// Report each viewport as a test case to the CI server
+	junitReport := func(err error) {
+		if *junit == "" {
+			return
+		}
+		if err := writeJUnit(*junit, screenshoter.Summary("capture", startTime, err)); err != nil {
+			log.Printf("ERROR: Failed to write JUnit report %s: %v", *junit, err)
+			return
+		}
+		log.Printf("Wrote JUnit report %s", *junit)
+	}
 
 	// Capture screenshots
 	if err := screenshoter.CaptureURLs(ctx); err != nil {
 		log.Printf("Screenshot capture failed: %v", err)
+		junitReport(err)
+		bundleRun()
+		notifyRun(err)
 		cleanupDockerContainer()
+		if *ci {
+			exitCI(screenshoter.Summary("capture", startTime, err), err)
+		}
 		os.Exit(1)
 	}
+	notifyRun(nil)
 
 	// Log completion time
 	elapsed := time.Since(startTime)
 	log.Printf("Screenshot capture completed successfully in %v", elapsed)
+	junitReport(nil)
+	bundleRun()
 
 	// Cleanup
 	cleanupDockerContainer()
+
+	if *ci {
+		exitCI(screenshoter.Summary("capture", startTime, nil), nil)
+	}
 }
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"log"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"screenshot-tool/config"
+	"screenshot-tool/delivery"
+	"screenshot-tool/screenshot"
+)
+
+// artifactLinks resolves the artifacts of a run to their uploaded locations
+type artifactLinks struct {
+	baseDir   string // Output directory the upload keys are relative to
+	target    string // Upload target, e.g. s3://bucket/prefix, empty if artifacts aren't uploaded
+	publicURL string // URL the upload target is served at, empty if it isn't public
+}
+
+// newArtifactLinks returns the links of the configured artifact upload
+func newArtifactLinks(cfg *config.Config) artifactLinks {
+	links := artifactLinks{baseDir: cfg.OutputDir}
+	if cfg.Upload != nil {
+		if uploader, err := delivery.NewUploader(*cfg.Upload); err == nil {
+			links.target = uploader.Target()
+		}
+		links.publicURL = strings.TrimSuffix(cfg.Upload.PublicURL, "/")
+	}
+	return links
+}
+
+// key returns the upload key of a file given relative to a run's output directory
+func (l artifactLinks) key(runDir, rel string) (string, bool) {
+	key, err := filepath.Rel(l.baseDir, filepath.Join(runDir, filepath.FromSlash(rel)))
+	if err != nil || strings.HasPrefix(key, "..") {
+		return "", false
+	}
+	return filepath.ToSlash(key), true
+}
+
+// location returns where an artifact was uploaded, preferring its public URL,
+// or "" if artifacts aren't uploaded
+func (l artifactLinks) location(runDir, rel string) string {
+	if l.target == "" {
+		return ""
+	}
+	if public := l.public(runDir, rel); public != "" {
+		return public
+	}
+	key, ok := l.key(runDir, rel)
+	if !ok {
+		return ""
+	}
+	return l.target + "/" + key
+}
+
+// public returns the public URL of an uploaded artifact, or "" if it has none
+func (l artifactLinks) public(runDir, rel string) string {
+	if l.target == "" || l.publicURL == "" {
+		return ""
+	}
+	key, ok := l.key(runDir, rel)
+	if !ok {
+		return ""
+	}
+	return l.publicURL + "/" + key
+}
+
+// notifyHook returns a callback that sends the summary of a finished run to the
+// configured notification channels, or nil if there are none. Failed notifications
+// are queued in the journal and retried like other deliveries.
+func notifyHook(ctx context.Context, cfg *config.Config, journal *delivery.Journal) func(*screenshot.RunSummary) {
+	if len(cfg.Notifications) == 0 {
+		return nil
+	}
+
+	links := newArtifactLinks(cfg)
+
+	return func(summary *screenshot.RunSummary) {
+		// Link the uploaded manifests when artifacts are uploaded
+		for i := range summary.URLs {
+			if summary.URLs[i].Manifest != "" {
+				summary.URLs[i].ManifestURL = links.location(summary.OutputDir, summary.URLs[i].Manifest)
+			}
+		}
+
+		// Still report runs that ended because of a shutdown
+		ctx := context.WithoutCancel(ctx)
+
+		for _, notification := range cfg.Notifications {
+			if notification.On == "failure" && summary.Status != "failed" {
+				continue
+			}
+			if !reportsRun(notification, summary) {
+				continue
+			}
+
+			var body any = summary
+			switch notification.Type {
+			case "slack":
+				body = slackMessage(summary, links)
+			case "teams":
+				body = teamsMessage(summary, links)
+			}
+
+			if err := delivery.Notify(ctx, journal, notification, body); err != nil {
+				log.Printf("ERROR: Failed to notify %s: %v", notification.URL, err)
+				continue
+			}
+			log.Printf("Sent run summary to %s", notification.URL)
+		}
+	}
+}
+
+// reportsRun reports whether a notification is configured for the kind, schedule or trigger of a run
+func reportsRun(notification config.Notification, summary *screenshot.RunSummary) bool {
+	if len(notification.Runs) == 0 {
+		return true
+	}
+	switch summary.Kind {
+	case "schedule":
+		return slices.Contains(notification.Runs, summary.Schedule)
+	case "trigger":
+		return slices.Contains(notification.Runs, summary.Trigger)
+	}
+	return slices.Contains(notification.Runs, summary.Kind)
+}
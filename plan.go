@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"screenshot-tool/config"
+	"screenshot-tool/screenshot"
+)
+
+// printPlan writes the capture plan of a dry run as a tree of the directories and files it would create
+func printPlan(w io.Writer, cfg *config.Config, plan []screenshot.PlannedURL) {
+	captures := 0
+	for _, u := range plan {
+		captures += len(u.Viewports)
+	}
+	fmt.Fprintf(w, "Dry run: %d URLs, %d viewport captures, written to %s\n", len(plan), captures, cfg.OutputDir)
+	fmt.Fprintf(w, "YYYYMMDD-HHMMSS stands for the capture time, N for one file per screen of the page\n")
+
+	for _, u := range plan {
+		fmt.Fprintf(w, "\n[%d] %s %s\n", u.Index, u.Name, u.URL)
+
+		details := []string{"chrome " + u.ChromeMode}
+		if u.Browser == "firefox" {
+			details = []string{"firefox"}
+		}
+		if u.Cookies > 0 {
+			details = append(details, fmt.Sprintf("%d cookies", u.Cookies))
+		}
+		if u.LocalStorage > 0 {
+			details = append(details, fmt.Sprintf("%d localStorage items", u.LocalStorage))
+		}
+		if u.Login != "" {
+			details = append(details, "login "+u.Login)
+		}
+		if u.Proxy != "" {
+			details = append(details, "proxy "+u.Proxy)
+		}
+		if len(u.Extensions) > 0 {
+			details = append(details, "extensions "+strings.Join(u.Extensions, ", "))
+		}
+		if len(u.ChromeFlags) > 0 {
+			details = append(details, "chrome flags "+strings.Join(u.ChromeFlags, " "))
+		}
+		if u.Actions > 0 {
+			details = append(details, fmt.Sprintf("%d actions", u.Actions))
+		}
+		fmt.Fprintf(w, "    %s\n", strings.Join(details, ", "))
+
+		fmt.Fprintf(w, "    %s%c\n", filepath.Join(cfg.OutputDir, u.Dir), filepath.Separator)
+		for _, file := range u.Files {
+			fmt.Fprintf(w, "      %s\n", file)
+		}
+		for _, viewport := range u.Viewports {
+			fmt.Fprintf(w, "      %s%c\n", viewport.Dir, filepath.Separator)
+			for _, file := range viewport.Files {
+				fmt.Fprintf(w, "        %s\n", file)
+			}
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package queue
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"screenshot-tool/config"
+)
+
+// natsQueue publishes jobs to a subject stored by a JetStream stream, and pulls them from
+// a durable consumer the workers share. Jobs that aren't acknowledged within the ack wait
+// of the consumer are delivered again.
+type natsQueue struct {
+	address  string
+	useTLS   bool
+	user     string
+	password string
+	token    string
+	subject  string
+	stream   string
+	consumer string
+	conn     net.Conn
+	reader   *bufio.Reader
+	inbox    string // Prefix of the subjects replies are received on
+	requests int    // Requests sent, numbering their reply subjects
+}
+
+// natsReply is a message received on the inbox
+type natsReply struct {
+	subject string
+	reply   string // Subject to acknowledge a JetStream message on
+	status  int    // Status of a header-only message, e.g. 404 when no job is waiting
+	data    []byte
+}
+
+// newNATSQueue parses a nats:// or tls:// URL with optional credentials or token
+func newNATSQueue(q config.Queue) (*natsQueue, error) {
+	u, err := url.Parse(q.URL)
+	if err != nil || (u.Scheme != "nats" && u.Scheme != "tls") || u.Host == "" {
+		return nil, fmt.Errorf("invalid NATS URL %q, expected nats://[user:password@]host:port", q.URL)
+	}
+	n := &natsQueue{
+		address:  u.Host,
+		useTLS:   u.Scheme == "tls",
+		subject:  q.Name,
+		stream:   q.Stream,
+		consumer: q.Consumer,
+	}
+	if u.Port() == "" {
+		n.address = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	if u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			n.user, n.password = u.User.Username(), password
+		} else {
+			n.token = u.User.Username()
+		}
+	}
+	return n, nil
+}
+
+func (n *natsQueue) Target() string {
+	return fmt.Sprintf("nats://%s/%s", n.address, n.subject)
+}
+
+// Push publishes a job and waits for the stream to confirm it stored it
+func (n *natsQueue) Push(ctx context.Context, body []byte) error {
+	reply, err := n.request(ctx, deadline(ctx, 0), n.subject, body)
+	if err != nil {
+		return err
+	}
+	if reply.status == 503 {
+		return fmt.Errorf("no JetStream stream stores subject %s", n.subject)
+	}
+	var ack struct {
+		Error *struct {
+			Description string `json:"description"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(reply.data, &ack); err != nil {
+		return fmt.Errorf("invalid JetStream publish acknowledgement: %w", err)
+	}
+	if ack.Error != nil {
+		return fmt.Errorf("JetStream: %s", ack.Error.Description)
+	}
+	return nil
+}
+
+// Pop requests the next job of the consumer, which the server holds until one arrives or
+// the wait expires
+func (n *natsQueue) Pop(ctx context.Context, wait time.Duration) (*Message, error) {
+	next, _ := json.Marshal(map[string]any{"batch": 1, "expires": wait.Nanoseconds()})
+	subject := fmt.Sprintf("$JS.API.CONSUMER.MSG.NEXT.%s.%s", n.stream, n.consumer)
+	reply, err := n.request(ctx, deadline(ctx, wait), subject, next)
+	if err != nil {
+		return nil, err
+	}
+	switch reply.status {
+	case 0:
+	case 404, 408, 409: // No job waiting, wait expired or the request was superseded
+		return nil, nil
+	case 503:
+		return nil, fmt.Errorf("JetStream is not available for consumer %s of stream %s", n.consumer, n.stream)
+	default:
+		return nil, fmt.Errorf("JetStream returned status %d for consumer %s of stream %s", reply.status, n.consumer, n.stream)
+	}
+
+	return &Message{
+		Body: reply.data,
+		ack: func(ctx context.Context) error {
+			return n.publish(ctx, reply.reply, "", []byte("+ACK"))
+		},
+	}, nil
+}
+
+func (n *natsQueue) Close() error {
+	if n.conn == nil {
+		return nil
+	}
+	err := n.conn.Close()
+	n.conn = nil
+	return err
+}
+
+// connect opens the connection if needed and subscribes to the inbox
+func (n *natsQueue) connect(ctx context.Context) error {
+	if n.conn != nil {
+		return nil
+	}
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", n.address)
+	if err != nil {
+		return fmt.Errorf("failed to connect to NATS at %s: %w", n.address, err)
+	}
+	conn.SetDeadline(deadline(ctx, 0))
+	reader := bufio.NewReader(conn)
+
+	// The server introduces itself before the connection is upgraded to TLS
+	info, err := reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(info, "INFO ") {
+		conn.Close()
+		return fmt.Errorf("unexpected NATS greeting %q: %v", strings.TrimSpace(info), err)
+	}
+	if n.useTLS {
+		host, _, _ := net.SplitHostPort(n.address)
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: host})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return fmt.Errorf("NATS TLS handshake failed: %w", err)
+		}
+		conn, reader = tlsConn, bufio.NewReader(tlsConn)
+	}
+
+	options := map[string]any{
+		"verbose":       false,
+		"pedantic":      false,
+		"headers":       true,
+		"no_responders": true,
+		"lang":          "go",
+		"version":       "1.0.0",
+		"name":          "screenshot-tool",
+	}
+	if n.user != "" {
+		options["user"], options["pass"] = n.user, n.password
+	}
+	if n.token != "" {
+		options["auth_token"] = n.token
+	}
+	connect, _ := json.Marshal(options)
+	n.inbox = fmt.Sprintf("_INBOX.screenshot-tool.%d", time.Now().UnixNano())
+	if _, err := fmt.Fprintf(conn, "CONNECT %s\r\nSUB %s.* 1\r\nPING\r\n", connect, n.inbox); err != nil {
+		conn.Close()
+		return err
+	}
+	n.conn, n.reader = conn, reader
+
+	// The server answers the PING once it accepted the connection
+	for {
+		line, err := n.readLine()
+		if err != nil {
+			n.Close()
+			return fmt.Errorf("NATS connection failed: %w", err)
+		}
+		if line == "PONG" {
+			return nil
+		}
+	}
+}
+
+// publish sends a message to subject, with replies going to reply if set
+func (n *natsQueue) publish(ctx context.Context, subject, reply string, data []byte) error {
+	if err := n.connect(ctx); err != nil {
+		return err
+	}
+	n.conn.SetDeadline(deadline(ctx, 0))
+	header := "PUB " + subject
+	if reply != "" {
+		header += " " + reply
+	}
+	if _, err := fmt.Fprintf(n.conn, "%s %d\r\n%s\r\n", header, len(data), data); err != nil {
+		n.Close()
+		return err
+	}
+	return nil
+}
+
+// request publishes a message and waits until until for the reply to it
+func (n *natsQueue) request(ctx context.Context, until time.Time, subject string, data []byte) (*natsReply, error) {
+	if err := n.connect(ctx); err != nil {
+		return nil, err
+	}
+	n.requests++
+	reply := n.inbox + "." + strconv.Itoa(n.requests)
+	if err := n.publish(ctx, subject, reply, data); err != nil {
+		return nil, err
+	}
+	n.conn.SetDeadline(until)
+	defer interruptOnDone(ctx, n.conn)()
+
+	for {
+		msg, err := n.readMessage()
+		if err != nil {
+			n.Close()
+			return nil, err
+		}
+		if msg.subject == reply {
+			return msg, nil
+		}
+		// Late replies to earlier requests are dropped
+	}
+}
+
+// readMessage reads until the next message, answering pings of the server
+func (n *natsQueue) readMessage() (*natsReply, error) {
+	for {
+		line, err := n.readLine()
+		if err != nil {
+			return nil, err
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 || (fields[0] != "MSG" && fields[0] != "HMSG") {
+			continue
+		}
+
+		// MSG <subject> <sid> [reply] <size> and HMSG <subject> <sid> [reply] <header size> <size>
+		msg := &natsReply{subject: fields[1]}
+		counts := 1
+		if fields[0] == "HMSG" {
+			counts = 2
+		}
+		if len(fields) == 3+counts+1 {
+			msg.reply = fields[3]
+		}
+		size, err := strconv.Atoi(fields[len(fields)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid NATS message %q", line)
+		}
+		headerSize := 0
+		if counts == 2 {
+			if headerSize, err = strconv.Atoi(fields[len(fields)-2]); err != nil {
+				return nil, fmt.Errorf("invalid NATS message %q", line)
+			}
+		}
+
+		payload := make([]byte, size+2)
+		if _, err := io.ReadFull(n.reader, payload); err != nil {
+			return nil, err
+		}
+		msg.data = payload[headerSize:size]
+		if headerSize > 0 {
+			// NATS/1.0 404 No Messages
+			status := strings.Fields(strings.SplitN(string(payload[:headerSize]), "\r\n", 2)[0])
+			if len(status) > 1 {
+				msg.status, _ = strconv.Atoi(status[1])
+			}
+		}
+		return msg, nil
+	}
+}
+
+// readLine reads a protocol line, answering pings and failing on errors of the server
+func (n *natsQueue) readLine() (string, error) {
+	for {
+		line, err := n.reader.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		line = strings.TrimSuffix(line, "\r\n")
+		switch {
+		case line == "PING":
+			if _, err := io.WriteString(n.conn, "PONG\r\n"); err != nil {
+				return "", err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return "", fmt.Errorf("NATS: %s", strings.Trim(strings.TrimSpace(line[4:]), "'"))
+		case line == "+OK" || strings.HasPrefix(line, "INFO "):
+		default:
+			return line, nil
+		}
+	}
+}
@@ -0,0 +1,73 @@
+// Package queue moves capture jobs between the enqueue command and workers through
+// Redis, NATS JetStream or Amazon SQS
+package queue
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"screenshot-tool/config"
+)
+
+// Queue is a connection to a work queue. It is not safe for concurrent use, each worker
+// opens its own.
+type Queue interface {
+	// Push adds a job to the queue
+	Push(ctx context.Context, body []byte) error
+	// Pop waits up to wait for a job and returns it, or nil if none arrived
+	Pop(ctx context.Context, wait time.Duration) (*Message, error)
+	// Target describes the queue for logs, e.g. redis://host:6379/screenshot-tool.jobs
+	Target() string
+	Close() error
+}
+
+// Message is a job taken from a queue. It must be acknowledged once handled, otherwise
+// the queue delivers it again, or for Redis keeps it in the processing list.
+type Message struct {
+	Body []byte
+	ack  func(ctx context.Context) error
+}
+
+// Ack removes the job from the queue
+func (m *Message) Ack(ctx context.Context) error {
+	return m.ack(ctx)
+}
+
+// New connects to the configured queue
+func New(q config.Queue) (Queue, error) {
+	switch q.Type {
+	case "redis":
+		return newRedisQueue(q)
+	case "nats":
+		return newNATSQueue(q)
+	case "sqs":
+		return newSQSQueue(q)
+	default:
+		return nil, fmt.Errorf("unsupported queue type: %s", q.Type)
+	}
+}
+
+// deadline returns when a call waiting up to wait for a job has to end, leaving the
+// server time to answer
+func deadline(ctx context.Context, wait time.Duration) time.Time {
+	d := time.Now().Add(wait + 10*time.Second)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(d) {
+		return ctxDeadline
+	}
+	return d
+}
+
+// interruptOnDone unblocks calls on conn once ctx ends. The returned function stops watching.
+func interruptOnDone(ctx context.Context, conn net.Conn) func() {
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-stop:
+		}
+	}()
+	return func() { close(stop) }
+}
@@ -0,0 +1,214 @@
+package queue
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"screenshot-tool/config"
+)
+
+// redisQueue keeps jobs in a Redis list. Popped jobs are moved to <list>:processing
+// until they are acknowledged, so jobs of a crashed worker aren't lost.
+type redisQueue struct {
+	address  string
+	useTLS   bool
+	username string
+	password string
+	db       int
+	key      string
+	conn     net.Conn
+	reader   *bufio.Reader
+}
+
+// newRedisQueue parses a redis:// or rediss:// URL with an optional password and database
+func newRedisQueue(q config.Queue) (*redisQueue, error) {
+	u, err := url.Parse(q.URL)
+	if err != nil || (u.Scheme != "redis" && u.Scheme != "rediss") || u.Host == "" {
+		return nil, fmt.Errorf("invalid Redis URL %q, expected redis://[:password@]host:port[/db]", q.URL)
+	}
+	r := &redisQueue{address: u.Host, useTLS: u.Scheme == "rediss", key: q.Name}
+	if u.Port() == "" {
+		r.address = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		r.username = u.User.Username()
+		r.password, _ = u.User.Password()
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if r.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("invalid Redis database %q", db)
+		}
+	}
+	return r, nil
+}
+
+func (r *redisQueue) Target() string {
+	scheme := "redis"
+	if r.useTLS {
+		scheme = "rediss"
+	}
+	return fmt.Sprintf("%s://%s/%d/%s", scheme, r.address, r.db, r.key)
+}
+
+func (r *redisQueue) Push(ctx context.Context, body []byte) error {
+	_, err := r.do(ctx, time.Time{}, "LPUSH", r.key, string(body))
+	return err
+}
+
+func (r *redisQueue) Pop(ctx context.Context, wait time.Duration) (*Message, error) {
+	processing := r.key + ":processing"
+	timeout := strconv.FormatFloat(max(wait.Seconds(), 0.1), 'f', 1, 64)
+	reply, err := r.do(ctx, deadline(ctx, wait), "BLMOVE", r.key, processing, "RIGHT", "LEFT", timeout)
+	if err != nil || reply == nil {
+		return nil, err
+	}
+	body, ok := reply.(string)
+	if !ok {
+		return nil, fmt.Errorf("unexpected BLMOVE reply %v", reply)
+	}
+	return &Message{
+		Body: []byte(body),
+		ack: func(ctx context.Context) error {
+			_, err := r.do(ctx, time.Time{}, "LREM", processing, "1", body)
+			return err
+		},
+	}, nil
+}
+
+func (r *redisQueue) Close() error {
+	if r.conn == nil {
+		return nil
+	}
+	err := r.conn.Close()
+	r.conn = nil
+	return err
+}
+
+// connect opens the connection if needed, authenticating and selecting the database
+func (r *redisQueue) connect(ctx context.Context) error {
+	if r.conn != nil {
+		return nil
+	}
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	var conn net.Conn
+	var err error
+	if r.useTLS {
+		conn, err = (&tls.Dialer{NetDialer: dialer}).DialContext(ctx, "tcp", r.address)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", r.address)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to Redis at %s: %w", r.address, err)
+	}
+	r.conn, r.reader = conn, bufio.NewReader(conn)
+
+	if r.password != "" {
+		args := []string{"AUTH", r.password}
+		if r.username != "" {
+			args = []string{"AUTH", r.username, r.password}
+		}
+		if _, err := r.do(ctx, time.Time{}, args...); err != nil {
+			r.Close()
+			return fmt.Errorf("Redis authentication failed: %w", err)
+		}
+	}
+	if r.db != 0 {
+		if _, err := r.do(ctx, time.Time{}, "SELECT", strconv.Itoa(r.db)); err != nil {
+			r.Close()
+			return err
+		}
+	}
+	return nil
+}
+
+// do sends a command and reads its reply: a string, an int64, a list or nil. A zero
+// until waits up to 30 seconds. The connection is dropped on network errors and
+// reopened by the next command.
+func (r *redisQueue) do(ctx context.Context, until time.Time, args ...string) (any, error) {
+	if err := r.connect(ctx); err != nil {
+		return nil, err
+	}
+	if until.IsZero() {
+		until = deadline(ctx, 20*time.Second)
+	}
+	r.conn.SetDeadline(until)
+	defer interruptOnDone(ctx, r.conn)()
+
+	var command strings.Builder
+	fmt.Fprintf(&command, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&command, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(r.conn, command.String()); err != nil {
+		r.Close()
+		return nil, err
+	}
+
+	reply, err := r.readReply()
+	if _, ok := err.(redisError); !ok && err != nil {
+		r.Close()
+	}
+	return reply, err
+}
+
+// redisError is an error reply of the server, which leaves the connection usable
+type redisError string
+
+func (e redisError) Error() string {
+	return "Redis: " + string(e)
+}
+
+// readReply reads a reply in the Redis serialization protocol
+func (r *redisQueue) readReply() (any, error) {
+	line, err := r.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("empty Redis reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '_':
+		return nil, nil
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r.reader, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = r.readReply(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("unexpected Redis reply %q", line)
+	}
+}
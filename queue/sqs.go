@@ -0,0 +1,213 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"screenshot-tool/config"
+)
+
+// sqsQueue sends jobs to an Amazon SQS queue through its JSON API. A received job is
+// hidden from other workers for the visibility timeout and delivered again if it isn't
+// deleted by then.
+type sqsQueue struct {
+	queueURL          string
+	endpoint          string // Scheme and host of the queue URL the API is called on
+	host              string
+	region            string
+	visibilityTimeout int
+	accessKey         string
+	secretKey         string
+	sessionToken      string
+	client            *http.Client
+}
+
+// newSQSQueue creates an SQS queue, reading credentials from the standard AWS environment variables
+func newSQSQueue(q config.Queue) (*sqsQueue, error) {
+	u, err := url.Parse(q.URL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid SQS queue URL %q, expected https://sqs.<region>.amazonaws.com/<account>/<queue>", q.URL)
+	}
+	s := &sqsQueue{
+		queueURL:          q.URL,
+		endpoint:          u.Scheme + "://" + u.Host,
+		host:              u.Host,
+		region:            q.Region,
+		visibilityTimeout: q.VisibilityTimeout,
+		accessKey:         os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:         os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken:      os.Getenv("AWS_SESSION_TOKEN"),
+		client:            &http.Client{Timeout: time.Minute},
+	}
+
+	// Queue URLs name their region: https://sqs.eu-west-1.amazonaws.com/...
+	if parts := strings.Split(u.Hostname(), "."); s.region == "" && len(parts) > 2 && parts[0] == "sqs" {
+		s.region = parts[1]
+	}
+	if s.region == "" {
+		s.region = os.Getenv("AWS_REGION")
+	}
+	if s.region == "" {
+		s.region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if s.region == "" {
+		s.region = "us-east-1"
+	}
+
+	if s.accessKey == "" || s.secretKey == "" {
+		return nil, fmt.Errorf("SQS queue requires AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY to be set")
+	}
+	return s, nil
+}
+
+func (s *sqsQueue) Target() string {
+	return s.queueURL
+}
+
+func (s *sqsQueue) Push(ctx context.Context, body []byte) error {
+	return s.call(ctx, "SendMessage", map[string]any{"QueueUrl": s.queueURL, "MessageBody": string(body)}, nil)
+}
+
+// Pop long-polls the queue, which waits at most 20 seconds per call
+func (s *sqsQueue) Pop(ctx context.Context, wait time.Duration) (*Message, error) {
+	request := map[string]any{
+		"QueueUrl":            s.queueURL,
+		"MaxNumberOfMessages": 1,
+		"WaitTimeSeconds":     min(int(wait.Seconds()), 20),
+		"VisibilityTimeout":   s.visibilityTimeout,
+	}
+	var response struct {
+		Messages []struct {
+			Body          string `json:"Body"`
+			ReceiptHandle string `json:"ReceiptHandle"`
+		} `json:"Messages"`
+	}
+	if err := s.call(ctx, "ReceiveMessage", request, &response); err != nil {
+		return nil, err
+	}
+	if len(response.Messages) == 0 {
+		return nil, nil
+	}
+
+	received := response.Messages[0]
+	return &Message{
+		Body: []byte(received.Body),
+		ack: func(ctx context.Context) error {
+			return s.call(ctx, "DeleteMessage", map[string]any{"QueueUrl": s.queueURL, "ReceiptHandle": received.ReceiptHandle}, nil)
+		},
+	}, nil
+}
+
+func (s *sqsQueue) Close() error {
+	return nil
+}
+
+// call invokes an action of the SQS JSON API and decodes its response into out, if set
+func (s *sqsQueue) call(ctx context.Context, action string, request, out any) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	req.Header.Set("X-Amz-Target", "AmazonSQS."+action)
+	s.sign(req, body, time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("SQS %s failed: %w", action, err)
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("SQS %s failed: %s: %s", action, resp.Status, strings.TrimSpace(string(data)))
+	}
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			return fmt.Errorf("invalid SQS %s response: %w", action, err)
+		}
+	}
+	return nil
+}
+
+// sign adds a Signature Version 4 authorization to a request of the JSON API
+func (s *sqsQueue) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := hex.EncodeToString(sha256Sum(body))
+
+	req.Host = s.host
+	req.Header.Set("X-Amz-Date", amzDate)
+	if s.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.sessionToken)
+	}
+
+	headers := []string{"content-type", "host", "x-amz-date"}
+	values := map[string]string{"content-type": req.Header.Get("Content-Type"), "host": s.host, "x-amz-date": amzDate}
+	if s.sessionToken != "" {
+		headers = append(headers, "x-amz-security-token")
+		values["x-amz-security-token"] = s.sessionToken
+	}
+	headers = append(headers, "x-amz-target")
+	values["x-amz-target"] = req.Header.Get("X-Amz-Target")
+
+	var canonicalHeaders strings.Builder
+	for _, h := range headers {
+		canonicalHeaders.WriteString(h + ":" + values[h] + "\n")
+	}
+	signedHeaders := strings.Join(headers, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		"/",
+		"",
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.region + "/sqs/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(sha256Sum([]byte(canonicalRequest))),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "sqs")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature))
+}
+
+// sha256Sum returns the SHA-256 hash of data
+func sha256Sum(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data with key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"log"
+	"mime"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"screenshot-tool/screenshot"
+)
+
+// reportTimeout bounds rendering the PDF, which embeds every screenshot of the run
+const reportTimeout = 5 * time.Minute
+
+// proofReport is the content of a PDF proof report
+type proofReport struct {
+	RunDir      string
+	GeneratedAt time.Time
+	Version     string
+	Label       string
+	URLs        []*urlProof
+}
+
+// urlProof is the section of the report for a captured URL
+type urlProof struct {
+	Dir       string
+	Manifest  *screenshot.Manifest
+	Viewports []viewportProof
+	Cookies   []inventoryCookie
+	Hashes    []fileHash
+}
+
+// viewportProof holds the screenshots of a viewport, embedded as data URLs
+type viewportProof struct {
+	Manifest  *screenshot.ViewportManifest
+	Name      string
+	Full      template.URL // Full page screenshot
+	ViewProof template.URL // Full page screenshot with the ViewProof block
+}
+
+// fileHash is the SHA-256 of an artifact, checked against the one recorded in the manifest
+type fileHash struct {
+	Path   string
+	SHA256 string
+	Status string // "verified", "changed", "not recorded" or "missing"
+}
+
+// runReport implements the report command, which assembles the captures of a run into a document
+func runReport(args []string) {
+	if len(args) == 0 || args[0] != "pdf" {
+		fmt.Fprintf(os.Stderr, "Usage: %s report pdf [flags] <runDir>\n", os.Args[0])
+		os.Exit(2)
+	}
+
+	flags := flag.NewFlagSet("report pdf", flag.ExitOnError)
+	outPath := flags.String("out", "", "Path of the PDF (defaults to report.pdf in the run directory)")
+	chromeMode := flags.String("chrome", "auto", "Chrome execution mode: 'local', 'docker', or 'auto'")
+	certPath := flags.String("sign-cert", "", "PEM certificate chain to sign the PDF with, signing certificate first")
+	keyPath := flags.String("sign-key", "", "PEM private key of the signing certificate")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s report pdf [flags] <runDir>\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args[1:])
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if (*certPath == "") != (*keyPath == "") {
+		log.Fatalf("-sign-cert and -sign-key must be used together")
+	}
+	runDir := flags.Arg(0)
+	if *outPath == "" {
+		*outPath = filepath.Join(runDir, "report.pdf")
+	}
+
+	// Load the signer first, so a bad key doesn't waste the rendering
+	var signer *pdfSigner
+	if *certPath != "" {
+		var err error
+		if signer, err = loadPDFSigner(*certPath, *keyPath); err != nil {
+			log.Fatalf("Failed to load signing certificate: %v", err)
+		}
+	}
+
+	report, err := loadProofReport(runDir)
+	if err != nil {
+		log.Fatalf("Failed to read run %s: %v", runDir, err)
+	}
+
+	var document strings.Builder
+	if err := reportTemplate.Execute(&document, report); err != nil {
+		log.Fatalf("Failed to build report: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), reportTimeout)
+	defer cancel()
+	footer := fmt.Sprintf("Proof report of %s, generated %s", filepath.Base(filepath.Clean(runDir)), report.GeneratedAt.Format(time.RFC3339))
+	pdf, err := screenshot.PrintPDF(ctx, *chromeMode, document.String(), footer)
+	if err != nil {
+		log.Fatalf("Failed to render report: %v", err)
+	}
+
+	if signer != nil {
+		if pdf, err = signer.signPDF(pdf, report.GeneratedAt); err != nil {
+			log.Fatalf("Failed to sign report: %v", err)
+		}
+		log.Printf("Signed report as %s", signer.chain[0].Subject.CommonName)
+	}
+
+	if err := os.WriteFile(*outPath, pdf, 0644); err != nil {
+		log.Fatalf("Failed to write report: %v", err)
+	}
+	sum := sha256.Sum256(pdf)
+	log.Printf("Wrote proof report of %d URLs to %s (sha256:%s)", len(report.URLs), *outPath, hex.EncodeToString(sum[:]))
+}
+
+// loadProofReport reads the captures of a run. A run is a directory of URL directories,
+// or a single URL directory.
+func loadProofReport(runDir string) (*proofReport, error) {
+	manifests, err := filepath.Glob(filepath.Join(runDir, "*", "manifest.json"))
+	if err != nil {
+		return nil, err
+	}
+	if single := filepath.Join(runDir, "manifest.json"); len(manifests) == 0 {
+		if _, err := os.Stat(single); err == nil {
+			manifests = []string{single}
+		}
+	}
+	if len(manifests) == 0 {
+		return nil, fmt.Errorf("no captured URLs found")
+	}
+	sort.Strings(manifests)
+
+	report := &proofReport{
+		RunDir:      runDir,
+		GeneratedAt: time.Now(),
+		Version:     screenshot.ToolVersion(),
+	}
+	for _, manifestPath := range manifests {
+		proof, err := loadURLProof(filepath.Dir(manifestPath))
+		if err != nil {
+			return nil, err
+		}
+		if report.Label == "" {
+			report.Label = proof.Manifest.Label
+		}
+		report.URLs = append(report.URLs, proof)
+	}
+	return report, nil
+}
+
+// loadURLProof reads the manifest, screenshots, cookies and artifact hashes of a URL directory
+func loadURLProof(urlDir string) (*urlProof, error) {
+	manifestPath := filepath.Join(urlDir, "manifest.json")
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &screenshot.Manifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", manifestPath, err)
+	}
+	proof := &urlProof{Dir: filepath.Base(urlDir), Manifest: manifest}
+
+	for _, vm := range manifest.Viewports {
+		name := fmt.Sprintf("%dx%d", vm.Width, vm.Height)
+		viewport := viewportProof{Manifest: vm, Name: name}
+		if viewport.Full, err = embedLatestImage(filepath.Join(urlDir, name, fmt.Sprintf("*-full-%s.*", name))); err != nil {
+			return nil, err
+		}
+		if viewport.ViewProof, err = embedLatestImage(filepath.Join(urlDir, name, fmt.Sprintf("*-full-proof-%s.*", name))); err != nil {
+			return nil, err
+		}
+		proof.Viewports = append(proof.Viewports, viewport)
+	}
+
+	cookies, err := readURLCookies(urlDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cookies of %s: %w", urlDir, err)
+	}
+	for _, cookie := range cookies {
+		proof.Cookies = append(proof.Cookies, cookie)
+	}
+	sortCookies(proof.Cookies)
+
+	if proof.Hashes, err = verifyArtifactHashes(urlDir, manifest.Checksums); err != nil {
+		return nil, fmt.Errorf("failed to hash artifacts of %s: %w", urlDir, err)
+	}
+	return proof, nil
+}
+
+// embedLatestImage returns the last file matching pattern as a data URL, or "" if there is none.
+// Timestamped names sort by capture time.
+func embedLatestImage(pattern string) (template.URL, error) {
+	matches, err := filepath.Glob(pattern)
+	if err != nil || len(matches) == 0 {
+		return "", err
+	}
+	sort.Strings(matches)
+	path := matches[len(matches)-1]
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	mimeType := mime.TypeByExtension(filepath.Ext(path))
+	if mimeType == "" {
+		mimeType = "image/png"
+	}
+	return template.URL("data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data)), nil
+}
+
+// verifyArtifactHashes hashes the artifacts of a URL directory and checks them against the
+// checksums recorded in the manifest, if checksums were enabled for the run
+func verifyArtifactHashes(urlDir string, recorded map[string]string) ([]fileHash, error) {
+	current, err := screenshot.ChecksumDir(urlDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var hashes []fileHash
+	for path, sum := range current {
+		status := "not recorded"
+		if want, ok := recorded[path]; ok {
+			status = "verified"
+			if want != sum {
+				status = "changed"
+			}
+		}
+		hashes = append(hashes, fileHash{Path: path, SHA256: sum, Status: status})
+	}
+	for path, sum := range recorded {
+		if _, ok := current[path]; !ok {
+			hashes = append(hashes, fileHash{Path: path, SHA256: sum, Status: "missing"})
+		}
+	}
+	sort.Slice(hashes, func(i, j int) bool { return hashes[i].Path < hashes[j].Path })
+	return hashes, nil
+}
+
+// reportTemplate lays out the report: a cover page, then a section per URL starting on a new page
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"time": func(t time.Time) string { return t.Format(time.RFC3339) },
+	"inc":  func(i int) int { return i + 1 },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Proof report</title>
+<style>
+	body { font-family: Arial, sans-serif; font-size: 10px; color: #222; }
+	h1 { font-size: 22px; }
+	h2 { font-size: 16px; break-before: page; word-break: break-all; }
+	h3 { font-size: 12px; margin-top: 16px; }
+	table { border-collapse: collapse; width: 100%; margin-bottom: 8px; }
+	th, td { border: 1px solid #ccc; padding: 3px 5px; text-align: left; vertical-align: top; }
+	th { background: #f0f0f0; }
+	td.hash { font-family: monospace; font-size: 8px; word-break: break-all; }
+	.changed, .missing { color: #b00020; font-weight: bold; }
+	.shot { break-inside: avoid; margin-bottom: 12px; }
+	.shot img { display: block; max-width: 100%; max-height: 240mm; border: 1px solid #ccc; }
+</style>
+</head>
+<body>
+<h1>Proof report</h1>
+<table>
+	<tr><th>Run</th><td>{{.RunDir}}</td></tr>
+	{{with .Label}}<tr><th>Label</th><td>{{.}}</td></tr>{{end}}
+	<tr><th>Generated</th><td>{{time .GeneratedAt}}</td></tr>
+	<tr><th>Tool version</th><td>{{.Version}}</td></tr>
+	<tr><th>URLs</th><td>{{len .URLs}}</td></tr>
+</table>
+<table>
+	<tr><th>#</th><th>Name</th><th>URL</th><th>Started</th></tr>
+	{{range $i, $u := .URLs}}<tr><td>{{inc $i}}</td><td>{{$u.Manifest.Name}}</td><td>{{$u.Manifest.URL}}</td><td>{{time $u.Manifest.StartedAt}}</td></tr>
+	{{end}}
+</table>
+
+{{range .URLs}}{{$m := .Manifest}}
+<h2>{{$m.Name}}</h2>
+<table>
+	<tr><th>URL</th><td>{{$m.URL}}</td></tr>
+	<tr><th>Directory</th><td>{{.Dir}}</td></tr>
+	{{with $m.Label}}<tr><th>Label</th><td>{{.}}</td></tr>{{end}}
+	<tr><th>Started</th><td>{{time $m.StartedAt}}</td></tr>
+	<tr><th>Finished</th><td>{{time $m.FinishedAt}}</td></tr>
+	{{with $m.Timezone}}<tr><th>Time zone</th><td>{{.}}</td></tr>{{end}}
+	{{with $m.Geolocation}}<tr><th>Geolocation</th><td>{{.Latitude}}, {{.Longitude}}</td></tr>{{end}}
+	{{with $m.Throttling}}<tr><th>Throttling</th><td>{{with .Profile}}{{.}}: {{end}}{{.Latency}} ms, {{.Download}} kbit/s down, {{.Upload}} kbit/s up</td></tr>{{end}}
+	<tr><th>Downloaded</th><td>{{$m.BytesDownloaded}} bytes</td></tr>
+</table>
+
+{{range .Viewports}}
+<h3>Viewport {{.Name}}{{if .Manifest.Mobile}}, mobile{{end}}{{with .Manifest.Orientation}}, {{.}}{{end}}</h3>
+{{with .Manifest.Failure}}<p class="changed">Capture failed at {{.Stage}}: {{index .Errors 0}}</p>{{end}}
+{{with .Full}}<div class="shot"><p>Full page</p><img src="{{.}}"></div>{{end}}
+{{with .ViewProof}}<div class="shot"><p>ViewProof</p><img src="{{.}}"></div>{{end}}
+{{end}}
+
+<h3>Cookies</h3>
+{{if .Cookies}}<table>
+	<tr><th>Name</th><th>Domain</th><th>Path</th><th>Lifetime</th><th>HttpOnly</th><th>Secure</th><th>SameSite</th></tr>
+	{{range .Cookies}}<tr><td>{{.Name}}</td><td>{{.Domain}}</td><td>{{.Path}}</td><td>{{.Lifetime}}</td><td>{{.HTTPOnly}}</td><td>{{.Secure}}</td><td>{{.SameSite}}</td></tr>
+	{{end}}
+</table>{{else}}<p>No cookies were set.</p>{{end}}
+
+<h3>Artifact hashes (SHA-256)</h3>
+<table>
+	<tr><th>File</th><th>SHA-256</th><th>Status</th></tr>
+	{{range .Hashes}}<tr><td>{{.Path}}</td><td class="hash">{{.SHA256}}</td><td class="{{.Status}}">{{.Status}}</td></tr>
+	{{end}}
+</table>
+{{end}}
+</body>
+</html>
+`))
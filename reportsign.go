@@ -0,0 +1,416 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// signatureSize is the room reserved in a signed PDF for the CMS signature, in bytes.
+// It holds a signature with a certificate chain of several certificates.
+const signatureSize = 16384
+
+// Object identifiers of the CMS signature
+var (
+	oidData            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidContentType     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSigningTime     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	oidSHA256          = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidRSAEncryption   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+)
+
+// pdfSigner holds the certificate chain and key a PDF is signed with
+type pdfSigner struct {
+	chain []*x509.Certificate // Signing certificate first
+	key   crypto.Signer
+}
+
+// loadPDFSigner reads a PEM certificate chain, signing certificate first, and its PEM private key
+func loadPDFSigner(certPath, keyPath string) (*pdfSigner, error) {
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, err
+	}
+	signer := &pdfSigner{}
+	for block, rest := pem.Decode(certPEM); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate: %w", err)
+		}
+		signer.chain = append(signer.chain, cert)
+	}
+	if len(signer.chain) == 0 {
+		return nil, fmt.Errorf("no certificate found in %s", certPath)
+	}
+
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("no private key found in %s", keyPath)
+	}
+	var key any
+	if key, err = x509.ParsePKCS8PrivateKey(block.Bytes); err != nil {
+		if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			if key, err = x509.ParseECPrivateKey(block.Bytes); err != nil {
+				return nil, fmt.Errorf("failed to parse private key: %w", err)
+			}
+		}
+	}
+
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		signer.key = key
+	case *ecdsa.PrivateKey:
+		signer.key = key
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T, PDF signatures need an RSA or ECDSA key", key)
+	}
+	if !publicKeysEqual(signer.chain[0].PublicKey, signer.key.Public()) {
+		return nil, fmt.Errorf("the private key doesn't belong to the first certificate in %s", certPath)
+	}
+	return signer, nil
+}
+
+// publicKeysEqual reports whether two public keys are the same
+func publicKeysEqual(a, b crypto.PublicKey) bool {
+	key, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && key.Equal(b)
+}
+
+// signPDF adds an invisible signature to a PDF as an incremental update, the way PDF
+// readers sign documents. The signature is a detached CMS signature (adbe.pkcs7.detached)
+// over the whole file except the signature itself, so any later change invalidates it.
+func (s *pdfSigner) signPDF(pdf []byte, at time.Time) ([]byte, error) {
+	trailer, err := readPDFTrailer(pdf)
+	if err != nil {
+		return nil, err
+	}
+	catalog, err := readPDFObject(pdf, trailer.root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the document catalog: %w", err)
+	}
+	if bytes.Contains(catalog, []byte("/AcroForm")) {
+		return nil, fmt.Errorf("signing PDFs with forms isn't supported")
+	}
+
+	sigNum, fieldNum := trailer.size, trailer.size+1
+	byteRangePlaceholder := "[0 0000000000 0000000000 0000000000]"
+
+	var update bytes.Buffer
+	update.Write(pdf)
+	if !bytes.HasSuffix(pdf, []byte("\n")) {
+		update.WriteByte('\n')
+	}
+	offsets := make(map[int]int)
+
+	// The catalog gains a form with the signature field
+	offsets[trailer.root] = update.Len()
+	fmt.Fprintf(&update, "%d 0 obj\n%s /AcroForm << /Fields [%d 0 R] /SigFlags 3 >> >>\nendobj\n",
+		trailer.root, bytes.TrimSuffix(bytes.TrimSpace(catalog), []byte(">>")), fieldNum)
+
+	offsets[sigNum] = update.Len()
+	fmt.Fprintf(&update, "%d 0 obj\n<< /Type /Sig /Filter /Adobe.PPKLite /SubFilter /adbe.pkcs7.detached /M (D:%s) /Name %s /ByteRange ",
+		sigNum, at.UTC().Format("20060102150405Z"), pdfString(s.chain[0].Subject.CommonName))
+	byteRangeAt := update.Len()
+	update.WriteString(byteRangePlaceholder)
+	update.WriteString(" /Contents ")
+	contentsAt := update.Len()
+	update.WriteString("<" + string(bytes.Repeat([]byte("0"), 2*signatureSize)) + ">")
+	contentsEnd := update.Len()
+	update.WriteString(" >>\nendobj\n")
+
+	offsets[fieldNum] = update.Len()
+	fmt.Fprintf(&update, "%d 0 obj\n<< /Type /Annot /Subtype /Widget /FT /Sig /T (Signature1) /V %d 0 R /F 132 /Rect [0 0 0 0] >>\nendobj\n",
+		fieldNum, sigNum)
+
+	// Cross-reference the new and changed objects
+	xrefAt := update.Len()
+	update.WriteString("xref\n")
+	nums := make([]int, 0, len(offsets))
+	for num := range offsets {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	for _, num := range nums {
+		fmt.Fprintf(&update, "%d 1\n%010d 00000 n\r\n", num, offsets[num])
+	}
+	fmt.Fprintf(&update, "trailer\n<< /Size %d /Root %d 0 R /Prev %d", fieldNum+1, trailer.root, trailer.xref)
+	if trailer.info != "" {
+		fmt.Fprintf(&update, " /Info %s", trailer.info)
+	}
+	fmt.Fprintf(&update, " >>\nstartxref\n%d\n%%%%EOF\n", xrefAt)
+
+	// Sign everything but the signature contents
+	signed := update.Bytes()
+	byteRange := fmt.Sprintf("[0 %010d %010d %010d]", contentsAt, contentsEnd, len(signed)-contentsEnd)
+	copy(signed[byteRangeAt:], byteRange)
+
+	digest := sha256.New()
+	digest.Write(signed[:contentsAt])
+	digest.Write(signed[contentsEnd:])
+	signature, err := s.cmsSignature(digest.Sum(nil), at)
+	if err != nil {
+		return nil, err
+	}
+	if len(signature) > signatureSize {
+		return nil, fmt.Errorf("signature of %d bytes exceeds the %d bytes reserved for it", len(signature), signatureSize)
+	}
+	copy(signed[contentsAt+1:], hex.EncodeToString(signature))
+	return signed, nil
+}
+
+// pdfTrailer is what signing needs from the trailer of a PDF
+type pdfTrailer struct {
+	root int    // Object number of the document catalog
+	size int    // Number of objects, the next free object number
+	info string // Reference to the document information, if any
+	xref int    // Offset of the last cross-reference section
+}
+
+var (
+	startxrefPattern = regexp.MustCompile(`startxref\s+(\d+)\s+%%EOF\s*$`)
+	rootPattern      = regexp.MustCompile(`/Root\s+(\d+)\s+0\s+R`)
+	sizePattern      = regexp.MustCompile(`/Size\s+(\d+)`)
+	infoPattern      = regexp.MustCompile(`/Info\s+(\d+\s+\d+\s+R)`)
+)
+
+// readPDFTrailer reads the trailer of the last cross-reference section, which is either a
+// table followed by a trailer dictionary or a cross-reference stream with the same entries
+func readPDFTrailer(pdf []byte) (*pdfTrailer, error) {
+	match := startxrefPattern.FindSubmatch(pdf)
+	if match == nil {
+		return nil, fmt.Errorf("not a PDF file: no startxref at the end")
+	}
+	xref, _ := strconv.Atoi(string(match[1]))
+	if xref >= len(pdf) {
+		return nil, fmt.Errorf("invalid startxref offset %d", xref)
+	}
+
+	section := pdf[xref:]
+	if end := bytes.Index(section, []byte("startxref")); end >= 0 {
+		section = section[:end]
+	}
+	if bytes.HasPrefix(section, []byte("xref")) {
+		trailerAt := bytes.Index(section, []byte("trailer"))
+		if trailerAt < 0 {
+			return nil, fmt.Errorf("no trailer after the cross-reference table")
+		}
+		section = section[trailerAt:]
+	} else if streamAt := bytes.Index(section, []byte("stream")); streamAt >= 0 {
+		section = section[:streamAt]
+	}
+
+	root := rootPattern.FindSubmatch(section)
+	size := sizePattern.FindSubmatch(section)
+	if root == nil || size == nil {
+		return nil, fmt.Errorf("trailer has no /Root or /Size")
+	}
+	trailer := &pdfTrailer{xref: xref}
+	trailer.root, _ = strconv.Atoi(string(root[1]))
+	trailer.size, _ = strconv.Atoi(string(size[1]))
+	if info := infoPattern.FindSubmatch(section); info != nil {
+		trailer.info = string(info[1])
+	}
+	return trailer, nil
+}
+
+// readPDFObject returns the dictionary of an uncompressed object, using its last definition
+func readPDFObject(pdf []byte, num int) ([]byte, error) {
+	pattern := regexp.MustCompile(fmt.Sprintf(`(?:^|[\r\n])%d 0 obj\s*`, num))
+	matches := pattern.FindAllIndex(pdf, -1)
+	if matches == nil {
+		return nil, fmt.Errorf("object %d not found, it may be in a compressed object stream", num)
+	}
+	body := pdf[matches[len(matches)-1][1]:]
+	if !bytes.HasPrefix(body, []byte("<<")) {
+		return nil, fmt.Errorf("object %d is not a dictionary", num)
+	}
+
+	// Find the end of the dictionary, which may contain nested dictionaries
+	depth := 0
+	for i := 0; i+1 < len(body); i++ {
+		switch {
+		case body[i] == '<' && body[i+1] == '<':
+			depth++
+			i++
+		case body[i] == '>' && body[i+1] == '>':
+			depth--
+			i++
+			if depth == 0 {
+				return body[:i+1], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("object %d has an unterminated dictionary", num)
+}
+
+// pdfString encodes text as a PDF literal string
+func pdfString(s string) string {
+	var b bytes.Buffer
+	b.WriteByte('(')
+	for _, c := range []byte(s) {
+		if c == '(' || c == ')' || c == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(c)
+	}
+	b.WriteByte(')')
+	return b.String()
+}
+
+// CMS structures of a detached signature, RFC 5652
+type (
+	cmsContentInfo struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue // Explicitly tagged [0]
+	}
+	cmsSignedData struct {
+		Version          int
+		DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+		EncapContentInfo cmsEncapContentInfo
+		Certificates     asn1.RawValue   `asn1:"optional,tag:0"`
+		SignerInfos      []cmsSignerInfo `asn1:"set"`
+	}
+	cmsEncapContentInfo struct {
+		ContentType asn1.ObjectIdentifier
+	}
+	cmsSignerInfo struct {
+		Version            int
+		SID                cmsIssuerAndSerial
+		DigestAlgorithm    pkix.AlgorithmIdentifier
+		SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+		SignatureAlgorithm pkix.AlgorithmIdentifier
+		Signature          []byte
+	}
+	cmsIssuerAndSerial struct {
+		Issuer asn1.RawValue
+		Serial *big.Int
+	}
+	cmsAttribute struct {
+		Type   asn1.ObjectIdentifier
+		Values asn1.RawValue
+	}
+)
+
+// cmsSignature builds a DER encoded CMS SignedData signing the SHA-256 digest of the document
+func (s *pdfSigner) cmsSignature(digest []byte, at time.Time) ([]byte, error) {
+	cert := s.chain[0]
+
+	// The signature covers the signed attributes, which include the document digest
+	attrs, err := cmsSignedAttributes(digest, at)
+	if err != nil {
+		return nil, err
+	}
+	attrsDigest := sha256.Sum256(attrs)
+
+	var signatureAlgorithm pkix.AlgorithmIdentifier
+	switch s.key.(type) {
+	case *rsa.PrivateKey:
+		signatureAlgorithm = pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue}
+	case *ecdsa.PrivateKey:
+		signatureAlgorithm = pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256}
+	}
+	signature, err := s.key.Sign(rand.Reader, attrsDigest[:], crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign: %w", err)
+	}
+
+	var certs []byte
+	for _, c := range s.chain {
+		certs = append(certs, c.Raw...)
+	}
+
+	// The signed attributes are stored with an implicit tag instead of the SET tag they were signed with
+	signedAttrs := asn1.RawValue{FullBytes: append([]byte{0xA0}, attrs[1:]...)}
+
+	signedData, err := asn1.Marshal(cmsSignedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: oidSHA256}},
+		EncapContentInfo: cmsEncapContentInfo{ContentType: oidData},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certs},
+		SignerInfos: []cmsSignerInfo{{
+			Version:            1,
+			SID:                cmsIssuerAndSerial{Issuer: asn1.RawValue{FullBytes: cert.RawIssuer}, Serial: cert.SerialNumber},
+			DigestAlgorithm:    pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+			SignedAttrs:        signedAttrs,
+			SignatureAlgorithm: signatureAlgorithm,
+			Signature:          signature,
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(cmsContentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signedData},
+	})
+}
+
+// cmsSignedAttributes returns the DER encoded SET of the content type, signing time and
+// message digest attributes, sorted by their encoding as DER requires
+func cmsSignedAttributes(digest []byte, at time.Time) ([]byte, error) {
+	values := []struct {
+		oid   asn1.ObjectIdentifier
+		value any
+	}{
+		{oidContentType, oidData},
+		{oidSigningTime, at.UTC()},
+		{oidMessageDigest, digest},
+	}
+
+	var encoded [][]byte
+	for _, v := range values {
+		value, err := asn1.Marshal(v.value)
+		if err != nil {
+			return nil, err
+		}
+		attr, err := asn1.Marshal(cmsAttribute{Type: v.oid, Values: asn1.RawValue{FullBytes: wrapDER(0x31, value)}})
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, attr)
+	}
+	sort.Slice(encoded, func(i, j int) bool { return bytes.Compare(encoded[i], encoded[j]) < 0 })
+	return wrapDER(0x31, bytes.Join(encoded, nil)), nil
+}
+
+// wrapDER encodes content with the given tag and a DER length
+func wrapDER(tag byte, content []byte) []byte {
+	out := []byte{tag}
+	switch n := len(content); {
+	case n < 0x80:
+		out = append(out, byte(n))
+	case n < 0x100:
+		out = append(out, 0x81, byte(n))
+	case n < 0x10000:
+		out = append(out, 0x82, byte(n>>8), byte(n))
+	default:
+		out = append(out, 0x83, byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(out, content...)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"screenshot-tool/config"
+	"screenshot-tool/delivery"
+	"screenshot-tool/screenshot"
+)
+
+// Limits that keep pull request comments short
+const (
+	reviewMaxRows       = 20 // Viewports listed individually
+	reviewMaxThumbnails = 10 // Diff images and diagnostic screenshots shown inline
+	reviewThumbnailSize = 320
+)
+
+// reviewHook returns a callback that sets the commit status of a finished CI run and comments
+// on its pull or merge request, or nil if reviews aren't configured or the run has nothing to report
+// on, e.g. outside CI
+func reviewHook(ctx context.Context, cfg *config.Config) func(*screenshot.RunSummary) {
+	if cfg.Review == nil {
+		return nil
+	}
+
+	reviewer, err := delivery.NewReviewer(*cfg.Review)
+	if err != nil {
+		log.Printf("Warning: Not reporting the run on %s: %v", cfg.Review.Type, err)
+		return nil
+	}
+
+	links := newArtifactLinks(cfg)
+
+	return func(summary *screenshot.RunSummary) {
+		// Still report runs that ended because of a shutdown
+		ctx := context.WithoutCancel(ctx)
+
+		state := "success"
+		if summary.Status == "failed" {
+			state = "failure"
+		}
+		description := fmt.Sprintf("%d URLs: %d passed, %d failed, %d quarantined",
+			summary.Total, summary.Passed, summary.Failed, summary.Quarantined)
+		if err := reviewer.SetStatus(ctx, state, description); err != nil {
+			log.Printf("ERROR: Failed to set commit status on %s: %v", reviewer.Target(), err)
+		} else {
+			log.Printf("Set commit status %s on %s", state, reviewer.Target())
+		}
+
+		if cfg.Review.Comment == "never" {
+			return
+		}
+		create := cfg.Review.Comment == "always" || summary.Status == "failed"
+		body := reviewComment(summary, links, reviewer)
+		if err := reviewer.Comment(ctx, body, create); err != nil {
+			log.Printf("ERROR: Failed to comment on %s: %v", reviewer.Target(), err)
+		}
+	}
+}
+
+// reviewComment describes a run in Markdown for a pull or merge request: the counts, a link
+// to the report, and a row for each viewport that didn't pass with its diff image or
+// diagnostic screenshot if the uploaded artifacts are public, or a link to it otherwise
+func reviewComment(summary *screenshot.RunSummary, links artifactLinks, reviewer delivery.Reviewer) string {
+	var b strings.Builder
+
+	title := fmt.Sprintf("✅ Screenshots of %s passed", runTitle(summary.Run, summary.Label))
+	if summary.Status == "failed" {
+		title = fmt.Sprintf("❌ Screenshots of %s failed", runTitle(summary.Run, summary.Label))
+	}
+	fmt.Fprintf(&b, "### %s\n\n", title)
+	fmt.Fprintf(&b, "%d URLs: %d passed, %d failed, %d quarantined, in %v\n",
+		summary.Total, summary.Passed, summary.Failed, summary.Quarantined,
+		summary.FinishedAt.Sub(summary.StartedAt).Round(time.Second))
+	if reportURL := reviewer.ReportURL(); reportURL != "" {
+		fmt.Fprintf(&b, "\n[View the report](%s)\n", reportURL)
+	}
+	if summary.Error != "" {
+		fmt.Fprintf(&b, "\n**Error:** %s\n", firstLine(summary.Error))
+	}
+
+	rows, more, thumbnails := 0, 0, 0
+	for _, result := range summary.URLs {
+		if result.Status == "passed" {
+			continue
+		}
+
+		for _, row := range reviewRows(summary, result, links, reviewer) {
+			if rows == reviewMaxRows {
+				more++
+				continue
+			}
+			if rows == 0 {
+				b.WriteString("\n| URL | Viewport | Result | Image |\n|-----|----------|--------|-------|\n")
+			}
+			rows++
+
+			image := ""
+			if row.image != "" && thumbnails < reviewMaxThumbnails {
+				image = fmt.Sprintf(`<a href="%s"><img src="%s" width="%d"></a>`, row.image, row.image, reviewThumbnailSize)
+				thumbnails++
+			} else if row.link != "" {
+				image = fmt.Sprintf("[%s](%s)", path.Base(row.link), row.link)
+			}
+			fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", markdownCell(result.Name), row.viewport, markdownCell(row.result), image)
+		}
+	}
+	if more > 0 {
+		fmt.Fprintf(&b, "\n…and %d more viewports that didn't pass\n", more)
+	}
+	return b.String()
+}
+
+// reviewRow is a viewport listed in a pull or merge request comment
+type reviewRow struct {
+	viewport string
+	result   string
+	image    string // Public URL of the diff image or diagnostic screenshot, if any
+	link     string // Uploaded location of the image or report, or its page in the CI job's artifacts
+}
+
+// reviewRows returns the viewports of a URL that didn't pass. A URL without a manifest,
+// whose capture failed before any viewport was captured, has a single row with its error.
+func reviewRows(summary *screenshot.RunSummary, result screenshot.URLResult, links artifactLinks, reviewer delivery.Reviewer) []reviewRow {
+	// Link the uploaded artifacts, or the CI job's if they aren't uploaded
+	locate := func(rel string) string {
+		if rel == "" {
+			return ""
+		}
+		if location := links.location(summary.OutputDir, rel); location != "" {
+			return location
+		}
+		return reviewer.ArtifactURL(filepath.Join(summary.OutputDir, filepath.FromSlash(rel)))
+	}
+
+	prefix := ""
+	if result.Status == "quarantined" {
+		prefix = "quarantined: "
+	}
+
+	var manifest *screenshot.Manifest
+	if result.Dir != "" {
+		manifest, _ = readManifest(filepath.Join(summary.OutputDir, filepath.FromSlash(result.Dir)))
+	}
+	if manifest == nil {
+		return []reviewRow{{viewport: "-", result: prefix + firstLine(result.Error), link: locate(result.Manifest)}}
+	}
+
+	var rows []reviewRow
+	for _, vm := range manifest.Viewports {
+		viewportName := fmt.Sprintf("%dx%d", vm.Width, vm.Height)
+		row := reviewRow{viewport: viewportName}
+
+		var image string
+		switch {
+		case vm.Diff != nil && vm.Diff.Status == "mismatch":
+			row.result = prefix + "changed, " + vm.Diff.Score()
+			image = vm.Diff.Triptych
+		case vm.Failure != nil:
+			row.result = prefix + vm.Failure.Stage + " failed"
+			if len(vm.Failure.Errors) > 0 {
+				row.result += ": " + vm.Failure.Errors[0]
+			}
+			image = vm.Failure.Screenshot
+		default:
+			continue
+		}
+
+		if image != "" {
+			rel := path.Join(result.Dir, viewportName, image)
+			row.image = links.public(summary.OutputDir, rel)
+			row.link = locate(rel)
+		} else {
+			row.link = locate(result.Manifest)
+		}
+		rows = append(rows, row)
+	}
+
+	// The URL failed without a viewport failing, e.g. on a timeout
+	if len(rows) == 0 {
+		rows = append(rows, reviewRow{viewport: "-", result: prefix + firstLine(result.Error), link: locate(result.Manifest)})
+	}
+	return rows
+}
+
+// markdownCell makes text fit in a cell of a Markdown table
+func markdownCell(text string) string {
+	return strings.ReplaceAll(strings.Join(strings.Fields(text), " "), "|", `\|`)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// runLogTee copies the log output to the log files of the runs in progress
+type runLogTee struct {
+	mu    sync.Mutex
+	files map[*os.File]bool
+}
+
+// runLogs is the log output while run logs are written
+var runLogs = &runLogTee{files: make(map[*os.File]bool)}
+
+var installRunLogs sync.Once
+
+// Write writes a log line to stderr and every open run log
+func (t *runLogTee) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for file := range t.files {
+		// A full disk shouldn't stop the capture, the line still reaches stderr
+		file.Write(p)
+	}
+	return os.Stderr.Write(p)
+}
+
+// startRunLog copies everything logged until the returned function is called to
+// path, creating its directory. Concurrent runs each get all lines logged while they run.
+// If the file can't be created, a warning is logged and nothing is copied.
+func startRunLog(path string) func() {
+	installRunLogs.Do(func() { log.SetOutput(runLogs) })
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		log.Printf("Warning: Failed to create run log %s: %v", path, err)
+		return func() {}
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Printf("Warning: Failed to create run log %s: %v", path, err)
+		return func() {}
+	}
+
+	runLogs.mu.Lock()
+	runLogs.files[file] = true
+	runLogs.mu.Unlock()
+
+	return func() {
+		runLogs.mu.Lock()
+		delete(runLogs.files, file)
+		runLogs.mu.Unlock()
+		file.Close()
+	}
+}
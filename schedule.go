@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"screenshot-tool/config"
+	"screenshot-tool/screenshot"
+)
+
+// runSchedule implements the schedule command, which keeps running and captures
+// each schedule's URLs into a dated run directory whenever its cron expression matches
+func runSchedule(args []string) {
+	flags := flag.NewFlagSet("schedule", flag.ExitOnError)
+	configPath := flags.String("config", "config.json", "Path to configuration file")
+	chromeMode := flags.String("chrome", "auto", "Chrome execution mode: 'local', 'docker', or 'auto'")
+	flags.Parse(args)
+
+	if *chromeMode != "auto" && *chromeMode != "local" && *chromeMode != "docker" {
+		log.Fatalf("Invalid chrome mode: %s. Must be 'auto', 'local', or 'docker'", *chromeMode)
+	}
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	cfg.ChromeMode = *chromeMode
+	logConfigWarnings(cfg)
+
+	if len(cfg.Schedules) == 0 {
+		log.Fatalf("No schedules configured. Add schedules to the config file to use the schedule command.")
+	}
+
+	journal, err := openJournal(cfg)
+	if err != nil {
+		log.Fatalf("Failed to open delivery journal: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	afterURL := uploadHook(ctx, cfg, journal)
+	catalog := catalogHook(cfg)
+	notify := notifyHook(ctx, cfg, journal)
+	alert := alertHook(ctx, cfg, journal)
+
+	// Stop scheduling on signal, letting running captures be cancelled
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signalChan
+		log.Printf("Received signal: %v, shutting down gracefully", sig)
+		cancel()
+	}()
+
+	var wg sync.WaitGroup
+	for _, schedule := range cfg.Schedules {
+		afterRun := chainRunHooks(catalog, notify, alert, issueHook(ctx, cfg, schedule))
+
+		wg.Add(1)
+		go func(schedule config.Schedule) {
+			defer wg.Done()
+			runScheduleLoop(ctx, cfg, schedule, afterURL, afterRun)
+		}(schedule)
+	}
+
+	wg.Wait()
+	cleanupDockerContainer()
+}
+
+// runScheduleLoop waits for each matching time of a schedule and captures its URLs.
+// A run that is still going when the next time arrives makes the schedule skip that time.
+func runScheduleLoop(ctx context.Context, cfg *config.Config, schedule config.Schedule, afterURL func(config.URLConfig, string), afterRun func(*screenshot.RunSummary)) {
+	for {
+		next := schedule.Parsed.Next(time.Now().In(schedule.Location))
+		if next.IsZero() {
+			log.Printf("Schedule %s never matches, stopping it", schedule.Name)
+			return
+		}
+		log.Printf("Schedule %s: next run at %s", schedule.Name, next.Format(time.RFC3339))
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		runScheduled(ctx, cfg, schedule, next, afterURL, afterRun)
+	}
+}
+
+// runScheduled captures the URLs of a schedule into outputDir/scheduleName/timestamp
+func runScheduled(ctx context.Context, cfg *config.Config, schedule config.Schedule, at time.Time, afterURL func(config.URLConfig, string), afterRun func(*screenshot.RunSummary)) {
+	runCfg := *cfg
+	runCfg.OutputDir = filepath.Join(cfg.OutputDir, schedule.Name, at.Format("20060102-150405"))
+
+	runCfg.URLs = selectURLs(cfg.URLs, schedule.URLs)
+
+	captureRun(ctx, &runCfg, "Schedule "+schedule.Name, afterURL, tagRun(afterRun, "schedule", schedule.Name), nil)
+}
+
+// selectURLs returns the URLs with the given names in configuration order, or all URLs if no names are given
+func selectURLs(urls []config.URLConfig, names []string) []config.URLConfig {
+	if len(names) == 0 {
+		return urls
+	}
+
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+	var selected []config.URLConfig
+	for _, urlConfig := range urls {
+		if wanted[urlConfig.Name] {
+			selected = append(selected, urlConfig)
+		}
+	}
+	return selected
+}
+
+// chainRunHooks combines run summary callbacks, skipping nil ones. It returns nil if all are nil.
+func chainRunHooks(hooks ...func(*screenshot.RunSummary)) func(*screenshot.RunSummary) {
+	var set []func(*screenshot.RunSummary)
+	for _, hook := range hooks {
+		if hook != nil {
+			set = append(set, hook)
+		}
+	}
+	if len(set) == 0 {
+		return nil
+	}
+
+	return func(summary *screenshot.RunSummary) {
+		for _, hook := range set {
+			hook(summary)
+		}
+	}
+}
+
+// tagRun returns a callback that records the kind and schedule of a run in its
+// summary before passing it on to afterRun, or nil if afterRun is nil
+func tagRun(afterRun func(*screenshot.RunSummary), kind, schedule string) func(*screenshot.RunSummary) {
+	if afterRun == nil {
+		return nil
+	}
+	return func(summary *screenshot.RunSummary) {
+		summary.Kind, summary.Schedule = kind, schedule
+		afterRun(summary)
+	}
+}
+
+// captureRun captures the URLs of a run whose output directory was set by the caller,
+// logging the outcome with the given label. afterRun, if set, is called with the run
+// summary once the run finished or failed. Everything logged during the run is also
+// written to run.log in its output directory. It returns the error of a failed run.
+func captureRun(ctx context.Context, runCfg *config.Config, label string, afterURL func(config.URLConfig, string), afterRun func(*screenshot.RunSummary), onProgress func(screenshot.ProgressEvent)) error {
+	defer startRunLog(filepath.Join(runCfg.OutputDir, "run.log"))()
+
+	screenshoter := screenshot.NewScreenshoter(runCfg)
+	screenshoter.AfterURL = afterURL
+	screenshoter.OnProgress = onProgress
+	startTime := time.Now()
+
+	err := func() error {
+		if err := screenshoter.Preflight(); err != nil {
+			log.Printf("%s: skipping run, disk space preflight failed: %v", label, err)
+			return fmt.Errorf("disk space preflight failed: %w", err)
+		}
+
+		log.Printf("%s: capturing %d URLs to %s", label, len(runCfg.URLs), runCfg.OutputDir)
+		if err := screenshoter.CaptureURLs(ctx); err != nil {
+			log.Printf("%s: capture failed after %v: %v", label, time.Since(startTime), err)
+			return err
+		}
+		log.Printf("%s: capture completed successfully in %v", label, time.Since(startTime))
+		return nil
+	}()
+
+	if afterRun != nil {
+		afterRun(screenshoter.Summary(label, startTime, err))
+	}
+	return err
+}
@@ -0,0 +1,235 @@
+package screenshot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"screenshot-tool/config"
+
+	"github.com/chromedp/cdproto/accessibility"
+	"github.com/chromedp/cdproto/dom"
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+)
+
+// AccessibilityReport lists the accessibility violations found on a page
+type AccessibilityReport struct {
+	URL        string                   `json:"url"`
+	Viewport   string                   `json:"viewport"`
+	Engine     string                   `json:"engine"` // "axe-core <version>" or "built-in"
+	AuditedAt  time.Time                `json:"auditedAt"`
+	Violations []AccessibilityViolation `json:"violations"`
+}
+
+// AccessibilityViolation is a failed rule and the elements that fail it
+type AccessibilityViolation struct {
+	Rule        string   `json:"rule"`
+	Impact      string   `json:"impact"` // "minor", "moderate", "serious" or "critical"
+	Description string   `json:"description"`
+	HelpURL     string   `json:"helpUrl,omitempty"`
+	Elements    []string `json:"elements"` // Selectors or descriptions of the failing elements
+}
+
+// AccessibilitySummary is recorded in the manifest for each audited viewport
+type AccessibilitySummary struct {
+	Engine     string `json:"engine"`
+	Violations int    `json:"violations"` // Number of failed rules
+	Elements   int    `json:"elements"`   // Number of failing elements across all rules
+	Report     string `json:"report"`     // Report file, relative to the viewport directory
+}
+
+// axeRunScript runs axe-core and reduces its results to the report format
+const axeRunScript = `axe.run(document, {resultTypes: ['violations']}).then((results) => ({
+	engine: 'axe-core ' + (results.testEngine ? results.testEngine.version : axe.version),
+	violations: results.violations.map((v) => ({
+		rule: v.id,
+		impact: v.impact || 'minor',
+		description: v.help,
+		helpUrl: v.helpUrl,
+		elements: v.nodes.map((n) => n.target.join(' ')),
+	})),
+}))`
+
+// builtinRule is a check on the accessibility tree: nodes with one of the
+// roles fail when the browser computed no accessible name for them
+type builtinRule struct {
+	rule        string
+	impact      string
+	description string
+	roles       []string
+}
+
+var builtinRules = []builtinRule{
+	{"image-alt", "critical", "Images must have alternate text", []string{"image", "img"}},
+	{"button-name", "critical", "Buttons must have discernible text", []string{"button"}},
+	{"link-name", "serious", "Links must have discernible text", []string{"link"}},
+	{"label", "critical", "Form elements must have labels",
+		[]string{"textbox", "searchbox", "combobox", "listbox", "checkbox", "radio", "spinbutton", "slider", "switch"}},
+	{"document-title", "serious", "Documents must have a title", []string{"RootWebArea"}},
+}
+
+// auditAccessibility audits the loaded page and writes the report to path
+func auditAccessibility(ctx context.Context, audit *config.Accessibility, urlConfig config.URLConfig, viewport config.Viewport, path string) (*AccessibilitySummary, error) {
+	report := &AccessibilityReport{
+		URL:       urlConfig.URL,
+		Viewport:  fmt.Sprintf("%dx%d", viewport.Width, viewport.Height),
+		AuditedAt: time.Now(),
+	}
+
+	var err error
+	if audit.AxeScript != "" {
+		err = runAxe(ctx, audit.AxeScript, report)
+	} else {
+		err = runBuiltinAudit(ctx, report)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode accessibility report: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write accessibility report: %w", err)
+	}
+
+	summary := &AccessibilitySummary{Engine: report.Engine, Violations: len(report.Violations)}
+	for _, v := range report.Violations {
+		summary.Elements += len(v.Elements)
+	}
+	log.Printf("Accessibility audit of %s at viewport %s with %s: %d violations affecting %d elements, report written to %s",
+		urlConfig.Name, report.Viewport, report.Engine, summary.Violations, summary.Elements, path)
+	return summary, nil
+}
+
+// runAxe injects axe-core into the page and runs it
+func runAxe(ctx context.Context, scriptPath string, report *AccessibilityReport) error {
+	script, err := os.ReadFile(scriptPath)
+	if err != nil {
+		return fmt.Errorf("failed to read axe-core script: %w", err)
+	}
+
+	var result struct {
+		Engine     string                   `json:"engine"`
+		Violations []AccessibilityViolation `json:"violations"`
+	}
+	err = chromedp.Run(ctx,
+		chromedp.Evaluate(string(script), nil),
+		chromedp.Evaluate(axeRunScript, &result, func(p *runtime.EvaluateParams) *runtime.EvaluateParams {
+			return p.WithAwaitPromise(true)
+		}),
+	)
+	if err != nil {
+		return fmt.Errorf("axe-core audit failed: %w", err)
+	}
+
+	report.Engine = result.Engine
+	report.Violations = result.Violations
+	return nil
+}
+
+// runBuiltinAudit checks the browser's accessibility tree for elements without accessible names
+func runBuiltinAudit(ctx context.Context, report *AccessibilityReport) error {
+	report.Engine = "built-in"
+
+	var lang string
+	err := chromedp.Run(ctx,
+		chromedp.Evaluate(`document.documentElement.lang || ''`, &lang),
+		chromedp.ActionFunc(func(ctx context.Context) error {
+			nodes, err := accessibility.GetFullAXTree().Do(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to read accessibility tree: %w", err)
+			}
+
+			for _, rule := range builtinRules {
+				var elements []string
+				for _, node := range nodes {
+					if node.Ignored || !slices.Contains(rule.roles, axValue(node.Role)) {
+						continue
+					}
+					if strings.TrimSpace(axValue(node.Name)) != "" {
+						continue
+					}
+					elements = append(elements, describeAXNode(ctx, node))
+				}
+
+				if len(elements) > 0 {
+					report.Violations = append(report.Violations, AccessibilityViolation{
+						Rule:        rule.rule,
+						Impact:      rule.impact,
+						Description: rule.description,
+						Elements:    elements,
+					})
+				}
+			}
+			return nil
+		}),
+	)
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(lang) == "" {
+		report.Violations = append(report.Violations, AccessibilityViolation{
+			Rule:        "html-has-lang",
+			Impact:      "serious",
+			Description: "The html element must have a lang attribute",
+			Elements:    []string{"html"},
+		})
+	}
+
+	if report.Violations == nil {
+		report.Violations = []AccessibilityViolation{}
+	}
+	return nil
+}
+
+// axValue returns the string form of an accessibility value
+func axValue(v *accessibility.Value) string {
+	if v == nil || len(v.Value) == 0 {
+		return ""
+	}
+	var s string
+	if err := json.Unmarshal(v.Value, &s); err != nil {
+		return strings.Trim(string(v.Value), `"`)
+	}
+	return s
+}
+
+// describeAXNode identifies the DOM element behind an accessibility node as tag#id.class
+func describeAXNode(ctx context.Context, node *accessibility.Node) string {
+	if node.BackendDOMNodeID == 0 {
+		return axValue(node.Role)
+	}
+
+	domNode, err := dom.DescribeNode().WithBackendNodeID(node.BackendDOMNodeID).Do(ctx)
+	if err != nil {
+		return fmt.Sprintf("%s (backend node %d)", axValue(node.Role), node.BackendDOMNodeID)
+	}
+
+	var b strings.Builder
+	b.WriteString(strings.ToLower(domNode.LocalName))
+	if b.Len() == 0 {
+		b.WriteString(strings.ToLower(domNode.NodeName))
+	}
+	for i := 0; i+1 < len(domNode.Attributes); i += 2 {
+		switch domNode.Attributes[i] {
+		case "id":
+			b.WriteString("#" + domNode.Attributes[i+1])
+		case "class":
+			for _, class := range strings.Fields(domNode.Attributes[i+1]) {
+				b.WriteString("." + class)
+			}
+		case "src", "href":
+			b.WriteString(fmt.Sprintf("[%s=%q]", domNode.Attributes[i], domNode.Attributes[i+1]))
+		}
+	}
+	return b.String()
+}
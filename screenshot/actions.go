@@ -0,0 +1,157 @@
+package screenshot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"screenshot-tool/config"
+)
+
+// actionCapture is where actions that take screenshots write them. It is only
+// given to the viewport capture so the screenshots are taken once per viewport.
+type actionCapture struct {
+	s           *Screenshoter
+	viewport    config.Viewport
+	viewportDir string
+	timestamp   string
+	vm          *ViewportManifest
+}
+
+// capturesScreenshots reports whether an action takes screenshots
+func capturesScreenshots(action config.Action) bool {
+	return action.CapturePrintable != nil || action.TabThrough != nil
+}
+
+// presentScript reports whether a selector matches an element
+const presentScript = `return document.querySelector(arguments[0]) !== null`
+
+// hoverTargetScript scrolls the element matching a selector into view and returns its center
+const hoverTargetScript = `const el = document.querySelector(arguments[0]);
+el.scrollIntoView({block: 'nearest', inline: 'nearest'});
+const rect = el.getBoundingClientRect();
+return [rect.left + rect.width / 2, rect.top + rect.height / 2]`
+
+// runActions performs the configured pre-capture interactions in order. Actions that
+// take screenshots are skipped unless a capture target is given, and on engines without
+// the DevTools protocol they need.
+func runActions(ctx context.Context, engine BrowserEngine, urlConfig config.URLConfig, capture *actionCapture) error {
+	timeout := time.Duration(urlConfig.WaitTimeout) * time.Millisecond
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+
+	for i, action := range urlConfig.Actions {
+		if capturesScreenshots(action) && capture == nil {
+			continue
+		}
+
+		log.Printf("Running action %d/%d on %s: %s", i+1, len(urlConfig.Actions), urlConfig.Name, describeAction(action))
+
+		var err error
+		if capturesScreenshots(action) {
+			dt, ok := engine.(devToolsEngine)
+			if !ok {
+				log.Printf("Warning: Skipping action %d (%s) on %s, it needs the Chrome DevTools protocol", i+1, describeAction(action), urlConfig.Name)
+				continue
+			}
+			err = runCaptureAction(dt.devTools(), urlConfig, action, capture)
+		} else {
+			err = runAction(ctx, engine, action, timeout)
+		}
+		if err != nil {
+			return fmt.Errorf("action %d (%s) failed: %w", i+1, describeAction(action), err)
+		}
+
+		// Give the page a moment to react to the interaction
+		if err := sleepContext(ctx, 300*time.Millisecond); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// runAction performs a single interaction. Each action waits for its element for up to
+// the timeout, so a missing element doesn't hang the capture.
+func runAction(ctx context.Context, engine BrowserEngine, action config.Action, timeout time.Duration) error {
+	waitFor := func(selector string) error {
+		if err := pollScript(ctx, engine, presentScript, selector, timeout); err != nil {
+			return fmt.Errorf("no element matches %q after %v: %w", selector, timeout, err)
+		}
+		return nil
+	}
+
+	switch {
+	case action.Click != "":
+		if err := waitFor(action.Click); err != nil {
+			return err
+		}
+		return engine.Click(action.Click)
+
+	case action.Type != nil:
+		if err := waitFor(action.Type.Selector); err != nil {
+			return err
+		}
+		return engine.Type(action.Type.Selector, action.Type.Text)
+
+	case action.ScrollTo != "":
+		if err := waitFor(action.ScrollTo); err != nil {
+			return err
+		}
+		return engine.Evaluate(`document.querySelector(arguments[0]).scrollIntoView({block: 'nearest', inline: 'nearest'})`, nil, action.ScrollTo)
+
+	case action.Hover != "":
+		if err := waitFor(action.Hover); err != nil {
+			return err
+		}
+		var center []float64
+		if err := engine.Evaluate(hoverTargetScript, &center, action.Hover); err != nil {
+			return err
+		}
+		if len(center) != 2 {
+			return fmt.Errorf("no position for %q", action.Hover)
+		}
+		return engine.MoveMouse(center[0], center[1])
+
+	case action.Wait > 0:
+		return sleepContext(ctx, time.Duration(action.Wait)*time.Millisecond)
+	}
+
+	return nil
+}
+
+// runCaptureAction performs an action that takes screenshots in the DevTools context of the tab
+func runCaptureAction(ctx context.Context, urlConfig config.URLConfig, action config.Action, capture *actionCapture) error {
+	switch {
+	case action.CapturePrintable != nil:
+		return capture.s.capturePrintable(urlConfig, action.CapturePrintable, capture).Do(ctx)
+
+	case action.TabThrough != nil:
+		return capture.s.captureFocusStops(urlConfig, action.TabThrough, capture).Do(ctx)
+	}
+
+	return nil
+}
+
+// describeAction returns a short human readable description of an action for logs
+func describeAction(action config.Action) string {
+	switch {
+	case action.Click != "":
+		return fmt.Sprintf("click %s", action.Click)
+	case action.Type != nil:
+		return fmt.Sprintf("type into %s", action.Type.Selector)
+	case action.ScrollTo != "":
+		return fmt.Sprintf("scroll to %s", action.ScrollTo)
+	case action.Hover != "":
+		return fmt.Sprintf("hover %s", action.Hover)
+	case action.Wait > 0:
+		return fmt.Sprintf("wait %dms", action.Wait)
+	case action.CapturePrintable != nil:
+		return "capture printable"
+	case action.TabThrough != nil:
+		return fmt.Sprintf("tab through up to %d focus stops", action.TabThrough.MaxStops)
+	}
+	return "none"
+}
@@ -0,0 +1,86 @@
+package screenshot
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"screenshot-tool/config"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+)
+
+// bytesPerGB is the gigabyte cloud providers bill by (1024³ bytes)
+const bytesPerGB = 1 << 30
+
+// CostEstimate is the estimated cost of a run's bandwidth and artifact storage
+type CostEstimate struct {
+	Currency string  `json:"currency"`
+	Transfer float64 `json:"transfer"` // Cost of the bytes downloaded
+	Storage  float64 `json:"storage"`  // Cost of storing the artifacts for the retention period
+	Total    float64 `json:"total"`
+}
+
+// bandwidthCounter counts the bytes a browser downloads
+type bandwidthCounter struct {
+	bytes atomic.Int64
+}
+
+// countBandwidth starts counting the encoded bytes of all responses received by the browser context
+func countBandwidth(browserCtx context.Context) *bandwidthCounter {
+	counter := &bandwidthCounter{}
+
+	chromedp.ListenTarget(browserCtx, func(ev any) {
+		if e, ok := ev.(*network.EventLoadingFinished); ok {
+			counter.bytes.Add(int64(e.EncodedDataLength))
+		}
+	})
+
+	return counter
+}
+
+// dirSize returns the total size of the files below dir
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// estimateCost prices the bytes downloaded and the artifacts stored by a run
+func estimateCost(costs *config.Costs, bytesDownloaded, artifactBytes int64) *CostEstimate {
+	estimate := &CostEstimate{
+		Currency: costs.Currency,
+		Transfer: float64(bytesDownloaded) / bytesPerGB * costs.TransferPerGB,
+		Storage:  float64(artifactBytes) / bytesPerGB * costs.StoragePerGBMonth * costs.RetentionMonths,
+	}
+	estimate.Total = estimate.Transfer + estimate.Storage
+	return estimate
+}
+
+// logBandwidth logs the bytes downloaded and stored by the URLs captured so far,
+// with the estimated cost if prices are configured
+func (s *Screenshoter) logBandwidth() {
+	s.resultsMu.Lock()
+	var downloaded, stored int64
+	for _, result := range s.results {
+		downloaded += result.BytesDownloaded
+		stored += result.ArtifactBytes
+	}
+	count := len(s.results)
+	s.resultsMu.Unlock()
+
+	log.Printf("Bandwidth: downloaded %s for %d URLs, wrote %s of artifacts", formatBytes(uint64(downloaded)), count, formatBytes(uint64(stored)))
+	if s.Config.Costs != nil {
+		estimate := estimateCost(s.Config.Costs, downloaded, stored)
+		log.Printf("Estimated cost: %.4f %s (transfer %.4f, storage %.4f for %g months)",
+			estimate.Total, estimate.Currency, estimate.Transfer, estimate.Storage, s.Config.Costs.RetentionMonths)
+	}
+}
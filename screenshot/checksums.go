@@ -0,0 +1,80 @@
+package screenshot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// checksumsFile lists the SHA-256 digests of a URL's artifacts in the format of sha256sum
+const checksumsFile = "checksums.txt"
+
+// ChecksumDir returns the SHA-256 of every file in a URL directory, keyed by its slash-separated
+// path relative to the directory. The manifest and checksum list, which record the digests, are left out.
+func ChecksumDir(urlDir string) (map[string]string, error) {
+	checksums := make(map[string]string)
+	err := filepath.Walk(urlDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(urlDir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "manifest.json" || rel == checksumsFile {
+			return nil
+		}
+
+		sum, err := fileSHA256(path)
+		if err != nil {
+			return err
+		}
+		checksums[rel] = sum
+		return nil
+	})
+	return checksums, err
+}
+
+// writeChecksums writes checksums.txt with the digests of the artifacts and the manifest,
+// so `sha256sum -c checksums.txt` in the URL directory verifies that nothing was changed
+func writeChecksums(urlDir string, checksums map[string]string) error {
+	manifestSum, err := fileSHA256(filepath.Join(urlDir, "manifest.json"))
+	if err != nil {
+		return err
+	}
+
+	paths := make([]string, 0, len(checksums))
+	for path := range checksums {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var b strings.Builder
+	for _, path := range paths {
+		fmt.Fprintf(&b, "%s  %s\n", checksums[path], path)
+	}
+	fmt.Fprintf(&b, "%s  %s\n", manifestSum, "manifest.json")
+
+	return os.WriteFile(filepath.Join(urlDir, checksumsFile), []byte(b.String()), 0644)
+}
+
+// fileSHA256 returns the hex-encoded SHA-256 of a file
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
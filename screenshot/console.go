@@ -0,0 +1,130 @@
+package screenshot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	cdplog "github.com/chromedp/cdproto/log"
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+)
+
+// consoleRecorder collects console messages and page errors from a browser
+type consoleRecorder struct {
+	mu     sync.Mutex
+	lines  []string
+	errors int
+}
+
+// recordConsole starts collecting console output of the browser context
+func recordConsole(browserCtx context.Context) *consoleRecorder {
+	rec := &consoleRecorder{}
+
+	chromedp.ListenTarget(browserCtx, func(ev any) {
+		switch e := ev.(type) {
+		case *runtime.EventConsoleAPICalled:
+			args := make([]string, 0, len(e.Args))
+			for _, arg := range e.Args {
+				args = append(args, formatRemoteObject(arg))
+			}
+			rec.add(string(e.Type), strings.Join(args, " "), stackLocation(e.StackTrace), e.Type == runtime.APITypeError)
+
+		case *runtime.EventExceptionThrown:
+			details := e.ExceptionDetails
+			text := details.Text
+			if details.Exception != nil && details.Exception.Description != "" {
+				text = details.Exception.Description
+			}
+			location := stackLocation(details.StackTrace)
+			if location == "" && details.URL != "" {
+				location = fmt.Sprintf("%s:%d:%d", details.URL, details.LineNumber+1, details.ColumnNumber+1)
+			}
+			rec.add("exception", text, location, true)
+
+		case *cdplog.EventEntryAdded:
+			// Browser messages such as failed resource loads and CSP violations
+			location := e.Entry.URL
+			if location != "" && e.Entry.LineNumber > 0 {
+				location = fmt.Sprintf("%s:%d", location, e.Entry.LineNumber+1)
+			}
+			rec.add(string(e.Entry.Source)+"/"+string(e.Entry.Level), e.Entry.Text, location, e.Entry.Level == cdplog.LevelError)
+		}
+	})
+
+	return rec
+}
+
+// add appends a message to the log
+func (r *consoleRecorder) add(level, text, location string, isError bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	line := fmt.Sprintf("%s [%s] %s", time.Now().Format("15:04:05.000"), level, text)
+	if location != "" {
+		line += " (" + location + ")"
+	}
+	r.lines = append(r.lines, line)
+	if isError {
+		r.errors++
+	}
+}
+
+// write saves the collected messages to a file
+func (r *consoleRecorder) write(path string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	content := strings.Join(r.lines, "\n")
+	if content != "" {
+		content += "\n"
+	}
+
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return err
+	}
+
+	log.Printf("Wrote %d console messages (%d errors) to %s", len(r.lines), r.errors, path)
+	return nil
+}
+
+// tail returns up to the last n collected messages
+func (r *consoleRecorder) tail(n int) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	start := max(0, len(r.lines)-n)
+	return append([]string(nil), r.lines[start:]...)
+}
+
+// formatRemoteObject renders a console argument the way DevTools would show it
+func formatRemoteObject(obj *runtime.RemoteObject) string {
+	if obj.UnserializableValue != "" {
+		return string(obj.UnserializableValue)
+	}
+	if len(obj.Value) > 0 {
+		var s string
+		if err := json.Unmarshal(obj.Value, &s); err == nil {
+			return s
+		}
+		return string(obj.Value)
+	}
+	if obj.Description != "" {
+		return obj.Description
+	}
+	return string(obj.Type)
+}
+
+// stackLocation returns the source location of the top stack frame
+func stackLocation(trace *runtime.StackTrace) string {
+	if trace == nil || len(trace.CallFrames) == 0 {
+		return ""
+	}
+	frame := trace.CallFrames[0]
+	return fmt.Sprintf("%s:%d:%d", frame.URL, frame.LineNumber+1, frame.ColumnNumber+1)
+}
@@ -0,0 +1,41 @@
+package screenshot
+
+import (
+	"context"
+
+	"screenshot-tool/config"
+
+	"github.com/chromedp/cdproto/emulation"
+	"github.com/chromedp/chromedp"
+)
+
+// maxTouchPoints is the number of touch points reported to pages of touch viewports
+const maxTouchPoints = 5
+
+// deviceMetrics sizes the page to the viewport's width and the given height, keeping the viewport's
+// mobile emulation and orientation so resizing for a capture doesn't switch the page to another layout
+func deviceMetrics(viewport config.Viewport, height int64) *emulation.SetDeviceMetricsOverrideParams {
+	return emulation.SetDeviceMetricsOverride(int64(viewport.Width), height, 1, viewport.Mobile).
+		WithScreenOrientation(screenOrientation(viewport))
+}
+
+// screenOrientation returns the primary screen orientation of the viewport
+func screenOrientation(viewport config.Viewport) *emulation.ScreenOrientation {
+	if viewport.Orientation == "landscape" {
+		return &emulation.ScreenOrientation{Type: emulation.OrientationTypeLandscapePrimary, Angle: 90}
+	}
+	return &emulation.ScreenOrientation{Type: emulation.OrientationTypePortraitPrimary, Angle: 0}
+}
+
+// emulateDevice applies the mobile, touch and orientation emulation of a viewport to the page
+func emulateDevice(viewport config.Viewport) chromedp.ActionFunc {
+	return func(ctx context.Context) error {
+		if err := deviceMetrics(viewport, int64(viewport.Height)).Do(ctx); err != nil {
+			return err
+		}
+		if viewport.Touch {
+			return emulation.SetTouchEmulationEnabled(true).WithMaxTouchPoints(maxTouchPoints).Do(ctx)
+		}
+		return nil
+	}
+}
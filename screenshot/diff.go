@@ -0,0 +1,262 @@
+package screenshot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"screenshot-tool/config"
+)
+
+// DiffResult records how a full page capture compares to its baseline
+type DiffResult struct {
+	Baseline        string  `json:"baseline"`                  // Baseline screenshot the capture was compared to
+	Status          string  `json:"status"`                    // "match", "mismatch" or "missing"
+	Mode            string  `json:"mode,omitempty"`            // "pixel", "ssim" or "phash" comparison that decided the status
+	Similarity      float64 `json:"similarity"`                // Fraction of identical pixels (0-1)
+	SSIM            float64 `json:"ssim"`                      // Structural similarity (0-1)
+	HashDistance    int     `json:"hashDistance"`              // Bits in which the perceptual hashes differ (0-64)
+	Threshold       float64 `json:"threshold,omitempty"`       // Minimum similarity, or SSIM in ssim mode, to match
+	MaxHashDistance int     `json:"maxHashDistance,omitempty"` // Largest hash distance to match in phash mode
+	Retried         bool    `json:"retried,omitempty"`         // Whether the page was re-captured after a mismatch
+	FirstAttempt    string  `json:"firstAttempt,omitempty"`    // Screenshot of the capture that triggered the retry
+	FirstSimilarity float64 `json:"firstSimilarity,omitempty"` // Similarity of the capture that triggered the retry
+	Antialiased     int     `json:"antialiased,omitempty"`     // Differing pixels ignored as anti-aliasing
+	Heatmap         string  `json:"heatmap,omitempty"`         // Image of a mismatching capture highlighting the changed pixels
+	Triptych        string  `json:"triptych,omitempty"`        // Baseline, capture and heatmap of a mismatch side by side
+}
+
+// ErrBaselineMismatch is returned when a capture doesn't match its baseline
+var ErrBaselineMismatch = errors.New("capture differs from baseline")
+
+// isMismatch reports whether a capture error consists of baseline mismatches only. The
+// errors of several viewports count as a mismatch only if each of them is one.
+func isMismatch(err error) bool {
+	if err == ErrBaselineMismatch {
+		return true
+	}
+	switch e := err.(type) {
+	case interface{ Unwrap() []error }:
+		errs := e.Unwrap()
+		for _, err := range errs {
+			if !isMismatch(err) {
+				return false
+			}
+		}
+		return len(errs) > 0
+	case interface{ Unwrap() error }:
+		return isMismatch(e.Unwrap())
+	}
+	return false
+}
+
+// baselinePath returns where the baseline screenshot of a URL and viewport is stored
+func (s *Screenshoter) baselinePath(urlConfig config.URLConfig, viewport config.Viewport) string {
+	return filepath.Join(s.Config.Diff.BaselineDir, SanitizeFilename(urlConfig.Name),
+		fmt.Sprintf("%dx%d.%s", viewport.Width, viewport.Height, s.Config.FileFormat))
+}
+
+// compareWithBaseline compares a full page screenshot to its baseline. On a
+// mismatch the page is re-captured once with the retry wait strategy if one is
+// configured, as slow third-party content is a common cause of false mismatches.
+// Sampled pages compare their first sample and are not retried. recapture takes
+// the full page screenshot again with the given settings and returns its path.
+// An error is returned if the final capture doesn't match.
+func (s *Screenshoter) compareWithBaseline(urlConfig config.URLConfig, viewport config.Viewport, viewportDir, path string, vm *ViewportManifest, recapture func(config.URLConfig) (string, error)) error {
+	diff := s.Config.Diff
+	tolerance := urlConfig.DiffTolerance
+	result := &DiffResult{Baseline: s.baselinePath(urlConfig, viewport), Mode: urlConfig.DiffMode}
+	switch result.Mode {
+	case "ssim":
+		result.Threshold = diff.SSIMThreshold
+	case "phash":
+		result.MaxHashDistance = diff.MaxHashDistance
+	default:
+		result.Mode = "pixel"
+		result.Threshold = diff.Threshold
+		if tolerance != nil && tolerance.MaxChangedPercent > 0 {
+			result.Threshold = 1 - tolerance.MaxChangedPercent/100
+		}
+	}
+	vm.Diff = result
+
+	if _, err := os.Stat(result.Baseline); os.IsNotExist(err) {
+		log.Printf("No baseline for %s at viewport %dx%d, expected %s", urlConfig.Name, viewport.Width, viewport.Height, result.Baseline)
+		result.Status = "missing"
+		return nil
+	}
+
+	if err := result.measure(path, tolerance); err != nil {
+		return fmt.Errorf("failed to compare with baseline: %w", err)
+	}
+
+	if !result.matches() && diff.Retry != nil && urlConfig.Samples <= 1 {
+		log.Printf("Capture of %s at viewport %dx%d differs from baseline (%s), retrying with alternate wait strategy",
+			urlConfig.Name, viewport.Width, viewport.Height, result.Score())
+
+		// Keep the first attempt as evidence of what the mismatch looked like
+		ext := filepath.Ext(path)
+		firstAttempt := strings.TrimSuffix(path, ext) + "-attempt-1" + ext
+		if err := os.Rename(path, firstAttempt); err != nil {
+			return fmt.Errorf("failed to keep first attempt: %w", err)
+		}
+		result.Retried = true
+		result.FirstAttempt = filepath.Base(firstAttempt)
+		result.FirstSimilarity = result.Similarity
+
+		retryPath, err := recapture(retryURLConfig(urlConfig, diff.Retry))
+		if err != nil {
+			return fmt.Errorf("failed to re-capture after mismatch: %w", err)
+		}
+
+		if err := result.measure(retryPath, tolerance); err != nil {
+			return fmt.Errorf("failed to compare retry with baseline: %w", err)
+		}
+		path = retryPath
+	}
+
+	if !result.matches() {
+		result.Status = "mismatch"
+		if err := writeDiffImages(result, path, tolerance); err != nil {
+			log.Printf("Warning: Failed to write diff images for %s at viewport %dx%d: %v",
+				urlConfig.Name, viewport.Width, viewport.Height, err)
+		}
+		return fmt.Errorf("%w %s: %s", ErrBaselineMismatch, result.Baseline, result.Score())
+	}
+
+	result.Status = "match"
+	log.Printf("Capture of %s at viewport %dx%d matches baseline (%s, retried: %v)",
+		urlConfig.Name, viewport.Width, viewport.Height, result.Score(), result.Retried)
+	return nil
+}
+
+// measure compares a screenshot with the baseline, recording the share of identical pixels
+// with the given tolerance, the structural similarity and the perceptual hash distance
+func (r *DiffResult) measure(path string, tolerance *config.DiffTolerance) error {
+	baseline, err := loadImage(r.Baseline)
+	if err != nil {
+		return fmt.Errorf("failed to load %s: %w", r.Baseline, err)
+	}
+	img, err := loadImage(path)
+	if err != nil {
+		return fmt.Errorf("failed to load %s: %w", path, err)
+	}
+
+	r.Similarity, r.Antialiased = toleratedSimilarity(baseline, img, tolerance)
+	grayBaseline, gray := toGray(baseline), toGray(img)
+	r.SSIM = structuralSimilarity(grayBaseline, gray)
+	r.HashDistance = hashDistance(perceptualHash(grayBaseline), perceptualHash(gray))
+	return nil
+}
+
+// matches reports whether the measured capture matches the baseline in the comparison mode
+func (r *DiffResult) matches() bool {
+	switch r.Mode {
+	case "ssim":
+		return r.SSIM >= r.Threshold
+	case "phash":
+		return r.HashDistance <= r.MaxHashDistance
+	default:
+		return r.Similarity >= r.Threshold
+	}
+}
+
+// Score describes the measurement that decides the match in the comparison mode
+func (r *DiffResult) Score() string {
+	switch r.Mode {
+	case "ssim":
+		return fmt.Sprintf("SSIM %.4f, threshold %.4f", r.SSIM, r.Threshold)
+	case "phash":
+		return fmt.Sprintf("hash distance %d, maximum %d", r.HashDistance, r.MaxHashDistance)
+	default:
+		return fmt.Sprintf("similarity %.4f, threshold %.4f", r.Similarity, r.Threshold)
+	}
+}
+
+// retryURLConfig applies the retry wait strategy to a URL's configuration
+func retryURLConfig(urlConfig config.URLConfig, retry *config.DiffRetry) config.URLConfig {
+	urlConfig.WaitForSelector = retry.WaitForSelector
+	urlConfig.WaitTimeout = retry.WaitTimeout
+	if retry.WaitForSelector == "" {
+		if retry.Delay > 0 {
+			urlConfig.Delay = retry.Delay
+		} else {
+			urlConfig.Delay *= 3
+		}
+	}
+	return urlConfig
+}
+
+// CopyRunToBaselines makes the full page screenshots of a run the baselines in
+// baselineDir, so the next run is compared with this one. Samples and first
+// attempts of retried captures are skipped.
+func CopyRunToBaselines(runDir, baselineDir string) error {
+	manifests, err := filepath.Glob(filepath.Join(runDir, "*", "manifest.json"))
+	if err != nil {
+		return err
+	}
+
+	urlDirs := make([]string, 0, len(manifests))
+	for _, manifestPath := range manifests {
+		urlDirs = append(urlDirs, filepath.Dir(manifestPath))
+	}
+	_, err = PromoteToBaselines(urlDirs, baselineDir)
+	return err
+}
+
+// PromoteToBaselines makes the latest full page screenshot of each viewport of the
+// URL directories the baseline in baselineDir, and returns the baselines it wrote.
+// Samples, first attempts of retried captures and failed viewports are skipped.
+func PromoteToBaselines(urlDirs []string, baselineDir string) ([]string, error) {
+	var promoted []string
+	for _, urlDir := range urlDirs {
+		manifestPath := filepath.Join(urlDir, "manifest.json")
+		data, err := os.ReadFile(manifestPath)
+		if err != nil {
+			return promoted, err
+		}
+		var manifest Manifest
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return promoted, fmt.Errorf("failed to parse %s: %w", manifestPath, err)
+		}
+
+		for _, vm := range manifest.Viewports {
+			if vm.Failure != nil {
+				continue
+			}
+			viewportName := fmt.Sprintf("%dx%d", vm.Width, vm.Height)
+			matches, _ := filepath.Glob(filepath.Join(urlDir, viewportName, fmt.Sprintf("*-full-%s.*", viewportName)))
+
+			if len(matches) == 0 {
+				continue
+			}
+
+			// File names start with a timestamp, so the last one is the latest capture
+			latest := matches[len(matches)-1]
+
+			target := filepath.Join(baselineDir, SanitizeFilename(manifest.Name), viewportName+filepath.Ext(latest))
+			if err := copyFile(latest, target); err != nil {
+				return promoted, fmt.Errorf("failed to copy %s to baselines: %w", latest, err)
+			}
+			promoted = append(promoted, target)
+		}
+	}
+
+	return promoted, nil
+}
+
+// copyFile copies a file, creating the target's directory
+func copyFile(source, target string) error {
+	data, err := os.ReadFile(source)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(target, data, 0644)
+}
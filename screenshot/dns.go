@@ -0,0 +1,29 @@
+package screenshot
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// hostResolverRules formats DNS overrides for Chrome's --host-resolver-rules flag
+func hostResolverRules(overrides map[string]string) string {
+	hosts := make([]string, 0, len(overrides))
+	for host := range overrides {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	rules := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		ip := overrides[host]
+		// IPv6 addresses must be bracketed in resolver rules
+		if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() == nil {
+			ip = "[" + ip + "]"
+		}
+		rules = append(rules, fmt.Sprintf("MAP %s %s", host, ip))
+	}
+
+	return strings.Join(rules, ", ")
+}
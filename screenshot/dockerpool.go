@@ -0,0 +1,80 @@
+package screenshot
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"screenshot-tool/config"
+)
+
+// dockerPool spreads captures over several Docker Chrome containers, named chrome-1 to
+// chrome-N, as a single container saturates at a few parallel tabs. Containers are
+// started when a capture first needs them.
+type dockerPool struct {
+	mu         sync.Mutex
+	containers []*pooledContainer
+}
+
+// pooledContainer is a Chrome container of the pool
+type pooledContainer struct {
+	name   string
+	port   int
+	active int // Captures using the container
+}
+
+// newDockerPool creates the pool of a configuration, or returns nil if it's not enabled
+func newDockerPool(pool *config.DockerPool) *dockerPool {
+	if pool == nil || !pool.Enabled {
+		return nil
+	}
+	p := &dockerPool{}
+	for i := 0; i < pool.Size; i++ {
+		p.containers = append(p.containers, &pooledContainer{
+			name: fmt.Sprintf("chrome-%d", i+1),
+			port: pool.BasePort + i,
+		})
+	}
+	return p
+}
+
+// acquire starts or connects to the container with the fewest captures and returns its
+// address. release must be called once the capture is done with it.
+func (p *dockerPool) acquire(flags []string) (address string, release func(), err error) {
+	p.mu.Lock()
+	container := p.containers[0]
+	for _, c := range p.containers[1:] {
+		if c.active < container.active {
+			container = c
+		}
+	}
+	container.active++
+	p.mu.Unlock()
+
+	release = func() {
+		p.mu.Lock()
+		container.active--
+		p.mu.Unlock()
+	}
+
+	address, err = startDockerChromeContainer(container.name, container.port, flags)
+	if err != nil {
+		release()
+		return "", nil, err
+	}
+	log.Printf("Using pooled Docker Chrome container %s", container.name)
+	return address, release, nil
+}
+
+// UsesDockerPool reports whether captures in a Chrome mode are spread over the Docker
+// Chrome pool, which replaces the shared and standby browsers
+func UsesDockerPool(cfg *config.Config, mode string) bool {
+	if cfg.DockerPool == nil || !cfg.DockerPool.Enabled || cfg.Backend == "webdriver" {
+		return false
+	}
+	if mode == "auto" || mode == "" {
+		_, err := findChromeExecutable()
+		return err != nil
+	}
+	return mode == "docker"
+}
@@ -0,0 +1,336 @@
+package screenshot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image/png"
+	"log"
+	"strings"
+	"time"
+
+	"screenshot-tool/config"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/input"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/cdproto/storage"
+	"github.com/chromedp/chromedp"
+)
+
+// BrowserEngine drives the browser of a capture. An engine is bound to the context it was
+// started with, which cancels its commands. Scripts are function bodies that read their
+// arguments from arguments and return their result, as in the WebDriver execute command.
+type BrowserEngine interface {
+	// Navigate loads a URL and waits for it to load
+	Navigate(url string) error
+	// Reload reloads the current page
+	Reload() error
+	// SetCookies sets cookies for the current page, with the host of pageURL for cookies
+	// without a domain
+	SetCookies(cookies []config.Cookie, pageURL string) error
+	// Cookies returns the browser's cookies in the form Chrome reports them
+	Cookies() ([]*network.Cookie, error)
+	// Evaluate runs a script in the page and decodes its return value into out, if not nil.
+	// A returned promise is awaited.
+	Evaluate(script string, out any, args ...any) error
+	// Click clicks the first element matching a CSS selector
+	Click(selector string) error
+	// Type focuses the first element matching a CSS selector and types text into it
+	Type(selector, text string) error
+	// MoveMouse moves the mouse to a position in the viewport
+	MoveMouse(x, y float64) error
+	// SetViewportHeight resizes the viewport to a height, keeping its width, so a
+	// screenshot of the viewport shows that much of the page
+	SetViewportHeight(height int64) error
+	// Screenshot captures the viewport in the given file format
+	Screenshot(format string, quality int) ([]byte, error)
+	// Close ends the browser session
+	Close()
+}
+
+// devToolsEngine is an engine that also exposes the Chrome DevTools protocol, which
+// emulation, network recording, tracing and the other Chrome features need. Captures
+// through other engines skip those features.
+type devToolsEngine interface {
+	BrowserEngine
+	// devTools returns the chromedp context of the engine's tab
+	devTools() context.Context
+}
+
+// newEngine starts the browser engine of a capture: the one NewEngine starts if set,
+// Firefox for URLs captured in it, and Chrome otherwise
+func (s *Screenshoter) newEngine(ctx context.Context, urlConfig config.URLConfig, viewport config.Viewport) (BrowserEngine, error) {
+	if s.NewEngine != nil {
+		return s.NewEngine(ctx, urlConfig, viewport)
+	}
+	if urlConfig.Browser == "firefox" {
+		return s.newFirefoxEngine(ctx, urlConfig, viewport)
+	}
+	browserCtx, cancel, err := s.newBrowserContext(ctx, urlConfig, viewport)
+	if err != nil {
+		return nil, err
+	}
+	return &chromeEngine{ctx: browserCtx, viewport: viewport, cancel: cancel}, nil
+}
+
+// chromeEngine is the default BrowserEngine, driving a Chrome tab with chromedp
+type chromeEngine struct {
+	ctx      context.Context    // Browser context of the tab
+	viewport config.Viewport    // Viewport the device metrics are emulated for
+	cancel   context.CancelFunc // Closes the tab and the browser started for it
+}
+
+func (e *chromeEngine) devTools() context.Context {
+	return e.ctx
+}
+
+func (e *chromeEngine) Navigate(url string) error {
+	return chromedp.Run(e.ctx, chromedp.Navigate(url))
+}
+
+func (e *chromeEngine) Reload() error {
+	return chromedp.Run(e.ctx, chromedp.Reload())
+}
+
+func (e *chromeEngine) SetCookies(cookies []config.Cookie, pageURL string) error {
+	expires := cdp.TimeSinceEpoch(time.Now().Add(180 * 24 * time.Hour))
+	return chromedp.Run(e.ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+		for _, cookie := range cookies {
+			domain := cookie.Domain
+			if domain == "" {
+				domain = extractDomainFromURL(pageURL)
+			}
+			path := cookie.Path
+			if path == "" {
+				path = "/"
+			}
+			err := network.SetCookie(cookie.Name, cookie.Value).
+				WithDomain(domain).
+				WithPath(path).
+				WithSecure(cookie.Secure).
+				WithHTTPOnly(cookie.HTTPOnly).
+				WithExpires(&expires).
+				Do(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to set cookie %s: %w", cookie.Name, err)
+			}
+		}
+		return nil
+	}))
+}
+
+func (e *chromeEngine) Cookies() ([]*network.Cookie, error) {
+	var cookies []*network.Cookie
+	err := chromedp.Run(e.ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+		var err error
+		cookies, err = storage.GetCookies().Do(ctx)
+		return err
+	}))
+	return cookies, err
+}
+
+func (e *chromeEngine) Evaluate(script string, out any, args ...any) error {
+	data, err := json.Marshal(append([]any{}, args...))
+	if err != nil {
+		return err
+	}
+	expression := fmt.Sprintf("(function() {\n%s\n}).apply(null, %s)", script, data)
+	return chromedp.Run(e.ctx, chromedp.Evaluate(expression, out, func(p *runtime.EvaluateParams) *runtime.EvaluateParams {
+		return p.WithAwaitPromise(true)
+	}))
+}
+
+func (e *chromeEngine) Click(selector string) error {
+	return chromedp.Run(e.ctx, chromedp.Click(selector, chromedp.ByQuery))
+}
+
+func (e *chromeEngine) Type(selector, text string) error {
+	return chromedp.Run(e.ctx, chromedp.SendKeys(selector, text, chromedp.ByQuery))
+}
+
+func (e *chromeEngine) MoveMouse(x, y float64) error {
+	return chromedp.Run(e.ctx, input.DispatchMouseEvent(input.MouseMoved, x, y))
+}
+
+func (e *chromeEngine) SetViewportHeight(height int64) error {
+	return chromedp.Run(e.ctx, deviceMetrics(e.viewport, height))
+}
+
+func (e *chromeEngine) Screenshot(format string, quality int) ([]byte, error) {
+	var buf []byte
+	err := chromedp.Run(e.ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+		params := page.CaptureScreenshot().WithFromSurface(true)
+		if format == "jpeg" {
+			params = params.WithFormat(page.CaptureScreenshotFormatJpeg).WithQuality(int64(quality))
+		}
+		var err error
+		buf, err = params.Do(ctx)
+		return err
+	}))
+	return buf, err
+}
+
+// Close closes the tab, and the browser if it was started for the capture
+func (e *chromeEngine) Close() {
+	e.cancel()
+}
+
+// evaluateExpression evaluates one of the JavaScript expressions the page scripts of
+// this package are written as through an engine
+func evaluateExpression(engine BrowserEngine, expression string, out any) error {
+	expression = strings.TrimSuffix(strings.TrimSpace(expression), ";")
+	return engine.Evaluate("return "+expression, out)
+}
+
+// convertPNG converts a PNG screenshot to the given file format
+func convertPNG(data []byte, format string, quality int) ([]byte, error) {
+	if format == "png" {
+		return data, nil
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid screenshot: %w", err)
+	}
+	return encodeImage(img, format, quality)
+}
+
+// loadPage loads the URL and applies its cookies and localStorage, reloading the page so
+// they take effect. Cookies are logged before and after they are set.
+func (s *Screenshoter) loadPage(ctx context.Context, engine BrowserEngine, urlConfig config.URLConfig, viewport config.Viewport, viewportDir, stage, screenshotType string) error {
+	if err := engine.Navigate(urlConfig.URL); err != nil {
+		return fmt.Errorf("failed to navigate: %w", err)
+	}
+	s.saveEngineCookies(engine, urlConfig, "before"+stage, viewportDir, viewport, screenshotType)
+
+	if len(urlConfig.Cookies) == 0 && len(urlConfig.LocalStorage) == 0 {
+		return nil
+	}
+
+	if err := engine.SetCookies(urlConfig.Cookies, urlConfig.URL); err != nil {
+		return err
+	}
+	for _, item := range urlConfig.LocalStorage {
+		if err := engine.Evaluate(`localStorage.setItem(arguments[0], arguments[1])`, nil, item.Key, item.Value); err != nil {
+			return fmt.Errorf("failed to set localStorage %s: %w", item.Key, err)
+		}
+	}
+	log.Printf("Set %d cookies and %d localStorage items for %s", len(urlConfig.Cookies), len(urlConfig.LocalStorage), urlConfig.Name)
+	s.saveEngineCookies(engine, urlConfig, "after"+stage, viewportDir, viewport, screenshotType)
+
+	log.Printf("Performing additional refresh to ensure cookies and localStorage are fully applied before %s capture", screenshotType)
+	if err := engine.Reload(); err != nil {
+		return fmt.Errorf("failed to reload: %w", err)
+	}
+	return sleepContext(ctx, time.Second)
+}
+
+// saveEngineCookies appends the browser's cookies to the cookie logs of the URL
+func (s *Screenshoter) saveEngineCookies(engine BrowserEngine, urlConfig config.URLConfig, stage, viewportDir string, viewport config.Viewport, screenshotType string) {
+	cookies, err := engine.Cookies()
+	if err != nil {
+		log.Printf("ERROR: Failed to get cookies: %v", err)
+		return
+	}
+
+	timestamp := time.Now().Format("2006-01-02 15:04:05.000")
+	if err := s.saveCookiesTextLog(cookies, urlConfig, stage, viewportDir, viewport, screenshotType, timestamp); err != nil {
+		log.Printf("ERROR: Failed to save cookies text log: %v", err)
+	}
+	if err := s.saveCookiesCSV(cookies, urlConfig, stage, viewportDir, viewport, screenshotType, timestamp); err != nil {
+		log.Printf("ERROR: Failed to save cookies CSV: %v", err)
+	}
+}
+
+// readViewProof reads the cookies and localStorage items named by the ViewProof keys,
+// which prove the state the page was captured in
+func (s *Screenshoter) readViewProof(engine BrowserEngine) map[string]string {
+	viewproofData := make(map[string]string)
+	cookies, err := engine.Cookies()
+	if err != nil {
+		log.Printf("ERROR: Failed to get cookies for viewproof: %v", err)
+		return viewproofData // Non-fatal error
+	}
+
+	for _, cookie := range cookies {
+		for _, proofKey := range s.Config.ViewProof {
+			if cookie.Name == proofKey {
+				viewproofData[fmt.Sprintf("cookie:%s", cookie.Name)] = cookie.Value
+			}
+		}
+	}
+
+	for _, proofKey := range s.Config.ViewProof {
+		var value string
+		err := engine.Evaluate(`return localStorage.getItem(arguments[0]) || ''`, &value, proofKey)
+		if err == nil && value != "" {
+			viewproofData[fmt.Sprintf("localStorage:%s", proofKey)] = value
+		}
+	}
+
+	log.Printf("Extracted %d viewproof values", len(viewproofData))
+	return viewproofData
+}
+
+// preparePage brings a loaded page into the state to capture. Actions that take
+// screenshots only run if a capture target is given.
+func (s *Screenshoter) preparePage(ctx context.Context, engine BrowserEngine, urlConfig config.URLConfig, viewport config.Viewport, capture *actionCapture) error {
+	// Wait for the page to be ready before interacting with it
+	if err := waitForReady(ctx, engine, urlConfig); err != nil {
+		return err
+	}
+
+	// Perform the configured interactions to bring the page into the state to prove
+	if len(urlConfig.Actions) > 0 {
+		if err := runActions(ctx, engine, urlConfig, capture); err != nil {
+			return err
+		}
+	}
+
+	// Replay the simulated user session if enabled
+	if sim := urlConfig.UserSimulation; sim != nil && sim.Enabled {
+		if err := simulateUser(ctx, engine, planUserSimulation(sim), viewport); err != nil {
+			return err
+		}
+	}
+
+	// Replace dynamic text with fixed placeholders
+	if len(urlConfig.Placeholders) > 0 {
+		if err := substitutePlaceholders(engine, urlConfig); err != nil {
+			return err
+		}
+	}
+
+	// Hide and mask dynamic elements so captures are reproducible
+	if len(urlConfig.HideSelectors) > 0 || len(urlConfig.MaskSelectors) > 0 {
+		if err := hideElements(engine, urlConfig); err != nil {
+			return err
+		}
+	}
+
+	// Scroll to ensure lazy content is loaded
+	for _, script := range []string{`window.scrollTo(0, document.body.scrollHeight)`, `window.scrollTo(0, 0)`} {
+		if err := engine.Evaluate(script, nil); err != nil {
+			return err
+		}
+		if err := sleepContext(ctx, 500*time.Millisecond); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sleepContext waits for a duration or until the context is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
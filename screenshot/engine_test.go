@@ -0,0 +1,389 @@
+package screenshot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"screenshot-tool/config"
+
+	"github.com/chromedp/cdproto/network"
+)
+
+// fakeEngine is a BrowserEngine rendering a blank page of a fixed height. It records
+// what a capture did with the page.
+type fakeEngine struct {
+	mu           sync.Mutex
+	width        int
+	height       int64 // Current viewport height
+	pageHeight   float64
+	scrollY      float64
+	url          string
+	reloads      int
+	cookies      map[string]string
+	localStorage map[string]string
+	clicks       []string
+	typed        map[string]string
+	mouseMoves   int
+	scripts      []string
+	closed       bool
+}
+
+func newFakeEngine(viewport config.Viewport, pageHeight float64) *fakeEngine {
+	return &fakeEngine{
+		width:        viewport.Width,
+		height:       int64(viewport.Height),
+		pageHeight:   pageHeight,
+		cookies:      make(map[string]string),
+		localStorage: make(map[string]string),
+		typed:        make(map[string]string),
+	}
+}
+
+func (f *fakeEngine) Navigate(url string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.url = url
+	f.scrollY = 0
+	return nil
+}
+
+func (f *fakeEngine) Reload() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reloads++
+	f.scrollY = 0
+	return nil
+}
+
+func (f *fakeEngine) SetCookies(cookies []config.Cookie, pageURL string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, cookie := range cookies {
+		f.cookies[cookie.Name] = cookie.Value
+	}
+	return nil
+}
+
+func (f *fakeEngine) Cookies() ([]*network.Cookie, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var cookies []*network.Cookie
+	for name, value := range f.cookies {
+		cookies = append(cookies, &network.Cookie{Name: name, Value: value, Domain: "example.com", Path: "/"})
+	}
+	return cookies, nil
+}
+
+// Evaluate answers the scripts of the capture by what they do, decoding the result
+// through JSON like the real engines
+func (f *fakeEngine) Evaluate(script string, out any, args ...any) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.scripts = append(f.scripts, script)
+
+	var result any
+	switch {
+	case strings.Contains(script, "localStorage.setItem"):
+		f.localStorage[args[0].(string)] = args[1].(string)
+	case strings.Contains(script, "localStorage.getItem"):
+		result = f.localStorage[args[0].(string)]
+	case script == pageHeightScript:
+		result = f.pageHeight
+	case script == scrollToScript:
+		f.scrollY = max(0, min(toFloat(args[0]), f.pageHeight-float64(f.height)))
+	case strings.Contains(script, "document.body.scrollHeight)"):
+		f.scrollY = max(0, f.pageHeight-float64(f.height))
+	case strings.Contains(script, "window.scrollTo(0, 0)"):
+		f.scrollY = 0
+	case script == `return window.scrollY`:
+		result = f.scrollY
+	case script == `return location.href`:
+		result = f.url
+	case script == presentScript, script == visibleScript:
+		result = true
+	case script == hoverTargetScript:
+		result = []float64{10, 20}
+	case strings.Contains(script, "__screenshot_hide_style"):
+		result = 1
+	case script == `return window.__screenshot_substitutions || []`:
+		result = []Substitution{{Selector: ".date", Original: "today", Replacement: "DATE"}}
+	case strings.Contains(script, "__screenshot_substitution"):
+		result = 1
+	case strings.Contains(script, "performance.getEntriesByType"):
+		result = PageMetrics{TTFB: 12, Requests: 3}
+	case strings.Contains(script, "super-viewproof-overlay"):
+		result = true
+	}
+
+	if out == nil {
+		return nil
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+func (f *fakeEngine) Click(selector string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.clicks = append(f.clicks, selector)
+	return nil
+}
+
+func (f *fakeEngine) Type(selector, text string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.typed[selector] += text
+	return nil
+}
+
+func (f *fakeEngine) MoveMouse(x, y float64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.mouseMoves++
+	return nil
+}
+
+func (f *fakeEngine) SetViewportHeight(height int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.height = height
+	return nil
+}
+
+// Screenshot renders the viewport, shading the rows by their position on the page
+func (f *fakeEngine) Screenshot(format string, quality int) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	img := image.NewGray(image.Rect(0, 0, f.width, int(f.height)))
+	for y := 0; y < int(f.height); y++ {
+		shade := color.Gray{Y: uint8((int(f.scrollY) + y) % 256)}
+		for x := 0; x < f.width; x++ {
+			img.SetGray(x, y, shade)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return convertPNG(buf.Bytes(), format, quality)
+}
+
+func (f *fakeEngine) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+}
+
+func toFloat(v any) float64 {
+	switch n := v.(type) {
+	case float64:
+		return n
+	case int64:
+		return float64(n)
+	case int:
+		return float64(n)
+	}
+	return 0
+}
+
+// loadTestConfig loads a configuration written to a temporary directory, so the defaults
+// apply as in a run
+func loadTestConfig(t *testing.T, data string) *config.Config {
+	t.Helper()
+	dir := t.TempDir()
+	data = strings.ReplaceAll(data, "OUTPUT_DIR", filepath.ToSlash(filepath.Join(dir, "out")))
+	path := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	return cfg
+}
+
+func imageHeight(t *testing.T, path string) int {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	img, err := png.DecodeConfig(file)
+	if err != nil {
+		t.Fatalf("decode %s: %v", path, err)
+	}
+	return img.Height
+}
+
+func TestCaptureWithViewportRunsOnEngine(t *testing.T) {
+	cfg := loadTestConfig(t, `{
+		"outputDir": "OUTPUT_DIR",
+		"fileFormat": "png",
+		"sectionMode": "sequential",
+		"viewproof": ["session", "theme"],
+		"urls": [{
+			"name": "home",
+			"url": "https://example.com/",
+			"delay": 10,
+			"viewports": [{"width": 40, "height": 300}],
+			"cookies": [{"name": "session", "value": "abc"}],
+			"localStorage": [{"key": "theme", "value": "dark"}],
+			"actions": [
+				{"click": "#accept"},
+				{"type": {"selector": "#search", "text": "shoes"}},
+				{"hover": "#menu"}
+			],
+			"hideSelectors": [".banner"],
+			"placeholders": [{"selector": ".date", "text": "DATE"}],
+			"minimap": true
+		}]
+	}`)
+	urlConfig := cfg.URLs[0]
+	viewport := urlConfig.Viewports[0]
+
+	engine := newFakeEngine(viewport, 1000)
+	s := NewScreenshoter(cfg)
+	s.NewEngine = func(ctx context.Context, urlConfig config.URLConfig, viewport config.Viewport) (BrowserEngine, error) {
+		return engine, nil
+	}
+
+	viewportDir := filepath.Join(cfg.OutputDir, "home", "40x300")
+	if err := os.MkdirAll(viewportDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	vm := &ViewportManifest{}
+	if err := s.captureWithViewport(context.Background(), urlConfig, viewport, viewportDir, true, true, vm); err != nil {
+		t.Fatalf("captureWithViewport: %v", err)
+	}
+
+	if !engine.closed {
+		t.Error("engine was not closed")
+	}
+	if engine.cookies["session"] != "abc" || engine.localStorage["theme"] != "dark" {
+		t.Errorf("cookies %v and localStorage %v were not applied", engine.cookies, engine.localStorage)
+	}
+
+	// The proof, full page and viewport captures each load the page and perform the actions
+	if len(engine.clicks) != 3 || engine.typed["#search"] != strings.Repeat("shoes", 3) || engine.mouseMoves != 3 {
+		t.Errorf("actions ran as clicks %v, typed %v and %d mouse moves, want each 3 times", engine.clicks, engine.typed, engine.mouseMoves)
+	}
+	overlays := 0
+	for _, script := range engine.scripts {
+		if strings.Contains(script, "super-viewproof-overlay") {
+			overlays++
+		}
+	}
+	if overlays != 1 {
+		t.Errorf("ViewProof overlay added %d times, want 1", overlays)
+	}
+
+	proofs, _ := filepath.Glob(filepath.Join(viewportDir, "*-full-proof-40x300.png"))
+	fulls, _ := filepath.Glob(filepath.Join(viewportDir, "*-full-40x300.png"))
+	if len(proofs) != 1 || len(fulls) != 1 {
+		t.Fatalf("got proof screenshots %v and full page screenshots %v, want one each", proofs, fulls)
+	}
+	if height := imageHeight(t, fulls[0]); height != 1000 {
+		t.Errorf("full page screenshot is %dpx high, want the page height of 1000px", height)
+	}
+
+	sections, _ := filepath.Glob(filepath.Join(viewportDir, "*-viewport-40x300-*.png"))
+	if len(sections) != 4 {
+		t.Errorf("got %d viewport sections, want 4 for a 1000px page at 300px", len(sections))
+	}
+	covered := 0
+	for _, section := range sections {
+		covered += imageHeight(t, section)
+	}
+	if covered != 1000 {
+		t.Errorf("sections cover %dpx, want the page height of 1000px", covered)
+	}
+
+	if vm.Metrics == nil || vm.Metrics.TTFB != 12 {
+		t.Errorf("metrics %+v were not recorded", vm.Metrics)
+	}
+	if len(vm.Substitutions) != 1 {
+		t.Errorf("substitutions %+v were not recorded", vm.Substitutions)
+	}
+	if vm.Failure != nil {
+		t.Errorf("unexpected failure %+v", vm.Failure)
+	}
+}
+
+func TestCaptureFullHeightPolicies(t *testing.T) {
+	viewport := config.Viewport{Width: 20, Height: 100}
+	tests := []struct {
+		policy     string
+		wantHeight int
+		truncated  bool
+		wantErr    bool
+	}{
+		{policy: "truncate", wantHeight: 500, truncated: true},
+		{policy: "stitch", wantHeight: 1200},
+		{policy: "fail", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			s := &Screenshoter{Config: &config.Config{FileFormat: "png", MaxPageHeight: 500, PageHeightPolicy: tt.policy}}
+			engine := newFakeEngine(viewport, 1200)
+
+			var buf []byte
+			truncation, err := s.captureFullHeight(context.Background(), engine, &buf)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error for a page over the maximum height")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (truncation != nil) != tt.truncated {
+				t.Errorf("truncation = %+v, want truncated %v", truncation, tt.truncated)
+			}
+
+			img, err := png.Decode(bytes.NewReader(buf))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if img.Bounds().Dy() != tt.wantHeight {
+				t.Errorf("screenshot is %dpx high, want %dpx", img.Bounds().Dy(), tt.wantHeight)
+			}
+			// Each row shows its own position on the page, so stitched segments line up
+			if y := tt.wantHeight - 1; color.GrayModel.Convert(img.At(0, y)).(color.Gray).Y != uint8(y%256) {
+				t.Errorf("row %d shows the wrong part of the page", y)
+			}
+		})
+	}
+}
+
+func TestRunActionsSkipsDevToolsActions(t *testing.T) {
+	engine := newFakeEngine(config.Viewport{Width: 20, Height: 100}, 100)
+	urlConfig := config.URLConfig{
+		Name: "home",
+		Actions: []config.Action{
+			{CapturePrintable: &config.PrintableCapture{}},
+			{Click: "#accept"},
+		},
+	}
+
+	if err := runActions(context.Background(), engine, urlConfig, &actionCapture{}); err != nil {
+		t.Fatalf("runActions: %v", err)
+	}
+	if len(engine.clicks) != 1 {
+		t.Errorf("clicks = %v, want the click after the skipped action", engine.clicks)
+	}
+}
@@ -0,0 +1,133 @@
+package screenshot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// failureConsoleLines is the number of console messages kept in a failure report
+const failureConsoleLines = 50
+
+// ViewportFailure describes how the capture of a viewport failed
+type ViewportFailure struct {
+	Stage      string   `json:"stage"`                // Capture stage that failed, e.g. "full page capture"
+	Errors     []string `json:"errors"`               // Error chain, outermost first
+	LastURL    string   `json:"lastUrl,omitempty"`    // URL the page was on when the capture failed
+	Console    []string `json:"console,omitempty"`    // Last console messages before the failure
+	Screenshot string   `json:"screenshot,omitempty"` // What was on screen, relative to the viewport directory
+}
+
+// FailureReport is written as failure.json in the directory of a URL with failed viewports
+type FailureReport struct {
+	Name      string           `json:"name"`
+	URL       string           `json:"url"`
+	FailedAt  time.Time        `json:"failedAt"`
+	Viewports []FailedViewport `json:"viewports"`
+}
+
+// FailedViewport is the failure of a single viewport in failure.json. Unlike
+// in the manifest, its screenshot is relative to the URL directory.
+type FailedViewport struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	ViewportFailure
+}
+
+// errorChain splits an error into the messages of its wrapped errors, outermost first.
+// Each message is stripped of the wrapped error's text it repeats.
+func errorChain(err error) []string {
+	var chain []string
+	for err != nil {
+		message := err.Error()
+		next := errors.Unwrap(err)
+		if next != nil {
+			message = strings.TrimSuffix(strings.TrimSuffix(message, next.Error()), ": ")
+		}
+		chain = append(chain, message)
+		err = next
+	}
+	return chain
+}
+
+// diagnoseFailure collects what the browser showed when a viewport failed. The browser
+// context may already be cancelled by a timeout, in which case only the error chain,
+// stage and console output are recorded. consoleLog is nil for engines without the
+// DevTools protocol.
+func (s *Screenshoter) diagnoseFailure(engine BrowserEngine, stage string, captureErr error, consoleLog *consoleRecorder, name, viewportDir string) *ViewportFailure {
+	failure := &ViewportFailure{
+		Stage:  stage,
+		Errors: errorChain(captureErr),
+	}
+	if consoleLog != nil {
+		failure.Console = consoleLog.tail(failureConsoleLines)
+	}
+
+	// Chrome is still asked after a timeout, the tab stays open until the capture returns
+	if chrome, ok := engine.(*chromeEngine); ok {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(chrome.ctx), 10*time.Second)
+		defer cancel()
+		engine = &chromeEngine{ctx: ctx, viewport: chrome.viewport, cancel: cancel}
+	}
+
+	if err := engine.Evaluate(`return location.href`, &failure.LastURL); err != nil {
+		log.Printf("Warning: Failed to capture diagnostic screenshot for %s: %v", name, err)
+		return failure
+	}
+	buf, err := engine.Screenshot(s.Config.FileFormat, s.Config.Quality)
+	if err != nil {
+		log.Printf("Warning: Failed to capture diagnostic screenshot for %s: %v", name, err)
+		return failure
+	}
+
+	screenshotName := fmt.Sprintf("%s-failure.%s", SanitizeFilename(name), s.Config.FileFormat)
+	if err := os.WriteFile(filepath.Join(viewportDir, screenshotName), buf, 0644); err != nil {
+		log.Printf("Warning: Failed to save diagnostic screenshot for %s: %v", name, err)
+		return failure
+	}
+	failure.Screenshot = screenshotName
+
+	return failure
+}
+
+// writeFailureReport writes failure.json for the failed viewports of a manifest.
+// Nothing is written if every viewport succeeded.
+func writeFailureReport(urlDir string, manifest *Manifest) error {
+	manifest.mu.Lock()
+	report := FailureReport{
+		Name:     manifest.Name,
+		URL:      manifest.URL,
+		FailedAt: time.Now(),
+	}
+	for _, vm := range manifest.Viewports {
+		if vm.Failure == nil {
+			continue
+		}
+		failure := *vm.Failure
+		if failure.Screenshot != "" {
+			failure.Screenshot = fmt.Sprintf("%dx%d/%s", vm.Width, vm.Height, failure.Screenshot)
+		}
+		report.Viewports = append(report.Viewports, FailedViewport{
+			Width:           vm.Width,
+			Height:          vm.Height,
+			ViewportFailure: failure,
+		})
+	}
+	manifest.mu.Unlock()
+
+	if len(report.Viewports) == 0 {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode failure report: %w", err)
+	}
+	return os.WriteFile(filepath.Join(urlDir, "failure.json"), data, 0644)
+}
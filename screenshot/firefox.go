@@ -0,0 +1,308 @@
+package screenshot
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"screenshot-tool/config"
+
+	"github.com/chromedp/cdproto/network"
+)
+
+// firefoxEngine is the BrowserEngine of Firefox, a session driven through WebDriver by a
+// geckodriver started for it or on the Selenium Grid of the webdriver backend
+type firefoxEngine struct {
+	*webDriverSession
+	ctx         context.Context
+	viewport    config.Viewport
+	geckodriver *exec.Cmd // Local geckodriver serving the session, nil on a Grid
+}
+
+// webElementKey identifies element references in WebDriver requests and responses
+const webElementKey = "element-6066-11e4-a52e-4f735466cecf"
+
+// newFirefoxEngine starts Firefox with the window sized so the page sees the viewport
+func (s *Screenshoter) newFirefoxEngine(ctx context.Context, urlConfig config.URLConfig, viewport config.Viewport) (*firefoxEngine, error) {
+	firefox := s.Config.Firefox
+	if firefox == nil {
+		firefox = &config.Firefox{}
+	}
+
+	options := map[string]any{"args": []string{"-headless"}}
+	if firefox.Binary != "" {
+		options["binary"] = firefox.Binary
+	}
+	if len(firefox.Prefs) > 0 {
+		options["prefs"] = firefox.Prefs
+	}
+	capabilities := map[string]any{
+		"browserName":         "firefox",
+		"acceptInsecureCerts": true,
+		"moz:firefoxOptions":  options,
+	}
+	if urlConfig.Proxy != nil {
+		proxyURL, err := url.Parse(urlConfig.Proxy.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		proxy := map[string]any{"proxyType": "manual", "httpProxy": proxyURL.Host, "sslProxy": proxyURL.Host}
+		if len(urlConfig.Proxy.Bypass) > 0 {
+			proxy["noProxy"] = urlConfig.Proxy.Bypass
+		}
+		capabilities["proxy"] = proxy
+		log.Printf("Using proxy %s for %s", urlConfig.Proxy.URL, urlConfig.Name)
+	}
+
+	session := &firefoxEngine{ctx: ctx, viewport: viewport}
+	hub := ""
+	createCtx := ctx
+	if s.Config.Backend == "webdriver" {
+		for name, value := range s.Config.WebDriver.Capabilities {
+			if _, ok := capabilities[name]; !ok {
+				capabilities[name] = value
+			}
+		}
+		hub = s.Config.WebDriver.URL
+		var cancel context.CancelFunc
+		createCtx, cancel = context.WithTimeout(ctx, time.Duration(s.Config.WebDriver.SessionTimeout)*time.Millisecond)
+		defer cancel()
+	} else {
+		cmd, address, err := startGeckodriver(ctx, firefox.Geckodriver)
+		if err != nil {
+			return nil, err
+		}
+		session.geckodriver = cmd
+		hub = address
+	}
+
+	start := time.Now()
+	wd, _, err := startWebDriverSession(createCtx, hub, capabilities)
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	session.webDriverSession = wd
+	log.Printf("Started Firefox session %s for %s at viewport %dx%d in %v",
+		wd.id, urlConfig.Name, viewport.Width, viewport.Height, time.Since(start).Round(time.Millisecond))
+
+	if err := session.resize(viewport); err != nil {
+		session.Close()
+		return nil, fmt.Errorf("failed to size the window: %w", err)
+	}
+	return session, nil
+}
+
+// startGeckodriver starts geckodriver on a free local port and waits until it accepts sessions
+func startGeckodriver(ctx context.Context, path string) (*exec.Cmd, string, error) {
+	if path == "" {
+		path = "geckodriver"
+	}
+	execPath, err := exec.LookPath(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("geckodriver not found, install it or set firefox.geckodriver: %w", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to find a free port for geckodriver: %w", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	cmd := exec.Command(execPath, "--host", "127.0.0.1", "--port", strconv.Itoa(port))
+	if err := cmd.Start(); err != nil {
+		return nil, "", fmt.Errorf("failed to start geckodriver: %w", err)
+	}
+	address := fmt.Sprintf("http://127.0.0.1:%d", port)
+
+	// geckodriver takes a moment to listen
+	status := &webDriverSession{hub: address, client: &http.Client{}}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		var ready struct {
+			Ready bool `json:"ready"`
+		}
+		err := status.do(ctx, http.MethodGet, "/status", nil, &ready)
+		if err == nil && ready.Ready {
+			return cmd, address, nil
+		}
+		if time.Now().After(deadline) || ctx.Err() != nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+			return nil, "", fmt.Errorf("geckodriver at %s did not become ready: %v", address, err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// Close ends the session and stops its geckodriver
+func (f *firefoxEngine) Close() {
+	if f.webDriverSession != nil {
+		f.webDriverSession.close()
+	}
+	if f.geckodriver != nil {
+		f.geckodriver.Process.Kill()
+		f.geckodriver.Wait()
+	}
+}
+
+// command sends a WebDriver command of the session
+func (f *firefoxEngine) command(method, path string, body, out any) error {
+	return f.do(f.ctx, method, "/session/"+f.id+path, body, out)
+}
+
+// resize sets the window size, then corrects it by the browser chrome so the page
+// itself is as large as the viewport
+func (f *firefoxEngine) resize(viewport config.Viewport) error {
+	rect := map[string]any{"width": viewport.Width, "height": viewport.Height}
+	if err := f.command(http.MethodPost, "/window/rect", rect, nil); err != nil {
+		return err
+	}
+	var inner []int
+	if err := f.Evaluate(`return [window.innerWidth, window.innerHeight]`, &inner); err != nil || len(inner) != 2 {
+		return err
+	}
+	if inner[0] == viewport.Width && inner[1] == viewport.Height {
+		return nil
+	}
+	rect = map[string]any{"width": 2*viewport.Width - inner[0], "height": 2*viewport.Height - inner[1]}
+	return f.command(http.MethodPost, "/window/rect", rect, nil)
+}
+
+func (f *firefoxEngine) Navigate(url string) error {
+	return f.command(http.MethodPost, "/url", map[string]any{"url": url}, nil)
+}
+
+func (f *firefoxEngine) Reload() error {
+	return f.command(http.MethodPost, "/refresh", map[string]any{}, nil)
+}
+
+func (f *firefoxEngine) SetCookies(cookies []config.Cookie, pageURL string) error {
+	expiry := time.Now().Add(180 * 24 * time.Hour).Unix()
+	for _, cookie := range cookies {
+		domain := cookie.Domain
+		if domain == "" {
+			domain = extractDomainFromURL(pageURL)
+		}
+		path := cookie.Path
+		if path == "" {
+			path = "/"
+		}
+		c := map[string]any{
+			"name":     cookie.Name,
+			"value":    cookie.Value,
+			"domain":   domain,
+			"path":     path,
+			"secure":   cookie.Secure,
+			"httpOnly": cookie.HTTPOnly,
+			"expiry":   expiry,
+		}
+		if err := f.command(http.MethodPost, "/cookie", map[string]any{"cookie": c}, nil); err != nil {
+			return fmt.Errorf("failed to set cookie %s: %w", cookie.Name, err)
+		}
+	}
+	return nil
+}
+
+func (f *firefoxEngine) Cookies() ([]*network.Cookie, error) {
+	var cookies []struct {
+		Name     string `json:"name"`
+		Value    string `json:"value"`
+		Domain   string `json:"domain"`
+		Path     string `json:"path"`
+		Expiry   int64  `json:"expiry"`
+		HTTPOnly bool   `json:"httpOnly"`
+		Secure   bool   `json:"secure"`
+		SameSite string `json:"sameSite"`
+	}
+	if err := f.command(http.MethodGet, "/cookie", nil, &cookies); err != nil {
+		return nil, err
+	}
+
+	converted := make([]*network.Cookie, len(cookies))
+	for i, c := range cookies {
+		converted[i] = &network.Cookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Domain:   c.Domain,
+			Path:     c.Path,
+			Expires:  float64(c.Expiry),
+			Size:     int64(len(c.Name) + len(c.Value)),
+			HTTPOnly: c.HTTPOnly,
+			Secure:   c.Secure,
+			Session:  c.Expiry == 0,
+			SameSite: network.CookieSameSite(c.SameSite),
+		}
+	}
+	return converted, nil
+}
+
+func (f *firefoxEngine) Evaluate(script string, out any, args ...any) error {
+	if args == nil {
+		args = []any{}
+	}
+	return f.command(http.MethodPost, "/execute/sync", map[string]any{"script": script, "args": args}, out)
+}
+
+// element returns the reference of the first element matching a CSS selector
+func (f *firefoxEngine) element(selector string) (string, error) {
+	var ref map[string]string
+	if err := f.command(http.MethodPost, "/element", map[string]any{"using": "css selector", "value": selector}, &ref); err != nil {
+		return "", err
+	}
+	return ref[webElementKey], nil
+}
+
+func (f *firefoxEngine) Click(selector string) error {
+	id, err := f.element(selector)
+	if err != nil {
+		return err
+	}
+	return f.command(http.MethodPost, "/element/"+id+"/click", map[string]any{}, nil)
+}
+
+func (f *firefoxEngine) Type(selector, text string) error {
+	id, err := f.element(selector)
+	if err != nil {
+		return err
+	}
+	return f.command(http.MethodPost, "/element/"+id+"/value", map[string]any{"text": text}, nil)
+}
+
+func (f *firefoxEngine) MoveMouse(x, y float64) error {
+	move := map[string]any{"type": "pointerMove", "duration": 0, "origin": "viewport", "x": int(x), "y": int(y)}
+	actions := []map[string]any{{
+		"type":       "pointer",
+		"id":         "mouse",
+		"parameters": map[string]any{"pointerType": "mouse"},
+		"actions":    []map[string]any{move},
+	}}
+	return f.command(http.MethodPost, "/actions", map[string]any{"actions": actions}, nil)
+}
+
+// SetViewportHeight resizes the window, which headless Firefox allows beyond the screen
+func (f *firefoxEngine) SetViewportHeight(height int64) error {
+	viewport := f.viewport
+	viewport.Height = int(height)
+	return f.resize(viewport)
+}
+
+func (f *firefoxEngine) Screenshot(format string, quality int) ([]byte, error) {
+	var encoded string
+	if err := f.command(http.MethodGet, "/screenshot", nil, &encoded); err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid screenshot: %w", err)
+	}
+	return convertPNG(data, format, quality)
+}
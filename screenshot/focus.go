@@ -0,0 +1,156 @@
+package screenshot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"screenshot-tool/config"
+
+	"github.com/chromedp/cdproto/input"
+	"github.com/chromedp/chromedp"
+)
+
+// FocusStop records an element reached by keyboard navigation
+type FocusStop struct {
+	Index        int    `json:"index"`      // Position in the tab order, starting at 1
+	Screenshot   string `json:"screenshot"` // Screenshot file name
+	Element      string `json:"element"`    // Short description such as button#submit
+	Text         string `json:"text,omitempty"`
+	FocusVisible bool   `json:"focusVisible"` // Whether the element matches :focus-visible
+	Indicator    bool   `json:"indicator"`    // Whether an outline or box shadow is drawn around the element
+}
+
+// focusedElementScript describes the focused element, returning null when focus is on the page itself
+const focusedElementScript = `(() => {
+	const el = document.activeElement;
+	if (!el || el === document.body || el === document.documentElement) {
+		return null;
+	}
+
+	let element = el.tagName.toLowerCase();
+	if (el.id) {
+		element += '#' + el.id;
+	} else if (el.classList.length > 0) {
+		element += '.' + Array.from(el.classList).join('.');
+	}
+
+	const style = getComputedStyle(el);
+	const outline = style.outlineStyle !== 'none' && parseFloat(style.outlineWidth) > 0;
+	const shadow = style.boxShadow !== 'none';
+	const text = (el.getAttribute('aria-label') || el.innerText || el.value || '').trim().slice(0, 80);
+
+	return {
+		element: element,
+		text: text,
+		focusVisible: el.matches(':focus-visible'),
+		indicator: outline || shadow
+	};
+})()`
+
+// resetFocusScript removes focus from the page and scrolls back to the top
+const resetFocusScript = `(() => {
+	if (document.activeElement) {
+		document.activeElement.blur();
+	}
+	window.scrollTo(0, 0);
+	return true;
+})()`
+
+// focusedElement is the result of focusedElementScript
+type focusedElement struct {
+	Element      string `json:"element"`
+	Text         string `json:"text"`
+	FocusVisible bool   `json:"focusVisible"`
+	Indicator    bool   `json:"indicator"`
+}
+
+// pressTab sends a Tab key press to the page
+func pressTab(ctx context.Context) error {
+	key := input.DispatchKeyEvent(input.KeyDown).
+		WithKey("Tab").
+		WithCode("Tab").
+		WithWindowsVirtualKeyCode(9).
+		WithNativeVirtualKeyCode(9)
+	if err := key.Do(ctx); err != nil {
+		return err
+	}
+	return input.DispatchKeyEvent(input.KeyUp).
+		WithKey("Tab").
+		WithCode("Tab").
+		WithWindowsVirtualKeyCode(9).
+		WithNativeVirtualKeyCode(9).
+		Do(ctx)
+}
+
+// captureFocusStops tabs through the page from the top, capturing the viewport at each
+// focus stop. It stops after maxStops or when focus leaves the page or wraps around.
+func (s *Screenshoter) captureFocusStops(urlConfig config.URLConfig, tab *config.TabThrough, capture *actionCapture) chromedp.ActionFunc {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		viewport := capture.viewport
+
+		// Start from the top of the document so the tab order begins at the first focusable element
+		if err := chromedp.Evaluate(resetFocusScript, nil).Do(ctx); err != nil {
+			return err
+		}
+
+		var first string
+		for i := 1; i <= tab.MaxStops; i++ {
+			if err := pressTab(ctx); err != nil {
+				return fmt.Errorf("failed to press Tab: %w", err)
+			}
+			if err := chromedp.Sleep(200 * time.Millisecond).Do(ctx); err != nil {
+				return err
+			}
+
+			var focused *focusedElement
+			if err := chromedp.Evaluate(focusedElementScript, &focused).Do(ctx); err != nil {
+				return fmt.Errorf("failed to read focused element: %w", err)
+			}
+			if focused == nil {
+				log.Printf("Focus left the page of %s after %d stops", urlConfig.Name, i-1)
+				break
+			}
+
+			// Tabbing past the last element in some browsers wraps around to the first
+			key := focused.Element + "\x00" + focused.Text
+			if i == 1 {
+				first = key
+			} else if key == first {
+				log.Printf("Focus order of %s wrapped around after %d stops", urlConfig.Name, i-1)
+				break
+			}
+
+			var buf []byte
+			if err := s.captureScreenshot(&buf).Do(ctx); err != nil {
+				return fmt.Errorf("failed to capture focus stop %d: %w", i, err)
+			}
+
+			filename := fmt.Sprintf("%s-focus-%dx%d-%02d.%s", capture.timestamp, viewport.Width, viewport.Height, i, s.Config.FileFormat)
+			if err := os.WriteFile(filepath.Join(capture.viewportDir, filename), buf, 0644); err != nil {
+				return err
+			}
+
+			capture.vm.FocusStops = append(capture.vm.FocusStops, FocusStop{
+				Index:        i,
+				Screenshot:   filename,
+				Element:      focused.Element,
+				Text:         focused.Text,
+				FocusVisible: focused.FocusVisible,
+				Indicator:    focused.Indicator,
+			})
+
+			if !focused.Indicator {
+				log.Printf("Warning: Focus stop %d of %s (%s) has no visible focus indicator", i, urlConfig.Name, focused.Element)
+			}
+		}
+
+		log.Printf("Captured %d focus stops for %s at viewport %dx%d", len(capture.vm.FocusStops), urlConfig.Name, viewport.Width, viewport.Height)
+
+		// Leave the page unfocused and at the top for the viewport sections
+		return chromedp.Evaluate(resetFocusScript, nil).Do(ctx)
+	})
+}
@@ -0,0 +1,51 @@
+package screenshot
+
+import (
+	"context"
+
+	"screenshot-tool/config"
+
+	"github.com/chromedp/cdproto/browser"
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/emulation"
+	"github.com/chromedp/chromedp"
+)
+
+// emulateGeolocation grants the geolocation permission to every origin of the browser
+// context and overrides the position reported to the page
+func emulateGeolocation(geo *config.Geolocation) chromedp.ActionFunc {
+	return func(ctx context.Context) error {
+		c := chromedp.FromContext(ctx)
+
+		// Permissions belong to the browser context, so they're granted through the browser
+		grant := browser.GrantPermissions([]browser.PermissionType{browser.PermissionTypeGeolocation})
+		if c.BrowserContextID != "" {
+			grant = grant.WithBrowserContextID(c.BrowserContextID)
+		}
+		if err := grant.Do(cdp.WithExecutor(ctx, c.Browser)); err != nil {
+			return err
+		}
+
+		return emulation.SetGeolocationOverride().
+			WithLatitude(geo.Latitude).
+			WithLongitude(geo.Longitude).
+			WithAccuracy(geo.Accuracy).
+			Do(ctx)
+	}
+}
+
+// clearGeolocation removes the position override and the permissions granted to the browser context
+func clearGeolocation() chromedp.ActionFunc {
+	return func(ctx context.Context) error {
+		c := chromedp.FromContext(ctx)
+
+		reset := browser.ResetPermissions()
+		if c.BrowserContextID != "" {
+			reset = reset.WithBrowserContextID(c.BrowserContextID)
+		}
+		if err := reset.Do(cdp.WithExecutor(ctx, c.Browser)); err != nil {
+			return err
+		}
+		return emulation.ClearGeolocationOverride().Do(ctx)
+	}
+}
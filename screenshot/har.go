@@ -0,0 +1,288 @@
+package screenshot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/har"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+)
+
+// harRequest tracks a single request while it is in flight
+type harRequest struct {
+	entry     *har.Entry
+	startedAt time.Time               // Monotonic time the request was sent
+	timing    *network.ResourceTiming // Connection timings from the response
+}
+
+// harRecorder collects the network traffic of a browser as HAR entries
+type harRecorder struct {
+	mu        sync.Mutex
+	pages     []*har.Page
+	requests  []*harRequest
+	inFlight  map[network.RequestID]*harRequest
+	mainFrame cdp.FrameID
+}
+
+// recordHAR starts recording all network requests of the browser context
+func recordHAR(browserCtx context.Context) *harRecorder {
+	rec := &harRecorder{inFlight: make(map[network.RequestID]*harRequest)}
+
+	chromedp.ListenTarget(browserCtx, func(ev any) {
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+
+		switch e := ev.(type) {
+		case *network.EventRequestWillBeSent:
+			rec.requestWillBeSent(e)
+		case *network.EventResponseReceived:
+			if req := rec.inFlight[e.RequestID]; req != nil {
+				req.entry.Response = harResponse(e.Response)
+				req.entry.ServerIPAddress = e.Response.RemoteIPAddress
+				req.entry.Connection = fmt.Sprint(e.Response.ConnectionID)
+				req.timing = e.Response.Timing
+			}
+		case *network.EventLoadingFinished:
+			if req := rec.inFlight[e.RequestID]; req != nil {
+				if req.entry.Response != nil {
+					req.entry.Response.BodySize = int64(e.EncodedDataLength)
+					req.entry.Response.Content.Size = int64(e.EncodedDataLength)
+				}
+				req.finish(e.Timestamp)
+				delete(rec.inFlight, e.RequestID)
+			}
+		case *network.EventLoadingFailed:
+			if req := rec.inFlight[e.RequestID]; req != nil {
+				reason := e.ErrorText
+				if e.BlockedReason != "" {
+					reason += " (blocked: " + string(e.BlockedReason) + ")"
+				}
+				if req.entry.Response == nil {
+					req.entry.Response = emptyHARResponse()
+				}
+				req.entry.Response.StatusText = reason
+				req.entry.Comment = "failed: " + reason
+				req.finish(e.Timestamp)
+				delete(rec.inFlight, e.RequestID)
+			}
+		}
+	})
+
+	return rec
+}
+
+// requestWillBeSent starts an entry for a request, finishing the previous one on redirects
+func (r *harRecorder) requestWillBeSent(e *network.EventRequestWillBeSent) {
+	// A redirect reuses the request ID, the redirect response completes the previous hop
+	if prev := r.inFlight[e.RequestID]; prev != nil && e.RedirectResponse != nil {
+		prev.entry.Response = harResponse(e.RedirectResponse)
+		prev.entry.Response.RedirectURL = e.Request.URL
+		prev.timing = e.RedirectResponse.Timing
+		prev.finish(e.Timestamp)
+	}
+
+	// Each main frame navigation starts a new page
+	if e.Type == network.ResourceTypeDocument && (r.mainFrame == "" || e.FrameID == r.mainFrame) && e.RedirectResponse == nil {
+		r.mainFrame = e.FrameID
+		r.pages = append(r.pages, &har.Page{
+			ID:              fmt.Sprintf("page_%d", len(r.pages)+1),
+			StartedDateTime: harTime(e.WallTime),
+			Title:           e.Request.URL,
+			PageTimings:     &har.PageTimings{},
+		})
+	}
+
+	req := &harRequest{
+		entry: &har.Entry{
+			StartedDateTime: harTime(e.WallTime),
+			Request:         harRequestFor(e.Request),
+			Cache:           &har.Cache{},
+			Timings:         &har.Timings{},
+		},
+	}
+	if e.Timestamp != nil {
+		req.startedAt = e.Timestamp.Time()
+	}
+	if len(r.pages) > 0 {
+		req.entry.Pageref = r.pages[len(r.pages)-1].ID
+	}
+
+	r.requests = append(r.requests, req)
+	r.inFlight[e.RequestID] = req
+}
+
+// finish computes the entry's timings once the request completed
+func (req *harRequest) finish(finishedAt *cdp.MonotonicTime) {
+	var total float64
+	if finishedAt != nil && !req.startedAt.IsZero() {
+		total = float64(finishedAt.Time().Sub(req.startedAt)) / float64(time.Millisecond)
+	}
+
+	timings := req.entry.Timings
+	if t := req.timing; t != nil {
+		timings.Blocked = firstNonNegative(t.DNSStart, t.ConnectStart, t.SendStart)
+		timings.DNS = harSpan(t.DNSStart, t.DNSEnd)
+		timings.Connect = harSpan(t.ConnectStart, t.ConnectEnd)
+		timings.Ssl = harSpan(t.SslStart, t.SslEnd)
+		timings.Send = max(0, t.SendEnd-t.SendStart)
+		timings.Wait = max(0, t.ReceiveHeadersEnd-t.SendEnd)
+
+		// Timing offsets are relative to requestTime, in the same clock as event timestamps
+		if finishedAt != nil {
+			finished := float64(finishedAt.Time().Sub(*cdp.MonotonicTimeEpoch)) / float64(time.Second)
+			timings.Receive = max(0, (finished-t.RequestTime)*1000-t.ReceiveHeadersEnd)
+		}
+
+		total = 0
+		for _, v := range []float64{timings.Blocked, timings.DNS, timings.Connect, timings.Send, timings.Wait, timings.Receive} {
+			if v > 0 {
+				total += v
+			}
+		}
+	} else {
+		timings.Receive = total
+	}
+
+	req.entry.Time = total
+}
+
+// write saves the recorded traffic as a HAR file
+func (r *harRecorder) write(path string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entries := make([]*har.Entry, 0, len(r.requests))
+	for _, req := range r.requests {
+		if req.entry.Response == nil {
+			req.entry.Response = emptyHARResponse()
+			req.entry.Comment = "no response received before capture finished"
+		}
+		entries = append(entries, req.entry)
+	}
+
+	doc := har.HAR{Log: &har.Log{
+		Version: "1.2",
+		Creator: &har.Creator{Name: "screenshot-tool", Version: "1.0"},
+		Pages:   r.pages,
+		Entries: entries,
+	}}
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode HAR: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+
+	log.Printf("Wrote %d network requests across %d page loads to %s", len(entries), len(r.pages), path)
+	return nil
+}
+
+// harRequestFor converts a CDP request to its HAR form
+func harRequestFor(req *network.Request) *har.Request {
+	result := &har.Request{
+		Method:      req.Method,
+		URL:         req.URL,
+		Cookies:     []*har.Cookie{},
+		Headers:     harHeaders(req.Headers),
+		QueryString: []*har.NameValuePair{},
+		HeadersSize: -1,
+		BodySize:    -1,
+	}
+	if !req.HasPostData {
+		result.BodySize = 0
+	}
+
+	if parsed, err := url.Parse(req.URL); err == nil {
+		for name, values := range parsed.Query() {
+			for _, value := range values {
+				result.QueryString = append(result.QueryString, &har.NameValuePair{Name: name, Value: value})
+			}
+		}
+		sort.Slice(result.QueryString, func(i, j int) bool { return result.QueryString[i].Name < result.QueryString[j].Name })
+	}
+
+	return result
+}
+
+// harResponse converts a CDP response to its HAR form
+func harResponse(resp *network.Response) *har.Response {
+	result := &har.Response{
+		Status:      resp.Status,
+		StatusText:  resp.StatusText,
+		HTTPVersion: resp.Protocol,
+		Cookies:     []*har.Cookie{},
+		Headers:     harHeaders(resp.Headers),
+		Content:     &har.Content{MimeType: resp.MimeType},
+		HeadersSize: -1,
+		BodySize:    -1,
+	}
+	for name, value := range resp.Headers {
+		if strings.EqualFold(name, "location") {
+			result.RedirectURL = fmt.Sprint(value)
+		}
+	}
+	if resp.FromDiskCache {
+		result.Comment = "served from disk cache"
+	}
+	return result
+}
+
+// emptyHARResponse is used for requests that never received a response
+func emptyHARResponse() *har.Response {
+	return &har.Response{
+		Cookies:     []*har.Cookie{},
+		Headers:     []*har.NameValuePair{},
+		Content:     &har.Content{MimeType: "x-unknown"},
+		HeadersSize: -1,
+		BodySize:    -1,
+	}
+}
+
+// harHeaders converts CDP headers to sorted HAR name/value pairs
+func harHeaders(headers network.Headers) []*har.NameValuePair {
+	pairs := make([]*har.NameValuePair, 0, len(headers))
+	for name, value := range headers {
+		pairs = append(pairs, &har.NameValuePair{Name: name, Value: fmt.Sprint(value)})
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].Name < pairs[j].Name })
+	return pairs
+}
+
+// harTime formats a wall time the way HAR expects it
+func harTime(t *cdp.TimeSinceEpoch) string {
+	if t == nil {
+		return time.Now().Format(time.RFC3339Nano)
+	}
+	return t.Time().Format(time.RFC3339Nano)
+}
+
+// harSpan returns the duration between two timing offsets, or -1 if the phase didn't happen
+func harSpan(start, end float64) float64 {
+	if start < 0 || end < 0 {
+		return -1
+	}
+	return end - start
+}
+
+// firstNonNegative returns the first offset that is set, or -1
+func firstNonNegative(values ...float64) float64 {
+	for _, v := range values {
+		if v >= 0 {
+			return v
+		}
+	}
+	return -1
+}
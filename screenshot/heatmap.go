@@ -0,0 +1,121 @@
+package screenshot
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"screenshot-tool/config"
+)
+
+// Triptych layout, in pixels
+const triptychGap = 16
+
+var (
+	heatmapChanged     = color.RGBA{0xdc, 0x26, 0x26, 0xff}
+	heatmapAntialiased = color.RGBA{0xf5, 0x9e, 0x0b, 0xff}
+	heatmapMissing     = color.RGBA{0xfe, 0xca, 0xca, 0xff} // Area only one of the images covers
+	triptychBackground = color.RGBA{0xf3, 0xf4, 0xf6, 0xff}
+)
+
+// writeDiffImages writes the images that show reviewers how a capture differs from its
+// baseline: a heatmap of the changed pixels over a faded copy of the capture, and a
+// triptych of the baseline, the capture and the heatmap side by side. Both are PNG files
+// named after the capture, with "diff" or "triptych" in place of "full".
+func writeDiffImages(result *DiffResult, path string, tolerance *config.DiffTolerance) error {
+	baseline, err := loadImage(result.Baseline)
+	if err != nil {
+		return err
+	}
+	img, err := loadImage(path)
+	if err != nil {
+		return err
+	}
+
+	heatmap := diffHeatmap(baseline, img, tolerance)
+	heatmapPath := diffImagePath(path, "diff")
+	if err := writePNG(heatmapPath, heatmap); err != nil {
+		return err
+	}
+	result.Heatmap = filepath.Base(heatmapPath)
+
+	triptychPath := diffImagePath(path, "triptych")
+	if err := writePNG(triptychPath, sideBySide(baseline, img, heatmap)); err != nil {
+		return err
+	}
+	result.Triptych = filepath.Base(triptychPath)
+	return nil
+}
+
+// diffImagePath returns the path of a diff image of a full page screenshot
+func diffImagePath(path, kind string) string {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return filepath.Join(filepath.Dir(path), strings.Replace(name, "-full-", "-"+kind+"-", 1)+".png")
+}
+
+// diffHeatmap draws the capture faded to gray, with changed pixels in red and pixels ignored
+// as anti-aliasing in amber. Pixels within the pixel tolerance keep the faded capture. Area
+// covered by only one of the images, when their sizes differ, is light red.
+func diffHeatmap(baseline, img image.Image, tolerance *config.DiffTolerance) *image.RGBA {
+	boundsA, boundsB := baseline.Bounds(), img.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, max(boundsA.Dx(), boundsB.Dx()), max(boundsA.Dy(), boundsB.Dy())))
+	draw.Draw(out, out.Bounds(), &image.Uniform{heatmapMissing}, image.Point{}, draw.Src)
+
+	var pixelTolerance uint8
+	var ignoreAntialiasing bool
+	if tolerance != nil {
+		pixelTolerance = uint8(tolerance.PixelTolerance)
+		ignoreAntialiasing = tolerance.IgnoreAntialiasing
+	}
+
+	pa := pixelReader{img: baseline, width: min(boundsA.Dx(), boundsB.Dx()), height: min(boundsA.Dy(), boundsB.Dy())}
+	pb := pixelReader{img: img, width: pa.width, height: pa.height}
+
+	for y := 0; y < pa.height; y++ {
+		for x := 0; x < pa.width; x++ {
+			switch pa.compare(x, y, pb, pixelTolerance, ignoreAntialiasing) {
+			case pixelChanged:
+				out.SetRGBA(x, y, heatmapChanged)
+			case pixelAntialiased:
+				out.SetRGBA(x, y, heatmapAntialiased)
+			default:
+				// Fade to a light gray so the changes stand out
+				v := uint8(255 - (255-brightness(pb.at(x, y)))/4)
+				out.SetRGBA(x, y, color.RGBA{v, v, v, 0xff})
+			}
+		}
+	}
+	return out
+}
+
+// sideBySide places images next to each other from left to right, aligned at the top
+func sideBySide(images ...image.Image) *image.RGBA {
+	width, height := triptychGap*(len(images)+1), 0
+	for _, img := range images {
+		width += img.Bounds().Dx()
+		height = max(height, img.Bounds().Dy())
+	}
+
+	out := image.NewRGBA(image.Rect(0, 0, width, height+2*triptychGap))
+	draw.Draw(out, out.Bounds(), &image.Uniform{triptychBackground}, image.Point{}, draw.Src)
+
+	x := triptychGap
+	for _, img := range images {
+		bounds := img.Bounds()
+		draw.Draw(out, image.Rect(x, triptychGap, x+bounds.Dx(), triptychGap+bounds.Dy()), img, bounds.Min, draw.Src)
+		x += bounds.Dx() + triptychGap
+	}
+	return out
+}
+
+// writePNG encodes an image as PNG to a file
+func writePNG(path string, img image.Image) error {
+	data, err := encodeImage(img, "png", 0)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
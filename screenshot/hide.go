@@ -0,0 +1,67 @@
+package screenshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"screenshot-tool/config"
+)
+
+// hideElementsScript injects a stylesheet that hides or blocks out the given selectors.
+// Each selector gets its own rule so an invalid one doesn't disable the others.
+// Hidden elements keep their space so the layout doesn't shift between captures.
+const hideElementsScript = `((hide, mask) => {
+	let style = document.getElementById('__screenshot_hide_style');
+	if (!style) {
+		style = document.createElement('style');
+		style.id = '__screenshot_hide_style';
+		(document.head || document.documentElement).appendChild(style);
+	}
+
+	const rules = [];
+	let matched = 0;
+	const count = (selector) => {
+		try {
+			matched += document.querySelectorAll(selector).length;
+			return true;
+		} catch (e) {
+			return false;
+		}
+	};
+
+	for (const selector of hide) {
+		if (count(selector)) {
+			rules.push(selector + ' { visibility: hidden !important; }');
+		}
+	}
+	for (const selector of mask) {
+		if (count(selector)) {
+			rules.push(selector + ' { background: #000 !important; filter: brightness(0) !important; }');
+		}
+	}
+
+	style.textContent = rules.join('\n');
+	return matched;
+})(%s, %s)`
+
+// hideElements hides the URL's hideSelectors and blocks out its maskSelectors
+func hideElements(engine BrowserEngine, urlConfig config.URLConfig) error {
+	hide, err := json.Marshal(append([]string{}, urlConfig.HideSelectors...))
+	if err != nil {
+		return err
+	}
+	mask, err := json.Marshal(append([]string{}, urlConfig.MaskSelectors...))
+	if err != nil {
+		return err
+	}
+
+	var matched int
+	if err := evaluateExpression(engine, fmt.Sprintf(hideElementsScript, hide, mask), &matched); err != nil {
+		return fmt.Errorf("failed to hide elements: %w", err)
+	}
+
+	log.Printf("Hid %d and masked %d selectors on %s, matching %d elements",
+		len(urlConfig.HideSelectors), len(urlConfig.MaskSelectors), urlConfig.Name, matched)
+	return nil
+}
@@ -0,0 +1,182 @@
+package screenshot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"screenshot-tool/config"
+)
+
+// InteractiveElement is an element outlined on the interactive elements map
+type InteractiveElement struct {
+	Element   string  `json:"element"` // Short description such as button#submit
+	Name      string  `json:"name"`    // Accessible name, empty if the element has none
+	X         float64 `json:"x"`
+	Y         float64 `json:"y"`
+	Width     float64 `json:"width"`
+	Height    float64 `json:"height"`
+	Undersize bool    `json:"undersize"` // Smaller than the minimum target size in either dimension
+}
+
+// InteractiveMapSummary is recorded in the manifest for each viewport with an interactive elements map
+type InteractiveMapSummary struct {
+	Screenshot    string `json:"screenshot"`    // Diagnostic screenshot, relative to the viewport directory
+	Report        string `json:"report"`        // Element list, relative to the viewport directory
+	Elements      int    `json:"elements"`      // Number of outlined elements
+	Undersized    int    `json:"undersized"`    // Elements smaller than the minimum target size
+	Unnamed       int    `json:"unnamed"`       // Elements without an accessible name
+	MinTargetSize int    `json:"minTargetSize"` // Minimum target size in CSS pixels
+}
+
+// interactiveMapScript outlines every visible interactive element with its accessible name and size.
+// Undersized targets are outlined in red and unnamed ones are labelled as such.
+const interactiveMapScript = `((minSize) => {
+	const selector = 'a[href], button, input:not([type=hidden]), select, textarea, summary, ' +
+		'[role=button], [role=link], [role=checkbox], [role=radio], [role=switch], [role=tab], [role=menuitem], ' +
+		'[tabindex]:not([tabindex="-1"]), [contenteditable=""], [contenteditable=true]';
+
+	const accessibleName = (el) => {
+		const labelledBy = el.getAttribute('aria-labelledby');
+		if (labelledBy) {
+			const text = labelledBy.split(/\s+/).map((id) => {
+				const ref = document.getElementById(id);
+				return ref ? ref.innerText : '';
+			}).join(' ').trim();
+			if (text) return text;
+		}
+		if (el.labels && el.labels.length > 0) {
+			const text = Array.from(el.labels).map((l) => l.innerText).join(' ').trim();
+			if (text) return text;
+		}
+		const img = el.querySelector && el.querySelector('img[alt]');
+		return (el.getAttribute('aria-label') || el.innerText || el.getAttribute('alt') ||
+			el.getAttribute('title') || el.getAttribute('placeholder') || (img ? img.alt : '') ||
+			(el.type === 'submit' || el.type === 'button' ? el.value : '') || '').trim().slice(0, 60);
+	};
+
+	const describe = (el) => {
+		let element = el.tagName.toLowerCase();
+		if (el.id) {
+			element += '#' + el.id;
+		} else if (el.classList.length > 0) {
+			element += '.' + Array.from(el.classList).slice(0, 2).join('.');
+		}
+		return element;
+	};
+
+	let overlay = document.getElementById('__screenshot_interactive_map');
+	if (overlay) {
+		overlay.remove();
+	}
+	overlay = document.createElement('div');
+	overlay.id = '__screenshot_interactive_map';
+	Object.assign(overlay.style, {
+		position: 'absolute', top: '0', left: '0', width: '0', height: '0',
+		zIndex: '2147483647', pointerEvents: 'none'
+	});
+
+	const elements = [];
+	for (const el of document.querySelectorAll(selector)) {
+		const rect = el.getBoundingClientRect();
+		const style = getComputedStyle(el);
+		if (rect.width === 0 || rect.height === 0 || style.visibility === 'hidden' || style.display === 'none') {
+			continue;
+		}
+
+		const item = {
+			element: describe(el),
+			name: accessibleName(el),
+			x: rect.left + window.scrollX,
+			y: rect.top + window.scrollY,
+			width: rect.width,
+			height: rect.height
+		};
+		item.undersize = item.width < minSize || item.height < minSize;
+		elements.push(item);
+
+		const color = item.undersize ? '#e00000' : '#0070f0';
+		const box = document.createElement('div');
+		Object.assign(box.style, {
+			position: 'absolute', boxSizing: 'border-box',
+			left: item.x + 'px', top: item.y + 'px', width: item.width + 'px', height: item.height + 'px',
+			border: '2px solid ' + color, background: color + '22'
+		});
+
+		const label = document.createElement('div');
+		label.textContent = (item.name || '(no name)') + ' ' + Math.round(item.width) + '×' + Math.round(item.height);
+		Object.assign(label.style, {
+			position: 'absolute', left: '0', top: '-16px', whiteSpace: 'nowrap',
+			font: '11px/14px sans-serif', color: '#fff', background: color, padding: '0 3px'
+		});
+		box.appendChild(label);
+		overlay.appendChild(box);
+	}
+
+	document.body.appendChild(overlay);
+	return elements;
+})(%d)`
+
+// removeInteractiveMapScript removes the overlay added by interactiveMapScript
+const removeInteractiveMapScript = `(() => {
+	const overlay = document.getElementById('__screenshot_interactive_map');
+	if (overlay) {
+		overlay.remove();
+	}
+	return true;
+})()`
+
+// captureInteractiveMap outlines the interactive elements of the loaded page, captures the
+// full page as a diagnostic screenshot and writes the element list next to it
+func (s *Screenshoter) captureInteractiveMap(ctx context.Context, engine BrowserEngine, settings *config.InteractiveMap, urlConfig config.URLConfig, viewport config.Viewport, viewportDir string) (*InteractiveMapSummary, error) {
+	var elements []InteractiveElement
+	if err := evaluateExpression(engine, fmt.Sprintf(interactiveMapScript, settings.MinTargetSize), &elements); err != nil {
+		return nil, fmt.Errorf("failed to outline interactive elements: %w", err)
+	}
+
+	var buf []byte
+	_, err := s.captureFullHeight(ctx, engine, &buf)
+
+	// Remove the overlay even if the capture failed, later captures must not show it
+	if removeErr := evaluateExpression(engine, removeInteractiveMapScript, nil); removeErr != nil {
+		log.Printf("Warning: Failed to remove interactive elements overlay for %s: %v", urlConfig.Name, removeErr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture interactive elements map: %w", err)
+	}
+
+	name := SanitizeFilename(urlConfig.Name)
+	summary := &InteractiveMapSummary{
+		Screenshot:    fmt.Sprintf("%s-interactive-%dx%d.%s", name, viewport.Width, viewport.Height, s.Config.FileFormat),
+		Report:        fmt.Sprintf("%s-interactive.json", name),
+		Elements:      len(elements),
+		MinTargetSize: settings.MinTargetSize,
+	}
+	for _, element := range elements {
+		if element.Undersize {
+			summary.Undersized++
+		}
+		if element.Name == "" {
+			summary.Unnamed++
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(viewportDir, summary.Screenshot), buf, 0644); err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(elements, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(viewportDir, summary.Report), data, 0644); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Captured interactive elements map for %s at viewport %dx%d: %d elements, %d under %dpx, %d without a name",
+		urlConfig.Name, viewport.Width, viewport.Height, summary.Elements, summary.Undersized, summary.MinTargetSize, summary.Unnamed)
+	return summary, nil
+}
@@ -0,0 +1,284 @@
+package screenshot
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"screenshot-tool/config"
+)
+
+// Bounds for shrinking files that exceed the byte limit
+const (
+	minReencodeQuality = 40
+	maxShrinkAttempts  = 8
+)
+
+// ImageAdjustment records how a screenshot was changed to fit the configured limits
+type ImageAdjustment struct {
+	File           string `json:"file"`
+	OriginalFile   string `json:"originalFile,omitempty"` // Set when re-encoding changed the file name
+	OriginalWidth  int    `json:"originalWidth"`
+	OriginalHeight int    `json:"originalHeight"`
+	OriginalBytes  int64  `json:"originalBytes"`
+	Width          int    `json:"width"`
+	Height         int    `json:"height"`
+	Bytes          int64  `json:"bytes"`
+	Quality        int    `json:"quality,omitempty"` // JPEG quality used when re-encoding
+	Note           string `json:"note"`
+}
+
+// enforceImageLimits checks every screenshot in a viewport directory against the
+// configured limits, downscaling or re-encoding the ones that exceed them
+func (s *Screenshoter) enforceImageLimits(viewportDir string, vm *ViewportManifest) {
+	limits := s.Config.ImageLimits
+	if limits == nil {
+		return
+	}
+
+	entries, err := os.ReadDir(viewportDir)
+	if err != nil {
+		log.Printf("ERROR: Failed to read %s for image limits: %v", viewportDir, err)
+		return
+	}
+
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || (ext != ".png" && ext != ".jpeg") {
+			continue
+		}
+
+		path := filepath.Join(viewportDir, entry.Name())
+		adjustment, err := applyImageLimits(path, limits, s.Config.Quality)
+		if err != nil {
+			log.Printf("ERROR: Failed to apply image limits to %s: %v", path, err)
+			continue
+		}
+		if adjustment == nil {
+			continue
+		}
+
+		log.Printf("Adjusted %s to fit image limits: %s", adjustment.File, adjustment.Note)
+
+		// Keep the manifest's sample list pointing at the file that now exists
+		if adjustment.OriginalFile != "" && vm.Samples != nil {
+			for i, file := range vm.Samples.Files {
+				if filepath.Base(file) == adjustment.OriginalFile {
+					vm.Samples.Files[i] = filepath.Join(filepath.Dir(file), adjustment.File)
+				}
+			}
+		}
+		if adjustment.OriginalFile != "" {
+			for i := range vm.Truncations {
+				if vm.Truncations[i].Screenshot == adjustment.OriginalFile {
+					vm.Truncations[i].Screenshot = adjustment.File
+				}
+			}
+		}
+
+		vm.Adjustments = append(vm.Adjustments, *adjustment)
+	}
+}
+
+// applyImageLimits brings a single image within the limits, returning nil if it already fits
+func applyImageLimits(path string, limits *config.ImageLimits, quality int) (*ImageAdjustment, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, format, err := image.DecodeConfig(file)
+	file.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image header: %w", err)
+	}
+
+	scale := limitScale(cfg.Width, cfg.Height, limits)
+	tooLarge := limits.MaxBytes > 0 && info.Size() > limits.MaxBytes
+	if scale >= 1 && !tooLarge {
+		return nil, nil
+	}
+
+	img, err := loadImage(path)
+	if err != nil {
+		return nil, err
+	}
+
+	adjustment := &ImageAdjustment{
+		File:           filepath.Base(path),
+		OriginalWidth:  cfg.Width,
+		OriginalHeight: cfg.Height,
+		OriginalBytes:  info.Size(),
+	}
+	var notes []string
+
+	// Downscale to the pixel limits first
+	if scale < 1 {
+		img = resizeImage(img, scale)
+		notes = append(notes, fmt.Sprintf("downscaled from %dx%d to %dx%d to fit pixel limits",
+			cfg.Width, cfg.Height, img.Bounds().Dx(), img.Bounds().Dy()))
+	}
+
+	data, err := encodeImage(img, format, quality)
+	if err != nil {
+		return nil, err
+	}
+
+	// Shrink the file until it fits the byte limit
+	if limits.MaxBytes > 0 && int64(len(data)) > limits.MaxBytes {
+		if limits.Fallback == "reencode" {
+			if format == "png" {
+				format = "jpeg"
+				notes = append(notes, "re-encoded as JPEG to fit byte limit")
+			}
+			for q := min(quality, 90); int64(len(data)) > limits.MaxBytes && q >= minReencodeQuality; q -= 10 {
+				if data, err = encodeImage(img, format, q); err != nil {
+					return nil, err
+				}
+				quality = q
+			}
+			adjustment.Quality = quality
+		}
+
+		before := img.Bounds()
+		for attempt := 0; int64(len(data)) > limits.MaxBytes && attempt < maxShrinkAttempts; attempt++ {
+			// File size grows roughly with the pixel count, aim slightly below the limit
+			factor := math.Min(0.9, math.Sqrt(float64(limits.MaxBytes)/float64(len(data)))*0.95)
+			img = resizeImage(img, factor)
+			if data, err = encodeImage(img, format, quality); err != nil {
+				return nil, err
+			}
+		}
+
+		if img.Bounds() != before {
+			notes = append(notes, fmt.Sprintf("downscaled from %dx%d to %dx%d to fit byte limit",
+				before.Dx(), before.Dy(), img.Bounds().Dx(), img.Bounds().Dy()))
+		}
+		if int64(len(data)) > limits.MaxBytes {
+			notes = append(notes, fmt.Sprintf("still exceeds byte limit of %d bytes", limits.MaxBytes))
+		}
+	}
+
+	// Write the adjusted image, renaming it if the format changed
+	newPath := path
+	if ext := "." + format; filepath.Ext(path) != ext {
+		newPath = strings.TrimSuffix(path, filepath.Ext(path)) + ext
+		adjustment.OriginalFile = filepath.Base(path)
+		adjustment.File = filepath.Base(newPath)
+	}
+	if err := os.WriteFile(newPath, data, 0644); err != nil {
+		return nil, err
+	}
+	if newPath != path {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	adjustment.Width = img.Bounds().Dx()
+	adjustment.Height = img.Bounds().Dy()
+	adjustment.Bytes = int64(len(data))
+	adjustment.Note = strings.Join(notes, "; ")
+	return adjustment, nil
+}
+
+// limitScale returns the factor needed to fit the pixel limits, 1 if the image already fits
+func limitScale(width, height int, limits *config.ImageLimits) float64 {
+	scale := 1.0
+	if limits.MaxWidth > 0 && width > limits.MaxWidth {
+		scale = math.Min(scale, float64(limits.MaxWidth)/float64(width))
+	}
+	if limits.MaxHeight > 0 && height > limits.MaxHeight {
+		scale = math.Min(scale, float64(limits.MaxHeight)/float64(height))
+	}
+	if pixels := int64(width) * int64(height); limits.MaxPixels > 0 && pixels > limits.MaxPixels {
+		scale = math.Min(scale, math.Sqrt(float64(limits.MaxPixels)/float64(pixels)))
+	}
+	return scale
+}
+
+// encodeImage encodes an image as PNG or JPEG
+func encodeImage(img image.Image, format string, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	if format == "jpeg" {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s: %w", format, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// cropTop removes rows from the top of an encoded screenshot
+func cropTop(data []byte, format string, quality, rows int) ([]byte, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	cropped := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()-rows))
+	draw.Draw(cropped, cropped.Bounds(), img, image.Pt(bounds.Min.X, bounds.Min.Y+rows), draw.Src)
+	return encodeImage(cropped, format, quality)
+}
+
+// resizeImage scales an image down by the given factor, averaging the source
+// pixels covered by each destination pixel
+func resizeImage(img image.Image, factor float64) image.Image {
+	bounds := img.Bounds()
+	width := max(1, int(float64(bounds.Dx())*factor))
+	height := max(1, int(float64(bounds.Dy())*factor))
+
+	src, ok := img.(*image.RGBA)
+	if !ok {
+		src = image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+		draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+	}
+	srcW, srcH := src.Bounds().Dx(), src.Bounds().Dy()
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := y * srcH / height
+		y1 := max(y0+1, (y+1)*srcH/height)
+		for x := 0; x < width; x++ {
+			x0 := x * srcW / width
+			x1 := max(x0+1, (x+1)*srcW/width)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += uint64(p[0])
+					g += uint64(p[1])
+					b += uint64(p[2])
+					a += uint64(p[3])
+					n++
+				}
+			}
+
+			i := y*dst.Stride + x*4
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+
+	return dst
+}
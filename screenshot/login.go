@@ -0,0 +1,146 @@
+package screenshot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"screenshot-tool/config"
+
+	"github.com/chromedp/chromedp"
+)
+
+// loginSession holds the browser state produced by a login flow. The flow runs
+// once and every URL referencing the login reuses its result.
+type loginSession struct {
+	once  sync.Once
+	state *StorageState
+	err   error
+}
+
+// loginState returns the session for the URL's login flow, performing the login on first use
+func (s *Screenshoter) loginState(ctx context.Context, urlConfig config.URLConfig) (*StorageState, error) {
+	var login *config.Login
+	for i := range s.Config.Logins {
+		if s.Config.Logins[i].Name == urlConfig.LoginID {
+			login = &s.Config.Logins[i]
+			break
+		}
+	}
+	if login == nil {
+		return nil, fmt.Errorf("login %s not found", urlConfig.LoginID)
+	}
+
+	s.loginMu.Lock()
+	session, exists := s.logins[login.Name]
+	if !exists {
+		session = &loginSession{}
+		s.logins[login.Name] = session
+	}
+	s.loginMu.Unlock()
+
+	session.once.Do(func() {
+		session.state, session.err = s.performLogin(ctx, urlConfig, *login)
+	})
+
+	return session.state, session.err
+}
+
+// performLogin runs a login flow in its own browser and returns the resulting browser state.
+// A session saved by a previous run is reused instead if it still has valid cookies.
+func (s *Screenshoter) performLogin(ctx context.Context, urlConfig config.URLConfig, login config.Login) (*StorageState, error) {
+	if login.StorageState != "" {
+		state, err := loadStorageState(login.StorageState)
+		if err == nil && len(state.Cookies) > 0 {
+			log.Printf("Reusing saved session for login %s from %s (%d cookies)", login.Name, login.StorageState, len(state.Cookies))
+			return state, nil
+		}
+		if err != nil && !os.IsNotExist(err) {
+			log.Printf("Warning: Ignoring saved session for login %s: %v", login.Name, err)
+		}
+	}
+
+	log.Printf("Performing login %s at %s", login.Name, login.LoginURL)
+	start := time.Now()
+
+	// Use the URL's browser settings so proxies and DNS overrides also apply to the login
+	browserCtx, cancel, err := s.newBrowserContext(ctx, urlConfig, config.Viewport{Width: 1280, Height: 800})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start browser for login %s: %w", login.Name, err)
+	}
+	defer cancel()
+
+	loginCtx, cancelLogin := context.WithTimeout(browserCtx, time.Duration(login.Timeout)*time.Millisecond)
+	defer cancelLogin()
+
+	state := &StorageState{}
+	tasks := chromedp.Tasks{
+		chromedp.Navigate(login.LoginURL),
+		chromedp.WaitVisible(login.UsernameSelector, chromedp.ByQuery),
+		chromedp.SendKeys(login.UsernameSelector, login.Username, chromedp.ByQuery),
+		chromedp.SendKeys(login.PasswordSelector, login.Password, chromedp.ByQuery),
+		chromedp.Click(login.SubmitSelector, chromedp.ByQuery),
+		waitForLoginSuccess(login),
+		captureStorageState(state),
+	}
+
+	if err := chromedp.Run(loginCtx, tasks); err != nil {
+		return nil, fmt.Errorf("login %s failed: %w", login.Name, err)
+	}
+
+	log.Printf("Login %s succeeded in %v, captured %d session cookies", login.Name, time.Since(start).Round(time.Millisecond), len(state.Cookies))
+
+	// Save the session so later runs can skip the login
+	if login.StorageState != "" {
+		if err := saveStorageState(login.StorageState, state); err != nil {
+			log.Printf("ERROR: Failed to save session for login %s: %v", login.Name, err)
+		} else {
+			log.Printf("Saved session for login %s to %s", login.Name, login.StorageState)
+		}
+	}
+
+	return state, nil
+}
+
+// waitForLoginSuccess waits until the configured success condition is met
+func waitForLoginSuccess(login config.Login) chromedp.ActionFunc {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		if login.SuccessSelector != "" {
+			if err := chromedp.WaitVisible(login.SuccessSelector, chromedp.ByQuery).Do(ctx); err != nil {
+				return fmt.Errorf("success selector %q not visible: %w", login.SuccessSelector, err)
+			}
+		}
+
+		if login.SuccessURL != "" {
+			for {
+				var location string
+				if err := chromedp.Location(&location).Do(ctx); err != nil {
+					return err
+				}
+				if strings.Contains(location, login.SuccessURL) {
+					break
+				}
+				if err := chromedp.Sleep(250 * time.Millisecond).Do(ctx); err != nil {
+					return fmt.Errorf("URL did not reach %q, last location %s: %w", login.SuccessURL, location, err)
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// applyLoginSession injects the login flow's session into the browser before the first navigation
+func (s *Screenshoter) applyLoginSession(ctx context.Context, browserCtx context.Context, urlConfig *config.URLConfig) error {
+	state, err := s.loginState(ctx, *urlConfig)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Applying session from login %s to %s", urlConfig.LoginID, urlConfig.Name)
+	return applyStorageState(browserCtx, state, urlConfig)
+}
@@ -0,0 +1,104 @@
+package screenshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"screenshot-tool/config"
+)
+
+// Manifest records what was captured for a single URL
+type Manifest struct {
+	Index           int                 `json:"index,omitempty"` // 1-based position of the URL in the configuration
+	Name            string              `json:"name"`
+	URL             string              `json:"url"`
+	Label           string              `json:"label,omitempty"`       // Label of the run the URL was captured in
+	Browser         string              `json:"browser,omitempty"`     // Browser the URL was captured in if not Chrome
+	Timezone        string              `json:"timezone,omitempty"`    // Emulated time zone the pages were rendered in
+	Geolocation     *config.Geolocation `json:"geolocation,omitempty"` // Emulated position reported to the pages
+	Throttling      *config.Throttling  `json:"throttling,omitempty"`  // Network throttling the pages were loaded with
+	StartedAt       time.Time           `json:"startedAt"`
+	FinishedAt      time.Time           `json:"finishedAt"`
+	Viewports       []*ViewportManifest `json:"viewports"`
+	Simulation      *SimulationPlan     `json:"simulation,omitempty"` // Randomized user session replayed before each capture
+	BytesDownloaded int64               `json:"bytesDownloaded"`      // Bytes the browser downloaded for all viewports
+	ArtifactBytes   int64               `json:"artifactBytes"`        // Size of the artifacts in the URL directory, excluding the manifest
+	Checksums       map[string]string   `json:"checksums,omitempty"`  // SHA-256 of each artifact, keyed by its path relative to the URL directory
+
+	mu sync.Mutex
+}
+
+// ViewportManifest records the results for a single viewport of a URL
+type ViewportManifest struct {
+	Width           int                    `json:"width"`
+	Height          int                    `json:"height"`
+	Mobile          bool                   `json:"mobile,omitempty"`
+	Touch           bool                   `json:"touch,omitempty"`
+	Orientation     string                 `json:"orientation,omitempty"`
+	Samples         *SampleSet             `json:"samples,omitempty"`
+	Adjustments     []ImageAdjustment      `json:"adjustments,omitempty"`     // Screenshots changed to fit the image limits
+	BytesSaved      int64                  `json:"bytesSaved,omitempty"`      // Bytes saved by recompressing the screenshots
+	Metrics         *PageMetrics           `json:"metrics,omitempty"`         // Performance of the full page capture's page load
+	Transport       *TransportInfo         `json:"transport,omitempty"`       // Protocol and TLS parameters of the full page capture's main document
+	Accessibility   *AccessibilitySummary  `json:"accessibility,omitempty"`   // Result of the accessibility audit
+	Substitutions   []Substitution         `json:"substitutions,omitempty"`   // Dynamic text replaced by placeholders
+	Diff            *DiffResult            `json:"diff,omitempty"`            // Comparison of the full page capture with its baseline
+	Truncations     []Truncation           `json:"truncations,omitempty"`     // Full page screenshots that don't show the whole page
+	Printable       string                 `json:"printable,omitempty"`       // Print view screenshot taken at the end of the actions
+	FocusStops      []FocusStop            `json:"focusStops,omitempty"`      // Keyboard navigation captures in tab order
+	Interactive     *InteractiveMapSummary `json:"interactive,omitempty"`     // Diagnostic map of the interactive elements
+	Failure         *ViewportFailure       `json:"failure,omitempty"`         // How the capture failed, also reported in failure.json
+	Trace           string                 `json:"trace,omitempty"`           // DevTools performance trace of the page load
+	ScrollRecording string                 `json:"scrollRecording,omitempty"` // Animated recording of the page scrolling from top to bottom
+	Video           string                 `json:"video,omitempty"`           // Recording of the whole capture session
+	BytesDownloaded int64                  `json:"bytesDownloaded"`           // Bytes the browser downloaded for all captures of the viewport
+}
+
+// newManifest creates a manifest for a URL capture
+func newManifest(urlConfig config.URLConfig) *Manifest {
+	return &Manifest{
+		Name:        urlConfig.Name,
+		URL:         urlConfig.URL,
+		Browser:     urlConfig.Browser,
+		Timezone:    urlConfig.Timezone,
+		Geolocation: urlConfig.Geolocation,
+		Throttling:  urlConfig.Throttling,
+		StartedAt:   time.Now(),
+		Viewports:   make([]*ViewportManifest, 0, len(urlConfig.Viewports)),
+	}
+}
+
+// addViewport adds an entry for a viewport, safe for concurrent use
+func (m *Manifest) addViewport(viewport config.Viewport) *ViewportManifest {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	vm := &ViewportManifest{
+		Width:       viewport.Width,
+		Height:      viewport.Height,
+		Mobile:      viewport.Mobile,
+		Touch:       viewport.Touch,
+		Orientation: viewport.Orientation,
+	}
+	m.Viewports = append(m.Viewports, vm)
+	return vm
+}
+
+// write saves the manifest as manifest.json in the URL directory
+func (m *Manifest) write(urlDir string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.FinishedAt = time.Now()
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	return os.WriteFile(filepath.Join(urlDir, "manifest.json"), data, 0644)
+}
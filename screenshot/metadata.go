@@ -0,0 +1,257 @@
+package screenshot
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"screenshot-tool/config"
+)
+
+// pngSignature starts every PNG file
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// imageMetadata is the provenance written into a screenshot file
+type imageMetadata struct {
+	URL        string
+	CapturedAt time.Time
+	Viewport   string
+	Software   string
+	ConfigHash string
+}
+
+// fields returns the metadata as keyword and value pairs, in the order they are written
+func (m imageMetadata) fields() [][2]string {
+	return [][2]string{
+		{"URL", m.URL},
+		{"Creation Time", m.CapturedAt.Format(time.RFC3339)},
+		{"Viewport", m.Viewport},
+		{"Software", m.Software},
+		{"Config Hash", "sha256:" + m.ConfigHash},
+	}
+}
+
+// embedMetadata writes the URL, capture time, viewport, tool version and configuration hash
+// into every screenshot in a viewport directory, so the provenance travels with the file.
+// The capture time is the time the file was written, which is kept.
+func (s *Screenshoter) embedMetadata(viewportDir string, urlConfig config.URLConfig, viewport config.Viewport) {
+	if !s.Config.EmbedMetadata {
+		return
+	}
+
+	entries, err := os.ReadDir(viewportDir)
+	if err != nil {
+		log.Printf("ERROR: Failed to read %s for metadata: %v", viewportDir, err)
+		return
+	}
+
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || (ext != ".png" && ext != ".jpeg") {
+			continue
+		}
+
+		path := filepath.Join(viewportDir, entry.Name())
+		info, err := entry.Info()
+		if err != nil {
+			log.Printf("ERROR: Failed to embed metadata into %s: %v", path, err)
+			continue
+		}
+		metadata := imageMetadata{
+			URL:        urlConfig.URL,
+			CapturedAt: info.ModTime(),
+			Viewport:   fmt.Sprintf("%dx%d", viewport.Width, viewport.Height),
+			Software:   ToolVersion(),
+			ConfigHash: s.configHash,
+		}
+		if err := embedImageMetadata(path, metadata); err != nil {
+			log.Printf("ERROR: Failed to embed metadata into %s: %v", path, err)
+		}
+	}
+}
+
+// embedImageMetadata writes metadata into a PNG or JPEG file
+func embedImageMetadata(path string, metadata imageMetadata) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if bytes.HasPrefix(data, pngSignature) {
+		data, err = embedPNGText(data, metadata.fields())
+	} else {
+		data, err = embedJPEGMetadata(data, metadata)
+	}
+	if err != nil {
+		return err
+	}
+	return replaceKeepingModTime(path, data)
+}
+
+// embedPNGText adds a text chunk per field after the PNG header. ASCII values are
+// written as tEXt chunks, others as UTF-8 iTXt chunks.
+func embedPNGText(data []byte, fields [][2]string) ([]byte, error) {
+	// The IHDR chunk always comes first and holds 13 bytes
+	headerEnd := len(pngSignature) + 8 + 13 + 4
+	if len(data) < headerEnd || string(data[len(pngSignature)+4:len(pngSignature)+8]) != "IHDR" {
+		return nil, fmt.Errorf("not a valid PNG file")
+	}
+
+	var out bytes.Buffer
+	out.Write(data[:headerEnd])
+	for _, field := range fields {
+		if isASCII(field[1]) {
+			writePNGChunk(&out, "tEXt", []byte(field[0]+"\x00"+field[1]))
+		} else {
+			// Uncompressed, without language tag or translated keyword
+			writePNGChunk(&out, "iTXt", []byte(field[0]+"\x00\x00\x00\x00\x00"+field[1]))
+		}
+	}
+	out.Write(data[headerEnd:])
+	return out.Bytes(), nil
+}
+
+// writePNGChunk writes a PNG chunk with its length and checksum
+func writePNGChunk(w *bytes.Buffer, chunkType string, payload []byte) {
+	binary.Write(w, binary.BigEndian, uint32(len(payload)))
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(chunkType))
+	crc.Write(payload)
+	w.WriteString(chunkType)
+	w.Write(payload)
+	binary.Write(w, binary.BigEndian, crc.Sum32())
+}
+
+// embedJPEGMetadata adds an EXIF segment with the URL as image description, the tool
+// version and the capture time, and a comment segment with all fields. They are inserted
+// after the start of image and a JFIF header, which must come first.
+func embedJPEGMetadata(data []byte, metadata imageMetadata) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, fmt.Errorf("not a valid JPEG file")
+	}
+	insertAt := 2
+	if data[2] == 0xFF && data[3] == 0xE0 && len(data) >= 6 {
+		insertAt += 2 + int(binary.BigEndian.Uint16(data[4:6]))
+	}
+
+	exif := exifSegment(metadata)
+	var comment strings.Builder
+	for _, field := range metadata.fields() {
+		fmt.Fprintf(&comment, "%s: %s\n", field[0], field[1])
+	}
+	if len(exif) > 0xFFFF-2 || comment.Len() > 0xFFFF-2 {
+		return nil, fmt.Errorf("metadata exceeds the size of a JPEG segment")
+	}
+
+	var out bytes.Buffer
+	out.Write(data[:insertAt])
+	writeJPEGSegment(&out, 0xE1, exif)
+	writeJPEGSegment(&out, 0xFE, []byte(comment.String()))
+	out.Write(data[insertAt:])
+	return out.Bytes(), nil
+}
+
+// writeJPEGSegment writes a JPEG marker segment with its length
+func writeJPEGSegment(w *bytes.Buffer, marker byte, payload []byte) {
+	w.Write([]byte{0xFF, marker})
+	binary.Write(w, binary.BigEndian, uint16(len(payload)+2))
+	w.Write(payload)
+}
+
+// exifSegment builds the payload of an EXIF APP1 segment with a single image file directory
+// holding the ImageDescription, Software and DateTime tags
+func exifSegment(metadata imageMetadata) []byte {
+	tags := []struct {
+		id    uint16
+		value string
+	}{
+		{0x010E, metadata.URL},
+		{0x0131, metadata.Software},
+		{0x0132, metadata.CapturedAt.Format("2006:01:02 15:04:05")},
+	}
+
+	// Values that don't fit into their 4 byte entry follow the directory
+	const headerSize = 8
+	dirSize := 2 + len(tags)*12 + 4
+	var dir, values bytes.Buffer
+	binary.Write(&dir, binary.BigEndian, uint16(len(tags)))
+	for _, tag := range tags {
+		value := append([]byte(tag.value), 0)
+		binary.Write(&dir, binary.BigEndian, tag.id)
+		binary.Write(&dir, binary.BigEndian, uint16(2)) // ASCII
+		binary.Write(&dir, binary.BigEndian, uint32(len(value)))
+		if len(value) <= 4 {
+			dir.Write(append(value, make([]byte, 4-len(value))...))
+			continue
+		}
+		binary.Write(&dir, binary.BigEndian, uint32(headerSize+dirSize+values.Len()))
+		values.Write(value)
+	}
+	binary.Write(&dir, binary.BigEndian, uint32(0)) // No further directory
+
+	var segment bytes.Buffer
+	segment.WriteString("Exif\x00\x00")
+	segment.WriteString("MM\x00\x2A\x00\x00\x00\x08") // Big endian TIFF header, directory at offset 8
+	segment.Write(dir.Bytes())
+	segment.Write(values.Bytes())
+	return segment.Bytes()
+}
+
+// replaceKeepingModTime rewrites a file without changing its modification time,
+// which records when the screenshot was captured
+func replaceKeepingModTime(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+	return os.Chtimes(path, time.Time{}, info.ModTime())
+}
+
+// isASCII reports whether a string only holds ASCII characters
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// ToolVersion names the tool with the version and revision it was built from
+func ToolVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "screenshot-tool"
+	}
+	version := "screenshot-tool " + info.Main.Version
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" && len(setting.Value) >= 12 {
+			version += " (" + setting.Value[:12] + ")"
+		}
+	}
+	return version
+}
+
+// ConfigHash returns the SHA-256 of a loaded configuration, which identifies the settings a screenshot was captured with
+func ConfigHash(cfg *config.Config) string {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,94 @@
+package screenshot
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"screenshot-tool/config"
+)
+
+// PageMetrics holds web performance metrics of a page load, timings are in
+// milliseconds from the start of navigation
+type PageMetrics struct {
+	TTFB             float64 `json:"ttfbMs"`             // Time to first byte of the document
+	DOMContentLoaded float64 `json:"domContentLoadedMs"` // End of the DOMContentLoaded event
+	Load             float64 `json:"loadMs"`             // End of the load event
+	FCP              float64 `json:"fcpMs"`              // First contentful paint
+	LCP              float64 `json:"lcpMs"`              // Largest contentful paint
+	TransferBytes    int64   `json:"transferBytes"`      // Bytes transferred for the document and its resources
+	Requests         int     `json:"requests"`           // Number of requests, including the document
+}
+
+// pageMetricsScript reads the metrics from the Performance API. LCP is only
+// exposed through an observer, whose buffered entries arrive asynchronously.
+const pageMetricsScript = `new Promise((resolve) => {
+	const nav = performance.getEntriesByType('navigation')[0] || {};
+	const fcp = performance.getEntriesByName('first-contentful-paint')[0];
+	let lcp = 0;
+	try {
+		new PerformanceObserver((list) => {
+			for (const entry of list.getEntries()) {
+				lcp = entry.startTime;
+			}
+		}).observe({type: 'largest-contentful-paint', buffered: true});
+	} catch (e) {}
+
+	setTimeout(() => {
+		const resources = performance.getEntriesByType('resource');
+		resolve({
+			ttfbMs: nav.responseStart || 0,
+			domContentLoadedMs: nav.domContentLoadedEventEnd || 0,
+			loadMs: nav.loadEventEnd || 0,
+			fcpMs: fcp ? fcp.startTime : 0,
+			lcpMs: lcp,
+			transferBytes: resources.reduce((sum, r) => sum + (r.transferSize || 0), nav.transferSize || 0),
+			requests: resources.length + 1,
+		});
+	}, 100);
+})`
+
+// collectPageMetrics reads the performance metrics of the currently loaded page
+func collectPageMetrics(engine BrowserEngine, metrics *PageMetrics) error {
+	return evaluateExpression(engine, pageMetricsScript, metrics)
+}
+
+// writeMetricsCSV writes the metrics of every viewport of a URL to a CSV file in the URL directory
+func writeMetricsCSV(urlDir string, urlConfig config.URLConfig, manifest *Manifest) error {
+	manifest.mu.Lock()
+	defer manifest.mu.Unlock()
+
+	var b strings.Builder
+	b.WriteString("Timestamp,URL,URL_Name,Viewport,TTFB_ms,DOMContentLoaded_ms,Load_ms,FCP_ms,LCP_ms,Transfer_Bytes,Requests\n")
+
+	timestamp := time.Now().Format("20060102-150405")
+	urlValue := strings.ReplaceAll(urlConfig.URL, ",", "\\,")
+	urlName := strings.ReplaceAll(urlConfig.Name, ",", "\\,")
+
+	rows := 0
+	for _, vm := range manifest.Viewports {
+		m := vm.Metrics
+		if m == nil {
+			continue
+		}
+		fmt.Fprintf(&b, "%s,%s,%s,%dx%d,%.0f,%.0f,%.0f,%.0f,%.0f,%d,%d\n",
+			timestamp, urlValue, urlName, vm.Width, vm.Height,
+			m.TTFB, m.DOMContentLoaded, m.Load, m.FCP, m.LCP, m.TransferBytes, m.Requests)
+		rows++
+	}
+
+	if rows == 0 {
+		return nil
+	}
+
+	path := filepath.Join(urlDir, fmt.Sprintf("%s-metrics.csv", SanitizeFilename(urlConfig.Name)))
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		return err
+	}
+
+	log.Printf("Wrote performance metrics for %d viewports to %s", rows, path)
+	return nil
+}
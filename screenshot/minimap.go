@@ -0,0 +1,64 @@
+package screenshot
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+)
+
+// Minimap strip layout, in pixels
+const (
+	minimapWidth   = 16
+	minimapPadding = 3
+	minimapMinMark = 4 // Shortest marker, so sections of very long pages stay visible
+)
+
+var (
+	minimapBackground = color.RGBA{0xf3, 0xf4, 0xf6, 0xff}
+	minimapTrack      = color.RGBA{0xd1, 0xd5, 0xdb, 0xff}
+	minimapMarker     = color.RGBA{0x25, 0x63, 0xeb, 0xff}
+)
+
+// addMinimap widens a viewport section screenshot by a strip on its right edge, in which a
+// marker shows the part of the page the section covers. The captured pixels are kept as they are.
+func addMinimap(path, format string, quality int, scrollPos, sectionHeight, pageHeight float64) error {
+	img, err := loadImage(path)
+	if err != nil {
+		return err
+	}
+
+	bounds := img.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, bounds.Dx()+minimapWidth, bounds.Dy()))
+	draw.Draw(out, bounds.Sub(bounds.Min), img, bounds.Min, draw.Src)
+
+	strip := image.Rect(bounds.Dx(), 0, out.Bounds().Dx(), bounds.Dy())
+	draw.Draw(out, strip, &image.Uniform{minimapBackground}, image.Point{}, draw.Src)
+
+	// The track stands for the whole page, scaled to the height of the image
+	track := strip.Inset(minimapPadding)
+	if track.Empty() || pageHeight <= 0 {
+		return writeMinimap(path, out, format, quality)
+	}
+	draw.Draw(out, track, &image.Uniform{minimapTrack}, image.Point{}, draw.Src)
+
+	top := track.Min.Y + int(scrollPos/pageHeight*float64(track.Dy()))
+	bottom := track.Min.Y + int((scrollPos+sectionHeight)/pageHeight*float64(track.Dy()))
+	if bottom-top < minimapMinMark {
+		bottom = min(track.Max.Y, top+minimapMinMark)
+		top = bottom - minimapMinMark
+	}
+	marker := image.Rect(track.Min.X, max(top, track.Min.Y), track.Max.X, min(bottom, track.Max.Y))
+	draw.Draw(out, marker, &image.Uniform{minimapMarker}, image.Point{}, draw.Src)
+
+	return writeMinimap(path, out, format, quality)
+}
+
+// writeMinimap replaces the screenshot with the image including its minimap
+func writeMinimap(path string, img image.Image, format string, quality int) error {
+	data, err := encodeImage(img, format, quality)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,208 @@
+package screenshot
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// NTLM negotiate flags used by the proxy helper
+const (
+	ntlmNegotiateUnicode        = 0x00000001
+	ntlmRequestTarget           = 0x00000004
+	ntlmNegotiateNTLM           = 0x00000200
+	ntlmNegotiateAlwaysSign     = 0x00008000
+	ntlmNegotiateExtendedSecure = 0x00080000
+	ntlmNegotiateTargetInfo     = 0x00800000
+	ntlmNegotiate128            = 0x20000000
+	ntlmNegotiate56             = 0x80000000
+)
+
+var ntlmSignature = []byte("NTLMSSP\x00")
+
+// ntlmNegotiateMessage builds the type 1 message that starts an NTLM handshake
+func ntlmNegotiateMessage() []byte {
+	flags := uint32(ntlmNegotiateUnicode | ntlmRequestTarget | ntlmNegotiateNTLM |
+		ntlmNegotiateAlwaysSign | ntlmNegotiateExtendedSecure | ntlmNegotiate128 | ntlmNegotiate56)
+
+	msg := make([]byte, 32)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], 1)
+	binary.LittleEndian.PutUint32(msg[12:], flags)
+	// Domain and workstation security buffers are left empty
+	return msg
+}
+
+// ntlmChallenge holds the parts of a type 2 message needed to answer it
+type ntlmChallenge struct {
+	flags      uint32
+	challenge  []byte
+	targetInfo []byte
+}
+
+// parseNTLMChallenge parses the type 2 message sent by the proxy
+func parseNTLMChallenge(msg []byte) (*ntlmChallenge, error) {
+	if len(msg) < 32 || !bytes.Equal(msg[:8], ntlmSignature) {
+		return nil, fmt.Errorf("invalid NTLM challenge message")
+	}
+	if msgType := binary.LittleEndian.Uint32(msg[8:]); msgType != 2 {
+		return nil, fmt.Errorf("unexpected NTLM message type %d", msgType)
+	}
+
+	challenge := &ntlmChallenge{
+		flags:     binary.LittleEndian.Uint32(msg[20:]),
+		challenge: msg[24:32],
+	}
+
+	if challenge.flags&ntlmNegotiateTargetInfo != 0 && len(msg) >= 48 {
+		length := int(binary.LittleEndian.Uint16(msg[40:]))
+		offset := int(binary.LittleEndian.Uint32(msg[44:]))
+		if offset+length > len(msg) {
+			return nil, fmt.Errorf("NTLM target info out of range")
+		}
+		challenge.targetInfo = msg[offset : offset+length]
+	}
+
+	return challenge, nil
+}
+
+// ntlmAuthenticateMessage builds the type 3 message answering a challenge with an NTLMv2 response
+func ntlmAuthenticateMessage(challenge *ntlmChallenge, domain, username, password string) ([]byte, error) {
+	// Accept DOMAIN\user style usernames
+	if idx := strings.Index(username, "\\"); idx >= 0 {
+		domain = username[:idx]
+		username = username[idx+1:]
+	}
+
+	clientChallenge := make([]byte, 8)
+	if _, err := rand.Read(clientChallenge); err != nil {
+		return nil, err
+	}
+
+	ntHash := md4Sum(utf16LE(password))
+	v2Hash := hmacMD5(ntHash, utf16LE(strings.ToUpper(username)+domain))
+
+	// Windows FILETIME: 100ns intervals since January 1, 1601
+	timestamp := uint64(time.Now().UnixNano()/100) + 116444736000000000
+
+	var blob bytes.Buffer
+	blob.Write([]byte{0x01, 0x01, 0, 0, 0, 0, 0, 0})
+	binary.Write(&blob, binary.LittleEndian, timestamp)
+	blob.Write(clientChallenge)
+	blob.Write([]byte{0, 0, 0, 0})
+	blob.Write(challenge.targetInfo)
+	blob.Write([]byte{0, 0, 0, 0})
+
+	ntProof := hmacMD5(v2Hash, append(append([]byte{}, challenge.challenge...), blob.Bytes()...))
+	ntResponse := append(ntProof, blob.Bytes()...)
+	lmResponse := append(hmacMD5(v2Hash, append(append([]byte{}, challenge.challenge...), clientChallenge...)), clientChallenge...)
+
+	fields := [][]byte{
+		lmResponse,
+		ntResponse,
+		utf16LE(domain),
+		utf16LE(username),
+		utf16LE("PROOFSCAPE"),
+		nil, // Encrypted session key
+	}
+
+	header := make([]byte, 64)
+	copy(header, ntlmSignature)
+	binary.LittleEndian.PutUint32(header[8:], 3)
+
+	var payload bytes.Buffer
+	offset := len(header)
+	for i, field := range fields {
+		pos := 12 + i*8
+		binary.LittleEndian.PutUint16(header[pos:], uint16(len(field)))
+		binary.LittleEndian.PutUint16(header[pos+2:], uint16(len(field)))
+		binary.LittleEndian.PutUint32(header[pos+4:], uint32(offset+payload.Len()))
+		payload.Write(field)
+	}
+
+	flags := challenge.flags &^ ntlmNegotiateTargetInfo
+	binary.LittleEndian.PutUint32(header[60:], flags|ntlmNegotiateUnicode)
+
+	return append(header, payload.Bytes()...), nil
+}
+
+// utf16LE encodes a string as UTF-16 little endian
+func utf16LE(s string) []byte {
+	encoded := utf16.Encode([]rune(s))
+	buf := make([]byte, len(encoded)*2)
+	for i, r := range encoded {
+		binary.LittleEndian.PutUint16(buf[i*2:], r)
+	}
+	return buf
+}
+
+// hmacMD5 computes HMAC-MD5 of data with the given key
+func hmacMD5(key, data []byte) []byte {
+	mac := hmac.New(md5.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// md4Sum computes the MD4 digest (RFC 1320), which NTLM uses for password hashes
+func md4Sum(data []byte) []byte {
+	a, b, c, d := uint32(0x67452301), uint32(0xefcdab89), uint32(0x98badcfe), uint32(0x10325476)
+
+	// Pad to a multiple of 64 bytes with the message length in bits at the end
+	msg := append([]byte{}, data...)
+	msg = append(msg, 0x80)
+	for len(msg)%64 != 56 {
+		msg = append(msg, 0)
+	}
+	msg = binary.LittleEndian.AppendUint64(msg, uint64(len(data))*8)
+
+	var x [16]uint32
+	for chunk := 0; chunk < len(msg); chunk += 64 {
+		for i := range x {
+			x[i] = binary.LittleEndian.Uint32(msg[chunk+i*4:])
+		}
+
+		aa, bb, cc, dd := a, b, c, d
+
+		f := func(x, y, z uint32) uint32 { return (x & y) | (^x & z) }
+		g := func(x, y, z uint32) uint32 { return (x & y) | (x & z) | (y & z) }
+		h := func(x, y, z uint32) uint32 { return x ^ y ^ z }
+
+		for _, i := range []int{0, 4, 8, 12} {
+			a = bits.RotateLeft32(a+f(b, c, d)+x[i], 3)
+			d = bits.RotateLeft32(d+f(a, b, c)+x[i+1], 7)
+			c = bits.RotateLeft32(c+f(d, a, b)+x[i+2], 11)
+			b = bits.RotateLeft32(b+f(c, d, a)+x[i+3], 19)
+		}
+		for _, i := range []int{0, 1, 2, 3} {
+			a = bits.RotateLeft32(a+g(b, c, d)+x[i]+0x5a827999, 3)
+			d = bits.RotateLeft32(d+g(a, b, c)+x[i+4]+0x5a827999, 5)
+			c = bits.RotateLeft32(c+g(d, a, b)+x[i+8]+0x5a827999, 9)
+			b = bits.RotateLeft32(b+g(c, d, a)+x[i+12]+0x5a827999, 13)
+		}
+		for _, i := range []int{0, 2, 1, 3} {
+			a = bits.RotateLeft32(a+h(b, c, d)+x[i]+0x6ed9eba1, 3)
+			d = bits.RotateLeft32(d+h(a, b, c)+x[i+8]+0x6ed9eba1, 9)
+			c = bits.RotateLeft32(c+h(d, a, b)+x[i+4]+0x6ed9eba1, 11)
+			b = bits.RotateLeft32(b+h(c, d, a)+x[i+12]+0x6ed9eba1, 15)
+		}
+
+		a += aa
+		b += bb
+		c += cc
+		d += dd
+	}
+
+	sum := make([]byte, 16)
+	binary.LittleEndian.PutUint32(sum[0:], a)
+	binary.LittleEndian.PutUint32(sum[4:], b)
+	binary.LittleEndian.PutUint32(sum[8:], c)
+	binary.LittleEndian.PutUint32(sum[12:], d)
+	return sum
+}
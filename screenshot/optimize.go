@@ -0,0 +1,126 @@
+package screenshot
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxPaletteColors is the most colors a PNG palette holds
+const maxPaletteColors = 256
+
+// optimizeImages recompresses the PNG screenshots in a viewport directory without changing
+// a pixel. Chrome favours speed when encoding, so most captures shrink considerably.
+func (s *Screenshoter) optimizeImages(viewportDir string, vm *ViewportManifest) {
+	if !s.Config.OptimizeImages {
+		return
+	}
+
+	entries, err := os.ReadDir(viewportDir)
+	if err != nil {
+		log.Printf("ERROR: Failed to read %s for image optimization: %v", viewportDir, err)
+		return
+	}
+
+	var before, after int64
+	for _, entry := range entries {
+		if entry.IsDir() || strings.ToLower(filepath.Ext(entry.Name())) != ".png" {
+			continue
+		}
+
+		path := filepath.Join(viewportDir, entry.Name())
+		original, optimized, err := optimizePNG(path)
+		if err != nil {
+			log.Printf("ERROR: Failed to optimize %s: %v", path, err)
+			continue
+		}
+		before += original
+		after += optimized
+	}
+
+	if before > after {
+		vm.BytesSaved = before - after
+		log.Printf("Optimized screenshots in %s: %s saved (%.0f%%)", viewportDir, formatBytes(uint64(before-after)), 100*float64(before-after)/float64(before))
+	}
+}
+
+// optimizePNG rewrites a PNG with the best compression, as a palette image if it has few
+// enough colors. The file is only replaced if it gets smaller. It returns the sizes before and after.
+func optimizePNG(path string) (int64, int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if paletted := toPaletted(img); paletted != nil {
+		img = paletted
+	}
+
+	var buf bytes.Buffer
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := encoder.Encode(&buf, img); err != nil {
+		return 0, 0, err
+	}
+
+	original := int64(len(data))
+	if int64(buf.Len()) >= original {
+		return original, original, nil
+	}
+	if err := replaceKeepingModTime(path, buf.Bytes()); err != nil {
+		return 0, 0, err
+	}
+	return original, int64(buf.Len()), nil
+}
+
+// toPaletted converts an 8-bit RGB or RGBA image with at most 256 colors to a palette image
+// holding exactly those colors, or returns nil if it has more or is of another type
+func toPaletted(img image.Image) *image.Paletted {
+	// The decoder returns RGBA only for opaque images, whose colors are the same in NRGBA
+	var pix []uint8
+	var stride int
+	switch img := img.(type) {
+	case *image.RGBA:
+		pix, stride = img.Pix, img.Stride
+	case *image.NRGBA:
+		pix, stride = img.Pix, img.Stride
+	default:
+		return nil
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	paletted := &image.Paletted{
+		Pix:    make([]uint8, width*height),
+		Stride: width,
+		Rect:   image.Rect(0, 0, width, height),
+	}
+
+	indices := make(map[uint32]uint8, maxPaletteColors)
+	for y := 0; y < height; y++ {
+		row := pix[y*stride : y*stride+width*4]
+		for x := 0; x < width; x++ {
+			r, g, b, a := row[x*4], row[x*4+1], row[x*4+2], row[x*4+3]
+			key := uint32(r)<<24 | uint32(g)<<16 | uint32(b)<<8 | uint32(a)
+			index, ok := indices[key]
+			if !ok {
+				if len(paletted.Palette) == maxPaletteColors {
+					return nil
+				}
+				index = uint8(len(paletted.Palette))
+				indices[key] = index
+				paletted.Palette = append(paletted.Palette, color.NRGBA{r, g, b, a})
+			}
+			paletted.Pix[y*width+x] = index
+		}
+	}
+	return paletted
+}
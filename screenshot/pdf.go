@@ -0,0 +1,79 @@
+package screenshot
+
+import (
+	"context"
+	"fmt"
+	"html"
+
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+)
+
+// waitForImagesScript resolves once every image of the document has loaded or failed to
+const waitForImagesScript = `Promise.all(Array.from(document.images).map((img) => img.complete ? null :
+	new Promise((resolve) => { img.onload = img.onerror = resolve; })))`
+
+// pdfFooterTemplate numbers the pages of a printed PDF. Chrome fills in the classes.
+const pdfFooterTemplate = `<div style="width: 100%%; font-size: 8px; font-family: Arial, sans-serif; color: #555; padding: 0 10mm; display: flex; justify-content: space-between;">
+	<span>%s</span><span>Page <span class="pageNumber"></span> of <span class="totalPages"></span></span>
+</div>`
+
+// PrintPDF renders an HTML document to an A4 PDF in Chrome, with footer text and the
+// page number at the bottom of every page. Images may be embedded as data URLs, as the
+// document can't load local files in Docker Chrome.
+func PrintPDF(ctx context.Context, chromeMode, document, footer string) ([]byte, error) {
+	sb, err := StartStandby(chromeMode, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer sb.Close()
+
+	tabCtx, cancelTab, err := sb.newTab(1280, 800)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open a tab: %w", err)
+	}
+	defer cancelTab()
+
+	// Stop when the caller gives up
+	stop := context.AfterFunc(ctx, cancelTab)
+	defer stop()
+
+	var pdf []byte
+	err = chromedp.Run(tabCtx,
+		chromedp.Navigate("about:blank"),
+		chromedp.ActionFunc(func(ctx context.Context) error {
+			tree, err := page.GetFrameTree().Do(ctx)
+			if err != nil {
+				return err
+			}
+			return page.SetDocumentContent(tree.Frame.ID, document).Do(ctx)
+		}),
+		chromedp.Evaluate(waitForImagesScript, nil, func(p *runtime.EvaluateParams) *runtime.EvaluateParams {
+			return p.WithAwaitPromise(true)
+		}),
+		chromedp.ActionFunc(func(ctx context.Context) error {
+			var err error
+			pdf, _, err = page.PrintToPDF().
+				WithPaperWidth(8.27).
+				WithPaperHeight(11.69).
+				WithMarginTop(0.5).
+				WithMarginBottom(0.6).
+				WithMarginLeft(0.5).
+				WithMarginRight(0.5).
+				WithPrintBackground(true).
+				WithDisplayHeaderFooter(true).
+				WithHeaderTemplate("<span></span>").
+				WithFooterTemplate(fmt.Sprintf(pdfFooterTemplate, html.EscapeString(footer))).
+				Do(ctx)
+			return err
+		}),
+	)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("failed to print PDF: %w", err)
+	}
+	return pdf, nil
+}
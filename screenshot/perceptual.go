@@ -0,0 +1,169 @@
+package screenshot
+
+import (
+	"image"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+// Structural similarity settings, the usual constants for 8-bit images
+const (
+	ssimWindow = 8
+	ssimC1     = (0.01 * 255) * (0.01 * 255)
+	ssimC2     = (0.03 * 255) * (0.03 * 255)
+)
+
+// Perceptual hash settings: the image is shrunk to phashSize pixels square and the
+// lowest phashBits frequencies in each direction make up the hash
+const (
+	phashSize = 32
+	phashBits = 8
+)
+
+// grayImage holds the luma of an image
+type grayImage struct {
+	pix           []float64
+	width, height int
+}
+
+// toGray converts an image to luma
+func toGray(img image.Image) grayImage {
+	bounds := img.Bounds()
+	g := grayImage{width: bounds.Dx(), height: bounds.Dy(), pix: make([]float64, bounds.Dx()*bounds.Dy())}
+	for y := 0; y < g.height; y++ {
+		for x := 0; x < g.width; x++ {
+			r, gr, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			g.pix[y*g.width+x] = brightness([4]uint8{uint8(r >> 8), uint8(gr >> 8), uint8(b >> 8)})
+		}
+	}
+	return g
+}
+
+// structuralSimilarity returns the mean structural similarity (SSIM) of two images over
+// windows of 8x8 pixels, between 0 and 1. Unlike the share of identical pixels, it stays
+// high when colors shift slightly and drops when shapes, edges or text change. Only the
+// overlapping area is compared, and the result is scaled by its share of the larger image.
+func structuralSimilarity(a, b grayImage) float64 {
+	width, height := min(a.width, b.width), min(a.height, b.height)
+	area := max(a.width, b.width) * max(a.height, b.height)
+	if area == 0 {
+		return 1
+	}
+	if width == 0 || height == 0 {
+		return 0
+	}
+
+	// Images smaller than a window are compared as a single window
+	windowWidth, windowHeight := min(ssimWindow, width), min(ssimWindow, height)
+
+	var total float64
+	windows := 0
+	for wy := 0; wy+windowHeight <= height; wy += windowHeight {
+		for wx := 0; wx+windowWidth <= width; wx += windowWidth {
+			total += windowSSIM(a, b, wx, wy, windowWidth, windowHeight)
+			windows++
+		}
+	}
+
+	return max(0, total/float64(windows)) * float64(width*height) / float64(area)
+}
+
+// windowSSIM returns the structural similarity of a window of two images
+func windowSSIM(a, b grayImage, x0, y0, width, height int) float64 {
+	n := float64(width * height)
+
+	var sumA, sumB float64
+	for y := y0; y < y0+height; y++ {
+		for x := x0; x < x0+width; x++ {
+			sumA += a.pix[y*a.width+x]
+			sumB += b.pix[y*b.width+x]
+		}
+	}
+	meanA, meanB := sumA/n, sumB/n
+
+	var varA, varB, covariance float64
+	for y := y0; y < y0+height; y++ {
+		for x := x0; x < x0+width; x++ {
+			da, db := a.pix[y*a.width+x]-meanA, b.pix[y*b.width+x]-meanB
+			varA += da * da
+			varB += db * db
+			covariance += da * db
+		}
+	}
+	varA, varB, covariance = varA/n, varB/n, covariance/n
+
+	return ((2*meanA*meanB + ssimC1) * (2*covariance + ssimC2)) /
+		((meanA*meanA + meanB*meanB + ssimC1) * (varA + varB + ssimC2))
+}
+
+// perceptualHash returns a 64-bit perceptual hash (pHash) of an image: the signs of the
+// lowest frequencies of its discrete cosine transform relative to their median. Images
+// that look alike have hashes that differ in few bits, whatever their exact pixels.
+func perceptualHash(g grayImage) uint64 {
+	if g.width == 0 || g.height == 0 {
+		return 0
+	}
+
+	// Shrink the image by averaging the pixels of each cell
+	var small [phashSize][phashSize]float64
+	for cy := 0; cy < phashSize; cy++ {
+		y0, y1 := phashCell(cy, g.height)
+		for cx := 0; cx < phashSize; cx++ {
+			x0, x1 := phashCell(cx, g.width)
+			var sum float64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					sum += g.pix[y*g.width+x]
+				}
+			}
+			small[cy][cx] = sum / float64((y1-y0)*(x1-x0))
+		}
+	}
+
+	// Discrete cosine transform of the lowest frequencies
+	var cosines [phashBits][phashSize]float64
+	for u := 0; u < phashBits; u++ {
+		for x := 0; x < phashSize; x++ {
+			cosines[u][x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / (2 * phashSize))
+		}
+	}
+	coefficients := make([]float64, 0, phashBits*phashBits)
+	for v := 0; v < phashBits; v++ {
+		for u := 0; u < phashBits; u++ {
+			var sum float64
+			for y := 0; y < phashSize; y++ {
+				for x := 0; x < phashSize; x++ {
+					sum += small[y][x] * cosines[u][x] * cosines[v][y]
+				}
+			}
+			coefficients = append(coefficients, sum)
+		}
+	}
+
+	// The first coefficient is the average brightness and is left out of the median
+	sorted := append([]float64(nil), coefficients[1:]...)
+	sort.Float64s(sorted)
+	median := sorted[len(sorted)/2]
+
+	var hash uint64
+	for i, c := range coefficients {
+		if c > median {
+			hash |= 1 << i
+		}
+	}
+	return hash
+}
+
+// phashCell returns the range of pixels of cell i when size pixels are shrunk to phashSize,
+// at least one pixel wide
+func phashCell(i, size int) (int, int) {
+	start := i * size / phashSize
+	end := max((i+1)*size/phashSize, start+1)
+	return min(start, size-1), min(end, size)
+}
+
+// hashDistance returns the number of bits in which two perceptual hashes differ
+func hashDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
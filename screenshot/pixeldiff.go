@@ -0,0 +1,165 @@
+package screenshot
+
+import (
+	"image"
+
+	"screenshot-tool/config"
+)
+
+// toleratedSimilarity returns the fraction of pixels two images have in common, and how many
+// differing pixels were ignored as anti-aliasing. Pixels whose color channels differ by at
+// most the pixel tolerance count as identical. Pixels outside the overlapping area count as
+// different. A nil tolerance compares pixels exactly.
+func toleratedSimilarity(a, b image.Image, tolerance *config.DiffTolerance) (float64, int) {
+	boundsA, boundsB := a.Bounds(), b.Bounds()
+
+	width := max(boundsA.Dx(), boundsB.Dx())
+	height := max(boundsA.Dy(), boundsB.Dy())
+	if width == 0 || height == 0 {
+		return 1, 0
+	}
+
+	var pixelTolerance uint8
+	var ignoreAntialiasing bool
+	if tolerance != nil {
+		pixelTolerance = uint8(tolerance.PixelTolerance)
+		ignoreAntialiasing = tolerance.IgnoreAntialiasing
+	}
+
+	pa := pixelReader{img: a, width: min(boundsA.Dx(), boundsB.Dx()), height: min(boundsA.Dy(), boundsB.Dy())}
+	pb := pixelReader{img: b, width: pa.width, height: pa.height}
+
+	matching, antialiased := 0, 0
+	for y := 0; y < pa.height; y++ {
+		for x := 0; x < pa.width; x++ {
+			switch pa.compare(x, y, pb, pixelTolerance, ignoreAntialiasing) {
+			case pixelSame:
+				matching++
+			case pixelAntialiased:
+				matching++
+				antialiased++
+			}
+		}
+	}
+
+	return float64(matching) / float64(width*height), antialiased
+}
+
+// How a pixel compares between two images
+const (
+	pixelSame        = iota // Identical within the pixel tolerance
+	pixelAntialiased        // Differs by anti-aliasing, which is ignored
+	pixelChanged            // Differs
+)
+
+// compare returns how a pixel of the overlapping area compares with the other image
+func (p pixelReader) compare(x, y int, other pixelReader, pixelTolerance uint8, ignoreAntialiasing bool) int {
+	if channelDistance(p.at(x, y), other.at(x, y)) <= pixelTolerance {
+		return pixelSame
+	}
+	if ignoreAntialiasing && (p.antialiased(x, y, other) || other.antialiased(x, y, p)) {
+		return pixelAntialiased
+	}
+	return pixelChanged
+}
+
+// pixelReader reads the 8-bit colors of the overlapping area of an image
+type pixelReader struct {
+	img           image.Image
+	width, height int
+}
+
+// at returns the color of a pixel relative to the top left corner of the image
+func (p pixelReader) at(x, y int) [4]uint8 {
+	bounds := p.img.Bounds()
+	r, g, b, a := p.img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+	return [4]uint8{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), uint8(a >> 8)}
+}
+
+// antialiased reports whether a pixel looks like part of an anti-aliased edge in this image
+// and the other one, following the approach of pixelmatch (Vysniauskas, 2009): the pixel
+// has at most two neighbors of the same brightness, both darker and brighter neighbors, and
+// its darkest or brightest neighbor lies in a flat area of the same color in both images.
+func (p pixelReader) antialiased(x, y int, other pixelReader) bool {
+	center := brightness(p.at(x, y))
+
+	equal := 0
+	if p.onEdge(x, y) {
+		equal = 1
+	}
+	var darkest, brightest float64
+	var darkestX, darkestY, brightestX, brightestY int
+	for ny := max(y-1, 0); ny <= min(y+1, p.height-1); ny++ {
+		for nx := max(x-1, 0); nx <= min(x+1, p.width-1); nx++ {
+			if nx == x && ny == y {
+				continue
+			}
+			delta := brightness(p.at(nx, ny)) - center
+			switch {
+			case delta == 0:
+				equal++
+				if equal > 2 {
+					return false
+				}
+			case delta < darkest:
+				darkest, darkestX, darkestY = delta, nx, ny
+			case delta > brightest:
+				brightest, brightestX, brightestY = delta, nx, ny
+			}
+		}
+	}
+
+	// An edge pixel has both darker and brighter neighbors
+	if darkest == 0 || brightest == 0 {
+		return false
+	}
+	return (p.flat(darkestX, darkestY) && other.flat(darkestX, darkestY)) ||
+		(p.flat(brightestX, brightestY) && other.flat(brightestX, brightestY))
+}
+
+// flat reports whether a pixel has more than two neighbors of exactly its color
+func (p pixelReader) flat(x, y int) bool {
+	color := p.at(x, y)
+
+	equal := 0
+	if p.onEdge(x, y) {
+		equal = 1
+	}
+	for ny := max(y-1, 0); ny <= min(y+1, p.height-1); ny++ {
+		for nx := max(x-1, 0); nx <= min(x+1, p.width-1); nx++ {
+			if nx == x && ny == y {
+				continue
+			}
+			if p.at(nx, ny) == color {
+				equal++
+				if equal > 2 {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// onEdge reports whether a pixel is on the border of the compared area
+func (p pixelReader) onEdge(x, y int) bool {
+	return x == 0 || y == 0 || x == p.width-1 || y == p.height-1
+}
+
+// channelDistance returns the largest difference between the channels of two colors
+func channelDistance(a, b [4]uint8) uint8 {
+	var distance uint8
+	for i := range a {
+		d := a[i] - b[i]
+		if b[i] > a[i] {
+			d = b[i] - a[i]
+		}
+		distance = max(distance, d)
+	}
+	return distance
+}
+
+// brightness returns the luma of a color
+func brightness(c [4]uint8) float64 {
+	return 0.29889531*float64(c[0]) + 0.58662247*float64(c[1]) + 0.11448223*float64(c[2])
+}
@@ -0,0 +1,92 @@
+package screenshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"screenshot-tool/config"
+)
+
+// Substitution records a text replaced by a placeholder
+type Substitution struct {
+	Selector    string `json:"selector"`
+	Original    string `json:"original"`
+	Replacement string `json:"replacement"`
+}
+
+// substitutePlaceholdersScript replaces the text of matching elements and keeps
+// replacing it when the page updates it, e.g. for "2 minutes ago" timestamps.
+// Without a match pattern the element's whole text is replaced, otherwise only
+// the matching parts of its text nodes so the markup is preserved. Each
+// distinct substitution is recorded once on the window for the manifest.
+const substitutePlaceholdersScript = `((rules) => {
+	const applied = window.__screenshot_substitutions = window.__screenshot_substitutions || [];
+	const seen = new Set(applied.map((s) => s.selector + '\u0000' + s.original));
+	const record = (selector, original, replacement) => {
+		const key = selector + '\u0000' + original;
+		if (!seen.has(key)) {
+			seen.add(key);
+			applied.push({selector, original, replacement});
+		}
+	};
+
+	const apply = () => {
+		for (const rule of rules) {
+			let elements;
+			try {
+				elements = document.querySelectorAll(rule.selector);
+			} catch (e) {
+				continue;
+			}
+
+			for (const el of elements) {
+				if (!rule.match) {
+					if (el.textContent !== rule.text) {
+						record(rule.selector, el.textContent.trim(), rule.text);
+						el.textContent = rule.text;
+					}
+					continue;
+				}
+
+				const walker = document.createTreeWalker(el, NodeFilter.SHOW_TEXT);
+				for (let node = walker.nextNode(); node; node = walker.nextNode()) {
+					const replaced = node.nodeValue.replace(new RegExp(rule.match, 'g'), rule.text);
+					if (replaced !== node.nodeValue) {
+						record(rule.selector, node.nodeValue.trim(), replaced.trim());
+						node.nodeValue = replaced;
+					}
+				}
+			}
+		}
+	};
+
+	apply();
+	if (!window.__screenshot_substitution_observer) {
+		window.__screenshot_substitution_observer = new MutationObserver(apply);
+		window.__screenshot_substitution_observer.observe(document.documentElement,
+			{childList: true, subtree: true, characterData: true});
+	}
+	return applied.length;
+})(%s)`
+
+// substitutePlaceholders replaces dynamic text on the page with the URL's placeholders
+func substitutePlaceholders(engine BrowserEngine, urlConfig config.URLConfig) error {
+	rules, err := json.Marshal(urlConfig.Placeholders)
+	if err != nil {
+		return err
+	}
+
+	var count int
+	if err := evaluateExpression(engine, fmt.Sprintf(substitutePlaceholdersScript, rules), &count); err != nil {
+		return fmt.Errorf("failed to substitute placeholders: %w", err)
+	}
+
+	log.Printf("Applied %d placeholder rules on %s, %d substitutions made", len(urlConfig.Placeholders), urlConfig.Name, count)
+	return nil
+}
+
+// readSubstitutions returns the substitutions made on the current page
+func readSubstitutions(engine BrowserEngine, substitutions *[]Substitution) error {
+	return engine.Evaluate(`return window.__screenshot_substitutions || []`, substitutions)
+}
@@ -0,0 +1,147 @@
+package screenshot
+
+import (
+	"fmt"
+
+	"screenshot-tool/config"
+)
+
+// planTimestamp stands in for the capture time in planned directory and file names
+const planTimestamp = "YYYYMMDD-HHMMSS"
+
+// PlannedURL describes what a run would capture for a URL
+type PlannedURL struct {
+	Index        int
+	Name         string
+	URL          string
+	Dir          string // URL directory, relative to the output directory
+	ChromeMode   string
+	Browser      string // "firefox", or empty for Chrome
+	Cookies      int
+	LocalStorage int
+	Login        string
+	Proxy        string
+	Actions      int
+	Extensions   []string
+	ChromeFlags  []string // Global flags followed by those of the URL
+	Files        []string // Files in the URL directory
+	Viewports    []PlannedViewport
+}
+
+// PlannedViewport describes the files a run would create for a viewport of a URL
+type PlannedViewport struct {
+	Width  int
+	Height int
+	Dir    string   // Viewport directory, relative to the URL directory
+	Files  []string // Files in the viewport directory, N stands for a sequence number
+}
+
+// Plan lists the URLs, viewports and files a run would capture, without launching Chrome.
+// The capture time in names is shown as YYYYMMDD-HHMMSS. Files only written when a
+// capture fails or is truncated are not listed.
+func (s *Screenshoter) Plan() []PlannedURL {
+	var plan []PlannedURL
+
+	for _, group := range s.groupByChromeMode() {
+		for _, u := range group {
+			urlConfig := u.URLConfig
+			name := SanitizeFilename(urlConfig.Name)
+
+			planned := PlannedURL{
+				Index:        u.index,
+				Name:         urlConfig.Name,
+				URL:          urlConfig.URL,
+				Dir:          s.urlDirName(u.index, urlConfig.Name, planTimestamp),
+				ChromeMode:   s.chromeMode(urlConfig),
+				Browser:      urlConfig.Browser,
+				Cookies:      len(urlConfig.Cookies),
+				LocalStorage: len(urlConfig.LocalStorage),
+				Login:        urlConfig.LoginID,
+				Actions:      len(urlConfig.Actions),
+				Extensions:   urlConfig.Extensions,
+				ChromeFlags:  append(append([]string(nil), s.Config.ChromeFlags...), urlConfig.ChromeFlags...),
+				Files: []string{
+					"manifest.json",
+					name + "-metrics.csv",
+				},
+			}
+			if urlConfig.Proxy != nil {
+				planned.Proxy = urlConfig.Proxy.URL
+			}
+
+			for _, viewport := range urlConfig.Viewports {
+				planned.Viewports = append(planned.Viewports, PlannedViewport{
+					Width:  viewport.Width,
+					Height: viewport.Height,
+					Dir:    fmt.Sprintf("%dx%d", viewport.Width, viewport.Height),
+					Files:  s.planViewportFiles(urlConfig, viewport.Width, viewport.Height),
+				})
+			}
+
+			plan = append(plan, planned)
+		}
+	}
+
+	return plan
+}
+
+// planViewportFiles lists the files captured for a URL at a viewport, in capture order
+func (s *Screenshoter) planViewportFiles(urlConfig config.URLConfig, width, height int) []string {
+	name := SanitizeFilename(urlConfig.Name)
+	ext := s.Config.FileFormat
+	size := fmt.Sprintf("%dx%d", width, height)
+
+	// Firefox captures only the screenshots and cookie logs
+	if urlConfig.Browser == "firefox" {
+		return []string{
+			fmt.Sprintf("%s-full-%s.%s", planTimestamp, size, ext),
+			fmt.Sprintf("%s-viewport-%s-N.%s", planTimestamp, size, ext),
+			name + "-cookies.csv",
+			name + "-cookies.log",
+		}
+	}
+
+	var files []string
+	if len(s.Config.ViewProof) > 0 {
+		files = append(files, fmt.Sprintf("%s-full-proof-%s.%s", planTimestamp, size, ext))
+	}
+	if urlConfig.Samples > 1 {
+		for i := 1; i <= urlConfig.Samples; i++ {
+			files = append(files, fmt.Sprintf("%s-full-%s-sample-%d.%s", planTimestamp, size, i, ext))
+		}
+	} else {
+		files = append(files, fmt.Sprintf("%s-full-%s.%s", planTimestamp, size, ext))
+	}
+	if urlConfig.Trace {
+		files = append(files, "trace.json")
+	}
+	if audit := urlConfig.Accessibility; audit != nil && audit.Enabled {
+		files = append(files, name+"-accessibility.json")
+	}
+	if interactiveMap := urlConfig.InteractiveMap; interactiveMap != nil && interactiveMap.Enabled {
+		files = append(files, fmt.Sprintf("%s-interactive-%s.%s", name, size, ext), name+"-interactive.json")
+	}
+	files = append(files, fmt.Sprintf("%s-viewport-%s-N.%s", planTimestamp, size, ext))
+
+	for _, action := range urlConfig.Actions {
+		if action.TabThrough != nil {
+			files = append(files, fmt.Sprintf("%s-focus-%s-NN.%s (up to %d)", planTimestamp, size, ext, action.TabThrough.MaxStops))
+		}
+		if action.CapturePrintable != nil {
+			files = append(files, fmt.Sprintf("%s-printable-%s.%s", planTimestamp, size, ext))
+		}
+	}
+
+	if video := urlConfig.Video; video != nil && video.Enabled {
+		files = append(files, fmt.Sprintf("%s-session-%s.%s", name, size, video.Format))
+	}
+	if recording := urlConfig.ScrollRecording; recording != nil && recording.Enabled {
+		files = append(files, fmt.Sprintf("%s-scroll-%s.%s", name, size, recording.Format))
+	}
+
+	files = append(files, name+"-cookies.csv", name+"-cookies.log", urlConfig.Name+"-console.log")
+	if urlConfig.HAR {
+		files = append(files, urlConfig.Name+".har")
+	}
+	return files
+}
@@ -0,0 +1,231 @@
+package screenshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Size assumptions used until the output directory has a history of real captures
+const (
+	defaultFullBytes     = 2 * 1024 * 1024
+	defaultViewportBytes = 400 * 1024
+	defaultSections      = 4
+	defaultJPEGRatio     = 0.3 // Typical JPEG size relative to PNG for web pages
+)
+
+// artifactAverage accumulates the sizes of one kind of artifact
+type artifactAverage struct {
+	Count      int64 `json:"count"`
+	TotalBytes int64 `json:"totalBytes"`
+}
+
+// average returns the mean size, or false if nothing has been recorded
+func (a *artifactAverage) average() (float64, bool) {
+	if a == nil || a.Count == 0 {
+		return 0, false
+	}
+	return float64(a.TotalBytes) / float64(a.Count), true
+}
+
+// artifactStats is the size history of captures written to an output directory
+type artifactStats struct {
+	Types            map[string]*artifactAverage `json:"types"` // Keyed by format and type, e.g. "png/full"
+	ViewportCaptures int64                       `json:"viewportCaptures"`
+	Sections         int64                       `json:"sections"` // Viewport sections across all viewport captures
+
+	mu sync.Mutex
+}
+
+// statsPath returns the location of the size history for an output directory
+func statsPath(outputDir string) string {
+	return filepath.Join(outputDir, ".stats.json")
+}
+
+// loadArtifactStats reads the size history, returning empty stats if there is none
+func loadArtifactStats(outputDir string) *artifactStats {
+	stats := &artifactStats{Types: make(map[string]*artifactAverage)}
+
+	data, err := os.ReadFile(statsPath(outputDir))
+	if err != nil {
+		return stats
+	}
+	if err := json.Unmarshal(data, stats); err != nil {
+		log.Printf("Warning: Ignoring unreadable capture size history: %v", err)
+		return &artifactStats{Types: make(map[string]*artifactAverage)}
+	}
+	if stats.Types == nil {
+		stats.Types = make(map[string]*artifactAverage)
+	}
+	return stats
+}
+
+// typeAverage returns the expected size of an artifact type in a format
+func (st *artifactStats) typeAverage(format, artifactType string, fallback float64) float64 {
+	if avg, ok := st.Types[format+"/"+artifactType].average(); ok {
+		return avg
+	}
+
+	// Derive JPEG sizes from PNG history when there is no JPEG history yet
+	if format == "jpeg" {
+		if avg, ok := st.Types["png/"+artifactType].average(); ok {
+			return avg * defaultJPEGRatio
+		}
+		return fallback * defaultJPEGRatio
+	}
+	return fallback
+}
+
+// sectionsPerViewport returns the expected number of viewport sections per capture
+func (st *artifactStats) sectionsPerViewport() float64 {
+	if st.ViewportCaptures == 0 {
+		return defaultSections
+	}
+	return float64(st.Sections) / float64(st.ViewportCaptures)
+}
+
+// recordDir adds the artifacts found in a URL directory to the stats
+func (st *artifactStats) recordDir(urlDir string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	sectionsByDir := make(map[string]int64)
+
+	filepath.Walk(urlDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+
+		name := info.Name()
+		format := strings.TrimPrefix(filepath.Ext(name), ".")
+		if format != "png" && format != "jpeg" {
+			return nil
+		}
+
+		var artifactType string
+		switch {
+		case strings.Contains(name, "-full-proof-"):
+			artifactType = "full-proof"
+		case strings.Contains(name, "-full-"):
+			artifactType = "full"
+		case strings.Contains(name, "-viewport-"):
+			artifactType = "viewport"
+			sectionsByDir[filepath.Dir(path)]++
+		default:
+			return nil
+		}
+
+		key := format + "/" + artifactType
+		if st.Types[key] == nil {
+			st.Types[key] = &artifactAverage{}
+		}
+		st.Types[key].Count++
+		st.Types[key].TotalBytes += info.Size()
+		return nil
+	})
+
+	for _, sections := range sectionsByDir {
+		st.ViewportCaptures++
+		st.Sections += sections
+	}
+}
+
+// save writes the stats back to the output directory
+func (st *artifactStats) save(outputDir string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(statsPath(outputDir), data, 0644)
+}
+
+// estimateRunSize estimates the bytes a run will write in the given format
+func (s *Screenshoter) estimateRunSize(stats *artifactStats, format string) uint64 {
+	fullBytes := stats.typeAverage(format, "full", defaultFullBytes)
+	proofBytes := stats.typeAverage(format, "full-proof", defaultFullBytes)
+	viewportBytes := stats.typeAverage(format, "viewport", defaultViewportBytes)
+	sections := stats.sectionsPerViewport()
+
+	total := 0.0
+	for _, urlConfig := range s.Config.URLs {
+		perViewport := fullBytes*float64(max(urlConfig.Samples, 1)) + viewportBytes*sections
+		if len(s.Config.ViewProof) > 0 {
+			perViewport += proofBytes
+		}
+		total += perViewport * float64(len(urlConfig.Viewports))
+	}
+
+	return uint64(total)
+}
+
+// Preflight checks that the output volume has room for the planned captures
+// and applies the configured policy if it doesn't. With the degrade policy the
+// run switches from PNG to JPEG when that makes the captures fit.
+func (s *Screenshoter) Preflight() error {
+	stats := s.stats
+	policy := s.Config.DiskSpace
+
+	// The output directory must exist to query its volume
+	if err := os.MkdirAll(s.Config.OutputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	required := s.estimateRunSize(stats, s.Config.FileFormat)
+	reserve := uint64(policy.Reserve) * 1024 * 1024
+
+	free, err := freeDiskSpace(s.Config.OutputDir)
+	if err != nil {
+		log.Printf("Warning: Could not determine free disk space for %s: %v", s.Config.OutputDir, err)
+		return nil
+	}
+
+	log.Printf("Estimated run size: %s, free space: %s, reserve: %s",
+		formatBytes(required), formatBytes(free), formatBytes(reserve))
+
+	if required+reserve <= free {
+		return nil
+	}
+
+	problem := fmt.Sprintf("estimated run size %s plus reserve %s exceeds free space %s on %s",
+		formatBytes(required), formatBytes(reserve), formatBytes(free), s.Config.OutputDir)
+
+	switch policy.Policy {
+	case "warn":
+		log.Printf("Warning: %s, continuing anyway", problem)
+		return nil
+
+	case "degrade":
+		if s.Config.FileFormat == "png" {
+			jpegRequired := s.estimateRunSize(stats, "jpeg")
+			if jpegRequired+reserve <= free {
+				log.Printf("Warning: %s, switching to JPEG (estimated %s)", problem, formatBytes(jpegRequired))
+				s.Config.FileFormat = "jpeg"
+				return nil
+			}
+		}
+		return fmt.Errorf("insufficient disk space even after degrading to JPEG: %s", problem)
+	}
+
+	return fmt.Errorf("insufficient disk space: %s", problem)
+}
+
+// formatBytes formats a byte count for logs
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
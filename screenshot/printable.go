@@ -0,0 +1,90 @@
+package screenshot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"screenshot-tool/config"
+
+	"github.com/chromedp/cdproto/emulation"
+	"github.com/chromedp/chromedp"
+)
+
+// printableHideScript removes the given selectors from the layout while the print view is captured.
+// Unlike hideSelectors the elements don't keep their space, so the capture has no gaps where navigation was.
+const printableHideScript = `((hide) => {
+	let style = document.getElementById('__screenshot_printable_style');
+	if (!style) {
+		style = document.createElement('style');
+		style.id = '__screenshot_printable_style';
+		(document.head || document.documentElement).appendChild(style);
+	}
+
+	const rules = [];
+	for (const selector of hide) {
+		try {
+			document.querySelectorAll(selector);
+			rules.push(selector + ' { display: none !important; }');
+		} catch (e) {}
+	}
+
+	style.textContent = rules.join('\n');
+	return rules.length;
+})(%s)`
+
+// printableRestoreScript removes the stylesheet added by printableHideScript
+const printableRestoreScript = `(() => {
+	const style = document.getElementById('__screenshot_printable_style');
+	if (style) {
+		style.remove();
+	}
+	return true;
+})()`
+
+// capturePrintable captures the viewport with print media emulated and the given chrome hidden,
+// then restores the page so the following captures are unaffected
+func (s *Screenshoter) capturePrintable(urlConfig config.URLConfig, printable *config.PrintableCapture, capture *actionCapture) chromedp.ActionFunc {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		hide, err := json.Marshal(append([]string{}, printable.HideSelectors...))
+		if err != nil {
+			return err
+		}
+
+		if err := emulation.SetEmulatedMedia().WithMedia("print").Do(ctx); err != nil {
+			return fmt.Errorf("failed to emulate print media: %w", err)
+		}
+		if err := chromedp.Evaluate(fmt.Sprintf(printableHideScript, hide), nil).Do(ctx); err != nil {
+			return fmt.Errorf("failed to hide elements for printable capture: %w", err)
+		}
+		if err := chromedp.Evaluate(`window.scrollTo(0, 0)`, nil).Do(ctx); err != nil {
+			return err
+		}
+		if err := chromedp.Sleep(500 * time.Millisecond).Do(ctx); err != nil {
+			return err
+		}
+
+		var buf []byte
+		if err := s.captureScreenshot(&buf).Do(ctx); err != nil {
+			return fmt.Errorf("failed to capture printable view: %w", err)
+		}
+
+		viewport := capture.viewport
+		filename := fmt.Sprintf("%s-printable-%dx%d.%s", capture.timestamp, viewport.Width, viewport.Height, s.Config.FileFormat)
+		if err := os.WriteFile(filepath.Join(capture.viewportDir, filename), buf, 0644); err != nil {
+			return err
+		}
+		capture.vm.Printable = filename
+		log.Printf("Captured printable view for %s at viewport %dx%d: %s", urlConfig.Name, viewport.Width, viewport.Height, filename)
+
+		// Switch back to screen media for the viewport sections
+		if err := chromedp.Evaluate(printableRestoreScript, nil).Do(ctx); err != nil {
+			return err
+		}
+		return emulation.SetEmulatedMedia().WithMedia("").Do(ctx)
+	})
+}
@@ -0,0 +1,63 @@
+package screenshot
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"screenshot-tool/config"
+
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+)
+
+// ProgressEvent is a step of a URL capture, reported to OnProgress as it happens
+type ProgressEvent struct {
+	Type        string    `json:"type"` // "started", "navigated", "captured" or "failed"
+	Time        time.Time `json:"time"`
+	Name        string    `json:"name"`
+	URL         string    `json:"url"`
+	Label       string    `json:"label,omitempty"`
+	Viewport    string    `json:"viewport,omitempty"`    // Viewport of a "navigated" event, e.g. 1280x800
+	NavigatedTo string    `json:"navigatedTo,omitempty"` // URL the page landed on after redirects, for "navigated"
+	Dir         string    `json:"dir,omitempty"`         // URL directory
+	Error       string    `json:"error,omitempty"`       // Why the capture failed, for "failed"
+}
+
+// progress reports a capture event to OnProgress, if set
+func (s *Screenshoter) progress(event ProgressEvent) {
+	if s.OnProgress == nil {
+		return
+	}
+	event.Time = time.Now()
+	event.Label = s.Config.Label
+	s.OnProgress(event)
+}
+
+// navigatedEvent returns the "navigated" event of a viewport, reported once per viewport
+func (s *Screenshoter) navigatedEvent(urlConfig config.URLConfig, viewport config.Viewport, urlDir string) func(landedOn string) {
+	var once sync.Once
+	return func(landedOn string) {
+		once.Do(func() {
+			s.progress(ProgressEvent{
+				Type:        "navigated",
+				Name:        urlConfig.Name,
+				URL:         urlConfig.URL,
+				Viewport:    fmt.Sprintf("%dx%d", viewport.Width, viewport.Height),
+				NavigatedTo: landedOn,
+				Dir:         urlDir,
+			})
+		})
+	}
+}
+
+// reportNavigation calls navigated with the URL of the first page the browser context's
+// main frame loads
+func reportNavigation(browserCtx context.Context, navigated func(string)) {
+	chromedp.ListenTarget(browserCtx, func(ev any) {
+		if e, ok := ev.(*page.EventFrameNavigated); ok && e.Frame.ParentID == "" && e.Frame.URL != "about:blank" {
+			navigated(e.Frame.URL)
+		}
+	})
+}
@@ -0,0 +1,242 @@
+package screenshot
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"screenshot-tool/config"
+)
+
+// proxyForwarder is a local, unauthenticated HTTP proxy that forwards Chrome's
+// traffic to an upstream proxy and performs the authentication handshake on its
+// behalf. Headless Chrome cannot prompt for proxy credentials and has no way to
+// take NTLM credentials on the command line, so it talks to this helper instead.
+type proxyForwarder struct {
+	listener net.Listener
+	upstream string
+	proxy    config.Proxy
+	wg       sync.WaitGroup
+}
+
+// startProxyForwarder starts a forwarder on a random local port
+func startProxyForwarder(proxy config.Proxy) (*proxyForwarder, error) {
+	upstream, err := url.Parse(proxy.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy url %s: %w", proxy.URL, err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to start proxy helper: %w", err)
+	}
+
+	f := &proxyForwarder{
+		listener: listener,
+		upstream: upstream.Host,
+		proxy:    proxy,
+	}
+
+	f.wg.Add(1)
+	go f.serve()
+
+	log.Printf("Started proxy helper on %s forwarding to %s (auth: %s)", f.Addr(), upstream.Host, proxy.Auth)
+	return f, nil
+}
+
+// Addr returns the address Chrome should use as its proxy server
+func (f *proxyForwarder) Addr() string {
+	return f.listener.Addr().String()
+}
+
+// Close stops accepting new connections
+func (f *proxyForwarder) Close() error {
+	err := f.listener.Close()
+	f.wg.Wait()
+	return err
+}
+
+// serve accepts connections until the listener is closed
+func (f *proxyForwarder) serve() {
+	defer f.wg.Done()
+
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+// handle relays requests from a single Chrome connection over a dedicated upstream connection.
+// NTLM authenticates connections rather than requests, so the pairing must be kept.
+func (f *proxyForwarder) handle(client net.Conn) {
+	defer client.Close()
+
+	clientReader := bufio.NewReader(client)
+
+	upstream, err := net.DialTimeout("tcp", f.upstream, 30*time.Second)
+	if err != nil {
+		log.Printf("ERROR: Proxy helper failed to connect to upstream proxy %s: %v", f.upstream, err)
+		writeProxyError(client, http.StatusBadGateway)
+		return
+	}
+	defer upstream.Close()
+
+	upstreamReader := bufio.NewReader(upstream)
+	authenticated := false
+
+	for {
+		req, err := http.ReadRequest(clientReader)
+		if err != nil {
+			return
+		}
+
+		resp, err := f.roundTrip(upstream, upstreamReader, req, &authenticated)
+		if err != nil {
+			log.Printf("ERROR: Proxy helper request to %s failed: %v", req.Host, err)
+			writeProxyError(client, http.StatusBadGateway)
+			return
+		}
+
+		if req.Method == http.MethodConnect {
+			if resp.StatusCode != http.StatusOK {
+				resp.Write(client)
+				return
+			}
+
+			// Tunnel established, splice the two connections together
+			if _, err := io.WriteString(client, "HTTP/1.1 200 Connection established\r\n\r\n"); err != nil {
+				return
+			}
+			go func() {
+				io.Copy(upstream, clientReader)
+				if tcp, ok := upstream.(*net.TCPConn); ok {
+					tcp.CloseWrite()
+				}
+			}()
+			io.Copy(client, upstreamReader)
+			return
+		}
+
+		if err := resp.Write(client); err != nil {
+			return
+		}
+		if resp.Close || req.Close {
+			return
+		}
+	}
+}
+
+// roundTrip sends a request to the upstream proxy, authenticating if required
+func (f *proxyForwarder) roundTrip(upstream net.Conn, upstreamReader *bufio.Reader, req *http.Request, authenticated *bool) (*http.Response, error) {
+	// Buffer the body so the request can be replayed during the handshake
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+
+	send := func(authorization string) (*http.Response, error) {
+		req.Header.Del("Proxy-Authorization")
+		if authorization != "" {
+			req.Header.Set("Proxy-Authorization", authorization)
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+
+		if err := req.WriteProxy(upstream); err != nil {
+			return nil, err
+		}
+		return http.ReadResponse(upstreamReader, req)
+	}
+
+	switch f.proxy.Auth {
+	case "basic":
+		credentials := base64.StdEncoding.EncodeToString([]byte(f.proxy.Username + ":" + f.proxy.Password))
+		return send("Basic " + credentials)
+
+	case "ntlm", "negotiate":
+		if *authenticated {
+			return send("")
+		}
+
+		scheme := "NTLM"
+		if f.proxy.Auth == "negotiate" {
+			scheme = "Negotiate"
+		}
+
+		resp, err := send(scheme + " " + base64.StdEncoding.EncodeToString(ntlmNegotiateMessage()))
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusProxyAuthRequired {
+			*authenticated = true
+			return resp, nil
+		}
+
+		// Drain the 407 body so the connection can be reused for the next leg
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		token := ""
+		for _, header := range resp.Header.Values("Proxy-Authenticate") {
+			if strings.HasPrefix(header, scheme+" ") {
+				token = strings.TrimSpace(strings.TrimPrefix(header, scheme+" "))
+				break
+			}
+		}
+		if token == "" {
+			return nil, fmt.Errorf("upstream proxy did not send an %s challenge", scheme)
+		}
+
+		challengeMsg, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s challenge: %w", scheme, err)
+		}
+		challenge, err := parseNTLMChallenge(challengeMsg)
+		if err != nil {
+			return nil, err
+		}
+		authenticateMsg, err := ntlmAuthenticateMessage(challenge, f.proxy.Domain, f.proxy.Username, f.proxy.Password)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err = send(scheme + " " + base64.StdEncoding.EncodeToString(authenticateMsg))
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusProxyAuthRequired {
+			log.Printf("ERROR: Upstream proxy rejected %s credentials for %s", scheme, f.proxy.Username)
+		} else {
+			*authenticated = true
+		}
+		return resp, nil
+
+	default:
+		return send("")
+	}
+}
+
+// writeProxyError writes a minimal error response to Chrome
+func writeProxyError(conn net.Conn, status int) {
+	fmt.Fprintf(conn, "HTTP/1.1 %d %s\r\nContent-Length: 0\r\nConnection: close\r\n\r\n", status, http.StatusText(status))
+}
+
+// proxyBypassList formats bypass hosts for Chrome's --proxy-bypass-list flag
+func proxyBypassList(proxy config.Proxy) string {
+	return strings.Join(proxy.Bypass, ";")
+}
@@ -0,0 +1,199 @@
+package screenshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"screenshot-tool/config"
+)
+
+// Quarantine reasons
+const (
+	quarantineFlaky = "flaky" // Marked flaky in the config
+	quarantineAuto  = "auto"  // Mismatched its baseline too many times in a row
+)
+
+// quarantineEntry tracks the recent results of a URL and whether it is quarantined
+type quarantineEntry struct {
+	Reason                string    `json:"reason,omitempty"` // Empty if the URL is not quarantined
+	Since                 time.Time `json:"since,omitempty"`
+	ConsecutiveMismatches int       `json:"consecutiveMismatches"`
+	ConsecutivePasses     int       `json:"consecutivePasses"`
+	LastResult            string    `json:"lastResult"` // "passed", "mismatch" or "failed"
+	LastError             string    `json:"lastError,omitempty"`
+}
+
+// quarantineState is the quarantine list of an output directory, persisted across runs
+type quarantineState struct {
+	URLs map[string]*quarantineEntry `json:"urls"` // Keyed by URL name
+
+	mu sync.Mutex
+}
+
+// quarantinePath returns the location of the quarantine list for an output directory
+func quarantinePath(outputDir string) string {
+	return filepath.Join(outputDir, ".quarantine.json")
+}
+
+// loadQuarantine reads the quarantine list, returning an empty list if there is none
+func loadQuarantine(outputDir string) *quarantineState {
+	state := &quarantineState{URLs: make(map[string]*quarantineEntry)}
+
+	data, err := os.ReadFile(quarantinePath(outputDir))
+	if err != nil {
+		return state
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		log.Printf("Warning: Ignoring unreadable quarantine list: %v", err)
+		return &quarantineState{URLs: make(map[string]*quarantineEntry)}
+	}
+	if state.URLs == nil {
+		state.URLs = make(map[string]*quarantineEntry)
+	}
+	return state
+}
+
+// record updates a URL's history with the result of a capture and reports
+// whether the URL is quarantined, in which case its failure doesn't fail the run
+func (q *quarantineState) record(urlConfig config.URLConfig, policy *config.Quarantine, captureErr error) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entry := q.URLs[urlConfig.Name]
+	if entry == nil {
+		entry = &quarantineEntry{}
+		q.URLs[urlConfig.Name] = entry
+	}
+
+	entry.LastError = ""
+	switch {
+	case captureErr == nil:
+		entry.LastResult = "passed"
+		entry.ConsecutivePasses++
+		entry.ConsecutiveMismatches = 0
+	case isMismatch(captureErr):
+		entry.LastResult = "mismatch"
+		entry.LastError = captureErr.Error()
+		entry.ConsecutiveMismatches++
+		entry.ConsecutivePasses = 0
+	default:
+		entry.LastResult = "failed"
+		entry.LastError = captureErr.Error()
+		entry.ConsecutivePasses = 0
+	}
+
+	now := time.Now()
+	switch {
+	case urlConfig.Flaky:
+		if entry.Reason != quarantineFlaky {
+			entry.Reason, entry.Since = quarantineFlaky, now
+		}
+	case entry.Reason == quarantineFlaky:
+		// No longer marked flaky in the config
+		log.Printf("Released %s from quarantine, it is no longer marked flaky", urlConfig.Name)
+		entry.Reason, entry.Since = "", time.Time{}
+	case entry.Reason == quarantineAuto && policy != nil && entry.ConsecutivePasses >= policy.ReleaseAfter:
+		log.Printf("Released %s from quarantine after %d consecutive passing runs", urlConfig.Name, entry.ConsecutivePasses)
+		entry.Reason, entry.Since = "", time.Time{}
+	case entry.Reason == "" && policy != nil && policy.AutoAfter > 0 && entry.ConsecutiveMismatches >= policy.AutoAfter:
+		log.Printf("Quarantined %s after %d consecutive baseline mismatches", urlConfig.Name, entry.ConsecutiveMismatches)
+		entry.Reason, entry.Since = quarantineAuto, now
+	}
+
+	quarantined := entry.Reason != ""
+
+	// Only keep URLs with a history worth tracking
+	if !quarantined && entry.ConsecutiveMismatches == 0 {
+		delete(q.URLs, urlConfig.Name)
+	}
+
+	return quarantined
+}
+
+// save writes the quarantine list to the output directory, removing it once it is empty
+func (q *quarantineState) save(outputDir string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.URLs) == 0 {
+		if err := os.Remove(quarantinePath(outputDir)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	data, err := json.MarshalIndent(q, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(quarantinePath(outputDir), data, 0644)
+}
+
+// report describes the quarantined URLs, how long they have been quarantined and how they did in this run
+func (q *quarantineState) report(now time.Time) string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var names []string
+	for name, entry := range q.URLs {
+		if entry.Reason != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+
+	// Longest quarantined first
+	sort.Slice(names, func(i, j int) bool {
+		a, b := q.URLs[names[i]], q.URLs[names[j]]
+		if !a.Since.Equal(b.Since) {
+			return a.Since.Before(b.Since)
+		}
+		return names[i] < names[j]
+	})
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Quarantined URLs (%d):\n", len(names))
+	for _, name := range names {
+		entry := q.URLs[name]
+		fmt.Fprintf(&b, "  %s: %s since %s (%s), last result %s",
+			name, entry.Reason, entry.Since.Format("2006-01-02"), formatAge(now.Sub(entry.Since)), entry.LastResult)
+		if entry.LastError != "" {
+			fmt.Fprintf(&b, ": %s", entry.LastError)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// formatAge formats a quarantine age in days, or hours for recent quarantines
+func formatAge(age time.Duration) string {
+	if age < 24*time.Hour {
+		return fmt.Sprintf("%dh", int(age.Hours()))
+	}
+	return fmt.Sprintf("%dd", int(age.Hours()/24))
+}
+
+// writeQuarantineReport logs the quarantine report and writes it to the output directory
+func (s *Screenshoter) writeQuarantineReport() {
+	path := filepath.Join(s.Config.OutputDir, "quarantine-report.txt")
+
+	report := s.quarantine.report(time.Now())
+	if report == "" {
+		os.Remove(path)
+		return
+	}
+
+	log.Printf("%s", strings.TrimSuffix(report, "\n"))
+	if err := os.WriteFile(path, []byte(report), 0644); err != nil {
+		log.Printf("Warning: Failed to write quarantine report: %v", err)
+	}
+}
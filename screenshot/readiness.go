@@ -0,0 +1,58 @@
+package screenshot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"screenshot-tool/config"
+)
+
+// visibleScript reports whether the element matching a selector is visible
+const visibleScript = `const el = document.querySelector(arguments[0]);
+return !!el && el.getClientRects().length > 0 && getComputedStyle(el).visibility !== 'hidden'`
+
+// waitForReady waits until the page is ready to be captured. If a selector is
+// configured it waits for that element to become visible, otherwise it falls
+// back to sleeping for the configured delay.
+func waitForReady(ctx context.Context, engine BrowserEngine, urlConfig config.URLConfig) error {
+	if urlConfig.WaitForSelector == "" {
+		return sleepContext(ctx, time.Duration(urlConfig.Delay)*time.Millisecond)
+	}
+
+	timeout := time.Duration(urlConfig.WaitTimeout) * time.Millisecond
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+
+	log.Printf("Waiting up to %v for selector %q to be visible on %s", timeout, urlConfig.WaitForSelector, urlConfig.Name)
+	start := time.Now()
+
+	if err := pollScript(ctx, engine, visibleScript, urlConfig.WaitForSelector, timeout); err != nil {
+		return fmt.Errorf("selector %q not visible after %v: %w", urlConfig.WaitForSelector, timeout, err)
+	}
+
+	log.Printf("Selector %q visible on %s after %v", urlConfig.WaitForSelector, urlConfig.Name, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// pollScript evaluates a script with a selector until it returns true or the timeout passes
+func pollScript(ctx context.Context, engine BrowserEngine, script, selector string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		var ok bool
+		if err := engine.Evaluate(script, &ok, selector); err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return context.DeadlineExceeded
+		}
+		if err := sleepContext(ctx, 100*time.Millisecond); err != nil {
+			return err
+		}
+	}
+}
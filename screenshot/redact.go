@@ -0,0 +1,24 @@
+package screenshot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path"
+)
+
+// cookieLogValue returns a cookie value as it is written to the console log and the cookie
+// files. With redactCookies, the value of a cookie the allowlist doesn't name is replaced by
+// its hash, so logs can be shared without leaking session tokens while runs still show
+// whether a value changed.
+func (s *Screenshoter) cookieLogValue(name, value string) string {
+	if !s.Config.RedactCookies || value == "" {
+		return value
+	}
+	for _, pattern := range s.Config.RedactCookiesAllow {
+		if ok, _ := path.Match(pattern, name); ok {
+			return value
+		}
+	}
+	sum := sha256.Sum256([]byte(value))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,106 @@
+package screenshot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"screenshot-tool/config"
+
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/chromedp"
+)
+
+// compiledRewrite is a rewrite rule with its URL pattern compiled
+type compiledRewrite struct {
+	match *regexp.Regexp
+	rule  config.RewriteRule
+}
+
+// enableRewrites intercepts all requests of the browser context and applies the
+// rewrite rules to them. The returned action must run before navigating.
+func enableRewrites(browserCtx context.Context, rules []config.RewriteRule) chromedp.Action {
+	compiled := make([]compiledRewrite, 0, len(rules))
+	for _, rule := range rules {
+		c := compiledRewrite{rule: rule}
+		if rule.Match != "" {
+			c.match = regexp.MustCompile(rule.Match)
+		}
+		compiled = append(compiled, c)
+	}
+
+	chromedp.ListenTarget(browserCtx, func(ev any) {
+		e, ok := ev.(*fetch.EventRequestPaused)
+		if !ok {
+			return
+		}
+
+		// Every paused request must be continued, and actions can't run inside the listener
+		go func() {
+			if err := chromedp.Run(browserCtx, rewriteRequest(e, compiled)); err != nil {
+				log.Printf("ERROR: Failed to continue intercepted request %s: %v", e.Request.URL, err)
+			}
+		}()
+	})
+
+	log.Printf("Enabled %d request rewrite rules", len(rules))
+	return fetch.Enable().WithPatterns([]*fetch.RequestPattern{{URLPattern: "*"}})
+}
+
+// rewriteRequest builds the action that continues a paused request with all matching rules applied
+func rewriteRequest(e *fetch.EventRequestPaused, rules []compiledRewrite) chromedp.Action {
+	continueReq := fetch.ContinueRequest(e.RequestID)
+
+	parsed, err := url.Parse(e.Request.URL)
+	if err != nil {
+		return continueReq
+	}
+
+	headers := make(map[string]string)
+	for name, value := range e.Request.Headers {
+		headers[name] = fmt.Sprint(value)
+	}
+
+	urlChanged, headersChanged := false, false
+	for _, r := range rules {
+		if r.match != nil && !r.match.MatchString(e.Request.URL) {
+			continue
+		}
+		if r.rule.FromHost != "" && !strings.EqualFold(parsed.Hostname(), r.rule.FromHost) {
+			continue
+		}
+
+		if r.rule.ToHost != "" {
+			// Keep the original port unless the replacement specifies one
+			if port := parsed.Port(); port != "" && !strings.Contains(r.rule.ToHost, ":") {
+				parsed.Host = r.rule.ToHost + ":" + port
+			} else {
+				parsed.Host = r.rule.ToHost
+			}
+			urlChanged = true
+		}
+
+		for name, value := range r.rule.Headers {
+			headers[name] = value
+			headersChanged = true
+		}
+	}
+
+	if urlChanged {
+		log.Printf("Rewriting request %s -> %s", e.Request.URL, parsed.String())
+		continueReq = continueReq.WithURL(parsed.String())
+	}
+
+	if headersChanged {
+		entries := make([]*fetch.HeaderEntry, 0, len(headers))
+		for name, value := range headers {
+			entries = append(entries, &fetch.HeaderEntry{Name: name, Value: value})
+		}
+		continueReq = continueReq.WithHeaders(entries)
+	}
+
+	return continueReq
+}
@@ -0,0 +1,103 @@
+package screenshot
+
+import (
+	"context"
+	"fmt"
+	"image"
+	_ "image/jpeg" // Register JPEG decoder for sample comparison
+	_ "image/png"  // Register PNG decoder for sample comparison
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"screenshot-tool/config"
+)
+
+// SampleSet records repeated captures of the same page and how consistent they were
+type SampleSet struct {
+	Count          int       `json:"count"`
+	IntervalMs     int       `json:"intervalMs"`
+	Files          []string  `json:"files"`
+	Similarity     []float64 `json:"similarity"`     // Similarity of each sample to the first one (0-1)
+	StabilityScore float64   `json:"stabilityScore"` // Average similarity across all samples (0-1)
+}
+
+// captureSamples captures the full page several times and scores how stable the renders are
+func (s *Screenshoter) captureSamples(ctx context.Context, engine BrowserEngine, urlConfig config.URLConfig, viewport config.Viewport, viewportDir string, vm *ViewportManifest) error {
+	interval := time.Duration(urlConfig.SampleInterval) * time.Millisecond
+	paths := make([]string, 0, urlConfig.Samples)
+
+	for i := 1; i <= urlConfig.Samples; i++ {
+		// Wait between samples so dynamic content has a chance to change
+		if i > 1 && interval > 0 {
+			log.Printf("Waiting %v before sample %d/%d for %s", interval, i, urlConfig.Samples, urlConfig.Name)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(interval):
+			}
+		}
+
+		path, err := s.captureFullPageScreenshot(ctx, engine, urlConfig, viewport, viewportDir, i)
+		if err != nil {
+			return fmt.Errorf("failed to capture sample %d/%d: %w", i, urlConfig.Samples, err)
+		}
+		paths = append(paths, path)
+	}
+
+	set := &SampleSet{
+		Count:      len(paths),
+		IntervalMs: urlConfig.SampleInterval,
+		Files:      make([]string, 0, len(paths)),
+		Similarity: make([]float64, 0, len(paths)),
+	}
+
+	// Store paths relative to the URL directory
+	for _, path := range paths {
+		set.Files = append(set.Files, filepath.Join(filepath.Base(viewportDir), filepath.Base(path)))
+	}
+
+	first, err := loadImage(paths[0])
+	if err != nil {
+		return fmt.Errorf("failed to load first sample: %w", err)
+	}
+
+	total := 0.0
+	for _, path := range paths {
+		img, err := loadImage(path)
+		if err != nil {
+			return fmt.Errorf("failed to load sample %s: %w", path, err)
+		}
+
+		similarity := imageSimilarity(first, img)
+		set.Similarity = append(set.Similarity, similarity)
+		total += similarity
+	}
+	set.StabilityScore = total / float64(len(paths))
+
+	log.Printf("Captured %d samples for %s at viewport %dx%d, stability score: %.4f",
+		set.Count, urlConfig.Name, viewport.Width, viewport.Height, set.StabilityScore)
+
+	vm.Samples = set
+	return nil
+}
+
+// loadImage decodes a PNG or JPEG image from disk
+func loadImage(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	return img, err
+}
+
+// imageSimilarity returns the fraction of identical pixels between two images.
+// Pixels outside the overlapping area count as different.
+func imageSimilarity(a, b image.Image) float64 {
+	similarity, _ := toleratedSimilarity(a, b, nil)
+	return similarity
+}
@@ -0,0 +1,203 @@
+package screenshot
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+)
+
+// screencastFrame is a frame sent by the browser while the page was recorded
+type screencastFrame struct {
+	at   time.Time
+	data []byte // JPEG
+}
+
+// screencast collects the frames the browser sends while a page is recorded
+type screencast struct {
+	width, height int // Size the frames are scaled to fit
+
+	mu     sync.Mutex
+	frames []screencastFrame
+	stop   context.CancelFunc
+}
+
+// startScreencast starts recording the page of a browser context. Frames are scaled
+// down to fit width and height.
+func startScreencast(ctx context.Context, width, height int) (*screencast, error) {
+	sc := &screencast{width: width, height: height}
+
+	// Frames are only sent again once the previous one is acknowledged
+	listenCtx, stop := context.WithCancel(ctx)
+	sc.stop = stop
+	chromedp.ListenTarget(listenCtx, func(ev any) {
+		e, ok := ev.(*page.EventScreencastFrame)
+		if !ok {
+			return
+		}
+		if data, err := base64.StdEncoding.DecodeString(e.Data); err == nil {
+			sc.mu.Lock()
+			sc.frames = append(sc.frames, screencastFrame{at: time.Now(), data: data})
+			sc.mu.Unlock()
+		}
+		go chromedp.Run(listenCtx, chromedp.ActionFunc(func(ctx context.Context) error {
+			return page.ScreencastFrameAck(e.SessionID).Do(ctx)
+		}))
+	})
+
+	if err := chromedp.Run(ctx, page.StartScreencast().
+		WithFormat(page.ScreencastFormatJpeg).
+		WithQuality(80).
+		WithMaxWidth(int64(width)).
+		WithMaxHeight(int64(height))); err != nil {
+		stop()
+		return nil, err
+	}
+	return sc, nil
+}
+
+// finish stops the recording
+func (sc *screencast) finish(ctx context.Context) error {
+	defer sc.stop()
+	return chromedp.Run(ctx, page.StopScreencast())
+}
+
+// sample returns the frames shown between start and end at a fixed rate. The browser only
+// sends a frame when the page changes, so a frame is repeated until the next one arrives.
+func (sc *screencast) sample(start, end time.Time, fps int) [][]byte {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if len(sc.frames) == 0 {
+		return nil
+	}
+
+	interval := time.Second / time.Duration(fps)
+	var sampled [][]byte
+	next := 0
+	for at := start; !at.After(end); at = at.Add(interval) {
+		for next+1 < len(sc.frames) && !sc.frames[next+1].at.After(at) {
+			next++
+		}
+		sampled = append(sampled, sc.frames[next].data)
+	}
+	return sampled
+}
+
+// writeAnimation writes sampled frames as an animated GIF or, if ffmpeg is installed, a WebM video
+func (sc *screencast) writeAnimation(ctx context.Context, path, format string, frames [][]byte, fps int) error {
+	if len(frames) == 0 {
+		return fmt.Errorf("the browser sent no screencast frames")
+	}
+	if format == "webm" {
+		return encodeWebM(ctx, path, frames, fps, sc.width, sc.height)
+	}
+	return encodeGIF(path, frames, fps, sc.width, sc.height)
+}
+
+// fitFrame decodes a frame and centers it on a black canvas of the given size. Frames vary
+// in size when the viewport is resized, such as for the full page capture.
+func fitFrame(data []byte, width, height int) (image.Image, error) {
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	if bounds.Dx() == width && bounds.Dy() == height {
+		return img, nil
+	}
+	if factor := min(float64(width)/float64(bounds.Dx()), float64(height)/float64(bounds.Dy())); factor < 1 {
+		img = resizeImage(img, factor)
+		bounds = img.Bounds()
+	}
+
+	canvas := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(canvas, canvas.Bounds(), image.Black, image.Point{}, draw.Src)
+	offset := image.Pt((width-bounds.Dx())/2, (height-bounds.Dy())/2)
+	draw.Draw(canvas, bounds.Sub(bounds.Min).Add(offset), img, bounds.Min, draw.Src)
+	return canvas, nil
+}
+
+// encodeGIF writes JPEG frames as an animated GIF that loops forever
+func encodeGIF(path string, frames [][]byte, fps, width, height int) error {
+	anim := &gif.GIF{LoopCount: 0}
+	delay := max(2, 100/fps) // In hundredths of a second, browsers play shorter delays slowly
+
+	for i, data := range frames {
+		// Consecutive identical frames only lengthen the previous one
+		if i > 0 && bytes.Equal(data, frames[i-1]) {
+			anim.Delay[len(anim.Delay)-1] += delay
+			continue
+		}
+
+		img, err := fitFrame(data, width, height)
+		if err != nil {
+			return fmt.Errorf("failed to decode frame %d: %w", i+1, err)
+		}
+		paletted := image.NewPaletted(img.Bounds(), palette.Plan9)
+		draw.FloydSteinberg.Draw(paletted, img.Bounds(), img, img.Bounds().Min)
+
+		anim.Image = append(anim.Image, paletted)
+		anim.Delay = append(anim.Delay, delay)
+	}
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		return fmt.Errorf("failed to encode GIF: %w", err)
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// encodeWebM writes JPEG frames as a VP9 WebM video. Go has no VP9 encoder, so ffmpeg does the encoding.
+func encodeWebM(ctx context.Context, path string, frames [][]byte, fps, width, height int) error {
+	ffmpeg, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return fmt.Errorf("webm recordings require ffmpeg in PATH: %w", err)
+	}
+
+	// VP9 needs even dimensions
+	width, height = width&^1, height&^1
+
+	var input bytes.Buffer
+	var previous []byte
+	var encoded []byte
+	for i, data := range frames {
+		if i == 0 || !bytes.Equal(data, previous) {
+			img, err := fitFrame(data, width, height)
+			if err != nil {
+				return fmt.Errorf("failed to decode frame %d: %w", i+1, err)
+			}
+			var buf bytes.Buffer
+			if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+				return err
+			}
+			encoded = buf.Bytes()
+		}
+		previous = data
+		input.Write(encoded)
+	}
+
+	cmd := exec.CommandContext(ctx, ffmpeg, "-y", "-loglevel", "error",
+		"-f", "image2pipe", "-framerate", fmt.Sprint(fps), "-c:v", "mjpeg", "-i", "-",
+		"-c:v", "libvpx-vp9", "-b:v", "0", "-crf", "36", "-pix_fmt", "yuv420p", path)
+	cmd.Stdin = &input
+	if output, err := cmd.CombinedOutput(); err != nil {
+		log.Printf("ffmpeg output for %s: %s", path, bytes.TrimSpace(output))
+		return fmt.Errorf("ffmpeg failed: %w", err)
+	}
+	return nil
+}
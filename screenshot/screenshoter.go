@@ -2,6 +2,7 @@ package screenshot
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"math"
@@ -9,21 +10,21 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"screenshot-tool/config"
 
-	"github.com/chromedp/cdproto/cdp"
 	"github.com/chromedp/cdproto/emulation"
 	"github.com/chromedp/cdproto/network"
-	"github.com/chromedp/cdproto/storage"
+	"github.com/chromedp/cdproto/page"
 	"github.com/chromedp/chromedp"
 )
 
-// Global mutex to synchronize Docker container operations
-var dockerMutex sync.Mutex
+// Mutexes synchronizing the operations on each Docker container, keyed by container name
+var dockerMutexes sync.Map
 
 // findChromeExecutable attempts to locate the Chrome executable on the system
 func findChromeExecutable() (string, error) {
@@ -86,11 +87,28 @@ func findChromeExecutable() (string, error) {
 	return "", fmt.Errorf("could not find Chrome executable")
 }
 
-// startDockerChrome starts a Chrome instance in Docker if not already running
-func startDockerChrome() (string, error) {
+// Labels recording the configured Chrome flags and the host port a container was started with
+const (
+	dockerFlagsLabel = "screenshot-tool.chrome-flags"
+	dockerPortLabel  = "screenshot-tool.port"
+)
+
+// startDockerChrome starts a Chrome instance in Docker with the configured Chrome flags
+// if not already running with them
+func startDockerChrome(flags []string) (string, error) {
+	return startDockerChromeContainer("chrome", 9222, flags)
+}
+
+// startDockerChromeContainer starts a Chrome container with the given name, listening on
+// a host port, unless it's already running with the same flags, and returns its address
+func startDockerChromeContainer(name string, port int, flags []string) (string, error) {
 	// Acquire mutex to prevent parallel container creation
-	dockerMutex.Lock()
-	defer dockerMutex.Unlock()
+	mu, _ := dockerMutexes.LoadOrStore(name, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	defer mu.(*sync.Mutex).Unlock()
+
+	address := fmt.Sprintf("http://localhost:%d", port)
+	filter := "name=^" + name + "$"
 
 	// Check if docker is installed
 	if _, err := exec.LookPath("docker"); err != nil {
@@ -98,7 +116,7 @@ func startDockerChrome() (string, error) {
 	}
 
 	// Check if chrome container exists (running or not)
-	existsCmd := exec.Command("docker", "ps", "-a", "-q", "-f", "name=chrome")
+	existsCmd := exec.Command("docker", "ps", "-a", "-q", "-f", filter)
 	existsOutput, err := existsCmd.Output()
 	if err != nil {
 		return "", fmt.Errorf("failed to check for existing chrome container: %w", err)
@@ -107,15 +125,22 @@ func startDockerChrome() (string, error) {
 	// If container exists in any state
 	if len(existsOutput) > 0 {
 		// Check if it's running and responding
-		runningCmd := exec.Command("docker", "ps", "-q", "-f", "name=chrome", "-f", "status=running")
+		runningCmd := exec.Command("docker", "ps", "-q", "-f", filter, "-f", "status=running")
 		runningOutput, err := runningCmd.Output()
 
-		if err == nil && len(runningOutput) > 0 {
+		// A container started with other flags or on another port, e.g. by a run with another configuration, is replaced
+		labelCmd := exec.Command("docker", "inspect", "-f", fmt.Sprintf("{{index .Config.Labels %q}}|{{index .Config.Labels %q}}", dockerFlagsLabel, dockerPortLabel), name)
+		labelOutput, labelErr := labelCmd.Output()
+		sameFlags := labelErr == nil && strings.TrimSpace(string(labelOutput)) == strings.Join(flags, " ")+"|"+strconv.Itoa(port)
+
+		if err == nil && len(runningOutput) > 0 && !sameFlags {
+			log.Printf("Existing Chrome container %s was started with other Chrome flags or port", name)
+		} else if err == nil && len(runningOutput) > 0 {
 			// Container is running, check if it responds
 			log.Printf("Found existing Chrome container, checking if it's responsive")
-			if err := checkChromeResponseFromContainer(5); err == nil {
-				log.Printf("Using existing Chrome container")
-				return "http://localhost:9222", nil
+			if err := checkChromeResponseFromContainer(port, 5); err == nil {
+				log.Printf("Using existing Chrome container %s", name)
+				return address, nil
 			} else {
 				log.Printf("Existing Chrome container not responding: %v", err)
 			}
@@ -125,7 +150,7 @@ func startDockerChrome() (string, error) {
 
 		// Container exists but is not running or not responding - remove it
 		log.Printf("Removing existing Chrome container")
-		stopCmd := exec.Command("docker", "rm", "-f", "chrome")
+		stopCmd := exec.Command("docker", "rm", "-f", name)
 		if stopOut, stopErr := stopCmd.CombinedOutput(); stopErr != nil {
 			log.Printf("Warning: Failed to remove existing Chrome container: %v, output: %s", stopErr, string(stopOut))
 			// Continue anyway, the next docker run command will fail if this is a real problem
@@ -133,18 +158,27 @@ func startDockerChrome() (string, error) {
 	}
 
 	// Start a new chrome container with improved configuration
-	log.Printf("Starting a new Chrome container...")
-	cmd := exec.Command("docker", "run", "-d", "--rm", "--name", "chrome",
-		"-p", "9222:9222", // Using standard port 9222 for chromedp/headless-shell
-		"--cap-add=SYS_ADMIN",              // Add capabilities needed for Chrome
-		"--shm-size=2g",                    // Increase shared memory size to 2GB
-		"--memory=4g",                      // Limit container memory to 4GB
+	log.Printf("Starting a new Chrome container %s on port %d...", name, port)
+	args := []string{"run", "-d", "--rm", "--name", name,
+		"-p", fmt.Sprintf("%d:9222", port), // chromedp/headless-shell listens on the standard port 9222
+		"--cap-add=SYS_ADMIN", // Add capabilities needed for Chrome
+		"--shm-size=2g",       // Increase shared memory size to 2GB
+		"--memory=4g",         // Limit container memory to 4GB
+		"--label", dockerFlagsLabel + "=" + strings.Join(flags, " "),
+		"--label", dockerPortLabel + "=" + strconv.Itoa(port),
 		"chromedp/headless-shell:latest",   // Use chromedp's official headless shell image
 		"--disable-web-security",           // Disable web security for testing
 		"--ignore-certificate-errors",      // Ignore SSL certificate errors
 		"--allow-running-insecure-content", // Allow loading insecure content
 		"--disable-dev-shm-usage",          // Don't use /dev/shm (prevents crashes)
-		"--no-sandbox")                     // No sandbox for container environment
+		"--no-sandbox",                     // No sandbox for container environment
+	}
+	// Configured flags come last, so they win over the defaults above
+	if len(flags) > 0 {
+		log.Printf("Adding Chrome flags to the container: %s", strings.Join(flags, " "))
+		args = append(args, flags...)
+	}
+	cmd := exec.Command("docker", args...)
 
 	if output, err := cmd.CombinedOutput(); err != nil {
 		return "", fmt.Errorf("failed to start chrome container: %w, output: %s", err, string(output))
@@ -155,14 +189,14 @@ func startDockerChrome() (string, error) {
 
 	// Check if Chrome responds within timeout with retries
 	for retryAttempt := 0; retryAttempt < 3; retryAttempt++ {
-		if err := checkChromeResponseFromContainer(20); err != nil {
+		if err := checkChromeResponseFromContainer(port, 20); err != nil {
 			if retryAttempt == 2 {
 				// Get container logs for diagnostics
-				logsCmd := exec.Command("docker", "logs", "chrome")
+				logsCmd := exec.Command("docker", "logs", name)
 				logs, _ := logsCmd.CombinedOutput()
 
 				// Stop the container since it's not working
-				stopCmd := exec.Command("docker", "rm", "-f", "chrome")
+				stopCmd := exec.Command("docker", "rm", "-f", name)
 				stopCmd.Run() // Ignore errors
 
 				return "", fmt.Errorf("chrome container started but not responding after retries: %v\nContainer logs: %s",
@@ -171,24 +205,24 @@ func startDockerChrome() (string, error) {
 			log.Printf("Chrome container not responding yet, retrying... (attempt %d/3)", retryAttempt+1)
 			time.Sleep(2 * time.Second)
 		} else {
-			log.Printf("Chrome container is ready")
-			return "http://localhost:9222", nil
+			log.Printf("Chrome container %s is ready", name)
+			return address, nil
 		}
 	}
 
-	return "http://localhost:9222", nil
+	return address, nil
 }
 
-// checkChromeResponseFromContainer checks if Chrome is responding in the container
-// with the specified timeout in seconds
-func checkChromeResponseFromContainer(timeoutSeconds int) error {
+// checkChromeResponseFromContainer checks if Chrome is responding in the container on
+// a host port with the specified timeout in seconds
+func checkChromeResponseFromContainer(port, timeoutSeconds int) error {
 	// Try multiple times with increasing delay
 	maxRetries := timeoutSeconds
 	baseDelay := 1 * time.Second
 
 	for i := 0; i < maxRetries; i++ {
 		// Try standard Chrome endpoint first
-		cmd := exec.Command("curl", "-s", "--max-time", "2", "http://localhost:9222/json/version")
+		cmd := exec.Command("curl", "-s", "--max-time", "2", fmt.Sprintf("http://localhost:%d/json/version", port))
 		output, err := cmd.CombinedOutput()
 
 		if err == nil && strings.Contains(string(output), "webSocketDebuggerUrl") {
@@ -197,7 +231,7 @@ func checkChromeResponseFromContainer(timeoutSeconds int) error {
 		}
 
 		// Try browserless endpoint which might be different
-		cmd = exec.Command("curl", "-s", "--max-time", "2", "http://localhost:9222/json")
+		cmd = exec.Command("curl", "-s", "--max-time", "2", fmt.Sprintf("http://localhost:%d/json", port))
 		output, err = cmd.CombinedOutput()
 
 		if err == nil && len(output) > 0 && (strings.Contains(string(output), "webSocketDebuggerUrl") ||
@@ -218,195 +252,90 @@ func checkChromeResponseFromContainer(timeoutSeconds int) error {
 // Screenshoter handles the screenshot capturing logic
 type Screenshoter struct {
 	Config *config.Config
+
+	logins     map[string]*loginSession // Sessions of login flows, keyed by login name
+	loginMu    sync.Mutex
+	stats      *artifactStats   // Artifact size history, updated after each URL
+	quarantine *quarantineState // Quarantined URLs and recent mismatch history
+	standby    *Standby         // Warm browser used for captures when set
+	dockerPool *dockerPool      // Docker Chrome containers captures are spread over, if enabled
+	results    []URLResult      // Outcome of each URL captured by CaptureURLs
+	resultsMu  sync.Mutex
+	configHash string // SHA-256 of the configuration, embedded into the screenshots
+	runSize    int    // URLs of the run a queued URL belongs to, numbered like the others
+
+	// AfterURL is called with the directory of each captured URL once its artifacts are written
+	AfterURL func(urlConfig config.URLConfig, urlDir string)
+
+	// OnProgress, if set, is called as each URL capture starts, loads its page in a viewport,
+	// and finishes. It is called from the capture goroutines and must not block.
+	OnProgress func(event ProgressEvent)
+
+	// NewEngine, if set, starts the browser engine of every capture instead of Chrome or
+	// Firefox. It lets the capture logic run against a fake browser; the steps that need the
+	// Chrome DevTools protocol are skipped for engines that don't expose it.
+	NewEngine func(ctx context.Context, urlConfig config.URLConfig, viewport config.Viewport) (BrowserEngine, error)
 }
 
 // NewScreenshoter creates a new Screenshoter
 func NewScreenshoter(cfg *config.Config) *Screenshoter {
 	return &Screenshoter{
-		Config: cfg,
+		Config:     cfg,
+		logins:     make(map[string]*loginSession),
+		stats:      loadArtifactStats(cfg.OutputDir),
+		quarantine: loadQuarantine(cfg.OutputDir),
+		configHash: ConfigHash(cfg),
+		dockerPool: newDockerPool(cfg.DockerPool),
 	}
 }
 
-// setCookiesAndLocalStorage sets cookies and localStorage items for a URL and refreshes the page
-func (s *Screenshoter) setCookiesAndLocalStorage(ctx context.Context, urlConfig config.URLConfig, viewport config.Viewport, urlDir, stage string, screenshotType string) chromedp.ActionFunc {
-	return chromedp.ActionFunc(func(ctx context.Context) error {
-		// Check if these are defaultCookies (applied from config)
-		defaultCookiesApplied := false
-
-		// The issue is that we're not correctly detecting if the cookies come from DefaultCookies
-		// Instead of checking for stage, we should look for a marker that can tell us
-		// Let's add a special log message and check cookie names against defaultCookies
-
-		// Flag to track if any cookie or localStorage values were changed
-		needsRefresh := false
-
-		// Add cookies if specified
-		if len(urlConfig.Cookies) > 0 {
-			// Check if these cookies match the DefaultCookies from the config
-			// This is a better way to detect if we're applying DefaultCookies
-			for _, cookie := range urlConfig.Cookies {
-				for _, defaultCookie := range s.Config.DefaultCookies {
-					if cookie.Name == defaultCookie.Name {
-						defaultCookiesApplied = true
-						log.Printf("Detected DefaultCookie being applied: %s", cookie.Name)
-						break
-					}
-				}
-				if defaultCookiesApplied {
-					break
-				}
-			}
-
-			log.Printf("Setting %d cookies for %s (using DefaultCookies: %v)",
-				len(urlConfig.Cookies), urlConfig.Name, defaultCookiesApplied)
-
-			// Get existing cookies first
-			existingCookies, err := storage.GetCookies().Do(ctx)
-			if err != nil {
-				log.Printf("ERROR: Failed to get existing cookies: %v", err)
-				return err
-			}
-
-			// Create a map of existing cookies for quick lookup
-			existingCookieMap := make(map[string]string)
-			for _, cookie := range existingCookies {
-				key := cookie.Name + cookie.Path + cookie.Domain
-				existingCookieMap[key] = cookie.Value
-			}
-
-			// Create cookie expiration (180 days)
-			expr := cdp.TimeSinceEpoch(time.Now().Add(180 * 24 * time.Hour))
-
-			// Flag to track if any cookie was actually set
-			cookiesChanged := false
-
-			for _, cookie := range urlConfig.Cookies {
-				// Extract domain from URL if not specified in cookie
-				domain := cookie.Domain
-				if domain == "" {
-					// Use the URL's domain
-					domain = extractDomainFromURL(urlConfig.URL)
-				}
-
-				// Set cookie path to root if not specified
-				path := cookie.Path
-				if path == "" {
-					path = "/"
-				}
-
-				// Check if this cookie already exists with the same value
-				key := cookie.Name + path + domain
-				if value, exists := existingCookieMap[key]; exists && value == cookie.Value {
-					log.Printf("Cookie %s already exists with the same value, skipping", cookie.Name)
-					continue
-				}
-
-				err := network.SetCookie(cookie.Name, cookie.Value).
-					WithExpires(&expr).
-					WithDomain(domain).
-					WithPath(path).
-					WithHTTPOnly(cookie.HTTPOnly).
-					WithSecure(cookie.Secure).
-					Do(ctx)
-
-				if err != nil {
-					log.Printf("ERROR: Failed to set cookie %s: %v", cookie.Name, err)
-					return err
-				}
-
-				log.Printf("Successfully set cookie: %s=%s", cookie.Name, cookie.Value)
-				cookiesChanged = true
-			}
-
-			if cookiesChanged {
-				needsRefresh = true
-			}
-		}
-
-		// Set localStorage values if specified
-		if len(urlConfig.LocalStorage) > 0 {
-			log.Printf("Setting %d localStorage items for %s", len(urlConfig.LocalStorage), urlConfig.Name)
-			storageChanged := false
-
-			for _, storage := range urlConfig.LocalStorage {
-				jsScript := fmt.Sprintf(`
-				(function() {
-					const existingValue = localStorage.getItem("%s");
-					if (existingValue === "%s") {
-						console.log("localStorage key %s already has the same value, skipping");
-						return false;
-					}
-					localStorage.setItem("%s", "%s");
-					return true;
-				})()`,
-					escapeJSString(storage.Key),
-					escapeJSString(storage.Value),
-					escapeJSString(storage.Key),
-					escapeJSString(storage.Key),
-					escapeJSString(storage.Value))
-
-				var changed bool
-				if err := chromedp.Evaluate(jsScript, &changed).Do(ctx); err != nil {
-					log.Printf("ERROR: Failed to set localStorage %s: %v", storage.Key, err)
-					return err
-				}
-
-				if changed {
-					log.Printf("Successfully set localStorage: %s=%s", storage.Key, storage.Value)
-					storageChanged = true
-				}
-			}
-
-			if storageChanged {
-				needsRefresh = true
-			}
-		}
-
-		// Only refresh if needed
-		if needsRefresh || defaultCookiesApplied {
-			log.Printf("Refreshing page to ensure cookies and localStorage are applied")
-			if err := chromedp.Reload().Do(ctx); err != nil {
-				return err
-			}
-
-			// Extra refresh for DefaultCookies to ensure they're fully applied
-			if defaultCookiesApplied {
-				log.Printf("Adding extra refresh to ensure DefaultCookies are fully applied")
-				// Wait a bit more for DefaultCookies
-				if err := chromedp.Sleep(500 * time.Millisecond).Do(ctx); err != nil {
-					return err
-				}
+// UseStandby makes captures open tabs in a warm standby browser instead of launching Chrome
+func (s *Screenshoter) UseStandby(sb *Standby) {
+	s.standby = sb
+}
 
-				// Verify cookies were actually set before continuing
-				cookies, err := storage.GetCookies().Do(ctx)
-				if err != nil {
-					log.Printf("ERROR: Failed to get cookies after setting DefaultCookies: %v", err)
-				} else {
-					log.Printf("After setting DefaultCookies, found %d cookies:", len(cookies))
-					for _, c := range cookies {
-						log.Printf("  Cookie: %s=%s (domain: %s, path: %s)",
-							c.Name, c.Value, c.Domain, c.Path)
-					}
-				}
+// CaptureURL captures screenshots for a given URL with all configured viewports
+func (s *Screenshoter) CaptureURL(ctx context.Context, urlConfig config.URLConfig) error {
+	_, err := s.CaptureURLDir(ctx, urlConfig)
+	return err
+}
 
-				if err := chromedp.Reload().Do(ctx); err != nil {
-					return err
-				}
-			}
+// CaptureURLDir captures a URL like CaptureURL and returns the directory it was captured
+// into, which is empty if it couldn't be created
+func (s *Screenshoter) CaptureURLDir(ctx context.Context, urlConfig config.URLConfig) (string, error) {
+	urlDir, _, err := s.captureURL(ctx, 0, urlConfig)
+	return urlDir, err
+}
 
-			// Wait time for page to load after refresh
-			if err := chromedp.Sleep(500 * time.Millisecond).Do(ctx); err != nil {
-				return err
-			}
-		}
+// CaptureRunURL captures a URL of a run whose other URLs are captured elsewhere, such as a
+// job of a work queue, numbering its directory and manifest with its 1-based index among
+// the total URLs of the run. It returns the URL directory.
+func (s *Screenshoter) CaptureRunURL(ctx context.Context, index, total int, urlConfig config.URLConfig) (string, error) {
+	s.runSize = total
+	urlDir, _, err := s.captureURL(ctx, index, urlConfig)
+	return urlDir, err
+}
 
-		// Log cookies after setting our custom ones
-		return SaveCookiesToFile(ctx, urlConfig, stage, urlDir, viewport, screenshotType).Do(ctx)
-	})
+// urlDirName returns the name of a URL directory: the URL's position, name, the run
+// label if set and the capture time. An index of 0 leaves it unnumbered.
+func (s *Screenshoter) urlDirName(index int, name, timestamp string) string {
+	dirName := SanitizeFilename(name)
+	if s.Config.Label != "" {
+		dirName += "_" + SanitizeFilename(s.Config.Label)
+	}
+	dirName += "_" + timestamp
+	if index > 0 {
+		// Zero-pad the number so directories list in configuration order
+		width := max(3, len(strconv.Itoa(max(len(s.Config.URLs), s.runSize))))
+		dirName = fmt.Sprintf("%0*d_%s", width, index, dirName)
+	}
+	return dirName
 }
 
-// CaptureURL captures screenshots for a given URL with all configured viewports
-func (s *Screenshoter) CaptureURL(ctx context.Context, urlConfig config.URLConfig) error {
+// captureURL captures a URL, numbering its directory and manifest with its
+// 1-based position in the configuration. An index of 0 leaves them unnumbered.
+// It returns the URL directory and manifest, empty and nil if the directory could not be created.
+func (s *Screenshoter) captureURL(ctx context.Context, index int, urlConfig config.URLConfig) (string, *Manifest, error) {
 	viewportsCount := len(urlConfig.Viewports)
 	timeoutDuration := 120*time.Second + time.Duration(60*viewportsCount)*time.Second
 	ctx, cancel := context.WithTimeout(ctx, timeoutDuration)
@@ -415,20 +344,35 @@ func (s *Screenshoter) CaptureURL(ctx context.Context, urlConfig config.URLConfi
 	log.Printf("Set timeout of %v for URL %s with %d viewports", timeoutDuration, urlConfig.Name, viewportsCount)
 
 	timestamp := time.Now().Format("20060102-150405")
-	uniqueDirName := fmt.Sprintf("%s_%s", sanitizeFilename(urlConfig.Name), timestamp)
+	uniqueDirName := s.urlDirName(index, urlConfig.Name, timestamp)
 
 	urlDir := filepath.Join(s.Config.OutputDir, uniqueDirName)
+	s.progress(ProgressEvent{Type: "started", Name: urlConfig.Name, URL: urlConfig.URL, Dir: urlDir})
 	if err := os.MkdirAll(urlDir, 0755); err != nil {
-		return fmt.Errorf("failed to create directory for URL %s: %w", urlConfig.Name, err)
+		err = fmt.Errorf("failed to create directory for URL %s: %w", urlConfig.Name, err)
+		s.progress(ProgressEvent{Type: "failed", Name: urlConfig.Name, URL: urlConfig.URL, Dir: urlDir, Error: err.Error()})
+		return "", nil, err
 	}
 
 	log.Printf("Created unique directory for %s: %s", urlConfig.Name, uniqueDirName)
 
 	viewproofNeeded := len(s.Config.ViewProof) > 0
+	manifest := newManifest(urlConfig)
+	manifest.Index = index
+	manifest.Label = s.Config.Label
+	if sim := urlConfig.UserSimulation; sim != nil && sim.Enabled {
+		manifest.Simulation = planUserSimulation(sim)
+	}
+
+	// Add the manifest entries up front so they follow the configured viewport order
+	viewportManifests := make([]*ViewportManifest, len(urlConfig.Viewports))
+	for i, viewport := range urlConfig.Viewports {
+		viewportManifests[i] = manifest.addViewport(viewport)
+	}
 
 	var wg sync.WaitGroup
-	errChan := make(chan error, len(urlConfig.Viewports))
-	viewportSem := make(chan struct{}, 3) // Process up to 3 viewports in parallel
+	viewportErrs := make([]error, len(urlConfig.Viewports))
+	viewportSem := make(chan struct{}, s.Config.ViewportConcurrency)
 
 	for i, viewport := range urlConfig.Viewports {
 		wg.Add(1)
@@ -441,15 +385,16 @@ func (s *Screenshoter) CaptureURL(ctx context.Context, urlConfig config.URLConfi
 			viewportDirName := fmt.Sprintf("%dx%d", viewport.Width, viewport.Height)
 			viewportDir := filepath.Join(urlDir, viewportDirName)
 			if err := os.MkdirAll(viewportDir, 0755); err != nil {
-				errChan <- fmt.Errorf("failed to create directory for viewport %s: %w", viewportDirName, err)
+				viewportErrs[i] = fmt.Errorf("failed to create directory for viewport %s: %w", viewportDirName, err)
+				viewportManifests[i].Failure = &ViewportFailure{Stage: "directory setup", Errors: errorChain(viewportErrs[i])}
 				return
 			}
 
 			log.Printf("Capturing screenshots for %s at viewport %dx%d", urlConfig.Name, viewport.Width, viewport.Height)
 
 			// Apply ViewProof to all viewports by removing the "i == 0" condition
-			if err := s.captureWithViewport(ctx, urlConfig, viewport, viewportDir, true, viewproofNeeded); err != nil {
-				errChan <- fmt.Errorf("failed to capture screenshots for %s at viewport %dx%d: %w",
+			if err := s.captureWithViewport(ctx, urlConfig, viewport, viewportDir, true, viewproofNeeded, viewportManifests[i]); err != nil {
+				viewportErrs[i] = fmt.Errorf("failed to capture screenshots for %s at viewport %dx%d: %w",
 					urlConfig.Name, viewport.Width, viewport.Height, err)
 				return
 			}
@@ -458,16 +403,129 @@ func (s *Screenshoter) CaptureURL(ctx context.Context, urlConfig config.URLConfi
 
 	wg.Wait()
 
-	select {
-	case err := <-errChan:
-		return err
-	default:
-		return nil
+	if err := writeFailureReport(urlDir, manifest); err != nil {
+		log.Printf("ERROR: Failed to write failure report for %s: %v", urlConfig.Name, err)
+	}
+
+	if err := writeMetricsCSV(urlDir, urlConfig, manifest); err != nil {
+		log.Printf("ERROR: Failed to write performance metrics for %s: %v", urlConfig.Name, err)
 	}
+
+	// Account for the bandwidth used and the space taken by the artifacts
+	for _, vm := range viewportManifests {
+		manifest.BytesDownloaded += vm.BytesDownloaded
+	}
+	manifest.ArtifactBytes = dirSize(urlDir)
+
+	// Fingerprint the artifacts for tamper evidence
+	if s.Config.Checksums {
+		if checksums, err := ChecksumDir(urlDir); err != nil {
+			log.Printf("ERROR: Failed to compute checksums for %s: %v", urlConfig.Name, err)
+		} else {
+			manifest.Checksums = checksums
+		}
+	}
+
+	// Write the manifest even if some viewports failed so partial results are documented
+	if err := manifest.write(urlDir); err != nil {
+		log.Printf("ERROR: Failed to write manifest for %s: %v", urlConfig.Name, err)
+	}
+
+	// List the checksums of the artifacts and the manifest in a file sha256sum can check
+	if manifest.Checksums != nil {
+		if err := writeChecksums(urlDir, manifest.Checksums); err != nil {
+			log.Printf("ERROR: Failed to write checksums for %s: %v", urlConfig.Name, err)
+		}
+	}
+
+	// Record artifact sizes to improve future disk space estimates
+	s.stats.recordDir(urlDir)
+
+	if s.AfterURL != nil {
+		s.AfterURL(urlConfig, urlDir)
+	}
+
+	// Report the first failed viewport in configuration order
+	err := errors.Join(viewportErrs...)
+	if err != nil {
+		s.progress(ProgressEvent{Type: "failed", Name: urlConfig.Name, URL: urlConfig.URL, Dir: urlDir, Error: err.Error()})
+	} else {
+		s.progress(ProgressEvent{Type: "captured", Name: urlConfig.Name, URL: urlConfig.URL, Dir: urlDir})
+	}
+	return urlDir, manifest, err
+}
+
+// needsLocalChrome reports whether a URL uses settings that can only be applied when launching Chrome
+func needsLocalChrome(urlConfig config.URLConfig) bool {
+	return urlConfig.Proxy != nil || len(urlConfig.DNSOverrides) > 0 || len(urlConfig.Extensions) > 0 || len(urlConfig.ChromeFlags) > 0
+}
+
+// chromeFlagOptions turns Chrome flags of the form --name or --name=value into allocator
+// options. They are added last, so they replace the tool's own flags of the same name.
+func chromeFlagOptions(flags ...[]string) []chromedp.ExecAllocatorOption {
+	var opts []chromedp.ExecAllocatorOption
+	for _, list := range flags {
+		for _, flag := range list {
+			name, value, hasValue := strings.Cut(strings.TrimPrefix(flag, "--"), "=")
+			if hasValue {
+				opts = append(opts, chromedp.Flag(name, value))
+			} else {
+				opts = append(opts, chromedp.Flag(name, true))
+			}
+		}
+	}
+	return opts
+}
+
+// startDockerChrome connects a capture to Docker Chrome, to the least busy container of
+// the pool if enabled. release must be called once the capture is done.
+func (s *Screenshoter) startDockerChrome() (string, func(), error) {
+	if s.dockerPool != nil {
+		return s.dockerPool.acquire(s.Config.ChromeFlags)
+	}
+	address, err := startDockerChrome(s.Config.ChromeFlags)
+	return address, func() {}, err
+}
+
+// chromeMode returns the Chrome backend for a URL, its own mode takes precedence over the command line
+func (s *Screenshoter) chromeMode(urlConfig config.URLConfig) string {
+	if urlConfig.ChromeMode != "" {
+		return urlConfig.ChromeMode
+	}
+	return s.Config.ChromeMode
 }
 
-// captureWithViewport captures screenshots for a specific viewport size
-func (s *Screenshoter) captureWithViewport(ctx context.Context, urlConfig config.URLConfig, viewport config.Viewport, viewportDir string, captureViewports bool, withViewProof bool) error {
+// newBrowserContext launches or connects to Chrome for a URL and viewport and returns a
+// browser context. The returned cancel function releases everything that was started.
+func (s *Screenshoter) newBrowserContext(ctx context.Context, urlConfig config.URLConfig, viewport config.Viewport) (context.Context, context.CancelFunc, error) {
+	if s.Config.Backend == "webdriver" {
+		return s.newWebDriverContext(ctx, urlConfig, viewport)
+	}
+	chromeMode := s.chromeMode(urlConfig)
+
+	// Use a tab of the standby browser unless the URL needs its own launch settings or backend
+	if s.standby != nil && !needsLocalChrome(urlConfig) && chromeMode == s.standby.mode {
+		tabCtx, cancelTab, err := s.standby.newTab(viewport.Width, viewport.Height)
+		if err != nil {
+			// The browser may have crashed, try once more after replacing it
+			s.standby.recover("could not open a tab")
+			tabCtx, cancelTab, err = s.standby.newTab(viewport.Width, viewport.Height)
+		}
+		if err == nil {
+			log.Printf("Using standby browser for %s at viewport %dx%d", urlConfig.Name, viewport.Width, viewport.Height)
+			return tabCtx, cancelTab, nil
+		}
+		log.Printf("Standby browser unavailable for %s, launching Chrome instead: %v", urlConfig.Name, err)
+	}
+
+	// Release resources in reverse order of creation
+	var cleanups []func()
+	cleanup := func() {
+		for i := len(cleanups) - 1; i >= 0; i-- {
+			cleanups[i]()
+		}
+	}
+
 	// Create browser options
 	opts := append(chromedp.DefaultExecAllocatorOptions[:],
 		chromedp.WindowSize(viewport.Width, viewport.Height),
@@ -477,14 +535,77 @@ func (s *Screenshoter) captureWithViewport(ctx context.Context, urlConfig config
 		chromedp.Flag("ignore-certificate-errors", true),
 	)
 
+	// Route browser traffic through the configured proxy
+	if urlConfig.Proxy != nil {
+		if chromeMode == "docker" {
+			cleanup()
+			return nil, nil, fmt.Errorf("proxy settings require local Chrome, the shared Docker Chrome container cannot use them")
+		}
+
+		proxyServer := urlConfig.Proxy.URL
+		if urlConfig.Proxy.Auth != "" {
+			// Chrome can't prompt for credentials, so authenticate through a local helper
+			forwarder, err := startProxyForwarder(*urlConfig.Proxy)
+			if err != nil {
+				cleanup()
+				return nil, nil, err
+			}
+			cleanups = append(cleanups, func() { forwarder.Close() })
+			proxyServer = "http://" + forwarder.Addr()
+		}
+
+		log.Printf("Using proxy %s for %s", urlConfig.Proxy.URL, urlConfig.Name)
+		opts = append(opts, chromedp.ProxyServer(proxyServer))
+		if len(urlConfig.Proxy.Bypass) > 0 {
+			opts = append(opts, chromedp.Flag("proxy-bypass-list", proxyBypassList(*urlConfig.Proxy)))
+		}
+	}
+
+	// Resolve overridden hostnames without touching the runner's hosts file
+	if len(urlConfig.DNSOverrides) > 0 {
+		if chromeMode == "docker" {
+			cleanup()
+			return nil, nil, fmt.Errorf("DNS overrides require local Chrome, the shared Docker Chrome container cannot use them")
+		}
+
+		rules := hostResolverRules(urlConfig.DNSOverrides)
+		log.Printf("Using host resolver rules for %s: %s", urlConfig.Name, rules)
+		opts = append(opts, chromedp.Flag("host-resolver-rules", rules))
+	}
+
+	// Load unpacked extensions, which the old headless mode of Chrome can't run
+	if len(urlConfig.Extensions) > 0 {
+		if chromeMode == "docker" {
+			cleanup()
+			return nil, nil, fmt.Errorf("extensions require local Chrome, the Docker headless shell cannot load them")
+		}
+
+		extensions := strings.Join(urlConfig.Extensions, ",")
+		log.Printf("Loading extensions for %s: %s", urlConfig.Name, extensions)
+		opts = append(opts,
+			chromedp.Flag("headless", "new"),
+			chromedp.Flag("disable-extensions", false),
+			chromedp.Flag("load-extension", extensions),
+			chromedp.Flag("disable-extensions-except", extensions),
+		)
+	}
+
+	// Add the configured Chrome flags, which the shared Docker Chrome container was started without
+	if len(urlConfig.ChromeFlags) > 0 {
+		if chromeMode == "docker" {
+			cleanup()
+			return nil, nil, fmt.Errorf("chromeFlags of a URL require local Chrome, the shared Docker Chrome container cannot use them")
+		}
+		log.Printf("Adding Chrome flags for %s: %s", urlConfig.Name, strings.Join(urlConfig.ChromeFlags, " "))
+	}
+	opts = append(opts, chromeFlagOptions(s.Config.ChromeFlags, urlConfig.ChromeFlags)...)
+
 	// Define context variables here
 	var allocCtx context.Context
-	var browserCtx context.Context
 	var cancelAlloc context.CancelFunc
-	var cancelBrowser context.CancelFunc
 
 	// Determine which Chrome implementation to use based on the specified mode
-	switch s.Config.ChromeMode {
+	switch chromeMode {
 	case "local":
 		// Force use of local Chrome
 		if execPath, err := findChromeExecutable(); err == nil {
@@ -494,22 +615,25 @@ func (s *Screenshoter) captureWithViewport(ctx context.Context, urlConfig config
 
 			// Create allocator context with local Chrome
 			allocCtx, cancelAlloc = chromedp.NewExecAllocator(ctx, opts...)
-			defer cancelAlloc()
+			cleanups = append(cleanups, cancelAlloc)
 		} else {
-			return fmt.Errorf("local Chrome mode specified but Chrome executable not found: %v", err)
+			cleanup()
+			return nil, nil, fmt.Errorf("local Chrome mode specified but Chrome executable not found: %v", err)
 		}
 
 	case "docker":
 		// Force use of Docker Chrome
 		log.Printf("Docker Chrome mode specified, starting or connecting to Docker Chrome...")
-		if dockerURL, err := startDockerChrome(); err == nil {
+		if dockerURL, release, err := s.startDockerChrome(); err == nil {
 			// Use Docker Chrome
 			log.Printf("Using Docker Chrome at: %s", dockerURL)
+			cleanups = append(cleanups, release)
 			// Use standard Chrome debugging protocol with chromedp/headless-shell
 			allocCtx, cancelAlloc = chromedp.NewRemoteAllocator(ctx, dockerURL)
-			defer cancelAlloc()
+			cleanups = append(cleanups, cancelAlloc)
 		} else {
-			return fmt.Errorf("docker Chrome mode specified but failed to start or connect to Docker Chrome: %v", err)
+			cleanup()
+			return nil, nil, fmt.Errorf("docker Chrome mode specified but failed to start or connect to Docker Chrome: %v", err)
 		}
 
 	default: // "auto" mode - try local, then Docker, then fallback
@@ -521,97 +645,363 @@ func (s *Screenshoter) captureWithViewport(ctx context.Context, urlConfig config
 
 			// Create allocator context with local Chrome
 			allocCtx, cancelAlloc = chromedp.NewExecAllocator(ctx, opts...)
-			defer cancelAlloc()
+			cleanups = append(cleanups, cancelAlloc)
 		} else {
 			// Try Docker Chrome as fallback
 			log.Printf("Local Chrome not found: %v", err)
+			if needsLocalChrome(urlConfig) {
+				cleanup()
+				return nil, nil, fmt.Errorf("proxy, DNS override, extension and Chrome flag settings require local Chrome, but it was not found: %v", err)
+			}
 			log.Printf("Attempting to use Docker Chrome...")
 
-			if dockerURL, err := startDockerChrome(); err == nil {
+			if dockerURL, release, err := s.startDockerChrome(); err == nil {
 				// Use Docker Chrome
 				log.Printf("Using Docker Chrome at: %s", dockerURL)
+				cleanups = append(cleanups, release)
 				// Use standard Chrome debugging protocol with chromedp/headless-shell
 				allocCtx, cancelAlloc = chromedp.NewRemoteAllocator(ctx, dockerURL)
-				defer cancelAlloc()
+				cleanups = append(cleanups, cancelAlloc)
 			} else {
 				// Fallback to default Chrome as last resort
 				log.Printf("Docker Chrome failed: %v", err)
 				log.Printf("Falling back to default Chrome settings")
 
 				allocCtx, cancelAlloc = chromedp.NewExecAllocator(ctx, opts...)
-				defer cancelAlloc()
+				cleanups = append(cleanups, cancelAlloc)
 			}
 		}
 	}
 
 	// Create browser context
-	browserCtx, cancelBrowser = chromedp.NewContext(allocCtx, chromedp.WithLogf(log.Printf))
-	defer cancelBrowser()
+	browserCtx, cancelBrowser := chromedp.NewContext(allocCtx, chromedp.WithLogf(log.Printf))
+	cleanups = append(cleanups, cancelBrowser)
+
+	return browserCtx, cleanup, nil
+}
+
+// captureWithViewport captures screenshots for a specific viewport size. Every engine runs
+// the same capture; the steps that need the Chrome DevTools protocol only run on engines
+// that expose it.
+func (s *Screenshoter) captureWithViewport(ctx context.Context, urlConfig config.URLConfig, viewport config.Viewport, viewportDir string, captureViewports bool, withViewProof bool, vm *ViewportManifest) (captureErr error) {
+	// Cookie and localStorage values produced by commands are minted for each capture
+	urlConfig, err := s.resolveValueCommands(ctx, urlConfig.ForViewport(viewport))
+	if err != nil {
+		vm.Failure = &ViewportFailure{Stage: "value commands", Errors: errorChain(err)}
+		return err
+	}
+
+	if ignored := config.FirefoxIgnoredOptions(urlConfig); len(ignored) > 0 {
+		log.Printf("Warning: %s uses Firefox, which ignores %s", urlConfig.Name, strings.Join(ignored, ", "))
+	}
+
+	stage := "browser start"
+	engine, err := s.newEngine(ctx, urlConfig, viewport)
+	if err != nil {
+		vm.Failure = &ViewportFailure{Stage: stage, Errors: errorChain(err)}
+		return err
+	}
+	defer engine.Close()
+
+	// Report when the page first loaded, the captures follow. Without the DevTools protocol
+	// the first page is reported once it was captured.
+	navigated := s.navigatedEvent(urlConfig, viewport, filepath.Dir(viewportDir))
+	reportLanding := func() {
+		if s.OnProgress != nil {
+			var landedOn string
+			if err := engine.Evaluate(`return location.href`, &landedOn); err == nil {
+				navigated(landedOn)
+			}
+		}
+	}
+
+	var session *screencast
+	var consoleLog *consoleRecorder
+	var transport *transportRecorder
+	dt, hasDevTools := engine.(devToolsEngine)
+	if hasDevTools {
+		browserCtx := dt.devTools()
+		if s.OnProgress != nil {
+			reportNavigation(browserCtx, navigated)
+		}
+
+		// Record the whole session as evidence of how the page reached the captured state
+		if video := urlConfig.Video; video != nil && video.Enabled {
+			sc, saveVideo, err := startSessionVideo(browserCtx, video, urlConfig, viewport, viewportDir, vm)
+			if err != nil {
+				log.Printf("Warning: Failed to record session video for %s at viewport %dx%d: %v", urlConfig.Name, viewport.Width, viewport.Height, err)
+			} else {
+				session = sc
+				defer saveVideo()
+			}
+		}
+
+		// Record console messages and page errors so broken renders can be diagnosed
+		consoleLog = recordConsole(browserCtx)
+
+		// Count the bytes downloaded by all captures of the viewport
+		bandwidth := countBandwidth(browserCtx)
+
+		// Record the protocol and TLS parameters the documents are loaded with
+		transport = recordTransport(browserCtx)
+		defer func() {
+			vm.BytesDownloaded = bandwidth.bytes.Load()
+		}()
+		defer func() {
+			consolePath := filepath.Join(viewportDir, fmt.Sprintf("%s-console.log", urlConfig.Name))
+			if err := consoleLog.write(consolePath); err != nil {
+				log.Printf("ERROR: Failed to write console log for %s: %v", urlConfig.Name, err)
+			}
+		}()
+	}
+
+	// Document a failure with what the browser showed, before the browser is closed
+	defer func() {
+		if captureErr != nil {
+			vm.Failure = s.diagnoseFailure(engine, stage, captureErr, consoleLog, urlConfig.Name, viewportDir)
+		}
+	}()
+
+	stage = "page setup"
+	if hasDevTools {
+		browserCtx := dt.devTools()
+
+		// Record network traffic as evidence of which resources were loaded
+		if urlConfig.HAR {
+			harLog := recordHAR(browserCtx)
+			defer func() {
+				harPath := filepath.Join(viewportDir, fmt.Sprintf("%s.har", urlConfig.Name))
+				if err := harLog.write(harPath); err != nil {
+					log.Printf("ERROR: Failed to write HAR for %s: %v", urlConfig.Name, err)
+				}
+			}()
+		}
+
+		// Emulate a mobile device before the page is laid out, as sites serve their mobile layout by it
+		if viewport.Mobile || viewport.Touch || viewport.Orientation == "landscape" {
+			if err := chromedp.Run(browserCtx, emulateDevice(viewport)); err != nil {
+				return fmt.Errorf("failed to emulate device: %w", err)
+			}
+		}
+
+		// Render the page in the URL's time zone, before any script reads the clock
+		if urlConfig.Timezone != "" {
+			if err := chromedp.Run(browserCtx, emulation.SetTimezoneOverride(urlConfig.Timezone)); err != nil {
+				return fmt.Errorf("failed to emulate time zone %s: %w", urlConfig.Timezone, err)
+			}
+		}
+
+		// Report the URL's position to the page without a permission prompt
+		if urlConfig.Geolocation != nil {
+			if err := chromedp.Run(browserCtx, emulateGeolocation(urlConfig.Geolocation)); err != nil {
+				return fmt.Errorf("failed to emulate geolocation: %w", err)
+			}
+		}
+
+		// Slow down the network to prove how the page loads on a slow connection
+		if urlConfig.Throttling != nil {
+			if err := chromedp.Run(browserCtx, throttleNetwork(urlConfig.Throttling)); err != nil {
+				return fmt.Errorf("failed to throttle network: %w", err)
+			}
+		}
+
+		// Install request rewrite rules before the first navigation
+		if len(urlConfig.Rewrites) > 0 {
+			if err := chromedp.Run(browserCtx, enableRewrites(browserCtx, urlConfig.Rewrites)); err != nil {
+				return fmt.Errorf("failed to enable request rewriting: %w", err)
+			}
+		}
+
+		// Import a saved browser storage state
+		if urlConfig.StorageState != "" {
+			state, err := loadStorageState(urlConfig.StorageState)
+			if err != nil {
+				return fmt.Errorf("failed to load storage state: %w", err)
+			}
+			if err := applyStorageState(browserCtx, state, &urlConfig); err != nil {
+				return fmt.Errorf("failed to apply storage state: %w", err)
+			}
+		}
+
+		// Reuse the session of the URL's login flow, logging in first if needed
+		if urlConfig.LoginID != "" {
+			if err := s.applyLoginSession(ctx, browserCtx, &urlConfig); err != nil {
+				return fmt.Errorf("failed to apply login session: %w", err)
+			}
+		}
+	}
+
+	// Write the provenance into the final screenshot files, after they are recompressed
+	defer s.embedMetadata(viewportDir, urlConfig, viewport)
+
+	// Recompress the screenshots once they are final, after the image limits below
+	defer s.optimizeImages(viewportDir, vm)
+
+	// Bring the screenshots within the configured size limits, including those of a partial capture
+	defer s.enforceImageLimits(viewportDir, vm)
+
+	// Mark truncated screenshots in the manifest
+	defer collectTruncations(viewportDir, vm)
+
+	// Record a performance trace from the first navigation until the full page is captured.
+	// The deferred stop saves the trace of a capture that failed before.
+	stopTrace := func() {}
+	if urlConfig.Trace && hasDevTools {
+		browserCtx := dt.devTools()
+		trace, err := startTrace(browserCtx)
+		if err != nil {
+			log.Printf("Warning: Failed to trace %s at viewport %dx%d: %v", urlConfig.Name, viewport.Width, viewport.Height, err)
+		} else {
+			var once sync.Once
+			stopTrace = func() {
+				once.Do(func() {
+					if err := trace.stop(browserCtx, filepath.Join(viewportDir, "trace.json")); err != nil {
+						log.Printf("ERROR: Failed to save trace for %s at viewport %dx%d: %v", urlConfig.Name, viewport.Width, viewport.Height, err)
+						return
+					}
+					vm.Trace = "trace.json"
+				})
+			}
+			defer stopTrace()
+		}
+	}
 
 	// If withViewProof is true, capture a full page screenshot with ViewProof first
 	if withViewProof {
-		if err := s.captureFullPageWithViewProof(browserCtx, urlConfig, viewport, viewportDir); err != nil {
+		stage = "viewproof capture"
+		if err := s.captureFullPageWithViewProof(ctx, engine, urlConfig, viewport, viewportDir); err != nil {
 			return fmt.Errorf("failed to capture full-proof screenshot: %w", err)
 		}
+		reportLanding()
 	}
 
-	// Capture full page screenshot
-	if err := s.captureFullPageScreenshot(browserCtx, urlConfig, viewport, viewportDir); err != nil {
+	// Capture full page screenshot, sampling it several times if configured
+	stage = "full page capture"
+	var fullPagePath string
+	if urlConfig.Samples > 1 {
+		if err := s.captureSamples(ctx, engine, urlConfig, viewport, viewportDir, vm); err != nil {
+			return fmt.Errorf("failed to capture full page samples for %s at viewport %dx%d: %w",
+				urlConfig.Name, viewport.Width, viewport.Height, err)
+		}
+		fullPagePath = filepath.Join(filepath.Dir(viewportDir), vm.Samples.Files[0])
+	} else if fullPagePath, err = s.captureFullPageScreenshot(ctx, engine, urlConfig, viewport, viewportDir, 0); err != nil {
 		return fmt.Errorf("failed to capture full page screenshot for %s at viewport %dx%d: %w",
 			urlConfig.Name, viewport.Width, viewport.Height, err)
 	}
+	reportLanding()
+	stopTrace()
+
+	// Compare against the baseline, a mismatch fails the viewport once the remaining captures are done
+	var diffErr error
+	if s.Config.Diff != nil {
+		stage = "baseline comparison"
+		diffErr = s.compareWithBaseline(urlConfig, viewport, viewportDir, fullPagePath, vm, func(urlConfig config.URLConfig) (string, error) {
+			return s.captureFullPageScreenshot(ctx, engine, urlConfig, viewport, viewportDir, 0)
+		})
+		if diffErr != nil {
+			log.Printf("ERROR: Baseline comparison failed for %s at viewport %dx%d: %v",
+				urlConfig.Name, viewport.Width, viewport.Height, diffErr)
+		}
+	}
 
-	// Capture viewport screenshots if requested
-	if captureViewports {
-		if err := s.captureViewportScreenshots(browserCtx, urlConfig, viewport, viewportDir, true); err != nil {
-			return fmt.Errorf("failed to capture viewport screenshots for %s at viewport %dx%d: %w",
+	// Record the performance of the page load that was just captured
+	metrics := &PageMetrics{}
+	if err := collectPageMetrics(engine, metrics); err != nil {
+		log.Printf("Warning: Failed to collect performance metrics for %s at viewport %dx%d: %v",
+			urlConfig.Name, viewport.Width, viewport.Height, err)
+	} else {
+		log.Printf("Performance of %s at viewport %dx%d: TTFB %.0fms, FCP %.0fms, LCP %.0fms, load %.0fms, %d requests, %d bytes",
+			urlConfig.Name, viewport.Width, viewport.Height, metrics.TTFB, metrics.FCP, metrics.LCP, metrics.Load, metrics.Requests, metrics.TransferBytes)
+		vm.Metrics = metrics
+	}
+
+	// Record how the main document of the page load was transferred
+	if transport != nil {
+		if info, err := transport.mainDocument(dt.devTools()); err != nil {
+			log.Printf("Warning: Failed to read the transport of %s at viewport %dx%d: %v",
 				urlConfig.Name, viewport.Width, viewport.Height, err)
+		} else {
+			vm.Transport = info
 		}
 	}
 
-	return nil
-}
+	// Record the placeholder substitutions made for the full page capture
+	if len(urlConfig.Placeholders) > 0 {
+		if err := readSubstitutions(engine, &vm.Substitutions); err != nil {
+			log.Printf("Warning: Failed to read placeholder substitutions for %s at viewport %dx%d: %v",
+				urlConfig.Name, viewport.Width, viewport.Height, err)
+		}
+	}
 
-// SaveCookiesToFile saves all current cookies to a log file
-func SaveCookiesToFile(ctx context.Context, urlConfig config.URLConfig, stage string, urlDir string, viewport config.Viewport, screenshotType string) chromedp.ActionFunc {
-	return chromedp.ActionFunc(func(ctx context.Context) error {
-		log.Printf("SaveCookiesToFile called for %s (stage: %s, type: %s)", urlConfig.Name, stage, screenshotType)
+	// Audit accessibility of the captured page, a failed audit doesn't fail the capture
+	if audit := urlConfig.Accessibility; audit != nil && audit.Enabled && hasDevTools {
+		reportName := fmt.Sprintf("%s-accessibility.json", SanitizeFilename(urlConfig.Name))
+		summary, err := auditAccessibility(dt.devTools(), audit, urlConfig, viewport, filepath.Join(viewportDir, reportName))
+		if err != nil {
+			log.Printf("Warning: Accessibility audit failed for %s at viewport %dx%d: %v",
+				urlConfig.Name, viewport.Width, viewport.Height, err)
+		} else {
+			summary.Report = reportName
+			vm.Accessibility = summary
+		}
+	}
 
-		// Get all cookies
-		cookies, err := storage.GetCookies().Do(ctx)
+	// Outline the interactive elements on a diagnostic screenshot, a failure doesn't fail the capture
+	if interactiveMap := urlConfig.InteractiveMap; interactiveMap != nil && interactiveMap.Enabled {
+		summary, err := s.captureInteractiveMap(ctx, engine, interactiveMap, urlConfig, viewport, viewportDir)
 		if err != nil {
-			log.Printf("ERROR: Failed to get cookies: %v", err)
-			return err
+			log.Printf("Warning: Interactive elements map failed for %s at viewport %dx%d: %v",
+				urlConfig.Name, viewport.Width, viewport.Height, err)
+		} else {
+			vm.Interactive = summary
 		}
-		log.Printf("Retrieved %d cookies for %s", len(cookies), urlConfig.Name)
+	}
 
-		// Create a single log file for the URL
-		timestamp := time.Now().Format("2006-01-02 15:04:05.000")
+	// Capture viewport screenshots if requested
+	if captureViewports {
+		stage = "viewport capture"
+		if err := s.captureViewportScreenshots(ctx, engine, urlConfig, viewport, viewportDir, vm); err != nil {
+			return fmt.Errorf("failed to capture viewport screenshots for %s at viewport %dx%d: %w",
+				urlConfig.Name, viewport.Width, viewport.Height, err)
+		}
+	}
 
-		// Save text log
-		if err := saveCookiesTextLog(cookies, urlConfig, stage, urlDir, viewport, screenshotType, timestamp); err != nil {
-			log.Printf("ERROR: Failed to save cookies text log: %v", err)
-			return err
+	// Record the page scrolling as motion proof, a failed recording doesn't fail the capture
+	if recording := urlConfig.ScrollRecording; recording != nil && recording.Enabled && hasDevTools {
+		name, err := s.recordScroll(dt.devTools(), recording, session, urlConfig, viewport, viewportDir)
+		if err != nil {
+			log.Printf("Warning: Scroll recording failed for %s at viewport %dx%d: %v",
+				urlConfig.Name, viewport.Width, viewport.Height, err)
+		} else {
+			log.Printf("Recorded scrolling of %s at viewport %dx%d: %s", urlConfig.Name, viewport.Width, viewport.Height, name)
+			vm.ScrollRecording = name
 		}
-		log.Printf("Saved cookies to text log successfully")
+	}
 
-		// Save CSV log
-		if err := saveCookiesCSV(cookies, urlConfig, stage, urlDir, viewport, screenshotType, timestamp); err != nil {
-			log.Printf("ERROR: Failed to save cookies CSV: %v", err)
-			return err
+	if diffErr != nil {
+		stage = "baseline comparison"
+	}
+	return diffErr
+}
+
+// captureScreenshot captures the current viewport in the configured file format
+func (s *Screenshoter) captureScreenshot(res *[]byte) chromedp.ActionFunc {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		params := page.CaptureScreenshot().WithFromSurface(true)
+		if s.Config.FileFormat == "jpeg" {
+			params = params.WithFormat(page.CaptureScreenshotFormatJpeg).WithQuality(int64(s.Config.Quality))
 		}
-		log.Printf("Saved cookies to CSV successfully")
 
-		log.Printf("Saved %d cookies to log files (viewport: %dx%d, type: %s, stage: %s)",
-			len(cookies), viewport.Width, viewport.Height, screenshotType, stage)
-		return nil
+		var err error
+		*res, err = params.Do(ctx)
+		return err
 	})
 }
 
 // saveCookiesTextLog saves cookies in text format
-func saveCookiesTextLog(cookies []*network.Cookie, urlConfig config.URLConfig, stage string, urlDir string, viewport config.Viewport, screenshotType, timestamp string) error {
+func (s *Screenshoter) saveCookiesTextLog(cookies []*network.Cookie, urlConfig config.URLConfig, stage string, urlDir string, viewport config.Viewport, screenshotType, timestamp string) error {
 	// Use the URL name directly from the config
-	filename := fmt.Sprintf("%s-cookies.log", sanitizeFilename(urlConfig.Name))
+	filename := fmt.Sprintf("%s-cookies.log", SanitizeFilename(urlConfig.Name))
 	filepath := filepath.Join(urlDir, filename)
 
 	// Format cookies as text
@@ -628,7 +1018,7 @@ func saveCookiesTextLog(cookies []*network.Cookie, urlConfig config.URLConfig, s
 		cookieText.WriteString("\nConfigured cookies that will be set:\n")
 		for i, cookie := range urlConfig.Cookies {
 			cookieText.WriteString(fmt.Sprintf("  Config Cookie #%d: %s=%s (domain: %s, path: %s)\n",
-				i+1, cookie.Name, cookie.Value,
+				i+1, cookie.Name, s.cookieLogValue(cookie.Name, cookie.Value),
 				cookie.Domain, cookie.Path))
 		}
 	}
@@ -639,7 +1029,7 @@ func saveCookiesTextLog(cookies []*network.Cookie, urlConfig config.URLConfig, s
 	for i, cookie := range cookies {
 		cookieText.WriteString(fmt.Sprintf("Cookie #%d:\n", i+1))
 		cookieText.WriteString(fmt.Sprintf("  Name: %s\n", cookie.Name))
-		cookieText.WriteString(fmt.Sprintf("  Value: %s\n", cookie.Value))
+		cookieText.WriteString(fmt.Sprintf("  Value: %s\n", s.cookieLogValue(cookie.Name, cookie.Value)))
 		cookieText.WriteString(fmt.Sprintf("  Domain: %s\n", cookie.Domain))
 		cookieText.WriteString(fmt.Sprintf("  Path: %s\n", cookie.Path))
 		cookieText.WriteString(fmt.Sprintf("  Expires: %s\n", time.Unix(int64(cookie.Expires), 0)))
@@ -674,8 +1064,8 @@ func saveCookiesTextLog(cookies []*network.Cookie, urlConfig config.URLConfig, s
 }
 
 // saveCookiesCSV saves cookies in CSV format
-func saveCookiesCSV(cookies []*network.Cookie, urlConfig config.URLConfig, stage string, urlDir string, viewport config.Viewport, screenshotType, timestamp string) error {
-	filename := fmt.Sprintf("%s-cookies.csv", sanitizeFilename(urlConfig.Name))
+func (s *Screenshoter) saveCookiesCSV(cookies []*network.Cookie, urlConfig config.URLConfig, stage string, urlDir string, viewport config.Viewport, screenshotType, timestamp string) error {
+	filename := fmt.Sprintf("%s-cookies.csv", SanitizeFilename(urlConfig.Name))
 	filepath := filepath.Join(urlDir, filename)
 
 	log.Printf("Saving cookies to CSV file: %s", filepath)
@@ -709,7 +1099,7 @@ func saveCookiesCSV(cookies []*network.Cookie, urlConfig config.URLConfig, stage
 		urlValue := strings.ReplaceAll(urlConfig.URL, ",", "\\,")
 		urlName := strings.ReplaceAll(urlConfig.Name, ",", "\\,")
 		cookieName := strings.ReplaceAll(cookie.Name, ",", "\\,")
-		cookieValue := strings.ReplaceAll(cookie.Value, ",", "\\,")
+		cookieValue := strings.ReplaceAll(s.cookieLogValue(cookie.Name, cookie.Value), ",", "\\,")
 		cookieDomain := strings.ReplaceAll(cookie.Domain, ",", "\\,")
 		cookiePath := strings.ReplaceAll(cookie.Path, ",", "\\,")
 
@@ -744,138 +1134,48 @@ func saveCookiesCSV(cookies []*network.Cookie, urlConfig config.URLConfig, stage
 }
 
 // captureFullPageWithViewProof captures a special screenshot with ViewProof data
-func (s *Screenshoter) captureFullPageWithViewProof(ctx context.Context, urlConfig config.URLConfig, viewport config.Viewport, viewportDir string) error {
+func (s *Screenshoter) captureFullPageWithViewProof(ctx context.Context, engine BrowserEngine, urlConfig config.URLConfig, viewport config.Viewport, viewportDir string) error {
 	if len(s.Config.ViewProof) == 0 {
 		return nil // Skip if ViewProof is not needed
 	}
 
 	log.Printf("Capturing special full-proof screenshot with ViewProof data")
 
-	var buf []byte
 	timestamp := time.Now().Format("20060102-150405")
 	filename := fmt.Sprintf("%s-full-proof-%dx%d.%s", timestamp, viewport.Width, viewport.Height, s.Config.FileFormat)
 	filepath := filepath.Join(viewportDir, filename)
 
-	viewproofData := make(map[string]string)
-	var tasks []chromedp.Action
-
-	tasks = append(tasks, chromedp.Navigate(urlConfig.URL))
-	tasks = append(tasks, SaveCookiesToFile(ctx, urlConfig, "before", viewportDir, viewport, "full-proof"))
-
 	// Apply cookies and localStorage BEFORE extracting ViewProof data
-	if len(urlConfig.Cookies) > 0 || len(urlConfig.LocalStorage) > 0 {
-		tasks = append(tasks, s.setCookiesAndLocalStorage(ctx, urlConfig, viewport, viewportDir, "after", "full-proof"))
-
-		// Add explicit refresh after setting cookies/localStorage to ensure they're applied
-		tasks = append(tasks, chromedp.ActionFunc(func(ctx context.Context) error {
-			log.Printf("Performing additional refresh to ensure cookies and localStorage are fully applied before ViewProof processing")
-			if err := chromedp.Reload().Do(ctx); err != nil {
-				return err
-			}
-			// Wait for page to reload and stabilize
-			return chromedp.Sleep(1 * time.Second).Do(ctx)
-		}))
+	if err := s.loadPage(ctx, engine, urlConfig, viewport, viewportDir, "", "full-proof"); err != nil {
+		return err
 	}
+	viewproofData := s.readViewProof(engine)
 
-	// Extract ViewProof data from cookies and localStorage AFTER setting them
-	tasks = append(tasks, chromedp.ActionFunc(func(ctx context.Context) error {
-		cookies, err := storage.GetCookies().Do(ctx)
-		if err != nil {
-			log.Printf("ERROR: Failed to get cookies for viewproof: %v", err)
-			return nil // Non-fatal error
-		}
-
-		for _, cookie := range cookies {
-			for _, proofKey := range s.Config.ViewProof {
-				if cookie.Name == proofKey {
-					viewproofData[fmt.Sprintf("cookie:%s", cookie.Name)] = cookie.Value
-				}
-			}
-		}
-
-		for _, proofKey := range s.Config.ViewProof {
-			var value string
-			err := chromedp.Evaluate(fmt.Sprintf(`localStorage.getItem("%s")`, escapeJSString(proofKey)), &value).Do(ctx)
-			if err == nil && value != "" {
-				viewproofData[fmt.Sprintf("localStorage:%s", proofKey)] = value
-			}
-		}
-
-		log.Printf("Extracted %d viewproof values for full-proof screenshot", len(viewproofData))
-		return nil
-	}))
-
-	// Scroll to ensure lazy content is loaded
-	tasks = append(tasks,
-		chromedp.Sleep(time.Duration(urlConfig.Delay)*time.Millisecond),
-		chromedp.Evaluate(`window.scrollTo(0, document.body.scrollHeight)`, nil),
-		chromedp.Sleep(500*time.Millisecond),
-		chromedp.Evaluate(`window.scrollTo(0, 0)`, nil),
-		chromedp.Sleep(500*time.Millisecond),
-	)
+	if err := s.preparePage(ctx, engine, urlConfig, viewport, nil); err != nil {
+		return err
+	}
 
 	// Add ViewProof block
-	tasks = append(tasks, chromedp.ActionFunc(func(ctx context.Context) error {
-		if len(viewproofData) > 0 {
-			script, _ := s.createViewProof(viewproofData, true, false)
-
-			var result bool
-			err := chromedp.Evaluate(script, &result).Do(ctx)
-			if err != nil {
-				log.Printf("ERROR creating ViewProof block: %v", err)
-				return err
-			}
-
-			log.Printf("Added ViewProof block to proof screenshot")
-		}
-		return nil
-	}))
+	if len(viewproofData) > 0 {
+		script, _ := s.createViewProof(viewproofData, true, false)
 
-	tasks = append(tasks, chromedp.Sleep(1*time.Second))
-	tasks = append(tasks, chromedp.Sleep(500*time.Millisecond))
-
-	// Capture the screenshot
-	tasks = append(tasks, chromedp.ActionFunc(func(ctx context.Context) error {
-		var metrics map[string]interface{}
-		if err := chromedp.Evaluate(`({
-			width: Math.max(document.body.scrollWidth, document.documentElement.scrollWidth),
-			height: Math.max(document.body.scrollHeight, document.documentElement.scrollHeight),
-		})`, &metrics).Do(ctx); err != nil {
+		var result bool
+		if err := evaluateExpression(engine, script, &result); err != nil {
+			log.Printf("ERROR creating ViewProof block: %v", err)
 			return err
 		}
 
-		width := int64(viewport.Width)
-
-		// Limit height to prevent Chrome screenshot issues
-		height := int64(metrics["height"].(float64))
-		maxHeight := int64(16384)
-		if height > maxHeight {
-			log.Printf("Warning: Page height (%d) exceeds maximum allowed height (%d). Limiting height.",
-				height, maxHeight)
-			height = maxHeight
-		}
-
-		if err := emulation.SetDeviceMetricsOverride(width, height, 1, false).Do(ctx); err != nil {
-			return err
-		}
-
-		err := chromedp.CaptureScreenshot(&buf).Do(ctx)
-		if err != nil {
-			// Try with smaller height if capture failed
-			if height > 8192 {
-				log.Printf("Screenshot capture failed, trying with reduced height...")
-				if err := emulation.SetDeviceMetricsOverride(width, 8192, 1, false).Do(ctx); err != nil {
-					return err
-				}
-				return chromedp.CaptureScreenshot(&buf).Do(ctx)
-			}
-			return err
-		}
+		log.Printf("Added ViewProof block to proof screenshot")
+	}
 
-		return nil
-	}))
+	if err := sleepContext(ctx, 1500*time.Millisecond); err != nil {
+		return err
+	}
 
-	if err := chromedp.Run(ctx, tasks...); err != nil {
+	// Capture the screenshot
+	var buf []byte
+	truncation, err := s.captureFullHeight(ctx, engine, &buf)
+	if err != nil {
 		return err
 	}
 
@@ -883,175 +1183,93 @@ func (s *Screenshoter) captureFullPageWithViewProof(ctx context.Context, urlConf
 		return err
 	}
 
+	if truncation != nil {
+		if err := writeTruncationNotice(filepath, truncation); err != nil {
+			log.Printf("ERROR: Failed to write truncation notice for %s: %v", filepath, err)
+		}
+	}
+
 	log.Printf("Captured full-proof screenshot for %s at viewport %dx%d: %s", urlConfig.Name, viewport.Width, viewport.Height, filepath)
 	return nil
 }
 
-// captureFullPageScreenshot captures a full page screenshot
-func (s *Screenshoter) captureFullPageScreenshot(ctx context.Context, urlConfig config.URLConfig, viewport config.Viewport, viewportDir string) error {
-	var buf []byte
+// captureFullPageScreenshot captures a full page screenshot and returns the path it was written to.
+// A non-zero sample number is added to the filename when the page is sampled multiple times.
+func (s *Screenshoter) captureFullPageScreenshot(ctx context.Context, engine BrowserEngine, urlConfig config.URLConfig, viewport config.Viewport, viewportDir string, sample int) (string, error) {
 	timestamp := time.Now().Format("20060102-150405")
 	filename := fmt.Sprintf("%s-full-%dx%d.%s", timestamp, viewport.Width, viewport.Height, s.Config.FileFormat)
+	if sample > 0 {
+		filename = fmt.Sprintf("%s-full-%dx%d-sample-%d.%s", timestamp, viewport.Width, viewport.Height, sample, s.Config.FileFormat)
+	}
 	filepath := filepath.Join(viewportDir, filename)
 
-	var tasks []chromedp.Action
-
-	tasks = append(tasks, chromedp.Navigate(urlConfig.URL))
-	tasks = append(tasks, SaveCookiesToFile(ctx, urlConfig, "before", viewportDir, viewport, "full page"))
-
 	// First apply cookies and localStorage
-	if len(urlConfig.Cookies) > 0 || len(urlConfig.LocalStorage) > 0 {
-		tasks = append(tasks, s.setCookiesAndLocalStorage(ctx, urlConfig, viewport, viewportDir, "after", "full page"))
-
-		// Add explicit refresh after setting cookies/localStorage to ensure they're applied
-		tasks = append(tasks, chromedp.ActionFunc(func(ctx context.Context) error {
-			log.Printf("Performing additional refresh to ensure cookies and localStorage are fully applied before screenshot capture")
-			if err := chromedp.Reload().Do(ctx); err != nil {
-				return err
-			}
-			// Wait for page to reload and stabilize
-			return chromedp.Sleep(1 * time.Second).Do(ctx)
-		}))
+	if err := s.loadPage(ctx, engine, urlConfig, viewport, viewportDir, "", "full page"); err != nil {
+		return "", err
 	}
 
 	// Then extract ViewProof data if needed
 	var viewproofData map[string]string
 	if len(s.Config.ViewProof) > 0 {
-		viewproofData = make(map[string]string)
-
-		tasks = append(tasks, chromedp.ActionFunc(func(ctx context.Context) error {
-			cookies, err := storage.GetCookies().Do(ctx)
-			if err != nil {
-				log.Printf("ERROR: Failed to get cookies for viewproof: %v", err)
-				return nil // Non-fatal error
-			}
-
-			for _, cookie := range cookies {
-				for _, proofKey := range s.Config.ViewProof {
-					if cookie.Name == proofKey {
-						viewproofData[fmt.Sprintf("cookie:%s", cookie.Name)] = cookie.Value
-					}
-				}
-			}
-
-			for _, proofKey := range s.Config.ViewProof {
-				var value string
-				err := chromedp.Evaluate(fmt.Sprintf(`localStorage.getItem("%s")`, escapeJSString(proofKey)), &value).Do(ctx)
-				if err == nil && value != "" {
-					viewproofData[fmt.Sprintf("localStorage:%s", proofKey)] = value
-				}
-			}
-
-			log.Printf("Extracted %d viewproof values", len(viewproofData))
-			return nil
-		}))
+		viewproofData = s.readViewProof(engine)
 	}
 
-	tasks = append(tasks,
-		chromedp.Sleep(time.Duration(urlConfig.Delay)*time.Millisecond),
-		chromedp.Evaluate(`window.scrollTo(0, document.body.scrollHeight)`, nil),
-		chromedp.Sleep(500*time.Millisecond),
-		chromedp.Evaluate(`window.scrollTo(0, 0)`, nil),
-		chromedp.Sleep(500*time.Millisecond),
-	)
-
-	tasks = append(tasks, chromedp.Sleep(1*time.Second))
-
-	tasks = append(tasks, chromedp.ActionFunc(func(ctx context.Context) error {
-		var metrics map[string]interface{}
-		if err := chromedp.Evaluate(`({
-			width: Math.max(document.body.scrollWidth, document.documentElement.scrollWidth),
-			height: Math.max(document.body.scrollHeight, document.documentElement.scrollHeight),
-		})`, &metrics).Do(ctx); err != nil {
-			return err
-		}
-
-		width := int64(viewport.Width)
-
-		height := int64(metrics["height"].(float64))
-		maxHeight := int64(16384)
-		if height > maxHeight {
-			log.Printf("Warning: Page height (%d) exceeds maximum allowed height (%d). Limiting height.",
-				height, maxHeight)
-			height = maxHeight
-		}
-
-		if err := emulation.SetDeviceMetricsOverride(width, height, 1, false).Do(ctx); err != nil {
-			return err
-		}
-
-		err := chromedp.CaptureScreenshot(&buf).Do(ctx)
-		if err != nil {
-			if height > 8192 {
-				log.Printf("Screenshot capture failed, trying with reduced height...")
-				if err := emulation.SetDeviceMetricsOverride(width, 8192, 1, false).Do(ctx); err != nil {
-					return err
-				}
-				return chromedp.CaptureScreenshot(&buf).Do(ctx)
-			}
-			return err
-		}
+	if err := s.preparePage(ctx, engine, urlConfig, viewport, nil); err != nil {
+		return "", err
+	}
 
-		if len(s.Config.ViewProof) > 0 && len(viewproofData) > 0 {
-			overlayText := fmt.Sprintf("VIEWPROOF DATA - %s", timestamp)
-			for key, value := range viewproofData {
-				overlayText += fmt.Sprintf("\n%s: %s", key, value)
-			}
+	if err := sleepContext(ctx, time.Second); err != nil {
+		return "", err
+	}
 
-			log.Printf("Adding ViewProof data as direct text overlay on image")
-			log.Printf("ViewProof data: %s", overlayText)
-		}
+	var buf []byte
+	truncation, err := s.captureFullHeight(ctx, engine, &buf)
+	if err != nil {
+		return "", err
+	}
 
-		return nil
-	}))
+	if len(viewproofData) > 0 {
+		overlayText := fmt.Sprintf("VIEWPROOF DATA - %s\n%s", timestamp, s.formatViewproofData(viewproofData))
 
-	if err := chromedp.Run(ctx, tasks...); err != nil {
-		return err
+		log.Printf("Adding ViewProof data as direct text overlay on image")
+		log.Printf("ViewProof data: %s", overlayText)
 	}
 
 	if err := os.WriteFile(filepath, buf, 0644); err != nil {
-		return err
+		return "", err
+	}
+
+	if truncation != nil {
+		if err := writeTruncationNotice(filepath, truncation); err != nil {
+			log.Printf("ERROR: Failed to write truncation notice for %s: %v", filepath, err)
+		}
 	}
 
 	log.Printf("Captured full page screenshot for %s at viewport %dx%d: %s", urlConfig.Name, viewport.Width, viewport.Height, filepath)
-	return nil
+	return filepath, nil
 }
 
-// captureViewportScreenshots captures screenshots divided by viewport
-func (s *Screenshoter) captureViewportScreenshots(ctx context.Context, urlConfig config.URLConfig, viewport config.Viewport, viewportDir string, captureViewports bool) error {
-	var pageHeight float64
+// captureViewportScreenshots captures screenshots divided by viewport, along with the screenshots taken by actions
+func (s *Screenshoter) captureViewportScreenshots(ctx context.Context, engine BrowserEngine, urlConfig config.URLConfig, viewport config.Viewport, viewportDir string, vm *ViewportManifest) error {
 	timestamp := time.Now().Format("20060102-150405")
 
-	var tasks []chromedp.Action
-
-	tasks = append(tasks, chromedp.Navigate(urlConfig.URL))
-	tasks = append(tasks, SaveCookiesToFile(ctx, urlConfig, "before-viewport", viewportDir, viewport, "viewport"))
-
-	if len(urlConfig.Cookies) > 0 || len(urlConfig.LocalStorage) > 0 {
-		tasks = append(tasks, s.setCookiesAndLocalStorage(ctx, urlConfig, viewport, viewportDir, "after-viewport", "viewport"))
-
-		// Add explicit refresh after setting cookies/localStorage to ensure they're applied
-		tasks = append(tasks, chromedp.ActionFunc(func(ctx context.Context) error {
-			log.Printf("Performing additional refresh to ensure cookies and localStorage are fully applied before viewport screenshots")
-			if err := chromedp.Reload().Do(ctx); err != nil {
-				return err
-			}
-			// Wait for page to reload and stabilize
-			return chromedp.Sleep(1 * time.Second).Do(ctx)
-		}))
+	if err := s.loadPage(ctx, engine, urlConfig, viewport, viewportDir, "-viewport", "viewport"); err != nil {
+		return err
 	}
 
-	tasks = append(tasks,
-		chromedp.Sleep(time.Duration(urlConfig.Delay)*time.Millisecond),
-		chromedp.Evaluate(`window.scrollTo(0, document.body.scrollHeight)`, nil),
-		chromedp.Sleep(500*time.Millisecond),
-		chromedp.Evaluate(`window.scrollTo(0, 0)`, nil),
-		chromedp.Sleep(500*time.Millisecond),
-	)
-
-	tasks = append(tasks, chromedp.Evaluate(`Math.max(document.body.scrollHeight, document.documentElement.scrollHeight)`, &pageHeight))
+	err := s.preparePage(ctx, engine, urlConfig, viewport, &actionCapture{
+		s:           s,
+		viewport:    viewport,
+		viewportDir: viewportDir,
+		timestamp:   timestamp,
+		vm:          vm,
+	})
+	if err != nil {
+		return err
+	}
 
-	if err := chromedp.Run(ctx, chromedp.Tasks(tasks)); err != nil {
+	var pageHeight float64
+	if err := engine.Evaluate(pageHeightScript, &pageHeight); err != nil {
 		return err
 	}
 
@@ -1071,23 +1289,11 @@ func (s *Screenshoter) captureViewportScreenshots(ctx context.Context, urlConfig
 		pageHeight, viewportHeight, viewportCount)
 
 	if pageHeight <= viewportHeight || viewportCount == 1 {
-		var buf []byte
 		filename := fmt.Sprintf("%s-viewport-%dx%d-1.%s", timestamp, viewport.Width, viewport.Height, s.Config.FileFormat)
 		filepath := filepath.Join(viewportDir, filename)
 
-		if err := chromedp.Run(ctx,
-			chromedp.Evaluate(`window.scrollTo(0, 0)`, nil),
-			chromedp.Sleep(300*time.Millisecond),
-
-			emulation.SetDeviceMetricsOverride(int64(viewport.Width), int64(viewport.Height), 1, false).
-				WithScreenOrientation(&emulation.ScreenOrientation{
-					Type:  emulation.OrientationTypePortraitPrimary,
-					Angle: 0,
-				}),
-
-			chromedp.Sleep(800*time.Millisecond),
-			chromedp.CaptureScreenshot(&buf),
-		); err != nil {
+		buf, _, err := s.captureSection(ctx, engine, viewport, 0)
+		if err != nil {
 			return err
 		}
 
@@ -1099,9 +1305,13 @@ func (s *Screenshoter) captureViewportScreenshots(ctx context.Context, urlConfig
 		return nil
 	}
 
+	if s.Config.SectionMode == "sequential" {
+		return s.captureSectionsInOrder(ctx, engine, urlConfig, viewport, viewportDir, timestamp, pageHeight, viewportCount)
+	}
+
 	var wg sync.WaitGroup
 	errChan := make(chan error, viewportCount)
-	vpSem := make(chan struct{}, 4) // Process up to 4 viewport sections in parallel
+	vpSem := make(chan struct{}, s.Config.SectionConcurrency) // Sections share the tab, so they race on the scroll position
 
 	for i := 0; i < viewportCount; i++ {
 		wg.Add(1)
@@ -1123,20 +1333,8 @@ func (s *Screenshoter) captureViewportScreenshots(ctx context.Context, urlConfig
 			filename := fmt.Sprintf("%s-viewport-%dx%d-%d.%s", timestamp, viewport.Width, viewport.Height, i+1, s.Config.FileFormat)
 			filepath := filepath.Join(viewportDir, filename)
 
-			var buf []byte
-			if err := chromedp.Run(ctx,
-				chromedp.Evaluate(fmt.Sprintf(`window.scrollTo({top: %f, left: 0, behavior: 'instant'})`, scrollPos), nil),
-				chromedp.Sleep(300*time.Millisecond),
-
-				emulation.SetDeviceMetricsOverride(int64(viewport.Width), int64(viewport.Height), 1, false).
-					WithScreenOrientation(&emulation.ScreenOrientation{
-						Type:  emulation.OrientationTypePortraitPrimary,
-						Angle: 0,
-					}),
-
-				chromedp.Sleep(800*time.Millisecond),
-				chromedp.CaptureScreenshot(&buf),
-			); err != nil {
+			buf, _, err := s.captureSection(ctx, engine, viewport, scrollPos)
+			if err != nil {
 				errChan <- err
 				return
 			}
@@ -1146,6 +1344,13 @@ func (s *Screenshoter) captureViewportScreenshots(ctx context.Context, urlConfig
 				return
 			}
 
+			// Mark the section's position on the page for reviewers of the individual images
+			if urlConfig.Minimap {
+				if err := addMinimap(filepath, s.Config.FileFormat, s.Config.Quality, scrollPos, viewportHeight, pageHeight); err != nil {
+					log.Printf("Warning: Failed to add minimap to %s: %v", filepath, err)
+				}
+			}
+
 			log.Printf("Captured viewport screenshot for %s: %s", urlConfig.Name, filepath)
 		}(i)
 	}
@@ -1160,6 +1365,75 @@ func (s *Screenshoter) captureViewportScreenshots(ctx context.Context, urlConfig
 	}
 }
 
+// captureSectionsInOrder captures the scroll sections one after another from the top. Each
+// section starts where the previous one ended; where the browser can't scroll that far, the
+// part already captured is cropped off, so sections are ordered and never overlap.
+func (s *Screenshoter) captureSectionsInOrder(ctx context.Context, engine BrowserEngine, urlConfig config.URLConfig, viewport config.Viewport, viewportDir, timestamp string, pageHeight float64, viewportCount int) error {
+	viewportHeight := float64(viewport.Height)
+	covered := 0.0
+
+	// Pages can shrink while sections are captured, so stop if scrolling no longer advances
+	for i := 0; covered < pageHeight && i < 2*viewportCount; i++ {
+		buf, scrollY, err := s.captureSection(ctx, engine, viewport, covered)
+		if err != nil {
+			return err
+		}
+
+		overlap := int(math.Round(covered - scrollY))
+		if overlap >= viewport.Height {
+			log.Printf("Warning: Page of %s ended at %.0fpx instead of %.0fpx, stopping after %d sections", urlConfig.Name, covered, pageHeight, i)
+			break
+		}
+		if overlap > 0 {
+			if buf, err = cropTop(buf, s.Config.FileFormat, s.Config.Quality, overlap); err != nil {
+				return fmt.Errorf("failed to crop section %d: %w", i+1, err)
+			}
+		}
+
+		filename := fmt.Sprintf("%s-viewport-%dx%d-%d.%s", timestamp, viewport.Width, viewport.Height, i+1, s.Config.FileFormat)
+		filepath := filepath.Join(viewportDir, filename)
+		if err := os.WriteFile(filepath, buf, 0644); err != nil {
+			return err
+		}
+
+		// Mark the section's position on the page for reviewers of the individual images
+		if urlConfig.Minimap {
+			if err := addMinimap(filepath, s.Config.FileFormat, s.Config.Quality, covered, viewportHeight-float64(max(overlap, 0)), pageHeight); err != nil {
+				log.Printf("Warning: Failed to add minimap to %s: %v", filepath, err)
+			}
+		}
+
+		log.Printf("Captured viewport screenshot for %s: %s", urlConfig.Name, filepath)
+		covered = scrollY + viewportHeight
+	}
+
+	return nil
+}
+
+// captureSection scrolls to a position and captures the viewport, returning the
+// screenshot and the scroll position the browser actually reached
+func (s *Screenshoter) captureSection(ctx context.Context, engine BrowserEngine, viewport config.Viewport, scrollPos float64) ([]byte, float64, error) {
+	if err := engine.Evaluate(scrollToScript, nil, scrollPos); err != nil {
+		return nil, 0, err
+	}
+	if err := sleepContext(ctx, 300*time.Millisecond); err != nil {
+		return nil, 0, err
+	}
+	if err := engine.SetViewportHeight(int64(viewport.Height)); err != nil {
+		return nil, 0, err
+	}
+	if err := sleepContext(ctx, 800*time.Millisecond); err != nil {
+		return nil, 0, err
+	}
+
+	var scrollY float64
+	if err := engine.Evaluate(`return window.scrollY`, &scrollY); err != nil {
+		return nil, 0, err
+	}
+	buf, err := engine.Screenshot(s.Config.FileFormat, s.Config.Quality)
+	return buf, scrollY, err
+}
+
 // extractDomainFromURL extracts a domain name from a URL for cookie setting
 func extractDomainFromURL(url string) string {
 	if strings.HasPrefix(url, "http://") {
@@ -1183,10 +1457,14 @@ func extractDomainFromURL(url string) string {
 	return url
 }
 
-// formatViewproofData formats viewproof data for display in the ViewProof block
-func formatViewproofData(data map[string]string) string {
+// formatViewproofData formats viewproof data for display in the ViewProof block, with
+// cookie values redacted like in the logs
+func (s *Screenshoter) formatViewproofData(data map[string]string) string {
 	var formattedData strings.Builder
 	for key, value := range data {
+		if name, ok := strings.CutPrefix(key, "cookie:"); ok {
+			value = s.cookieLogValue(name, value)
+		}
 		formattedData.WriteString(fmt.Sprintf("%s: %s\n", key, value))
 	}
 	return formattedData.String()
@@ -1205,7 +1483,10 @@ func escapeJSString(s string) string {
 
 // createViewProof creates JavaScript code to inject a ViewProof overlay/block
 func (s *Screenshoter) createViewProof(viewproofData map[string]string, forceful bool, separateCSS bool) (string, string) {
-	formattedData := formatViewproofData(viewproofData)
+	formattedData := s.formatViewproofData(viewproofData)
+	if s.Config.Label != "" {
+		formattedData = fmt.Sprintf("run: %s\n%s", s.Config.Label, formattedData)
+	}
 
 	elementID := "viewproof-block"
 	if forceful {
@@ -1388,36 +1669,140 @@ func (s *Screenshoter) createViewProof(viewproofData map[string]string, forceful
 	return script, css
 }
 
-// CaptureURLs captures screenshots for all URLs in configuration
+// indexedURL is a URL with its 1-based position in the configuration
+type indexedURL struct {
+	index int
+	config.URLConfig
+}
+
+// CaptureURLs captures screenshots for all URLs in configuration. URLs are
+// grouped by Chrome backend and each group runs to completion before the
+// next starts, so the backends aren't switched back and forth. Results are
+// kept by configuration position, so output numbering and the order of the
+// reported errors don't depend on which capture finishes first. The returned
+// error joins the errors of all failed URLs.
 func (s *Screenshoter) CaptureURLs(ctx context.Context) error {
+	results := make([]error, len(s.Config.URLs))
+
+	for _, group := range s.groupByChromeMode() {
+		mode := s.chromeMode(group[0].URLConfig)
+		log.Printf("Capturing %d URLs with Chrome mode %s", len(group), mode)
+		release := s.shareBrowser(mode, group)
+		s.captureGroup(ctx, group, results)
+		release()
+	}
+
+	if err := s.stats.save(s.Config.OutputDir); err != nil {
+		log.Printf("Warning: Failed to save capture size history: %v", err)
+	}
+
+	if err := s.quarantine.save(s.Config.OutputDir); err != nil {
+		log.Printf("Warning: Failed to save quarantine list: %v", err)
+	}
+	s.writeQuarantineReport()
+	s.logBandwidth()
+
+	return errors.Join(results...)
+}
+
+// shareBrowser launches a standby browser for the URLs of a group that can share one and
+// returns a function that shuts it down. Nothing is launched if the screenshoter already
+// uses a standby browser, separateBrowsers is set or captures run on a Selenium Grid. If
+// the launch fails, the URLs launch their own browsers.
+func (s *Screenshoter) shareBrowser(mode string, group []indexedURL) func() {
+	if s.standby != nil || s.Config.SeparateBrowsers || s.Config.Backend == "webdriver" || UsesDockerPool(s.Config, mode) {
+		return func() {}
+	}
+	shareable := false
+	for _, u := range group {
+		if !needsLocalChrome(u.URLConfig) && u.Browser != "firefox" {
+			shareable = true
+			break
+		}
+	}
+	if !shareable {
+		return func() {}
+	}
+
+	sb, err := StartStandby(mode, s.Config.ChromeFlags)
+	if err != nil {
+		log.Printf("Warning: Failed to start a shared browser, launching one per viewport: %v", err)
+		return func() {}
+	}
+	if s.Config.TabPool != nil {
+		sb.PoolTabs(s.Config.TabPool)
+	}
+	s.standby = sb
+	return func() {
+		s.standby = nil
+		sb.Close()
+	}
+}
+
+// groupByChromeMode splits the URLs by Chrome backend, keeping the configured
+// order within each group and ordering groups by their first URL
+func (s *Screenshoter) groupByChromeMode() [][]indexedURL {
+	var groups [][]indexedURL
+	index := make(map[string]int)
+
+	for i, urlConfig := range s.Config.URLs {
+		if !s.inShard(i) {
+			continue
+		}
+		mode := s.chromeMode(urlConfig)
+		g, exists := index[mode]
+		if !exists {
+			g = len(groups)
+			index[mode] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], indexedURL{index: i + 1, URLConfig: urlConfig})
+	}
+
+	return groups
+}
+
+// inShard reports whether the URL at a 0-based configuration position belongs to the
+// shard captured by this worker. URLs are dealt out to the shards in turn, so slow pages
+// that are configured together end up on different workers.
+func (s *Screenshoter) inShard(i int) bool {
+	return s.Config.Shards == 0 || i%s.Config.Shards == s.Config.Shard
+}
+
+// captureGroup captures a group of URLs concurrently and waits for all of them to finish.
+// Each URL's error is stored in results at its configuration position.
+func (s *Screenshoter) captureGroup(ctx context.Context, urls []indexedURL, results []error) {
 	sem := make(chan struct{}, s.Config.Concurrency)
-	errChan := make(chan error, len(s.Config.URLs))
-	doneChan := make(chan struct{}, len(s.Config.URLs))
+	var wg sync.WaitGroup
 
-	for _, urlConfig := range s.Config.URLs {
-		urlConfig := urlConfig // Create local copy for goroutine
+	for _, u := range urls {
+		u := u // Create local copy for goroutine
 		sem <- struct{}{}
+		wg.Add(1)
 
 		go func() {
 			defer func() {
 				<-sem
-				doneChan <- struct{}{}
+				wg.Done()
 			}()
 
-			if err := s.CaptureURL(ctx, urlConfig); err != nil {
-				errChan <- fmt.Errorf("error capturing URL %s: %w", urlConfig.Name, err)
+			urlConfig := u.URLConfig
+			urlDir, manifest, err := s.captureURL(ctx, u.index, urlConfig)
+
+			// Failures of quarantined URLs are reported but don't fail the run
+			quarantined := s.quarantine.record(urlConfig, s.Config.Quarantine, err)
+			s.recordResult(u.index, urlConfig, urlDir, manifest, err, quarantined)
+			if quarantined {
+				if err != nil {
+					log.Printf("Quarantined URL %s failed, not counted as a failure: %v", urlConfig.Name, err)
+				}
+				return
+			}
+			if err != nil {
+				results[u.index-1] = fmt.Errorf("error capturing URL %s: %w", urlConfig.Name, err)
 			}
 		}()
 	}
 
-	for i := 0; i < len(s.Config.URLs); i++ {
-		<-doneChan
-	}
-
-	select {
-	case err := <-errChan:
-		return err
-	default:
-		return nil
-	}
+	wg.Wait()
 }
@@ -0,0 +1,80 @@
+package screenshot
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"screenshot-tool/config"
+
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+)
+
+// scrollRecordingSettle is how long the page rests at the top and bottom of the recording
+const scrollRecordingSettle = 500 * time.Millisecond
+
+// smoothScrollScript scrolls from the top to the bottom of the page over the given milliseconds,
+// easing in and out so parallax and scroll-triggered animations play as they do for a reader
+const smoothScrollScript = `((duration) => new Promise((resolve) => {
+	const end = Math.max(document.body.scrollHeight, document.documentElement.scrollHeight) - window.innerHeight;
+	const start = performance.now();
+	const step = (now) => {
+		const t = Math.min(1, (now - start) / duration);
+		const eased = t < 0.5 ? 2 * t * t : 1 - Math.pow(-2 * t + 2, 2) / 2;
+		window.scrollTo({top: end * eased, left: 0, behavior: 'instant'});
+		if (t < 1) {
+			requestAnimationFrame(step);
+		} else {
+			resolve(end);
+		}
+	};
+	requestAnimationFrame(step);
+}))(%d)`
+
+// recordScroll records the page scrolling smoothly from top to bottom using the browser's
+// screencast and writes it as an animated GIF or WebM. It takes its frames from the session
+// video if one is being recorded, as the browser runs one screencast per page. It returns the file name.
+func (s *Screenshoter) recordScroll(ctx context.Context, rec *config.ScrollRecording, session *screencast, urlConfig config.URLConfig, viewport config.Viewport, viewportDir string) (string, error) {
+	// The full page capture resized the viewport to the page height
+	if err := chromedp.Run(ctx,
+		deviceMetrics(viewport, int64(viewport.Height)),
+		chromedp.Evaluate(`window.scrollTo({top: 0, left: 0, behavior: 'instant'})`, nil),
+		chromedp.Sleep(scrollRecordingSettle),
+	); err != nil {
+		return "", err
+	}
+
+	sc := session
+	if sc == nil {
+		var err error
+		if sc, err = startScreencast(ctx, rec.MaxWidth, rec.MaxWidth*viewport.Height/viewport.Width); err != nil {
+			return "", err
+		}
+	}
+
+	start := time.Now()
+	err := chromedp.Run(ctx,
+		chromedp.Sleep(scrollRecordingSettle),
+		chromedp.Evaluate(fmt.Sprintf(smoothScrollScript, rec.Duration), nil, func(p *runtime.EvaluateParams) *runtime.EvaluateParams {
+			return p.WithAwaitPromise(true)
+		}),
+		chromedp.Sleep(scrollRecordingSettle),
+	)
+	end := time.Now()
+	if session == nil {
+		if finishErr := sc.finish(ctx); err == nil {
+			err = finishErr
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	name := fmt.Sprintf("%s-scroll-%dx%d.%s", SanitizeFilename(urlConfig.Name), viewport.Width, viewport.Height, rec.Format)
+	if err := sc.writeAnimation(ctx, filepath.Join(viewportDir, name), rec.Format, sc.sample(start, end, rec.FPS), rec.FPS); err != nil {
+		return "", err
+	}
+	return name, nil
+}
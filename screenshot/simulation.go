@@ -0,0 +1,91 @@
+package screenshot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+
+	"screenshot-tool/config"
+)
+
+// SimulationStep is a single randomized user action
+type SimulationStep struct {
+	Action     string  `json:"action"`               // "mouseMove", "scroll" or "dwell"
+	X          float64 `json:"x,omitempty"`          // Mouse X as a fraction of the viewport width
+	Y          float64 `json:"y,omitempty"`          // Mouse Y as a fraction of the viewport height
+	Depth      float64 `json:"depth,omitempty"`      // Scroll depth as a fraction of the scrollable height
+	DurationMs int     `json:"durationMs,omitempty"` // Dwell time in milliseconds
+}
+
+// SimulationPlan is the reproducible sequence of user actions generated from a seed
+type SimulationPlan struct {
+	Seed  int64            `json:"seed"`
+	Steps []SimulationStep `json:"steps"`
+}
+
+// planUserSimulation generates the user actions for a simulation. The plan only
+// depends on the settings, so every capture of a URL replays the same session.
+func planUserSimulation(sim *config.UserSimulation) *SimulationPlan {
+	rng := rand.New(rand.NewSource(sim.Seed))
+	plan := &SimulationPlan{Seed: sim.Seed}
+
+	for i := 0; i < sim.Steps; i++ {
+		for j := 0; j < sim.MouseMoves; j++ {
+			plan.Steps = append(plan.Steps, SimulationStep{
+				Action: "mouseMove",
+				X:      rng.Float64(),
+				Y:      rng.Float64(),
+			})
+		}
+
+		plan.Steps = append(plan.Steps, SimulationStep{
+			Action: "scroll",
+			Depth:  rng.Float64(),
+		})
+
+		dwell := sim.MinDwell
+		if sim.MaxDwell > sim.MinDwell {
+			dwell += rng.Intn(sim.MaxDwell - sim.MinDwell + 1)
+		}
+		plan.Steps = append(plan.Steps, SimulationStep{
+			Action:     "dwell",
+			DurationMs: dwell,
+		})
+	}
+
+	return plan
+}
+
+// simulateUser performs the planned user actions on the current page
+func simulateUser(ctx context.Context, engine BrowserEngine, plan *SimulationPlan, viewport config.Viewport) error {
+	log.Printf("Simulating user session with seed %d (%d steps)", plan.Seed, len(plan.Steps))
+
+	for _, step := range plan.Steps {
+		switch step.Action {
+		case "mouseMove":
+			x := step.X * float64(viewport.Width)
+			y := step.Y * float64(viewport.Height)
+			if err := engine.MoveMouse(x, y); err != nil {
+				return fmt.Errorf("failed to move mouse: %w", err)
+			}
+			if err := sleepContext(ctx, 50*time.Millisecond); err != nil {
+				return err
+			}
+
+		case "scroll":
+			script := `window.scrollTo({top: arguments[0] * Math.max(0, document.documentElement.scrollHeight - window.innerHeight), left: 0, behavior: 'smooth'})`
+			if err := engine.Evaluate(script, nil, step.Depth); err != nil {
+				return fmt.Errorf("failed to scroll: %w", err)
+			}
+
+		case "dwell":
+			if err := sleepContext(ctx, time.Duration(step.DurationMs)*time.Millisecond); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,347 @@
+package screenshot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/browser"
+	"github.com/chromedp/cdproto/emulation"
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/cdproto/storage"
+	"github.com/chromedp/chromedp"
+
+	"screenshot-tool/config"
+)
+
+// Health check settings for the standby browser
+const (
+	standbyCheckInterval = 30 * time.Second
+	standbyCheckTimeout  = 5 * time.Second
+	tabResetTimeout      = 10 * time.Second
+)
+
+// Standby keeps a launched and health-checked browser ready so that captures open
+// a tab in it instead of paying the Chrome or Docker startup cost. It backs the serve
+// command and is shared by the URLs of a run.
+type Standby struct {
+	mode  string
+	flags []string // Chrome flags added to every launch
+
+	relaunchMu sync.Mutex // Serializes relaunches by the health check and by captures that lost the browser
+	mu         sync.Mutex
+	browserCtx context.Context
+	cancel     context.CancelFunc
+	lastErr    error
+	pool       *config.TabPool // Reuse tabs across captures if set
+	idle       []*pooledTab
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// StartStandby launches the standby browser with the given Chrome flags and keeps it
+// healthy until Close is called
+func StartStandby(mode string, flags []string) (*Standby, error) {
+	sb := &Standby{
+		mode:  mode,
+		flags: flags,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+
+	if err := sb.launch(); err != nil {
+		return nil, err
+	}
+
+	go sb.monitor()
+	return sb, nil
+}
+
+// launch starts a new browser, replacing the current one
+func (sb *Standby) launch() error {
+	start := time.Now()
+
+	var allocCtx context.Context
+	var cancelAlloc context.CancelFunc
+
+	opts := append(chromedp.DefaultExecAllocatorOptions[:],
+		chromedp.DisableGPU,
+		chromedp.NoSandbox,
+		chromedp.Headless,
+		chromedp.Flag("ignore-certificate-errors", true),
+	)
+	opts = append(opts, chromeFlagOptions(sb.flags)...)
+
+	// Use the same backend selection as regular captures
+	execPath, localErr := findChromeExecutable()
+	switch {
+	case sb.mode != "docker" && localErr == nil:
+		log.Printf("Launching standby browser with local Chrome at: %s", execPath)
+		opts = append(opts, chromedp.ExecPath(execPath))
+		allocCtx, cancelAlloc = chromedp.NewExecAllocator(context.Background(), opts...)
+
+	case sb.mode == "local":
+		return fmt.Errorf("local Chrome mode specified but Chrome executable not found: %v", localErr)
+
+	default:
+		dockerURL, err := startDockerChrome(sb.flags)
+		if err != nil {
+			return fmt.Errorf("failed to start Docker Chrome for standby browser: %w", err)
+		}
+		log.Printf("Connecting standby browser to Docker Chrome at: %s", dockerURL)
+		allocCtx, cancelAlloc = chromedp.NewRemoteAllocator(context.Background(), dockerURL)
+	}
+
+	browserCtx, cancelBrowser := chromedp.NewContext(allocCtx, chromedp.WithLogf(log.Printf))
+	cancel := func() {
+		cancelBrowser()
+		cancelAlloc()
+	}
+
+	// Running without actions starts the browser
+	if err := chromedp.Run(browserCtx); err != nil {
+		cancel()
+		return fmt.Errorf("failed to start standby browser: %w", err)
+	}
+
+	sb.mu.Lock()
+	old := sb.cancel
+	sb.browserCtx, sb.cancel, sb.lastErr = browserCtx, cancel, nil
+	idle := sb.idle
+	sb.idle = nil
+	sb.mu.Unlock()
+
+	// Pooled tabs belong to the replaced browser
+	for _, tab := range idle {
+		tab.cancel()
+	}
+	if old != nil {
+		old()
+	}
+
+	log.Printf("Standby browser ready in %v", time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// check verifies that the browser still responds
+func (sb *Standby) check() error {
+	sb.mu.Lock()
+	browserCtx := sb.browserCtx
+	sb.mu.Unlock()
+
+	if browserCtx == nil {
+		return fmt.Errorf("standby browser is not running")
+	}
+
+	checkCtx, cancel := context.WithTimeout(browserCtx, standbyCheckTimeout)
+	defer cancel()
+
+	return chromedp.Run(checkCtx, chromedp.ActionFunc(func(ctx context.Context) error {
+		_, _, _, _, _, err := browser.GetVersion().Do(ctx)
+		return err
+	}))
+}
+
+// monitor periodically checks the browser and relaunches it if it stopped responding
+func (sb *Standby) monitor() {
+	defer close(sb.done)
+
+	ticker := time.NewTicker(standbyCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-sb.stop:
+			return
+		case <-ticker.C:
+		}
+
+		sb.recover("failed health check")
+	}
+}
+
+// recover relaunches the browser if it stopped responding. Captures call it when
+// opening a tab fails, so a crashed browser is replaced without waiting for the health check.
+func (sb *Standby) recover(reason string) {
+	sb.relaunchMu.Lock()
+	defer sb.relaunchMu.Unlock()
+
+	// Another caller may have relaunched it already
+	err := sb.check()
+	if err == nil {
+		return
+	}
+
+	log.Printf("Standby browser %s, relaunching: %v", reason, err)
+	if err := sb.launch(); err != nil {
+		log.Printf("ERROR: Failed to relaunch standby browser: %v", err)
+		sb.mu.Lock()
+		sb.lastErr = err
+		sb.mu.Unlock()
+	}
+}
+
+// Healthy reports whether the standby browser is ready for captures
+func (sb *Standby) Healthy() error {
+	sb.mu.Lock()
+	lastErr := sb.lastErr
+	sb.mu.Unlock()
+
+	if lastErr != nil {
+		return lastErr
+	}
+	return sb.check()
+}
+
+// pooledTab is a tab of the standby browser that is reused across captures
+type pooledTab struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	browser context.Context // Browser the tab was opened in
+	uses    int
+
+	mu      sync.Mutex
+	origins map[string]bool // Origins loaded since the last reset, whose storage is cleared
+}
+
+// PoolTabs makes the standby browser reuse tabs across captures instead of opening
+// a new one for each. Tabs are reset between captures as configured by pool.
+func (sb *Standby) PoolTabs(pool *config.TabPool) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	sb.pool = pool
+}
+
+// newTab opens a tab with the given viewport in the standby browser, or takes one from the
+// pool. Each tab gets its own browser context, so captures in different tabs don't see each
+// other's cookies, storage or cache. The returned cancel function closes the tab or resets
+// it and returns it to the pool.
+func (sb *Standby) newTab(width, height int) (context.Context, context.CancelFunc, error) {
+	sb.mu.Lock()
+	if sb.browserCtx == nil || sb.lastErr != nil {
+		err := sb.lastErr
+		sb.mu.Unlock()
+		return nil, nil, fmt.Errorf("standby browser is not available: %v", err)
+	}
+	if sb.pool == nil || !sb.pool.Enabled {
+		tabCtx, cancel := chromedp.NewContext(sb.browserCtx, chromedp.WithNewBrowserContext())
+		sb.mu.Unlock()
+
+		if err := chromedp.Run(tabCtx, chromedp.EmulateViewport(int64(width), int64(height))); err != nil {
+			cancel()
+			return nil, nil, err
+		}
+		return tabCtx, cancel, nil
+	}
+
+	var tab *pooledTab
+	if n := len(sb.idle); n > 0 {
+		tab = sb.idle[n-1]
+		sb.idle = sb.idle[:n-1]
+	} else {
+		tabCtx, cancel := chromedp.NewContext(sb.browserCtx, chromedp.WithNewBrowserContext())
+		tab = &pooledTab{ctx: tabCtx, cancel: cancel, browser: sb.browserCtx, origins: make(map[string]bool)}
+	}
+	sb.mu.Unlock()
+
+	// Listeners of a capture are registered on the lease and removed when it ends
+	leaseCtx, endLease := context.WithCancel(tab.ctx)
+	if err := chromedp.Run(leaseCtx, chromedp.EmulateViewport(int64(width), int64(height))); err != nil {
+		endLease()
+		tab.cancel()
+		return nil, nil, err
+	}
+	chromedp.ListenTarget(leaseCtx, func(ev any) {
+		if e, ok := ev.(*page.EventFrameNavigated); ok && e.Frame.SecurityOrigin != "" {
+			tab.mu.Lock()
+			tab.origins[e.Frame.SecurityOrigin] = true
+			tab.mu.Unlock()
+		}
+	})
+
+	return leaseCtx, func() {
+		endLease()
+		sb.release(tab)
+	}, nil
+}
+
+// release resets a tab after a capture and returns it to the pool. Tabs that reached
+// their maximum uses, belong to a replaced browser or can't be reset are closed.
+func (sb *Standby) release(tab *pooledTab) {
+	tab.uses++
+
+	sb.mu.Lock()
+	pool, current := sb.pool, sb.browserCtx
+	sb.mu.Unlock()
+
+	if tab.browser != current || tab.uses >= pool.MaxUses {
+		tab.cancel()
+		return
+	}
+	if err := tab.reset(pool.KeepState); err != nil {
+		log.Printf("Warning: Failed to reset pooled tab, closing it: %v", err)
+		tab.cancel()
+		return
+	}
+
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	if tab.browser != sb.browserCtx {
+		tab.cancel()
+		return
+	}
+	sb.idle = append(sb.idle, tab)
+}
+
+// reset undoes what a capture changed in a tab: request interception, emulation and the
+// loaded page, and unless keepState is set, cookies, cache and the storage of loaded origins
+func (t *pooledTab) reset(keepState bool) error {
+	ctx, cancel := context.WithTimeout(t.ctx, tabResetTimeout)
+	defer cancel()
+
+	tasks := chromedp.Tasks{
+		fetch.Disable(),
+		emulation.ClearDeviceMetricsOverride(),
+		emulation.SetTouchEmulationEnabled(false),
+		emulation.SetEmulatedMedia(),
+		emulation.SetTimezoneOverride(""),
+		clearGeolocation(),
+		network.EmulateNetworkConditions(false, 0, -1, -1),
+		chromedp.Navigate("about:blank"),
+	}
+	if !keepState {
+		tasks = append(tasks, network.ClearBrowserCookies(), network.ClearBrowserCache())
+
+		t.mu.Lock()
+		for origin := range t.origins {
+			tasks = append(tasks, storage.ClearDataForOrigin(origin, "all"))
+		}
+		t.origins = make(map[string]bool)
+		t.mu.Unlock()
+	}
+
+	return chromedp.Run(ctx, tasks)
+}
+
+// Close stops the health checks and shuts the browser down
+func (sb *Standby) Close() {
+	close(sb.stop)
+	<-sb.done
+
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	for _, tab := range sb.idle {
+		tab.cancel()
+	}
+	sb.idle = nil
+	if sb.cancel != nil {
+		sb.cancel()
+		sb.browserCtx, sb.cancel = nil, nil
+	}
+}
@@ -0,0 +1,158 @@
+package screenshot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"screenshot-tool/config"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/storage"
+	"github.com/chromedp/chromedp"
+)
+
+// StorageState is a snapshot of browser cookies and localStorage that can be
+// saved to a file and imported into later runs, similar to Playwright's storageState
+type StorageState struct {
+	Cookies []*network.Cookie `json:"cookies"`
+	Origins []OriginStorage   `json:"origins"`
+}
+
+// OriginStorage holds the localStorage items of a single origin
+type OriginStorage struct {
+	Origin       string                `json:"origin"`
+	LocalStorage []config.LocalStorage `json:"localStorage"`
+}
+
+// loadStorageState reads a storage state file and drops cookies that have expired since it was saved
+func loadStorageState(path string) (*StorageState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var state StorageState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse storage state %s: %w", path, err)
+	}
+
+	now := float64(time.Now().Unix())
+	valid := state.Cookies[:0]
+	for _, cookie := range state.Cookies {
+		if cookie.Session || cookie.Expires > now {
+			valid = append(valid, cookie)
+		}
+	}
+	state.Cookies = valid
+
+	return &state, nil
+}
+
+// saveStorageState writes a storage state file, readable only by the owner since it holds session credentials
+func saveStorageState(path string, state *StorageState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode storage state: %w", err)
+	}
+
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+
+	return os.WriteFile(path, data, 0600)
+}
+
+// captureStorageState collects all browser cookies and the localStorage of the current page's origin
+func captureStorageState(state *StorageState) chromedp.ActionFunc {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		cookies, err := storage.GetCookies().Do(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get cookies: %w", err)
+		}
+		state.Cookies = cookies
+
+		var origin string
+		if err := chromedp.Evaluate(`window.location.origin`, &origin).Do(ctx); err != nil {
+			return fmt.Errorf("failed to get page origin: %w", err)
+		}
+
+		var items []config.LocalStorage
+		if err := chromedp.Evaluate(`Object.keys(localStorage).map(k => ({key: k, value: localStorage.getItem(k)}))`, &items).Do(ctx); err != nil {
+			return fmt.Errorf("failed to read localStorage: %w", err)
+		}
+
+		if origin != "" && origin != "null" && len(items) > 0 {
+			state.Origins = append(state.Origins, OriginStorage{Origin: origin, LocalStorage: items})
+		}
+
+		return nil
+	})
+}
+
+// applyStorageState imports the state's cookies into the browser and merges the
+// localStorage for the URL's origin into its configuration. Items configured on
+// the URL take precedence over imported ones.
+func applyStorageState(browserCtx context.Context, state *StorageState, urlConfig *config.URLConfig) error {
+	params := make([]*network.CookieParam, 0, len(state.Cookies))
+	for _, cookie := range state.Cookies {
+		param := &network.CookieParam{
+			Name:     cookie.Name,
+			Value:    cookie.Value,
+			Domain:   cookie.Domain,
+			Path:     cookie.Path,
+			Secure:   cookie.Secure,
+			HTTPOnly: cookie.HTTPOnly,
+			SameSite: cookie.SameSite,
+		}
+		if !cookie.Session {
+			expires := cdp.TimeSinceEpoch(time.Unix(int64(cookie.Expires), 0))
+			param.Expires = &expires
+		}
+		params = append(params, param)
+	}
+
+	if len(params) > 0 {
+		if err := chromedp.Run(browserCtx, storage.SetCookies(params)); err != nil {
+			return fmt.Errorf("failed to import cookies: %w", err)
+		}
+	}
+
+	parsed, err := url.Parse(urlConfig.URL)
+	if err != nil {
+		return nil
+	}
+	origin := parsed.Scheme + "://" + parsed.Host
+
+	// Copy before appending, the slice is shared with the URL's other viewports
+	urlConfig.LocalStorage = append([]config.LocalStorage{}, urlConfig.LocalStorage...)
+
+	existing := make(map[string]bool)
+	for _, item := range urlConfig.LocalStorage {
+		existing[item.Key] = true
+	}
+
+	imported := 0
+	for _, originStorage := range state.Origins {
+		if originStorage.Origin != origin {
+			continue
+		}
+		for _, item := range originStorage.LocalStorage {
+			if !existing[item.Key] {
+				urlConfig.LocalStorage = append(urlConfig.LocalStorage, item)
+				imported++
+			}
+		}
+	}
+
+	log.Printf("Imported %d cookies and %d localStorage items into %s", len(params), imported, urlConfig.Name)
+	return nil
+}
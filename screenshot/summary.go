@@ -0,0 +1,139 @@
+package screenshot
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"screenshot-tool/config"
+)
+
+// URLResult is the outcome of capturing a URL in a run
+type URLResult struct {
+	Index       int    `json:"index,omitempty"` // 1-based position of the URL in the configuration
+	Name        string `json:"name"`
+	URL         string `json:"url"`
+	Status      string `json:"status"` // "passed", "failed", "mismatch" or "quarantined"
+	Error       string `json:"error,omitempty"`
+	Dir         string `json:"dir"`                   // URL directory, relative to the output directory
+	Manifest    string `json:"manifest"`              // manifest.json, relative to the output directory
+	ManifestURL string `json:"manifestUrl,omitempty"` // Location of the uploaded manifest, set by the caller
+	Failure     string `json:"failure,omitempty"`     // failure.json, relative to the output directory
+
+	BytesDownloaded int64 `json:"bytesDownloaded"` // Bytes the browser downloaded
+	ArtifactBytes   int64 `json:"artifactBytes"`   // Size of the URL's artifacts
+}
+
+// RunSummary describes the outcome of a run
+type RunSummary struct {
+	Run         string    `json:"run"`                // Label of the run, e.g. the schedule it belongs to
+	Label       string    `json:"label,omitempty"`    // Label given with -label, e.g. a release or ticket
+	Kind        string    `json:"kind"`               // "capture", "watch", "schedule", "trigger" or "deployment", set by the caller
+	Schedule    string    `json:"schedule,omitempty"` // Schedule of a scheduled run, set by the caller
+	Trigger     string    `json:"trigger,omitempty"`  // Webhook trigger of a triggered run, set by the caller
+	Status      string    `json:"status"`             // "passed" or "failed"
+	Error       string    `json:"error,omitempty"`
+	OutputDir   string    `json:"outputDir"`
+	StartedAt   time.Time `json:"startedAt"`
+	FinishedAt  time.Time `json:"finishedAt"`
+	Total       int       `json:"total"`       // URLs in the run
+	Passed      int       `json:"passed"`      // URLs captured without errors
+	Failed      int       `json:"failed"`      // URLs that failed or mismatched their baseline
+	Quarantined int       `json:"quarantined"` // Failed quarantined URLs, which don't fail the run
+
+	BytesDownloaded int64         `json:"bytesDownloaded"` // Bytes the browser downloaded for all URLs
+	ArtifactBytes   int64         `json:"artifactBytes"`   // Size of the artifacts of all URLs
+	Cost            *CostEstimate `json:"cost,omitempty"`  // Estimated cost, if prices are configured
+
+	URLs []URLResult `json:"urls"` // Captured URLs in configuration order
+}
+
+// recordResult adds the outcome of a URL capture to the run summary
+func (s *Screenshoter) recordResult(index int, urlConfig config.URLConfig, urlDir string, manifest *Manifest, captureErr error, quarantined bool) {
+	result := URLResult{
+		Index:  index,
+		Name:   urlConfig.Name,
+		URL:    urlConfig.URL,
+		Status: "passed",
+	}
+
+	if urlDir != "" {
+		dir, err := filepath.Rel(s.Config.OutputDir, urlDir)
+		if err != nil {
+			dir = urlDir
+		}
+		result.Dir = filepath.ToSlash(dir)
+		result.Manifest = result.Dir + "/manifest.json"
+		if _, err := os.Stat(filepath.Join(urlDir, "failure.json")); err == nil {
+			result.Failure = result.Dir + "/failure.json"
+		}
+	}
+
+	if manifest != nil {
+		result.BytesDownloaded = manifest.BytesDownloaded
+		result.ArtifactBytes = manifest.ArtifactBytes
+	}
+
+	switch {
+	case captureErr != nil && quarantined:
+		result.Status = "quarantined"
+	case isMismatch(captureErr):
+		result.Status = "mismatch"
+	case captureErr != nil:
+		result.Status = "failed"
+	}
+	if captureErr != nil {
+		result.Error = captureErr.Error()
+	}
+
+	s.resultsMu.Lock()
+	defer s.resultsMu.Unlock()
+	s.results = append(s.results, result)
+}
+
+// Summary describes the run so far. runErr is the error that ended the run, if any.
+func (s *Screenshoter) Summary(label string, startedAt time.Time, runErr error) *RunSummary {
+	s.resultsMu.Lock()
+	results := append([]URLResult(nil), s.results...)
+	s.resultsMu.Unlock()
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Index < results[j].Index })
+
+	summary := &RunSummary{
+		Run:        label,
+		Label:      s.Config.Label,
+		Status:     "passed",
+		OutputDir:  s.Config.OutputDir,
+		StartedAt:  startedAt,
+		FinishedAt: time.Now(),
+		URLs:       results,
+	}
+	for i := range s.Config.URLs {
+		if s.inShard(i) {
+			summary.Total++
+		}
+	}
+	for _, result := range results {
+		summary.BytesDownloaded += result.BytesDownloaded
+		summary.ArtifactBytes += result.ArtifactBytes
+
+		switch result.Status {
+		case "passed":
+			summary.Passed++
+		case "quarantined":
+			summary.Quarantined++
+		default:
+			summary.Failed++
+		}
+	}
+	if s.Config.Costs != nil {
+		summary.Cost = estimateCost(s.Config.Costs, summary.BytesDownloaded, summary.ArtifactBytes)
+	}
+	if runErr != nil {
+		summary.Status = "failed"
+		summary.Error = runErr.Error()
+	}
+
+	return summary
+}
@@ -0,0 +1,29 @@
+package screenshot
+
+import (
+	"context"
+
+	"screenshot-tool/config"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+)
+
+// throttleNetwork applies network throttling to the page. A bandwidth of 0 isn't limited.
+func throttleNetwork(throttling *config.Throttling) chromedp.ActionFunc {
+	return func(ctx context.Context) error {
+		if err := network.Enable().Do(ctx); err != nil {
+			return err
+		}
+		return network.EmulateNetworkConditions(false, float64(throttling.Latency),
+			kbitToBytes(throttling.Download), kbitToBytes(throttling.Upload)).Do(ctx)
+	}
+}
+
+// kbitToBytes converts a bandwidth in kbit/s to the bytes per second Chrome expects, -1 disables the limit
+func kbitToBytes(kbit int) float64 {
+	if kbit == 0 {
+		return -1
+	}
+	return float64(kbit) * 1000 / 8
+}
@@ -0,0 +1,117 @@
+package screenshot
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/tracing"
+	"github.com/chromedp/chromedp"
+)
+
+// traceCategories are the categories recorded by the DevTools Performance panel
+var traceCategories = []string{
+	"-*",
+	"devtools.timeline",
+	"disabled-by-default-devtools.timeline",
+	"disabled-by-default-devtools.timeline.frame",
+	"disabled-by-default-devtools.timeline.stack",
+	"disabled-by-default-devtools.screenshot",
+	"disabled-by-default-v8.cpu_profiler",
+	"toplevel",
+	"blink.console",
+	"blink.user_timing",
+	"latencyInfo",
+	"loading",
+	"v8.execute",
+}
+
+// traceRecorder collects the events of a DevTools performance trace
+type traceRecorder struct {
+	mu       sync.Mutex
+	events   []json.RawMessage
+	dataLoss bool
+	complete chan struct{}
+}
+
+// startTrace starts recording a performance trace of the browser context
+func startTrace(browserCtx context.Context) (*traceRecorder, error) {
+	rec := &traceRecorder{complete: make(chan struct{})}
+
+	chromedp.ListenTarget(browserCtx, func(ev any) {
+		switch e := ev.(type) {
+		case *tracing.EventDataCollected:
+			rec.mu.Lock()
+			for _, event := range e.Value {
+				rec.events = append(rec.events, json.RawMessage(event))
+			}
+			rec.mu.Unlock()
+		case *tracing.EventTracingComplete:
+			rec.mu.Lock()
+			rec.dataLoss = e.DataLossOccurred
+			rec.mu.Unlock()
+			close(rec.complete)
+		}
+	})
+
+	err := chromedp.Run(browserCtx, tracing.Start().
+		WithTransferMode(tracing.TransferModeReportEvents).
+		WithTraceConfig(&tracing.TraceConfig{
+			RecordMode:         tracing.RecordModeRecordAsMuchAsPossible,
+			IncludedCategories: traceCategories,
+		}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to start trace: %w", err)
+	}
+	return rec, nil
+}
+
+// stop ends the trace and writes it to path in the JSON trace event format,
+// which chrome://tracing and the DevTools Performance panel load
+func (r *traceRecorder) stop(browserCtx context.Context, path string) error {
+	// The capture may have timed out, the trace of a slow page is still worth saving
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(browserCtx), 30*time.Second)
+	defer cancel()
+
+	if err := chromedp.Run(ctx, tracing.End()); err != nil {
+		return fmt.Errorf("failed to end trace: %w", err)
+	}
+	select {
+	case <-r.complete:
+	case <-ctx.Done():
+		return fmt.Errorf("timed out waiting for trace data")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	w.WriteString(`{"traceEvents":[`)
+	for i, event := range r.events {
+		if i > 0 {
+			w.WriteString(",\n")
+		}
+		w.Write(event)
+	}
+	fmt.Fprintf(w, "],\n\"metadata\":{\"source\":\"screenshot-tool\",\"dataLossOccurred\":%t}}\n", r.dataLoss)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if r.dataLoss {
+		log.Printf("Warning: Trace buffer overflowed, %s is incomplete", path)
+	}
+	log.Printf("Wrote %d trace events to %s", len(r.events), path)
+	return nil
+}
@@ -0,0 +1,74 @@
+package screenshot
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+)
+
+// TransportInfo describes how the main document of a page load was transferred
+type TransportInfo struct {
+	URL              string `json:"url"`                        // Final URL of the document, after redirects
+	Protocol         string `json:"protocol,omitempty"`         // Negotiated application protocol, e.g. "h2", "h3" or "http/1.1"
+	TLSVersion       string `json:"tlsVersion,omitempty"`       // e.g. "TLS 1.3", empty for plain HTTP
+	Cipher           string `json:"cipher,omitempty"`           // e.g. "AES_128_GCM"
+	KeyExchange      string `json:"keyExchange,omitempty"`      // Empty for TLS 1.3, which doesn't negotiate it separately
+	KeyExchangeGroup string `json:"keyExchangeGroup,omitempty"` // e.g. "X25519"
+}
+
+// transportRecorder keeps the transport of the latest document response of each frame
+type transportRecorder struct {
+	mu        sync.Mutex
+	documents map[cdp.FrameID]*TransportInfo
+}
+
+// recordTransport starts recording the transport of the documents loaded in the browser context
+func recordTransport(browserCtx context.Context) *transportRecorder {
+	rec := &transportRecorder{documents: make(map[cdp.FrameID]*TransportInfo)}
+
+	chromedp.ListenTarget(browserCtx, func(ev any) {
+		e, ok := ev.(*network.EventResponseReceived)
+		if !ok || e.Type != network.ResourceTypeDocument || e.Response == nil {
+			return
+		}
+
+		info := &TransportInfo{URL: e.Response.URL, Protocol: e.Response.Protocol}
+		if details := e.Response.SecurityDetails; details != nil {
+			info.TLSVersion = details.Protocol
+			info.Cipher = details.Cipher
+			info.KeyExchange = details.KeyExchange
+			info.KeyExchangeGroup = details.KeyExchangeGroup
+		}
+
+		rec.mu.Lock()
+		rec.documents[e.FrameID] = info
+		rec.mu.Unlock()
+	})
+
+	return rec
+}
+
+// mainDocument returns the transport of the document currently loaded in the main frame
+func (r *transportRecorder) mainDocument(browserCtx context.Context) (*TransportInfo, error) {
+	var tree *page.FrameTree
+	if err := chromedp.Run(browserCtx, chromedp.ActionFunc(func(ctx context.Context) error {
+		var err error
+		tree, err = page.GetFrameTree().Do(ctx)
+		return err
+	})); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	info := r.documents[tree.Frame.ID]
+	if info == nil {
+		return nil, fmt.Errorf("no document response was received for the main frame")
+	}
+	return info, nil
+}
@@ -0,0 +1,195 @@
+package screenshot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/draw"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Scripts that measure and scroll the page
+const (
+	pageHeightScript = `return Math.max(document.body.scrollHeight, document.documentElement.scrollHeight)`
+	scrollToScript   = `window.scrollTo({top: arguments[0], left: 0, behavior: 'instant'})`
+)
+
+// fallbackCaptureHeight is the height retried with when Chrome fails to capture a very tall page
+const fallbackCaptureHeight = 8192
+
+// maxStitchedHeight is the tallest stitched screenshot, the largest height a JPEG can hold.
+// It also bounds the memory needed for stitching.
+const maxStitchedHeight = 65535
+
+// Truncation records that a full page screenshot doesn't show the whole page
+type Truncation struct {
+	Screenshot     string    `json:"screenshot"`     // Screenshot file name
+	PageHeight     int64     `json:"pageHeight"`     // Height of the page in pixels
+	CapturedHeight int64     `json:"capturedHeight"` // Height of the screenshot in pixels
+	Reason         string    `json:"reason"`
+	CapturedAt     time.Time `json:"capturedAt"`
+}
+
+// captureFullHeight resizes the viewport to the page height and captures it, applying the
+// maximum page height policy. It returns a truncation record if only the top of the page was captured.
+func (s *Screenshoter) captureFullHeight(ctx context.Context, engine BrowserEngine, buf *[]byte) (*Truncation, error) {
+	var pageHeight float64
+	if err := engine.Evaluate(pageHeightScript, &pageHeight); err != nil {
+		return nil, err
+	}
+
+	height := int64(pageHeight)
+	maxHeight := int64(s.Config.MaxPageHeight)
+
+	var truncation *Truncation
+	if height > maxHeight {
+		if s.Config.PageHeightPolicy == "stitch" {
+			return s.captureStitched(ctx, engine, height, buf)
+		}
+		if s.Config.PageHeightPolicy == "fail" {
+			return nil, fmt.Errorf("page height %dpx exceeds maximum page height %dpx", height, maxHeight)
+		}
+		log.Printf("Warning: Page height (%d) exceeds maximum allowed height (%d). Limiting height.", height, maxHeight)
+		truncation = &Truncation{
+			PageHeight:     height,
+			CapturedHeight: maxHeight,
+			Reason:         fmt.Sprintf("page height exceeds maximum page height of %dpx", maxHeight),
+		}
+		height = maxHeight
+	}
+
+	if err := engine.SetViewportHeight(height); err != nil {
+		return nil, err
+	}
+
+	data, err := engine.Screenshot(s.Config.FileFormat, s.Config.Quality)
+	if err == nil {
+		*buf = data
+		return truncation, nil
+	}
+
+	// Try with smaller height if capture failed
+	if height <= fallbackCaptureHeight || s.Config.PageHeightPolicy == "fail" {
+		return nil, err
+	}
+
+	log.Printf("Screenshot capture failed, trying with reduced height...")
+	if err := engine.SetViewportHeight(fallbackCaptureHeight); err != nil {
+		return nil, err
+	}
+	if *buf, err = engine.Screenshot(s.Config.FileFormat, s.Config.Quality); err != nil {
+		return nil, err
+	}
+
+	return &Truncation{
+		PageHeight:     int64(pageHeight),
+		CapturedHeight: fallbackCaptureHeight,
+		Reason:         fmt.Sprintf("capture at %dpx failed: %v", height, err),
+	}, nil
+}
+
+// captureStitched captures a page taller than the maximum page height in segments of that
+// height and stitches them into one image. Pages taller than a stitched image can hold are truncated.
+func (s *Screenshoter) captureStitched(ctx context.Context, engine BrowserEngine, pageHeight int64, buf *[]byte) (*Truncation, error) {
+	segmentHeight := int64(s.Config.MaxPageHeight)
+	height := min(pageHeight, maxStitchedHeight)
+	log.Printf("Page height (%d) exceeds maximum page height (%d), stitching %d segments", pageHeight, segmentHeight, (height+segmentHeight-1)/segmentHeight)
+
+	if err := engine.SetViewportHeight(segmentHeight); err != nil {
+		return nil, err
+	}
+
+	var canvas *image.RGBA
+	for offset := int64(0); offset < height; offset += segmentHeight {
+		// The last segment can't scroll past the end of the page and overlaps the previous one
+		var scrollY float64
+		if err := engine.Evaluate(scrollToScript, nil, offset); err != nil {
+			return nil, err
+		}
+		if err := sleepContext(ctx, 300*time.Millisecond); err != nil {
+			return nil, err
+		}
+		if err := engine.Evaluate(`return window.scrollY`, &scrollY); err != nil {
+			return nil, err
+		}
+
+		segment, err := engine.Screenshot(s.Config.FileFormat, s.Config.Quality)
+		if err != nil {
+			return nil, fmt.Errorf("failed to capture segment at %dpx: %w", offset, err)
+		}
+		img, _, err := image.Decode(bytes.NewReader(segment))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode segment at %dpx: %w", offset, err)
+		}
+
+		if canvas == nil {
+			canvas = image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), int(height)))
+		}
+		top := int(scrollY)
+		draw.Draw(canvas, image.Rect(0, top, canvas.Bounds().Dx(), top+img.Bounds().Dy()), img, img.Bounds().Min, draw.Src)
+	}
+
+	if err := engine.Evaluate(`window.scrollTo(0, 0)`, nil); err != nil {
+		return nil, err
+	}
+
+	data, err := encodeImage(canvas, s.Config.FileFormat, s.Config.Quality)
+	if err != nil {
+		return nil, err
+	}
+	*buf = data
+
+	if height < pageHeight {
+		return &Truncation{
+			PageHeight:     pageHeight,
+			CapturedHeight: height,
+			Reason:         fmt.Sprintf("page height exceeds the %dpx a stitched screenshot can hold", maxStitchedHeight),
+		}, nil
+	}
+	return nil, nil
+}
+
+// writeTruncationNotice saves a notice next to a truncated screenshot so it can't be mistaken for the full page
+func writeTruncationNotice(screenshotPath string, truncation *Truncation) error {
+	truncation.Screenshot = filepath.Base(screenshotPath)
+	truncation.CapturedAt = time.Now()
+
+	data, err := json.MarshalIndent(truncation, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	noticePath := strings.TrimSuffix(screenshotPath, filepath.Ext(screenshotPath)) + "-TRUNCATED.json"
+	if err := os.WriteFile(noticePath, data, 0644); err != nil {
+		return err
+	}
+
+	log.Printf("Warning: Screenshot %s is truncated, it shows %dpx of the %dpx page. Notice written to %s",
+		truncation.Screenshot, truncation.CapturedHeight, truncation.PageHeight, noticePath)
+	return nil
+}
+
+// collectTruncations adds the truncation notices in a viewport directory to the manifest
+func collectTruncations(viewportDir string, vm *ViewportManifest) {
+	notices, _ := filepath.Glob(filepath.Join(viewportDir, "*-TRUNCATED.json"))
+	for _, notice := range notices {
+		data, err := os.ReadFile(notice)
+		if err != nil {
+			log.Printf("ERROR: Failed to read truncation notice %s: %v", notice, err)
+			continue
+		}
+
+		var truncation Truncation
+		if err := json.Unmarshal(data, &truncation); err != nil {
+			log.Printf("ERROR: Failed to parse truncation notice %s: %v", notice, err)
+			continue
+		}
+		vm.Truncations = append(vm.Truncations, truncation)
+	}
+}
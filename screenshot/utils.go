@@ -5,8 +5,8 @@ import (
 	"strings"
 )
 
-// sanitizeFilename sanitizes a filename by removing illegal characters
-func sanitizeFilename(filename string) string {
+// SanitizeFilename sanitizes a filename by removing illegal characters
+func SanitizeFilename(filename string) string {
 	// Replace illegal characters with underscore
 	re := regexp.MustCompile(`[\\/:*?"<>|]`)
 	sanitized := re.ReplaceAllString(filename, "_")
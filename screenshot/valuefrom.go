@@ -0,0 +1,95 @@
+package screenshot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"screenshot-tool/config"
+)
+
+// resolveValueCommands returns the URL with the values of its cookies and localStorage
+// items that are produced by commands, running the commands. It runs for every viewport
+// capture, so short-lived tokens are minted right before they are set.
+func (s *Screenshoter) resolveValueCommands(ctx context.Context, urlConfig config.URLConfig) (config.URLConfig, error) {
+	var cookies []config.Cookie
+	for i, cookie := range urlConfig.Cookies {
+		if cookie.ValueFrom == nil {
+			continue
+		}
+		if cookies == nil {
+			cookies = append([]config.Cookie(nil), urlConfig.Cookies...)
+		}
+		value, err := runValueCommand(ctx, cookie.ValueFrom)
+		if err != nil {
+			return urlConfig, fmt.Errorf("failed to produce the value of cookie %s: %w", cookie.Name, err)
+		}
+		cookies[i].Value = value
+		log.Printf("Produced the value of cookie %s for %s", cookie.Name, urlConfig.Name)
+	}
+
+	var items []config.LocalStorage
+	for i, item := range urlConfig.LocalStorage {
+		if item.ValueFrom == nil {
+			continue
+		}
+		if items == nil {
+			items = append([]config.LocalStorage(nil), urlConfig.LocalStorage...)
+		}
+		value, err := runValueCommand(ctx, item.ValueFrom)
+		if err != nil {
+			return urlConfig, fmt.Errorf("failed to produce the value of localStorage item %s: %w", item.Key, err)
+		}
+		items[i].Value = value
+		log.Printf("Produced the value of localStorage item %s for %s", item.Key, urlConfig.Name)
+	}
+
+	// The URL's slices are shared with the other viewports, which mint their own values
+	if cookies != nil {
+		urlConfig.Cookies = cookies
+	}
+	if items != nil {
+		urlConfig.LocalStorage = items
+	}
+	return urlConfig, nil
+}
+
+// runValueCommand runs a value command with the system shell and returns its output
+// without surrounding whitespace. The output isn't logged, as it is usually a credential.
+func runValueCommand(ctx context.Context, from *config.ValueFrom) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(from.Timeout)*time.Millisecond)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", from.Command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", from.Command)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	// Don't wait for children of the shell that keep its output open after a timeout
+	cmd.WaitDelay = time.Second
+
+	output, err := cmd.Output()
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("command %q timed out after %dms", from.Command, from.Timeout)
+	}
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", fmt.Errorf("command %q failed: %w: %s", from.Command, err, message)
+		}
+		return "", fmt.Errorf("command %q failed: %w", from.Command, err)
+	}
+
+	value := strings.TrimSpace(string(output))
+	if value == "" {
+		return "", fmt.Errorf("command %q printed no value", from.Command)
+	}
+	return value, nil
+}
@@ -0,0 +1,46 @@
+package screenshot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"screenshot-tool/config"
+)
+
+// startSessionVideo starts recording everything the page of a viewport shows, from before the
+// first navigation until the capture ends. The returned function saves the video, it also
+// records captures that failed.
+func startSessionVideo(browserCtx context.Context, video *config.VideoRecording, urlConfig config.URLConfig, viewport config.Viewport, viewportDir string, vm *ViewportManifest) (*screencast, func(), error) {
+	sc, err := startScreencast(browserCtx, video.MaxWidth, video.MaxWidth*viewport.Height/viewport.Width)
+	if err != nil {
+		return nil, nil, err
+	}
+	start := time.Now()
+
+	save := func() {
+		if err := sc.finish(browserCtx); err != nil {
+			log.Printf("Warning: Failed to stop the session video of %s at viewport %dx%d: %v", urlConfig.Name, viewport.Width, viewport.Height, err)
+		}
+		end := time.Now()
+
+		format := video.Format
+		if _, err := exec.LookPath("ffmpeg"); format == "webm" && err != nil {
+			log.Printf("Warning: ffmpeg is not installed, saving the session video of %s as GIF", urlConfig.Name)
+			format = "gif"
+		}
+
+		name := fmt.Sprintf("%s-session-%dx%d.%s", SanitizeFilename(urlConfig.Name), viewport.Width, viewport.Height, format)
+		// The browser context may already be done, encoding doesn't depend on it
+		if err := sc.writeAnimation(context.Background(), filepath.Join(viewportDir, name), format, sc.sample(start, end, video.FPS), video.FPS); err != nil {
+			log.Printf("ERROR: Failed to save the session video of %s at viewport %dx%d: %v", urlConfig.Name, viewport.Width, viewport.Height, err)
+			return
+		}
+		log.Printf("Saved session video of %s at viewport %dx%d: %s (%v)", urlConfig.Name, viewport.Width, viewport.Height, name, end.Sub(start).Round(time.Second))
+		vm.Video = name
+	}
+	return sc, save, nil
+}
@@ -0,0 +1,191 @@
+package screenshot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"screenshot-tool/config"
+
+	"github.com/chromedp/chromedp"
+)
+
+// webDriverSession is a browser session on a Selenium Grid node
+type webDriverSession struct {
+	hub    string
+	id     string
+	cdpURL string // DevTools endpoint of the session, proxied by the Grid
+	client *http.Client
+}
+
+// newWebDriverSession asks the Grid for a Chrome session launched with args and waits for
+// a node to become free. Selenium 4 exposes the DevTools protocol of Chrome sessions as
+// the se:cdp capability, which lets the captures drive the browser as if it ran locally.
+func newWebDriverSession(ctx context.Context, webDriver *config.WebDriver, args []string) (*webDriverSession, error) {
+	capabilities := map[string]any{}
+	for name, value := range webDriver.Capabilities {
+		capabilities[name] = value
+	}
+	capabilities["browserName"] = "chrome"
+	capabilities["acceptInsecureCerts"] = true
+	capabilities["goog:chromeOptions"] = map[string]any{"args": args}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(webDriver.SessionTimeout)*time.Millisecond)
+	defer cancel()
+
+	session, created, err := startWebDriverSession(ctx, webDriver.URL, capabilities)
+	if err != nil {
+		return nil, err
+	}
+
+	cdpURL, _ := created["se:cdp"].(string)
+	if cdpURL == "" {
+		session.close()
+		return nil, fmt.Errorf("the session on %s has no se:cdp capability, captures need Selenium Grid 4 with Chrome nodes", session.hub)
+	}
+	session.cdpURL = cdpURL
+	return session, nil
+}
+
+// startWebDriverSession creates a session with the given capabilities on a WebDriver
+// server, and returns it with the capabilities the server granted
+func startWebDriverSession(ctx context.Context, hub string, capabilities map[string]any) (*webDriverSession, map[string]any, error) {
+	session := &webDriverSession{
+		hub:    strings.TrimSuffix(hub, "/"),
+		client: &http.Client{},
+	}
+
+	var created struct {
+		SessionID    string         `json:"sessionId"`
+		Capabilities map[string]any `json:"capabilities"`
+	}
+	request := map[string]any{"capabilities": map[string]any{"alwaysMatch": capabilities}}
+	if err := session.do(ctx, http.MethodPost, "/session", request, &created); err != nil {
+		return nil, nil, fmt.Errorf("failed to create a session on %s: %w", session.hub, err)
+	}
+	session.id = created.SessionID
+	return session, created.Capabilities, nil
+}
+
+// close ends the session, freeing its node
+func (w *webDriverSession) close() {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := w.do(ctx, http.MethodDelete, "/session/"+w.id, nil, nil); err != nil {
+		log.Printf("Warning: Failed to end session %s on %s: %v", w.id, w.hub, err)
+	}
+}
+
+// do sends a WebDriver command to the hub and decodes the value of its response into out
+func (w *webDriverSession) do(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, w.hub+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Value json.RawMessage `json:"value"`
+	}
+	// Screenshots are returned inline, so full page captures of long pages are large
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 512<<20))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &result); err != nil && resp.StatusCode < 300 {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+
+	if resp.StatusCode >= 300 {
+		var failure struct {
+			Error   string `json:"error"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(result.Value, &failure) == nil && failure.Error != "" {
+			message, _, _ := strings.Cut(failure.Message, "\n")
+			return fmt.Errorf("%s: %s", failure.Error, message)
+		}
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if out != nil {
+		return json.Unmarshal(result.Value, out)
+	}
+	return nil
+}
+
+// GridReady reports an error if the Selenium Grid of the webdriver backend can't take sessions
+func GridReady(ctx context.Context, webDriver *config.WebDriver) error {
+	w := &webDriverSession{hub: strings.TrimSuffix(webDriver.URL, "/"), client: &http.Client{}}
+	var status struct {
+		Ready   bool   `json:"ready"`
+		Message string `json:"message"`
+	}
+	if err := w.do(ctx, http.MethodGet, "/status", nil, &status); err != nil {
+		return fmt.Errorf("selenium grid at %s is unreachable: %w", w.hub, err)
+	}
+	if !status.Ready {
+		return fmt.Errorf("selenium grid at %s is not ready: %s", w.hub, status.Message)
+	}
+	return nil
+}
+
+// newWebDriverContext starts a Chrome session on the Selenium Grid for a URL and viewport
+// and returns a browser context connected to it. The returned cancel function ends the
+// session.
+func (s *Screenshoter) newWebDriverContext(ctx context.Context, urlConfig config.URLConfig, viewport config.Viewport) (context.Context, context.CancelFunc, error) {
+	args := []string{
+		fmt.Sprintf("--window-size=%d,%d", viewport.Width, viewport.Height),
+		"--headless=new",
+		"--disable-gpu",
+		"--ignore-certificate-errors",
+	}
+	if urlConfig.Proxy != nil {
+		args = append(args, "--proxy-server="+urlConfig.Proxy.URL)
+		if len(urlConfig.Proxy.Bypass) > 0 {
+			args = append(args, "--proxy-bypass-list="+proxyBypassList(*urlConfig.Proxy))
+		}
+	}
+	if len(urlConfig.DNSOverrides) > 0 {
+		args = append(args, "--host-resolver-rules="+hostResolverRules(urlConfig.DNSOverrides))
+	}
+	args = append(append(args, s.Config.ChromeFlags...), urlConfig.ChromeFlags...)
+
+	start := time.Now()
+	session, err := newWebDriverSession(ctx, s.Config.WebDriver, args)
+	if err != nil {
+		return nil, nil, err
+	}
+	log.Printf("Using Selenium Grid session %s for %s at viewport %dx%d, started in %v",
+		session.id, urlConfig.Name, viewport.Width, viewport.Height, time.Since(start).Round(time.Millisecond))
+
+	allocCtx, cancelAlloc := chromedp.NewRemoteAllocator(ctx, session.cdpURL, chromedp.NoModifyURL)
+	browserCtx, cancelBrowser := chromedp.NewContext(allocCtx, chromedp.WithLogf(log.Printf))
+	return browserCtx, func() {
+		cancelBrowser()
+		cancelAlloc()
+		session.close()
+	}, nil
+}
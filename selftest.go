@@ -0,0 +1,387 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/png" // Register PNG decoder for screenshot checks
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"screenshot-tool/config"
+	"screenshot-tool/internal/testserver"
+	"screenshot-tool/screenshot"
+)
+
+// selftestViewport is the viewport used for all selftest captures
+var selftestViewport = config.Viewport{Width: 1024, Height: 768}
+
+// selftestCase is a page captured by the selftest and the checks run on its output
+type selftestCase struct {
+	urlConfig config.URLConfig
+	checks    []selftestCheck
+}
+
+// selftestCheck verifies one aspect of a capture's output
+type selftestCheck struct {
+	name  string
+	check func(out *captureOutput) error
+}
+
+// captureOutput locates the files produced for a URL
+type captureOutput struct {
+	urlDir      string
+	viewportDir string
+	name        string
+}
+
+// runSelftest implements the selftest command, which runs the full capture
+// pipeline against the built-in test server and verifies the results
+func runSelftest(args []string) {
+	flags := flag.NewFlagSet("selftest", flag.ExitOnError)
+	chromeMode := flags.String("chrome", "auto", "Chrome execution mode: 'local', 'docker', or 'auto'")
+	outputDir := flags.String("output", "", "Directory to keep the selftest captures in (defaults to a temporary directory that is removed)")
+	verbose := flags.Bool("verbose", false, "Show capture logs")
+	flags.Parse(args)
+
+	if *chromeMode != "auto" && *chromeMode != "local" && *chromeMode != "docker" {
+		log.Fatalf("Invalid chrome mode: %s. Must be 'auto', 'local', or 'docker'", *chromeMode)
+	}
+
+	server := testserver.Start()
+	defer server.Close()
+
+	dir := *outputDir
+	if dir == "" {
+		tmp, err := os.MkdirTemp("", "screenshot-selftest-")
+		if err != nil {
+			log.Fatalf("Failed to create output directory: %v", err)
+		}
+		defer os.RemoveAll(tmp)
+		dir = tmp
+	}
+
+	cases := selftestCases(server)
+
+	cfg := config.Config{
+		DefaultViewports: []config.Viewport{selftestViewport},
+		OutputDir:        dir,
+		FileFormat:       "png",
+		HAR:              true,
+	}
+	for _, c := range cases {
+		cfg.URLs = append(cfg.URLs, c.urlConfig)
+	}
+
+	loaded, err := loadGeneratedConfig(cfg, dir)
+	if err != nil {
+		log.Fatalf("Failed to load selftest configuration: %v", err)
+	}
+	loaded.ChromeMode = *chromeMode
+
+	log.Printf("Running selftest with %d pages against %s", len(cases), server.URL)
+
+	if !*verbose {
+		log.SetOutput(io.Discard)
+	}
+	captureErr := screenshot.NewScreenshoter(loaded).CaptureURLs(context.Background())
+	log.SetOutput(os.Stderr)
+	cleanupDockerContainer()
+
+	if captureErr != nil {
+		log.Printf("Capture reported an error: %v", captureErr)
+	}
+
+	// Run every check, even after failures, so the report is complete
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PAGE\tCHECK\tRESULT")
+	failed := 0
+	for _, c := range cases {
+		out, findErr := findCaptureOutput(dir, c.urlConfig.Name)
+		for _, check := range c.checks {
+			err := findErr
+			if err == nil {
+				err = check.check(out)
+			}
+
+			result := "PASS"
+			if err != nil {
+				result = "FAIL: " + err.Error()
+				failed++
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", c.urlConfig.Name, check.name, result)
+		}
+	}
+	tw.Flush()
+
+	if *outputDir != "" {
+		log.Printf("Selftest captures kept in %s", dir)
+	}
+	if failed > 0 {
+		log.Printf("Selftest failed: %d checks failed", failed)
+		os.Exit(1)
+	}
+	log.Printf("Selftest passed")
+}
+
+// selftestCases returns the pages to capture and how to verify each of them
+func selftestCases(server *testserver.Server) []selftestCase {
+	return []selftestCase{
+		{
+			urlConfig: config.URLConfig{
+				Name:          "basic",
+				URL:           server.PageURL(testserver.PathBasic),
+				MaskSelectors: []string{testserver.MaskedElement},
+			},
+			checks: []selftestCheck{
+				standardCheck(),
+				{"masked element is blacked out", func(out *captureOutput) error {
+					img, err := out.image("-viewport-", 1)
+					if err != nil {
+						return err
+					}
+					x := testserver.MaskedX + testserver.MaskedSize/2
+					y := testserver.MaskedY + testserver.MaskedSize/2
+					if r, g, b := rgb(img.At(x, y)); r > 40 || g > 40 || b > 40 {
+						return fmt.Errorf("pixel at %d,%d is rgb(%d, %d, %d), expected black", x, y, r, g, b)
+					}
+					return nil
+				}},
+			},
+		},
+		{
+			urlConfig: config.URLConfig{
+				Name: "lazy",
+				URL:  server.PageURL(testserver.PathLazy),
+			},
+			checks: []selftestCheck{
+				standardCheck(),
+				{"all lazy images loaded", func(out *captureOutput) error {
+					entries, err := out.harEntries()
+					if err != nil {
+						return err
+					}
+					loaded := make(map[string]bool)
+					for _, e := range entries {
+						if strings.Contains(e.Request.URL, testserver.PathLazyImage) && e.Response.Status == 200 {
+							loaded[e.Request.URL] = true
+						}
+					}
+					if len(loaded) < testserver.LazyImages {
+						return fmt.Errorf("%d of %d images loaded", len(loaded), testserver.LazyImages)
+					}
+					return nil
+				}},
+			},
+		},
+		{
+			urlConfig: config.URLConfig{
+				Name:    "cookie-banner",
+				URL:     server.PageURL(testserver.PathCookieBanner),
+				Cookies: []config.Cookie{{Name: testserver.ConsentCookie, Value: "yes"}},
+			},
+			checks: []selftestCheck{
+				standardCheck(),
+				{"banner dismissed by consent cookie", func(out *captureOutput) error {
+					img, err := out.image("-viewport-", 1)
+					if err != nil {
+						return err
+					}
+					if r, g, b := rgb(img.At(10, 10)); r > 200 && g < 40 && b < 40 {
+						return fmt.Errorf("cookie banner is still visible")
+					}
+					return nil
+				}},
+			},
+		},
+		{
+			urlConfig: config.URLConfig{
+				Name: "redirect",
+				URL:  server.PageURL(testserver.PathRedirect),
+			},
+			checks: []selftestCheck{
+				standardCheck(),
+				{"redirect recorded in HAR", func(out *captureOutput) error {
+					entries, err := out.harEntries()
+					if err != nil {
+						return err
+					}
+					redirected, final := false, false
+					for _, e := range entries {
+						if strings.HasSuffix(e.Request.URL, testserver.PathRedirect) && e.Response.Status == 302 {
+							redirected = true
+						}
+						if strings.HasSuffix(e.Request.URL, testserver.PathRedirectFinal) && e.Response.Status == 200 {
+							final = true
+						}
+					}
+					if !redirected || !final {
+						return fmt.Errorf("expected a 302 followed by a 200 for the target (302: %v, 200: %v)", redirected, final)
+					}
+					return nil
+				}},
+			},
+		},
+		{
+			urlConfig: config.URLConfig{
+				Name: "tall",
+				URL:  server.PageURL(testserver.PathTall),
+			},
+			checks: []selftestCheck{
+				standardCheck(),
+				{"full page covers tall content", func(out *captureOutput) error {
+					img, err := out.image("-full-", 0)
+					if err != nil {
+						return err
+					}
+					// Very tall pages may be limited to 8192 pixels by the capture fallback
+					if h := img.Bounds().Dy(); h < min(testserver.TallHeight, 8192) {
+						return fmt.Errorf("full page is %dpx tall, expected at least %dpx", h, min(testserver.TallHeight, 8192))
+					}
+					return nil
+				}},
+				{"page split into viewport sections", func(out *captureOutput) error {
+					matches, _ := filepath.Glob(filepath.Join(out.viewportDir, "*-viewport-*"))
+					if len(matches) < 2 {
+						return fmt.Errorf("found %d viewport sections, expected several", len(matches))
+					}
+					return nil
+				}},
+			},
+		},
+		{
+			urlConfig: config.URLConfig{
+				Name: "csp",
+				URL:  server.PageURL(testserver.PathCSP),
+			},
+			checks: []selftestCheck{
+				standardCheck(),
+				{"CSP violation logged", func(out *captureOutput) error {
+					data, err := os.ReadFile(filepath.Join(out.viewportDir, out.name+"-console.log"))
+					if err != nil {
+						return err
+					}
+					if !strings.Contains(string(data), "Content Security Policy") {
+						return fmt.Errorf("console log does not mention the blocked inline script")
+					}
+					return nil
+				}},
+			},
+		},
+	}
+}
+
+// standardCheck verifies the files every capture should produce
+func standardCheck() selftestCheck {
+	return selftestCheck{"screenshots, manifest, console log and HAR written", func(out *captureOutput) error {
+		img, err := out.image("-full-", 0)
+		if err != nil {
+			return err
+		}
+		if w := img.Bounds().Dx(); w != selftestViewport.Width {
+			return fmt.Errorf("full page is %dpx wide, expected %dpx", w, selftestViewport.Width)
+		}
+		if _, err := out.image("-viewport-", 1); err != nil {
+			return err
+		}
+		for _, path := range []string{
+			filepath.Join(out.urlDir, "manifest.json"),
+			filepath.Join(out.viewportDir, out.name+"-console.log"),
+			filepath.Join(out.viewportDir, out.name+".har"),
+		} {
+			if _, err := os.Stat(path); err != nil {
+				return fmt.Errorf("missing %s", filepath.Base(path))
+			}
+		}
+		return nil
+	}}
+}
+
+// findCaptureOutput locates the directories written for a URL
+func findCaptureOutput(outputDir, name string) (*captureOutput, error) {
+	matches, err := filepath.Glob(filepath.Join(outputDir, "[0-9]*_"+name+"_*"))
+	if err != nil || len(matches) == 0 {
+		return nil, fmt.Errorf("no output directory for %s", name)
+	}
+
+	urlDir := matches[len(matches)-1]
+	return &captureOutput{
+		urlDir:      urlDir,
+		viewportDir: filepath.Join(urlDir, fmt.Sprintf("%dx%d", selftestViewport.Width, selftestViewport.Height)),
+		name:        name,
+	}, nil
+}
+
+// image decodes a screenshot by type, with section numbers for viewport screenshots
+func (out *captureOutput) image(kind string, section int) (image.Image, error) {
+	pattern := "*" + kind + "*.png"
+	if section > 0 {
+		pattern = fmt.Sprintf("*%s*-%d.png", kind, section)
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(out.viewportDir, pattern))
+	var path string
+	for _, m := range matches {
+		// The full page pattern also matches full-proof screenshots
+		if !strings.Contains(filepath.Base(m), "-full-proof-") {
+			path = m
+			break
+		}
+	}
+	if path == "" {
+		return nil, fmt.Errorf("no %s screenshot found", strings.Trim(kind, "-"))
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", filepath.Base(path), err)
+	}
+	return img, nil
+}
+
+// selftestHAREntry holds the HAR fields the checks look at
+type selftestHAREntry struct {
+	Request struct {
+		URL string `json:"url"`
+	} `json:"request"`
+	Response struct {
+		Status int `json:"status"`
+	} `json:"response"`
+}
+
+// harEntries reads the entries of the URL's HAR file
+func (out *captureOutput) harEntries() ([]selftestHAREntry, error) {
+	data, err := os.ReadFile(filepath.Join(out.viewportDir, out.name+".har"))
+	if err != nil {
+		return nil, err
+	}
+
+	var doc struct {
+		Log struct {
+			Entries []selftestHAREntry `json:"entries"`
+		} `json:"log"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid HAR file: %w", err)
+	}
+	return doc.Log.Entries, nil
+}
+
+// rgb returns the 8-bit color components of a pixel
+func rgb(c color.Color) (uint8, uint8, uint8) {
+	r, g, b, _ := c.RGBA()
+	return uint8(r >> 8), uint8(g >> 8), uint8(b >> 8)
+}
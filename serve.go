@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"screenshot-tool/config"
+	"screenshot-tool/screenshot"
+)
+
+// captureRequest is the body of a capture request to the server
+type captureRequest struct {
+	URL       string            `json:"url"`
+	Name      string            `json:"name,omitempty"`
+	Viewports []config.Viewport `json:"viewports,omitempty"`
+	Delay     int               `json:"delay,omitempty"`
+}
+
+// captureResponse reports the outcome of a capture request
+type captureResponse struct {
+	Name       string `json:"name"`
+	URL        string `json:"url"`
+	DurationMs int64  `json:"durationMs"`
+	Error      string `json:"error,omitempty"`
+}
+
+// rejectValueCommands refuses cookies and localStorage items of a request, including those of
+// its viewports, whose values are produced by commands. Commands run on the server, so only
+// its configuration may set them.
+func rejectValueCommands(cookies []config.Cookie, items []config.LocalStorage, viewports []config.Viewport) error {
+	cookies, items = cookies[:len(cookies):len(cookies)], items[:len(items):len(items)]
+	for _, v := range viewports {
+		cookies = append(cookies, v.Cookies...)
+		items = append(items, v.LocalStorage...)
+	}
+	for _, cookie := range cookies {
+		if cookie.ValueFrom != nil {
+			return fmt.Errorf("cookie %s: valueFrom can only be set in the server's configuration", cookie.Name)
+		}
+	}
+	for _, item := range items {
+		if item.ValueFrom != nil {
+			return fmt.Errorf("localStorage item %s: valueFrom can only be set in the server's configuration", item.Key)
+		}
+	}
+	return nil
+}
+
+// runServe implements the serve command, which captures single URLs on request
+// using a warm standby browser so captures don't wait for Chrome to start
+func runServe(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	configPath := flags.String("config", "config.json", "Path to configuration file")
+	addr := flags.String("addr", "127.0.0.1:8080", "Address to listen on")
+	grpcAddr := flags.String("grpc", "", "Address to serve the gRPC API of api/capture.proto on, e.g. 127.0.0.1:9090")
+	chromeMode := flags.String("chrome", "auto", "Chrome execution mode: 'local', 'docker', or 'auto'")
+	flags.Parse(args)
+
+	if *chromeMode != "auto" && *chromeMode != "local" && *chromeMode != "docker" {
+		log.Fatalf("Invalid chrome mode: %s. Must be 'auto', 'local', or 'docker'", *chromeMode)
+	}
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	cfg.ChromeMode = *chromeMode
+	logConfigWarnings(cfg)
+
+	// Launch the standby browser before accepting requests, unless captures run on a Selenium Grid
+	// or are spread over the Docker Chrome pool
+	var standby *screenshot.Standby
+	if cfg.Backend == "webdriver" {
+		if err := screenshot.GridReady(context.Background(), cfg.WebDriver); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	} else if screenshot.UsesDockerPool(cfg, cfg.ChromeMode) {
+		log.Printf("Spreading captures over %d Docker Chrome containers instead of keeping a standby browser", cfg.DockerPool.Size)
+	} else {
+		if standby, err = screenshot.StartStandby(cfg.ChromeMode, cfg.ChromeFlags); err != nil {
+			log.Fatalf("Failed to start standby browser: %v", err)
+		}
+		if cfg.TabPool != nil {
+			standby.PoolTabs(cfg.TabPool)
+		}
+	}
+
+	journal, err := openJournal(cfg)
+	if err != nil {
+		log.Fatalf("Failed to open delivery journal: %v", err)
+	}
+
+	screenshoter := screenshot.NewScreenshoter(cfg)
+	if standby != nil {
+		screenshoter.UseStandby(standby)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	screenshoter.AfterURL = uploadHook(ctx, cfg, journal)
+
+	// The progress of every capture is streamed to the clients of /events
+	progress := newProgressHub(cfg.OutputDir)
+	screenshoter.OnProgress = progress.publisher("capture", "")
+
+	// Webhook triggers and deployments capture their URLs as runs, notified like scheduled runs
+	afterRun := chainRunHooks(catalogHook(cfg), notifyHook(ctx, cfg, journal), alertHook(ctx, cfg, journal))
+	triggers := newTriggerRunner(ctx, cfg, screenshoter.AfterURL, afterRun, func(trigger string, event screenshot.ProgressEvent) {
+		progress.publish("trigger:"+trigger, "", event)
+	})
+	var deployments *deploymentScheduler
+	if cfg.Deployments != nil {
+		if deployments, err = newDeploymentScheduler(ctx, cfg, screenshoter.AfterURL, afterRun, progress.publisher("deployment", "")); err != nil {
+			log.Fatalf("Failed to load deployments: %v", err)
+		}
+	}
+
+	// With API keys, each team's captures go to its own prefix of the output directory
+	tenants, err := newAPITenants(cfg, standby, screenshoter.AfterURL)
+	if err != nil {
+		log.Fatalf("Failed to set up API keys: %v", err)
+	}
+	if tenants != nil {
+		for _, tenant := range tenants.tenants {
+			tenant.screenshoter.OnProgress = progress.publisher("team:"+tenant.Name, tenant.Name)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/capture", func(w http.ResponseWriter, r *http.Request) {
+		handleCapture(ctx, cfg, screenshoter, tenants, w, r)
+	})
+	mux.HandleFunc("/events", progress.handle(tenants))
+	mux.HandleFunc("/trigger/{name}", triggers.handle)
+	if deployments != nil {
+		mux.HandleFunc("/deployments", deployments.handle)
+	}
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		health := func() error {
+			if standby == nil {
+				return screenshot.GridReady(r.Context(), cfg.WebDriver)
+			}
+			return standby.Healthy()
+		}
+		if err := health(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok\n"))
+	})
+
+	server := &http.Server{Addr: *addr, Handler: mux}
+	server.RegisterOnShutdown(progress.close)
+
+	// gRPC clients connect with HTTP/2 without TLS
+	var grpc *grpcServer
+	var grpcHTTP *http.Server
+	if *grpcAddr != "" {
+		grpc = newGRPCServer(ctx, cfg, screenshoter, tenants)
+		grpcHTTP = &http.Server{Addr: *grpcAddr, Handler: grpc, Protocols: new(http.Protocols)}
+		grpcHTTP.Protocols.SetUnencryptedHTTP2(true)
+		go func() {
+			log.Printf("Serving the gRPC API on %s", *grpcAddr)
+			if err := grpcHTTP.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("gRPC server failed: %v", err)
+				server.Close()
+			}
+		}()
+	}
+
+	// Shut down on signal, letting running captures finish
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signalChan
+		log.Printf("Received signal: %v, shutting down gracefully", sig)
+
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancelShutdown()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Failed to shut down server: %v", err)
+		}
+		if grpcHTTP != nil {
+			if err := grpcHTTP.Shutdown(shutdownCtx); err != nil {
+				log.Printf("Failed to shut down gRPC server: %v", err)
+			}
+		}
+	}()
+
+	log.Printf("Listening for capture requests on %s", *addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("Server failed: %v", err)
+	}
+
+	// Triggered runs and gRPC batches are captured in the background, let them finish too
+	triggers.wait()
+	if grpc != nil {
+		grpc.wait()
+	}
+	cancel()
+	if deployments != nil {
+		deployments.wait()
+	}
+	if standby != nil {
+		standby.Close()
+	}
+	cleanupDockerContainer()
+}
+
+// handleCapture captures the URL of a single request and reports the result. With API
+// keys, the URL is captured into the prefix of the request's key.
+func handleCapture(ctx context.Context, cfg *config.Config, screenshoter *screenshot.Screenshoter, tenants *apiTenants, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var tenant *apiTenant
+	if tenants != nil {
+		var err error
+		if tenant, err = tenants.authenticate(r.Header); err != nil {
+			writeAPIKeyError(w, err)
+			return
+		}
+		screenshoter = tenant.screenshoter
+	}
+
+	var req captureRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.URL == "" {
+		http.Error(w, "invalid request: url is required", http.StatusBadRequest)
+		return
+	}
+
+	// Fill in defaults the same way as the -url flag
+	if req.Name == "" {
+		req.Name = extractDomain(req.URL)
+	}
+	if req.Delay == 0 {
+		req.Delay = 1000
+	}
+	if len(req.Viewports) == 0 {
+		req.Viewports = cfg.DefaultViewports
+	}
+	if len(req.Viewports) == 0 {
+		req.Viewports = []config.Viewport{{Width: 1280, Height: 800}}
+	}
+	if err := rejectValueCommands(nil, nil, req.Viewports); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Check the target like the URLs of the configuration, applying the global settings
+	urlConfig := config.URLConfig{
+		Name:      req.Name,
+		URL:       req.URL,
+		Viewports: req.Viewports,
+		Delay:     req.Delay,
+	}
+	if err := cfg.ValidateURL(&urlConfig); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := tenant.admit(1); err != nil {
+		log.Printf("Refused capture request of %s for %s: %v", tenant.Name, req.URL, err)
+		writeAPIKeyError(w, err)
+		return
+	}
+
+	if tenant != nil {
+		log.Printf("Received capture request of %s for %s", tenant.Name, req.URL)
+	} else {
+		log.Printf("Received capture request for %s", req.URL)
+	}
+	start := time.Now()
+
+	err := screenshoter.CaptureURL(ctx, urlConfig)
+
+	resp := captureResponse{
+		Name:       req.Name,
+		URL:        req.URL,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	status := http.StatusOK
+	if err != nil {
+		log.Printf("Capture request for %s failed: %v", req.URL, err)
+		resp.Error = err.Error()
+		status = http.StatusInternalServerError
+	} else {
+		log.Printf("Capture request for %s completed in %dms", req.URL, resp.DurationMs)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"screenshot-tool/config"
+	"screenshot-tool/screenshot"
+)
+
+// maxTriggerPayload is the largest webhook payload accepted
+const maxTriggerPayload = 1 << 20
+
+// secretHeaders are request headers that authenticate a webhook and aren't recorded
+var secretHeaders = map[string]bool{
+	"Authorization":       true,
+	"Cookie":              true,
+	"X-Hub-Signature":     true,
+	"X-Hub-Signature-256": true,
+	"X-Gitlab-Token":      true,
+	"X-Api-Key":           true,
+	"X-Trigger-Token":     true,
+}
+
+// triggerEvent is the webhook that started a triggered run, recorded in its trigger.json
+type triggerEvent struct {
+	Trigger    string            `json:"trigger"`
+	ReceivedAt time.Time         `json:"receivedAt"`
+	RemoteAddr string            `json:"remoteAddr"`
+	Headers    map[string]string `json:"headers"`
+	Payload    json.RawMessage   `json:"payload"` // The payload as sent if it's JSON, as a string otherwise
+}
+
+// triggerResponse acknowledges a webhook whose run was started
+type triggerResponse struct {
+	Trigger   string `json:"trigger"`
+	OutputDir string `json:"outputDir"`
+	URLs      int    `json:"urls"`
+}
+
+// triggerRunner starts the runs of webhook triggers. Runs of the same trigger are
+// captured one after another, runs of different triggers concurrently.
+type triggerRunner struct {
+	ctx        context.Context
+	cfg        *config.Config
+	afterURL   func(config.URLConfig, string)
+	afterRun   func(*screenshot.RunSummary)
+	onProgress func(trigger string, event screenshot.ProgressEvent) // Progress of the captures, if set
+
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+	dirs  map[string]bool // Run directories handed out, so webhooks in the same second don't share one
+	wg    sync.WaitGroup
+}
+
+// newTriggerRunner returns a runner for the configured triggers
+func newTriggerRunner(ctx context.Context, cfg *config.Config, afterURL func(config.URLConfig, string), afterRun func(*screenshot.RunSummary), onProgress func(string, screenshot.ProgressEvent)) *triggerRunner {
+	return &triggerRunner{
+		ctx:        ctx,
+		cfg:        cfg,
+		afterURL:   afterURL,
+		afterRun:   afterRun,
+		onProgress: onProgress,
+		locks:      make(map[string]*sync.Mutex),
+		dirs:       make(map[string]bool),
+	}
+}
+
+// handle authenticates a webhook and starts the run of its trigger, answering
+// before the capture so webhook senders don't time out
+func (t *triggerRunner) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var trigger *config.Trigger
+	for i := range t.cfg.Triggers {
+		if t.cfg.Triggers[i].Name == r.PathValue("name") {
+			trigger = &t.cfg.Triggers[i]
+		}
+	}
+	if trigger == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxTriggerPayload))
+	if err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err := verifyTrigger(*trigger, r, body); err != nil {
+		log.Printf("Warning: Rejected webhook for trigger %s from %s: %v", trigger.Name, r.RemoteAddr, err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	event := triggerEvent{
+		Trigger:    trigger.Name,
+		ReceivedAt: time.Now(),
+		RemoteAddr: r.RemoteAddr,
+		Headers:    make(map[string]string),
+		Payload:    body,
+	}
+	for name, values := range r.Header {
+		if !secretHeaders[name] {
+			event.Headers[name] = strings.Join(values, ", ")
+		}
+	}
+	if !json.Valid(body) {
+		event.Payload, _ = json.Marshal(string(body))
+	}
+
+	runCfg := *t.cfg
+	runCfg.OutputDir = t.runDir(trigger.Name, event.ReceivedAt)
+	runCfg.URLs = selectURLs(t.cfg.URLs, trigger.URLs)
+
+	if err := writeTriggerEvent(runCfg.OutputDir, event); err != nil {
+		log.Printf("ERROR: Failed to record webhook for trigger %s: %v", trigger.Name, err)
+		http.Error(w, "failed to record webhook", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Received webhook for trigger %s from %s, capturing %d URLs to %s", trigger.Name, r.RemoteAddr, len(runCfg.URLs), runCfg.OutputDir)
+
+	t.wg.Add(1)
+	go func(name string) {
+		defer t.wg.Done()
+
+		lock := t.lock(name)
+		lock.Lock()
+		defer lock.Unlock()
+
+		afterRun := tagRun(t.afterRun, "trigger", "")
+		if afterRun != nil {
+			next := afterRun
+			afterRun = func(summary *screenshot.RunSummary) {
+				summary.Trigger = name
+				next(summary)
+			}
+		}
+		var onProgress func(screenshot.ProgressEvent)
+		if t.onProgress != nil {
+			onProgress = func(event screenshot.ProgressEvent) { t.onProgress(name, event) }
+		}
+		captureRun(t.ctx, &runCfg, "Trigger "+name, t.afterURL, afterRun, onProgress)
+	}(trigger.Name)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(triggerResponse{Trigger: trigger.Name, OutputDir: runCfg.OutputDir, URLs: len(runCfg.URLs)})
+}
+
+// lock returns the lock serializing the runs of a trigger
+func (t *triggerRunner) lock(name string) *sync.Mutex {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.locks[name] == nil {
+		t.locks[name] = &sync.Mutex{}
+	}
+	return t.locks[name]
+}
+
+// runDir returns the directory of a triggered run, outputDir/triggers/name/timestamp,
+// numbering runs received in the same second
+func (t *triggerRunner) runDir(name string, at time.Time) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	base := filepath.Join(t.cfg.OutputDir, "triggers", name, at.Format("20060102-150405"))
+	dir := base
+	for n := 2; ; n++ {
+		if _, err := os.Stat(dir); os.IsNotExist(err) && !t.dirs[dir] {
+			break
+		}
+		dir = fmt.Sprintf("%s-%d", base, n)
+	}
+	t.dirs[dir] = true
+	return dir
+}
+
+// wait waits for the triggered runs in progress
+func (t *triggerRunner) wait() {
+	t.wg.Wait()
+}
+
+// verifyTrigger checks that a webhook carries the trigger's secret, either as an HMAC-SHA256
+// signature of the payload in X-Hub-Signature-256 or as a token in X-Trigger-Token or X-Gitlab-Token.
+// Triggers without a secret accept every request.
+func verifyTrigger(trigger config.Trigger, r *http.Request, body []byte) error {
+	if trigger.Secret == "" {
+		return nil
+	}
+
+	if signature := r.Header.Get("X-Hub-Signature-256"); signature != "" {
+		got, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+		if err != nil {
+			return fmt.Errorf("malformed signature")
+		}
+		mac := hmac.New(sha256.New, []byte(trigger.Secret))
+		mac.Write(body)
+		if !hmac.Equal(got, mac.Sum(nil)) {
+			return fmt.Errorf("signature mismatch")
+		}
+		return nil
+	}
+
+	for _, header := range []string{"X-Trigger-Token", "X-Gitlab-Token"} {
+		if token := r.Header.Get(header); token != "" {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(trigger.Secret)) != 1 {
+				return fmt.Errorf("invalid token")
+			}
+			return nil
+		}
+	}
+
+	return fmt.Errorf("missing signature or token")
+}
+
+// writeTriggerEvent records the webhook of a run in trigger.json in its output directory
+func writeTriggerEvent(runDir string, event triggerEvent) error {
+	if err := os.MkdirAll(runDir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(event, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(runDir, "trigger.json"), data, 0644)
+}
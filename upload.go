@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"screenshot-tool/config"
+	"screenshot-tool/delivery"
+)
+
+// uploadHook returns a callback that uploads the artifacts of each captured URL,
+// keyed by their path below the output directory, or nil if uploads aren't configured.
+// Failed uploads are queued in the journal and retried like other deliveries.
+func uploadHook(ctx context.Context, cfg *config.Config, journal *delivery.Journal) func(config.URLConfig, string) {
+	if cfg.Upload == nil {
+		return nil
+	}
+
+	uploader, err := delivery.NewUploader(*cfg.Upload)
+	if err != nil {
+		log.Fatalf("Failed to set up artifact upload: %v", err)
+	}
+
+	baseDir := cfg.OutputDir
+	return func(urlConfig config.URLConfig, urlDir string) {
+		count, err := delivery.UploadDir(ctx, journal, uploader, baseDir, urlDir)
+		if err != nil {
+			log.Printf("ERROR: Failed to upload artifacts of %s: %v", urlConfig.Name, err)
+			return
+		}
+		log.Printf("Uploaded %d artifacts of %s to %s", count, urlConfig.Name, uploader.Target())
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"screenshot-tool/config"
+	"screenshot-tool/screenshot"
+)
+
+// logConfigWarnings logs the lint warnings of a configuration, so footguns show up
+// at the start of a run rather than hours into it
+func logConfigWarnings(cfg *config.Config) {
+	for _, warning := range config.Lint(cfg) {
+		log.Printf("Warning: Configuration: %s", warning)
+	}
+}
+
+// runValidate implements the validate command, which checks a configuration and prints
+// all of its problems at once without capturing anything
+func runValidate(args []string) {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	configPath := flags.String("config", "config.json", "Path to configuration file")
+	strict := flags.Bool("strict", false, "Exit with status 1 if there are warnings")
+	jsonOutput := flags.Bool("json", false, "Print the problems as a JSON array instead of text")
+	flags.Parse(args)
+
+	cfg, diagnostics := config.Diagnose(*configPath)
+
+	warnings := 0
+	for _, d := range diagnostics {
+		if d.Severity == "warning" {
+			warnings++
+		}
+	}
+
+	if *jsonOutput {
+		if diagnostics == nil {
+			diagnostics = []config.Diagnostic{}
+		}
+		data, _ := json.MarshalIndent(diagnostics, "", "  ")
+		fmt.Println(string(data))
+	} else {
+		for _, d := range diagnostics {
+			fmt.Println(d)
+		}
+		if cfg == nil {
+			fmt.Fprintf(os.Stderr, "%s is invalid: %d errors, %d warnings\n", *configPath, len(diagnostics)-warnings, warnings)
+		} else {
+			fmt.Printf("%s is valid: %d URLs, %d warnings\n", *configPath, len(cfg.URLs), warnings)
+			fmt.Printf("config hash: sha256:%s\n", screenshot.ConfigHash(cfg))
+		}
+	}
+
+	if cfg == nil {
+		os.Exit(2)
+	}
+	if *strict && warnings > 0 {
+		os.Exit(1)
+	}
+}
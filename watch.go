@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"screenshot-tool/config"
+	"screenshot-tool/screenshot"
+)
+
+// runWatch captures the configured URLs every interval until the context is cancelled.
+// Each iteration is written to outputDir/watch/timestamp. With change detection, every
+// iteration is compared with the previous one, which serves as its baseline. If archive is
+// set, each iteration is also bundled into an archive of that format next to its directory.
+func runWatch(ctx context.Context, cfg *config.Config, interval time.Duration, detectChanges bool, archive string, afterURL func(config.URLConfig, string), afterRun func(*screenshot.RunSummary)) {
+	watchDir := filepath.Join(cfg.OutputDir, "watch")
+	baselineDir := filepath.Join(watchDir, ".previous")
+
+	for iteration := 1; ; iteration++ {
+		startTime := time.Now()
+
+		runCfg := *cfg
+		runCfg.OutputDir = filepath.Join(watchDir, startTime.Format("20060102-150405"))
+		if cfg.Label != "" {
+			runCfg.OutputDir += "_" + screenshot.SanitizeFilename(cfg.Label)
+		}
+		if detectChanges {
+			diff := config.Diff{Threshold: 0.999, SSIMThreshold: 0.98, MaxHashDistance: 5}
+			if cfg.Diff != nil {
+				diff = *cfg.Diff
+				diff.Retry = nil
+			}
+			diff.BaselineDir = baselineDir
+			runCfg.Diff = &diff
+		}
+
+		label := fmt.Sprintf("Watch iteration %d", iteration)
+		captureRun(ctx, &runCfg, label, afterURL, tagRun(afterRun, "watch", ""), nil)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if archive != "" {
+			archiveRunDir(archive, runCfg.OutputDir)
+		}
+
+		if detectChanges {
+			if changed := changedViewports(runCfg.OutputDir); len(changed) > 0 {
+				log.Printf("%s: changes detected since the previous iteration in %d viewports:", label, len(changed))
+				for _, viewport := range changed {
+					log.Printf("  %s", viewport)
+				}
+			} else if iteration > 1 {
+				log.Printf("%s: no changes since the previous iteration", label)
+			}
+
+			if err := screenshot.CopyRunToBaselines(runCfg.OutputDir, baselineDir); err != nil {
+				log.Printf("%s: failed to keep captures for change detection: %v", label, err)
+			}
+		}
+
+		next := startTime.Add(interval)
+		log.Printf("Next watch iteration at %s", next.Format(time.RFC3339))
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// changedViewports lists the URLs and viewports of a run that mismatched their baseline
+func changedViewports(runDir string) []string {
+	manifests, _ := filepath.Glob(filepath.Join(runDir, "*", "manifest.json"))
+
+	var changed []string
+	for _, manifestPath := range manifests {
+		data, err := os.ReadFile(manifestPath)
+		if err != nil {
+			continue
+		}
+		var manifest screenshot.Manifest
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			continue
+		}
+
+		for _, vm := range manifest.Viewports {
+			if vm.Diff != nil && vm.Diff.Status == "mismatch" {
+				changed = append(changed, fmt.Sprintf("%s at %dx%d (similarity %.4f)", manifest.Name, vm.Width, vm.Height, vm.Diff.Similarity))
+			}
+		}
+	}
+	return changed
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"screenshot-tool/config"
+	"screenshot-tool/queue"
+	"screenshot-tool/screenshot"
+)
+
+// queuePollWait is how long a worker waits for a job before checking whether it should stop
+const queuePollWait = 20 * time.Second
+
+// captureJob is a URL of a run enqueued for the workers, with the defaults of the
+// producer's configuration applied. Passwords from secret managers are only referenced,
+// the workers resolve them with their own credentials.
+type captureJob struct {
+	Run   string           `json:"run"`             // Directory of the run below the workers' output directory
+	Label string           `json:"label,omitempty"` // Label of the run, e.g. a release or ticket
+	Index int              `json:"index"`           // 1-based position of the URL in the run
+	Total int              `json:"total"`           // URLs in the run
+	URL   config.URLConfig `json:"url"`
+}
+
+func runEnqueue(args []string) {
+	flags := flag.NewFlagSet("enqueue", flag.ExitOnError)
+	configPath := flags.String("config", "config.json", "Path to configuration file")
+	run := flags.String("run", "", "Directory of the run below the workers' output directory, defaults to the current time")
+	label := flags.String("label", "", "Label of the run, e.g. a release or ticket, added to the directory names, manifests and notifications")
+	flags.Parse(args)
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	if cfg.Queue == nil {
+		log.Fatalf("No work queue configured, add a queue object to the configuration")
+	}
+	logConfigWarnings(cfg)
+	if len(cfg.URLs) == 0 {
+		log.Fatalf("No URLs to process")
+	}
+
+	if *run == "" {
+		*run = time.Now().Format("20060102-150405")
+	}
+	*run = screenshot.SanitizeFilename(*run)
+
+	q, err := queue.New(*cfg.Queue)
+	if err != nil {
+		log.Fatalf("Failed to connect to the queue: %v", err)
+	}
+	defer q.Close()
+
+	ctx := context.Background()
+	for i, urlConfig := range cfg.URLs {
+		if urlConfig.Proxy != nil && urlConfig.Proxy.PasswordSecret != "" {
+			proxy := *urlConfig.Proxy
+			proxy.Password = ""
+			urlConfig.Proxy = &proxy
+		}
+		job, err := json.Marshal(captureJob{
+			Run:   *run,
+			Label: *label,
+			Index: i + 1,
+			Total: len(cfg.URLs),
+			URL:   urlConfig,
+		})
+		if err != nil {
+			log.Fatalf("Failed to encode the job of %s: %v", urlConfig.Name, err)
+		}
+		if err := q.Push(ctx, job); err != nil {
+			log.Fatalf("Failed to enqueue %s, %d of %d URLs were enqueued: %v", urlConfig.Name, i, len(cfg.URLs), err)
+		}
+	}
+	log.Printf("Enqueued %d URLs of run %s on %s", len(cfg.URLs), *run, q.Target())
+}
+
+func runWorker(args []string) {
+	flags := flag.NewFlagSet("worker", flag.ExitOnError)
+	configPath := flags.String("config", "config.json", "Path to configuration file")
+	chromeMode := flags.String("chrome", "auto", "Chrome execution mode: 'local', 'docker', or 'auto'")
+	idle := flags.Duration("idle", 0, "Exit once no job arrived for this long, e.g. 5m; runs until interrupted if 0")
+	flags.Parse(args)
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	if cfg.Queue == nil {
+		log.Fatalf("No work queue configured, add a queue object to the configuration")
+	}
+	cfg.ChromeMode = *chromeMode
+	logConfigWarnings(cfg)
+
+	journal, err := openJournal(cfg)
+	if err != nil {
+		log.Fatalf("Failed to open delivery journal: %v", err)
+	}
+
+	// Jobs being captured are finished when interrupted, only taking new ones stops
+	captureCtx, cancelCaptures := context.WithCancel(context.Background())
+	defer cancelCaptures()
+	stop, stopWorkers := context.WithCancel(context.Background())
+	signalChan := make(chan os.Signal, 2)
+	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signalChan
+		log.Printf("Received signal: %v, finishing the jobs being captured", sig)
+		stopWorkers()
+		sig = <-signalChan
+		log.Printf("Received signal: %v, stopping", sig)
+		cancelCaptures()
+	}()
+
+	afterURL := uploadHook(captureCtx, cfg, journal)
+	log.Printf("Starting %d workers", cfg.Concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			captureJobs(stop, captureCtx, cfg, afterURL, *idle)
+		}()
+	}
+	wg.Wait()
+	cleanupDockerContainer()
+}
+
+// captureJobs takes jobs from the queue and captures them until stop ends, or no job
+// arrived for idle if it's not 0
+func captureJobs(stop, captureCtx context.Context, cfg *config.Config, afterURL func(config.URLConfig, string), idle time.Duration) {
+	q, err := queue.New(*cfg.Queue)
+	if err != nil {
+		log.Printf("ERROR: Failed to connect to the queue: %v", err)
+		return
+	}
+	defer q.Close()
+
+	lastJob := time.Now()
+	for stop.Err() == nil {
+		msg, err := q.Pop(stop, queuePollWait)
+		if err != nil {
+			if stop.Err() != nil {
+				return
+			}
+			log.Printf("Warning: Failed to take a job from %s: %v", q.Target(), err)
+			sleepUntil(stop, 5*time.Second)
+			continue
+		}
+		if msg == nil {
+			if idle > 0 && time.Since(lastJob) >= idle {
+				log.Printf("No job arrived for %v, stopping worker", idle)
+				return
+			}
+			continue
+		}
+
+		var job captureJob
+		if err := json.Unmarshal(msg.Body, &job); err != nil || job.Run == "" {
+			log.Printf("ERROR: Dropping invalid job %.200q: %v", msg.Body, err)
+		} else if err := captureQueued(captureCtx, cfg, job, afterURL); err != nil {
+			log.Printf("ERROR: Capturing %s of run %s failed: %v", job.URL.Name, job.Run, err)
+		}
+		lastJob = time.Now()
+
+		// Failed captures are acknowledged as well, their failure is recorded with the captures
+		if err := msg.Ack(captureCtx); err != nil {
+			log.Printf("Warning: Failed to acknowledge job: %v", err)
+		}
+	}
+}
+
+// captureQueued captures the URL of a job into the directory of its run
+func captureQueued(ctx context.Context, cfg *config.Config, job captureJob, afterURL func(config.URLConfig, string)) error {
+	runCfg := *cfg
+	runCfg.OutputDir = filepath.Join(cfg.OutputDir, screenshot.SanitizeFilename(job.Run))
+	runCfg.Label = job.Label
+	if err := cfg.ResolveProxyPassword(job.URL.Proxy); err != nil {
+		return err
+	}
+	runCfg.URLs = []config.URLConfig{job.URL}
+	if err := os.MkdirAll(runCfg.OutputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create run directory: %w", err)
+	}
+
+	log.Printf("Capturing %s (%d of %d) of run %s", job.URL.Name, job.Index, job.Total, job.Run)
+	screenshoter := screenshot.NewScreenshoter(&runCfg)
+	screenshoter.AfterURL = afterURL
+	_, err := screenshoter.CaptureRunURL(ctx, job.Index, job.Total, job.URL)
+	return err
+}
+
+// sleepUntil waits for d or until ctx ends
+func sleepUntil(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}